@@ -62,14 +62,15 @@ func (bn *blockNode) indexKey() (key []byte) {
 	return
 }
 
-func (bn *blockNode) initBlockNode(block *types.Block, parent *blockNode) {
+func (bn *blockNode) initBlockNode(height uint32, block *types.Block, parent *blockNode) {
 	bn.hash = block.SignedHeader.BlockHash
 	bn.parent = nil
-	bn.height = 0
+	bn.height = height
+	bn.count = 0
 
 	if parent != nil {
 		bn.parent = parent
-		bn.height = parent.height + 1
+		bn.count = parent.count + 1
 	}
 }
 
@@ -49,13 +49,28 @@ var (
 	accountAddress          proto.AccountAddress
 )
 
+// nodeCaller defines the rpc caller of the main chain to call the other block producers.
+type nodeCaller interface {
+	CallNode(node proto.NodeID, method string, args interface{}, reply interface{}) error
+}
+
 // Chain defines the main chain.
 type Chain struct {
 	db *bolt.DB
 	ms *metaState
 	bi *blockIndex
 	rt *rt
-	cl *rpc.Caller
+	cl nodeCaller
+	vs *voteState
+	// provider allocates the miners of the databases created by the produced blocks, and
+	// deploys them.
+	provider DatabaseProvider
+
+	// pushMutex serializes block pushing.
+	pushMutex sync.Mutex
+	// statusHandlers are the subscribers of the database status events.
+	statusMutex    sync.RWMutex
+	statusHandlers []func(*DatabaseStatusEvent)
 
 	blocksFromRPC chan *pt.Block
 	pendingTxs    chan pi.Transaction
@@ -119,6 +134,11 @@ func NewChain(cfg *Config) (*Chain, error) {
 		return nil, err
 	}
 
+	vs, err := loadVoteState(db)
+	if err != nil {
+		return nil, err
+	}
+
 	// create chain
 	chain := &Chain{
 		db:            db,
@@ -126,6 +146,8 @@ func NewChain(cfg *Config) (*Chain, error) {
 		bi:            newBlockIndex(),
 		rt:            newRuntime(cfg, accountAddress),
 		cl:            rpc.NewCaller(),
+		vs:            vs,
+		provider:      cfg.Provider,
 		blocksFromRPC: make(chan *pt.Block),
 		pendingTxs:    make(chan pi.Transaction),
 		stopCh:        make(chan struct{}),
@@ -166,12 +188,19 @@ func LoadChain(cfg *Config) (chain *Chain, err error) {
 		return nil, err
 	}
 
+	vs, err := loadVoteState(db)
+	if err != nil {
+		return nil, err
+	}
+
 	chain = &Chain{
 		db:            db,
 		ms:            newMetaState(),
 		bi:            newBlockIndex(),
 		rt:            newRuntime(cfg, accountAddress),
 		cl:            rpc.NewCaller(),
+		vs:            vs,
+		provider:      cfg.Provider,
 		blocksFromRPC: make(chan *pt.Block),
 		pendingTxs:    make(chan pi.Transaction),
 		stopCh:        make(chan struct{}),
@@ -222,7 +251,7 @@ func LoadChain(cfg *Config) (chain *Chain, err error) {
 				}
 			}
 
-			nodes[index].initBlockNode(block, parent)
+			nodes[index].initBlockNode(chain.rt.getHeightFromTime(block.Timestamp()), block, parent)
 			chain.bi.addBlock(&nodes[index])
 			last = &nodes[index]
 			index++
@@ -231,6 +260,11 @@ func LoadChain(cfg *Config) (chain *Chain, err error) {
 			return err
 		}
 
+		// Relink the head node, which is not encoded in state
+		if state.Node = chain.bi.lookupNode(&state.Head); state.Node == nil {
+			return ErrCorruptedIndex
+		}
+
 		// Reload state
 		if err = chain.ms.reloadProcedure()(tx); err != nil {
 			return
@@ -247,14 +281,25 @@ func LoadChain(cfg *Config) (chain *Chain, err error) {
 
 // checkBlock has following steps: 1. check parent block 2. checkTx 2. merkle tree 3. Hash 4. Signature.
 func (c *Chain) checkBlock(b *pt.Block) (err error) {
-	// TODO(lambda): process block fork
-	if !b.ParentHash().IsEqual(&c.rt.getHead().Head) {
+	// the parent must be a known block, the ones not extending the head are rejected by pushBlock
+	if !c.bi.hasBlock(*b.ParentHash()) {
 		log.WithFields(log.Fields{
 			"head":            c.rt.getHead().Head.String(),
 			"height":          c.rt.getHead().Height,
 			"received_parent": b.ParentHash(),
-		}).Debug("invalid parent")
-		return ErrParentNotMatch
+		}).Debug("parent not found")
+		return ErrParentNotFound
+	}
+
+	if len(b.Transactions) > MaxBlockTxs {
+		return ErrTooManyTransactions
+	}
+	var size int
+	for _, v := range b.Transactions {
+		size += v.Msgsize()
+	}
+	if size > MaxBlockTxsSize {
+		return ErrTooManyTransactions
 	}
 
 	rootHash := merkle.NewMerkle(b.GetTxHashes()).GetRoot()
@@ -294,17 +339,13 @@ func (c *Chain) pushBlockWithoutCheck(b *pt.Block) error {
 		return err
 	}
 
+	settled := c.loadSettledSQLChains(b)
 	err = c.db.Update(func(tx *bolt.Tx) (err error) {
 		err = tx.Bucket(metaBucket[:]).Bucket(metaBlockIndexBucket).Put(node.indexKey(), encBlock.Bytes())
 		if err != nil {
 			return
 		}
-		for _, v := range b.Transactions {
-			if err = c.ms.applyTransactionProcedure(v)(tx); err != nil {
-				return
-			}
-		}
-		err = c.ms.partialCommitProcedure(b.Transactions)(tx)
+		err = c.ms.applyBlockProcedure(b)(tx)
 		if err != nil {
 			return
 		}
@@ -316,7 +357,11 @@ func (c *Chain) pushBlockWithoutCheck(b *pt.Block) error {
 		c.bi.addBlock(node)
 		return
 	})
-	return err
+	if err != nil {
+		return err
+	}
+	c.publishSettlement(b, settled)
+	return nil
 }
 
 func (c *Chain) pushGenesisBlock(b *pt.Block) (err error) {
@@ -327,18 +372,47 @@ func (c *Chain) pushGenesisBlock(b *pt.Block) (err error) {
 	return
 }
 
+// pushBlock checks and commits the block, the block must carry the quorum certificate of the
+// precommits from the block producers. The blocks committed with quorum certificates are final,
+// so a block which does not extend the current head conflicts with the best chain and is
+// rejected.
 func (c *Chain) pushBlock(b *pt.Block) error {
+	c.pushMutex.Lock()
+	defer c.pushMutex.Unlock()
+
+	if c.bi.hasBlock(*b.BlockHash()) {
+		// already known
+		return nil
+	}
+
 	err := c.checkBlock(b)
 	if err != nil {
 		err = errors.Wrap(err, "check block failed")
 		return err
 	}
 
+	err = c.checkCert(b)
+	if err != nil {
+		err = errors.Wrap(err, "check quorum certificate failed")
+		return err
+	}
+
+	if head := c.rt.getHead(); !b.ParentHash().IsEqual(&head.Head) {
+		log.WithFields(log.Fields{
+			"head":        head.Head.String(),
+			"head_height": head.Height,
+			"block":       b.BlockHash().String(),
+			"parent":      b.ParentHash().String(),
+		}).Warning("received certified block conflicting with the best chain")
+		return errors.Wrapf(ErrFinalizedBlock, "head %s at height %d", head.Head.String(), head.Height)
+	}
+
 	err = c.pushBlockWithoutCheck(b)
 	if err != nil {
 		return err
 	}
 
+	c.vs.prune(c.rt.getHeightFromTime(b.Timestamp()))
 	return nil
 }
 
@@ -348,30 +422,46 @@ func (c *Chain) produceBlock(now time.Time) error {
 		return err
 	}
 
-	b := &pt.Block{
-		SignedHeader: pt.SignedHeader{
-			Header: pt.Header{
-				Version:    blockVersion,
-				Producer:   c.rt.accountAddress,
-				ParentHash: c.rt.getHead().Head,
-				Timestamp:  now,
+	head := c.rt.getHead()
+	// the block locked by the local block producer is proposed again, otherwise the chain may
+	// stall if too many block producers are locked on it
+	b := c.vs.getLockedProposal(&head.Head)
+	if b != nil {
+		log.WithField("block", b).Debug("propose locked block again")
+	} else {
+		b = &pt.Block{
+			SignedHeader: pt.SignedHeader{
+				Header: pt.Header{
+					Version:    blockVersion,
+					Producer:   c.rt.accountAddress,
+					ParentHash: head.Head,
+					Timestamp:  now,
+				},
 			},
-		},
-		Transactions: c.ms.pullTxs(),
+		}
+		b.Transactions, b.Allocations = c.ms.packTxs(MaxBlockTxs, MaxBlockTxsSize, c.allocateDatabase)
+
+		err = b.PackAndSignBlock(priv)
+		if err != nil {
+			return err
+		}
+
+		log.WithField("block", b).Debug("produced new block")
 	}
 
-	err = b.PackAndSignBlock(priv)
+	err = c.runConsensus(b)
 	if err != nil {
 		return err
 	}
 
-	log.WithField("block", b).Debug("produced new block")
-
-	err = c.pushBlockWithoutCheck(b)
+	err = c.pushBlock(b)
 	if err != nil {
 		return err
 	}
 
+	// the proposer deploys the databases created in the block
+	c.goDeployDatabases(b)
+
 	peers := c.rt.getPeers()
 	wg := &sync.WaitGroup{}
 	for _, s := range peers.Servers {
@@ -405,6 +495,65 @@ func (c *Chain) produceBlock(now time.Time) error {
 	return err
 }
 
+// allocateDatabase allocates the miners of the database created by tx with the database
+// provider, it's only called by the block proposer. The public keys of the miners are taken from
+// the local key store and recorded in the allocation, so that the other block producers verify
+// the allocation by the block contents only.
+func (c *Chain) allocateDatabase(tx *pt.CreateDatabase) (a *pt.DatabaseAllocation, err error) {
+	if c.provider == nil {
+		err = ErrDatabaseAllocation
+		return
+	}
+	a = &pt.DatabaseAllocation{}
+	if a.DatabaseID, err = tx.DatabaseID(); err != nil {
+		return
+	}
+	var nodes []proto.NodeID
+	if nodes, err = c.provider.AllocateMiners(a.DatabaseID, &tx.ResourceMeta); err != nil {
+		return
+	}
+	a.Miners = make([]*pt.AllocatedMiner, len(nodes))
+	for i, v := range nodes {
+		var info *proto.Node
+		if info, err = kms.GetNodeInfo(v); err != nil {
+			err = errors.Wrapf(ErrDatabaseAllocation, "unknown miner %s: %v", v, err)
+			return
+		}
+		a.Miners[i] = &pt.AllocatedMiner{
+			NodeID:    v,
+			PublicKey: info.PublicKey,
+			Nonce:     info.Nonce,
+		}
+	}
+	return
+}
+
+// goDeployDatabases deploys the databases allocated by block b in background.
+func (c *Chain) goDeployDatabases(b *pt.Block) {
+	var provider = c.provider
+	if provider == nil {
+		return
+	}
+	var profiles []*pt.SQLChainProfile
+	for _, v := range b.Allocations {
+		if p, loaded := c.ms.loadSQLChainProfile(v.DatabaseID); loaded {
+			profiles = append(profiles, p)
+		}
+	}
+	if len(profiles) == 0 {
+		return
+	}
+	c.rt.wg.Add(1)
+	go func() {
+		defer c.rt.wg.Done()
+		for _, p := range profiles {
+			if err := provider.DeployDatabase(p); err != nil {
+				log.WithField("db", p.ID).WithError(err).Error("deploy database failed")
+			}
+		}
+	}()
+}
+
 func (c *Chain) produceBilling(br *pt.BillingRequest) (_ *pt.BillingRequest, err error) {
 	// TODO(lambda): simplify the function
 	if err = c.checkBillingRequest(br); err != nil {
@@ -419,11 +568,17 @@ func (c *Chain) produceBilling(br *pt.BillingRequest) (_ *pt.BillingRequest, err
 		receivers     = make([]*proto.AccountAddress, accountNumber)
 		fees          = make([]uint64, accountNumber)
 		rewards       = make([]uint64, accountNumber)
+		price         = uint64(gasPrice)
 	)
 
+	// use the gas price of the database if it's created on chain
+	if p, loaded := c.ms.loadSQLChainProfile(br.Header.DatabaseID); loaded && p.GasPrice > 0 {
+		price = p.GasPrice
+	}
+
 	for i, addrAndGas := range br.Header.GasAmounts {
 		receivers[i] = &addrAndGas.AccountAddress
-		fees[i] = addrAndGas.GasAmount * uint64(gasPrice)
+		fees[i] = addrAndGas.GasAmount * price
 		rewards[i] = 0
 	}
 
@@ -615,18 +770,15 @@ func (c *Chain) processBlocks() {
 				}
 				stash = append(stash, block)
 			} else {
-				// Process block
-				if h < c.rt.getNextTurn()-1 {
-					// TODO(lambda): check and add to fork list.
-				} else {
-					err := c.pushBlock(block)
-					if err != nil {
-						log.WithFields(log.Fields{
-							"block_hash":        block.BlockHash(),
-							"block_parent_hash": block.ParentHash(),
-							"block_timestamp":   block.Timestamp(),
-						}).Debug(err)
-					}
+				// Process block, the conflicting ones are rejected
+				err := c.pushBlock(block)
+				if err != nil {
+					log.WithFields(log.Fields{
+						"block_hash":        block.BlockHash(),
+						"block_parent_hash": block.ParentHash(),
+						"block_timestamp":   block.Timestamp(),
+						"block_height":      h,
+					}).Debug(err)
 				}
 
 				// Return all stashed blocks to pending channel
@@ -643,7 +795,7 @@ func (c *Chain) processBlocks() {
 }
 
 func (c *Chain) processTx(tx pi.Transaction) (err error) {
-	return c.db.Update(c.ms.applyTransactionProcedure(tx))
+	return c.db.Update(c.ms.addTxProcedure(tx))
 }
 
 func (c *Chain) processTxs() {
@@ -730,6 +882,18 @@ func (c *Chain) syncHead() {
 					}).WithError(err).Debug(
 						"Failed to fetch block from peer")
 				} else {
+					// fetch the missing ancestors if the local chain lags behind the peer
+					ancestors, err := c.fetchAncestors(s, resp.Block, resp.Count)
+					if err != nil {
+						log.WithFields(log.Fields{
+							"peer":   c.rt.getPeerInfoString(),
+							"remote": fmt.Sprintf("[%d/%d] %s", i, len(peers.Servers), s),
+							"block":  resp.Block.BlockHash().String(),
+						}).WithError(err).Debug("Failed to fetch ancestors from peer")
+					}
+					for _, b := range ancestors {
+						c.blocksFromRPC <- b
+					}
 					c.blocksFromRPC <- resp.Block
 					log.WithFields(log.Fields{
 						"peer":        c.rt.getPeerInfoString(),
@@ -757,6 +921,30 @@ func (c *Chain) syncHead() {
 	}
 }
 
+// fetchAncestors fetches the unknown ancestors of the block with the given count from the peer,
+// and returns them in order from the oldest one.
+func (c *Chain) fetchAncestors(
+	peer proto.NodeID, b *pt.Block, count uint32) (blocks []*pt.Block, err error,
+) {
+	for ; count > 0 && !c.bi.hasBlock(*b.ParentHash()); count-- {
+		req := &FetchBlockByCountReq{Count: count - 1}
+		resp := &FetchBlockResp{}
+		if err = c.cl.CallNode(peer, route.MCCFetchBlockByCount.String(), req, resp); err != nil {
+			return nil, err
+		}
+		if resp.Block == nil || !resp.Block.BlockHash().IsEqual(b.ParentHash()) {
+			// the peer returned a block which is not the parent
+			return nil, ErrParentNotFound
+		}
+		b = resp.Block
+		blocks = append(blocks, b)
+	}
+	for i, j := 0, len(blocks)-1; i < j; i, j = i+1, j-1 {
+		blocks[i], blocks[j] = blocks[j], blocks[i]
+	}
+	return
+}
+
 // Stop stops the main process of the sql-chain.
 func (c *Chain) Stop() (err error) {
 	// Stop main process
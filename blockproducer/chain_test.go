@@ -31,6 +31,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/types"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -122,6 +123,10 @@ func TestChain(t *testing.T) {
 			block, err := generateRandomBlockWithTransactions(chain.rt.getHead().Head, tbs)
 			So(err, ShouldBeNil)
 			err = chain.pushBlock(block)
+			So(errors.Cause(err), ShouldEqual, ErrMissingQuorumCert)
+			err = generateBlockCert(block, peers, chain.rt.getHeightFromTime(block.Timestamp()))
+			So(err, ShouldBeNil)
+			err = chain.pushBlock(block)
 			So(err, ShouldBeNil)
 			nextNonce, err := chain.ms.nextNonce(testAddress1)
 			So(err, ShouldBeNil)
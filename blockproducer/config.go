@@ -26,8 +26,46 @@ import (
 
 const (
 	blockVersion int32 = 0x01
+
+	// StorageProofPenalty defines the max stable coin amount slashed from a miner for each
+	// reported storage proof failure, the slashed amount is added to the database deposit.
+	StorageProofPenalty uint64 = 10
+)
+
+var (
+	// MaxPendingTxsPerAccount defines the max number of pending transactions of an account in
+	// the transaction pool.
+	MaxPendingTxsPerAccount = 64
+	// MaxPendingTxs defines the max number of pending transactions in the transaction pool.
+	// When the pool is full, the pending transaction with the lowest fee is evicted for a new
+	// transaction with a higher fee.
+	MaxPendingTxs = 8192
+	// MaxBlockTxs defines the max number of transactions packed in a block.
+	MaxBlockTxs = 4096
+	// MaxBlockTxsSize defines the max estimated size in bytes of the transactions packed in a
+	// block.
+	MaxBlockTxsSize = 4 << 20
+
+	// DatabaseGracePeriods defines the number of billing periods that a database with low
+	// deposit stays in the grace period before it's frozen for writes.
+	DatabaseGracePeriods uint32 = 3
+	// DatabaseFrozenPeriods defines the number of billing periods that a database with low
+	// deposit stays frozen before it's dropped.
+	DatabaseFrozenPeriods uint32 = 3
 )
 
+// DatabaseProvider defines the database provisioning used by the main chain to allocate and
+// deploy the databases created by transactions.
+type DatabaseProvider interface {
+	// AllocateMiners returns the miner nodes for database dbID. It's only called by the block
+	// proposer, the allocation is recorded in the block and verified by the other block producers.
+	AllocateMiners(dbID proto.DatabaseID, meta *types.ResourceMeta) ([]proto.NodeID, error)
+	// DeployDatabase deploys the database described by profile to its miner nodes.
+	DeployDatabase(profile *types.SQLChainProfile) error
+	// UndeployDatabase drops the database described by profile from its miner nodes.
+	UndeployDatabase(profile *types.SQLChainProfile) error
+}
+
 // Config is the main chain configuration.
 type Config struct {
 	Genesis *types.Block
@@ -41,6 +79,10 @@ type Config struct {
 
 	Period time.Duration
 	Tick   time.Duration
+
+	// Provider allocates and deploys the databases created by transactions, the database
+	// creation transactions are not packed by the node if it's not set.
+	Provider DatabaseProvider
 }
 
 // NewConfig creates new config.
@@ -0,0 +1,470 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/coreos/bbolt"
+	"github.com/pkg/errors"
+)
+
+var (
+	metaVoteBucket  = []byte("covenantsql-vote-bucket")
+	metaVoteLockKey = []byte("lock")
+)
+
+// lockedBlock is the block precommitted by the local block producer at height Height, which is
+// not finalized yet.
+type lockedBlock struct {
+	Height uint32
+	Block  *pt.Block
+}
+
+// voteState records the votes of the local block producer by height, so that it never votes
+// for two different blocks of the same type at the same height. The votes and the lock are
+// persisted, so the rule still holds after restart.
+type voteState struct {
+	sync.Mutex
+	db    *bolt.DB
+	votes map[pt.VoteType]map[uint32]hash.Hash
+	// proposals are the prevoted blocks by height.
+	proposals map[uint32]*pt.Block
+	// lock is the last precommitted block, the local block producer only prevotes the proposals
+	// extending it until it is finalized or a quorum prevotes a later block.
+	lock *lockedBlock
+}
+
+func voteKey(t pt.VoteType, h uint32) (key []byte) {
+	key = make([]byte, 5)
+	key[0] = byte(t)
+	binary.BigEndian.PutUint32(key[1:], h)
+	return
+}
+
+// loadVoteState loads the persisted votes of the local block producer from db.
+func loadVoteState(db *bolt.DB) (s *voteState, err error) {
+	s = &voteState{
+		db: db,
+		votes: map[pt.VoteType]map[uint32]hash.Hash{
+			pt.VoteTypePrevote:   make(map[uint32]hash.Hash),
+			pt.VoteTypePrecommit: make(map[uint32]hash.Hash),
+		},
+		proposals: make(map[uint32]*pt.Block),
+	}
+	if err = db.Update(func(tx *bolt.Tx) (err error) {
+		bucket, err := tx.Bucket(metaBucket[:]).CreateBucketIfNotExists(metaVoteBucket)
+		if err != nil {
+			return
+		}
+		if enc := bucket.Get(metaVoteLockKey); enc != nil {
+			s.lock = &lockedBlock{}
+			if err = utils.DecodeMsgPack(enc, s.lock); err != nil {
+				return
+			}
+		}
+		return bucket.ForEach(func(k, v []byte) (err error) {
+			if len(k) != 5 {
+				return
+			}
+			var (
+				t  = pt.VoteType(k[0])
+				bh hash.Hash
+			)
+			if _, ok := s.votes[t]; !ok {
+				return
+			}
+			if err = bh.SetBytes(v); err != nil {
+				return
+			}
+			s.votes[t][binary.BigEndian.Uint32(k[1:])] = bh
+			return
+		})
+	}); err != nil {
+		s = nil
+		err = errors.Wrap(err, "load votes failed")
+	}
+	return
+}
+
+// vote records the vote on block bh at height h, it returns ErrConflictVote if another block
+// has been voted with the same type at that height.
+func (s *voteState) vote(t pt.VoteType, h uint32, bh hash.Hash) error {
+	s.Lock()
+	defer s.Unlock()
+	return s.voteWith(t, h, bh, nil)
+}
+
+func (s *voteState) voteWith(
+	t pt.VoteType, h uint32, bh hash.Hash, fn func(bucket *bolt.Bucket) error,
+) (
+	err error,
+) {
+	if voted, ok := s.votes[t][h]; ok {
+		if !voted.IsEqual(&bh) {
+			return ErrConflictVote
+		}
+		if fn == nil {
+			return
+		}
+	}
+	if err = s.db.Update(func(tx *bolt.Tx) (err error) {
+		bucket := tx.Bucket(metaBucket[:]).Bucket(metaVoteBucket)
+		if err = bucket.Put(voteKey(t, h), bh[:]); err != nil {
+			return
+		}
+		if fn != nil {
+			err = fn(bucket)
+		}
+		return
+	}); err != nil {
+		return errors.Wrap(err, "persist vote failed")
+	}
+	s.votes[t][h] = bh
+	return
+}
+
+// prevote records the prevote on block b at height h, the block must extend the locked block
+// unless it is the locked block itself.
+func (s *voteState) prevote(h uint32, b *pt.Block, head *blockNode) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	if l := s.lock; l != nil && !l.Block.BlockHash().IsEqual(b.BlockHash()) {
+		if ancestor := head.ancestor(l.Height); ancestor == nil ||
+			!ancestor.hash.IsEqual(l.Block.BlockHash()) {
+			return errors.Wrapf(ErrLockedOnOtherBlock, "locked on block %s at height %d",
+				l.Block.BlockHash().String(), l.Height)
+		}
+	}
+	if err = s.voteWith(pt.VoteTypePrevote, h, *b.BlockHash(), nil); err != nil {
+		return
+	}
+	s.proposals[h] = b
+	return
+}
+
+// precommit records the precommit on the prevoted block bh at height h, and locks the local block
+// producer on it. A lock on a later block is never released by the prevotes of an earlier block.
+func (s *voteState) precommit(h uint32, bh hash.Hash) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	b, ok := s.proposals[h]
+	if !ok || !b.BlockHash().IsEqual(&bh) {
+		return ErrUnknownProposal
+	}
+	if l := s.lock; l != nil && l.Height > h {
+		return errors.Wrapf(ErrLockedOnOtherBlock, "locked on block %s at height %d",
+			l.Block.BlockHash().String(), l.Height)
+	}
+	var (
+		lock = &lockedBlock{Height: h, Block: b}
+		enc  *bytes.Buffer
+	)
+	if enc, err = utils.EncodeMsgPack(lock); err != nil {
+		return
+	}
+	if err = s.voteWith(pt.VoteTypePrecommit, h, bh, func(bucket *bolt.Bucket) error {
+		return bucket.Put(metaVoteLockKey, enc.Bytes())
+	}); err != nil {
+		return
+	}
+	s.lock = lock
+	return
+}
+
+// hasVoted returns whether block bh has been voted with the given type at height h.
+func (s *voteState) hasVoted(t pt.VoteType, h uint32, bh hash.Hash) bool {
+	s.Lock()
+	defer s.Unlock()
+	voted, ok := s.votes[t][h]
+	return ok && voted.IsEqual(&bh)
+}
+
+// getLockedProposal returns the locked block if it is a child of the head, which should be
+// proposed again instead of a new block.
+func (s *voteState) getLockedProposal(head *hash.Hash) *pt.Block {
+	s.Lock()
+	defer s.Unlock()
+	if s.lock == nil || !s.lock.Block.ParentHash().IsEqual(head) {
+		return nil
+	}
+	return s.lock.Block
+}
+
+// prune drops the votes and the lock at heights up to h, which are finalized.
+func (s *voteState) prune(h uint32) {
+	s.Lock()
+	defer s.Unlock()
+	if err := s.db.Update(func(tx *bolt.Tx) (err error) {
+		bucket := tx.Bucket(metaBucket[:]).Bucket(metaVoteBucket)
+		for t, v := range s.votes {
+			for k := range v {
+				if k <= h {
+					if err = bucket.Delete(voteKey(t, k)); err != nil {
+						return
+					}
+				}
+			}
+		}
+		if s.lock != nil && s.lock.Height <= h {
+			err = bucket.Delete(metaVoteLockKey)
+		}
+		return
+	}); err != nil {
+		// the stale votes are pruned again next time
+		log.WithError(err).Warning("prune votes failed")
+		return
+	}
+	for _, v := range s.votes {
+		for k := range v {
+			if k <= h {
+				delete(v, k)
+			}
+		}
+	}
+	for k := range s.proposals {
+		if k <= h {
+			delete(s.proposals, k)
+		}
+	}
+	if s.lock != nil && s.lock.Height <= h {
+		s.lock = nil
+	}
+}
+
+// getProposer returns the block producer who should propose the block at height h.
+func (c *Chain) getProposer(h uint32) (proto.NodeID, error) {
+	peers := c.rt.getPeers()
+	if len(peers.Servers) == 0 {
+		return "", ErrNoBlockProducer
+	}
+	return peers.Servers[h%uint32(len(peers.Servers))], nil
+}
+
+// checkProposal checks the block proposed at height h before prevoting it.
+func (c *Chain) checkProposal(b *pt.Block, h uint32) (err error) {
+	var (
+		proposer proto.NodeID
+		pub      *asymmetric.PublicKey
+	)
+	if head := c.rt.getHead(); !b.ParentHash().IsEqual(&head.Head) {
+		return errors.Wrapf(ErrParentNotMatch, "head %s at height %d", head.Head.String(), head.Height)
+	}
+	if err = c.checkBlock(b); err != nil {
+		return
+	}
+	if err = b.SignedHeader.Verify(); err != nil {
+		return
+	}
+	// the miners allocated by the proposer are verified again when the block is applied
+	if err = checkAllocations(b.Transactions, b.Allocations); err != nil {
+		return
+	}
+	if proposer, err = c.getProposer(h); err != nil {
+		return
+	}
+	if pub, err = kms.GetPublicKey(proposer); err != nil {
+		return
+	}
+	if !pub.IsEqual(b.SignedHeader.Signee) {
+		return errors.Wrapf(ErrInvalidProposer, "expected proposer %s at height %d", proposer, h)
+	}
+	return
+}
+
+// checkCert checks that the block is committed with the precommits from a quorum of the block
+// producers.
+func (c *Chain) checkCert(b *pt.Block) (err error) {
+	if b.Cert == nil {
+		return ErrMissingQuorumCert
+	}
+	if b.Cert.Type != pt.VoteTypePrecommit ||
+		b.Cert.Height != c.rt.getHeightFromTime(b.Timestamp()) ||
+		!b.Cert.BlockHash.IsEqual(b.BlockHash()) {
+		return ErrInvalidQuorumCert
+	}
+	return b.Cert.Verify(c.rt.getPeers())
+}
+
+func (c *Chain) signVote(t pt.VoteType, h uint32, bh hash.Hash) (v *pt.Vote, err error) {
+	var priv *asymmetric.PrivateKey
+	if priv, err = kms.GetLocalPrivateKey(); err != nil {
+		return
+	}
+	v = pt.NewVote(&pt.VoteHeader{
+		Type:      t,
+		Height:    h,
+		BlockHash: bh,
+		Voter:     c.rt.nodeID,
+	})
+	if err = v.Sign(priv); err != nil {
+		v = nil
+	}
+	return
+}
+
+// prevote checks the proposed block and returns the signed prevote of the local block producer.
+func (c *Chain) prevote(b *pt.Block) (v *pt.Vote, err error) {
+	if b == nil {
+		return nil, ErrNoSuchBlock
+	}
+	var h = c.rt.getHeightFromTime(b.Timestamp())
+	if err = c.checkProposal(b, h); err != nil {
+		return
+	}
+	if err = c.vs.prevote(h, b, c.rt.getHead().Node); err != nil {
+		return
+	}
+	return c.signVote(pt.VoteTypePrevote, h, *b.BlockHash())
+}
+
+// precommit checks the prevote quorum certificate and returns the signed precommit of the local
+// block producer. The block must have been prevoted locally, and the local block producer is
+// locked on it since then.
+func (c *Chain) precommit(cert *pt.QuorumCert) (v *pt.Vote, err error) {
+	if cert == nil {
+		return nil, ErrMissingQuorumCert
+	}
+	if cert.Type != pt.VoteTypePrevote {
+		return nil, ErrInvalidQuorumCert
+	}
+	if !c.vs.hasVoted(pt.VoteTypePrevote, cert.Height, cert.BlockHash) {
+		return nil, ErrUnknownProposal
+	}
+	if err = cert.Verify(c.rt.getPeers()); err != nil {
+		return
+	}
+	if err = c.vs.precommit(cert.Height, cert.BlockHash); err != nil {
+		return
+	}
+	return c.signVote(pt.VoteTypePrecommit, cert.Height, cert.BlockHash)
+}
+
+// collectVotes calls the other block producers concurrently and returns as soon as the votes
+// from a quorum are collected, or all the calls are returned, or the timeout is reached.
+func (c *Chain) collectVotes(
+	t pt.VoteType, own *pt.Vote, call func(proto.NodeID) (*pt.Vote, error),
+) (
+	votes []*pt.Vote,
+) {
+	var (
+		peers   = c.rt.getPeers()
+		quorum  = pt.QuorumSize(len(peers.Servers))
+		resultC = make(chan *pt.Vote, len(peers.Servers))
+		pending int
+		timer   = time.NewTimer(c.rt.period / 2)
+	)
+	defer timer.Stop()
+
+	votes = append(votes, own)
+	for _, s := range peers.Servers {
+		if s.IsEqual(&c.rt.nodeID) {
+			continue
+		}
+		pending++
+		go func(id proto.NodeID) {
+			v, err := call(id)
+			if err == nil {
+				if v == nil || v.Type != t || v.Voter != id {
+					err = pt.ErrVoteMismatch
+				} else {
+					err = v.Verify()
+				}
+			}
+			if err != nil {
+				log.WithFields(log.Fields{
+					"peer":   c.rt.getPeerInfoString(),
+					"remote": id,
+					"type":   t.String(),
+				}).WithError(err).Debug("failed to collect vote")
+				v = nil
+			}
+			resultC <- v
+		}(s)
+	}
+
+	for ; pending > 0 && len(votes) < quorum; pending-- {
+		select {
+		case v := <-resultC:
+			if v != nil {
+				votes = append(votes, v)
+			}
+		case <-timer.C:
+			return
+		}
+	}
+	return
+}
+
+// runConsensus runs the prevote and precommit rounds on the block proposed by the local block
+// producer. The quorum certificate of the precommits is attached to the block on success.
+func (c *Chain) runConsensus(b *pt.Block) (err error) {
+	var (
+		h       = c.rt.getHeightFromTime(b.Timestamp())
+		bh      = *b.BlockHash()
+		quorum  = pt.QuorumSize(len(c.rt.getPeers().Servers))
+		own     *pt.Vote
+		prevote *pt.QuorumCert
+		commit  *pt.QuorumCert
+	)
+
+	// prevote round
+	if own, err = c.prevote(b); err != nil {
+		return errors.Wrap(err, "prevote local block failed")
+	}
+	prevote = pt.NewQuorumCert(pt.VoteTypePrevote, h, bh, c.collectVotes(
+		pt.VoteTypePrevote, own, func(id proto.NodeID) (*pt.Vote, error) {
+			req := &ProposeBlockReq{Block: b}
+			resp := &ProposeBlockResp{}
+			err := c.cl.CallNode(id, route.MCCProposeBlock.String(), req, resp)
+			return resp.Vote, err
+		},
+	))
+	if len(prevote.Votes) < quorum {
+		return errors.Wrapf(pt.ErrNoQuorum, "got %d prevotes", len(prevote.Votes))
+	}
+
+	// precommit round
+	if own, err = c.precommit(prevote); err != nil {
+		return errors.Wrap(err, "precommit local block failed")
+	}
+	commit = pt.NewQuorumCert(pt.VoteTypePrecommit, h, bh, c.collectVotes(
+		pt.VoteTypePrecommit, own, func(id proto.NodeID) (*pt.Vote, error) {
+			req := &PrecommitBlockReq{Cert: prevote}
+			resp := &PrecommitBlockResp{}
+			err := c.cl.CallNode(id, route.MCCPrecommitBlock.String(), req, resp)
+			return resp.Vote, err
+		},
+	))
+	if len(commit.Votes) < quorum {
+		return errors.Wrapf(pt.ErrNoQuorum, "got %d precommits", len(commit.Votes))
+	}
+
+	b.Cert = commit
+	return
+}
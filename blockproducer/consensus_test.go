@@ -0,0 +1,361 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/conf"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var errTestNodeUnreachable = errors.New("node unreachable")
+
+// testNetwork is the local multi-BP test harness, it dispatches the rpc calls between the
+// block producer chains in the same process.
+type testNetwork struct {
+	sync.RWMutex
+	chains  map[proto.NodeID]*Chain
+	offline map[proto.NodeID]bool
+}
+
+func (n *testNetwork) setOffline(node proto.NodeID, offline bool) {
+	n.Lock()
+	defer n.Unlock()
+	n.offline[node] = offline
+}
+
+// testCaller is the nodeCaller of a block producer chain in the test network.
+type testCaller struct {
+	*testNetwork
+	self proto.NodeID
+}
+
+// CallNode implements nodeCaller.CallNode, the caller node id is set to the request envelope
+// like the rpc server codec does.
+func (c *testCaller) CallNode(node proto.NodeID, method string, args interface{}, reply interface{}) error {
+	if req, ok := args.(interface{ SetNodeID(*proto.RawNodeID) }); ok {
+		req.SetNodeID(c.self.ToRawNodeID())
+	}
+	return c.testNetwork.CallNode(node, method, args, reply)
+}
+
+// CallNode dispatches the rpc call to the target chain.
+func (n *testNetwork) CallNode(node proto.NodeID, method string, args interface{}, reply interface{}) error {
+	n.RLock()
+	c, ok := n.chains[node]
+	offline := n.offline[node]
+	n.RUnlock()
+	if !ok || offline {
+		return errTestNodeUnreachable
+	}
+
+	s := &ChainRPCService{chain: c}
+	switch method {
+	case route.MCCProposeBlock.String():
+		return s.ProposeBlock(args.(*ProposeBlockReq), reply.(*ProposeBlockResp))
+	case route.MCCPrecommitBlock.String():
+		return s.PrecommitBlock(args.(*PrecommitBlockReq), reply.(*PrecommitBlockResp))
+	case route.MCCAdviseNewBlock.String():
+		// push block synchronously instead of the block processing cycle
+		return c.pushBlock(args.(*AdviseNewBlockReq).Block)
+	}
+	return errors.Errorf("unknown method: %s", method)
+}
+
+func newTestNetwork(num int) (n *testNetwork, chains []*Chain, cleanup func(), err error) {
+	var (
+		peers   *proto.Peers
+		genesis *pt.Block
+		files   []string
+	)
+	savedConf := conf.GConf
+	cleanup = func() {
+		for _, c := range chains {
+			c.db.Close()
+		}
+		for _, f := range files {
+			os.Remove(f)
+		}
+		conf.GConf = savedConf
+		route.Once = sync.Once{}
+	}
+	if _, peers, err = createTestPeers(num); err != nil {
+		return
+	}
+	// register the test peers as the known block producers for the rpc acl
+	testConf := &conf.Config{}
+	if savedConf != nil {
+		*testConf = *savedConf
+	}
+	testConf.IsTestMode = true
+	testConf.BP = &conf.BPInfo{NodeID: peers.Leader}
+	testConf.KnownNodes = nil
+	conf.GConf = testConf
+	for _, s := range peers.Servers {
+		conf.GConf.KnownNodes = append(conf.GConf.KnownNodes, proto.Node{ID: s, Role: proto.Follower})
+	}
+	route.Once = sync.Once{}
+
+	if genesis, err = generateRandomBlock(genesisHash, true); err != nil {
+		return
+	}
+	// use a past genesis so that the test heights are never ahead of time
+	genesis.SignedHeader.Timestamp = time.Now().UTC().Add(-time.Hour)
+
+	n = &testNetwork{
+		chains:  make(map[proto.NodeID]*Chain),
+		offline: make(map[proto.NodeID]bool),
+	}
+	for i := 0; i < num; i++ {
+		var (
+			fl *os.File
+			c  *Chain
+		)
+		if fl, err = ioutil.TempFile("", "mainchain"); err != nil {
+			return
+		}
+		fl.Close()
+		os.Remove(fl.Name())
+		files = append(files, fl.Name())
+
+		cfg := NewConfig(genesis, fl.Name(), nil, peers, peers.Servers[i], testPeriod, testTick)
+		if c, err = NewChain(cfg); err != nil {
+			return
+		}
+		c.cl = &testCaller{testNetwork: n, self: peers.Servers[i]}
+		n.chains[peers.Servers[i]] = c
+		chains = append(chains, c)
+	}
+	return
+}
+
+// waitForHead waits until the heads of all the online chains reach the block.
+func waitForHead(n *testNetwork, chains []*Chain, b *pt.Block) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		reached := true
+		n.RLock()
+		for _, c := range chains {
+			if !n.offline[c.rt.nodeID] && !c.rt.getHead().Head.IsEqual(b.BlockHash()) {
+				reached = false
+			}
+		}
+		n.RUnlock()
+		if reached {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func getTestHeadBlock(c *Chain) (b *pt.Block, err error) {
+	b, _, err = c.fetchBlockByHeight(c.rt.getHead().Height)
+	return
+}
+
+func TestConsensus(t *testing.T) {
+	Convey("Given a local network of 4 block producers", t, func() {
+		cleanupNode, _, _, _, err := initNode(
+			"../test/mainchain/node_standalone/config.yaml",
+			"../test/mainchain/node_standalone/private.key",
+		)
+		So(err, ShouldBeNil)
+		defer cleanupNode()
+
+		n, chains, cleanup, err := newTestNetwork(4)
+		defer cleanup()
+		So(err, ShouldBeNil)
+		So(len(chains), ShouldEqual, 4)
+
+		var (
+			c0        = chains[0]
+			initial   = c0.rt.getHeightFromTime(c0.rt.now())
+			proposeAt = func(h uint32) (c *Chain, b *pt.Block, err error) {
+				c = chains[h%uint32(len(chains))]
+				if err = c.produceBlock(c0.rt.chainInitTime.Add(time.Duration(h) * c0.rt.period)); err != nil {
+					return
+				}
+				b, err = getTestHeadBlock(c)
+				return
+			}
+		)
+		// align to the turn of the first block producer
+		initial += uint32(len(chains)) - initial%uint32(len(chains))
+
+		Convey("The blocks should be committed with quorum certificates in turns", func() {
+			for h := initial; h < initial+uint32(len(chains)); h++ {
+				c, b, err := proposeAt(h)
+				So(err, ShouldBeNil)
+				So(c.rt.getHead().Height, ShouldEqual, h)
+				So(b.Cert, ShouldNotBeNil)
+				So(b.Cert.Type, ShouldEqual, pt.VoteTypePrecommit)
+				So(len(b.Cert.Votes), ShouldBeGreaterThanOrEqualTo, pt.QuorumSize(len(chains)))
+				So(b.Cert.Verify(c.rt.getPeers()), ShouldBeNil)
+				So(waitForHead(n, chains, b), ShouldBeTrue)
+			}
+		})
+		Convey("The block should be committed with one faulty block producer offline", func() {
+			n.setOffline(chains[3].rt.nodeID, true)
+			c, b, err := proposeAt(initial + 1)
+			So(err, ShouldBeNil)
+			So(c, ShouldEqual, chains[1])
+			So(len(b.Cert.Votes), ShouldEqual, 3)
+			So(waitForHead(n, chains, b), ShouldBeTrue)
+			So(chains[3].rt.getHead().Head.IsEqual(b.BlockHash()), ShouldBeFalse)
+		})
+		Convey("The block should not be committed without a quorum", func() {
+			n.setOffline(chains[2].rt.nodeID, true)
+			n.setOffline(chains[3].rt.nodeID, true)
+			head := c0.rt.getHead().Head
+			_, _, err := proposeAt(initial)
+			So(errors.Cause(err), ShouldEqual, pt.ErrNoQuorum)
+			So(c0.rt.getHead().Head, ShouldResemble, head)
+		})
+		Convey("The block producers should reject the consensus rpc from non block producers", func() {
+			var (
+				s     = &ChainRPCService{chain: chains[1]}
+				other = proto.NodeID("0000000000000000000000000000000000000000000000000000000000000004")
+				env   = proto.Envelope{NodeID: other.ToRawNodeID()}
+			)
+			b, err := generateRandomBlock(c0.rt.getHead().Head, false)
+			So(err, ShouldBeNil)
+			err = s.ProposeBlock(&ProposeBlockReq{Envelope: env, Block: b}, &ProposeBlockResp{})
+			So(err, ShouldEqual, ErrPermissionDenied)
+			err = s.PrecommitBlock(&PrecommitBlockReq{
+				Envelope: env,
+				Cert:     pt.NewQuorumCert(pt.VoteTypePrevote, initial, *b.BlockHash(), nil),
+			}, &PrecommitBlockResp{})
+			So(err, ShouldEqual, ErrPermissionDenied)
+			err = s.AdviseNewBlock(&AdviseNewBlockReq{Envelope: env, Block: b}, &AdviseNewBlockResp{})
+			So(err, ShouldEqual, ErrPermissionDenied)
+		})
+		Convey("The block producers should be locked on the precommitted block", func() {
+			var (
+				b1, b2 *pt.Block
+				votes  []*pt.Vote
+				v      *pt.Vote
+				priv   *asymmetric.PrivateKey
+				head   = c0.rt.getHead().Head
+			)
+			priv, err = kms.GetLocalPrivateKey()
+			So(err, ShouldBeNil)
+			b1, err = generateRandomBlock(head, false)
+			So(err, ShouldBeNil)
+			b1.SignedHeader.Timestamp = c0.rt.chainInitTime.Add(time.Duration(initial) * c0.rt.period)
+			b1.Transactions, b1.Allocations = nil, nil
+			So(b1.PackAndSignBlock(priv), ShouldBeNil)
+
+			// all prevote the block but only 2 of them precommit it
+			for _, c := range chains {
+				v, err = c.prevote(b1)
+				So(err, ShouldBeNil)
+				votes = append(votes, v)
+			}
+			cert := pt.NewQuorumCert(pt.VoteTypePrevote, initial, *b1.BlockHash(), votes)
+			for _, c := range chains[:2] {
+				_, err = c.precommit(cert)
+				So(err, ShouldBeNil)
+			}
+
+			// the locked block producers reject the proposal not extending the locked block
+			b2, err = generateRandomBlock(head, false)
+			So(err, ShouldBeNil)
+			b2.SignedHeader.Timestamp = c0.rt.chainInitTime.Add(time.Duration(initial+1) * c0.rt.period)
+			So(b2.PackAndSignBlock(priv), ShouldBeNil)
+			_, err = c0.prevote(b2)
+			So(errors.Cause(err), ShouldEqual, ErrLockedOnOtherBlock)
+			_, err = chains[2].prevote(b2)
+			So(err, ShouldBeNil)
+
+			// the lock and votes are persisted
+			vs, err := loadVoteState(c0.db)
+			So(err, ShouldBeNil)
+			So(vs.lock, ShouldNotBeNil)
+			So(vs.lock.Height, ShouldEqual, initial)
+			So(vs.lock.Block.BlockHash(), ShouldResemble, b1.BlockHash())
+			So(vs.hasVoted(pt.VoteTypePrecommit, initial, *b1.BlockHash()), ShouldBeTrue)
+			So(vs.vote(pt.VoteTypePrevote, initial, *b2.BlockHash()), ShouldEqual, ErrConflictVote)
+
+			// the locked block is proposed again by the next locked block producer
+			c, b, err := proposeAt(initial + 1)
+			So(err, ShouldBeNil)
+			So(c, ShouldEqual, chains[1])
+			So(b.BlockHash(), ShouldResemble, b1.BlockHash())
+			So(c.rt.getHead().Height, ShouldEqual, initial)
+			So(waitForHead(n, chains, b), ShouldBeTrue)
+
+			// the lock is released once the block is finalized
+			for _, c := range chains {
+				So(c.vs.getLockedProposal(&head), ShouldBeNil)
+			}
+			So(c0.vs.lock, ShouldBeNil)
+			vs, err = loadVoteState(c0.db)
+			So(err, ShouldBeNil)
+			So(vs.lock, ShouldBeNil)
+		})
+		Convey("The block producers should reject the invalid proposals and certificates", func() {
+			var (
+				b1, b2 *pt.Block
+				v      *pt.Vote
+			)
+			b1, err = generateRandomBlock(c0.rt.getHead().Head, false)
+			So(err, ShouldBeNil)
+			b1.SignedHeader.Timestamp = c0.rt.chainInitTime.Add(time.Duration(initial) * c0.rt.period)
+			So(b1.PackAndSignBlock(testPrivKey), ShouldBeNil)
+
+			// proposal from a block producer out of its turn
+			_, err = chains[1].prevote(b1)
+			So(errors.Cause(err), ShouldEqual, ErrInvalidProposer)
+
+			// block without quorum certificate
+			err = chains[1].pushBlock(b1)
+			So(errors.Cause(err), ShouldEqual, ErrMissingQuorumCert)
+
+			// precommit without prevote
+			b2, err = generateRandomBlock(c0.rt.getHead().Head, false)
+			So(err, ShouldBeNil)
+			_, err = chains[1].precommit(pt.NewQuorumCert(
+				pt.VoteTypePrevote, initial, *b2.BlockHash(), nil))
+			So(err, ShouldEqual, ErrUnknownProposal)
+
+			// conflict votes at the same height
+			So(c0.vs.vote(pt.VoteTypePrevote, initial, *b1.BlockHash()), ShouldBeNil)
+			So(c0.vs.vote(pt.VoteTypePrevote, initial, *b2.BlockHash()), ShouldEqual, ErrConflictVote)
+
+			// certificate of prevotes and certificate from too few voters
+			v, err = chains[1].signVote(pt.VoteTypePrecommit, initial, *b1.BlockHash())
+			So(err, ShouldBeNil)
+			b1.Cert = pt.NewQuorumCert(pt.VoteTypePrevote, initial, *b1.BlockHash(), []*pt.Vote{v})
+			err = chains[1].pushBlock(b1)
+			So(errors.Cause(err), ShouldEqual, ErrInvalidQuorumCert)
+			b1.Cert = pt.NewQuorumCert(pt.VoteTypePrecommit, initial, *b1.BlockHash(), []*pt.Vote{v})
+			err = chains[1].pushBlock(b1)
+			So(errors.Cause(err), ShouldEqual, pt.ErrNoQuorum)
+		})
+	})
+}
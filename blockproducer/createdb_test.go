@@ -0,0 +1,248 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/coreos/bbolt"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type stubDatabaseProvider struct {
+	nodes    []proto.NodeID
+	err      error
+	deployed []*pt.SQLChainProfile
+	dropped  []*pt.SQLChainProfile
+}
+
+func (p *stubDatabaseProvider) AllocateMiners(
+	dbID proto.DatabaseID, meta *pt.ResourceMeta) ([]proto.NodeID, error,
+) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.nodes[:meta.Node], nil
+}
+
+func (p *stubDatabaseProvider) DeployDatabase(profile *pt.SQLChainProfile) error {
+	p.deployed = append(p.deployed, profile)
+	return nil
+}
+
+func (p *stubDatabaseProvider) UndeployDatabase(profile *pt.SQLChainProfile) error {
+	p.dropped = append(p.dropped, profile)
+	return nil
+}
+
+func TestCreateDatabase(t *testing.T) {
+	Convey("Given a metaState object with a database provider", t, func() {
+		cleanupNode, _, _, _, err := initNode(
+			"../test/mainchain/node_standalone/config.yaml",
+			"../test/mainchain/node_standalone/private.key",
+		)
+		So(err, ShouldBeNil)
+		defer cleanupNode()
+
+		_, peers, err := createTestPeersWithPrivKeys(testPrivKey, 2)
+		So(err, ShouldBeNil)
+		minerAddr, err := crypto.PubKeyHash(testPrivKey.PubKey())
+		So(err, ShouldBeNil)
+		ownerPrivKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		owner, err := crypto.PubKeyHash(ownerPrivKey.PubKey())
+		So(err, ShouldBeNil)
+
+		var (
+			provider = &stubDatabaseProvider{nodes: peers.Servers}
+			proposer = &Chain{provider: provider}
+			ms       = newMetaState()
+			fl       = path.Join(testDataDir, t.Name())
+			db       *bolt.DB
+		)
+		db, err = bolt.Open(fl, 0600, nil)
+		So(err, ShouldBeNil)
+		defer func() {
+			db.Close()
+			os.Remove(fl)
+		}()
+		err = db.Update(func(tx *bolt.Tx) (err error) {
+			var meta *bolt.Bucket
+			if meta, err = tx.CreateBucket(metaBucket[:]); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucket(metaAccountIndexBucket); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucket(metaSQLChainIndexBucket); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucket(metaTransactionBucket); err != nil {
+				return
+			}
+			return resetMetaStateBuckets(tx)
+		})
+		So(err, ShouldBeNil)
+		err = db.Update(ms.applyTransactionProcedure(pt.NewBaseAccount(&pt.Account{
+			Address:           owner,
+			StableCoinBalance: 100,
+		})))
+		So(err, ShouldBeNil)
+		err = db.Update(ms.commitProcedure())
+		So(err, ShouldBeNil)
+
+		var (
+			balanceOf = func(addr proto.AccountAddress) (b uint64) {
+				b, _ = ms.loadAccountStableBalance(addr)
+				return
+			}
+			addCreateDatabase = func(node uint16, advance, fee uint64) (
+				t *pt.CreateDatabase, dbID proto.DatabaseID, err error,
+			) {
+				var nonce pi.AccountNonce
+				if nonce, err = ms.nextNonce(owner); err != nil {
+					return
+				}
+				t = pt.NewCreateDatabase(&pt.CreateDatabaseHeader{
+					Owner: owner,
+					ResourceMeta: pt.ResourceMeta{
+						Node:          node,
+						Space:         1 << 20,
+						StorageEngine: "sqlite",
+					},
+					GasPrice:       2,
+					AdvancePayment: advance,
+					Nonce:          nonce,
+					Fee:            fee,
+				})
+				if err = t.Sign(ownerPrivKey); err != nil {
+					return
+				}
+				if dbID, err = t.DatabaseID(); err != nil {
+					return
+				}
+				err = db.Update(ms.addTxProcedure(t))
+				return
+			}
+		)
+
+		Convey("The database should be recorded with the deposit", func() {
+			_, dbID, err := addCreateDatabase(2, 30, 1)
+			So(err, ShouldBeNil)
+			So(balanceOf(owner), ShouldEqual, 69)
+
+			p, loaded := ms.loadSQLChainProfile(dbID)
+			So(loaded, ShouldBeTrue)
+			So(p.ID, ShouldEqual, dbID)
+			So(p.Owner, ShouldEqual, owner)
+			So(p.Deposit, ShouldEqual, 30)
+			So(p.GasPrice, ShouldEqual, 2)
+			So(p.Meta.Node, ShouldEqual, 2)
+			So(p.Meta.StorageEngine, ShouldEqual, "sqlite")
+			So(p.MinerNodes, ShouldBeEmpty)
+			So(p.Miners, ShouldBeEmpty)
+			So(len(p.Users), ShouldEqual, 1)
+			So(p.Users[0].Address, ShouldEqual, owner)
+			So(p.Users[0].Permission, ShouldEqual, pt.Admin)
+
+			Convey("The miners should be allocated by the proposer and recorded on commit", func() {
+				txs, allocs := ms.packTxs(MaxBlockTxs, MaxBlockTxsSize, proposer.allocateDatabase)
+				So(len(txs), ShouldEqual, 1)
+				So(len(allocs), ShouldEqual, 1)
+				So(allocs[0].DatabaseID, ShouldEqual, dbID)
+				So(allocs[0].MinerNodes(), ShouldResemble, peers.Servers)
+				// the allocation is verified without the local key store
+				for _, v := range peers.Servers {
+					err = kms.DelNode(v)
+					So(err, ShouldBeNil)
+				}
+				err = checkAllocations(txs, allocs)
+				So(err, ShouldBeNil)
+				err = db.Update(ms.partialCommitProcedure(txs, allocs))
+				So(err, ShouldBeNil)
+				So(balanceOf(owner), ShouldEqual, 69)
+				p, loaded := ms.loadSQLChainProfile(dbID)
+				So(loaded, ShouldBeTrue)
+				So(p.Deposit, ShouldEqual, 30)
+				So(p.MinerNodes, ShouldResemble, peers.Servers)
+				So(p.Miners, ShouldResemble, []proto.AccountAddress{minerAddr, minerAddr})
+			})
+			Convey("The commit should reject invalid allocations", func() {
+				txs, allocs := ms.packTxs(MaxBlockTxs, MaxBlockTxsSize, proposer.allocateDatabase)
+				So(len(allocs), ShouldEqual, 1)
+				var m = allocs[0].Miners
+				for _, v := range [][]*pt.DatabaseAllocation{
+					nil,
+					append(allocs, allocs[0]),
+					{{DatabaseID: dbID, Miners: m[:1]}},
+					{{DatabaseID: dbID, Miners: []*pt.AllocatedMiner{m[0], m[0]}}},
+					{{DatabaseID: dbID, Miners: []*pt.AllocatedMiner{m[0], nil}}},
+					{{DatabaseID: dbID, Miners: []*pt.AllocatedMiner{m[0], {
+						NodeID:    proto.NodeID("00000000000000000000000000000000"),
+						PublicKey: m[1].PublicKey,
+						Nonce:     m[1].Nonce,
+					}}}},
+					{{DatabaseID: dbID, Miners: []*pt.AllocatedMiner{m[0], {
+						NodeID:    m[1].NodeID,
+						PublicKey: ownerPrivKey.PubKey(),
+						Nonce:     m[1].Nonce,
+					}}}},
+					{{DatabaseID: "db#0", Miners: m}},
+				} {
+					err = checkAllocations(txs, v)
+					So(errors.Cause(err), ShouldEqual, ErrInvalidAllocation)
+					err = db.Update(ms.partialCommitProcedure(txs, v))
+					So(errors.Cause(err), ShouldEqual, ErrInvalidAllocation)
+				}
+				p, loaded := ms.loadCommittedSQLChainProfile(dbID)
+				So(loaded, ShouldBeFalse)
+				So(p, ShouldBeNil)
+			})
+		})
+		Convey("The creation should fail with insufficient balance", func() {
+			_, dbID, err := addCreateDatabase(1, 100, 1)
+			So(errors.Cause(err), ShouldEqual, ErrInsufficientBalance)
+			So(balanceOf(owner), ShouldEqual, 100)
+			_, loaded := ms.loadSQLChainProfile(dbID)
+			So(loaded, ShouldBeFalse)
+		})
+		Convey("The creation should not be packed if the miners cannot be allocated", func() {
+			_, _, err := addCreateDatabase(1, 10, 1)
+			So(err, ShouldBeNil)
+			provider.err = ErrDatabaseAllocation
+			txs, allocs := ms.packTxs(MaxBlockTxs, MaxBlockTxsSize, proposer.allocateDatabase)
+			So(txs, ShouldBeEmpty)
+			So(allocs, ShouldBeEmpty)
+		})
+		Convey("The creation should not be packed without database provider", func() {
+			_, _, err := addCreateDatabase(1, 10, 1)
+			So(err, ShouldBeNil)
+			txs, allocs := ms.packTxs(MaxBlockTxs, MaxBlockTxsSize, (&Chain{}).allocateDatabase)
+			So(txs, ShouldBeEmpty)
+			So(allocs, ShouldBeEmpty)
+		})
+	})
+}
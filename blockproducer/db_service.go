@@ -21,12 +21,12 @@ import (
 	"sync"
 	"time"
 
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
 	"github.com/CovenantSQL/CovenantSQL/consistent"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/metric"
-	"github.com/CovenantSQL/CovenantSQL/pow/cpuminer"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/rpc"
@@ -64,54 +64,64 @@ type DBService struct {
 	includeBPNodesForAllocation bool
 }
 
-// CreateDatabase defines block producer create database logic.
+// CreateDatabase rejects the deprecated off-chain database creation request. The databases are
+// created by the CreateDatabase transactions on main chain, so that each of them has a SQLChain
+// profile paid by the advance payment of owner, see client.CreateAndWait.
 func (s *DBService) CreateDatabase(req *types.CreateDatabaseRequest, resp *types.CreateDatabaseResponse) (err error) {
 	// verify signature
 	if err = req.Verify(); err != nil {
 		return
 	}
 
-	// TODO(xq262144): verify identity
-	// verify identity
+	return ErrCreateDatabaseOffChain
+}
 
+// AllocateMiners implements DatabaseProvider.AllocateMiners, it chooses the miners with enough
+// free memory among the neighbors of the database on the consistent hash ring.
+func (s *DBService) AllocateMiners(dbID proto.DatabaseID, meta *pt.ResourceMeta) (nodeIDs []proto.NodeID, err error) {
+	var peers *proto.Peers
+	if peers, err = s.allocateNodes(0, dbID, toServiceResourceMeta(meta)); err != nil {
+		return
+	}
+	nodeIDs = peers.Servers
+
+	log.WithFields(log.Fields{
+		"db":    dbID,
+		"meta":  meta,
+		"nodes": nodeIDs,
+	}).Debug("allocated miners for database created on chain")
+
+	return
+}
+
+// DeployDatabase implements DatabaseProvider.DeployDatabase, it deploys the database created on
+// chain to its allocated miners and saves the instance to service map.
+func (s *DBService) DeployDatabase(profile *pt.SQLChainProfile) (err error) {
 	defer func() {
 		log.WithFields(log.Fields{
-			"meta": req.Header.ResourceMeta,
-			"node": req.GetNodeID().String(),
-		}).WithError(err).Debug("create database")
+			"db":    profile.ID,
+			"nodes": profile.MinerNodes,
+		}).WithError(err).Debug("deploy database created on chain")
 	}()
 
-	// create random DatabaseID
-	var dbID proto.DatabaseID
-	if dbID, err = s.generateDatabaseID(req.GetNodeID()); err != nil {
+	if _, err = s.ServiceMap.Get(profile.ID); err == nil {
+		// already deployed
 		return
 	}
+	err = nil
 
-	log.WithField("db", dbID).Debug("generated database id")
-
-	// allocate nodes
 	var peers *proto.Peers
-	if peers, err = s.allocateNodes(0, dbID, req.Header.ResourceMeta); err != nil {
+	if peers, err = s.buildPeers(1, profile.MinerNodes); err != nil {
 		return
 	}
 
-	log.WithField("peers", peers).Debug("generated peers info")
+	resourceMeta := toServiceResourceMeta(&profile.Meta)
 
-	// TODO(lambda): call accounting features, top up deposit
 	var genesisBlock *types.Block
-	if genesisBlock, err = s.generateGenesisBlock(dbID, req.Header.ResourceMeta); err != nil {
+	if genesisBlock, err = s.generateGenesisBlock(profile.ID, resourceMeta); err != nil {
 		return
 	}
 
-	log.WithField("block", genesisBlock).Debug("generated genesis block")
-
-	defer func() {
-		if err != nil {
-			// TODO(lambda): release deposit on error
-		}
-	}()
-
-	// call miner nodes to provide service
 	var privateKey *asymmetric.PrivateKey
 	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
 		return
@@ -120,8 +130,9 @@ func (s *DBService) CreateDatabase(req *types.CreateDatabaseRequest, resp *types
 	initSvcReq := new(types.UpdateService)
 	initSvcReq.Header.Op = types.CreateDB
 	initSvcReq.Header.Instance = types.ServiceInstance{
-		DatabaseID:   dbID,
+		DatabaseID:   profile.ID,
 		Peers:        peers,
+		ResourceMeta: resourceMeta,
 		GenesisBlock: genesisBlock,
 	}
 	if err = initSvcReq.Sign(privateKey); err != nil {
@@ -131,7 +142,7 @@ func (s *DBService) CreateDatabase(req *types.CreateDatabaseRequest, resp *types
 	rollbackReq := new(types.UpdateService)
 	rollbackReq.Header.Op = types.DropDB
 	rollbackReq.Header.Instance = types.ServiceInstance{
-		DatabaseID: dbID,
+		DatabaseID: profile.ID,
 	}
 	if err = rollbackReq.Sign(privateKey); err != nil {
 		return
@@ -141,29 +152,43 @@ func (s *DBService) CreateDatabase(req *types.CreateDatabaseRequest, resp *types
 		return
 	}
 
-	// save to meta
-	instanceMeta := types.ServiceInstance{
-		DatabaseID:   dbID,
+	return s.ServiceMap.Set(types.ServiceInstance{
+		DatabaseID:   profile.ID,
 		Peers:        peers,
-		ResourceMeta: req.Header.ResourceMeta,
+		ResourceMeta: resourceMeta,
 		GenesisBlock: genesisBlock,
-	}
+	})
+}
 
-	log.WithField("meta", instanceMeta).Debug("generated instance meta")
+// UndeployDatabase implements DatabaseProvider.UndeployDatabase, it drops the database dropped on
+// chain from its miners and removes the instance from service map.
+func (s *DBService) UndeployDatabase(profile *pt.SQLChainProfile) (err error) {
+	defer func() {
+		log.WithFields(log.Fields{
+			"db":    profile.ID,
+			"nodes": profile.MinerNodes,
+		}).WithError(err).Debug("undeploy database dropped on chain")
+	}()
 
-	if err = s.ServiceMap.Set(instanceMeta); err != nil {
-		// critical error
-		// TODO(xq262144): critical error recover
-		return err
+	var privateKey *asymmetric.PrivateKey
+	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
+		return
 	}
 
-	// send response to client
-	resp.Header.InstanceMeta = instanceMeta
+	dropDBSvcReq := new(types.UpdateService)
+	dropDBSvcReq.Header.Op = types.DropDB
+	dropDBSvcReq.Header.Instance = types.ServiceInstance{
+		DatabaseID: profile.ID,
+	}
+	if err = dropDBSvcReq.Sign(privateKey); err != nil {
+		return
+	}
 
-	// sign the response
-	err = resp.Sign(privateKey)
+	if err = s.batchSendSingleSvcReq(dropDBSvcReq, profile.MinerNodes); err != nil {
+		return
+	}
 
-	return
+	return s.ServiceMap.Delete(profile.ID)
 }
 
 // DropDatabase defines block producer drop database logic.
@@ -290,38 +315,6 @@ func (s *DBService) GetNodeDatabases(req *types.InitService, resp *types.InitSer
 	return
 }
 
-func (s *DBService) generateDatabaseID(reqNodeID *proto.RawNodeID) (dbID proto.DatabaseID, err error) {
-	var startNonce cpuminer.Uint256
-
-	for {
-		nonceCh := make(chan cpuminer.NonceInfo)
-		quitCh := make(chan struct{})
-		miner := cpuminer.NewCPUMiner(quitCh)
-		go miner.ComputeBlockNonce(cpuminer.MiningBlock{
-			Data:      reqNodeID.CloneBytes(),
-			NonceChan: nonceCh,
-			Stop:      nil,
-		}, startNonce, 4)
-
-		nonce := <-nonceCh
-		close(quitCh)
-		close(nonceCh)
-
-		// set start nonceCh
-		startNonce = nonce.Nonce
-		startNonce.Inc()
-		dbID = proto.DatabaseID(nonce.Hash.String())
-
-		log.WithField("db", dbID).Debug("try generate database id")
-
-		// check existence
-		if _, err = s.ServiceMap.Get(dbID); err == ErrNoSuchDatabase {
-			err = nil
-			return
-		}
-	}
-}
-
 func (s *DBService) allocateNodes(lastTerm uint64, dbID proto.DatabaseID, resourceMeta types.ResourceMeta) (peers *proto.Peers, err error) {
 	curRange := int(resourceMeta.Node)
 	excludeNodes := make(map[proto.NodeID]bool)
@@ -561,3 +554,15 @@ func (s *DBService) batchSendSingleSvcReq(req *types.UpdateService, nodes []prot
 
 	return
 }
+
+// toServiceResourceMeta converts the resource meta of main chain transaction to the one of
+// database service.
+func toServiceResourceMeta(meta *pt.ResourceMeta) types.ResourceMeta {
+	return types.ResourceMeta{
+		Node:          meta.Node,
+		Space:         meta.Space,
+		Memory:        meta.Memory,
+		LoadAvgPerCPU: meta.LoadAvgPerCPU,
+		StorageEngine: types.StorageEngine(meta.StorageEngine),
+	}
+}
@@ -17,9 +17,13 @@
 package blockproducer
 
 import (
+	"os"
+	"path"
 	"testing"
 	"time"
 
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/metric"
@@ -27,6 +31,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/rpc"
 	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/coreos/bbolt"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -49,6 +54,9 @@ func TestService(t *testing.T) {
 		var privateKey *asymmetric.PrivateKey
 		privateKey, err = kms.GetLocalPrivateKey()
 		So(err, ShouldBeNil)
+		var owner proto.AccountAddress
+		owner, err = crypto.PubKeyHash(privateKey.PubKey())
+		So(err, ShouldBeNil)
 
 		// create service
 		stubPersistence := &stubDBMetaPersistence{}
@@ -65,6 +73,46 @@ func TestService(t *testing.T) {
 		err = server.RegisterService(route.BPDBRPCName, dbService)
 		So(err, ShouldBeNil)
 
+		// register chain service with the meta state of the databases created on chain
+		var (
+			ms    = newMetaState()
+			chain = &Chain{ms: ms, provider: dbService}
+			fl    = path.Join(testDataDir, t.Name())
+			db    *bolt.DB
+		)
+		db, err = bolt.Open(fl, 0600, nil)
+		So(err, ShouldBeNil)
+		defer func() {
+			db.Close()
+			os.Remove(fl)
+		}()
+		err = db.Update(func(tx *bolt.Tx) (err error) {
+			var meta *bolt.Bucket
+			if meta, err = tx.CreateBucket(metaBucket[:]); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucket(metaAccountIndexBucket); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucket(metaSQLChainIndexBucket); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucket(metaTransactionBucket); err != nil {
+				return
+			}
+			return resetMetaStateBuckets(tx)
+		})
+		So(err, ShouldBeNil)
+		err = db.Update(ms.applyTransactionProcedure(pt.NewBaseAccount(&pt.Account{
+			Address:           owner,
+			StableCoinBalance: 100,
+		})))
+		So(err, ShouldBeNil)
+		err = db.Update(ms.commitProcedure())
+		So(err, ShouldBeNil)
+		err = server.RegisterService(route.BlockProducerRPCName, &ChainRPCService{chain: chain})
+		So(err, ShouldBeNil)
+
 		// get database
 		var nodeID proto.NodeID
 		nodeID, err = kms.GetLocalNodeID()
@@ -91,7 +139,7 @@ func TestService(t *testing.T) {
 		So(getAllRes.Header.Instances, ShouldHaveLength, 1)
 		So(getAllRes.Header.Instances[0].DatabaseID, ShouldResemble, proto.DatabaseID("db"))
 
-		// create database, no metric received, should failed
+		// create database off chain, should be rejected
 		createDBReq := new(types.CreateDatabaseRequest)
 		createDBReq.Header.ResourceMeta = types.ResourceMeta{
 			Node: 1,
@@ -101,20 +149,49 @@ func TestService(t *testing.T) {
 		createDBRes := new(types.CreateDatabaseResponse)
 		err = rpc.NewCaller().CallNode(nodeID, route.BPDBCreateDatabase.String(), createDBReq, createDBRes)
 		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, ErrCreateDatabaseOffChain.Error())
+
+		// create database on chain
+		createDBTx := pt.NewCreateDatabase(&pt.CreateDatabaseHeader{
+			Owner:          owner,
+			ResourceMeta:   pt.ResourceMeta{Node: 1},
+			GasPrice:       1,
+			AdvancePayment: 10,
+			Nonce:          1,
+		})
+		err = createDBTx.Sign(privateKey)
+		So(err, ShouldBeNil)
+		err = db.Update(ms.addTxProcedure(createDBTx))
+		So(err, ShouldBeNil)
+		dbID, err := createDBTx.DatabaseID()
+		So(err, ShouldBeNil)
+
+		// no metric received, should not be packed
+		txs, allocs := ms.packTxs(MaxBlockTxs, MaxBlockTxsSize, chain.allocateDatabase)
+		So(txs, ShouldBeEmpty)
+		So(allocs, ShouldBeEmpty)
 
 		// trigger metrics, but does not allow block producer to service as miner
 		metric.NewCollectClient().UploadMetrics(nodeID)
-		createDBRes = new(types.CreateDatabaseResponse)
-		err = rpc.NewCaller().CallNode(nodeID, route.BPDBCreateDatabase.String(), createDBReq, createDBRes)
-		So(err, ShouldNotBeNil)
+		txs, allocs = ms.packTxs(MaxBlockTxs, MaxBlockTxsSize, chain.allocateDatabase)
+		So(txs, ShouldBeEmpty)
+		So(allocs, ShouldBeEmpty)
 
 		// allow block producer to service as miner, only use this in test case
 		dbService.includeBPNodesForAllocation = true
-		createDBRes = new(types.CreateDatabaseResponse)
-		err = rpc.NewCaller().CallNode(nodeID, route.BPDBCreateDatabase.String(), createDBReq, createDBRes)
+		txs, allocs = ms.packTxs(MaxBlockTxs, MaxBlockTxsSize, chain.allocateDatabase)
+		So(txs, ShouldHaveLength, 1)
+		So(allocs, ShouldHaveLength, 1)
+		So(allocs[0].MinerNodes(), ShouldResemble, []proto.NodeID{nodeID})
+		err = db.Update(ms.partialCommitProcedure(txs, allocs))
+		So(err, ShouldBeNil)
+
+		// deploy the database with its profile
+		profile, loaded := ms.loadSQLChainProfile(dbID)
+		So(loaded, ShouldBeTrue)
+		So(profile.MinerNodes, ShouldResemble, []proto.NodeID{nodeID})
+		err = dbService.DeployDatabase(profile)
 		So(err, ShouldBeNil)
-		So(createDBRes.Verify(), ShouldBeNil)
-		So(createDBRes.Header.InstanceMeta.DatabaseID, ShouldNotBeEmpty)
 
 		// get all databases, this new database should exists
 		err = rpc.NewCaller().CallNode(nodeID, route.BPDBGetNodeDatabases.String(), getAllReq, getAllRes)
@@ -123,16 +200,15 @@ func TestService(t *testing.T) {
 		So(getAllRes.Header.Instances, ShouldHaveLength, 2)
 		So(getAllRes.Header.Instances[0].DatabaseID, ShouldBeIn, []proto.DatabaseID{
 			proto.DatabaseID("db"),
-			createDBRes.Header.InstanceMeta.DatabaseID,
+			dbID,
 		})
 		So(getAllRes.Header.Instances[1].DatabaseID, ShouldBeIn, []proto.DatabaseID{
 			proto.DatabaseID("db"),
-			createDBRes.Header.InstanceMeta.DatabaseID,
+			dbID,
 		})
 
 		// use the database
-		serverID := createDBRes.Header.InstanceMeta.Peers.Leader
-		dbID := createDBRes.Header.InstanceMeta.DatabaseID
+		serverID := profile.MinerNodes[0]
 		var queryReq *types.Request
 		queryReq, err = buildQuery(types.WriteQuery, 1, 1, dbID, []string{
 			"create table test (test int)",
@@ -159,7 +235,7 @@ func TestService(t *testing.T) {
 
 		// drop database
 		dropDBReq := new(types.DropDatabaseRequest)
-		dropDBReq.Header.DatabaseID = createDBRes.Header.InstanceMeta.DatabaseID
+		dropDBReq.Header.DatabaseID = dbID
 		err = dropDBReq.Sign(privateKey)
 		So(err, ShouldBeNil)
 		dropDBRes := new(types.DropDatabaseResponse)
@@ -168,7 +244,7 @@ func TestService(t *testing.T) {
 
 		// get this database again to test if it is dropped
 		getReq = new(types.GetDatabaseRequest)
-		getReq.Header.DatabaseID = createDBRes.Header.InstanceMeta.DatabaseID
+		getReq.Header.DatabaseID = dbID
 		err = getReq.Sign(privateKey)
 		So(err, ShouldBeNil)
 		err = rpc.NewCaller().CallNode(nodeID, route.BPDBGetDatabase.String(), getReq, getRes)
@@ -23,6 +23,9 @@ var (
 	ErrNoSuchDatabase = errors.New("no such database")
 	// ErrDatabaseAllocation defines database allocation failure error.
 	ErrDatabaseAllocation = errors.New("allocate database failed")
+	// ErrCreateDatabaseOffChain defines the error of creating database without main chain
+	// transaction.
+	ErrCreateDatabaseOffChain = errors.New("database should be created by main chain transaction")
 	// ErrMetricNotCollected defines errors collected.
 	ErrMetricNotCollected = errors.New("metric not collected")
 
@@ -48,6 +51,28 @@ var (
 	ErrSmallerSequenceID = errors.New("SequanceID should be bigger than the old one")
 	// ErrInvalidBillingRequest defines BillingRequest is invalid
 	ErrInvalidBillingRequest = errors.New("The BillingRequest is invalid")
+	// ErrNoBlockProducer indicates that there is no block producer in the peer list.
+	ErrNoBlockProducer = errors.New("no block producer")
+	// ErrInvalidProposer indicates that the block is not proposed by the block producer of its turn.
+	ErrInvalidProposer = errors.New("invalid block proposer")
+	// ErrUnknownProposal indicates that the block to precommit has not been prevoted locally.
+	ErrUnknownProposal = errors.New("unknown block proposal")
+	// ErrConflictVote indicates that another block has been voted at the same height.
+	ErrConflictVote = errors.New("conflict with previous vote")
+	// ErrFinalizedBlock indicates that the block conflicts with the blocks committed with quorum
+	// certificates, which are final.
+	ErrFinalizedBlock = errors.New("block conflicts with finalized block")
+	// ErrLockedOnOtherBlock indicates that the local block producer is locked on a precommitted
+	// block which is not extended by the proposal.
+	ErrLockedOnOtherBlock = errors.New("locked on other block")
+	// ErrMissingQuorumCert indicates that the block is not committed with a quorum certificate.
+	ErrMissingQuorumCert = errors.New("missing quorum certificate")
+	// ErrInvalidQuorumCert indicates that the quorum certificate does not match the block.
+	ErrInvalidQuorumCert = errors.New("invalid quorum certificate")
+	// ErrPermissionDenied indicates that the caller is not permitted to call the main chain RPC.
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrTooManyTransactions indicates that the block exceeds the transaction count or size limit.
+	ErrTooManyTransactions = errors.New("too many transactions in block")
 
 	// ErrBalanceOverflow indicates that there will be an overflow after balance manipulation.
 	ErrBalanceOverflow = errors.New("balance overflow")
@@ -63,6 +88,18 @@ var (
 	ErrDatabaseExists = errors.New("database already exists")
 	// ErrDatabaseUserExists indicates that the database user already exists.
 	ErrDatabaseUserExists = errors.New("database user already exists")
+	// ErrDatabaseUserNotFound indicates that the database user is not found.
+	ErrDatabaseUserNotFound = errors.New("database user not found")
+	// ErrInvalidPermission indicates that a transaction has a invalid user permission.
+	ErrInvalidPermission = errors.New("invalid user permission")
+	// ErrAccessDenied indicates that the transaction signer has no access to the target database.
+	ErrAccessDenied = errors.New("access denied")
+	// ErrDuplicateStorageProofReport indicates that the reporter has already reported the storage
+	// proof failure of the miner in the current billing period.
+	ErrDuplicateStorageProofReport = errors.New("duplicate storage proof failure report")
+	// ErrMinerAlreadySlashed indicates that the miner has already been slashed for the storage
+	// proof failures in the current billing period.
+	ErrMinerAlreadySlashed = errors.New("miner already slashed in billing period")
 	// ErrInvalidAccountNonce indicates that a transaction has a invalid account nonce.
 	ErrInvalidAccountNonce = errors.New("invalid account nonce")
 	// ErrUnknownTransactionType indicates that a transaction has a unknown type and cannot be
@@ -70,6 +107,14 @@ var (
 	ErrUnknownTransactionType = errors.New("unknown transaction type")
 	// ErrTransactionMismatch indicates that transactions to be committed mismatch the pool.
 	ErrTransactionMismatch = errors.New("transaction mismatch")
+	// ErrInvalidAllocation indicates that the database allocations of a block mismatch the
+	// database creation transactions or have invalid miners.
+	ErrInvalidAllocation = errors.New("invalid database allocation")
+	// ErrTooManyPendingTxs indicates that the account has too many pending transactions in pool.
+	ErrTooManyPendingTxs = errors.New("too many pending transactions of account")
+	// ErrTxPoolFull indicates that the transaction pool is full and the transaction fee is not
+	// higher than any evictable pending transaction.
+	ErrTxPoolFull = errors.New("transaction pool is full")
 	// ErrMetaStateNotFound indicates that meta state not found in db.
 	ErrMetaStateNotFound = errors.New("meta state not found in db")
 )
@@ -0,0 +1,140 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"testing"
+	"time"
+
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// newTestForkBlock creates a block with the quorum certificate at the height on the parent,
+// which transfers the amounts from testAddress1 to testAddress2 with the nonces from nonce.
+func newTestForkBlock(
+	c *Chain, peers *proto.Peers, parent hash.Hash, height uint32, nonce pi.AccountNonce, amounts ...uint64,
+) (b *pt.Block, err error) {
+	b = &pt.Block{
+		SignedHeader: pt.SignedHeader{
+			Header: pt.Header{
+				Version:    0x01000000,
+				Producer:   testAddress1,
+				ParentHash: parent,
+				Timestamp:  c.rt.chainInitTime.Add(time.Duration(height) * c.rt.period),
+			},
+		},
+	}
+	for i, v := range amounts {
+		var tr = pt.NewTransfer(&pt.TransferHeader{
+			Sender:   testAddress1,
+			Receiver: testAddress2,
+			Nonce:    nonce + pi.AccountNonce(i),
+			Amount:   v,
+		})
+		if err = tr.Sign(testPrivKey); err != nil {
+			return
+		}
+		b.Transactions = append(b.Transactions, tr)
+	}
+	if err = b.PackAndSignBlock(testPrivKey); err != nil {
+		return
+	}
+	err = generateBlockCert(b, peers, height)
+	return
+}
+
+func TestForkBlock(t *testing.T) {
+	Convey("Given a block producer chain with certified blocks", t, func() {
+		cleanupNode, _, _, _, err := initNode(
+			"../test/mainchain/node_standalone/config.yaml",
+			"../test/mainchain/node_standalone/private.key",
+		)
+		So(err, ShouldBeNil)
+		defer cleanupNode()
+
+		_, chains, cleanup, err := newTestNetwork(1)
+		defer cleanup()
+		So(err, ShouldBeNil)
+		So(len(chains), ShouldEqual, 1)
+
+		var (
+			c          *Chain
+			peers      *proto.Peers
+			genesis    hash.Hash
+			nonce      pi.AccountNonce
+			a1, a2, b1 *pt.Block
+		)
+		c = chains[0]
+		peers = c.rt.peers
+		genesis = c.rt.getHead().Head
+		nonce, err = c.ms.nextNonce(testAddress1)
+		So(err, ShouldBeNil)
+
+		// the best chain: genesis <- a1 <- a2
+		a1, err = newTestForkBlock(c, peers, genesis, 1, nonce, 100)
+		So(err, ShouldBeNil)
+		So(c.pushBlock(a1), ShouldBeNil)
+		a2, err = newTestForkBlock(c, peers, *a1.BlockHash(), 2, nonce+1, 100)
+		So(err, ShouldBeNil)
+		So(c.pushBlock(a2), ShouldBeNil)
+		So(c.rt.getHead().Head, ShouldResemble, *a2.BlockHash())
+		So(c.rt.getHead().Node.count, ShouldEqual, 2)
+
+		Convey("The known block should be ignored", func() {
+			So(c.pushBlock(a1), ShouldBeNil)
+			So(c.pushBlock(a2), ShouldBeNil)
+			So(c.rt.getHead().Head, ShouldResemble, *a2.BlockHash())
+		})
+		Convey("The block with unknown parent should be rejected", func() {
+			b1, err = newTestForkBlock(c, peers, hash.Hash{0x1}, 3, nonce, 1)
+			So(err, ShouldBeNil)
+			err = c.pushBlock(b1)
+			So(errors.Cause(err), ShouldEqual, ErrParentNotFound)
+		})
+		Convey("The block without quorum certificate should be rejected", func() {
+			b1, err = newTestForkBlock(c, peers, *a2.BlockHash(), 3, nonce+2, 1)
+			So(err, ShouldBeNil)
+			b1.Cert = nil
+			err = c.pushBlock(b1)
+			So(errors.Cause(err), ShouldEqual, ErrMissingQuorumCert)
+			So(c.rt.getHead().Head, ShouldResemble, *a2.BlockHash())
+		})
+		Convey("The certified block conflicting with the best chain should be rejected", func() {
+			for _, parent := range []hash.Hash{genesis, *a1.BlockHash()} {
+				b1, err = newTestForkBlock(c, peers, parent, 3, nonce, 1, 1, 1)
+				So(err, ShouldBeNil)
+				err = c.pushBlock(b1)
+				So(errors.Cause(err), ShouldEqual, ErrFinalizedBlock)
+				So(c.bi.hasBlock(*b1.BlockHash()), ShouldBeFalse)
+			}
+			So(c.rt.getHead().Head, ShouldResemble, *a2.BlockHash())
+
+			// the meta state is not changed
+			balance, loaded := c.ms.loadAccountStableBalance(testAddress1)
+			So(loaded, ShouldBeTrue)
+			So(balance, ShouldEqual, testInitBalance-200)
+			next, err := c.ms.nextNonce(testAddress1)
+			So(err, ShouldBeNil)
+			So(next, ShouldEqual, nonce+2)
+		})
+	})
+}
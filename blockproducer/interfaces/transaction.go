@@ -63,6 +63,10 @@ const (
 	TransactionTypeBaseAccount
 	// TransactionTypeCreateDatabase defines database creation transaction type.
 	TransactionTypeCreateDatabase
+	// TransactionTypeStorageProofFailure defines storage proof failure report transaction type.
+	TransactionTypeStorageProofFailure
+	// TransactionTypeTopUpDatabase defines database deposit top-up transaction type.
+	TransactionTypeTopUpDatabase
 	// TransactionTypeNumber defines transaction types number.
 	TransactionTypeNumber
 )
@@ -87,6 +91,10 @@ func (t TransactionType) String() string {
 		return "BaseAccount"
 	case TransactionTypeCreateDatabase:
 		return "CreateDatabase"
+	case TransactionTypeStorageProofFailure:
+		return "StorageProofFailure"
+	case TransactionTypeTopUpDatabase:
+		return "TopUpDatabase"
 	default:
 		return "Unknown"
 	}
@@ -97,6 +105,7 @@ func (t TransactionType) String() string {
 type Transaction interface {
 	GetAccountAddress() proto.AccountAddress
 	GetAccountNonce() AccountNonce
+	GetFee() uint64
 	Hash() hash.Hash
 	GetTransactionType() TransactionType
 	Sign(signer *asymmetric.PrivateKey) error
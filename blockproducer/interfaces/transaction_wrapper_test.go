@@ -40,6 +40,10 @@ func (e *TestTransactionEncode) GetAccountNonce() pi.AccountNonce {
 	return pi.AccountNonce(0)
 }
 
+func (e *TestTransactionEncode) GetFee() uint64 {
+	return 0
+}
+
 func (e *TestTransactionEncode) Hash() hash.Hash {
 	return hash.Hash{}
 }
@@ -18,14 +18,20 @@ package blockproducer
 
 import (
 	"bytes"
+	"container/heap"
+	"sort"
 	"sync"
 
 	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
 	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/utils"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 	"github.com/coreos/bbolt"
+	"github.com/pkg/errors"
 	"github.com/ulule/deepcopier"
 )
 
@@ -168,6 +174,64 @@ func (s *metaState) loadSQLChainObject(k proto.DatabaseID) (o *sqlchainObject, l
 	return
 }
 
+func (s *metaState) loadSQLChainProfile(k proto.DatabaseID) (p *pt.SQLChainProfile, loaded bool) {
+	var o *sqlchainObject
+	if o, loaded = s.loadSQLChainObject(k); !loaded {
+		return
+	}
+
+	s.RLock()
+	defer s.RUnlock()
+	p = copySQLChainProfile(&o.SQLChainProfile)
+	return
+}
+
+// loadCommittedSQLChainProfile loads the profile of SQLChain k from the committed state, the
+// pending transactions in pool are not counted.
+func (s *metaState) loadCommittedSQLChainProfile(k proto.DatabaseID) (
+	p *pt.SQLChainProfile, loaded bool,
+) {
+	s.RLock()
+	defer s.RUnlock()
+	var o *sqlchainObject
+	if o, loaded = s.readonly.databases[k]; !loaded || o == nil {
+		loaded = false
+		return
+	}
+	p = copySQLChainProfile(&o.SQLChainProfile)
+	return
+}
+
+// copySQLChainProfile returns a copy of o, the users may be modified by later transactions.
+func copySQLChainProfile(o *pt.SQLChainProfile) (p *pt.SQLChainProfile) {
+	p = &pt.SQLChainProfile{
+		ID:             o.ID,
+		Deposit:        o.Deposit,
+		GasPrice:       o.GasPrice,
+		Owner:          o.Owner,
+		Miners:         append([]proto.AccountAddress(nil), o.Miners...),
+		MinerNodes:     append([]proto.NodeID(nil), o.MinerNodes...),
+		Users:          make([]*pt.SQLChainUser, 0, len(o.Users)),
+		Meta:           o.Meta,
+		Status:         o.Status,
+		ArrearsPeriods: o.ArrearsPeriods,
+	}
+	for _, v := range o.Users {
+		p.Users = append(p.Users, &pt.SQLChainUser{
+			Address:    v.Address,
+			Permission: v.Permission,
+		})
+	}
+	for _, v := range o.StorageProofReports {
+		p.StorageProofReports = append(p.StorageProofReports, &pt.StorageProofReport{
+			Miner:     v.Miner,
+			Reporters: append([]proto.AccountAddress(nil), v.Reporters...),
+			Slashed:   v.Slashed,
+		})
+	}
+	return
+}
+
 func (s *metaState) loadOrStoreSQLChainObject(
 	k proto.DatabaseID, v *sqlchainObject) (o *sqlchainObject, loaded bool,
 ) {
@@ -250,8 +314,11 @@ func (s *metaState) commitProcedure() (_ func(*bolt.Tx) error) {
 }
 
 // partialCommitProcedure compares txs with pooled items, replays and commits the state due to txs
-// if txs matches part of or all the pooled items. Not committed txs will be left in the pool.
-func (s *metaState) partialCommitProcedure(txs []pi.Transaction) (_ func(*bolt.Tx) error) {
+// if txs matches part of or all the pooled items, together with the database allocations of the
+// created databases. Not committed txs will be left in the pool.
+func (s *metaState) partialCommitProcedure(
+	txs []pi.Transaction, allocs []*pt.DatabaseAllocation) (_ func(*bolt.Tx) error,
+) {
 	return func(tx *bolt.Tx) (err error) {
 		var (
 			enc *bytes.Buffer
@@ -280,6 +347,9 @@ func (s *metaState) partialCommitProcedure(txs []pi.Transaction) (_ func(*bolt.T
 				return
 			}
 		}
+		if err = cm.applyAllocations(txs, allocs); err != nil {
+			return
+		}
 
 		for k, v := range cm.dirty.accounts {
 			if v != nil {
@@ -320,13 +390,7 @@ func (s *metaState) partialCommitProcedure(txs []pi.Transaction) (_ func(*bolt.T
 
 		// Rebuild dirty map
 		cm.dirty = newMetaIndex()
-		for _, v := range cp.entries {
-			for _, tx := range v.transactions {
-				if err = cm.applyTransaction(tx); err != nil {
-					return
-				}
-			}
-		}
+		cm.replayTxPool(cp)
 
 		// Clean dirty map and tx pool
 		s.pool = cp
@@ -336,6 +400,34 @@ func (s *metaState) partialCommitProcedure(txs []pi.Transaction) (_ func(*bolt.T
 	}
 }
 
+// replayTxPool applies the pending transactions of p in nonce order of each account. As a
+// transaction may depend on the ones of other accounts, the failed ones are retried until no more
+// transaction applies, and the remaining are dropped from p.
+func (s *metaState) replayTxPool(p *txPool) {
+	var applied = make(map[proto.AccountAddress]int)
+	for progress := true; progress; {
+		progress = false
+		for k, v := range p.entries {
+			for i := applied[k]; i < len(v.transactions); i++ {
+				if err := s.applyTransaction(v.transactions[i]); err != nil {
+					break
+				}
+				applied[k] = i + 1
+				progress = true
+			}
+		}
+	}
+	for k, v := range p.entries {
+		if n := applied[k]; n < len(v.transactions) {
+			log.WithFields(log.Fields{
+				"account": k.String(),
+				"dropped": len(v.transactions) - n,
+			}).Debug("drop pending transactions failed to replay")
+			v.transactions = v.transactions[:n]
+		}
+	}
+}
+
 func (s *metaState) reloadProcedure() (_ func(*bolt.Tx) error) {
 	return func(tx *bolt.Tx) (err error) {
 		s.Lock()
@@ -569,6 +661,78 @@ func (s *metaState) addSQLChainUser(
 	return
 }
 
+func (s *metaState) increaseSQLChainDeposit(k proto.DatabaseID, amount uint64) error {
+	s.Lock()
+	defer s.Unlock()
+	var (
+		src, dst *sqlchainObject
+		ok       bool
+	)
+	if dst, ok = s.dirty.databases[k]; !ok {
+		if src, ok = s.readonly.databases[k]; !ok {
+			return ErrDatabaseNotFound
+		}
+		dst = &sqlchainObject{}
+		deepcopier.Copy(&src.SQLChainProfile).To(&dst.SQLChainProfile)
+		s.dirty.databases[k] = dst
+	}
+	return safeAdd(&dst.SQLChainProfile.Deposit, &amount)
+}
+
+// addStorageProofReport records the storage proof failure of miner reported by reporter in
+// SQLChain k, it returns true if the miner is reported by quorum reporters and should be slashed.
+func (s *metaState) addStorageProofReport(
+	k proto.DatabaseID, miner, reporter proto.AccountAddress, quorum int,
+) (slash bool, err error) {
+	s.Lock()
+	defer s.Unlock()
+	var (
+		src, dst *sqlchainObject
+		ok       bool
+		index    = -1
+		report   = &pt.StorageProofReport{Miner: miner}
+	)
+	if dst, ok = s.dirty.databases[k]; !ok {
+		if src, ok = s.readonly.databases[k]; !ok {
+			err = ErrDatabaseNotFound
+			return
+		}
+		dst = &sqlchainObject{}
+		deepcopier.Copy(&src.SQLChainProfile).To(&dst.SQLChainProfile)
+		s.dirty.databases[k] = dst
+	}
+	for i, v := range dst.StorageProofReports {
+		if v.Miner != miner {
+			continue
+		}
+		if v.Slashed {
+			err = ErrMinerAlreadySlashed
+			return
+		}
+		for _, r := range v.Reporters {
+			if r == reporter {
+				err = ErrDuplicateStorageProofReport
+				return
+			}
+		}
+		index = i
+		report.Reporters = append(report.Reporters, v.Reporters...)
+		break
+	}
+	report.Reporters = append(report.Reporters, reporter)
+	report.Slashed = len(report.Reporters) >= quorum
+	// the reports may be shared with the readonly index, replace them instead of modifying
+	reports := append([]*pt.StorageProofReport(nil), dst.StorageProofReports...)
+	if index >= 0 {
+		reports[index] = report
+	} else {
+		reports = append(reports, report)
+	}
+	dst.StorageProofReports = reports
+	slash = report.Slashed
+	return
+}
+
 func (s *metaState) deleteSQLChainUser(k proto.DatabaseID, addr proto.AccountAddress) error {
 	s.Lock()
 	defer s.Unlock()
@@ -590,6 +754,7 @@ func (s *metaState) deleteSQLChainUser(k proto.DatabaseID, addr proto.AccountAdd
 			dst.Users[i] = dst.Users[last]
 			dst.Users[last] = nil
 			dst.Users = dst.Users[:last]
+			break
 		}
 	}
 	return nil
@@ -661,31 +826,451 @@ func (s *metaState) increaseNonce(addr proto.AccountAddress) (err error) {
 }
 
 func (s *metaState) applyBilling(tx *pt.Billing) (err error) {
+	var (
+		fees = tx.Fees
+		dbID = tx.BillingRequest.Header.DatabaseID
+		drop bool
+	)
+	if len(fees) != len(tx.Receivers) || len(tx.Rewards) != len(tx.Receivers) {
+		return ErrInvalidBillingRequest
+	}
+	// the fees of the SQLChains created on chain are settled against the deposit
+	if _, loaded := s.loadSQLChainObject(dbID); loaded {
+		if fees, drop, err = s.settleSQLChainBilling(dbID, tx.Fees); err != nil {
+			return
+		}
+	}
 	for i, v := range tx.Receivers {
 		// Create empty receiver account if not found
 		s.loadOrStoreAccountObject(*v, &accountObject{Account: pt.Account{Address: *v}})
 
-		if err = s.increaseAccountCovenantBalance(*v, tx.Fees[i]); err != nil {
+		if err = s.increaseAccountCovenantBalance(*v, fees[i]); err != nil {
 			return
 		}
 		if err = s.increaseAccountStableBalance(*v, tx.Rewards[i]); err != nil {
 			return
 		}
 	}
+	if drop {
+		err = s.dropSQLChain(dbID)
+	}
+	return
+}
+
+// settleSQLChainBilling debits the fees from the deposit of SQLChain k and returns the fees
+// actually paid, which are paid in order until the deposit runs out. The deposit is low if it
+// cannot cover the fees of one more period, the SQLChain enters the grace period in this case,
+// then it's frozen, and should be dropped if the deposit is still low after these periods.
+func (s *metaState) settleSQLChainBilling(k proto.DatabaseID, fees []uint64) (
+	paid []uint64, drop bool, err error,
+) {
+	s.Lock()
+	defer s.Unlock()
+	var (
+		src, dst *sqlchainObject
+		ok       bool
+		total    uint64
+	)
+	if dst, ok = s.dirty.databases[k]; !ok {
+		if src, ok = s.readonly.databases[k]; !ok {
+			err = ErrDatabaseNotFound
+			return
+		}
+		dst = &sqlchainObject{}
+		deepcopier.Copy(&src.SQLChainProfile).To(&dst.SQLChainProfile)
+		s.dirty.databases[k] = dst
+	}
+	// the storage proof failures are reported and slashed per billing period
+	dst.StorageProofReports = nil
+	paid = make([]uint64, len(fees))
+	for i, v := range fees {
+		if err = safeAdd(&total, &v); err != nil {
+			return
+		}
+		if v > dst.Deposit {
+			v = dst.Deposit
+		}
+		dst.Deposit -= v
+		paid[i] = v
+	}
+	if dst.Deposit > 0 && dst.Deposit >= total {
+		dst.Status = pt.DatabaseNormal
+		dst.ArrearsPeriods = 0
+		return
+	}
+	dst.ArrearsPeriods++
+	switch {
+	case dst.ArrearsPeriods <= DatabaseGracePeriods:
+		dst.Status = pt.DatabaseInGracePeriod
+	case dst.ArrearsPeriods <= DatabaseGracePeriods+DatabaseFrozenPeriods:
+		dst.Status = pt.DatabaseFrozen
+	default:
+		dst.Status = pt.DatabaseDropped
+		drop = true
+	}
 	return
 }
 
+// dropSQLChain removes SQLChain k and refunds the remaining deposit to its owner.
+func (s *metaState) dropSQLChain(k proto.DatabaseID) (err error) {
+	var (
+		p      *pt.SQLChainProfile
+		loaded bool
+	)
+	if p, loaded = s.loadSQLChainProfile(k); !loaded {
+		return ErrDatabaseNotFound
+	}
+	if p.Deposit > 0 {
+		if err = s.increaseAccountStableBalance(p.Owner, p.Deposit); err != nil {
+			return
+		}
+	}
+	s.deleteSQLChainObject(k)
+	return
+}
+
+// applyTopUpDatabase moves the stable coin of the payer to the deposit of the target SQLChain.
+// The status of the SQLChain is restored by the next billing settlement if the deposit is enough.
+func (s *metaState) applyTopUpDatabase(tx *pt.TopUpDatabase) (err error) {
+	if _, loaded := s.loadSQLChainObject(tx.TargetSQLChain); !loaded {
+		return ErrDatabaseNotFound
+	}
+	if err = s.decreaseAccountStableBalance(tx.Payer, tx.Amount); err != nil {
+		return
+	}
+	return s.increaseSQLChainDeposit(tx.TargetSQLChain, tx.Amount)
+}
+
+// checkSQLChainUserUpdate checks that advocate is allowed to update the target user of database k:
+// the advocate should be the signer of the transaction and the owner or an admin user of the
+// database, and the owner itself cannot be updated by any user transaction.
+func (s *metaState) checkSQLChainUserUpdate(
+	k proto.DatabaseID, signee *asymmetric.PublicKey, advocate, target proto.AccountAddress) (
+	p *pt.SQLChainProfile, err error,
+) {
+	if err = pt.VerifySignee(signee, advocate); err != nil {
+		return
+	}
+	var loaded bool
+	if p, loaded = s.loadSQLChainProfile(k); !loaded {
+		err = ErrDatabaseNotFound
+		return
+	}
+	if target == p.Owner {
+		err = ErrAccessDenied
+		return
+	}
+	if advocate == p.Owner {
+		return
+	}
+	for _, v := range p.Users {
+		if v.Address == advocate && v.Permission == pt.Admin {
+			return
+		}
+	}
+	err = ErrAccessDenied
+	return
+}
+
+func hasSQLChainUser(p *pt.SQLChainProfile, addr proto.AccountAddress) bool {
+	for _, v := range p.Users {
+		if v.Address == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *metaState) applyAddDatabaseUser(tx *pt.AddDatabaseUser) (err error) {
+	if tx.Permission < 0 || tx.Permission >= pt.NumberOfUserPermission {
+		return ErrInvalidPermission
+	}
+	if _, err = s.checkSQLChainUserUpdate(
+		tx.TargetSQLChain, tx.Signee, tx.Advocate, tx.TargetUser); err != nil {
+		return
+	}
+	return s.addSQLChainUser(tx.TargetSQLChain, tx.TargetUser, tx.Permission)
+}
+
+func (s *metaState) applyAlterDatabaseUser(tx *pt.AlterDatabaseUser) (err error) {
+	if tx.Permission < 0 || tx.Permission >= pt.NumberOfUserPermission {
+		return ErrInvalidPermission
+	}
+	var p *pt.SQLChainProfile
+	if p, err = s.checkSQLChainUserUpdate(
+		tx.TargetSQLChain, tx.Signee, tx.Advocate, tx.TargetUser); err != nil {
+		return
+	}
+	if !hasSQLChainUser(p, tx.TargetUser) {
+		return ErrDatabaseUserNotFound
+	}
+	return s.alterSQLChainUser(tx.TargetSQLChain, tx.TargetUser, tx.Permission)
+}
+
+func (s *metaState) applyDeleteDatabaseUser(tx *pt.DeleteDatabaseUser) (err error) {
+	var p *pt.SQLChainProfile
+	if p, err = s.checkSQLChainUserUpdate(
+		tx.TargetSQLChain, tx.Signee, tx.Advocate, tx.TargetUser); err != nil {
+		return
+	}
+	if !hasSQLChainUser(p, tx.TargetUser) {
+		return ErrDatabaseUserNotFound
+	}
+	return s.deleteSQLChainUser(tx.TargetSQLChain, tx.TargetUser)
+}
+
+func hasSQLChainMiner(p *pt.SQLChainProfile, addr proto.AccountAddress) bool {
+	for _, v := range p.Miners {
+		if v == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// storageProofQuorum returns the number of the reporters required to slash a miner of a database
+// with n miners. A miner can't report itself, so the miners of a database with less than 3 miners
+// are never slashed.
+func storageProofQuorum(n int) int {
+	return n/2 + 1
+}
+
+// applyStorageProofFailure records the storage proof failure of a miner reported by another miner
+// of the same database. The miner is slashed once it's reported by a quorum of the miners, and at
+// most once in a billing period. The penalty is limited to the stable coin balance of the miner.
+func (s *metaState) applyStorageProofFailure(tx *pt.StorageProofFailure) (err error) {
+	var (
+		p       *pt.SQLChainProfile
+		balance uint64
+		penalty = StorageProofPenalty
+		loaded  bool
+		slash   bool
+	)
+	if p, loaded = s.loadSQLChainProfile(tx.TargetSQLChain); !loaded {
+		return ErrDatabaseNotFound
+	}
+	if tx.Reporter == tx.Miner ||
+		!hasSQLChainMiner(p, tx.Reporter) || !hasSQLChainMiner(p, tx.Miner) {
+		return ErrAccessDenied
+	}
+	if balance, loaded = s.loadAccountStableBalance(tx.Miner); !loaded {
+		return ErrAccountNotFound
+	}
+	if slash, err = s.addStorageProofReport(
+		tx.TargetSQLChain, tx.Miner, tx.Reporter, storageProofQuorum(len(p.Miners)),
+	); err != nil || !slash {
+		return
+	}
+	if balance < penalty {
+		penalty = balance
+	}
+	if err = s.increaseSQLChainDeposit(tx.TargetSQLChain, penalty); err != nil {
+		return
+	}
+	return s.decreaseAccountStableBalance(tx.Miner, penalty)
+}
+
+// applyCreateDatabase moves the advance payment of the owner to the database deposit and records
+// the database profile. The miners are allocated by the block proposer and recorded in the block,
+// see applyDatabaseAllocation.
+func (s *metaState) applyCreateDatabase(tx *pt.CreateDatabase) (err error) {
+	var (
+		dbID    proto.DatabaseID
+		balance uint64
+		loaded  bool
+	)
+	if dbID, err = tx.DatabaseID(); err != nil {
+		return
+	}
+	if _, loaded = s.loadSQLChainObject(dbID); loaded {
+		return ErrDatabaseExists
+	}
+	if balance, loaded = s.loadAccountStableBalance(tx.Owner); !loaded {
+		return ErrAccountNotFound
+	}
+	if balance < tx.AdvancePayment {
+		return ErrInsufficientBalance
+	}
+	if err = s.createSQLChain(tx.Owner, dbID); err != nil {
+		return
+	}
+	if err = s.decreaseAccountStableBalance(tx.Owner, tx.AdvancePayment); err != nil {
+		return
+	}
+	return s.setSQLChainProvision(dbID, tx)
+}
+
+// setSQLChainProvision records the provision of the newly created database k.
+func (s *metaState) setSQLChainProvision(k proto.DatabaseID, tx *pt.CreateDatabase) (_ error) {
+	s.Lock()
+	defer s.Unlock()
+	var dst, ok = s.dirty.databases[k]
+	if !ok || dst == nil {
+		return ErrDatabaseNotFound
+	}
+	dst.Deposit = tx.AdvancePayment
+	dst.GasPrice = tx.GasPrice
+	dst.Meta = tx.ResourceMeta
+	return nil
+}
+
+// unwrapCreateDatabase returns the database creation transaction of t if it is one.
+func unwrapCreateDatabase(t pi.Transaction) (cd *pt.CreateDatabase, ok bool) {
+	if w, wrapped := t.(*pi.TransactionWrapper); wrapped {
+		t = w.Unwrap()
+	}
+	cd, ok = t.(*pt.CreateDatabase)
+	return
+}
+
+// checkDatabaseAllocation checks that allocation a of the database created by tx has exactly the
+// requested count of distinct miners, whose node ids are derived from the carried public keys,
+// and returns the miner accounts. It only depends on the block contents.
+func checkDatabaseAllocation(tx *pt.CreateDatabase, a *pt.DatabaseAllocation) (
+	miners []proto.AccountAddress, err error,
+) {
+	var dbID proto.DatabaseID
+	if dbID, err = tx.DatabaseID(); err != nil {
+		return
+	}
+	if a == nil || a.DatabaseID != dbID || len(a.Miners) == 0 ||
+		len(a.Miners) != int(tx.ResourceMeta.Node) {
+		err = ErrInvalidAllocation
+		return
+	}
+	var nodes = make(map[proto.NodeID]struct{}, len(a.Miners))
+	for _, v := range a.Miners {
+		var addr proto.AccountAddress
+		if v == nil {
+			err = errors.Wrap(ErrInvalidAllocation, "nil miner")
+			return
+		}
+		if _, ok := nodes[v.NodeID]; ok {
+			err = errors.Wrapf(ErrInvalidAllocation, "duplicate miner %s", v.NodeID)
+			return
+		}
+		nodes[v.NodeID] = struct{}{}
+		if !kms.IsIDPubNonceValid(v.NodeID.ToRawNodeID(), &v.Nonce, v.PublicKey) {
+			err = errors.Wrapf(ErrInvalidAllocation, "miner %s mismatches its key", v.NodeID)
+			return
+		}
+		if addr, err = crypto.PubKeyHash(v.PublicKey); err != nil {
+			return
+		}
+		miners = append(miners, addr)
+	}
+	return
+}
+
+// applyDatabaseAllocation verifies and records allocation a of the database created by tx.
+func (s *metaState) applyDatabaseAllocation(
+	tx *pt.CreateDatabase, a *pt.DatabaseAllocation) (err error,
+) {
+	var miners []proto.AccountAddress
+	if miners, err = checkDatabaseAllocation(tx, a); err != nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	var dst, ok = s.dirty.databases[a.DatabaseID]
+	if !ok || dst == nil {
+		return ErrDatabaseNotFound
+	}
+	if len(dst.MinerNodes) > 0 {
+		return errors.Wrapf(ErrInvalidAllocation, "database %s is already allocated", a.DatabaseID)
+	}
+	dst.Miners = miners
+	dst.MinerNodes = a.MinerNodes()
+	return
+}
+
+// matchAllocations calls f with each database creation transaction of txs and its allocation of
+// allocs, which should match the transactions one by one in order.
+func matchAllocations(
+	txs []pi.Transaction, allocs []*pt.DatabaseAllocation,
+	f func(*pt.CreateDatabase, *pt.DatabaseAllocation) error) (err error,
+) {
+	var i int
+	for _, v := range txs {
+		var cd, ok = unwrapCreateDatabase(v)
+		if !ok {
+			continue
+		}
+		if i >= len(allocs) {
+			return errors.Wrapf(ErrInvalidAllocation, "missing allocation of tx %s",
+				v.Hash().String())
+		}
+		if err = f(cd, allocs[i]); err != nil {
+			return
+		}
+		i++
+	}
+	if i != len(allocs) {
+		return errors.Wrapf(ErrInvalidAllocation, "unexpected allocation count %d", len(allocs))
+	}
+	return
+}
+
+// checkAllocations checks the database allocations allocs of the block with transactions txs
+// without applying them.
+func checkAllocations(txs []pi.Transaction, allocs []*pt.DatabaseAllocation) error {
+	return matchAllocations(txs, allocs,
+		func(cd *pt.CreateDatabase, a *pt.DatabaseAllocation) (err error) {
+			_, err = checkDatabaseAllocation(cd, a)
+			return
+		})
+}
+
+// applyAllocations applies the database allocations allocs of the block with transactions txs.
+func (s *metaState) applyAllocations(
+	txs []pi.Transaction, allocs []*pt.DatabaseAllocation) (_ error,
+) {
+	return matchAllocations(txs, allocs, s.applyDatabaseAllocation)
+}
+
+// applyTransaction charges the fee of tx from the stable coin balance of its account and applies
+// it. The fee is burned, and refunded if tx fails to apply.
 func (s *metaState) applyTransaction(tx pi.Transaction) (err error) {
+	switch t := tx.(type) {
+	case nil:
+		return ErrUnknownTransactionType
+	case *pi.TransactionWrapper:
+		// call again using unwrapped transaction
+		return s.applyTransaction(t.Unwrap())
+	}
+	var (
+		addr = tx.GetAccountAddress()
+		fee  = tx.GetFee()
+	)
+	if fee > 0 {
+		if err = s.decreaseAccountStableBalance(addr, fee); err != nil {
+			return
+		}
+		defer func() {
+			if err != nil {
+				s.increaseAccountStableBalance(addr, fee)
+			}
+		}()
+	}
 	switch t := tx.(type) {
 	case *pt.Transfer:
 		err = s.transferAccountStableBalance(t.Sender, t.Receiver, t.Amount)
 	case *pt.Billing:
 		err = s.applyBilling(t)
+	case *pt.AddDatabaseUser:
+		err = s.applyAddDatabaseUser(t)
+	case *pt.AlterDatabaseUser:
+		err = s.applyAlterDatabaseUser(t)
+	case *pt.DeleteDatabaseUser:
+		err = s.applyDeleteDatabaseUser(t)
+	case *pt.StorageProofFailure:
+		err = s.applyStorageProofFailure(t)
+	case *pt.CreateDatabase:
+		err = s.applyCreateDatabase(t)
+	case *pt.TopUpDatabase:
+		err = s.applyTopUpDatabase(t)
 	case *pt.BaseAccount:
 		err = s.storeBaseAccount(t.Address, &accountObject{Account: t.Account})
-	case *pi.TransactionWrapper:
-		// call again using unwrapped transaction
-		err = s.applyTransaction(t.Unwrap())
 	default:
 		err = ErrUnknownTransactionType
 	}
@@ -770,12 +1355,178 @@ func (s *metaState) applyTransactionProcedure(t pi.Transaction) (_ func(*bolt.Tx
 	}
 }
 
-func (s *metaState) pullTxs() (txs []pi.Transaction) {
+// applyBlockProcedure applies the transactions of the block and commits the state.
+func (s *metaState) applyBlockProcedure(b *pt.Block) (_ func(*bolt.Tx) error) {
+	return func(tx *bolt.Tx) (err error) {
+		for _, v := range b.Transactions {
+			if err = s.applyTransactionProcedure(v)(tx); err != nil {
+				return
+			}
+		}
+		return s.partialCommitProcedure(b.Transactions, b.Allocations)(tx)
+	}
+}
+
+// checkTxPoolLimits checks the pool limits for the new transaction t. If the pool is full, it
+// returns the account entries whose last transaction should be evicted for t.
+func (s *metaState) checkTxPoolLimits(t pi.Transaction) (evict *accountTxEntries, err error) {
 	s.Lock()
 	defer s.Unlock()
+	var addr = t.GetAccountAddress()
+	if e, ok := s.pool.getTxEntries(addr); ok && len(e.transactions) >= MaxPendingTxsPerAccount {
+		err = ErrTooManyPendingTxs
+		return
+	}
+	if s.pool.count() < MaxPendingTxs {
+		return
+	}
+	if e, fee, ok := s.pool.lowestFeeTail(addr); ok && fee < t.GetFee() {
+		evict = e
+		return
+	}
+	err = ErrTxPoolFull
+	return
+}
+
+// addTxProcedure adds the new transaction t to the pool with the pool limits checked, which is
+// used for the transactions not from blocks.
+func (s *metaState) addTxProcedure(t pi.Transaction) (_ func(*bolt.Tx) error) {
+	return func(tx *bolt.Tx) (err error) {
+		if s.pool.hasTx(t) {
+			return
+		}
+		var evict *accountTxEntries
+		if evict, err = s.checkTxPoolLimits(t); err != nil {
+			return
+		}
+		if err = s.applyTransactionProcedure(t)(tx); err != nil || evict == nil {
+			return
+		}
+		return s.evictTxProcedure(evict)(tx)
+	}
+}
+
+// evictTxProcedure removes the last transaction of e from the pool, and rebuilds the dirty state
+// without it.
+func (s *metaState) evictTxProcedure(e *accountTxEntries) (_ func(*bolt.Tx) error) {
+	return func(tx *bolt.Tx) (err error) {
+		s.Lock()
+		defer s.Unlock()
+		var t = e.removeLastTx()
+		if t == nil {
+			return
+		}
+		var (
+			hash = t.Hash()
+			tb   = tx.Bucket(metaBucket[:]).Bucket(metaTransactionBucket).Bucket(
+				t.GetTransactionType().Bytes())
+		)
+		if err = tb.Delete(hash[:]); err != nil {
+			return
+		}
+		log.WithFields(log.Fields{
+			"tx":  hash.String(),
+			"fee": t.GetFee(),
+		}).Debug("evict pending transaction with the lowest fee")
+
+		var cm = &metaState{
+			dirty:    newMetaIndex(),
+			readonly: s.readonly,
+		}
+		cm.replayTxPool(s.pool)
+		s.dirty = cm.dirty
+		return
+	}
+}
+
+// packTxs selects the pending transactions for the next block by fee from high to low, while the
+// transactions of each account are kept in nonce order. The miners of the created databases are
+// allocated by allocate and returned in the order of the transactions. An account is skipped once
+// its next transaction exceeds the size limit, fails to apply or fails to allocate.
+func (s *metaState) packTxs(
+	maxCount, maxSize int, allocate func(*pt.CreateDatabase) (*pt.DatabaseAllocation, error),
+) (
+	txs []pi.Transaction, allocs []*pt.DatabaseAllocation,
+) {
+	s.Lock()
+	defer s.Unlock()
+	var (
+		cm = &metaState{
+			dirty:    newMetaIndex(),
+			readonly: s.readonly,
+		}
+		q    txCursorHeap
+		size int
+	)
 	for _, v := range s.pool.entries {
+		if len(v.transactions) > 0 {
+			q = append(q, &txCursor{transactions: v.transactions})
+		}
+	}
+	heap.Init(&q)
+	for q.Len() > 0 && len(txs) < maxCount {
+		var (
+			c = q[0]
+			t = c.tx()
+			n = t.Msgsize()
+		)
+		if size+n > maxSize {
+			heap.Pop(&q)
+			continue
+		}
+		var (
+			cd, created = unwrapCreateDatabase(t)
+			a           *pt.DatabaseAllocation
+			err         error
+		)
+		if created {
+			if allocate == nil {
+				err = ErrDatabaseAllocation
+			} else if a, err = allocate(cd); err == nil {
+				_, err = checkDatabaseAllocation(cd, a)
+			}
+			if err != nil {
+				log.WithField("tx", t.Hash().String()).WithError(err).Warning(
+					"allocate database failed")
+				heap.Pop(&q)
+				continue
+			}
+		}
+		if cm.applyTransaction(t) != nil {
+			heap.Pop(&q)
+			continue
+		}
+		if created {
+			// the allocation is checked above, and the database is just created by t
+			cm.applyDatabaseAllocation(cd, a)
+			allocs = append(allocs, a)
+		}
+		txs = append(txs, t)
+		size += n
+		if c.next++; c.next < len(c.transactions) {
+			heap.Fix(&q, 0)
+		} else {
+			heap.Pop(&q)
+		}
+	}
+	return
+}
+
+// pullTxs returns the pending transactions in the pool, ordered by account address and nonce, so
+// that the pool is rebuilt in the same order on every node.
+func (s *metaState) pullTxs() (txs []pi.Transaction) {
+	s.Lock()
+	defer s.Unlock()
+	var addrs = make([]proto.AccountAddress, 0, len(s.pool.entries))
+	for k := range s.pool.entries {
+		addrs = append(addrs, k)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return bytes.Compare(addrs[i][:], addrs[j][:]) < 0
+	})
+	for _, v := range addrs {
 		// TODO(leventeliu): check race condition.
-		txs = append(txs, v.transactions...)
+		txs = append(txs, s.pool.entries[v].transactions...)
 	}
 	return
 }
@@ -24,6 +24,8 @@ import (
 
 	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
 	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/coreos/bbolt"
 	. "github.com/smartystreets/goconvey/convey"
@@ -166,11 +168,163 @@ func TestMetaState(t *testing.T) {
 					err = ms.createSQLChain(addr1, dbid3)
 					So(err, ShouldEqual, ErrDatabaseExists)
 				})
+				Convey("The database user transactions should be authorized by admins", func() {
+					var (
+						dbid  = proto.DatabaseID("db#5")
+						privs = make([]*asymmetric.PrivateKey, 3)
+						users = make([]proto.AccountAddress, 3)
+					)
+					for i := range privs {
+						privs[i], _, err = asymmetric.GenSecp256k1KeyPair()
+						So(err, ShouldBeNil)
+						users[i], err = crypto.PubKeyHash(privs[i].PubKey())
+						So(err, ShouldBeNil)
+					}
+					_, loaded = ms.loadOrStoreAccountObject(users[0], &accountObject{
+						Account: pt.Account{Address: users[0]},
+					})
+					So(loaded, ShouldBeFalse)
+					err = ms.createSQLChain(users[0], dbid)
+					So(err, ShouldBeNil)
+					signed := func(tx pi.Transaction, priv *asymmetric.PrivateKey) pi.Transaction {
+						So(tx.Sign(priv), ShouldBeNil)
+						return tx
+					}
+
+					// the grant on behalf of the owner signed by a non-owner should be rejected
+					tx := signed(pt.NewAddDatabaseUser(&pt.AddDatabaseUserHeader{
+						Advocate: users[0], TargetSQLChain: dbid, TargetUser: users[1], Permission: pt.Admin,
+					}), privs[1])
+					So(tx.Verify(), ShouldEqual, pt.ErrSigneeNotMatch)
+					err = ms.applyTransaction(tx)
+					So(err, ShouldEqual, pt.ErrSigneeNotMatch)
+					err = ms.applyTransaction(pt.NewAddDatabaseUser(&pt.AddDatabaseUserHeader{
+						Advocate: users[0], TargetSQLChain: dbid, TargetUser: users[1], Permission: pt.Admin,
+					}))
+					So(err, ShouldEqual, pt.ErrSigneeNotMatch)
+
+					err = ms.applyTransaction(signed(pt.NewAddDatabaseUser(&pt.AddDatabaseUserHeader{
+						Advocate: users[1], TargetSQLChain: dbid, TargetUser: users[2], Permission: pt.Read,
+					}), privs[1]))
+					So(err, ShouldEqual, ErrAccessDenied)
+					err = ms.applyTransaction(signed(pt.NewAddDatabaseUser(&pt.AddDatabaseUserHeader{
+						Advocate: users[0], TargetSQLChain: dbid, TargetUser: users[1],
+						Permission: pt.NumberOfUserPermission,
+					}), privs[0]))
+					So(err, ShouldEqual, ErrInvalidPermission)
+					err = ms.applyTransaction(signed(pt.NewAddDatabaseUser(&pt.AddDatabaseUserHeader{
+						Advocate: users[0], TargetSQLChain: dbid, TargetUser: users[1], Permission: pt.Admin,
+					}), privs[0]))
+					So(err, ShouldBeNil)
+					err = ms.applyTransaction(signed(pt.NewAddDatabaseUser(&pt.AddDatabaseUserHeader{
+						Advocate: users[1], TargetSQLChain: dbid, TargetUser: users[2], Permission: pt.Read,
+					}), privs[1]))
+					So(err, ShouldBeNil)
+					err = ms.applyTransaction(signed(pt.NewAlterDatabaseUser(&pt.AlterDatabaseUserHeader{
+						Advocate: users[2], TargetSQLChain: dbid, TargetUser: users[2], Permission: pt.Admin,
+					}), privs[2]))
+					So(err, ShouldEqual, ErrAccessDenied)
+					err = ms.applyTransaction(signed(pt.NewAlterDatabaseUser(&pt.AlterDatabaseUserHeader{
+						Advocate: users[1], TargetSQLChain: dbid, TargetUser: users[0], Permission: pt.Read,
+					}), privs[1]))
+					So(err, ShouldEqual, ErrAccessDenied)
+					err = ms.applyTransaction(signed(pt.NewAlterDatabaseUser(&pt.AlterDatabaseUserHeader{
+						Advocate: users[1], TargetSQLChain: dbid, TargetUser: users[2], Permission: pt.ReadWrite,
+					}), privs[2]))
+					So(err, ShouldEqual, pt.ErrSigneeNotMatch)
+					err = ms.applyTransaction(signed(pt.NewAlterDatabaseUser(&pt.AlterDatabaseUserHeader{
+						Advocate: users[1], TargetSQLChain: dbid, TargetUser: users[2], Permission: pt.ReadWrite,
+					}), privs[1]))
+					So(err, ShouldBeNil)
+					err = ms.applyTransaction(signed(pt.NewDeleteDatabaseUser(&pt.DeleteDatabaseUserHeader{
+						Advocate: users[0], TargetSQLChain: dbid, TargetUser: users[1],
+					}), privs[1]))
+					So(err, ShouldEqual, pt.ErrSigneeNotMatch)
+					err = ms.applyTransaction(signed(pt.NewDeleteDatabaseUser(&pt.DeleteDatabaseUserHeader{
+						Advocate: users[0], TargetSQLChain: dbid, TargetUser: users[1],
+					}), privs[0]))
+					So(err, ShouldBeNil)
+					err = ms.applyTransaction(signed(pt.NewDeleteDatabaseUser(&pt.DeleteDatabaseUserHeader{
+						Advocate: users[0], TargetSQLChain: dbid, TargetUser: users[1],
+					}), privs[0]))
+					So(err, ShouldEqual, ErrDatabaseUserNotFound)
+					err = ms.applyTransaction(signed(pt.NewDeleteDatabaseUser(&pt.DeleteDatabaseUserHeader{
+						Advocate: users[0], TargetSQLChain: proto.DatabaseID("db#4"), TargetUser: users[1],
+					}), privs[0]))
+					So(err, ShouldEqual, ErrDatabaseNotFound)
+					profile, loaded := ms.loadSQLChainProfile(dbid)
+					So(loaded, ShouldBeTrue)
+					So(profile.Users, ShouldResemble, []*pt.SQLChainUser{
+						{Address: users[0], Permission: pt.Admin},
+						{Address: users[2], Permission: pt.ReadWrite},
+					})
+				})
+				Convey("The storage proof failure should slash the miner reported by a quorum", func() {
+					var (
+						addr4  = proto.AccountAddress{0x0, 0x0, 0x0, 0x4}
+						report = func(reporter, miner proto.AccountAddress, dbid proto.DatabaseID) error {
+							return ms.applyTransaction(pt.NewStorageProofFailure(&pt.StorageProofFailureHeader{
+								Reporter: reporter, TargetSQLChain: dbid, Miner: miner,
+							}))
+						}
+						balance uint64
+					)
+					ms.dirty.databases[dbid3].Miners = []proto.AccountAddress{addr1, addr2, addr3}
+					err = ms.increaseAccountStableBalance(addr2, StorageProofPenalty+1)
+					So(err, ShouldBeNil)
+					balance, loaded = ms.loadAccountStableBalance(addr2)
+					So(loaded, ShouldBeTrue)
+					So(report(addr4, addr2, dbid3), ShouldEqual, ErrAccessDenied)
+					So(report(addr1, addr1, dbid3), ShouldEqual, ErrAccessDenied)
+					So(report(addr1, addr2, proto.DatabaseID("db#4")), ShouldEqual, ErrDatabaseNotFound)
+
+					// a single reporter can not slash the miner
+					So(report(addr1, addr2, dbid3), ShouldBeNil)
+					So(report(addr1, addr2, dbid3), ShouldEqual, ErrDuplicateStorageProofReport)
+					bl, loaded = ms.loadAccountStableBalance(addr2)
+					So(loaded, ShouldBeTrue)
+					So(bl, ShouldEqual, balance)
+
+					// slashed by the quorum, and at most once in a billing period
+					So(report(addr3, addr2, dbid3), ShouldBeNil)
+					So(report(addr3, addr2, dbid3), ShouldEqual, ErrMinerAlreadySlashed)
+					bl, loaded = ms.loadAccountStableBalance(addr2)
+					So(loaded, ShouldBeTrue)
+					So(bl, ShouldEqual, balance-StorageProofPenalty)
+					profile, loaded := ms.loadSQLChainProfile(dbid3)
+					So(loaded, ShouldBeTrue)
+					So(profile.Deposit, ShouldEqual, StorageProofPenalty)
+					So(profile.StorageProofReports, ShouldResemble, []*pt.StorageProofReport{
+						{Miner: addr2, Reporters: []proto.AccountAddress{addr1, addr3}, Slashed: true},
+					})
+
+					// the reports are reset in the next billing period
+					_, _, err = ms.settleSQLChainBilling(dbid3, nil)
+					So(err, ShouldBeNil)
+					profile, loaded = ms.loadSQLChainProfile(dbid3)
+					So(loaded, ShouldBeTrue)
+					So(profile.StorageProofReports, ShouldBeEmpty)
+					So(report(addr3, addr2, dbid3), ShouldBeNil)
+					bl, loaded = ms.loadAccountStableBalance(addr2)
+					So(loaded, ShouldBeTrue)
+					So(bl, ShouldEqual, balance-StorageProofPenalty)
+				})
 				Convey("When new SQLChain users are added", func() {
 					err = ms.addSQLChainUser(dbid3, addr2, pt.ReadWrite)
 					So(err, ShouldBeNil)
 					err = ms.addSQLChainUser(dbid3, addr2, pt.ReadWrite)
 					So(err, ShouldEqual, ErrDatabaseUserExists)
+					Convey("The profile should include the users", func() {
+						profile, loaded := ms.loadSQLChainProfile(dbid3)
+						So(loaded, ShouldBeTrue)
+						So(profile.Owner, ShouldEqual, addr1)
+						So(profile.Users, ShouldResemble, []*pt.SQLChainUser{
+							{Address: addr1, Permission: pt.Admin},
+							{Address: addr2, Permission: pt.ReadWrite},
+						})
+						_, loaded = ms.loadSQLChainProfile(proto.DatabaseID("db#4"))
+						So(loaded, ShouldBeFalse)
+					})
 					Convey("The metaState object should be ok to delete user", func() {
 						err = ms.deleteSQLChainUser(dbid3, addr2)
 						So(err, ShouldBeNil)
@@ -648,30 +802,32 @@ func TestMetaState(t *testing.T) {
 				Convey("The txs should be able to be pulled from pool", func() {
 					var txs = ms.pullTxs()
 					So(len(txs), ShouldEqual, 3)
-					for _, tx := range txs {
+					for i, tx := range txs {
 						So(ms.pool.hasTx(tx), ShouldBeTrue)
+						So(tx.GetAccountNonce(), ShouldEqual, i)
 					}
+					So(ms.pullTxs(), ShouldResemble, txs)
 				})
 				Convey("The partial commit procedure should be appliable for empty txs", func() {
-					err = db.Update(ms.partialCommitProcedure([]pi.Transaction{}))
+					err = db.Update(ms.partialCommitProcedure([]pi.Transaction{}, nil))
 					So(err, ShouldBeNil)
 					So(ms.pool.entries[addr1].baseNonce, ShouldEqual, 0)
 					So(len(ms.pool.entries[addr1].transactions), ShouldEqual, 3)
 				})
 				Convey("The partial commit procedure should be appliable for tx0", func() {
-					err = db.Update(ms.partialCommitProcedure([]pi.Transaction{t0}))
+					err = db.Update(ms.partialCommitProcedure([]pi.Transaction{t0}, nil))
 					So(err, ShouldBeNil)
 					So(ms.pool.entries[addr1].baseNonce, ShouldEqual, 1)
 					So(len(ms.pool.entries[addr1].transactions), ShouldEqual, 2)
 				})
 				Convey("The partial commit procedure should be appliable for tx0-1", func() {
-					err = db.Update(ms.partialCommitProcedure([]pi.Transaction{t0, t1}))
+					err = db.Update(ms.partialCommitProcedure([]pi.Transaction{t0, t1}, nil))
 					So(err, ShouldBeNil)
 					So(ms.pool.entries[addr1].baseNonce, ShouldEqual, 2)
 					So(len(ms.pool.entries[addr1].transactions), ShouldEqual, 1)
 				})
 				Convey("The partial commit procedure should be appliable for all tx", func() {
-					err = db.Update(ms.partialCommitProcedure([]pi.Transaction{t0, t1, t2}))
+					err = db.Update(ms.partialCommitProcedure([]pi.Transaction{t0, t1, t2}, nil))
 					So(err, ShouldBeNil)
 					So(ms.pool.entries[addr1].baseNonce, ShouldEqual, 3)
 					So(len(ms.pool.entries[addr1].transactions), ShouldEqual, 0)
@@ -682,7 +838,7 @@ func TestMetaState(t *testing.T) {
 						t1.Nonce = pi.AccountNonce(10)
 						err = t1.Sign(testPrivKey)
 						So(err, ShouldBeNil)
-						err = db.Update(ms.partialCommitProcedure([]pi.Transaction{t0, t1, t2}))
+						err = db.Update(ms.partialCommitProcedure([]pi.Transaction{t0, t1, t2}, nil))
 						So(err, ShouldEqual, ErrTransactionMismatch)
 						So(len(ms.pool.entries[addr1].transactions), ShouldEqual, 3)
 					},
@@ -781,7 +937,7 @@ func TestMetaState(t *testing.T) {
 				So(bl, ShouldEqual, 118)
 			})
 			Convey("When state change is partial committed #0", func() {
-				err = db.Update(ms.partialCommitProcedure(nil))
+				err = db.Update(ms.partialCommitProcedure(nil, nil))
 				So(err, ShouldBeNil)
 				Convey("The state should still match the update result", func() {
 					bl, loaded = ms.loadAccountStableBalance(addr1)
@@ -793,7 +949,7 @@ func TestMetaState(t *testing.T) {
 				})
 			})
 			Convey("When state change is partial committed #1", func() {
-				err = db.Update(ms.partialCommitProcedure(txs[:2]))
+				err = db.Update(ms.partialCommitProcedure(txs[:2], nil))
 				So(err, ShouldBeNil)
 				Convey("The state should still match the update result", func() {
 					bl, loaded = ms.loadAccountStableBalance(addr1)
@@ -805,7 +961,7 @@ func TestMetaState(t *testing.T) {
 				})
 			})
 			Convey("When state change is partial committed #2", func() {
-				err = db.Update(ms.partialCommitProcedure(txs[:3]))
+				err = db.Update(ms.partialCommitProcedure(txs[:3], nil))
 				So(err, ShouldBeNil)
 				Convey("The state should still match the update result", func() {
 					bl, loaded = ms.loadAccountStableBalance(addr1)
@@ -817,7 +973,7 @@ func TestMetaState(t *testing.T) {
 				})
 			})
 			Convey("When state change is partial committed #3", func() {
-				err = db.Update(ms.partialCommitProcedure(txs[:6]))
+				err = db.Update(ms.partialCommitProcedure(txs[:6], nil))
 				So(err, ShouldBeNil)
 				Convey("The state should still match the update result", func() {
 					bl, loaded = ms.loadAccountStableBalance(addr1)
@@ -829,7 +985,7 @@ func TestMetaState(t *testing.T) {
 				})
 			})
 			Convey("When state change is partial committed #4", func() {
-				err = db.Update(ms.partialCommitProcedure(txs))
+				err = db.Update(ms.partialCommitProcedure(txs, nil))
 				So(err, ShouldBeNil)
 				Convey("The state should still match the update result", func() {
 					bl, loaded = ms.loadAccountStableBalance(addr1)
@@ -17,9 +17,9 @@
 package blockproducer
 
 import (
-	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
 	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
 	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/types"
 )
 
@@ -39,6 +39,30 @@ type AdviseNewBlockResp struct {
 	proto.Envelope
 }
 
+// ProposeBlockReq defines a request of the ProposeBlock RPC method.
+type ProposeBlockReq struct {
+	proto.Envelope
+	Block *pt.Block
+}
+
+// ProposeBlockResp defines a response of the ProposeBlock RPC method.
+type ProposeBlockResp struct {
+	proto.Envelope
+	Vote *pt.Vote
+}
+
+// PrecommitBlockReq defines a request of the PrecommitBlock RPC method.
+type PrecommitBlockReq struct {
+	proto.Envelope
+	Cert *pt.QuorumCert
+}
+
+// PrecommitBlockResp defines a response of the PrecommitBlock RPC method.
+type PrecommitBlockResp struct {
+	proto.Envelope
+	Vote *pt.Vote
+}
+
 // AdviseTxBillingReq defines a request of the AdviseTxBilling RPC method.
 type AdviseTxBillingReq struct {
 	proto.Envelope
@@ -80,30 +104,6 @@ type FetchTxBillingResp struct {
 	proto.Envelope
 }
 
-// NextAccountNonceReq defines a request of the NextAccountNonce RPC method.
-type NextAccountNonceReq struct {
-	proto.Envelope
-	Addr proto.AccountAddress
-}
-
-// NextAccountNonceResp defines a response of the NextAccountNonce RPC method.
-type NextAccountNonceResp struct {
-	proto.Envelope
-	Addr  proto.AccountAddress
-	Nonce pi.AccountNonce
-}
-
-// AddTxReq defines a request of the AddTx RPC method.
-type AddTxReq struct {
-	proto.Envelope
-	Tx pi.Transaction
-}
-
-// AddTxResp defines a response of the AddTx RPC method.
-type AddTxResp struct {
-	proto.Envelope
-}
-
 // QueryAccountStableBalanceReq defines a request of the QueryAccountStableBalance RPC method.
 type QueryAccountStableBalanceReq struct {
 	proto.Envelope
@@ -134,10 +134,33 @@ type QueryAccountCovenantBalanceResp struct {
 
 // AdviseNewBlock is the RPC method to advise a new block to target server.
 func (s *ChainRPCService) AdviseNewBlock(req *AdviseNewBlockReq, resp *AdviseNewBlockResp) error {
+	if !route.IsPermitted(&req.Envelope, route.MCCAdviseNewBlock) {
+		return ErrPermissionDenied
+	}
 	s.chain.blocksFromRPC <- req.Block
 	return nil
 }
 
+// ProposeBlock is the RPC method to propose a new block to target server and collect its
+// prevote.
+func (s *ChainRPCService) ProposeBlock(req *ProposeBlockReq, resp *ProposeBlockResp) (err error) {
+	if !route.IsPermitted(&req.Envelope, route.MCCProposeBlock) {
+		return ErrPermissionDenied
+	}
+	resp.Vote, err = s.chain.prevote(req.Block)
+	return
+}
+
+// PrecommitBlock is the RPC method to collect the precommit of target server on a block which
+// has collected the prevotes of a quorum.
+func (s *ChainRPCService) PrecommitBlock(req *PrecommitBlockReq, resp *PrecommitBlockResp) (err error) {
+	if !route.IsPermitted(&req.Envelope, route.MCCPrecommitBlock) {
+		return ErrPermissionDenied
+	}
+	resp.Vote, err = s.chain.precommit(req.Cert)
+	return
+}
+
 // AdviseBillingRequest is the RPC method to advise a new billing request to main chain.
 func (s *ChainRPCService) AdviseBillingRequest(req *types.AdviseBillingReq, resp *types.AdviseBillingResp) error {
 	response, err := s.chain.produceBilling(req.Req)
@@ -179,7 +202,7 @@ func (s *ChainRPCService) FetchTxBilling(req *FetchTxBillingReq, resp *FetchTxBi
 
 // NextAccountNonce is the RPC method to query the next nonce of an account.
 func (s *ChainRPCService) NextAccountNonce(
-	req *NextAccountNonceReq, resp *NextAccountNonceResp) (err error,
+	req *types.NextAccountNonceReq, resp *types.NextAccountNonceResp) (err error,
 ) {
 	if resp.Nonce, err = s.chain.ms.nextNonce(req.Addr); err != nil {
 		return
@@ -189,7 +212,7 @@ func (s *ChainRPCService) NextAccountNonce(
 }
 
 // AddTx is the RPC method to add a transaction.
-func (s *ChainRPCService) AddTx(req *AddTxReq, resp *AddTxResp) (err error) {
+func (s *ChainRPCService) AddTx(req *types.AddTxReq, resp *types.AddTxResp) (err error) {
 	if req.Tx == nil {
 		return ErrUnknownTransactionType
 	}
@@ -216,3 +239,14 @@ func (s *ChainRPCService) QueryAccountCovenantBalance(
 	resp.Balance, resp.OK = s.chain.ms.loadAccountCovenantBalance(req.Addr)
 	return
 }
+
+// QuerySQLChainProfile is the RPC method to query the SQLChain profile of a database.
+func (s *ChainRPCService) QuerySQLChainProfile(
+	req *types.QuerySQLChainProfileReq, resp *types.QuerySQLChainProfileResp) (err error,
+) {
+	var p *pt.SQLChainProfile
+	if p, resp.OK = s.chain.ms.loadSQLChainProfile(req.DBID); resp.OK {
+		resp.Profile = *p
+	}
+	return
+}
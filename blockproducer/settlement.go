@@ -0,0 +1,132 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+// DatabaseStatusEvent defines the event of a database billing status change settled by a
+// committed block, e.g. a database enters the grace period, or is frozen or dropped for low
+// deposit.
+type DatabaseStatusEvent struct {
+	DatabaseID proto.DatabaseID
+	Owner      proto.AccountAddress
+	// Block is the hash of the block which settles the change.
+	Block     hash.Hash
+	OldStatus pt.DatabaseStatus
+	Status    pt.DatabaseStatus
+	// Deposit is the remaining deposit after the settlement, it's zero for a dropped database
+	// since the remaining deposit is refunded to the owner.
+	Deposit        uint64
+	ArrearsPeriods uint32
+}
+
+// SubscribeDatabaseStatus subscribes the database status events of the chain. The handler is
+// called synchronously after each block is committed, so it should not block. The events are
+// not replayed on chain reorganization.
+func (c *Chain) SubscribeDatabaseStatus(handler func(*DatabaseStatusEvent)) {
+	c.statusMutex.Lock()
+	defer c.statusMutex.Unlock()
+	c.statusHandlers = append(c.statusHandlers, handler)
+}
+
+func (c *Chain) publishDatabaseStatus(e *DatabaseStatusEvent) {
+	c.statusMutex.RLock()
+	defer c.statusMutex.RUnlock()
+	for _, h := range c.statusHandlers {
+		h(e)
+	}
+}
+
+// loadSettledSQLChains returns the committed profiles of the SQLChains settled or topped up by
+// the transactions of block b.
+func (c *Chain) loadSettledSQLChains(b *pt.Block) (profiles map[proto.DatabaseID]*pt.SQLChainProfile) {
+	profiles = make(map[proto.DatabaseID]*pt.SQLChainProfile)
+	for _, v := range b.Transactions {
+		if w, ok := v.(*pi.TransactionWrapper); ok {
+			v = w.Unwrap()
+		}
+		var dbID proto.DatabaseID
+		switch t := v.(type) {
+		case *pt.Billing:
+			dbID = t.BillingRequest.Header.DatabaseID
+		case *pt.TopUpDatabase:
+			dbID = t.TargetSQLChain
+		default:
+			continue
+		}
+		if _, ok := profiles[dbID]; ok {
+			continue
+		}
+		if p, loaded := c.ms.loadCommittedSQLChainProfile(dbID); loaded {
+			profiles[dbID] = p
+		}
+	}
+	return
+}
+
+// publishSettlement publishes the status changes of the SQLChains settled by the committed block
+// b, the producer of b also undeploys the dropped databases.
+func (c *Chain) publishSettlement(b *pt.Block, settled map[proto.DatabaseID]*pt.SQLChainProfile) {
+	var dropped []*pt.SQLChainProfile
+	for k, v := range settled {
+		var e = &DatabaseStatusEvent{
+			DatabaseID: k,
+			Owner:      v.Owner,
+			Block:      *b.BlockHash(),
+			OldStatus:  v.Status,
+			Status:     pt.DatabaseDropped,
+		}
+		if p, loaded := c.ms.loadCommittedSQLChainProfile(k); loaded {
+			if p.Status == v.Status && p.ArrearsPeriods == v.ArrearsPeriods {
+				continue
+			}
+			e.Status = p.Status
+			e.Deposit = p.Deposit
+			e.ArrearsPeriods = p.ArrearsPeriods
+		} else {
+			dropped = append(dropped, v)
+		}
+		log.WithFields(log.Fields{
+			"db":         e.DatabaseID,
+			"old_status": e.OldStatus.String(),
+			"status":     e.Status.String(),
+			"deposit":    e.Deposit,
+			"arrears":    e.ArrearsPeriods,
+		}).Info("database status settled")
+		c.publishDatabaseStatus(e)
+	}
+
+	var provider = c.provider
+	if provider == nil || len(dropped) == 0 || b.Producer() != c.rt.accountAddress {
+		return
+	}
+	c.rt.wg.Add(1)
+	go func() {
+		defer c.rt.wg.Done()
+		for _, p := range dropped {
+			if err := provider.UndeployDatabase(p); err != nil {
+				log.WithField("db", p.ID).WithError(err).Error("undeploy database failed")
+			}
+		}
+	}()
+}
@@ -0,0 +1,282 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/coreos/bbolt"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSettlement(t *testing.T) {
+	Convey("Given a database created on chain with deposit", t, func() {
+		cleanupNode, _, _, _, err := initNode(
+			"../test/mainchain/node_standalone/config.yaml",
+			"../test/mainchain/node_standalone/private.key",
+		)
+		So(err, ShouldBeNil)
+		defer cleanupNode()
+
+		_, peers, err := createTestPeersWithPrivKeys(testPrivKey, 1)
+		So(err, ShouldBeNil)
+		minerAddr, err := crypto.PubKeyHash(testPrivKey.PubKey())
+		So(err, ShouldBeNil)
+		ownerPrivKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		owner, err := crypto.PubKeyHash(ownerPrivKey.PubKey())
+		So(err, ShouldBeNil)
+
+		var (
+			producer = proto.AccountAddress{0x0, 0x0, 0x0, 0x2}
+			provider = &stubDatabaseProvider{nodes: peers.Servers}
+			ms       = newMetaState()
+			c        = &Chain{ms: ms, rt: &rt{accountAddress: producer}, provider: provider}
+			fl       = path.Join(testDataDir, t.Name())
+			db       *bolt.DB
+			events   []*DatabaseStatusEvent
+
+			gracePeriods  = DatabaseGracePeriods
+			frozenPeriods = DatabaseFrozenPeriods
+		)
+		DatabaseGracePeriods, DatabaseFrozenPeriods = 2, 1
+		defer func() {
+			DatabaseGracePeriods, DatabaseFrozenPeriods = gracePeriods, frozenPeriods
+		}()
+		c.SubscribeDatabaseStatus(func(e *DatabaseStatusEvent) {
+			events = append(events, e)
+		})
+		db, err = bolt.Open(fl, 0600, nil)
+		So(err, ShouldBeNil)
+		defer func() {
+			db.Close()
+			os.Remove(fl)
+		}()
+		err = db.Update(func(tx *bolt.Tx) (err error) {
+			var meta *bolt.Bucket
+			if meta, err = tx.CreateBucket(metaBucket[:]); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucket(metaAccountIndexBucket); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucket(metaSQLChainIndexBucket); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucket(metaTransactionBucket); err != nil {
+				return
+			}
+			return resetMetaStateBuckets(tx)
+		})
+		So(err, ShouldBeNil)
+		for _, v := range []proto.AccountAddress{owner, producer} {
+			err = db.Update(ms.applyTransactionProcedure(pt.NewBaseAccount(&pt.Account{
+				Address:           v,
+				StableCoinBalance: 100,
+			})))
+			So(err, ShouldBeNil)
+		}
+		err = db.Update(ms.commitProcedure())
+		So(err, ShouldBeNil)
+
+		var (
+			nonceOf = func(addr proto.AccountAddress) (nonce pi.AccountNonce) {
+				nonce, err = ms.nextNonce(addr)
+				So(err, ShouldBeNil)
+				return
+			}
+			// commit adds the transactions and commits them in a block produced by local node
+			commit = func(txs ...pi.Transaction) (err error) {
+				for _, v := range txs {
+					var priv = testPrivKey
+					if v.GetAccountAddress() == owner {
+						priv = ownerPrivKey
+					}
+					if err = v.Sign(priv); err != nil {
+						return
+					}
+					if err = db.Update(ms.addTxProcedure(v)); err != nil {
+						return
+					}
+				}
+				var b = &pt.Block{
+					SignedHeader: pt.SignedHeader{Header: pt.Header{Producer: producer}},
+				}
+				b.Transactions, b.Allocations = ms.packTxs(
+					MaxBlockTxs, MaxBlockTxsSize, c.allocateDatabase)
+				var settled = c.loadSettledSQLChains(b)
+				if err = db.Update(ms.partialCommitProcedure(b.Transactions, b.Allocations)); err != nil {
+					return
+				}
+				c.publishSettlement(b, settled)
+				c.rt.wg.Wait()
+				return
+			}
+			bill = func(dbID proto.DatabaseID, fee uint64) pi.Transaction {
+				return pt.NewBilling(pt.NewBillingHeader(
+					nonceOf(producer),
+					&pt.BillingRequest{Header: pt.BillingRequestHeader{DatabaseID: dbID}},
+					producer, []*proto.AccountAddress{&minerAddr}, []uint64{fee}, []uint64{0},
+				))
+			}
+			topUp = func(dbID proto.DatabaseID, amount uint64) pi.Transaction {
+				return pt.NewTopUpDatabase(&pt.TopUpDatabaseHeader{
+					Payer:          owner,
+					TargetSQLChain: dbID,
+					Amount:         amount,
+					Nonce:          nonceOf(owner),
+				})
+			}
+			profileOf = func(dbID proto.DatabaseID) (p *pt.SQLChainProfile) {
+				var loaded bool
+				p, loaded = ms.loadSQLChainProfile(dbID)
+				So(loaded, ShouldBeTrue)
+				return
+			}
+			covenantBalanceOf = func(addr proto.AccountAddress) (b uint64) {
+				b, _ = ms.loadAccountCovenantBalance(addr)
+				return
+			}
+			stableBalanceOf = func(addr proto.AccountAddress) (b uint64) {
+				b, _ = ms.loadAccountStableBalance(addr)
+				return
+			}
+		)
+
+		cd := pt.NewCreateDatabase(&pt.CreateDatabaseHeader{
+			Owner:          owner,
+			ResourceMeta:   pt.ResourceMeta{Node: 1},
+			GasPrice:       1,
+			AdvancePayment: 30,
+			Nonce:          nonceOf(owner),
+		})
+		err = commit(cd)
+		So(err, ShouldBeNil)
+		dbID, err := cd.DatabaseID()
+		So(err, ShouldBeNil)
+		So(profileOf(dbID).Deposit, ShouldEqual, 30)
+		So(stableBalanceOf(owner), ShouldEqual, 70)
+
+		Convey("The billing should be settled against the deposit", func() {
+			err = commit(bill(dbID, 10))
+			So(err, ShouldBeNil)
+			So(profileOf(dbID).Deposit, ShouldEqual, 20)
+			So(profileOf(dbID).Status, ShouldEqual, pt.DatabaseNormal)
+			So(covenantBalanceOf(minerAddr), ShouldEqual, 10)
+			So(events, ShouldBeEmpty)
+
+			Convey("The database should enter the grace period with low deposit", func() {
+				err = commit(bill(dbID, 15))
+				So(err, ShouldBeNil)
+				p := profileOf(dbID)
+				So(p.Deposit, ShouldEqual, 5)
+				So(p.Status, ShouldEqual, pt.DatabaseInGracePeriod)
+				So(p.ArrearsPeriods, ShouldEqual, 1)
+				So(covenantBalanceOf(minerAddr), ShouldEqual, 25)
+				So(len(events), ShouldEqual, 1)
+				So(events[0].DatabaseID, ShouldEqual, dbID)
+				So(events[0].OldStatus, ShouldEqual, pt.DatabaseNormal)
+				So(events[0].Status, ShouldEqual, pt.DatabaseInGracePeriod)
+				So(events[0].Deposit, ShouldEqual, 5)
+
+				Convey("The fees should be paid as long as the deposit covers them", func() {
+					err = commit(bill(dbID, 10))
+					So(err, ShouldBeNil)
+					p := profileOf(dbID)
+					So(p.Deposit, ShouldEqual, 0)
+					So(p.Status, ShouldEqual, pt.DatabaseInGracePeriod)
+					So(p.ArrearsPeriods, ShouldEqual, 2)
+					So(covenantBalanceOf(minerAddr), ShouldEqual, 30)
+					So(len(events), ShouldEqual, 2)
+
+					Convey("The database should be frozen then dropped", func() {
+						err = commit(bill(dbID, 10))
+						So(err, ShouldBeNil)
+						So(profileOf(dbID).Status, ShouldEqual, pt.DatabaseFrozen)
+						So(len(events), ShouldEqual, 3)
+						So(events[2].OldStatus, ShouldEqual, pt.DatabaseInGracePeriod)
+						So(events[2].Status, ShouldEqual, pt.DatabaseFrozen)
+
+						err = commit(bill(dbID, 10))
+						So(err, ShouldBeNil)
+						_, loaded := ms.loadSQLChainProfile(dbID)
+						So(loaded, ShouldBeFalse)
+						So(len(events), ShouldEqual, 4)
+						So(events[3].OldStatus, ShouldEqual, pt.DatabaseFrozen)
+						So(events[3].Status, ShouldEqual, pt.DatabaseDropped)
+						So(len(provider.dropped), ShouldEqual, 1)
+						So(provider.dropped[0].ID, ShouldEqual, dbID)
+						So(provider.dropped[0].MinerNodes, ShouldResemble, peers.Servers)
+					})
+				})
+				Convey("The database should be restored by top-up at the next billing", func() {
+					err = commit(topUp(dbID, 50))
+					So(err, ShouldBeNil)
+					p := profileOf(dbID)
+					So(p.Deposit, ShouldEqual, 55)
+					So(p.Status, ShouldEqual, pt.DatabaseInGracePeriod)
+					So(stableBalanceOf(owner), ShouldEqual, 20)
+
+					err = commit(bill(dbID, 10))
+					So(err, ShouldBeNil)
+					p = profileOf(dbID)
+					So(p.Deposit, ShouldEqual, 45)
+					So(p.Status, ShouldEqual, pt.DatabaseNormal)
+					So(p.ArrearsPeriods, ShouldEqual, 0)
+					So(len(events), ShouldEqual, 2)
+					So(events[1].Status, ShouldEqual, pt.DatabaseNormal)
+				})
+			})
+		})
+		Convey("The remaining deposit should be refunded to the owner on drop", func() {
+			for _, v := range []uint64{20, 6, 3} {
+				err = commit(bill(dbID, v))
+				So(err, ShouldBeNil)
+			}
+			err = commit(topUp(dbID, 10))
+			So(err, ShouldBeNil)
+			So(profileOf(dbID).Status, ShouldEqual, pt.DatabaseFrozen)
+			So(profileOf(dbID).Deposit, ShouldEqual, 11)
+			err = commit(bill(dbID, 10))
+			So(err, ShouldBeNil)
+			So(covenantBalanceOf(minerAddr), ShouldEqual, 39)
+			_, loaded := ms.loadSQLChainProfile(dbID)
+			So(loaded, ShouldBeFalse)
+			So(stableBalanceOf(owner), ShouldEqual, 61)
+			So(events[len(events)-1].Status, ShouldEqual, pt.DatabaseDropped)
+			So(events[len(events)-1].Deposit, ShouldEqual, 0)
+		})
+		Convey("The top-up should fail for unknown database or insufficient balance", func() {
+			err = db.Update(ms.addTxProcedure(topUp("unknown", 10)))
+			So(err, ShouldNotBeNil)
+			tx := topUp(dbID, 1000)
+			err = tx.Sign(ownerPrivKey)
+			So(err, ShouldBeNil)
+			err = db.Update(ms.addTxProcedure(tx))
+			So(errors.Cause(err), ShouldEqual, ErrInsufficientBalance)
+			So(profileOf(dbID).Deposit, ShouldEqual, 30)
+		})
+	})
+}
@@ -17,6 +17,8 @@
 package blockproducer
 
 import (
+	"bytes"
+
 	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
@@ -46,6 +48,17 @@ func (e *accountTxEntries) addTx(tx pi.Transaction) {
 	e.transactions = append(e.transactions, tx)
 }
 
+// removeLastTx removes the last transaction of the account, it's the only one which can be
+// removed without breaking the nonce sequence.
+func (e *accountTxEntries) removeLastTx() (tx pi.Transaction) {
+	if len(e.transactions) == 0 {
+		return
+	}
+	tx = e.transactions[len(e.transactions)-1]
+	e.transactions = e.transactions[:len(e.transactions)-1]
+	return
+}
+
 func (e *accountTxEntries) halfDeepCopy() (cpy *accountTxEntries) {
 	return &accountTxEntries{
 		account:      e.account,
@@ -79,6 +92,28 @@ func (p *txPool) getTxEntries(addr proto.AccountAddress) (e *accountTxEntries, o
 	return
 }
 
+func (p *txPool) count() (n int) {
+	for _, v := range p.entries {
+		n += len(v.transactions)
+	}
+	return
+}
+
+// lowestFeeTail returns the account entries with the lowest fee last transaction, except the
+// entries of account addr. The one with the smallest account address is returned on tie.
+func (p *txPool) lowestFeeTail(addr proto.AccountAddress) (e *accountTxEntries, fee uint64, ok bool) {
+	for k, v := range p.entries {
+		if k == addr || len(v.transactions) == 0 {
+			continue
+		}
+		if f := v.transactions[len(v.transactions)-1].GetFee(); !ok || f < fee ||
+			(f == fee && bytes.Compare(k[:], e.account[:]) < 0) {
+			e, fee, ok = v, f, true
+		}
+	}
+	return
+}
+
 func (p *txPool) hasTx(tx pi.Transaction) (ok bool) {
 	var te *accountTxEntries
 	if te, ok = p.entries[tx.GetAccountAddress()]; !ok {
@@ -128,3 +163,51 @@ func (p *txPool) halfDeepCopy() (cpy *txPool) {
 	}
 	return
 }
+
+// txCursor iterates the pending transactions of an account in nonce order.
+type txCursor struct {
+	transactions []pi.Transaction
+	next         int
+}
+
+func (c *txCursor) tx() pi.Transaction {
+	return c.transactions[c.next]
+}
+
+// txCursorHeap implements heap.Interface, the cursor with the highest fee next transaction is
+// at the top, and the tie is broken by the transaction hash.
+type txCursorHeap []*txCursor
+
+func (h txCursorHeap) Len() int {
+	return len(h)
+}
+
+func (h txCursorHeap) Less(i, j int) bool {
+	var (
+		ti, tj = h[i].tx(), h[j].tx()
+		fi, fj = ti.GetFee(), tj.GetFee()
+	)
+	if fi != fj {
+		return fi > fj
+	}
+	hi, hj := ti.Hash(), tj.Hash()
+	return bytes.Compare(hi[:], hj[:]) < 0
+}
+
+func (h txCursorHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *txCursorHeap) Push(x interface{}) {
+	*h = append(*h, x.(*txCursor))
+}
+
+func (h *txCursorHeap) Pop() interface{} {
+	var (
+		old = *h
+		n   = len(old)
+		c   = old[n-1]
+	)
+	*h = old[:n-1]
+	return c
+}
@@ -15,3 +15,199 @@
  */
 
 package blockproducer
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/coreos/bbolt"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newTestTransfer(
+	sender, receiver proto.AccountAddress, nonce pi.AccountNonce, amount, fee uint64,
+) (t *pt.Transfer, err error) {
+	t = pt.NewTransfer(&pt.TransferHeader{
+		Sender:   sender,
+		Receiver: receiver,
+		Nonce:    nonce,
+		Amount:   amount,
+		Fee:      fee,
+	})
+	err = t.Sign(testPrivKey)
+	return
+}
+
+func TestTxPoolFees(t *testing.T) {
+	Convey("Given a metaState object with some accounts", t, func() {
+		var (
+			addr1   = proto.AccountAddress{0x0, 0x0, 0x0, 0x1}
+			addr2   = proto.AccountAddress{0x0, 0x0, 0x0, 0x2}
+			addr3   = proto.AccountAddress{0x0, 0x0, 0x0, 0x3}
+			ms      = newMetaState()
+			fl      = path.Join(testDataDir, t.Name())
+			db, err = bolt.Open(fl, 0600, nil)
+
+			maxPendingTxsPerAccount = MaxPendingTxsPerAccount
+			maxPendingTxs           = MaxPendingTxs
+		)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			MaxPendingTxsPerAccount = maxPendingTxsPerAccount
+			MaxPendingTxs = maxPendingTxs
+			err = db.Close()
+			So(err, ShouldBeNil)
+			err = os.Remove(fl)
+			So(err, ShouldBeNil)
+		})
+		err = db.Update(func(tx *bolt.Tx) (err error) {
+			var meta *bolt.Bucket
+			if meta, err = tx.CreateBucket(metaBucket[:]); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucket(metaAccountIndexBucket); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucket(metaSQLChainIndexBucket); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucket(metaTransactionBucket); err != nil {
+				return
+			}
+			return resetMetaStateBuckets(tx)
+		})
+		So(err, ShouldBeNil)
+		for _, v := range []proto.AccountAddress{addr1, addr2, addr3} {
+			err = db.Update(ms.applyTransactionProcedure(pt.NewBaseAccount(&pt.Account{
+				Address:           v,
+				StableCoinBalance: 100,
+			})))
+			So(err, ShouldBeNil)
+		}
+		err = db.Update(ms.commitProcedure())
+		So(err, ShouldBeNil)
+
+		var (
+			balanceOf = func(addr proto.AccountAddress) (b uint64) {
+				b, _ = ms.loadAccountStableBalance(addr)
+				return
+			}
+			addTransfer = func(
+				sender, receiver proto.AccountAddress, amount, fee uint64,
+			) (t *pt.Transfer, err error) {
+				var nonce pi.AccountNonce
+				if nonce, err = ms.nextNonce(sender); err != nil {
+					return
+				}
+				if t, err = newTestTransfer(sender, receiver, nonce, amount, fee); err != nil {
+					return
+				}
+				err = db.Update(ms.addTxProcedure(t))
+				return
+			}
+		)
+
+		Convey("The transaction fee should be charged from the sender", func() {
+			_, err = addTransfer(addr1, addr2, 10, 5)
+			So(err, ShouldBeNil)
+			So(balanceOf(addr1), ShouldEqual, 85)
+			So(balanceOf(addr2), ShouldEqual, 110)
+
+			// not enough balance for both amount and fee, the fee should be refunded
+			_, err = addTransfer(addr1, addr2, 85, 1)
+			So(err, ShouldEqual, ErrInsufficientBalance)
+			So(balanceOf(addr1), ShouldEqual, 85)
+			_, err = addTransfer(addr1, addr2, 1, 100)
+			So(err, ShouldEqual, ErrInsufficientBalance)
+			So(balanceOf(addr1), ShouldEqual, 85)
+		})
+		Convey("The pending transactions of an account should be limited", func() {
+			MaxPendingTxsPerAccount = 2
+			_, err = addTransfer(addr1, addr2, 1, 1)
+			So(err, ShouldBeNil)
+			_, err = addTransfer(addr1, addr2, 1, 1)
+			So(err, ShouldBeNil)
+			_, err = addTransfer(addr1, addr2, 1, 1)
+			So(err, ShouldEqual, ErrTooManyPendingTxs)
+			_, err = addTransfer(addr2, addr1, 1, 1)
+			So(err, ShouldBeNil)
+			So(ms.pool.count(), ShouldEqual, 3)
+		})
+		Convey("The transaction with the lowest fee should be evicted from the full pool", func() {
+			MaxPendingTxs = 2
+			var t1, t2, t3 *pt.Transfer
+			t1, err = addTransfer(addr1, addr3, 10, 1)
+			So(err, ShouldBeNil)
+			t2, err = addTransfer(addr2, addr3, 10, 2)
+			So(err, ShouldBeNil)
+			_, err = addTransfer(addr3, addr1, 10, 1)
+			So(err, ShouldEqual, ErrTxPoolFull)
+			t3, err = addTransfer(addr3, addr1, 10, 3)
+			So(err, ShouldBeNil)
+			So(ms.pool.count(), ShouldEqual, 2)
+			So(ms.pool.hasTx(t1), ShouldBeFalse)
+			So(ms.pool.hasTx(t2), ShouldBeTrue)
+			So(ms.pool.hasTx(t3), ShouldBeTrue)
+
+			// the state should be rebuilt without the evicted transaction
+			So(balanceOf(addr1), ShouldEqual, 110)
+			So(balanceOf(addr2), ShouldEqual, 88)
+			So(balanceOf(addr3), ShouldEqual, 97)
+			var nonce pi.AccountNonce
+			nonce, err = ms.nextNonce(addr1)
+			So(err, ShouldBeNil)
+			So(nonce, ShouldEqual, t1.Nonce)
+			err = db.View(func(tx *bolt.Tx) error {
+				var h = t1.Hash()
+				So(tx.Bucket(metaBucket[:]).Bucket(metaTransactionBucket).Bucket(
+					pi.TransactionTypeTransfer.Bytes()).Get(h[:]), ShouldBeNil)
+				return nil
+			})
+			So(err, ShouldBeNil)
+		})
+		Convey("The transactions should be packed by fee in nonce order of each account", func() {
+			var t1, t2, t3, t4 *pt.Transfer
+			t1, err = addTransfer(addr1, addr2, 1, 1)
+			So(err, ShouldBeNil)
+			t2, err = addTransfer(addr1, addr2, 1, 10)
+			So(err, ShouldBeNil)
+			t3, err = addTransfer(addr2, addr1, 1, 5)
+			So(err, ShouldBeNil)
+			t4, err = addTransfer(addr3, addr1, 1, 3)
+			So(err, ShouldBeNil)
+
+			var txs, _ = ms.packTxs(MaxBlockTxs, MaxBlockTxsSize, nil)
+			So(txs, ShouldResemble, []pi.Transaction{t3, t4, t1, t2})
+			txs, _ = ms.packTxs(2, MaxBlockTxsSize, nil)
+			So(txs, ShouldResemble, []pi.Transaction{t3, t4})
+			txs, _ = ms.packTxs(MaxBlockTxs, t3.Msgsize()+t4.Msgsize(), nil)
+			So(txs, ShouldResemble, []pi.Transaction{t3, t4})
+
+			err = db.Update(ms.partialCommitProcedure(txs, nil))
+			So(err, ShouldBeNil)
+			So(ms.pool.count(), ShouldEqual, 2)
+			So(ms.pool.hasTx(t1), ShouldBeTrue)
+			So(ms.pool.hasTx(t2), ShouldBeTrue)
+			So(balanceOf(addr1), ShouldEqual, 102-11-2)
+		})
+		Convey("The transaction depending on an unpacked one should not be packed", func() {
+			var t1, t2 *pt.Transfer
+			t1, err = addTransfer(addr3, addr2, 100, 0)
+			So(err, ShouldBeNil)
+			t2, err = addTransfer(addr2, addr1, 150, 10)
+			So(err, ShouldBeNil)
+
+			var txs, _ = ms.packTxs(MaxBlockTxs, MaxBlockTxsSize, nil)
+			So(txs, ShouldResemble, []pi.Transaction{t1})
+			err = db.Update(ms.partialCommitProcedure(txs, nil))
+			So(err, ShouldBeNil)
+			So(ms.pool.hasTx(t2), ShouldBeTrue)
+			txs, _ = ms.packTxs(MaxBlockTxs, MaxBlockTxsSize, nil)
+			So(txs, ShouldResemble, []pi.Transaction{t2})
+		})
+	})
+}
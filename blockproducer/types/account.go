@@ -18,6 +18,8 @@ package types
 
 import (
 	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 )
 
@@ -49,6 +51,39 @@ const (
 	NumberOfUserPermission
 )
 
+// DatabaseStatus defines the billing status of a SQLChain.
+type DatabaseStatus int32
+
+const (
+	// DatabaseNormal defines the status of a SQLChain with enough deposit.
+	DatabaseNormal DatabaseStatus = iota
+	// DatabaseInGracePeriod defines the status of a SQLChain with low deposit, it's still
+	// serviceable until the grace period expires.
+	DatabaseInGracePeriod
+	// DatabaseFrozen defines the status of a SQLChain frozen for writes after the grace period.
+	DatabaseFrozen
+	// DatabaseDropped defines the status of a SQLChain dropped for low deposit, it's only seen
+	// in chain events since the SQLChain is removed from the chain state.
+	DatabaseDropped
+	// NumberOfDatabaseStatus defines the database status number.
+	NumberOfDatabaseStatus
+)
+
+func (s DatabaseStatus) String() string {
+	switch s {
+	case DatabaseNormal:
+		return "Normal"
+	case DatabaseInGracePeriod:
+		return "InGracePeriod"
+	case DatabaseFrozen:
+		return "Frozen"
+	case DatabaseDropped:
+		return "Dropped"
+	default:
+		return "Unknown"
+	}
+}
+
 // SQLChainUser defines a SQLChain user.
 type SQLChainUser struct {
 	Address    proto.AccountAddress
@@ -57,11 +92,29 @@ type SQLChainUser struct {
 
 // SQLChainProfile defines a SQLChainProfile related to an account.
 type SQLChainProfile struct {
-	ID      proto.DatabaseID
-	Deposit uint64
-	Owner   proto.AccountAddress
-	Miners  []proto.AccountAddress
-	Users   []*SQLChainUser
+	ID       proto.DatabaseID
+	Deposit  uint64
+	GasPrice uint64
+	Owner    proto.AccountAddress
+	Miners   []proto.AccountAddress
+	// MinerNodes are the node ids of the miners, in the same order as Miners.
+	MinerNodes []proto.NodeID
+	Users      []*SQLChainUser
+	Meta       ResourceMeta
+	Status     DatabaseStatus
+	// ArrearsPeriods is the number of the consecutive billing periods settled with low deposit.
+	ArrearsPeriods uint32
+	// StorageProofReports are the storage proof failure reports of the miners in the current
+	// billing period.
+	StorageProofReports []*StorageProofReport
+}
+
+// StorageProofReport records the miners reporting the storage proof failures of a miner in a
+// billing period, and whether the miner has been slashed in the period.
+type StorageProofReport struct {
+	Miner     proto.AccountAddress
+	Reporters []proto.AccountAddress
+	Slashed   bool
 }
 
 // Account store its balance, and other mate data.
@@ -72,3 +125,18 @@ type Account struct {
 	Rating              float64
 	NextNonce           pi.AccountNonce
 }
+
+// VerifySignee checks that the transaction signer signee owns the account addr.
+func VerifySignee(signee *asymmetric.PublicKey, addr proto.AccountAddress) (err error) {
+	if signee == nil {
+		return ErrSigneeNotMatch
+	}
+	var signer proto.AccountAddress
+	if signer, err = crypto.PubKeyHash(signee); err != nil {
+		return
+	}
+	if signer != addr {
+		return ErrSigneeNotMatch
+	}
+	return
+}
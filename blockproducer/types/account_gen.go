@@ -38,29 +38,62 @@ func (z *Account) Msgsize() (s int) {
 	return
 }
 
+// MarshalHash marshals for hash
+func (z DatabaseStatus) MarshalHash() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	o = hsp.AppendInt32(o, int32(z))
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z DatabaseStatus) Msgsize() (s int) {
+	s = hsp.Int32Size
+	return
+}
+
 // MarshalHash marshals for hash
 func (z *SQLChainProfile) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 5
-	o = append(o, 0x85, 0x85)
+	// map header, size 11
+	o = append(o, 0x8b, 0x8b)
+	if oTemp, err := z.Meta.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x8b)
 	o = hsp.AppendArrayHeader(o, uint32(len(z.Users)))
-	for za0002 := range z.Users {
-		if z.Users[za0002] == nil {
+	for za0003 := range z.Users {
+		if z.Users[za0003] == nil {
 			o = hsp.AppendNil(o)
 		} else {
 			// map header, size 2
 			o = append(o, 0x82, 0x82)
-			if oTemp, err := z.Users[za0002].Address.MarshalHash(); err != nil {
+			if oTemp, err := z.Users[za0003].Address.MarshalHash(); err != nil {
 				return nil, err
 			} else {
 				o = hsp.AppendBytes(o, oTemp)
 			}
 			o = append(o, 0x82)
-			o = hsp.AppendInt32(o, int32(z.Users[za0002].Permission))
+			o = hsp.AppendInt32(o, int32(z.Users[za0003].Permission))
 		}
 	}
-	o = append(o, 0x85)
+	o = append(o, 0x8b)
+	o = hsp.AppendArrayHeader(o, uint32(len(z.StorageProofReports)))
+	for za0004 := range z.StorageProofReports {
+		if z.StorageProofReports[za0004] == nil {
+			o = hsp.AppendNil(o)
+		} else {
+			if oTemp, err := z.StorageProofReports[za0004].MarshalHash(); err != nil {
+				return nil, err
+			} else {
+				o = hsp.AppendBytes(o, oTemp)
+			}
+		}
+	}
+	o = append(o, 0x8b)
 	o = hsp.AppendArrayHeader(o, uint32(len(z.Miners)))
 	for za0001 := range z.Miners {
 		if oTemp, err := z.Miners[za0001].MarshalHash(); err != nil {
@@ -69,38 +102,65 @@ func (z *SQLChainProfile) MarshalHash() (o []byte, err error) {
 			o = hsp.AppendBytes(o, oTemp)
 		}
 	}
-	o = append(o, 0x85)
+	o = append(o, 0x8b)
+	o = hsp.AppendArrayHeader(o, uint32(len(z.MinerNodes)))
+	for za0002 := range z.MinerNodes {
+		if oTemp, err := z.MinerNodes[za0002].MarshalHash(); err != nil {
+			return nil, err
+		} else {
+			o = hsp.AppendBytes(o, oTemp)
+		}
+	}
+	o = append(o, 0x8b)
 	if oTemp, err := z.Owner.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x85)
+	o = append(o, 0x8b)
 	if oTemp, err := z.ID.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x85)
+	o = append(o, 0x8b)
 	o = hsp.AppendUint64(o, z.Deposit)
+	o = append(o, 0x8b)
+	o = hsp.AppendUint64(o, z.GasPrice)
+	o = append(o, 0x8b)
+	o = hsp.AppendInt32(o, int32(z.Status))
+	o = append(o, 0x8b)
+	o = hsp.AppendUint32(o, z.ArrearsPeriods)
 	return
 }
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *SQLChainProfile) Msgsize() (s int) {
-	s = 1 + 6 + hsp.ArrayHeaderSize
-	for za0002 := range z.Users {
-		if z.Users[za0002] == nil {
+	s = 1 + 5 + z.Meta.Msgsize() + 6 + hsp.ArrayHeaderSize
+	for za0003 := range z.Users {
+		if z.Users[za0003] == nil {
 			s += hsp.NilSize
 		} else {
-			s += 1 + 8 + z.Users[za0002].Address.Msgsize() + 11 + hsp.Int32Size
+			s += 1 + 8 + z.Users[za0003].Address.Msgsize() + 11 + hsp.Int32Size
+		}
+	}
+	s += 20 + hsp.ArrayHeaderSize
+	for za0004 := range z.StorageProofReports {
+		if z.StorageProofReports[za0004] == nil {
+			s += hsp.NilSize
+		} else {
+			s += z.StorageProofReports[za0004].Msgsize()
 		}
 	}
 	s += 7 + hsp.ArrayHeaderSize
 	for za0001 := range z.Miners {
 		s += z.Miners[za0001].Msgsize()
 	}
-	s += 6 + z.Owner.Msgsize() + 3 + z.ID.Msgsize() + 8 + hsp.Uint64Size
+	s += 11 + hsp.ArrayHeaderSize
+	for za0002 := range z.MinerNodes {
+		s += z.MinerNodes[za0002].Msgsize()
+	}
+	s += 6 + z.Owner.Msgsize() + 3 + z.ID.Msgsize() + 8 + hsp.Uint64Size + 9 + hsp.Uint64Size + 7 + hsp.Int32Size + 15 + hsp.Uint32Size
 	return
 }
 
@@ -140,6 +200,41 @@ func (z *SQLChainUser) Msgsize() (s int) {
 	return
 }
 
+// MarshalHash marshals for hash
+func (z *StorageProofReport) MarshalHash() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 3
+	o = append(o, 0x83, 0x83)
+	if oTemp, err := z.Miner.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x83)
+	o = hsp.AppendArrayHeader(o, uint32(len(z.Reporters)))
+	for za0001 := range z.Reporters {
+		if oTemp, err := z.Reporters[za0001].MarshalHash(); err != nil {
+			return nil, err
+		} else {
+			o = hsp.AppendBytes(o, oTemp)
+		}
+	}
+	o = append(o, 0x83)
+	o = hsp.AppendBool(o, z.Slashed)
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *StorageProofReport) Msgsize() (s int) {
+	s = 1 + 6 + z.Miner.Msgsize() + 10 + hsp.ArrayHeaderSize
+	for za0001 := range z.Reporters {
+		s += z.Reporters[za0001].Msgsize()
+	}
+	s += 8 + hsp.BoolSize
+	return
+}
+
 // MarshalHash marshals for hash
 func (z UserPermission) MarshalHash() (o []byte, err error) {
 	var b []byte
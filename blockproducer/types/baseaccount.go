@@ -50,6 +50,12 @@ func (b *BaseAccount) GetAccountNonce() pi.AccountNonce {
 	return pi.AccountNonce(0)
 }
 
+// GetFee implements interfaces/Transaction.GetFee, BaseAccount only exists in genesis block
+// and is free.
+func (b *BaseAccount) GetFee() uint64 {
+	return 0
+}
+
 // Hash implements interfaces/Transaction.Hash.
 func (b *BaseAccount) Hash() (h hash.Hash) {
 	return
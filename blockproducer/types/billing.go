@@ -88,6 +88,12 @@ func (tb *Billing) GetAccountNonce() pi.AccountNonce {
 	return tb.Nonce
 }
 
+// GetFee implements interfaces/Transaction.GetFee, billing is produced by block producers
+// without fee.
+func (tb *Billing) GetFee() uint64 {
+	return 0
+}
+
 // GetDatabaseID gets the database ID.
 func (tb *Billing) GetDatabaseID() *proto.DatabaseID {
 	return &tb.BillingRequest.Header.DatabaseID
@@ -54,21 +54,31 @@ func (s *SignedHeader) Verify() error {
 	return nil
 }
 
-// Block defines the main chain block.
+// Block defines the main chain block, the block is committed with the quorum certificate of
+// the precommits from the block producers.
 type Block struct {
 	SignedHeader SignedHeader
 	Transactions []pi.Transaction
+	// Allocations are the miners allocated by the proposer to the databases created by the
+	// transactions, in the same order as the CreateDatabase transactions.
+	Allocations []*DatabaseAllocation
+	Cert        *QuorumCert
 }
 
 // GetTxHashes returns all hashes of tx in block.{Billings, ...}
 func (b *Block) GetTxHashes() []*hash.Hash {
 	// TODO(lambda): when you add new tx type, you need to put new tx's hash in the slice
 	// get hashes in block.Transactions
-	hs := make([]*hash.Hash, len(b.Transactions))
+	hs := make([]*hash.Hash, 0, len(b.Transactions)+len(b.Allocations))
 
-	for i, v := range b.Transactions {
+	for _, v := range b.Transactions {
 		h := v.Hash()
-		hs[i] = &h
+		hs = append(hs, &h)
+	}
+	// the allocations are covered by the merkle root as well
+	for _, v := range b.Allocations {
+		h := v.Hash()
+		hs = append(hs, &h)
 	}
 	return hs
 }
@@ -10,14 +10,37 @@ import (
 func (z *Block) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 2
-	o = append(o, 0x82, 0x82)
+	// map header, size 4
+	o = append(o, 0x84, 0x84)
+	if z.Cert == nil {
+		o = hsp.AppendNil(o)
+	} else {
+		if oTemp, err := z.Cert.MarshalHash(); err != nil {
+			return nil, err
+		} else {
+			o = hsp.AppendBytes(o, oTemp)
+		}
+	}
+	o = append(o, 0x84)
 	if oTemp, err := z.SignedHeader.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x82)
+	o = append(o, 0x84)
+	o = hsp.AppendArrayHeader(o, uint32(len(z.Allocations)))
+	for za0002 := range z.Allocations {
+		if z.Allocations[za0002] == nil {
+			o = hsp.AppendNil(o)
+		} else {
+			if oTemp, err := z.Allocations[za0002].MarshalHash(); err != nil {
+				return nil, err
+			} else {
+				o = hsp.AppendBytes(o, oTemp)
+			}
+		}
+	}
+	o = append(o, 0x84)
 	o = hsp.AppendArrayHeader(o, uint32(len(z.Transactions)))
 	for za0001 := range z.Transactions {
 		if oTemp, err := z.Transactions[za0001].MarshalHash(); err != nil {
@@ -31,7 +54,21 @@ func (z *Block) MarshalHash() (o []byte, err error) {
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *Block) Msgsize() (s int) {
-	s = 1 + 13 + z.SignedHeader.Msgsize() + 13 + hsp.ArrayHeaderSize
+	s = 1 + 5
+	if z.Cert == nil {
+		s += hsp.NilSize
+	} else {
+		s += z.Cert.Msgsize()
+	}
+	s += 13 + z.SignedHeader.Msgsize() + 12 + hsp.ArrayHeaderSize
+	for za0002 := range z.Allocations {
+		if z.Allocations[za0002] == nil {
+			s += hsp.NilSize
+		} else {
+			s += z.Allocations[za0002].Msgsize()
+		}
+	}
+	s += 13 + hsp.ArrayHeaderSize
 	for za0001 := range z.Transactions {
 		s += z.Transactions[za0001].Msgsize()
 	}
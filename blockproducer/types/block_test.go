@@ -22,6 +22,8 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/utils"
 )
 
@@ -135,3 +137,32 @@ func TestBlock_PackAndSignBlock(t *testing.T) {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 }
+
+func TestBlock_VerifyAllocations(t *testing.T) {
+	block, err := generateRandomBlock(genesisHash, false)
+	if err != nil {
+		t.Fatalf("Failed to generate block: %v", err)
+	}
+
+	priv, _, err := asymmetric.GenSecp256k1KeyPair()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	block.Allocations = []*DatabaseAllocation{{
+		DatabaseID: proto.DatabaseID("db"),
+		Miners:     []*AllocatedMiner{{NodeID: proto.NodeID("node")}},
+	}}
+	if err = block.PackAndSignBlock(priv); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err = block.Verify(); err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+
+	// the allocations are covered by the merkle root
+	block.Allocations[0].Miners[0].NodeID = proto.NodeID("other")
+	err = block.Verify()
+	if err != ErrMerkleRootVerification {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
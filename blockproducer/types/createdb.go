@@ -19,18 +19,56 @@ package types
 import (
 	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	mine "github.com/CovenantSQL/CovenantSQL/pow/cpuminer"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 )
 
 //go:generate hsp
 
+// ResourceMeta defines the resource requirements of the database created on chain. It's the
+// same as the ResourceMeta of database service, except that the encryption key is not included
+// since the transaction is public.
+type ResourceMeta struct {
+	Node          uint16 // reserved node count
+	Space         uint64 // reserved storage space in bytes
+	Memory        uint64 // reserved memory in bytes
+	LoadAvgPerCPU uint64 // max loadAvg15 per CPU
+	StorageEngine string // storage engine of database instance
+}
+
 // CreateDatabaseHeader defines the database creation transaction header.
 type CreateDatabaseHeader struct {
+	Owner        proto.AccountAddress
+	ResourceMeta ResourceMeta
+	// GasPrice is the stable coin price per unit of gas paid by the database users.
+	GasPrice uint64
+	// AdvancePayment is the stable coin amount moved from the owner to the database deposit.
+	AdvancePayment uint64
+	Nonce          pi.AccountNonce
+	Version        int32
+	Fee            uint64
+}
+
+// CreateDatabaseHeaderV0 defines the version 0 layout of CreateDatabaseHeader, which is hashed
+// and signed without the fields other than Owner and Nonce.
+type CreateDatabaseHeaderV0 struct {
 	Owner proto.AccountAddress
 	Nonce pi.AccountNonce
 }
 
+// signedHeader returns the header hashed and signed in the layout of its version.
+func (h *CreateDatabaseHeader) signedHeader() verifier.MarshalHasher {
+	if h.Version == TxVersion0 {
+		return &CreateDatabaseHeaderV0{
+			Owner: h.Owner,
+			Nonce: h.Nonce,
+		}
+	}
+	return h
+}
+
 // GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
 func (h *CreateDatabaseHeader) GetAccountAddress() proto.AccountAddress {
 	return h.Owner
@@ -41,6 +79,22 @@ func (h *CreateDatabaseHeader) GetAccountNonce() pi.AccountNonce {
 	return h.Nonce
 }
 
+// GetFee implements interfaces/Transaction.GetFee.
+func (h *CreateDatabaseHeader) GetFee() uint64 {
+	return h.Fee
+}
+
+// DatabaseID returns the id of the database created by the transaction, it's derived from the
+// signed header hash so that it's deterministic for every block producer.
+func (h *CreateDatabaseHeader) DatabaseID() (id proto.DatabaseID, err error) {
+	var enc []byte
+	if enc, err = h.signedHeader().MarshalHash(); err != nil {
+		return
+	}
+	id = proto.DatabaseID(hash.THashH(enc).String())
+	return
+}
+
 // CreateDatabase defines the database creation transaction.
 type CreateDatabase struct {
 	CreateDatabaseHeader
@@ -48,22 +102,73 @@ type CreateDatabase struct {
 	verifier.DefaultHashSignVerifierImpl
 }
 
-// NewCreateDatabase returns new instance.
+// NewCreateDatabase returns new instance of the current transaction version.
 func NewCreateDatabase(header *CreateDatabaseHeader) *CreateDatabase {
-	return &CreateDatabase{
+	cd := &CreateDatabase{
 		CreateDatabaseHeader: *header,
 		TransactionTypeMixin: *pi.NewTransactionTypeMixin(pi.TransactionTypeCreateDatabase),
 	}
+	cd.Version = TxVersion
+	return cd
 }
 
 // Sign implements interfaces/Transaction.Sign.
 func (cd *CreateDatabase) Sign(signer *asymmetric.PrivateKey) (err error) {
-	return cd.DefaultHashSignVerifierImpl.Sign(&cd.CreateDatabaseHeader, signer)
+	return cd.DefaultHashSignVerifierImpl.Sign(cd.signedHeader(), signer)
+}
+
+// Verify implements interfaces/Transaction.Verify, the transaction should be signed by the
+// owner.
+func (cd *CreateDatabase) Verify() (err error) {
+	if err = verifyTxVersion(cd.Version, cd.Fee); err != nil {
+		return
+	}
+	if cd.Version == TxVersion0 &&
+		(cd.ResourceMeta != (ResourceMeta{}) || cd.GasPrice != 0 || cd.AdvancePayment != 0) {
+		return ErrUnsignedField
+	}
+	if err = cd.DefaultHashSignVerifierImpl.Verify(cd.signedHeader()); err != nil {
+		return
+	}
+	return VerifySignee(cd.Signee, cd.Owner)
 }
 
-// Verify implements interfaces/Transaction.Verify.
-func (cd *CreateDatabase) Verify() error {
-	return cd.DefaultHashSignVerifierImpl.Verify(&cd.CreateDatabaseHeader)
+// AllocatedMiner defines a miner node allocated to a database with its public key and the nonce
+// of its node id, so that the node id and the miner account are verified by the block contents
+// only.
+type AllocatedMiner struct {
+	NodeID    proto.NodeID
+	PublicKey *asymmetric.PublicKey
+	Nonce     mine.Uint256
+}
+
+// DatabaseAllocation defines the miners allocated by the block proposer to the database created
+// by a CreateDatabase transaction of the block.
+type DatabaseAllocation struct {
+	DatabaseID proto.DatabaseID
+	Miners     []*AllocatedMiner
+}
+
+// MinerNodes returns the node ids of the allocated miners.
+func (a *DatabaseAllocation) MinerNodes() (nodes []proto.NodeID) {
+	nodes = make([]proto.NodeID, len(a.Miners))
+	for i, v := range a.Miners {
+		if v != nil {
+			nodes[i] = v.NodeID
+		}
+	}
+	return
+}
+
+// Hash returns the hash of the allocation.
+func (a *DatabaseAllocation) Hash() (h hash.Hash) {
+	if a == nil {
+		return
+	}
+	if enc, err := a.MarshalHash(); err == nil {
+		h = hash.THashH(enc)
+	}
+	return
 }
 
 func init() {
@@ -7,19 +7,54 @@ import (
 )
 
 // MarshalHash marshals for hash
-func (z *CreateDatabase) MarshalHash() (o []byte, err error) {
+func (z *AllocatedMiner) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
 	// map header, size 3
-	// map header, size 2
-	o = append(o, 0x83, 0x83, 0x82, 0x82)
-	if oTemp, err := z.CreateDatabaseHeader.Owner.MarshalHash(); err != nil {
+	o = append(o, 0x83, 0x83)
+	if z.PublicKey == nil {
+		o = hsp.AppendNil(o)
+	} else {
+		if oTemp, err := z.PublicKey.MarshalHash(); err != nil {
+			return nil, err
+		} else {
+			o = hsp.AppendBytes(o, oTemp)
+		}
+	}
+	o = append(o, 0x83)
+	if oTemp, err := z.Nonce.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x82)
-	if oTemp, err := z.CreateDatabaseHeader.Nonce.MarshalHash(); err != nil {
+	o = append(o, 0x83)
+	if oTemp, err := z.NodeID.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *AllocatedMiner) Msgsize() (s int) {
+	s = 1 + 10
+	if z.PublicKey == nil {
+		s += hsp.NilSize
+	} else {
+		s += z.PublicKey.Msgsize()
+	}
+	s += 6 + z.Nonce.Msgsize() + 7 + z.NodeID.Msgsize()
+	return
+}
+
+// MarshalHash marshals for hash
+func (z *CreateDatabase) MarshalHash() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 3
+	o = append(o, 0x83, 0x83)
+	if oTemp, err := z.CreateDatabaseHeader.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
@@ -41,12 +76,52 @@ func (z *CreateDatabase) MarshalHash() (o []byte, err error) {
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *CreateDatabase) Msgsize() (s int) {
-	s = 1 + 21 + 1 + 6 + z.CreateDatabaseHeader.Owner.Msgsize() + 6 + z.CreateDatabaseHeader.Nonce.Msgsize() + 21 + z.TransactionTypeMixin.Msgsize() + 28 + z.DefaultHashSignVerifierImpl.Msgsize()
+	s = 1 + 21 + z.CreateDatabaseHeader.Msgsize() + 21 + z.TransactionTypeMixin.Msgsize() + 28 + z.DefaultHashSignVerifierImpl.Msgsize()
 	return
 }
 
 // MarshalHash marshals for hash
 func (z *CreateDatabaseHeader) MarshalHash() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 7
+	o = append(o, 0x87, 0x87)
+	if oTemp, err := z.ResourceMeta.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x87)
+	if oTemp, err := z.Nonce.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x87)
+	o = hsp.AppendInt32(o, z.Version)
+	o = append(o, 0x87)
+	if oTemp, err := z.Owner.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x87)
+	o = hsp.AppendUint64(o, z.GasPrice)
+	o = append(o, 0x87)
+	o = hsp.AppendUint64(o, z.AdvancePayment)
+	o = append(o, 0x87)
+	o = hsp.AppendUint64(o, z.Fee)
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *CreateDatabaseHeader) Msgsize() (s int) {
+	s = 1 + 13 + z.ResourceMeta.Msgsize() + 6 + z.Nonce.Msgsize() + 8 + hsp.Int32Size + 6 + z.Owner.Msgsize() + 9 + hsp.Uint64Size + 15 + hsp.Uint64Size + 4 + hsp.Uint64Size
+	return
+}
+
+// MarshalHash marshals for hash
+func (z *CreateDatabaseHeaderV0) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
 	// map header, size 2
@@ -66,7 +141,72 @@ func (z *CreateDatabaseHeader) MarshalHash() (o []byte, err error) {
 }
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
-func (z *CreateDatabaseHeader) Msgsize() (s int) {
+func (z *CreateDatabaseHeaderV0) Msgsize() (s int) {
 	s = 1 + 6 + z.Nonce.Msgsize() + 6 + z.Owner.Msgsize()
 	return
 }
+
+// MarshalHash marshals for hash
+func (z *DatabaseAllocation) MarshalHash() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 2
+	o = append(o, 0x82, 0x82)
+	o = hsp.AppendArrayHeader(o, uint32(len(z.Miners)))
+	for za0001 := range z.Miners {
+		if z.Miners[za0001] == nil {
+			o = hsp.AppendNil(o)
+		} else {
+			if oTemp, err := z.Miners[za0001].MarshalHash(); err != nil {
+				return nil, err
+			} else {
+				o = hsp.AppendBytes(o, oTemp)
+			}
+		}
+	}
+	o = append(o, 0x82)
+	if oTemp, err := z.DatabaseID.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *DatabaseAllocation) Msgsize() (s int) {
+	s = 1 + 7 + hsp.ArrayHeaderSize
+	for za0001 := range z.Miners {
+		if z.Miners[za0001] == nil {
+			s += hsp.NilSize
+		} else {
+			s += z.Miners[za0001].Msgsize()
+		}
+	}
+	s += 11 + z.DatabaseID.Msgsize()
+	return
+}
+
+// MarshalHash marshals for hash
+func (z *ResourceMeta) MarshalHash() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 5
+	o = append(o, 0x85, 0x85)
+	o = hsp.AppendString(o, z.StorageEngine)
+	o = append(o, 0x85)
+	o = hsp.AppendUint16(o, z.Node)
+	o = append(o, 0x85)
+	o = hsp.AppendUint64(o, z.Space)
+	o = append(o, 0x85)
+	o = hsp.AppendUint64(o, z.Memory)
+	o = append(o, 0x85)
+	o = hsp.AppendUint64(o, z.LoadAvgPerCPU)
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *ResourceMeta) Msgsize() (s int) {
+	s = 1 + 14 + hsp.StringPrefixSize + len(z.StorageEngine) + 5 + hsp.Uint16Size + 6 + hsp.Uint64Size + 7 + hsp.Uint64Size + 14 + hsp.Uint64Size
+	return
+}
@@ -19,17 +19,17 @@ package types
 import (
 	"testing"
 
+	"github.com/CovenantSQL/CovenantSQL/crypto"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
-	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
-	"github.com/CovenantSQL/CovenantSQL/proto"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
 func TestTxCreateDatabase(t *testing.T) {
 	Convey("test tx create database", t, func() {
-		h, err := hash.NewHashFromStr("000005aa62048f85da4ae9698ed59c14ec0d48a88a07c15a32265634e7e64ade")
+		priv, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		addr, err := crypto.PubKeyHash(priv.PubKey())
 		So(err, ShouldBeNil)
-		addr := proto.AccountAddress(*h)
 
 		cd := NewCreateDatabase(&CreateDatabaseHeader{
 			Owner: addr,
@@ -39,13 +39,30 @@ func TestTxCreateDatabase(t *testing.T) {
 		So(cd.GetAccountAddress(), ShouldEqual, addr)
 		So(cd.GetAccountNonce(), ShouldEqual, 1)
 
-		priv, _, err := asymmetric.GenSecp256k1KeyPair()
+		err = cd.Sign(priv)
 		So(err, ShouldBeNil)
 
-		err = cd.Sign(priv)
+		err = cd.Verify()
 		So(err, ShouldBeNil)
 
+		// the transaction should be signed by the owner
+		other, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		err = cd.Sign(other)
+		So(err, ShouldBeNil)
 		err = cd.Verify()
+		So(err, ShouldEqual, ErrSigneeNotMatch)
+
+		// the version 0 header only signs the owner and nonce
+		cd.Version = TxVersion0
+		So(cd.Sign(priv), ShouldBeNil)
+		So(cd.Verify(), ShouldBeNil)
+		id, err := cd.DatabaseID()
+		So(err, ShouldBeNil)
+		cd.AdvancePayment = 100
+		So(cd.Verify(), ShouldEqual, ErrUnsignedField)
+		nid, err := cd.DatabaseID()
 		So(err, ShouldBeNil)
+		So(nid, ShouldEqual, id)
 	})
 }
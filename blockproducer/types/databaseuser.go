@@ -0,0 +1,285 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+//go:generate hsp
+
+// AddDatabaseUserHeader defines the database user addition transaction header.
+type AddDatabaseUserHeader struct {
+	Advocate       proto.AccountAddress
+	TargetSQLChain proto.DatabaseID
+	TargetUser     proto.AccountAddress
+	Permission     UserPermission
+	Nonce          pi.AccountNonce
+	Version        int32
+	Fee            uint64
+}
+
+// AddDatabaseUserHeaderV0 defines the version 0 layout of AddDatabaseUserHeader,
+// which is hashed and signed without the Version and Fee fields.
+type AddDatabaseUserHeaderV0 struct {
+	Advocate       proto.AccountAddress
+	TargetSQLChain proto.DatabaseID
+	TargetUser     proto.AccountAddress
+	Permission     UserPermission
+	Nonce          pi.AccountNonce
+}
+
+// signedHeader returns the header hashed and signed in the layout of its version.
+func (h *AddDatabaseUserHeader) signedHeader() verifier.MarshalHasher {
+	if h.Version == TxVersion0 {
+		return &AddDatabaseUserHeaderV0{
+			Advocate:       h.Advocate,
+			TargetSQLChain: h.TargetSQLChain,
+			TargetUser:     h.TargetUser,
+			Permission:     h.Permission,
+			Nonce:          h.Nonce,
+		}
+	}
+	return h
+}
+
+// AddDatabaseUser defines the database user addition transaction, it grants the target user
+// the permission on the target database and should be signed by an admin of the database.
+type AddDatabaseUser struct {
+	AddDatabaseUserHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewAddDatabaseUser returns new instance of the current transaction version.
+func NewAddDatabaseUser(header *AddDatabaseUserHeader) *AddDatabaseUser {
+	t := &AddDatabaseUser{
+		AddDatabaseUserHeader: *header,
+		TransactionTypeMixin:  *pi.NewTransactionTypeMixin(pi.TransactionTypeAddDatabaseUser),
+	}
+	t.Version = TxVersion
+	return t
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (t *AddDatabaseUser) GetAccountAddress() proto.AccountAddress {
+	return t.Advocate
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (t *AddDatabaseUser) GetAccountNonce() pi.AccountNonce {
+	return t.Nonce
+}
+
+// GetFee implements interfaces/Transaction.GetFee.
+func (t *AddDatabaseUser) GetFee() uint64 {
+	return t.Fee
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (t *AddDatabaseUser) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return t.DefaultHashSignVerifierImpl.Sign(t.signedHeader(), signer)
+}
+
+// Verify implements interfaces/Transaction.Verify, the transaction should be signed by the
+// advocate.
+func (t *AddDatabaseUser) Verify() (err error) {
+	if err = verifyTxVersion(t.Version, t.Fee); err != nil {
+		return
+	}
+	if err = t.DefaultHashSignVerifierImpl.Verify(t.signedHeader()); err != nil {
+		return
+	}
+	return VerifySignee(t.Signee, t.Advocate)
+}
+
+// AlterDatabaseUserHeader defines the database user alteration transaction header.
+type AlterDatabaseUserHeader struct {
+	Advocate       proto.AccountAddress
+	TargetSQLChain proto.DatabaseID
+	TargetUser     proto.AccountAddress
+	Permission     UserPermission
+	Nonce          pi.AccountNonce
+	Version        int32
+	Fee            uint64
+}
+
+// AlterDatabaseUserHeaderV0 defines the version 0 layout of AlterDatabaseUserHeader,
+// which is hashed and signed without the Version and Fee fields.
+type AlterDatabaseUserHeaderV0 struct {
+	Advocate       proto.AccountAddress
+	TargetSQLChain proto.DatabaseID
+	TargetUser     proto.AccountAddress
+	Permission     UserPermission
+	Nonce          pi.AccountNonce
+}
+
+// signedHeader returns the header hashed and signed in the layout of its version.
+func (h *AlterDatabaseUserHeader) signedHeader() verifier.MarshalHasher {
+	if h.Version == TxVersion0 {
+		return &AlterDatabaseUserHeaderV0{
+			Advocate:       h.Advocate,
+			TargetSQLChain: h.TargetSQLChain,
+			TargetUser:     h.TargetUser,
+			Permission:     h.Permission,
+			Nonce:          h.Nonce,
+		}
+	}
+	return h
+}
+
+// AlterDatabaseUser defines the database user alteration transaction, it changes the permission
+// of an existing user of the target database and should be signed by an admin of the database.
+type AlterDatabaseUser struct {
+	AlterDatabaseUserHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewAlterDatabaseUser returns new instance of the current transaction version.
+func NewAlterDatabaseUser(header *AlterDatabaseUserHeader) *AlterDatabaseUser {
+	t := &AlterDatabaseUser{
+		AlterDatabaseUserHeader: *header,
+		TransactionTypeMixin:    *pi.NewTransactionTypeMixin(pi.TransactionTypeAlterDatabaseUser),
+	}
+	t.Version = TxVersion
+	return t
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (t *AlterDatabaseUser) GetAccountAddress() proto.AccountAddress {
+	return t.Advocate
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (t *AlterDatabaseUser) GetAccountNonce() pi.AccountNonce {
+	return t.Nonce
+}
+
+// GetFee implements interfaces/Transaction.GetFee.
+func (t *AlterDatabaseUser) GetFee() uint64 {
+	return t.Fee
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (t *AlterDatabaseUser) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return t.DefaultHashSignVerifierImpl.Sign(t.signedHeader(), signer)
+}
+
+// Verify implements interfaces/Transaction.Verify, the transaction should be signed by the
+// advocate.
+func (t *AlterDatabaseUser) Verify() (err error) {
+	if err = verifyTxVersion(t.Version, t.Fee); err != nil {
+		return
+	}
+	if err = t.DefaultHashSignVerifierImpl.Verify(t.signedHeader()); err != nil {
+		return
+	}
+	return VerifySignee(t.Signee, t.Advocate)
+}
+
+// DeleteDatabaseUserHeader defines the database user deletion transaction header.
+type DeleteDatabaseUserHeader struct {
+	Advocate       proto.AccountAddress
+	TargetSQLChain proto.DatabaseID
+	TargetUser     proto.AccountAddress
+	Nonce          pi.AccountNonce
+	Version        int32
+	Fee            uint64
+}
+
+// DeleteDatabaseUserHeaderV0 defines the version 0 layout of DeleteDatabaseUserHeader,
+// which is hashed and signed without the Version and Fee fields.
+type DeleteDatabaseUserHeaderV0 struct {
+	Advocate       proto.AccountAddress
+	TargetSQLChain proto.DatabaseID
+	TargetUser     proto.AccountAddress
+	Nonce          pi.AccountNonce
+}
+
+// signedHeader returns the header hashed and signed in the layout of its version.
+func (h *DeleteDatabaseUserHeader) signedHeader() verifier.MarshalHasher {
+	if h.Version == TxVersion0 {
+		return &DeleteDatabaseUserHeaderV0{
+			Advocate:       h.Advocate,
+			TargetSQLChain: h.TargetSQLChain,
+			TargetUser:     h.TargetUser,
+			Nonce:          h.Nonce,
+		}
+	}
+	return h
+}
+
+// DeleteDatabaseUser defines the database user deletion transaction, it revokes all the
+// permissions of the target user on the target database and should be signed by an admin of
+// the database.
+type DeleteDatabaseUser struct {
+	DeleteDatabaseUserHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewDeleteDatabaseUser returns new instance of the current transaction version.
+func NewDeleteDatabaseUser(header *DeleteDatabaseUserHeader) *DeleteDatabaseUser {
+	t := &DeleteDatabaseUser{
+		DeleteDatabaseUserHeader: *header,
+		TransactionTypeMixin:     *pi.NewTransactionTypeMixin(pi.TransactionTypeDeleteDatabaseUser),
+	}
+	t.Version = TxVersion
+	return t
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (t *DeleteDatabaseUser) GetAccountAddress() proto.AccountAddress {
+	return t.Advocate
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (t *DeleteDatabaseUser) GetAccountNonce() pi.AccountNonce {
+	return t.Nonce
+}
+
+// GetFee implements interfaces/Transaction.GetFee.
+func (t *DeleteDatabaseUser) GetFee() uint64 {
+	return t.Fee
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (t *DeleteDatabaseUser) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return t.DefaultHashSignVerifierImpl.Sign(t.signedHeader(), signer)
+}
+
+// Verify implements interfaces/Transaction.Verify, the transaction should be signed by the
+// advocate.
+func (t *DeleteDatabaseUser) Verify() (err error) {
+	if err = verifyTxVersion(t.Version, t.Fee); err != nil {
+		return
+	}
+	if err = t.DefaultHashSignVerifierImpl.Verify(t.signedHeader()); err != nil {
+		return
+	}
+	return VerifySignee(t.Signee, t.Advocate)
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeAddDatabaseUser, (*AddDatabaseUser)(nil))
+	pi.RegisterTransaction(pi.TransactionTypeAlterDatabaseUser, (*AlterDatabaseUser)(nil))
+	pi.RegisterTransaction(pi.TransactionTypeDeleteDatabaseUser, (*DeleteDatabaseUser)(nil))
+}
@@ -36,4 +36,23 @@ var (
 
 	// ErrBillingNotMatch indicates that the billing request doesn't match the local result.
 	ErrBillingNotMatch = errors.New("billing request doesn't match")
+
+	// ErrVoteMismatch indicates that a vote doesn't match the quorum certificate.
+	ErrVoteMismatch = errors.New("vote doesn't match quorum certificate")
+
+	// ErrUnknownVoter indicates that a vote is not from any block producer.
+	ErrUnknownVoter = errors.New("unknown voter")
+
+	// ErrNoQuorum indicates that the votes are not from a quorum of the block producers.
+	ErrNoQuorum = errors.New("no quorum")
+
+	// ErrSigneeNotMatch indicates that the transaction is not signed by the account it's sent from.
+	ErrSigneeNotMatch = errors.New("signee doesn't match account")
+
+	// ErrUnknownTxVersion indicates that the transaction header version is not supported.
+	ErrUnknownTxVersion = errors.New("unknown transaction version")
+
+	// ErrUnsignedField indicates that a transaction header field is set but not signed by the
+	// header version.
+	ErrUnsignedField = errors.New("transaction field is not signed by header version")
 )
@@ -0,0 +1,112 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+//go:generate hsp
+
+// StorageProofFailureHeader defines the storage proof failure report transaction header.
+type StorageProofFailureHeader struct {
+	Reporter       proto.AccountAddress
+	TargetSQLChain proto.DatabaseID
+	Miner          proto.AccountAddress
+	Nonce          pi.AccountNonce
+	Version        int32
+	Fee            uint64
+}
+
+// StorageProofFailureHeaderV0 defines the version 0 layout of StorageProofFailureHeader,
+// which is hashed and signed without the Version and Fee fields.
+type StorageProofFailureHeaderV0 struct {
+	Reporter       proto.AccountAddress
+	TargetSQLChain proto.DatabaseID
+	Miner          proto.AccountAddress
+	Nonce          pi.AccountNonce
+}
+
+// signedHeader returns the header hashed and signed in the layout of its version.
+func (h *StorageProofFailureHeader) signedHeader() verifier.MarshalHasher {
+	if h.Version == TxVersion0 {
+		return &StorageProofFailureHeaderV0{
+			Reporter:       h.Reporter,
+			TargetSQLChain: h.TargetSQLChain,
+			Miner:          h.Miner,
+			Nonce:          h.Nonce,
+		}
+	}
+	return h
+}
+
+// StorageProofFailure defines the storage proof failure report transaction, it's sent by the
+// challenger miner of the target database to report a miner failing the storage proof challenge.
+type StorageProofFailure struct {
+	StorageProofFailureHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewStorageProofFailure returns new instance of the current transaction version.
+func NewStorageProofFailure(header *StorageProofFailureHeader) *StorageProofFailure {
+	t := &StorageProofFailure{
+		StorageProofFailureHeader: *header,
+		TransactionTypeMixin:      *pi.NewTransactionTypeMixin(pi.TransactionTypeStorageProofFailure),
+	}
+	t.Version = TxVersion
+	return t
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (t *StorageProofFailure) GetAccountAddress() proto.AccountAddress {
+	return t.Reporter
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (t *StorageProofFailure) GetAccountNonce() pi.AccountNonce {
+	return t.Nonce
+}
+
+// GetFee implements interfaces/Transaction.GetFee.
+func (t *StorageProofFailure) GetFee() uint64 {
+	return t.Fee
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (t *StorageProofFailure) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return t.DefaultHashSignVerifierImpl.Sign(t.signedHeader(), signer)
+}
+
+// Verify implements interfaces/Transaction.Verify, the transaction should be signed by the
+// reporter.
+func (t *StorageProofFailure) Verify() (err error) {
+	if err = verifyTxVersion(t.Version, t.Fee); err != nil {
+		return
+	}
+	if err = t.DefaultHashSignVerifierImpl.Verify(t.signedHeader()); err != nil {
+		return
+	}
+	return VerifySignee(t.Signee, t.Reporter)
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeStorageProofFailure, (*StorageProofFailure)(nil))
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"testing"
+
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTxStorageProofFailure(t *testing.T) {
+	Convey("test tx storage proof failure", t, func() {
+		priv, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		addr, err := crypto.PubKeyHash(priv.PubKey())
+		So(err, ShouldBeNil)
+
+		tx := NewStorageProofFailure(&StorageProofFailureHeader{
+			Reporter:       addr,
+			TargetSQLChain: proto.DatabaseID("db"),
+			Miner:          proto.AccountAddress{0x1},
+			Nonce:          1,
+		})
+		So(tx.GetTransactionType(), ShouldEqual, pi.TransactionTypeStorageProofFailure)
+		So(tx.GetAccountAddress(), ShouldEqual, addr)
+		So(tx.GetAccountNonce(), ShouldEqual, 1)
+
+		err = tx.Sign(priv)
+		So(err, ShouldBeNil)
+		err = tx.Verify()
+		So(err, ShouldBeNil)
+
+		// the transaction should be signed by the reporter
+		other, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		err = tx.Sign(other)
+		So(err, ShouldBeNil)
+		err = tx.Verify()
+		So(err, ShouldEqual, ErrSigneeNotMatch)
+
+		ntx, err := pi.NewTransaction(pi.TransactionTypeStorageProofFailure)
+		So(err, ShouldBeNil)
+		So(ntx, ShouldHaveSameTypeAs, tx)
+	})
+}
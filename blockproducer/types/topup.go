@@ -0,0 +1,84 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+//go:generate hsp
+
+// TopUpDatabaseHeader defines the database deposit top-up transaction header.
+type TopUpDatabaseHeader struct {
+	Payer          proto.AccountAddress
+	TargetSQLChain proto.DatabaseID
+	Amount         uint64
+	Nonce          pi.AccountNonce
+	Fee            uint64
+}
+
+// TopUpDatabase defines the database deposit top-up transaction, it moves stable coin from the
+// payer to the deposit of the target database. Any account can top up a database.
+type TopUpDatabase struct {
+	TopUpDatabaseHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewTopUpDatabase returns new instance.
+func NewTopUpDatabase(header *TopUpDatabaseHeader) *TopUpDatabase {
+	return &TopUpDatabase{
+		TopUpDatabaseHeader:  *header,
+		TransactionTypeMixin: *pi.NewTransactionTypeMixin(pi.TransactionTypeTopUpDatabase),
+	}
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (t *TopUpDatabase) GetAccountAddress() proto.AccountAddress {
+	return t.Payer
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (t *TopUpDatabase) GetAccountNonce() pi.AccountNonce {
+	return t.Nonce
+}
+
+// GetFee implements interfaces/Transaction.GetFee.
+func (t *TopUpDatabase) GetFee() uint64 {
+	return t.Fee
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (t *TopUpDatabase) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return t.DefaultHashSignVerifierImpl.Sign(&t.TopUpDatabaseHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify, the transaction should be signed by the
+// payer.
+func (t *TopUpDatabase) Verify() (err error) {
+	if err = t.DefaultHashSignVerifierImpl.Verify(&t.TopUpDatabaseHeader); err != nil {
+		return
+	}
+	return VerifySignee(t.Signee, t.Payer)
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeTopUpDatabase, (*TopUpDatabase)(nil))
+}
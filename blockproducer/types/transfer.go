@@ -30,6 +30,29 @@ type TransferHeader struct {
 	Sender, Receiver proto.AccountAddress
 	Nonce            pi.AccountNonce
 	Amount           uint64
+	Version          int32
+	Fee              uint64
+}
+
+// TransferHeaderV0 defines the version 0 layout of TransferHeader,
+// which is hashed and signed without the Version and Fee fields.
+type TransferHeaderV0 struct {
+	Sender, Receiver proto.AccountAddress
+	Nonce            pi.AccountNonce
+	Amount           uint64
+}
+
+// signedHeader returns the header hashed and signed in the layout of its version.
+func (h *TransferHeader) signedHeader() verifier.MarshalHasher {
+	if h.Version == TxVersion0 {
+		return &TransferHeaderV0{
+			Sender:   h.Sender,
+			Receiver: h.Receiver,
+			Nonce:    h.Nonce,
+			Amount:   h.Amount,
+		}
+	}
+	return h
 }
 
 // Transfer defines the transfer transaction.
@@ -39,12 +62,14 @@ type Transfer struct {
 	verifier.DefaultHashSignVerifierImpl
 }
 
-// NewTransfer returns new instance.
+// NewTransfer returns new instance of the current transaction version.
 func NewTransfer(header *TransferHeader) *Transfer {
-	return &Transfer{
+	t := &Transfer{
 		TransferHeader:       *header,
 		TransactionTypeMixin: *pi.NewTransactionTypeMixin(pi.TransactionTypeTransfer),
 	}
+	t.Version = TxVersion
+	return t
 }
 
 // GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
@@ -57,14 +82,22 @@ func (t *Transfer) GetAccountNonce() pi.AccountNonce {
 	return t.Nonce
 }
 
+// GetFee implements interfaces/Transaction.GetFee.
+func (t *Transfer) GetFee() uint64 {
+	return t.Fee
+}
+
 // Sign implements interfaces/Transaction.Sign.
 func (t *Transfer) Sign(signer *asymmetric.PrivateKey) (err error) {
-	return t.DefaultHashSignVerifierImpl.Sign(&t.TransferHeader, signer)
+	return t.DefaultHashSignVerifierImpl.Sign(t.signedHeader(), signer)
 }
 
 // Verify implements interfaces/Transaction.Verify.
 func (t *Transfer) Verify() (err error) {
-	return t.DefaultHashSignVerifierImpl.Verify(&t.TransferHeader)
+	if err = verifyTxVersion(t.Version, t.Fee); err != nil {
+		return
+	}
+	return t.DefaultHashSignVerifierImpl.Verify(t.signedHeader())
 }
 
 func init() {
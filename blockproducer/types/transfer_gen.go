@@ -40,6 +40,44 @@ func (z *Transfer) Msgsize() (s int) {
 
 // MarshalHash marshals for hash
 func (z *TransferHeader) MarshalHash() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 6
+	o = append(o, 0x86, 0x86)
+	if oTemp, err := z.Nonce.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x86)
+	o = hsp.AppendInt32(o, z.Version)
+	o = append(o, 0x86)
+	if oTemp, err := z.Sender.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x86)
+	if oTemp, err := z.Receiver.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x86)
+	o = hsp.AppendUint64(o, z.Amount)
+	o = append(o, 0x86)
+	o = hsp.AppendUint64(o, z.Fee)
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *TransferHeader) Msgsize() (s int) {
+	s = 1 + 6 + z.Nonce.Msgsize() + 8 + hsp.Int32Size + 7 + z.Sender.Msgsize() + 9 + z.Receiver.Msgsize() + 7 + hsp.Uint64Size + 4 + hsp.Uint64Size
+	return
+}
+
+// MarshalHash marshals for hash
+func (z *TransferHeaderV0) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
 	// map header, size 4
@@ -67,7 +105,7 @@ func (z *TransferHeader) MarshalHash() (o []byte, err error) {
 }
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
-func (z *TransferHeader) Msgsize() (s int) {
+func (z *TransferHeaderV0) Msgsize() (s int) {
 	s = 1 + 6 + z.Nonce.Msgsize() + 7 + z.Sender.Msgsize() + 9 + z.Receiver.Msgsize() + 7 + hsp.Uint64Size
 	return
 }
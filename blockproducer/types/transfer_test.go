@@ -19,9 +19,12 @@ package types
 import (
 	"testing"
 
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
 	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/pkg/errors"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -42,5 +45,46 @@ func TestTxTransfer(t *testing.T) {
 		So(err, ShouldBeNil)
 		So(t.Sign(priv), ShouldBeNil)
 		So(t.Verify(), ShouldBeNil)
+		So(t.Version, ShouldEqual, TxVersion)
+
+		Convey("The fee should be signed by the current version", func() {
+			t.Fee = 10
+			So(errors.Cause(t.Verify()), ShouldEqual, verifier.ErrHashValueNotMatch)
+			So(t.Sign(priv), ShouldBeNil)
+			So(t.Verify(), ShouldBeNil)
+			t.Version = TxVersion + 1
+			So(t.Verify(), ShouldEqual, ErrUnknownTxVersion)
+		})
+		Convey("The transfer signed before the fee should be verified", func() {
+			v0 := &TransferHeaderV0{
+				Sender:   addr,
+				Receiver: addr,
+				Nonce:    1,
+				Amount:   100,
+			}
+			old := &Transfer{
+				TransferHeader: TransferHeader{
+					Sender:   addr,
+					Receiver: addr,
+					Nonce:    1,
+					Amount:   100,
+				},
+				TransactionTypeMixin: *pi.NewTransactionTypeMixin(pi.TransactionTypeTransfer),
+			}
+			So(old.DefaultHashSignVerifierImpl.Sign(v0, priv), ShouldBeNil)
+			So(old.Verify(), ShouldBeNil)
+			So(old.GetFee(), ShouldEqual, 0)
+
+			// the fee is not signed by the version 0 header
+			old.Fee = 10
+			So(old.Verify(), ShouldEqual, ErrUnsignedField)
+			old.Fee = 0
+
+			// the version 0 header should be signed in the same layout
+			h := old.Hash()
+			So(old.Sign(priv), ShouldBeNil)
+			So(old.Hash(), ShouldResemble, h)
+			So(old.Verify(), ShouldBeNil)
+		})
 	})
 }
@@ -0,0 +1,43 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+// The versions of the transaction headers. The headers of a version are hashed and signed in the
+// layout of the version, so that the transactions of the older versions are still verified after
+// the headers are extended.
+const (
+	// TxVersion0 is the version of the transactions created before the transaction fee, the
+	// headers are hashed without the Version and Fee fields.
+	TxVersion0 int32 = iota
+	// TxVersion1 adds the Version and Fee fields to the hashed headers.
+	TxVersion1
+)
+
+// TxVersion is the version of the new transactions.
+const TxVersion = TxVersion1
+
+// verifyTxVersion verifies the version of a transaction header with the fee, the fee is not signed
+// by the version 0 headers and must be zero.
+func verifyTxVersion(version int32, fee uint64) (err error) {
+	if version < TxVersion0 || version > TxVersion {
+		return ErrUnknownTxVersion
+	}
+	if version == TxVersion0 && fee != 0 {
+		return ErrUnsignedField
+	}
+	return
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/pkg/errors"
+)
+
+//go:generate hsp
+
+// VoteType defines the type of a block producer consensus vote.
+type VoteType int32
+
+const (
+	// VoteTypePrevote defines the vote of the first round, which accepts a valid proposal.
+	VoteTypePrevote VoteType = iota
+	// VoteTypePrecommit defines the vote of the second round, which commits a block which has
+	// collected the prevotes of a quorum.
+	VoteTypePrecommit
+)
+
+// String implements fmt.Stringer.
+func (t VoteType) String() string {
+	switch t {
+	case VoteTypePrevote:
+		return "Prevote"
+	case VoteTypePrecommit:
+		return "Precommit"
+	default:
+		return "Unknown"
+	}
+}
+
+// QuorumSize returns the minimum vote count of a quorum among n block producers, which is more
+// than 2/3 of n.
+func QuorumSize(n int) int {
+	return n*2/3 + 1
+}
+
+// VoteHeader defines the vote header of a block producer on a proposed block.
+type VoteHeader struct {
+	Type      VoteType
+	Height    uint32
+	BlockHash hash.Hash
+	Voter     proto.NodeID
+}
+
+// Vote defines a signed vote of a block producer on a proposed block.
+type Vote struct {
+	VoteHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewVote returns new instance.
+func NewVote(header *VoteHeader) *Vote {
+	return &Vote{
+		VoteHeader: *header,
+	}
+}
+
+// Sign signs the vote with the private key of the voter.
+func (v *Vote) Sign(signer *asymmetric.PrivateKey) error {
+	return v.DefaultHashSignVerifierImpl.Sign(&v.VoteHeader, signer)
+}
+
+// Verify verifies the hash and the signature of the vote, and checks that the vote is signed by
+// the voter.
+func (v *Vote) Verify() (err error) {
+	var pub *asymmetric.PublicKey
+	if pub, err = kms.GetPublicKey(v.Voter); err != nil {
+		return
+	}
+	if !pub.IsEqual(v.Signee) {
+		return ErrNodePublicKeyNotMatch
+	}
+	return v.DefaultHashSignVerifierImpl.Verify(&v.VoteHeader)
+}
+
+// QuorumCert defines a quorum certificate, which collects the votes of the same type on a block
+// from a quorum of the block producers.
+type QuorumCert struct {
+	Type      VoteType
+	Height    uint32
+	BlockHash hash.Hash
+	Votes     []*Vote
+}
+
+// NewQuorumCert returns a new quorum certificate with the votes matching the given type, height
+// and block hash.
+func NewQuorumCert(t VoteType, height uint32, bh hash.Hash, votes []*Vote) *QuorumCert {
+	var qc = &QuorumCert{
+		Type:      t,
+		Height:    height,
+		BlockHash: bh,
+	}
+	for _, v := range votes {
+		if v != nil && v.Type == t && v.Height == height && v.BlockHash.IsEqual(&bh) {
+			qc.Votes = append(qc.Votes, v)
+		}
+	}
+	return qc
+}
+
+// Verify checks that the certificate holds valid votes from a quorum of the block producers in
+// peers.
+func (c *QuorumCert) Verify(peers *proto.Peers) (err error) {
+	var (
+		servers = make(map[proto.NodeID]bool, len(peers.Servers))
+		voted   = make(map[proto.NodeID]bool, len(c.Votes))
+	)
+	for _, s := range peers.Servers {
+		servers[s] = true
+	}
+	for _, v := range c.Votes {
+		if v == nil {
+			continue
+		}
+		if v.Type != c.Type || v.Height != c.Height || !v.BlockHash.IsEqual(&c.BlockHash) {
+			return errors.Wrapf(ErrVoteMismatch, "vote from %s", v.Voter)
+		}
+		if !servers[v.Voter] {
+			return errors.Wrapf(ErrUnknownVoter, "vote from %s", v.Voter)
+		}
+		if voted[v.Voter] {
+			// count each block producer once
+			continue
+		}
+		if err = v.Verify(); err != nil {
+			return errors.Wrapf(err, "verify vote from %s failed", v.Voter)
+		}
+		voted[v.Voter] = true
+	}
+	if len(voted) < QuorumSize(len(peers.Servers)) {
+		return errors.Wrapf(ErrNoQuorum, "got %d of %d votes", len(voted), len(peers.Servers))
+	}
+	return
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/pow/cpuminer"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestQuorumCert(t *testing.T) {
+	Convey("Given 4 block producers", t, func() {
+		var (
+			peers = &proto.Peers{}
+			privs = make([]*asymmetric.PrivateKey, 4)
+			bh    = generateRandomHash()
+			votes []*Vote
+		)
+		for i := range privs {
+			priv, pub, err := asymmetric.GenSecp256k1KeyPair()
+			So(err, ShouldBeNil)
+			id := proto.NodeID(generateRandomHash().String())
+			err = kms.SetPublicKey(id, cpuminer.Uint256{}, pub)
+			So(err, ShouldBeNil)
+			privs[i] = priv
+			peers.Servers = append(peers.Servers, id)
+		}
+		So(QuorumSize(len(peers.Servers)), ShouldEqual, 3)
+		for i, s := range peers.Servers {
+			v := NewVote(&VoteHeader{
+				Type:      VoteTypePrecommit,
+				Height:    1,
+				BlockHash: bh,
+				Voter:     s,
+			})
+			So(v.Sign(privs[i]), ShouldBeNil)
+			So(v.Verify(), ShouldBeNil)
+			votes = append(votes, v)
+		}
+
+		Convey("The certificate of a quorum should be verified", func() {
+			qc := NewQuorumCert(VoteTypePrecommit, 1, bh, votes[:3])
+			So(qc.Verify(peers), ShouldBeNil)
+			// duplicate votes are counted once
+			qc = NewQuorumCert(VoteTypePrecommit, 1, bh, []*Vote{votes[0], votes[0], votes[1]})
+			So(errors.Cause(qc.Verify(peers)), ShouldEqual, ErrNoQuorum)
+			// votes of other types are filtered out
+			qc = NewQuorumCert(VoteTypePrevote, 1, bh, votes)
+			So(qc.Votes, ShouldBeEmpty)
+			So(errors.Cause(qc.Verify(peers)), ShouldEqual, ErrNoQuorum)
+		})
+		Convey("The vote signed by the others should not be verified", func() {
+			So(votes[1].Sign(privs[0]), ShouldBeNil)
+			So(votes[1].Verify(), ShouldEqual, ErrNodePublicKeyNotMatch)
+			qc := &QuorumCert{Type: VoteTypePrecommit, Height: 1, BlockHash: bh, Votes: votes}
+			So(qc.Verify(peers), ShouldNotBeNil)
+		})
+		Convey("The vote from unknown voter should not be verified", func() {
+			qc := NewQuorumCert(VoteTypePrecommit, 1, bh, votes)
+			qc.Votes[3].Voter = proto.NodeID(generateRandomHash().String())
+			So(errors.Cause(qc.Verify(peers)), ShouldEqual, ErrUnknownVoter)
+			qc.Votes[3].Height = 2
+			So(errors.Cause(qc.Verify(peers)), ShouldEqual, ErrVoteMismatch)
+		})
+	})
+}
@@ -33,6 +33,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/pow/cpuminer"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/coreos/bbolt"
 )
 
 var (
@@ -188,6 +189,31 @@ func generateRandomBlockWithTransactions(parent hash.Hash, tbs []pi.Transaction)
 	return
 }
 
+// generateBlockCert attaches the quorum certificate of the precommits from all the peers to the
+// block, the precommits are signed with the local private key which is shared by the test peers.
+func generateBlockCert(b *pt.Block, peers *proto.Peers, height uint32) (err error) {
+	var (
+		priv  *asymmetric.PrivateKey
+		votes = make([]*pt.Vote, len(peers.Servers))
+	)
+	if priv, err = kms.GetLocalPrivateKey(); err != nil {
+		return
+	}
+	for i, s := range peers.Servers {
+		votes[i] = pt.NewVote(&pt.VoteHeader{
+			Type:      pt.VoteTypePrecommit,
+			Height:    height,
+			BlockHash: *b.BlockHash(),
+			Voter:     s,
+		})
+		if err = votes[i].Sign(priv); err != nil {
+			return
+		}
+	}
+	b.Cert = pt.NewQuorumCert(pt.VoteTypePrecommit, height, *b.BlockHash(), votes)
+	return
+}
+
 func generateRandomBillingRequestHeader() *pt.BillingRequestHeader {
 	return &pt.BillingRequestHeader{
 		DatabaseID: *generateRandomDatabaseID(),
@@ -490,3 +516,25 @@ func TestMain(m *testing.M) {
 		return m.Run()
 	}())
 }
+
+// resetMetaStateBuckets clears the accounts, databases and transactions of the meta state.
+func resetMetaStateBuckets(tx *bolt.Tx) (err error) {
+	var meta = tx.Bucket(metaBucket[:])
+	for _, name := range [][]byte{
+		metaAccountIndexBucket, metaSQLChainIndexBucket, metaTransactionBucket,
+	} {
+		if err = meta.DeleteBucket(name); err != nil {
+			return
+		}
+		if _, err = meta.CreateBucket(name); err != nil {
+			return
+		}
+	}
+	txbk := meta.Bucket(metaTransactionBucket)
+	for i := pi.TransactionType(0); i < pi.TransactionTypeNumber; i++ {
+		if _, err = txbk.CreateBucket(i.Bytes()); err != nil {
+			return
+		}
+	}
+	return
+}
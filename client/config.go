@@ -18,21 +18,60 @@ package client
 
 import (
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ReadMode defines the peer selection policy of read queries.
+type ReadMode string
+
+const (
+	// ReadFromLeader sends all read queries to the leader peer.
+	ReadFromLeader ReadMode = "leader"
+	// ReadFromFollower balances read queries across the follower peers.
+	ReadFromFollower ReadMode = "follower"
+	// ReadFromNearest sends read queries to the peer with the lowest observed latency.
+	ReadFromNearest ReadMode = "nearest"
+
+	paramReadMode     = "read"
+	paramMaxStaleness = "staleness"
+	paramReadTimeout  = "read_timeout"
+	paramWriteTimeout = "write_timeout"
+	paramAckTimeout   = "ack_timeout"
+	paramPageSize     = "page_size"
 )
 
 // Config is a configuration parsed from a DSN string.
 type Config struct {
 	DatabaseID string
 
-	// additional configs should be filled
-	// such as read/write/exec timeout
-	// currently no timeout is supported.
+	// ReadMode defines which peer serves the read queries, leader by default.
+	ReadMode ReadMode
+	// MaxStaleness defines the max log offset lag allowed for a read response served by a
+	// non-leader peer, compared with the latest log offset seen by the connection.
+	// Zero means no bound.
+	MaxStaleness uint64
+
+	// ReadTimeout, WriteTimeout and AckTimeout bound the rpc call of read query, write query and
+	// query acknowledgement respectively, the deadline is also honored by the serving peer.
+	// Zero means no timeout other than the context deadline of the query.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	AckTimeout   time.Duration
+
+	// PageSize defines the max rows of a read query result page, the remaining rows are fetched
+	// page by page through a cursor on demand. Zero means the whole result is returned at once.
+	PageSize uint64
 }
 
 // NewConfig creates a new config with default value.
 func NewConfig() *Config {
-	return &Config{}
+	return &Config{
+		ReadMode: ReadFromLeader,
+	}
 }
 
 // FormatDSN formats the given Config into a DSN string which can be passed to the driver.
@@ -45,6 +84,24 @@ func (cfg *Config) FormatDSN() string {
 	}
 
 	newQuery := u.Query()
+	if cfg.ReadMode != "" && cfg.ReadMode != ReadFromLeader {
+		newQuery.Set(paramReadMode, string(cfg.ReadMode))
+	}
+	if cfg.MaxStaleness > 0 {
+		newQuery.Set(paramMaxStaleness, strconv.FormatUint(cfg.MaxStaleness, 10))
+	}
+	if cfg.ReadTimeout > 0 {
+		newQuery.Set(paramReadTimeout, cfg.ReadTimeout.String())
+	}
+	if cfg.WriteTimeout > 0 {
+		newQuery.Set(paramWriteTimeout, cfg.WriteTimeout.String())
+	}
+	if cfg.AckTimeout > 0 {
+		newQuery.Set(paramAckTimeout, cfg.AckTimeout.String())
+	}
+	if cfg.PageSize > 0 {
+		newQuery.Set(paramPageSize, strconv.FormatUint(cfg.PageSize, 10))
+	}
 	u.RawQuery = newQuery.Encode()
 
 	return u.String()
@@ -64,5 +121,40 @@ func ParseDSN(dsn string) (cfg *Config, err error) {
 	cfg = NewConfig()
 	cfg.DatabaseID = u.Host
 
+	q := u.Query()
+	if v := q.Get(paramReadMode); v != "" {
+		switch mode := ReadMode(strings.ToLower(v)); mode {
+		case ReadFromLeader, ReadFromFollower, ReadFromNearest:
+			cfg.ReadMode = mode
+		default:
+			err = errors.Wrapf(ErrInvalidDSNParam, "unknown read mode: %s", v)
+			return
+		}
+	}
+	if v := q.Get(paramMaxStaleness); v != "" {
+		if cfg.MaxStaleness, err = strconv.ParseUint(v, 10, 64); err != nil {
+			err = errors.Wrapf(ErrInvalidDSNParam, "invalid staleness: %s", v)
+			return
+		}
+	}
+	if v := q.Get(paramPageSize); v != "" {
+		if cfg.PageSize, err = strconv.ParseUint(v, 10, 64); err != nil {
+			err = errors.Wrapf(ErrInvalidDSNParam, "invalid page size: %s", v)
+			return
+		}
+	}
+	for param, timeout := range map[string]*time.Duration{
+		paramReadTimeout:  &cfg.ReadTimeout,
+		paramWriteTimeout: &cfg.WriteTimeout,
+		paramAckTimeout:   &cfg.AckTimeout,
+	} {
+		if v := q.Get(param); v != "" {
+			if *timeout, err = time.ParseDuration(v); err != nil || *timeout < 0 {
+				err = errors.Wrapf(ErrInvalidDSNParam, "invalid %s: %s", param, v)
+				return
+			}
+		}
+	}
+
 	return
 }
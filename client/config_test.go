@@ -18,6 +18,7 @@ package client
 
 import (
 	"testing"
+	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	. "github.com/smartystreets/goconvey/convey"
@@ -43,4 +44,44 @@ func TestConfig(t *testing.T) {
 		So(err, ShouldBeNil)
 		So(cfg.DatabaseID, ShouldEqual, dbIDStr)
 	})
+	Convey("test dsn with read mode", t, func() {
+		cfg, err := ParseDSN("covenantsql://db?read=follower&staleness=10")
+		So(err, ShouldBeNil)
+		So(cfg.ReadMode, ShouldEqual, ReadFromFollower)
+		So(cfg.MaxStaleness, ShouldEqual, 10)
+		So(cfg.FormatDSN(), ShouldEqual, "covenantsql://db?read=follower&staleness=10")
+
+		cfg, err = ParseDSN("covenantsql://db?read=Nearest")
+		So(err, ShouldBeNil)
+		So(cfg.ReadMode, ShouldEqual, ReadFromNearest)
+		So(cfg.MaxStaleness, ShouldEqual, 0)
+
+		cfg, err = ParseDSN("covenantsql://db?read=leader")
+		So(err, ShouldBeNil)
+		So(cfg.FormatDSN(), ShouldEqual, "covenantsql://db")
+
+		_, err = ParseDSN("covenantsql://db?read=unknown")
+		So(err, ShouldNotBeNil)
+		_, err = ParseDSN("covenantsql://db?staleness=-1")
+		So(err, ShouldNotBeNil)
+	})
+	Convey("test dsn with timeouts", t, func() {
+		cfg, err := ParseDSN("covenantsql://db?read_timeout=1s&write_timeout=5s&ack_timeout=500ms")
+		So(err, ShouldBeNil)
+		So(cfg.ReadTimeout, ShouldEqual, time.Second)
+		So(cfg.WriteTimeout, ShouldEqual, 5*time.Second)
+		So(cfg.AckTimeout, ShouldEqual, 500*time.Millisecond)
+		So(cfg.FormatDSN(), ShouldEqual,
+			"covenantsql://db?ack_timeout=500ms&read_timeout=1s&write_timeout=5s")
+
+		cfg, err = ParseDSN("covenantsql://db?page_size=1000")
+		So(err, ShouldBeNil)
+		So(cfg.PageSize, ShouldEqual, 1000)
+		So(cfg.FormatDSN(), ShouldEqual, "covenantsql://db?page_size=1000")
+
+		_, err = ParseDSN("covenantsql://db?read_timeout=1")
+		So(err, ShouldNotBeNil)
+		_, err = ParseDSN("covenantsql://db?write_timeout=-1s")
+		So(err, ShouldNotBeNil)
+	})
 }
@@ -20,6 +20,7 @@ import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	netrpc "net/rpc"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -31,6 +32,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/rpc"
 	"github.com/CovenantSQL/CovenantSQL/types"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
 )
 
 // conn implements an interface sql.Conn.
@@ -41,13 +43,33 @@ type conn struct {
 	localNodeID proto.NodeID
 	privKey     *asymmetric.PrivateKey
 
+	readMode     ReadMode
+	maxStaleness uint64
+	lastOffset   uint64 // latest log offset seen by this connection
+	readSeq      uint32 // round robin counter of follower reads
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	ackTimeout   time.Duration
+	pageSize     uint64
+
 	ackCh         chan *types.Ack
 	inTransaction bool
+	txID          uint64 // id of the interactive transaction
+	txBegun       bool   // whether the interactive transaction is opened remotely
 	closed        int32
 	pCaller       *rpc.PersistentCaller
+	callers       sync.Map // map[proto.NodeID]*peerCaller
+}
+
+// peerCaller wraps the rpc caller of a single peer with its observed latency.
+type peerCaller struct {
+	*rpc.PersistentCaller
+	latency int64 // moving average of call latency in nanoseconds
 }
 
-func newConn(cfg *Config) (c *conn, err error) {
+// newConn returns a new connection signing the requests with privKey, or the local private key if
+// privKey is nil.
+func newConn(cfg *Config, privKey *asymmetric.PrivateKey) (c *conn, err error) {
 	// get local node id
 	var localNodeID proto.NodeID
 	if localNodeID, err = kms.GetLocalNodeID(); err != nil {
@@ -55,16 +77,23 @@ func newConn(cfg *Config) (c *conn, err error) {
 	}
 
 	// get local private key
-	var privKey *asymmetric.PrivateKey
-	if privKey, err = kms.GetLocalPrivateKey(); err != nil {
-		return
+	if privKey == nil {
+		if privKey, err = kms.GetLocalPrivateKey(); err != nil {
+			return
+		}
 	}
 
 	c = &conn{
-		dbID:        proto.DatabaseID(cfg.DatabaseID),
-		localNodeID: localNodeID,
-		privKey:     privKey,
-		queries:     make([]types.Query, 0),
+		dbID:         proto.DatabaseID(cfg.DatabaseID),
+		localNodeID:  localNodeID,
+		privKey:      privKey,
+		queries:      make([]types.Query, 0),
+		readMode:     cfg.ReadMode,
+		maxStaleness: cfg.MaxStaleness,
+		readTimeout:  cfg.ReadTimeout,
+		writeTimeout: cfg.WriteTimeout,
+		ackTimeout:   cfg.AckTimeout,
+		pageSize:     cfg.PageSize,
 	}
 
 	var peers *proto.Peers
@@ -75,6 +104,7 @@ func newConn(cfg *Config) (c *conn, err error) {
 		return
 	}
 	c.pCaller = rpc.NewPersistentCaller(peers.Leader)
+	c.callers.Store(peers.Leader, &peerCaller{PersistentCaller: c.pCaller})
 
 	err = c.startAckWorkers(2)
 	if err != nil {
@@ -100,45 +130,49 @@ func (c *conn) stopAckWorkers() {
 }
 
 func (c *conn) ackWorker() {
-	if rawPeers, ok := peerList.Load(c.dbID); ok {
-		if peers, ok := rawPeers.(*proto.Peers); ok {
-			var (
-				oneTime sync.Once
-				pc      *rpc.PersistentCaller
-				err     error
-			)
-
-		ackWorkerLoop:
-			for {
-				ack, got := <-c.ackCh
-				if !got { //closed and empty
-					break ackWorkerLoop
-				}
-				oneTime.Do(func() {
-					pc = rpc.NewPersistentCaller(peers.Leader)
-				})
-				if err = ack.Sign(c.privKey, false); err != nil {
-					log.WithField("target", pc.TargetID).WithError(err).Error("failed to sign ack")
-					continue
-				}
-
-				var ackRes types.AckResponse
-				// send ack back
-				if err = pc.Call(route.DBSAck.String(), ack, &ackRes); err != nil {
-					log.WithError(err).Warning("send ack failed")
-					continue
-				}
-			}
-			if pc != nil {
-				pc.CloseStream()
-			}
-			log.Debug("ack worker quiting")
-			return
+	var (
+		callers = make(map[proto.NodeID]*rpc.PersistentCaller)
+		pc      *rpc.PersistentCaller
+		ok      bool
+		err     error
+	)
+
+	for ack := range c.ackCh {
+		// ack should be sent to the peer which served the query
+		target := ack.Header.Response.NodeID
+		if pc, ok = callers[target]; !ok {
+			pc = rpc.NewPersistentCaller(target)
+			callers[target] = pc
+		}
+		if err = ack.Sign(c.privKey, false); err != nil {
+			log.WithField("target", pc.TargetID).WithError(err).Error("failed to sign ack")
+			continue
+		}
+
+		// send ack back
+		if err = c.sendAck(pc, ack); err != nil {
+			log.WithError(err).Warning("send ack failed")
+			continue
 		}
 	}
 
-	log.Fatal("must GetPeers first")
-	return
+	for _, pc = range callers {
+		pc.CloseStream()
+	}
+	log.Debug("ack worker quiting")
+}
+
+func (c *conn) sendAck(pc *rpc.PersistentCaller, ack *types.Ack) (err error) {
+	var (
+		ctx    = context.Background()
+		cancel context.CancelFunc
+		ackRes types.AckResponse
+	)
+	if c.ackTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.ackTimeout)
+		defer cancel()
+	}
+	return pc.CallWithContext(ctx, route.DBSAck.String(), ack, &ackRes)
 }
 
 // Prepare implements the driver.Conn.Prepare method.
@@ -153,7 +187,10 @@ func (c *conn) Close() error {
 		log.WithField("db", c.dbID).Debug("closed connection")
 	}
 	c.stopAckWorkers()
-	c.pCaller.CloseStream()
+	c.callers.Range(func(_, rawCaller interface{}) bool {
+		rawCaller.(*peerCaller).CloseStream()
+		return true
+	})
 	return nil
 }
 
@@ -175,8 +212,11 @@ func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, e
 		return nil, sql.ErrTxDone
 	}
 
-	// TODO(xq262144): make use of the ctx argument
+	// the remote transaction session is opened lazily with the first query,
+	// cancellation of ctx is handled by database/sql which rolls back the transaction
 	c.inTransaction = true
+	c.txID = allocateTxID()
+	c.txBegun = false
 	c.queries = c.queries[:0]
 
 	return c, nil
@@ -201,11 +241,10 @@ func (c *conn) ExecContext(ctx context.Context, query string, args []driver.Name
 		return
 	}
 
-	// TODO(xq262144): make use of the ctx argument
 	sq := convertQuery(query, args)
 
 	var affectedRows, lastInsertID int64
-	if affectedRows, lastInsertID, _, err = c.addQuery(types.WriteQuery, sq); err != nil {
+	if affectedRows, lastInsertID, _, err = c.addQuery(ctx, types.WriteQuery, sq); err != nil {
 		return
 	}
 
@@ -224,9 +263,8 @@ func (c *conn) QueryContext(ctx context.Context, query string, args []driver.Nam
 		return
 	}
 
-	// TODO(xq262144): make use of the ctx argument
 	sq := convertQuery(query, args)
-	_, _, rows, err = c.addQuery(types.ReadQuery, sq)
+	_, _, rows, err = c.addQuery(ctx, types.ReadQuery, sq)
 
 	return
 }
@@ -241,23 +279,27 @@ func (c *conn) Commit() (err error) {
 		return sql.ErrTxDone
 	}
 
-	defer func() {
-		c.queries = c.queries[:0]
-		c.inTransaction = false
-	}()
+	defer c.resetTx()
 
-	if len(c.queries) > 0 {
-		// send query
-		if _, _, _, err = c.sendQuery(types.WriteQuery, c.queries); err != nil {
-			return
-		}
+	if !c.txBegun {
+		// nothing executed in transaction
+		return
+	}
+
+	if len(c.queries) == 0 {
+		// read only transaction, just release the remote session
+		_, _, _, err = c.sendQuery(context.Background(), types.WriteQuery, types.TxRollback, nil)
+		return
 	}
 
+	// commit with all the executed writes, which are replicated as a normal write request
+	_, _, _, err = c.sendQuery(context.Background(), types.WriteQuery, types.TxCommit, c.queries)
+
 	return
 }
 
 // Rollback implements the driver.Tx.Rollback method.
-func (c *conn) Rollback() error {
+func (c *conn) Rollback() (err error) {
 	if atomic.LoadInt32(&c.closed) != 0 {
 		return driver.ErrBadConn
 	}
@@ -266,34 +308,45 @@ func (c *conn) Rollback() error {
 		return sql.ErrTxDone
 	}
 
-	defer func() {
-		c.queries = c.queries[:0]
-		c.inTransaction = false
-	}()
+	defer c.resetTx()
 
-	if len(c.queries) == 0 {
-		return sql.ErrTxDone
+	if c.txBegun {
+		_, _, _, err = c.sendQuery(context.Background(), types.WriteQuery, types.TxRollback, nil)
 	}
 
-	return nil
+	return
 }
 
-func (c *conn) addQuery(queryType types.QueryType, query *types.Query) (affectedRows int64, lastInsertID int64, rows driver.Rows, err error) {
-	if c.inTransaction {
-		// check query type, enqueue query
-		if queryType == types.ReadQuery {
-			// read query is not supported in transaction
-			err = ErrQueryInTransaction
-			return
-		}
-
-		// append queries
-		c.queries = append(c.queries, *query)
+func (c *conn) resetTx() {
+	c.queries = c.queries[:0]
+	c.inTransaction = false
+	c.txID = 0
+	c.txBegun = false
+}
 
+func (c *conn) addQuery(ctx context.Context, queryType types.QueryType, query *types.Query) (affectedRows int64, lastInsertID int64, rows driver.Rows, err error) {
+	if c.inTransaction {
 		log.WithFields(log.Fields{
 			"pattern": query.Pattern,
 			"args":    query.Args,
-		}).Debug("add query to tx")
+			"tx":      c.txID,
+		}).Debug("execute query in tx")
+
+		txOp := types.TxExec
+		if !c.txBegun {
+			txOp = types.TxBegin
+		}
+
+		if affectedRows, lastInsertID, rows, err = c.sendQuery(
+			ctx, queryType, txOp, []types.Query{*query}); err != nil {
+			return
+		}
+
+		c.txBegun = true
+		if queryType == types.WriteQuery {
+			// record writes to commit
+			c.queries = append(c.queries, *query)
+		}
 
 		return
 	}
@@ -303,10 +356,21 @@ func (c *conn) addQuery(queryType types.QueryType, query *types.Query) (affected
 		"args":    query.Args,
 	}).Debug("execute query")
 
-	return c.sendQuery(queryType, []types.Query{*query})
+	return c.sendQuery(ctx, queryType, types.TxNone, []types.Query{*query})
 }
 
-func (c *conn) sendQuery(queryType types.QueryType, queries []types.Query) (affectedRows int64, lastInsertID int64, rows driver.Rows, err error) {
+func (c *conn) sendQuery(ctx context.Context, queryType types.QueryType, txOp types.TxOp, queries []types.Query) (affectedRows int64, lastInsertID int64, rows driver.Rows, err error) {
+	// bound the query with the configured timeout
+	timeout := c.readTimeout
+	if queryType == types.WriteQuery {
+		timeout = c.writeTimeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
 	var peers *proto.Peers
 	if peers, err = cacheGetPeers(c.dbID, c.privKey); err != nil {
 		return
@@ -316,13 +380,22 @@ func (c *conn) sendQuery(queryType types.QueryType, queries []types.Query) (affe
 	connID, seqNo := allocateConnAndSeq()
 	defer putBackConn(connID)
 
+	// choose the peer to serve the query
+	// interactive transaction is held by the leader
+	target := peers.Leader
+	var pageSize uint64
+	if queryType == types.ReadQuery && txOp == types.TxNone {
+		target = c.pickReadPeer(peers)
+		pageSize = c.pageSize
+	}
+
 	defer func() {
 		log.WithFields(log.Fields{
 			"count":  len(queries),
 			"type":   queryType.String(),
 			"connID": connID,
 			"seqNo":  seqNo,
-			"target": peers.Leader,
+			"target": target,
 			"source": c.localNodeID,
 		}).WithError(err).Debug("send query")
 	}()
@@ -337,6 +410,9 @@ func (c *conn) sendQuery(queryType types.QueryType, queries []types.Query) (affe
 				ConnectionID: connID,
 				SeqNo:        seqNo,
 				Timestamp:    getLocalTime(),
+				TxID:         c.txID,
+				TxOp:         txOp,
+				PageSize:     pageSize,
 			},
 		},
 		Payload: types.RequestPayload{
@@ -348,22 +424,25 @@ func (c *conn) sendQuery(queryType types.QueryType, queries []types.Query) (affe
 		return
 	}
 
-	var response types.Response
-	if err = c.pCaller.Call(route.DBSQuery.String(), req, &response); err != nil {
+	var response *types.Response
+	if response, target, err = c.sendRequest(ctx, peers, target, req); err != nil {
 		return
 	}
 
-	// verify response
-	if err = response.Verify(); err != nil {
-		return
-	}
-	rows = newRows(&response)
+	rr := newRows(response)
+	rr.cursor = newCursor(c, response)
+	rows = rr
 
 	if queryType == types.WriteQuery {
 		affectedRows = response.Header.AffectedRows
 		lastInsertID = response.Header.LastInsertID
 	}
 
+	if txOp != types.TxNone && txOp != types.TxCommit {
+		// speculative results in transaction are not tracked by peer
+		return
+	}
+
 	// build ack
 	c.ackCh <- &types.Ack{
 		Header: types.SignedAckHeader{
@@ -378,6 +457,276 @@ func (c *conn) sendQuery(queryType types.QueryType, queries []types.Query) (affe
 	return
 }
 
+// sendRequest sends the request to target and retries on failure.
+//
+// A read query is retried on another peer. A write query is retried on the leader only after a
+// peer failure, with the peers list refreshed from block producers. The retried write carries
+// the same connection id and sequence no, so it is rejected by the sequence check of the peers
+// if it is already applied. Queries in interactive transaction are never retried since the
+// transaction session is held by the failed peer.
+func (c *conn) sendRequest(
+	ctx context.Context, peers *proto.Peers, target proto.NodeID, req *types.Request,
+) (response *types.Response, actual proto.NodeID, err error) {
+	var tried = make(map[proto.NodeID]bool)
+
+	for i := 0; ; i++ {
+		actual = target
+		tried[target] = true
+
+		if response, err = c.callPeer(ctx, target, req); err == nil {
+			return
+		}
+
+		failover := errors.Cause(err) == ErrPeerUnavailable
+		if cause := errors.Cause(err); cause == ErrUnknownUser || cause == ErrPermissionDenied ||
+			cause == ErrDatabaseFrozen {
+			// denied by the database users or status on main chain, the same on all peers
+			return
+		}
+		if i > 0 && req.Header.QueryType == types.WriteQuery &&
+			queryErrorCode(err) == types.QueryErrInvalidRequestSeq {
+			err = errors.Wrapf(ErrInvalidRequestSeq, "write may be applied before retry: %v", err)
+			return
+		}
+		if i >= MaxQueryRetries || ctx.Err() != nil || req.Header.InTx() {
+			if failover {
+				// leave the latest peers for the following queries
+				c.refreshPeers()
+			}
+			return
+		}
+		if !failover && (req.Header.QueryType == types.WriteQuery || target == peers.Leader) {
+			// the query is rejected by the leader
+			return
+		}
+
+		if failover {
+			if newPeers := c.refreshPeers(); newPeers != nil {
+				peers = newPeers
+			}
+		}
+
+		// choose the next peer to retry
+		if req.Header.QueryType == types.WriteQuery {
+			target = peers.Leader
+		} else if target = pickRetryPeer(peers, tried); target == "" {
+			// all peers are tried
+			return
+		}
+
+		log.WithFields(log.Fields{
+			"failed":   actual,
+			"target":   target,
+			"failover": failover,
+			"retry":    i + 1,
+		}).WithError(err).Debug("retry query on peer")
+
+		if tried[target] {
+			// wait for the peers to be updated
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(QueryRetryInterval):
+			}
+		}
+	}
+}
+
+// refreshPeers fetches the latest peers list of database from block producers.
+func (c *conn) refreshPeers() (peers *proto.Peers) {
+	var err error
+	if peers, err = getPeers(c.dbID, c.privKey); err != nil {
+		log.WithField("db", c.dbID).WithError(err).Warning("refresh peers failed")
+		return nil
+	}
+	return
+}
+
+// pickRetryPeer selects the leader or any untried peer to retry a failed read query.
+func pickRetryPeer(peers *proto.Peers, tried map[proto.NodeID]bool) proto.NodeID {
+	if !tried[peers.Leader] {
+		return peers.Leader
+	}
+	for _, s := range peers.Servers {
+		if !tried[s] {
+			return s
+		}
+	}
+	return ""
+}
+
+func (c *conn) callPeer(ctx context.Context, target proto.NodeID, req *types.Request) (response *types.Response, err error) {
+	var (
+		caller = c.getCaller(target)
+		start  = time.Now()
+	)
+
+	response = new(types.Response)
+	if err = caller.CallWithContext(ctx, route.DBSQuery.String(), req, response); err != nil {
+		if isPeerFailure(err) {
+			caller.markFailure()
+			err = errors.Wrapf(ErrPeerUnavailable, "call %s failed: %v", target, err)
+		} else if permErr := permissionError(err); permErr != nil {
+			err = errors.Wrapf(permErr, "call %s failed: %v", target, err)
+		}
+		return
+	}
+	caller.updateLatency(time.Since(start))
+
+	// verify response
+	if err = response.Verify(); err != nil {
+		return
+	}
+	if response.Header.NodeID != target {
+		err = errors.Wrapf(ErrInvalidResponse, "response node %s mismatch target %s",
+			response.Header.NodeID, target)
+		return
+	}
+	if len(response.Payload.ColumnMetas) != len(response.Payload.Columns) {
+		err = errors.Wrapf(ErrInvalidResponse, "response column metas %d mismatch columns %d",
+			len(response.Payload.ColumnMetas), len(response.Payload.Columns))
+		return
+	}
+
+	if req.Header.InTx() && req.Header.TxOp != types.TxCommit {
+		// log offset of speculative results in transaction is meaningless
+		return
+	}
+
+	return c.checkLogOffset(req, response)
+}
+
+// checkLogOffset validates the staleness of the response and records the latest log offset
+// seen by this connection.
+func (c *conn) checkLogOffset(req *types.Request, response *types.Response) (*types.Response, error) {
+	var (
+		offset = response.Header.LogOffset
+		last   = atomic.LoadUint64(&c.lastOffset)
+	)
+
+	if req.Header.QueryType == types.WriteQuery {
+		offset += uint64(len(req.Payload.Queries))
+	} else if c.maxStaleness > 0 && offset+c.maxStaleness < last {
+		return nil, errors.Wrapf(ErrStaleRead, "response offset %d vs last seen offset %d",
+			offset, last)
+	}
+
+	for offset > last && !atomic.CompareAndSwapUint64(&c.lastOffset, last, offset) {
+		last = atomic.LoadUint64(&c.lastOffset)
+	}
+
+	return response, nil
+}
+
+// isPeerFailure reports whether err of rpc call indicates the peer is not able to serve query,
+// in which case the query is known not to be applied or deduplicated by its sequence.
+func isPeerFailure(err error) bool {
+	if _, ok := err.(netrpc.ServerError); ok {
+		// the peer is alive, only rejection of non-leader is considered a failure
+		return queryErrorCode(err) == types.QueryErrNotLeader
+	}
+	// transport failures
+	return err != context.Canceled && err != context.DeadlineExceeded
+}
+
+// permissionError returns the typed error if err of rpc call indicates the query is denied by the
+// database users or status on main chain.
+func permissionError(err error) error {
+	switch queryErrorCode(err) {
+	case types.QueryErrUnknownUser:
+		return ErrUnknownUser
+	case types.QueryErrPermissionDenied:
+		return ErrPermissionDenied
+	case types.QueryErrDatabaseFrozen:
+		return ErrDatabaseFrozen
+	}
+	return nil
+}
+
+// queryErrorCode returns the code of the query error reported by peer, or 0 if err is not a
+// coded query error.
+func queryErrorCode(err error) types.QueryErrorCode {
+	se, ok := errors.Cause(err).(netrpc.ServerError)
+	if !ok {
+		return 0
+	}
+	if qe, ok := types.ParseQueryError(string(se)); ok {
+		return qe.Code
+	}
+	return 0
+}
+
+func (c *conn) getCaller(target proto.NodeID) *peerCaller {
+	if rawCaller, ok := c.callers.Load(target); ok {
+		return rawCaller.(*peerCaller)
+	}
+
+	rawCaller, _ := c.callers.LoadOrStore(target, &peerCaller{
+		PersistentCaller: rpc.NewPersistentCaller(target),
+	})
+	return rawCaller.(*peerCaller)
+}
+
+// pickReadPeer selects the peer to serve a read query according to the read mode.
+func (c *conn) pickReadPeer(peers *proto.Peers) (target proto.NodeID) {
+	target = peers.Leader
+
+	switch c.readMode {
+	case ReadFromFollower:
+		followers := make([]proto.NodeID, 0, len(peers.Servers))
+		for _, s := range peers.Servers {
+			if s != peers.Leader {
+				followers = append(followers, s)
+			}
+		}
+		if len(followers) > 0 {
+			target = followers[atomic.AddUint32(&c.readSeq, 1)%uint32(len(followers))]
+		}
+	case ReadFromNearest:
+		// peers never called before have zero latency, so they get probed first
+		var minLatency int64 = -1
+		for _, s := range peers.Servers {
+			if latency := c.getCaller(s).getLatency(); minLatency < 0 || latency < minLatency {
+				target, minLatency = s, latency
+			}
+		}
+	}
+
+	return
+}
+
+func (pc *peerCaller) getLatency() int64 {
+	return atomic.LoadInt64(&pc.latency)
+}
+
+func (pc *peerCaller) updateLatency(d time.Duration) {
+	for {
+		var (
+			old    = atomic.LoadInt64(&pc.latency)
+			latest = int64(d)
+		)
+		if old > 0 {
+			// exponential moving average with alpha = 1/4
+			latest = old + (latest-old)/4
+		}
+		if atomic.CompareAndSwapInt64(&pc.latency, old, latest) {
+			return
+		}
+	}
+}
+
+// markFailure records the failure penalty as the latency of the peer, the latency recovers by the
+// moving average of the successful calls.
+func (pc *peerCaller) markFailure() {
+	for {
+		old := atomic.LoadInt64(&pc.latency)
+		if old >= int64(PeerFailurePenalty) ||
+			atomic.CompareAndSwapInt64(&pc.latency, old, int64(PeerFailurePenalty)) {
+			return
+		}
+	}
+}
+
 func getLocalTime() time.Time {
 	return time.Now().UTC()
 }
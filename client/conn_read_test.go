@@ -0,0 +1,112 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPickReadPeer(t *testing.T) {
+	Convey("test read peer selection", t, func() {
+		peers := &proto.Peers{
+			PeersHeader: proto.PeersHeader{
+				Leader:  proto.NodeID("leader"),
+				Servers: []proto.NodeID{"leader", "follower1", "follower2"},
+			},
+		}
+
+		c := &conn{readMode: ReadFromLeader}
+		So(c.pickReadPeer(peers), ShouldEqual, peers.Leader)
+
+		c = &conn{readMode: ReadFromFollower}
+		picked := make(map[proto.NodeID]int)
+		for i := 0; i != 10; i++ {
+			picked[c.pickReadPeer(peers)]++
+		}
+		So(picked, ShouldNotContainKey, peers.Leader)
+		So(picked[proto.NodeID("follower1")], ShouldEqual, 5)
+		So(picked[proto.NodeID("follower2")], ShouldEqual, 5)
+
+		// no followers available
+		c = &conn{readMode: ReadFromFollower}
+		So(c.pickReadPeer(&proto.Peers{
+			PeersHeader: proto.PeersHeader{
+				Leader:  proto.NodeID("leader"),
+				Servers: []proto.NodeID{"leader"},
+			},
+		}), ShouldEqual, peers.Leader)
+
+		c = &conn{readMode: ReadFromNearest}
+		c.getCaller("leader").updateLatency(3 * time.Millisecond)
+		c.getCaller("follower1").updateLatency(time.Millisecond)
+		c.getCaller("follower2").updateLatency(2 * time.Millisecond)
+		So(c.pickReadPeer(peers), ShouldEqual, proto.NodeID("follower1"))
+		c.getCaller("follower1").updateLatency(100 * time.Millisecond)
+		So(c.pickReadPeer(peers), ShouldEqual, proto.NodeID("follower2"))
+		c.getCaller("follower2").markFailure()
+		So(c.pickReadPeer(peers), ShouldEqual, proto.NodeID("leader"))
+
+		// the failed peer never called before should not be preferred
+		c.getCaller("follower3").markFailure()
+		So(c.pickReadPeer(&proto.Peers{
+			PeersHeader: proto.PeersHeader{
+				Leader:  "leader",
+				Servers: []proto.NodeID{"follower3", "leader"},
+			},
+		}), ShouldEqual, proto.NodeID("leader"))
+	})
+}
+
+func TestCheckLogOffset(t *testing.T) {
+	Convey("test log offset staleness check", t, func() {
+		newPair := func(qt types.QueryType, offset uint64, count int) (*types.Request, *types.Response) {
+			req := &types.Request{}
+			req.Header.QueryType = qt
+			req.Payload.Queries = make([]types.Query, count)
+			resp := &types.Response{}
+			resp.Header.LogOffset = offset
+			return req, resp
+		}
+
+		c := &conn{maxStaleness: 5}
+		_, err := c.checkLogOffset(newPair(types.WriteQuery, 10, 2))
+		So(err, ShouldBeNil)
+		So(c.lastOffset, ShouldEqual, 12)
+
+		_, err = c.checkLogOffset(newPair(types.ReadQuery, 7, 1))
+		So(err, ShouldBeNil)
+		So(c.lastOffset, ShouldEqual, 12)
+
+		_, err = c.checkLogOffset(newPair(types.ReadQuery, 6, 1))
+		So(errors.Cause(err), ShouldEqual, ErrStaleRead)
+
+		_, err = c.checkLogOffset(newPair(types.ReadQuery, 20, 1))
+		So(err, ShouldBeNil)
+		So(c.lastOffset, ShouldEqual, 20)
+
+		// no staleness bound
+		c = &conn{lastOffset: 100}
+		_, err = c.checkLogOffset(newPair(types.ReadQuery, 0, 1))
+		So(err, ShouldBeNil)
+	})
+}
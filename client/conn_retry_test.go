@@ -0,0 +1,80 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"io"
+	"net/rpc"
+	"testing"
+
+	kt "github.com/CovenantSQL/CovenantSQL/kayak/types"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPickRetryPeer(t *testing.T) {
+	Convey("test retry peer selection", t, func() {
+		peers := &proto.Peers{
+			PeersHeader: proto.PeersHeader{
+				Leader:  proto.NodeID("leader"),
+				Servers: []proto.NodeID{"leader", "follower1", "follower2"},
+			},
+		}
+		tried := map[proto.NodeID]bool{"follower1": true}
+		So(pickRetryPeer(peers, tried), ShouldEqual, peers.Leader)
+		tried[peers.Leader] = true
+		So(pickRetryPeer(peers, tried), ShouldEqual, proto.NodeID("follower2"))
+		tried["follower2"] = true
+		So(pickRetryPeer(peers, tried), ShouldBeEmpty)
+	})
+}
+
+func TestIsPeerFailure(t *testing.T) {
+	Convey("test peer failure detection", t, func() {
+		So(isPeerFailure(io.EOF), ShouldBeTrue)
+		So(isPeerFailure(rpc.ErrShutdown), ShouldBeTrue)
+		So(isPeerFailure(rpc.ServerError((&types.QueryError{
+			Code: types.QueryErrNotLeader,
+			Msg:  "apply failed: " + kt.ErrNotLeader.Error(),
+		}).Error())), ShouldBeTrue)
+		So(isPeerFailure(rpc.ServerError("leader verify log: "+kt.ErrNotLeader.Error())), ShouldBeFalse)
+		So(isPeerFailure(rpc.ServerError("no such table: t1")), ShouldBeFalse)
+		So(isPeerFailure(context.DeadlineExceeded), ShouldBeFalse)
+		So(isPeerFailure(context.Canceled), ShouldBeFalse)
+	})
+}
+
+func TestPermissionError(t *testing.T) {
+	Convey("test permission error detection", t, func() {
+		coded := func(code types.QueryErrorCode, msg string) error {
+			return rpc.ServerError((&types.QueryError{Code: code, Msg: msg}).Error())
+		}
+		So(permissionError(coded(types.QueryErrUnknownUser, "account 0000 in database db")),
+			ShouldEqual, ErrUnknownUser)
+		So(permissionError(coded(types.QueryErrPermissionDenied, "write query from read-only account 0000")),
+			ShouldEqual, ErrPermissionDenied)
+		So(permissionError(coded(types.QueryErrDatabaseFrozen, "database db")),
+			ShouldEqual, ErrDatabaseFrozen)
+		So(permissionError(coded(types.QueryErrInvalidRequestSeq, "apply failed")), ShouldBeNil)
+		// the messages are never parsed
+		So(permissionError(rpc.ServerError("no such table: "+ErrPermissionDenied.Error())), ShouldBeNil)
+		So(permissionError(rpc.ServerError("no such table: t1")), ShouldBeNil)
+		So(permissionError(io.EOF), ShouldBeNil)
+	})
+}
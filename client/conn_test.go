@@ -21,6 +21,7 @@ import (
 	"sync"
 	"testing"
 
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -29,13 +30,14 @@ func TestConn(t *testing.T) {
 	log.SetLevel(log.DebugLevel)
 	Convey("test connection", t, func() {
 		var stopTestService func()
+		var dsn string
 		var err error
-		stopTestService, _, err = startTestService()
+		stopTestService, _, dsn, err = startTestService()
 		So(err, ShouldBeNil)
 		defer stopTestService()
 
 		var db *sql.DB
-		db, err = sql.Open("covenantsql", "covenantsql://db?update_interval=400ms")
+		db, err = sql.Open("covenantsql", dsn+"?update_interval=400ms")
 		So(db, ShouldNotBeNil)
 		So(err, ShouldBeNil)
 
@@ -146,16 +148,49 @@ func TestConn(t *testing.T) {
 	})
 }
 
+func TestConnector(t *testing.T) {
+	Convey("test connector", t, func() {
+		var stopTestService func()
+		var dsn string
+		var err error
+		stopTestService, _, dsn, err = startTestService()
+		So(err, ShouldBeNil)
+		defer stopTestService()
+
+		var cfg *Config
+		cfg, err = ParseDSN(dsn)
+		So(err, ShouldBeNil)
+
+		// connector without private key signs with the local key
+		db := sql.OpenDB(NewConnector(cfg, nil))
+		defer db.Close()
+		_, err = db.Exec("create table test (test int)")
+		So(err, ShouldBeNil)
+
+		// account of the random key has no permission of the database
+		var privKey *asymmetric.PrivateKey
+		privKey, _, err = asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		otherDB := sql.OpenDB(NewConnector(cfg, privKey))
+		defer otherDB.Close()
+		_, err = otherDB.Exec("insert into test values (1)")
+		So(err, ShouldNotBeNil)
+		_, err = otherDB.Query("select * from test")
+		So(err, ShouldNotBeNil)
+	})
+}
+
 func TestTransaction(t *testing.T) {
 	Convey("test transaction", t, func() {
 		var stopTestService func()
+		var dsn string
 		var err error
-		stopTestService, _, err = startTestService()
+		stopTestService, _, dsn, err = startTestService()
 		So(err, ShouldBeNil)
 		defer stopTestService()
 
 		var db *sql.DB
-		db, err = sql.Open("covenantsql", "covenantsql://db")
+		db, err = sql.Open("covenantsql", dsn)
 		So(db, ShouldNotBeNil)
 		So(err, ShouldBeNil)
 
@@ -178,14 +213,23 @@ func TestTransaction(t *testing.T) {
 		So(tx, ShouldNotBeNil)
 		So(err, ShouldBeNil)
 
-		// test fill invalid read query in transaction
-		_, err = tx.Query("select * from test")
-		So(err, ShouldNotBeNil)
+		// test read query in transaction
+		var rows *sql.Rows
+		rows, err = tx.Query("select * from test")
+		So(err, ShouldBeNil)
+		So(rows, ShouldNotBeNil)
+		rows.Close()
 
 		// test query
 		_, err = tx.Exec("insert into test values(2)")
 		So(err, ShouldBeNil)
 
+		// test read your own writes in transaction
+		var txCount int
+		err = tx.QueryRow("select count(1) as cnt from test").Scan(&txCount)
+		So(err, ShouldBeNil)
+		So(txCount, ShouldEqual, 2)
+
 		// test rollback
 		err = tx.Rollback()
 		So(err, ShouldBeNil)
@@ -232,17 +276,27 @@ func TestTransaction(t *testing.T) {
 		_, err = tx.Exec("insert into test values(4)")
 		So(err, ShouldBeNil)
 		_, err = tx.Exec("THIS IS NOT A SQL!!!!")
-		So(err, ShouldBeNil) // should be nil since query is not committed
-		err = tx.Commit()
-		So(err, ShouldNotBeNil) // should failed
-		testRowCount(3)         // should still be 3 rows
+		So(err, ShouldNotBeNil) // should fail immediately in transaction
+		err = tx.Rollback()
+		So(err, ShouldBeNil)
+		testRowCount(3) // should still be 3 rows
 
 		// test rollback empty transaction
 		tx, err = db.Begin()
 		So(tx, ShouldNotBeNil)
 		So(err, ShouldBeNil)
 		err = tx.Rollback()
-		So(err, ShouldNotBeNil)
+		So(err, ShouldBeNil)
+
+		// test read only transaction
+		tx, err = db.Begin()
+		So(tx, ShouldNotBeNil)
+		So(err, ShouldBeNil)
+		err = tx.QueryRow("select count(1) as cnt from test").Scan(&txCount)
+		So(err, ShouldBeNil)
+		So(txCount, ShouldEqual, 3)
+		err = tx.Commit()
+		So(err, ShouldBeNil)
 
 		// test commit empty transaction, should silently success
 		tx, err = db.Begin()
@@ -0,0 +1,128 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/pkg/errors"
+)
+
+// cursor fetches the remaining pages of a paged query result from the peer serving the query.
+type cursor struct {
+	c       *conn
+	target  proto.NodeID
+	id      uint64
+	pageNo  uint64    // pageNo is the last received page, the query response is page 0
+	request hash.Hash // request is the hash of original request header
+	parent  hash.Hash // parent is the hash of last received response or page header
+	done    bool
+}
+
+func newCursor(c *conn, response *types.Response) *cursor {
+	if response.Header.CursorID == 0 {
+		return nil
+	}
+	return &cursor{
+		c:       c,
+		target:  response.Header.NodeID,
+		id:      response.Header.CursorID,
+		request: response.Header.Request.Hash(),
+		parent:  response.Header.Hash(),
+	}
+}
+
+// fetch pulls the next page of cursor, the page is verified to be signed by the serving peer and
+// chained to the previous page.
+func (cur *cursor) fetch() (rows []types.ResponseRow, err error) {
+	var (
+		req    *types.CursorRequest
+		page   = new(types.Page)
+		ctx    = context.Background()
+		cancel context.CancelFunc
+	)
+	if cur.c.readTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, cur.c.readTimeout)
+		defer cancel()
+	}
+	if req, err = cur.buildRequest(cur.pageNo + 1); err != nil {
+		return
+	}
+	if err = cur.c.getCaller(cur.target).CallWithContext(
+		ctx, route.DBSFetch.String(), req, page); err != nil {
+		return
+	}
+
+	// verify page
+	if err = page.Verify(); err != nil {
+		return
+	}
+	if page.Header.NodeID != cur.target {
+		err = errors.Wrapf(ErrInvalidResponse, "page node %s mismatch target %s",
+			page.Header.NodeID, cur.target)
+		return
+	}
+	if err = page.VerifyChain(cur.request, cur.parent, cur.id, cur.pageNo+1); err != nil {
+		return
+	}
+
+	cur.pageNo = page.Header.PageNo
+	cur.parent = page.Header.Hash()
+	cur.done = page.Header.Done
+	rows = page.Payload.Rows
+	return
+}
+
+// close releases the cursor on the serving peer.
+func (cur *cursor) close() (err error) {
+	var (
+		req    *types.CursorRequest
+		res    types.CloseCursorResponse
+		ctx    = context.Background()
+		cancel context.CancelFunc
+	)
+	if cur.c.readTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, cur.c.readTimeout)
+		defer cancel()
+	}
+	if req, err = cur.buildRequest(cur.pageNo); err != nil {
+		return
+	}
+	cur.done = true
+	return cur.c.getCaller(cur.target).CallWithContext(
+		ctx, route.DBSCloseCursor.String(), req, &res)
+}
+
+func (cur *cursor) buildRequest(pageNo uint64) (req *types.CursorRequest, err error) {
+	req = &types.CursorRequest{
+		Header: types.SignedCursorRequestHeader{
+			CursorRequestHeader: types.CursorRequestHeader{
+				DatabaseID: cur.c.dbID,
+				NodeID:     cur.c.localNodeID,
+				CursorID:   cur.id,
+				PageNo:     pageNo,
+				Timestamp:  getLocalTime(),
+			},
+		},
+	}
+	err = req.Sign(cur.c.privKey)
+	return
+}
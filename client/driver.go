@@ -17,6 +17,7 @@
 package client
 
 import (
+	"context"
 	"database/sql"
 	"database/sql/driver"
 	"math/rand"
@@ -26,6 +27,8 @@ import (
 	"time"
 
 	bp "github.com/CovenantSQL/CovenantSQL/blockproducer"
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
 	"github.com/CovenantSQL/CovenantSQL/conf"
 	"github.com/CovenantSQL/CovenantSQL/crypto"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
@@ -48,6 +51,27 @@ const (
 var (
 	// PeersUpdateInterval defines peers list refresh interval for client.
 	PeersUpdateInterval = time.Second * 5
+	// MaxQueryRetries defines the max retry times of a failed query on peers.
+	MaxQueryRetries = 3
+	// QueryRetryInterval defines the wait interval before retrying query on the same peer.
+	QueryRetryInterval = time.Second
+	// PeerFailurePenalty defines the latency recorded for a peer on call failure, so the nearest
+	// read mode avoids the failed peer until it is probed again.
+	PeerFailurePenalty = time.Second * 10
+	// DefaultGasPrice defines the gas price of the database created by the deprecated Create.
+	DefaultGasPrice uint64 = 1
+	// DefaultAdvancePayment defines the advance payment of the database created by the deprecated
+	// Create, which is charged from the stable coin balance of current account.
+	DefaultAdvancePayment uint64 = 1000000
+	// DefaultTxFee defines the fee of the main chain transactions sent by client, which can be
+	// overridden by WithFee. Block producer packs the pending transactions by fee, so a higher fee
+	// gets the transaction packed earlier when the main chain is busy.
+	DefaultTxFee uint64 = 10
+	// CreationTimeout defines the max time the deprecated Create waits for the database to be
+	// deployed, the creation transaction takes at least one block period to be packed on main chain.
+	CreationTimeout = time.Minute * 3
+	// CreationPollInterval defines the interval of polling the database while waiting for creation.
+	CreationPollInterval = time.Second
 
 	driverInitialized   uint32
 	peersUpdaterRunning uint32
@@ -80,7 +104,40 @@ func (d *covenantSQLDriver) Open(dsn string) (conn driver.Conn, err error) {
 		return
 	}
 
-	return newConn(cfg)
+	return newConn(cfg, nil)
+}
+
+// Connector implements the database/sql/driver.Connector interface, the connections opened by it
+// sign the requests with a specific private key instead of the local one. The requests are still
+// sent by the local node, but the miners check the database permissions of the signer account.
+type Connector struct {
+	cfg     *Config
+	privKey *asymmetric.PrivateKey
+}
+
+// NewConnector returns a new connector of the database described by cfg, which can be opened by
+// sql.OpenDB. The connections sign the requests with privKey, or the local private key if privKey
+// is nil.
+func NewConnector(cfg *Config, privKey *asymmetric.PrivateKey) *Connector {
+	return &Connector{
+		cfg:     cfg,
+		privKey: privKey,
+	}
+}
+
+// Connect implements the database/sql/driver.Connector.Connect method.
+func (c *Connector) Connect(ctx context.Context) (conn driver.Conn, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+
+	return newConn(c.cfg, c.privKey)
+}
+
+// Driver implements the database/sql/driver.Connector.Driver method.
+func (c *Connector) Driver() driver.Driver {
+	return &covenantSQLDriver{}
 }
 
 // ResourceMeta defines new database resources requirement descriptions.
@@ -115,37 +172,135 @@ func Init(configFile string, masterKey []byte) (err error) {
 	return
 }
 
-// Create send create database operation to block producer.
+// TxOption defines an option of the main chain transactions sent by client.
+type TxOption func(*txOptions)
+
+type txOptions struct {
+	fee uint64
+}
+
+// WithFee sets the fee of the main chain transaction, which is charged from the stable coin
+// balance of current account.
+func WithFee(fee uint64) TxOption {
+	return func(o *txOptions) {
+		o.fee = fee
+	}
+}
+
+func newTxOptions(opts []TxOption) (o *txOptions) {
+	o = &txOptions{fee: DefaultTxFee}
+	for _, v := range opts {
+		v(o)
+	}
+	return
+}
+
+// Create sends the database creation transaction to main chain with DefaultGasPrice,
+// DefaultAdvancePayment and DefaultTxFee, and waits up to CreationTimeout until the database is
+// deployed by block producer.
+//
+// Databases used to be created by block producer directly without payment, which is rejected now
+// with blockproducer.ErrCreateDatabaseOffChain since every database requires an on-chain profile.
+// Create keeps the signature of the former call, but it charges the advance payment and blocks
+// for blocks to be produced.
+//
+// Deprecated: use CreateAndWait, or CreateOnChain with WaitDatabaseCreation, which take the
+// payment and the timeout explicitly.
 func Create(meta ResourceMeta) (dsn string, err error) {
+	return CreateAndWait(meta, DefaultGasPrice, DefaultAdvancePayment, CreationTimeout)
+}
+
+// CreateAndWait sends the database creation transaction to main chain, and waits until the
+// database is deployed by block producer or the timeout, see CreateOnChain and
+// WaitDatabaseCreation. The dsn is returned with ErrCreationTimeout on timeout, so that the
+// caller can wait again.
+func CreateAndWait(
+	meta ResourceMeta, gasPrice, advancePayment uint64, timeout time.Duration, opts ...TxOption,
+) (dsn string, err error) {
+	if dsn, err = CreateOnChain(meta, gasPrice, advancePayment, opts...); err != nil {
+		return
+	}
+	err = WaitDatabaseCreation(dsn, timeout)
+	return
+}
+
+// WaitDatabaseCreation waits until the database of the dsn is deployed by block producer, or
+// returns ErrCreationTimeout if the database is still not available after the timeout.
+func WaitDatabaseCreation(dsn string, timeout time.Duration) (err error) {
 	if atomic.LoadUint32(&driverInitialized) == 0 {
 		err = ErrNotInitialized
 		return
 	}
 
-	req := new(types.CreateDatabaseRequest)
-	req.Header.ResourceMeta = types.ResourceMeta(meta)
+	var cfg *Config
+	if cfg, err = ParseDSN(dsn); err != nil {
+		return
+	}
 	var privateKey *asymmetric.PrivateKey
 	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
 		err = errors.Wrap(err, "get local private key failed")
 		return
 	}
-	if err = req.Sign(privateKey); err != nil {
-		err = errors.Wrap(err, "sign request failed")
+
+	var (
+		dbID     = proto.DatabaseID(cfg.DatabaseID)
+		deadline = time.After(timeout)
+		ticker   = time.NewTicker(CreationPollInterval)
+	)
+	defer ticker.Stop()
+	for {
+		if _, err = getPeers(dbID, privateKey); err == nil {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			err = errors.Wrapf(ErrCreationTimeout, "last error: %v", err)
+			return
+		}
+	}
+}
+
+// CreateOnChain sends the database creation transaction to main chain, the database is deployed
+// to the miners allocated by block producer after the transaction is packed, so the returned dsn
+// is not available until then, see WaitDatabaseCreation. The advance payment is moved to the
+// database deposit.
+func CreateOnChain(
+	meta ResourceMeta, gasPrice, advancePayment uint64, opts ...TxOption) (dsn string, err error,
+) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
 		return
 	}
-	res := new(types.CreateDatabaseResponse)
 
-	if err = requestBP(route.BPDBCreateDatabase, req, res); err != nil {
-		err = errors.Wrap(err, "call BPDB.CreateDatabase failed")
+	var tx *pt.CreateDatabase
+	if err = sendTx(opts, func(owner proto.AccountAddress, nonce pi.AccountNonce, fee uint64) pi.Transaction {
+		tx = pt.NewCreateDatabase(&pt.CreateDatabaseHeader{
+			Owner: owner,
+			ResourceMeta: pt.ResourceMeta{
+				Node:          meta.Node,
+				Space:         meta.Space,
+				Memory:        meta.Memory,
+				LoadAvgPerCPU: meta.LoadAvgPerCPU,
+				StorageEngine: string(meta.StorageEngine),
+			},
+			GasPrice:       gasPrice,
+			AdvancePayment: advancePayment,
+			Fee:            fee,
+			Nonce:          nonce,
+		})
+		return tx
+	}); err != nil {
 		return
 	}
-	if err = res.Verify(); err != nil {
-		err = errors.Wrap(err, "response verify failed")
+
+	var dbID proto.DatabaseID
+	if dbID, err = tx.DatabaseID(); err != nil {
 		return
 	}
 
 	cfg := NewConfig()
-	cfg.DatabaseID = string(res.Header.InstanceMeta.DatabaseID)
+	cfg.DatabaseID = string(dbID)
 	dsn = cfg.FormatDSN()
 
 	return
@@ -230,6 +385,154 @@ func GetCovenantCoinBalance() (balance uint64, err error) {
 	return
 }
 
+// GrantPermission grants the user permission on the database to the target account through a
+// main chain transaction signed by current account, which should be an admin of the database.
+// The target account is added as a new database user if it's not a user yet.
+func GrantPermission(
+	dsn string, target proto.AccountAddress, perm pt.UserPermission, opts ...TxOption) (err error,
+) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+
+	var cfg *Config
+	if cfg, err = ParseDSN(dsn); err != nil {
+		return
+	}
+	dbID := proto.DatabaseID(cfg.DatabaseID)
+
+	req := &types.QuerySQLChainProfileReq{DBID: dbID}
+	res := new(types.QuerySQLChainProfileResp)
+	if err = requestBP(route.MCCQuerySQLChainProfile, req, res); err != nil {
+		err = errors.Wrap(err, "query sqlchain profile failed")
+		return
+	}
+	if !res.OK {
+		err = errors.Wrapf(bp.ErrDatabaseNotFound, "database %s", dbID)
+		return
+	}
+
+	exists := false
+	for _, u := range res.Profile.Users {
+		if u != nil && u.Address == target {
+			exists = true
+			break
+		}
+	}
+
+	return sendTx(opts, func(advocate proto.AccountAddress, nonce pi.AccountNonce, fee uint64) pi.Transaction {
+		if exists {
+			return pt.NewAlterDatabaseUser(&pt.AlterDatabaseUserHeader{
+				Advocate:       advocate,
+				TargetSQLChain: dbID,
+				TargetUser:     target,
+				Permission:     perm,
+				Fee:            fee,
+				Nonce:          nonce,
+			})
+		}
+		return pt.NewAddDatabaseUser(&pt.AddDatabaseUserHeader{
+			Advocate:       advocate,
+			TargetSQLChain: dbID,
+			TargetUser:     target,
+			Permission:     perm,
+			Fee:            fee,
+			Nonce:          nonce,
+		})
+	})
+}
+
+// RevokePermission removes the target account from the database users through a main chain
+// transaction signed by current account, which should be an admin of the database.
+func RevokePermission(dsn string, target proto.AccountAddress, opts ...TxOption) (err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+
+	var cfg *Config
+	if cfg, err = ParseDSN(dsn); err != nil {
+		return
+	}
+	dbID := proto.DatabaseID(cfg.DatabaseID)
+
+	return sendTx(opts, func(advocate proto.AccountAddress, nonce pi.AccountNonce, fee uint64) pi.Transaction {
+		return pt.NewDeleteDatabaseUser(&pt.DeleteDatabaseUserHeader{
+			Advocate:       advocate,
+			TargetSQLChain: dbID,
+			TargetUser:     target,
+			Fee:            fee,
+			Nonce:          nonce,
+		})
+	})
+}
+
+// TopUpDatabase moves the stable coin of current account to the deposit of the database through
+// a main chain transaction, which restores the database in grace period or frozen for low
+// deposit since the next billing.
+func TopUpDatabase(dsn string, amount uint64, opts ...TxOption) (err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+
+	var cfg *Config
+	if cfg, err = ParseDSN(dsn); err != nil {
+		return
+	}
+	dbID := proto.DatabaseID(cfg.DatabaseID)
+
+	return sendTx(opts, func(payer proto.AccountAddress, nonce pi.AccountNonce, fee uint64) pi.Transaction {
+		return pt.NewTopUpDatabase(&pt.TopUpDatabaseHeader{
+			Payer:          payer,
+			TargetSQLChain: dbID,
+			Amount:         amount,
+			Fee:            fee,
+			Nonce:          nonce,
+		})
+	})
+}
+
+// sendTx builds a transaction of current account with its next nonce and the fee of opts, and
+// sends the signed transaction to block producer.
+func sendTx(
+	opts []TxOption, build func(proto.AccountAddress, pi.AccountNonce, uint64) pi.Transaction,
+) (
+	err error,
+) {
+	var (
+		privateKey *asymmetric.PrivateKey
+		addr       proto.AccountAddress
+		o          = newTxOptions(opts)
+	)
+	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
+		err = errors.Wrap(err, "get local private key failed")
+		return
+	}
+	if addr, err = crypto.PubKeyHash(privateKey.PubKey()); err != nil {
+		return
+	}
+
+	nonceReq := &types.NextAccountNonceReq{Addr: addr}
+	nonceResp := new(types.NextAccountNonceResp)
+	if err = requestBP(route.MCCNextAccountNonce, nonceReq, nonceResp); err != nil {
+		err = errors.Wrap(err, "call MCC.NextAccountNonce failed")
+		return
+	}
+
+	req := &types.AddTxReq{Tx: build(addr, nonceResp.Nonce, o.fee)}
+	if err = req.Tx.Sign(privateKey); err != nil {
+		err = errors.Wrap(err, "sign transaction failed")
+		return
+	}
+	if err = requestBP(route.MCCAddTx, req, new(types.AddTxResp)); err != nil {
+		err = errors.Wrap(err, "call MCC.AddTx failed")
+	}
+
+	return
+}
+
 func requestBP(method route.RemoteFunc, request interface{}, response interface{}) (err error) {
 	var bpNodeID proto.NodeID
 	if bpNodeID, err = rpc.GetCurrentBP(); err != nil {
@@ -387,6 +690,17 @@ func allocateConnAndSeq() (connID uint64, seqNo uint64) {
 	return
 }
 
+func allocateTxID() (txID uint64) {
+	connIDLock.Lock()
+	defer connIDLock.Unlock()
+
+	for txID == 0 {
+		txID = randSource.Uint64()
+	}
+
+	return
+}
+
 func putBackConn(connID uint64) {
 	connIDLock.Lock()
 	defer connIDLock.Unlock()
@@ -17,12 +17,15 @@
 package client
 
 import (
+	"database/sql"
 	"path/filepath"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -33,7 +36,7 @@ func TestInit(t *testing.T) {
 		var stopTestService func()
 		var confDir string
 		var err error
-		stopTestService, confDir, err = startTestService()
+		stopTestService, confDir, _, err = startTestService()
 		So(err, ShouldBeNil)
 		defer stopTestService()
 		// already init ed
@@ -54,25 +57,66 @@ func TestInit(t *testing.T) {
 func TestCreate(t *testing.T) {
 	Convey("test create", t, func() {
 		var stopTestService func()
+		var dsn string
 		var err error
-		stopTestService, _, err = startTestService()
+		stopTestService, _, dsn, err = startTestService()
 		So(err, ShouldBeNil)
 		defer stopTestService()
-		var dsn string
-		dsn, err = Create(ResourceMeta{})
+		So(dsn, ShouldStartWith, "covenantsql://")
+
+		// the database created on chain has the profile with the owner as admin
+		var cfg *Config
+		cfg, err = ParseDSN(dsn)
+		So(err, ShouldBeNil)
+		var db *sql.DB
+		db, err = sql.Open("covenantsql", dsn)
+		So(err, ShouldBeNil)
+		defer db.Close()
+		_, err = db.Exec("create table test (test int)")
+		So(err, ShouldBeNil)
+
+		// create another database with explicit payment
+		var (
+			anotherDSN string
+			balance    uint64
+		)
+		balance, err = GetStableCoinBalance()
 		So(err, ShouldBeNil)
-		So(dsn, ShouldEqual, "covenantsql://db")
+		anotherDSN, err = CreateAndWait(ResourceMeta{Node: 1}, 1, 100, CreationTimeout, WithFee(1))
+		So(err, ShouldBeNil)
+		So(anotherDSN, ShouldNotEqual, dsn)
+		var anotherBalance uint64
+		anotherBalance, err = GetStableCoinBalance()
+		So(err, ShouldBeNil)
+		So(anotherBalance, ShouldEqual, balance-101)
+		var anotherCfg *Config
+		anotherCfg, err = ParseDSN(anotherDSN)
+		So(err, ShouldBeNil)
+		So(anotherCfg.DatabaseID, ShouldNotEqual, cfg.DatabaseID)
+
+		// database not deployed in time
+		err = WaitDatabaseCreation("covenantsql://db_not_exists", time.Second)
+		So(errors.Cause(err), ShouldEqual, ErrCreationTimeout)
+	})
+}
+
+func TestTxOptions(t *testing.T) {
+	Convey("test transaction options", t, func() {
+		So(newTxOptions(nil).fee, ShouldEqual, DefaultTxFee)
+		So(newTxOptions([]TxOption{WithFee(100)}).fee, ShouldEqual, 100)
+		So(newTxOptions([]TxOption{WithFee(100), WithFee(0)}).fee, ShouldEqual, 0)
 	})
 }
 
 func TestDrop(t *testing.T) {
 	Convey("test drop", t, func() {
 		var stopTestService func()
+		var dsn string
 		var err error
-		stopTestService, _, err = startTestService()
+		stopTestService, _, dsn, err = startTestService()
 		So(err, ShouldBeNil)
 		defer stopTestService()
-		err = Drop("covenantsql://db")
+		err = Drop(dsn)
 		So(err, ShouldBeNil)
 	})
 }
@@ -81,7 +125,7 @@ func TestGetCovenantCoinBalance(t *testing.T) {
 	Convey("test get covenant coin balance", t, func() {
 		var stopTestService func()
 		var err error
-		stopTestService, _, err = startTestService()
+		stopTestService, _, _, err = startTestService()
 		So(err, ShouldBeNil)
 		defer stopTestService()
 
@@ -89,7 +133,7 @@ func TestGetCovenantCoinBalance(t *testing.T) {
 		balance, err = GetCovenantCoinBalance()
 
 		So(err, ShouldBeNil)
-		So(balance, ShouldEqual, 0)
+		So(balance, ShouldEqual, testInitBalance)
 	})
 }
 
@@ -97,14 +141,16 @@ func TestGetStableCoinBalance(t *testing.T) {
 	Convey("test get stable coin balance", t, func() {
 		var stopTestService func()
 		var err error
-		stopTestService, _, err = startTestService()
+		stopTestService, _, _, err = startTestService()
 		So(err, ShouldBeNil)
 		defer stopTestService()
 
 		var balance uint64
 		balance, err = GetStableCoinBalance()
 
+		// the advance payment of the test database is moved to its deposit, and the creation
+		// transaction fee is charged
 		So(err, ShouldBeNil)
-		So(balance, ShouldEqual, 0)
+		So(balance, ShouldEqual, testInitBalance-DefaultAdvancePayment-DefaultTxFee)
 	})
 }
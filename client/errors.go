@@ -20,12 +20,27 @@ import "github.com/pkg/errors"
 
 // Various errors the driver might returns.
 var (
-	// ErrQueryInTransaction represents a read query is presented during user transaction.
-	ErrQueryInTransaction = errors.New("only write is supported during transaction")
 	// ErrNotInitialized represents the driver is not initialized yet.
 	ErrNotInitialized = errors.New("driver not initialized")
 	// ErrAlreadyInitialized represents the driver is already initialized.
 	ErrAlreadyInitialized = errors.New("driver already initialized")
 	// ErrInvalidRequestSeq defines invalid sequence no of request.
 	ErrInvalidRequestSeq = errors.New("invalid request sequence applied")
+	// ErrInvalidDSNParam represents an invalid parameter is presented in dsn.
+	ErrInvalidDSNParam = errors.New("invalid dsn parameter")
+	// ErrInvalidResponse represents the response is not sent by the requested peer.
+	ErrInvalidResponse = errors.New("invalid response")
+	// ErrPeerUnavailable represents the peer failed to serve the query, e.g. the peer is down
+	// or it is no longer the leader.
+	ErrPeerUnavailable = errors.New("peer unavailable")
+	// ErrStaleRead represents the read response is staler than the configured bound.
+	ErrStaleRead = errors.New("read response exceeds the staleness bound")
+	// ErrUnknownUser represents the current account is not a user of the database.
+	ErrUnknownUser = errors.New("unknown database user")
+	// ErrPermissionDenied represents the current account has no permission for the query.
+	ErrPermissionDenied = errors.New("database permission denied")
+	// ErrDatabaseFrozen represents the database is frozen for low deposit and rejects writes.
+	ErrDatabaseFrozen = errors.New("database is frozen for low deposit")
+	// ErrCreationTimeout represents the created database is not deployed in time.
+	ErrCreationTimeout = errors.New("wait database creation timeout")
 )
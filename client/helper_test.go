@@ -29,8 +29,11 @@ import (
 	"time"
 
 	bp "github.com/CovenantSQL/CovenantSQL/blockproducer"
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
 	"github.com/CovenantSQL/CovenantSQL/conf"
 	"github.com/CovenantSQL/CovenantSQL/consistent"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
@@ -47,40 +50,32 @@ import (
 const (
 	// PubKeyStorePath defines public cache store.
 	PubKeyStorePath = "./public.keystore"
+
+	testInitBalance uint64 = 10000000
+	testChainPeriod        = time.Second
+	testChainTick          = 100 * time.Millisecond
 )
 
 var (
-	rootHash = hash.Hash{}
+	rootHash      = hash.Hash{}
+	testInstances sync.Map // map[proto.DatabaseID]types.ServiceInstance
 )
 
 // fake BPDB service
 type stubBPDBService struct{}
 
-func (s *stubBPDBService) CreateDatabase(req *types.CreateDatabaseRequest, resp *types.CreateDatabaseResponse) (err error) {
-	if resp.Header.InstanceMeta, err = s.getInstanceMeta(proto.DatabaseID("db")); err != nil {
-		return
-	}
-	if resp.Header.Signee, err = kms.GetLocalPublicKey(); err != nil {
-		return
-	}
-	var privateKey *asymmetric.PrivateKey
-	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
-		return
-	}
-
-	err = resp.Sign(privateKey)
-
-	return
-}
-
 func (s *stubBPDBService) DropDatabase(req *types.DropDatabaseRequest, resp *types.DropDatabaseRequest) (err error) {
 	return
 }
 
 func (s *stubBPDBService) GetDatabase(req *types.GetDatabaseRequest, resp *types.GetDatabaseResponse) (err error) {
-	if resp.Header.InstanceMeta, err = s.getInstanceMeta(req.Header.DatabaseID); err != nil {
+	var rawInstance interface{}
+	var ok bool
+	if rawInstance, ok = testInstances.Load(req.Header.DatabaseID); !ok {
+		err = bp.ErrNoSuchDatabase
 		return
 	}
+	resp.Header.InstanceMeta = rawInstance.(types.ServiceInstance)
 	if resp.Header.Signee, err = kms.GetLocalPublicKey(); err != nil {
 		return
 	}
@@ -109,44 +104,65 @@ func (s *stubBPDBService) GetNodeDatabases(req *types.InitService, resp *types.I
 	return
 }
 
-func (s *stubBPDBService) getInstanceMeta(dbID proto.DatabaseID) (instance types.ServiceInstance, err error) {
-	var privKey *asymmetric.PrivateKey
-	if privKey, err = kms.GetLocalPrivateKey(); err != nil {
-		return
-	}
+// stubDatabaseProvider allocates the local node for the databases created on the test chain and
+// deploys them to the local dbms.
+type stubDatabaseProvider struct{}
 
+func (p *stubDatabaseProvider) AllocateMiners(
+	dbID proto.DatabaseID, meta *pt.ResourceMeta) (nodes []proto.NodeID, err error,
+) {
 	var nodeID proto.NodeID
 	if nodeID, err = kms.GetLocalNodeID(); err != nil {
 		return
 	}
+	nodes = []proto.NodeID{nodeID}
+	return
+}
 
-	instance.DatabaseID = proto.DatabaseID(dbID)
-	instance.Peers = &proto.Peers{
-		PeersHeader: proto.PeersHeader{
-			Term:    1,
-			Leader:  nodeID,
-			Servers: []proto.NodeID{nodeID},
+func (p *stubDatabaseProvider) DeployDatabase(profile *pt.SQLChainProfile) (err error) {
+	var privateKey *asymmetric.PrivateKey
+	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
+		return
+	}
+
+	instance := types.ServiceInstance{
+		DatabaseID: profile.ID,
+		Peers: &proto.Peers{
+			PeersHeader: proto.PeersHeader{
+				Term:    1,
+				Leader:  profile.MinerNodes[0],
+				Servers: profile.MinerNodes,
+			},
 		},
 	}
-	if err = instance.Peers.Sign(privKey); err != nil {
+	if err = instance.Peers.Sign(privateKey); err != nil {
+		return
+	}
+	if instance.GenesisBlock, err = createRandomBlock(rootHash, true); err != nil {
 		return
 	}
-	instance.GenesisBlock, err = createRandomBlock(rootHash, true)
 
-	return
-}
+	req := new(types.UpdateService)
+	req.Header.Op = types.CreateDB
+	req.Header.Instance = instance
+	if err = req.Sign(privateKey); err != nil {
+		return
+	}
+	var res types.UpdateServiceResponse
+	if err = testRequest(route.DBSDeploy, req, &res); err != nil {
+		return
+	}
 
-func (s *stubBPDBService) QueryAccountStableBalance(req *bp.QueryAccountStableBalanceReq,
-	resp *bp.QueryAccountStableBalanceResp) (err error) {
+	testInstances.Store(profile.ID, instance)
 	return
 }
 
-func (s *stubBPDBService) QueryAccountCovenantBalance(req *bp.QueryAccountCovenantBalanceReq,
-	resp *bp.QueryAccountCovenantBalanceResp) (err error) {
+func (p *stubDatabaseProvider) UndeployDatabase(profile *pt.SQLChainProfile) (err error) {
+	testInstances.Delete(profile.ID)
 	return
 }
 
-func startTestService() (stopTestService func(), tempDir string, err error) {
+func startTestService() (stopTestService func(), tempDir string, dsn string, err error) {
 	var server *rpc.Server
 	var cleanup func()
 	if cleanup, tempDir, server, err = initNode(); err != nil {
@@ -185,45 +201,8 @@ func startTestService() (stopTestService func(), tempDir string, err error) {
 		return
 	}
 
-	// add database
-	var req *types.UpdateService
-	var res types.UpdateServiceResponse
-	var peers *proto.Peers
-	var block *types.Block
-
-	dbID := proto.DatabaseID("db")
-
-	// create sqlchain block
-	block, err = createRandomBlock(rootHash, true)
-
-	// get database peers
-	if peers, err = genPeers(1); err != nil {
-		return
-	}
-
-	// build create database request
-	req = new(types.UpdateService)
-	req.Header.Op = types.CreateDB
-	req.Header.Instance = types.ServiceInstance{
-		DatabaseID:   dbID,
-		Peers:        peers,
-		GenesisBlock: block,
-	}
-	if req.Header.Signee, err = kms.GetLocalPublicKey(); err != nil {
-		return
-	}
-	var privateKey *asymmetric.PrivateKey
-	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
-		return
-	}
-	if err = req.Sign(privateKey); err != nil {
-		return
-	}
-
-	// send create database request
-	if err = testRequest(route.DBSDeploy, req, &res); err != nil {
-		return
-	}
+	// create database on the test chain
+	dsn, err = Create(ResourceMeta{Node: 1})
 
 	return
 }
@@ -278,21 +257,24 @@ func initNode() (cleanupFunc func(), tempDir string, server *rpc.Server, err err
 		return
 	}
 
-	// register fake chain service
-	if err = server.RegisterService(route.BlockProducerRPCName, &stubBPDBService{}); err != nil {
-		return
-	}
-
 	// init private key
 	masterKey := []byte("")
 	if err = server.InitRPCServer(conf.GConf.ListenAddr, privateKeyPath, masterKey); err != nil {
 		return
 	}
 
+	// start main chain
+	var chain *bp.Chain
+	if chain, err = startTestChain(server, tempDir); err != nil {
+		return
+	}
+
 	// start server
 	go server.Serve()
 
 	cleanupFunc = func() {
+		chain.Stop()
+		testInstances = sync.Map{}
 		os.RemoveAll(tempDir)
 		server.Listener.Close()
 		server.Stop()
@@ -304,6 +286,71 @@ func initNode() (cleanupFunc func(), tempDir string, server *rpc.Server, err err
 	return
 }
 
+// startTestChain starts a single block producer main chain with the local account as the base
+// account, the databases created on the chain are deployed to the local node.
+func startTestChain(server *rpc.Server, tempDir string) (chain *bp.Chain, err error) {
+	var (
+		privKey *asymmetric.PrivateKey
+		pubKey  *asymmetric.PublicKey
+		nodeID  proto.NodeID
+		addr    proto.AccountAddress
+	)
+	if privKey, pubKey, err = getKeys(); err != nil {
+		return
+	}
+	if nodeID, err = kms.GetLocalNodeID(); err != nil {
+		return
+	}
+	if addr, err = crypto.PubKeyHash(pubKey); err != nil {
+		return
+	}
+
+	ba := pt.NewBaseAccount(&pt.Account{
+		Address:             addr,
+		StableCoinBalance:   testInitBalance,
+		CovenantCoinBalance: testInitBalance,
+	})
+	if err = ba.Sign(privKey); err != nil {
+		return
+	}
+	genesis := &pt.Block{
+		SignedHeader: pt.SignedHeader{
+			Header: pt.Header{
+				Version:   0x01000000,
+				Producer:  addr,
+				Timestamp: time.Now().UTC(),
+			},
+		},
+		Transactions: []pi.Transaction{ba},
+	}
+	if err = genesis.PackAndSignBlock(privKey); err != nil {
+		return
+	}
+
+	peers := &proto.Peers{
+		PeersHeader: proto.PeersHeader{
+			Term:    1,
+			Leader:  nodeID,
+			Servers: []proto.NodeID{nodeID},
+		},
+	}
+	if err = peers.Sign(privKey); err != nil {
+		return
+	}
+
+	cfg := bp.NewConfig(genesis, filepath.Join(tempDir, "chain.db"), server, peers, nodeID,
+		testChainPeriod, testChainTick)
+	cfg.Provider = &stubDatabaseProvider{}
+	if chain, err = bp.NewChain(cfg); err != nil {
+		return
+	}
+	if err = chain.Start(); err != nil {
+		chain.Stop()
+		chain = nil
+	}
+	return
+}
+
 // copied from sqlchain.xxx_test.
 func createRandomBlock(parent hash.Hash, isGenesis bool) (b *types.Block, err error) {
 	// Generate key pair
@@ -19,21 +19,28 @@ package client
 import (
 	"database/sql/driver"
 	"io"
+	"reflect"
 	"strings"
 
 	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
 )
 
 type rows struct {
 	columns []string
 	types   []string
+	metas   []types.ColumnMeta
 	data    []types.ResponseRow
+	cursor  *cursor // cursor to fetch the remaining pages, nil if the result is complete
 }
 
+// newRows returns the rows of res, whose column metas are checked to match the columns on
+// receiving, see conn.sendRequest.
 func newRows(res *types.Response) *rows {
 	return &rows{
 		columns: res.Payload.Columns,
 		types:   res.Payload.DeclTypes,
+		metas:   res.Payload.ColumnMetas,
 		data:    res.Payload.Rows,
 	}
 }
@@ -46,17 +53,33 @@ func (r *rows) Columns() []string {
 // Close implements driver.Rows.Close method.
 func (r *rows) Close() error {
 	r.data = nil
+	if r.cursor != nil {
+		// release the cursor on peer, the error is ignored since the cursor expires anyway
+		if err := r.cursor.close(); err != nil {
+			log.WithField("cursor", r.cursor.id).WithError(err).Debug("close cursor failed")
+		}
+		r.cursor = nil
+	}
 	return nil
 }
 
 // Next implements driver.Rows.Next method.
-func (r *rows) Next(dest []driver.Value) error {
-	if len(r.data) == 0 {
-		return io.EOF
+func (r *rows) Next(dest []driver.Value) (err error) {
+	for len(r.data) == 0 {
+		if r.cursor == nil || r.cursor.done {
+			return io.EOF
+		}
+		if r.data, err = r.cursor.fetch(); err != nil {
+			return
+		}
 	}
 
 	for i, d := range r.data[0].Values {
-		dest[i] = d
+		if i < len(r.metas) {
+			dest[i] = convertValue(&r.metas[i], d)
+		} else {
+			dest[i] = convertValue(&types.ColumnMeta{}, d)
+		}
 	}
 
 	// unshift data
@@ -69,3 +92,36 @@ func (r *rows) Next(dest []driver.Value) error {
 func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
 	return strings.ToUpper(r.types[index])
 }
+
+// ColumnTypeNullable implements driver.RowsColumnTypeNullable.ColumnTypeNullable method.
+//
+// The peer marks a column nullable unless it's known to be NOT NULL, thus the nullability is
+// only reported as known for the not nullable columns.
+func (r *rows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	if r.metas[index].Nullable {
+		return true, false
+	}
+	return false, true
+}
+
+// ColumnTypeScanType implements driver.RowsColumnTypeScanType.ColumnTypeScanType method.
+func (r *rows) ColumnTypeScanType(index int) reflect.Type {
+	return scanType(&r.metas[index])
+}
+
+// ColumnTypeLength implements driver.RowsColumnTypeLength.ColumnTypeLength method.
+func (r *rows) ColumnTypeLength(index int) (length int64, ok bool) {
+	if m := &r.metas[index]; m.IsVariableLength() {
+		return m.Length, true
+	}
+	return 0, false
+}
+
+// ColumnTypePrecisionScale implements driver.RowsColumnTypePrecisionScale.ColumnTypePrecisionScale
+// method.
+func (r *rows) ColumnTypePrecisionScale(index int) (precision, scale int64, ok bool) {
+	if m := &r.metas[index]; m.Kind == types.ColumnKindDecimal && m.Precision > 0 {
+		return m.Precision, m.Scale, true
+	}
+	return 0, 0, false
+}
@@ -17,9 +17,13 @@
 package client
 
 import (
+	"database/sql"
 	"database/sql/driver"
 	"io"
+	"math"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/types"
 	. "github.com/smartystreets/goconvey/convey"
@@ -35,6 +39,9 @@ func TestRowsStructure(t *testing.T) {
 				DeclTypes: []string{
 					"int",
 				},
+				ColumnMetas: []types.ColumnMeta{
+					types.ParseColumnMeta("int", true),
+				},
 				Rows: []types.ResponseRow{
 					{
 						Values: []interface{}{1},
@@ -57,3 +64,70 @@ func TestRowsStructure(t *testing.T) {
 		So(r.data, ShouldBeNil)
 	})
 }
+
+func TestRowsColumnTypes(t *testing.T) {
+	Convey("test rows with column metas", t, func() {
+		var ts = time.Date(2018, 11, 1, 8, 0, 0, 0, time.UTC)
+		r := newRows(&types.Response{
+			Payload: types.ResponsePayload{
+				Columns:   []string{"i", "s", "b", "d", "t", "f", "n"},
+				DeclTypes: []string{"INTEGER", "VARCHAR(32)", "BLOB", "DECIMAL(10,2)", "DATETIME", "BOOLEAN", ""},
+				ColumnMetas: []types.ColumnMeta{
+					types.ParseColumnMeta("INTEGER", false),
+					types.ParseColumnMeta("VARCHAR(32)", true),
+					types.ParseColumnMeta("BLOB", true),
+					types.ParseColumnMeta("DECIMAL(10,2)", true),
+					types.ParseColumnMeta("DATETIME", false),
+					types.ParseColumnMeta("BOOLEAN", true),
+					types.ParseColumnMeta("", true),
+				},
+				Rows: []types.ResponseRow{
+					{Values: []interface{}{int8(1), []byte("str"), "bin", 3.1, ts.In(time.Local), int64(1), nil}},
+					{Values: []interface{}{uint64(2), nil, nil, int64(3), "2018-11-01 08:00:00", []byte("false"), []byte("x")}},
+				},
+			},
+		})
+		nullable, ok := r.ColumnTypeNullable(0)
+		So(ok, ShouldBeTrue)
+		So(nullable, ShouldBeFalse)
+		So(r.ColumnTypeScanType(0), ShouldEqual, reflect.TypeOf(int64(0)))
+		So(r.ColumnTypeScanType(1), ShouldEqual, reflect.TypeOf(sql.NullString{}))
+		So(r.ColumnTypeScanType(2), ShouldEqual, reflect.TypeOf([]byte(nil)))
+		So(r.ColumnTypeScanType(4), ShouldEqual, reflect.TypeOf(time.Time{}))
+		So(r.ColumnTypeScanType(5), ShouldEqual, reflect.TypeOf(sql.NullBool{}))
+		length, ok := r.ColumnTypeLength(1)
+		So(ok, ShouldBeTrue)
+		So(length, ShouldEqual, 32)
+		length, ok = r.ColumnTypeLength(2)
+		So(ok, ShouldBeTrue)
+		So(length, ShouldEqual, math.MaxInt64)
+		_, ok = r.ColumnTypeLength(0)
+		So(ok, ShouldBeFalse)
+		precision, scale, ok := r.ColumnTypePrecisionScale(3)
+		So(ok, ShouldBeTrue)
+		So(precision, ShouldEqual, 10)
+		So(scale, ShouldEqual, 2)
+
+		dest := make([]driver.Value, 7)
+		err := r.Next(dest)
+		So(err, ShouldBeNil)
+		So(dest, ShouldResemble, []driver.Value{int64(1), "str", []byte("bin"), "3.10", ts, true, nil})
+		err = r.Next(dest)
+		So(err, ShouldBeNil)
+		So(dest, ShouldResemble, []driver.Value{int64(2), nil, nil, "3.00", ts, false, []byte("x")})
+		err = r.Next(dest)
+		So(err, ShouldEqual, io.EOF)
+	})
+	Convey("test rows with unknown nullability", t, func() {
+		r := newRows(&types.Response{
+			Payload: types.ResponsePayload{
+				Columns:     []string{"a"},
+				DeclTypes:   []string{"TEXT"},
+				ColumnMetas: []types.ColumnMeta{types.ParseColumnMeta("TEXT", true)},
+			},
+		})
+		_, ok := r.ColumnTypeNullable(0)
+		So(ok, ShouldBeFalse)
+		So(r.ColumnTypeScanType(0), ShouldEqual, reflect.TypeOf(sql.NullString{}))
+	})
+}
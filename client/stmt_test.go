@@ -29,13 +29,14 @@ import (
 func TestStmt(t *testing.T) {
 	Convey("test statement", t, func() {
 		var stopTestService func()
+		var dsn string
 		var err error
-		stopTestService, _, err = startTestService()
+		stopTestService, _, dsn, err = startTestService()
 		So(err, ShouldBeNil)
 		defer stopTestService()
 
 		var db *sql.DB
-		db, err = sql.Open("covenantsql", "covenantsql://db")
+		db, err = sql.Open("covenantsql", dsn)
 		So(db, ShouldNotBeNil)
 		So(err, ShouldBeNil)
 
@@ -0,0 +1,202 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/types"
+)
+
+var (
+	// timestampFormats is the timestamp formats understood by the storage engine, tried in order.
+	timestampFormats = []string{
+		"2006-01-02 15:04:05.999999999-07:00",
+		"2006-01-02T15:04:05.999999999-07:00",
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02 15:04:05",
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04",
+		"2006-01-02T15:04",
+		"2006-01-02",
+	}
+
+	scanTypeInt64       = reflect.TypeOf(int64(0))
+	scanTypeNullInt64   = reflect.TypeOf(sql.NullInt64{})
+	scanTypeFloat64     = reflect.TypeOf(float64(0))
+	scanTypeNullFloat64 = reflect.TypeOf(sql.NullFloat64{})
+	scanTypeString      = reflect.TypeOf("")
+	scanTypeNullString  = reflect.TypeOf(sql.NullString{})
+	scanTypeBool        = reflect.TypeOf(false)
+	scanTypeNullBool    = reflect.TypeOf(sql.NullBool{})
+	scanTypeTime        = reflect.TypeOf(time.Time{})
+	scanTypeNullTime    = reflect.TypeOf(sql.NullTime{})
+	scanTypeBytes       = reflect.TypeOf([]byte(nil))
+	scanTypeUnknown     = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+func scanType(m *types.ColumnMeta) reflect.Type {
+	switch m.Kind {
+	case types.ColumnKindInteger:
+		if m.Nullable {
+			return scanTypeNullInt64
+		}
+		return scanTypeInt64
+	case types.ColumnKindFloat:
+		if m.Nullable {
+			return scanTypeNullFloat64
+		}
+		return scanTypeFloat64
+	case types.ColumnKindText, types.ColumnKindDecimal:
+		if m.Nullable {
+			return scanTypeNullString
+		}
+		return scanTypeString
+	case types.ColumnKindBool:
+		if m.Nullable {
+			return scanTypeNullBool
+		}
+		return scanTypeBool
+	case types.ColumnKindDatetime:
+		if m.Nullable {
+			return scanTypeNullTime
+		}
+		return scanTypeTime
+	case types.ColumnKindBlob:
+		return scanTypeBytes
+	default:
+		return scanTypeUnknown
+	}
+}
+
+// normalizeValue converts the msgpack decoded value to one of the driver.Value types.
+func normalizeValue(v interface{}) driver.Value {
+	switch x := v.(type) {
+	case int:
+		return int64(x)
+	case int8:
+		return int64(x)
+	case int16:
+		return int64(x)
+	case int32:
+		return int64(x)
+	case uint:
+		return int64(x)
+	case uint8:
+		return int64(x)
+	case uint16:
+		return int64(x)
+	case uint32:
+		return int64(x)
+	case uint64:
+		return int64(x)
+	case float32:
+		return float64(x)
+	default:
+		return v
+	}
+}
+
+func parseTimestamp(s string) (t time.Time, ok bool) {
+	s = strings.TrimSuffix(strings.TrimSpace(s), "Z")
+	for _, f := range timestampFormats {
+		var err error
+		if t, err = time.ParseInLocation(f, s, time.UTC); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return
+}
+
+// convertValue converts the value in response row to the deterministic driver.Value type of
+// the column kind: integers to int64, floats to float64, text and decimals to string, blobs to
+// []byte, booleans to bool and datetimes to time.Time in UTC. Values which can't be converted
+// are returned as is.
+func convertValue(m *types.ColumnMeta, v interface{}) driver.Value {
+	var value = normalizeValue(v)
+	if value == nil {
+		return nil
+	}
+
+	switch m.Kind {
+	case types.ColumnKindInteger, types.ColumnKindFloat, types.ColumnKindText:
+		if b, ok := value.([]byte); ok {
+			return string(b)
+		}
+		if i, ok := value.(int64); ok && m.Kind == types.ColumnKindFloat {
+			return float64(i)
+		}
+	case types.ColumnKindBlob:
+		if s, ok := value.(string); ok {
+			return []byte(s)
+		}
+	case types.ColumnKindBool:
+		switch x := value.(type) {
+		case int64:
+			return x != 0
+		case float64:
+			return x != 0
+		case []byte:
+			if b, err := strconv.ParseBool(string(x)); err == nil {
+				return b
+			}
+			return string(x)
+		case string:
+			if b, err := strconv.ParseBool(x); err == nil {
+				return b
+			}
+		}
+	case types.ColumnKindDatetime:
+		switch x := value.(type) {
+		case time.Time:
+			return x.UTC()
+		case int64:
+			return time.Unix(x, 0).UTC()
+		case []byte:
+			if t, ok := parseTimestamp(string(x)); ok {
+				return t
+			}
+			return string(x)
+		case string:
+			if t, ok := parseTimestamp(x); ok {
+				return t
+			}
+		}
+	case types.ColumnKindDecimal:
+		switch x := value.(type) {
+		case int64:
+			if m.Scale > 0 {
+				return strconv.FormatInt(x, 10) + "." + strings.Repeat("0", int(m.Scale))
+			}
+			return strconv.FormatInt(x, 10)
+		case float64:
+			if m.Scale > 0 {
+				return strconv.FormatFloat(x, 'f', int(m.Scale), 64)
+			}
+			return strconv.FormatFloat(x, 'f', -1, 64)
+		case []byte:
+			return string(x)
+		}
+	}
+	return value
+}
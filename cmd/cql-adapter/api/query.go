@@ -21,7 +21,9 @@ import (
 	"net/http"
 
 	"github.com/CovenantSQL/CovenantSQL/cmd/cql-adapter/config"
+	"github.com/CovenantSQL/CovenantSQL/cmd/cql-adapter/storage"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/CovenantSQL/CovenantSQL/xenomint/dialect"
 )
 
 func init() {
@@ -30,6 +32,7 @@ func init() {
 	// add routes
 	GetV1Router().HandleFunc("/query", api.Query).Methods("GET", "POST")
 	GetV1Router().HandleFunc("/exec", api.Write).Methods("GET", "POST")
+	GetV1Router().HandleFunc("/tx", api.Tx).Methods("POST")
 }
 
 // queryAPI defines query features such as database update/select.
@@ -37,117 +40,169 @@ type queryAPI struct{}
 
 // Query defines read query for database.
 func (a *queryAPI) Query(rw http.ResponseWriter, r *http.Request) {
-	query := buildQuery(rw, r)
-	if query == "" {
+	q, args := buildQuery(rw, r)
+	if q == nil {
 		return
 	}
 
-	dbID := getDatabaseID(rw, r)
+	dbID := getRequestDatabaseID(q.Database, rw, r)
 	if dbID == "" {
 		return
 	}
 
-	log.WithField("db", dbID).WithField("query", query).Info("got query")
-
-	assoc := r.FormValue("assoc")
+	log.WithField("db", dbID).WithField("query", q.Query).Info("got query")
 
 	var columns []string
 	var types []string
 	var rows [][]interface{}
 	var err error
-	if columns, types, rows, err = config.GetConfig().StorageInstance.Query(dbID, query); err != nil {
+	if columns, types, rows, err = config.GetConfig().StorageInstance.Query(dbID, q.Query, args...); err != nil {
 		sendResponse(http.StatusInternalServerError, false, err, nil, rw)
 		return
 	}
 
-	// assign names to empty columns
-	for i, c := range columns {
-		if c == "" {
-			columns[i] = fmt.Sprintf("_c%d", i)
-		}
-	}
-
-	if assoc == "" {
-		sendResponse(http.StatusOK, true, nil, map[string]interface{}{
-			"types":   types,
-			"columns": columns,
-			"rows":    rows,
-		}, rw)
-	} else {
-		// combine columns
-		assocRows := make([]map[string]interface{}, 0, len(rows))
-
-		for _, row := range rows {
-			assocRow := make(map[string]interface{}, len(row))
-
-			for i, v := range row {
-				if i >= len(columns) {
-					break
-				}
-				assocRow[columns[i]] = v
-			}
-
-			assocRows = append(assocRows, assocRow)
-		}
-
-		sendResponse(http.StatusOK, true, nil, map[string]interface{}{
-			"rows": assocRows,
-		}, rw)
-	}
+	sendResponse(http.StatusOK, true, nil, buildQueryResult(columns, types, rows, q.Assoc), rw)
 }
 
 // Exec defines write query for database.
 func (a *queryAPI) Write(rw http.ResponseWriter, r *http.Request) {
-	// check privilege
-	hasPrivilege := false
-	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
-		cert := r.TLS.PeerCertificates[0]
-
-		for _, privilegedCert := range config.GetConfig().WriteCertificates {
-			if cert.Equal(privilegedCert) {
-				hasPrivilege = true
-				break
-			}
-		}
-
-		if !hasPrivilege {
-			for _, privilegedCert := range config.GetConfig().AdminCertificates {
-				if cert.Equal(privilegedCert) {
-					hasPrivilege = true
-					break
-				}
-			}
-		}
-	}
-
 	// forbidden
-	if !hasPrivilege {
+	if !hasWritePrivilege(r) {
 		sendResponse(http.StatusForbidden, false, nil, nil, rw)
 		return
 	}
 
-	query := buildQuery(rw, r)
-	if query == "" {
+	q, args := buildQuery(rw, r)
+	if q == nil {
 		return
 	}
 
-	dbID := getDatabaseID(rw, r)
+	dbID := getRequestDatabaseID(q.Database, rw, r)
 	if dbID == "" {
 		return
 	}
 
-	log.WithField("db", dbID).WithField("query", query).Info("got exec")
+	log.WithField("db", dbID).WithField("query", q.Query).Info("got exec")
 
 	var err error
 	var affectedRows int64
 	var lastInsertID int64
-	if affectedRows, lastInsertID, err = config.GetConfig().StorageInstance.Exec(dbID, query); err != nil {
+	if affectedRows, lastInsertID, err = config.GetConfig().StorageInstance.Exec(dbID, q.Query, args...); err != nil {
+		sendResponse(http.StatusInternalServerError, false, err, nil, rw)
+		return
+	}
+
+	sendResponse(http.StatusOK, true, nil, buildExecResult(affectedRows, lastInsertID), rw)
+}
+
+// Tx defines transaction of ordered queries for database, the results are returned in order.
+func (a *queryAPI) Tx(rw http.ResponseWriter, r *http.Request) {
+	tx, queries := buildTx(rw, r)
+	if tx == nil {
+		return
+	}
+
+	// read only transaction is allowed without write privilege
+	for _, q := range queries {
+		if !dialect.IsReadOnly(q.Pattern) {
+			if !hasWritePrivilege(r) {
+				sendResponse(http.StatusForbidden, false, nil, nil, rw)
+				return
+			}
+			break
+		}
+	}
+
+	dbID := getRequestDatabaseID(tx.Database, rw, r)
+	if dbID == "" {
+		return
+	}
+
+	log.WithField("db", dbID).WithField("count", len(queries)).Info("got tx")
+
+	var err error
+	var txResults []*storage.TxResult
+	if txResults, err = config.GetConfig().StorageInstance.Tx(dbID, queries); err != nil {
 		sendResponse(http.StatusInternalServerError, false, err, nil, rw)
 		return
 	}
 
+	results := make([]map[string]interface{}, len(txResults))
+	for i, res := range txResults {
+		if res.Columns != nil {
+			results[i] = buildQueryResult(res.Columns, res.Types, res.Rows, tx.Assoc)
+		} else {
+			results[i] = buildExecResult(res.AffectedRows, res.LastInsertID)
+		}
+	}
+
 	sendResponse(http.StatusOK, true, nil, map[string]interface{}{
+		"results": results,
+	}, rw)
+}
+
+func hasWritePrivilege(r *http.Request) bool {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return false
+	}
+
+	cert := r.TLS.PeerCertificates[0]
+
+	for _, privilegedCert := range config.GetConfig().WriteCertificates {
+		if cert.Equal(privilegedCert) {
+			return true
+		}
+	}
+
+	for _, privilegedCert := range config.GetConfig().AdminCertificates {
+		if cert.Equal(privilegedCert) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func buildQueryResult(columns []string, types []string, rows [][]interface{}, assoc bool) map[string]interface{} {
+	// assign names to empty columns
+	for i, c := range columns {
+		if c == "" {
+			columns[i] = fmt.Sprintf("_c%d", i)
+		}
+	}
+
+	if !assoc {
+		return map[string]interface{}{
+			"types":   types,
+			"columns": columns,
+			"rows":    rows,
+		}
+	}
+
+	// combine columns
+	assocRows := make([]map[string]interface{}, 0, len(rows))
+
+	for _, row := range rows {
+		assocRow := make(map[string]interface{}, len(row))
+
+		for i, v := range row {
+			if i >= len(columns) {
+				break
+			}
+			assocRow[columns[i]] = v
+		}
+
+		assocRows = append(assocRows, assocRow)
+	}
+
+	return map[string]interface{}{
+		"rows": assocRows,
+	}
+}
+
+func buildExecResult(affectedRows int64, lastInsertID int64) map[string]interface{} {
+	return map[string]interface{}{
 		"last_insert_id": lastInsertID,
 		"affected_rows":  affectedRows,
-	}, rw)
+	}
 }
@@ -17,16 +17,38 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"mime"
 	"net/http"
 	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/pkg/errors"
 )
 
 var (
 	dbIDRegex = regexp.MustCompile("^[a-zA-Z0-9_\\.]+$")
 )
 
+// queryRequest defines the JSON body of query requests.
+type queryRequest struct {
+	Database string          `json:"database"`
+	Query    string          `json:"query"`
+	Args     json.RawMessage `json:"args"`
+	Assoc    bool            `json:"assoc"`
+}
+
+// txRequest defines the JSON body of transaction requests.
+type txRequest struct {
+	Database string          `json:"database"`
+	Queries  []*queryRequest `json:"queries"`
+	Assoc    bool            `json:"assoc"`
+}
+
 func getDatabaseID(rw http.ResponseWriter, r *http.Request) string {
 	// try form
 	if database := r.FormValue("database"); database != "" {
@@ -51,14 +73,150 @@ func validateDatabaseID(dbID string, rw http.ResponseWriter) string {
 	return dbID
 }
 
-func buildQuery(rw http.ResponseWriter, r *http.Request) string {
+// getRequestDatabaseID returns the database id in the JSON body, or the database id in form or
+// header if not provided.
+func getRequestDatabaseID(database string, rw http.ResponseWriter, r *http.Request) string {
+	if database != "" {
+		return validateDatabaseID(database, rw)
+	}
+
+	return getDatabaseID(rw, r)
+}
+
+// buildQuery returns the query of the JSON body or the form, the args of form are JSON encoded.
+func buildQuery(rw http.ResponseWriter, r *http.Request) (q *queryRequest, args []types.NamedArg) {
 	// TODO(xq262144), support partial query and big query using application/octet-stream content-type
-	if query := r.FormValue("query"); query != "" {
-		return query
+	if isJSONRequest(r) {
+		q = &queryRequest{}
+		if err := json.NewDecoder(r.Body).Decode(q); err != nil {
+			sendResponse(http.StatusBadRequest, false, "Invalid request body", nil, rw)
+			return nil, nil
+		}
+	} else {
+		q = &queryRequest{
+			Query: r.FormValue("query"),
+			Assoc: r.FormValue("assoc") != "",
+		}
+		if rawArgs := r.FormValue("args"); rawArgs != "" {
+			q.Args = json.RawMessage(rawArgs)
+		}
 	}
 
-	sendResponse(http.StatusBadRequest, false, "Missing query parameter", nil, rw)
-	return ""
+	if q.Query == "" {
+		sendResponse(http.StatusBadRequest, false, "Missing query parameter", nil, rw)
+		return nil, nil
+	}
+
+	var err error
+	if args, err = parseArgs(q.Args); err != nil {
+		sendResponse(http.StatusBadRequest, false, err, nil, rw)
+		return nil, nil
+	}
+
+	return
+}
+
+// buildTx returns the transaction of the JSON body with the args of each query.
+func buildTx(rw http.ResponseWriter, r *http.Request) (tx *txRequest, queries []types.Query) {
+	tx = &txRequest{}
+	if !isJSONRequest(r) || json.NewDecoder(r.Body).Decode(tx) != nil {
+		sendResponse(http.StatusBadRequest, false, "Invalid request body", nil, rw)
+		return nil, nil
+	}
+
+	if len(tx.Queries) == 0 {
+		sendResponse(http.StatusBadRequest, false, "Missing queries parameter", nil, rw)
+		return nil, nil
+	}
+
+	queries = make([]types.Query, len(tx.Queries))
+	for i, q := range tx.Queries {
+		if q == nil || q.Query == "" {
+			sendResponse(http.StatusBadRequest, false, fmt.Sprintf("Missing query #%d", i), nil, rw)
+			return nil, nil
+		}
+
+		var err error
+		queries[i].Pattern = q.Query
+		if queries[i].Args, err = parseArgs(q.Args); err != nil {
+			sendResponse(http.StatusBadRequest, false, errors.Wrapf(err, "query #%d", i), nil, rw)
+			return nil, nil
+		}
+	}
+
+	return
+}
+
+func isJSONRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// parseArgs converts the JSON array of positional arguments or the JSON object of named arguments
+// to query arguments. The names may be prefixed by the placeholder symbols :, @ or $.
+func parseArgs(rawArgs json.RawMessage) (args []types.NamedArg, err error) {
+	if len(bytes.TrimSpace(rawArgs)) == 0 {
+		return
+	}
+
+	var (
+		decoder = json.NewDecoder(bytes.NewReader(rawArgs))
+		v       interface{}
+	)
+	decoder.UseNumber()
+	if err = decoder.Decode(&v); err != nil {
+		err = errors.New("Invalid args parameter")
+		return
+	}
+
+	switch x := v.(type) {
+	case nil:
+	case []interface{}:
+		args = make([]types.NamedArg, len(x))
+		for i, value := range x {
+			if args[i].Value, err = parseArgValue(value); err != nil {
+				err = errors.Wrapf(err, "Invalid arg #%d", i)
+				return
+			}
+		}
+	case map[string]interface{}:
+		names := make([]string, 0, len(x))
+		for name := range x {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		args = make([]types.NamedArg, len(names))
+		for i, name := range names {
+			if args[i].Name = strings.TrimLeft(name, ":@$"); args[i].Name == "" {
+				err = errors.Errorf("Invalid arg name %#v", name)
+				return
+			}
+			if args[i].Value, err = parseArgValue(x[name]); err != nil {
+				err = errors.Wrapf(err, "Invalid arg %#v", name)
+				return
+			}
+		}
+	default:
+		err = errors.New("Invalid args parameter, should be an array or an object")
+	}
+
+	return
+}
+
+func parseArgValue(v interface{}) (value interface{}, err error) {
+	switch x := v.(type) {
+	case json.Number:
+		// keep integers as int64 for the integer columns
+		if value, err = x.Int64(); err != nil {
+			value, err = x.Float64()
+		}
+	case string, bool, nil:
+		value = x
+	default:
+		err = errors.New("unsupported value type")
+	}
+	return
 }
 
 func sendResponse(code int, success bool, msg interface{}, data interface{}, rw http.ResponseWriter) {
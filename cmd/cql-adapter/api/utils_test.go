@@ -0,0 +1,128 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseArgs(t *testing.T) {
+	Convey("The positional args should be parsed in order", t, func() {
+		args, err := parseArgs(json.RawMessage(`[1, 1.5, "a", true, null]`))
+		So(err, ShouldBeNil)
+		So(args, ShouldResemble, []types.NamedArg{
+			{Value: int64(1)},
+			{Value: 1.5},
+			{Value: "a"},
+			{Value: true},
+			{Value: nil},
+		})
+	})
+	Convey("The named args should be parsed with the placeholder symbols trimmed", t, func() {
+		args, err := parseArgs(json.RawMessage(`{":b": "x", "a": 2, "$c": false}`))
+		So(err, ShouldBeNil)
+		So(args, ShouldResemble, []types.NamedArg{
+			{Name: "c", Value: false},
+			{Name: "b", Value: "x"},
+			{Name: "a", Value: int64(2)},
+		})
+	})
+	Convey("The empty args should be parsed as no args", t, func() {
+		args, err := parseArgs(nil)
+		So(err, ShouldBeNil)
+		So(args, ShouldBeEmpty)
+		args, err = parseArgs(json.RawMessage(`null`))
+		So(err, ShouldBeNil)
+		So(args, ShouldBeEmpty)
+	})
+	Convey("The invalid args should be rejected", t, func() {
+		var err error
+		_, err = parseArgs(json.RawMessage(`[`))
+		So(err, ShouldNotBeNil)
+		_, err = parseArgs(json.RawMessage(`"a"`))
+		So(err, ShouldNotBeNil)
+		_, err = parseArgs(json.RawMessage(`[[1]]`))
+		So(err, ShouldNotBeNil)
+		_, err = parseArgs(json.RawMessage(`{":": 1}`))
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestBuildQuery(t *testing.T) {
+	Convey("The query should be built from the JSON body", t, func() {
+		rw := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/v1/query", strings.NewReader(
+			`{"database": "db", "query": "SELECT * FROM t WHERE id = ?", "args": [1], "assoc": true}`))
+		r.Header.Set("Content-Type", "application/json; charset=utf-8")
+		q, args := buildQuery(rw, r)
+		So(q, ShouldNotBeNil)
+		So(q.Database, ShouldEqual, "db")
+		So(q.Query, ShouldEqual, "SELECT * FROM t WHERE id = ?")
+		So(q.Assoc, ShouldBeTrue)
+		So(args, ShouldResemble, []types.NamedArg{{Value: int64(1)}})
+	})
+	Convey("The query should be built from the form with JSON encoded args", t, func() {
+		rw := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/v1/query", strings.NewReader(url.Values{
+			"query": {"SELECT * FROM t WHERE id = :id"},
+			"args":  {`{"id": 1}`},
+		}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		q, args := buildQuery(rw, r)
+		So(q, ShouldNotBeNil)
+		So(q.Assoc, ShouldBeFalse)
+		So(args, ShouldResemble, []types.NamedArg{{Name: "id", Value: int64(1)}})
+	})
+	Convey("The request with invalid args should be rejected", t, func() {
+		rw := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/v1/query", strings.NewReader(
+			`{"query": "SELECT ?", "args": [{}]}`))
+		r.Header.Set("Content-Type", "application/json")
+		q, _ := buildQuery(rw, r)
+		So(q, ShouldBeNil)
+		So(rw.Code, ShouldEqual, http.StatusBadRequest)
+	})
+	Convey("The transaction should be built from the JSON body", t, func() {
+		rw := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/v1/tx", strings.NewReader(`{"queries": [
+			{"query": "INSERT INTO t VALUES (?)", "args": [1]},
+			{"query": "SELECT * FROM t"}
+		]}`))
+		r.Header.Set("Content-Type", "application/json")
+		tx, queries := buildTx(rw, r)
+		So(tx, ShouldNotBeNil)
+		So(queries, ShouldResemble, []types.Query{
+			{Pattern: "INSERT INTO t VALUES (?)", Args: []types.NamedArg{{Value: int64(1)}}},
+			{Pattern: "SELECT * FROM t"},
+		})
+
+		rw = httptest.NewRecorder()
+		r = httptest.NewRequest("POST", "/v1/tx", strings.NewReader(`{"queries": [{"query": ""}]}`))
+		r.Header.Set("Content-Type", "application/json")
+		tx, _ = buildTx(rw, r)
+		So(tx, ShouldBeNil)
+		So(rw.Code, ShouldEqual, http.StatusBadRequest)
+	})
+}
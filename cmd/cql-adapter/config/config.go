@@ -24,11 +24,13 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/client"
 	"github.com/CovenantSQL/CovenantSQL/cmd/cql-adapter/storage"
 	"github.com/CovenantSQL/CovenantSQL/conf"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
 )
 
@@ -62,6 +64,11 @@ type Config struct {
 	StorageDriver   string          `yaml:"StorageDriver"` // sqlite3 or covenantsql
 	StorageRoot     string          `yaml:"StorageRoot"`
 	StorageInstance storage.Storage `yaml:"-"`
+
+	// database creation config of covenantsql storage
+	AdvancePayment uint64        `yaml:"AdvancePayment"`
+	GasPrice       uint64        `yaml:"GasPrice"`
+	CreateTimeout  time.Duration `yaml:"CreateTimeout"`
 }
 
 type confWrapper struct {
@@ -166,7 +173,19 @@ func LoadConfig(configPath string, password string) (config *Config, err error)
 	// load storage
 	switch config.StorageDriver {
 	case "covenantsql":
-		config.StorageInstance = storage.NewCovenantSQLStorage()
+		// the advance payment is charged on database creation, which should be set explicitly
+		if config.AdvancePayment == 0 {
+			err = errors.Wrap(ErrInvalidStorageConfig, "advance payment is required")
+			return
+		}
+		if config.GasPrice == 0 {
+			config.GasPrice = client.DefaultGasPrice
+		}
+		if config.CreateTimeout == 0 {
+			config.CreateTimeout = client.CreationTimeout
+		}
+		config.StorageInstance = storage.NewCovenantSQLStorage(
+			config.GasPrice, config.AdvancePayment, config.CreateTimeout)
 	case "sqlite3":
 		storageRoot := filepath.Join(workingRoot, config.StorageRoot)
 		if config.StorageInstance, err = storage.NewSQLite3Storage(storageRoot); err != nil {
@@ -18,23 +18,37 @@ package storage
 
 import (
 	"database/sql"
+	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/client"
+	"github.com/CovenantSQL/CovenantSQL/types"
 )
 
 // CovenantSQLStorage defines the covenantsql database abstraction.
-type CovenantSQLStorage struct{}
+type CovenantSQLStorage struct {
+	gasPrice       uint64
+	advancePayment uint64
+	createTimeout  time.Duration
+}
 
-// NewCovenantSQLStorage returns new covenantsql storage handler.
-func NewCovenantSQLStorage() (s *CovenantSQLStorage) {
-	s = &CovenantSQLStorage{}
+// NewCovenantSQLStorage returns new covenantsql storage handler, the databases are created on
+// chain with the gas price and advance payment, and waited until deployed or the timeout.
+func NewCovenantSQLStorage(
+	gasPrice, advancePayment uint64, createTimeout time.Duration) (s *CovenantSQLStorage,
+) {
+	s = &CovenantSQLStorage{
+		gasPrice:       gasPrice,
+		advancePayment: advancePayment,
+		createTimeout:  createTimeout,
+	}
 	return
 }
 
 // Create implements the Storage abstraction interface.
 func (s *CovenantSQLStorage) Create(nodeCnt int) (dbID string, err error) {
 	var dsn string
-	if dsn, err = client.Create(client.ResourceMeta{Node: uint16(nodeCnt)}); err != nil {
+	if dsn, err = client.CreateAndWait(client.ResourceMeta{Node: uint16(nodeCnt)},
+		s.gasPrice, s.advancePayment, s.createTimeout); err != nil {
 		return
 	}
 
@@ -56,7 +70,7 @@ func (s *CovenantSQLStorage) Drop(dbID string) (err error) {
 }
 
 // Query implements the Storage abstraction interface.
-func (s *CovenantSQLStorage) Query(dbID string, query string) (columns []string, types []string, result [][]interface{}, err error) {
+func (s *CovenantSQLStorage) Query(dbID string, query string, args ...types.NamedArg) (columns []string, types []string, result [][]interface{}, err error) {
 	var conn *sql.DB
 	if conn, err = s.getConn(dbID); err != nil {
 		return
@@ -64,49 +78,58 @@ func (s *CovenantSQLStorage) Query(dbID string, query string) (columns []string,
 	defer conn.Close()
 
 	var rows *sql.Rows
-	if rows, err = conn.Query(query); err != nil {
+	if rows, err = conn.Query(query, convertArgs(args)...); err != nil {
 		return
 	}
 	defer rows.Close()
 
-	if columns, err = rows.Columns(); err != nil {
+	if columns, types, err = readColumns(rows); err != nil {
 		return
 	}
 
-	var colTypes []*sql.ColumnType
+	result, err = readAllRows(rows)
+	return
+}
 
-	if colTypes, err = rows.ColumnTypes(); err != nil {
+// Exec implements the Storage abstraction interface.
+func (s *CovenantSQLStorage) Exec(dbID string, query string, args ...types.NamedArg) (affectedRows int64, lastInsertID int64, err error) {
+	var conn *sql.DB
+	if conn, err = s.getConn(dbID); err != nil {
 		return
 	}
+	defer conn.Close()
 
-	types = make([]string, len(colTypes))
+	var result sql.Result
+	result, err = conn.Exec(query, convertArgs(args)...)
 
-	for i, c := range colTypes {
-		if c != nil {
-			types[i] = c.DatabaseTypeName()
-		}
+	if err == nil {
+		affectedRows, _ = result.RowsAffected()
+		lastInsertID, _ = result.LastInsertId()
 	}
 
-	result, err = readAllRows(rows)
 	return
 }
 
-// Exec implements the Storage abstraction interface.
-func (s *CovenantSQLStorage) Exec(dbID string, query string) (affectedRows int64, lastInsertID int64, err error) {
+// Tx implements the Storage abstraction interface.
+func (s *CovenantSQLStorage) Tx(dbID string, queries []types.Query) (results []*TxResult, err error) {
 	var conn *sql.DB
 	if conn, err = s.getConn(dbID); err != nil {
 		return
 	}
 	defer conn.Close()
 
-	var result sql.Result
-	result, err = conn.Exec(query)
+	// the writes are executed in an interactive transaction on the leader, and committed together
+	var tx *sql.Tx
+	if tx, err = conn.Begin(); err != nil {
+		return
+	}
 
-	if err == nil {
-		affectedRows, _ = result.RowsAffected()
-		lastInsertID, _ = result.LastInsertId()
+	if results, err = executeTx(tx, queries); err != nil {
+		tx.Rollback()
+		return
 	}
 
+	err = tx.Commit()
 	return
 }
 
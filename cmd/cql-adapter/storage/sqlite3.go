@@ -24,6 +24,8 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+
+	"github.com/CovenantSQL/CovenantSQL/types"
 	// Import sqlite3 manually.
 	_ "github.com/CovenantSQL/go-sqlite3-encrypt"
 )
@@ -73,7 +75,7 @@ func (s *SQLite3Storage) Drop(dbID string) (err error) {
 }
 
 // Query implements the Storage abstraction interface.
-func (s *SQLite3Storage) Query(dbID string, query string) (columns []string, types []string, result [][]interface{}, err error) {
+func (s *SQLite3Storage) Query(dbID string, query string, args ...types.NamedArg) (columns []string, types []string, result [][]interface{}, err error) {
 	var conn *sql.DB
 	if conn, err = s.getConn(dbID, true); err != nil {
 		return
@@ -87,47 +89,57 @@ func (s *SQLite3Storage) Query(dbID string, query string) (columns []string, typ
 	defer tx.Rollback()
 
 	var rows *sql.Rows
-	if rows, err = tx.Query(query); err != nil {
+	if rows, err = tx.Query(query, convertArgs(args)...); err != nil {
 		return
 	}
 	defer rows.Close()
 
-	if columns, err = rows.Columns(); err != nil {
+	if columns, types, err = readColumns(rows); err != nil {
 		return
 	}
 
-	var colTypes []*sql.ColumnType
+	result, err = readAllRows(rows)
+	return
+}
 
-	if colTypes, err = rows.ColumnTypes(); err != nil {
+// Exec implements the Storage abstraction interface.
+func (s *SQLite3Storage) Exec(dbID string, query string, args ...types.NamedArg) (affectedRows int64, lastInsertID int64, err error) {
+	var conn *sql.DB
+	if conn, err = s.getConn(dbID, false); err != nil {
 		return
 	}
+	defer conn.Close()
 
-	types = make([]string, len(colTypes))
-
-	for i, c := range colTypes {
-		if c != nil {
-			types[i] = c.DatabaseTypeName()
-		}
+	var result sql.Result
+	if result, err = conn.Exec(query, convertArgs(args)...); err != nil {
+		return
 	}
 
-	result, err = readAllRows(rows)
+	affectedRows, _ = result.RowsAffected()
+	lastInsertID, _ = result.LastInsertId()
+
 	return
 }
 
-// Exec implements the Storage abstraction interface.
-func (s *SQLite3Storage) Exec(dbID string, query string) (affectedRows int64, lastInsertID int64, err error) {
+// Tx implements the Storage abstraction interface.
+func (s *SQLite3Storage) Tx(dbID string, queries []types.Query) (results []*TxResult, err error) {
 	var conn *sql.DB
 	if conn, err = s.getConn(dbID, false); err != nil {
 		return
 	}
 	defer conn.Close()
 
-	var result sql.Result
-	result, err = conn.Exec(query)
+	var tx *sql.Tx
+	if tx, err = conn.Begin(); err != nil {
+		return
+	}
 
-	affectedRows, _ = result.RowsAffected()
-	lastInsertID, _ = result.LastInsertId()
+	if results, err = executeTx(tx, queries); err != nil {
+		tx.Rollback()
+		return
+	}
 
+	err = tx.Commit()
 	return
 }
 
@@ -0,0 +1,84 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSQLite3Storage(t *testing.T) {
+	Convey("Given a sqlite3 storage with a table", t, func() {
+		var (
+			tmp  string
+			s    *SQLite3Storage
+			dbID string
+			err  error
+		)
+		tmp, err = ioutil.TempDir("", "covenantsql")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			err = os.RemoveAll(tmp)
+			So(err, ShouldBeNil)
+		})
+		s, err = NewSQLite3Storage(tmp)
+		So(err, ShouldBeNil)
+		dbID, err = s.Create(1)
+		So(err, ShouldBeNil)
+		_, _, err = s.Exec(dbID, "CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT)")
+		So(err, ShouldBeNil)
+
+		Convey("The queries should bind the positional and named args", func() {
+			_, lastInsertID, err := s.Exec(dbID, "INSERT INTO t (name) VALUES (?)",
+				types.NamedArg{Value: "a"})
+			So(err, ShouldBeNil)
+			So(lastInsertID, ShouldEqual, 1)
+			_, _, rows, err := s.Query(dbID, "SELECT name FROM t WHERE id = :id",
+				types.NamedArg{Name: "id", Value: int64(1)})
+			So(err, ShouldBeNil)
+			So(rows, ShouldResemble, [][]interface{}{{"a"}})
+		})
+		Convey("The transaction should return the results in order", func() {
+			results, err := s.Tx(dbID, []types.Query{
+				{Pattern: "INSERT INTO t (name) VALUES (?)", Args: []types.NamedArg{{Value: "a"}}},
+				{Pattern: "INSERT INTO t (name) VALUES (:name)", Args: []types.NamedArg{{Name: "name", Value: "b"}}},
+				{Pattern: "SELECT id, name FROM t ORDER BY id"},
+			})
+			So(err, ShouldBeNil)
+			So(results, ShouldHaveLength, 3)
+			So(results[0].Columns, ShouldBeNil)
+			So(results[0].AffectedRows, ShouldEqual, 1)
+			So(results[1].LastInsertID, ShouldEqual, 2)
+			So(results[2].Columns, ShouldResemble, []string{"id", "name"})
+			So(results[2].Rows, ShouldResemble, [][]interface{}{{int64(1), "a"}, {int64(2), "b"}})
+		})
+		Convey("The transaction should be rolled back on failure", func() {
+			_, err = s.Tx(dbID, []types.Query{
+				{Pattern: "INSERT INTO t (name) VALUES ('a')"},
+				{Pattern: "INSERT INTO t (id) VALUES ('x', 'y')"},
+			})
+			So(err, ShouldNotBeNil)
+			_, _, rows, err := s.Query(dbID, "SELECT count(1) FROM t")
+			So(err, ShouldBeNil)
+			So(rows, ShouldResemble, [][]interface{}{{int64(0)}})
+		})
+	})
+}
@@ -19,8 +19,22 @@ package storage
 import (
 	"database/sql"
 	"io"
+
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/xenomint/dialect"
+	"github.com/pkg/errors"
 )
 
+// TxResult defines the result of a statement executed in transaction, the columns are nil for the
+// write statements.
+type TxResult struct {
+	Columns      []string
+	Types        []string
+	Rows         [][]interface{}
+	AffectedRows int64
+	LastInsertID int64
+}
+
 // Storage defines the storage abstraction layer interface.
 type Storage interface {
 	// Create operation.
@@ -28,9 +42,92 @@ type Storage interface {
 	// Drop operation.
 	Drop(dbID string) (err error)
 	// Query for result.
-	Query(dbID string, query string) (columns []string, types []string, rows [][]interface{}, err error)
+	Query(dbID string, query string, args ...types.NamedArg) (columns []string, types []string, rows [][]interface{}, err error)
 	// Exec for update.
-	Exec(dbID string, query string) (affectedRows int64, lastInsertID int64, err error)
+	Exec(dbID string, query string, args ...types.NamedArg) (affectedRows int64, lastInsertID int64, err error)
+	// Tx executes the queries in order in a transaction, all the queries are rolled back on any failure.
+	Tx(dbID string, queries []types.Query) (results []*TxResult, err error)
+}
+
+// txExecutor defines the common methods of sql.Tx used by executeTx.
+type txExecutor interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// convertArgs converts the named arguments to database/sql arguments, the arguments without name
+// are positional.
+func convertArgs(args []types.NamedArg) (converted []interface{}) {
+	converted = make([]interface{}, len(args))
+	for i, arg := range args {
+		if arg.Name == "" {
+			converted[i] = arg.Value
+		} else {
+			converted[i] = sql.Named(arg.Name, arg.Value)
+		}
+	}
+	return
+}
+
+// readColumns returns the column names and types of the rows.
+func readColumns(rows *sql.Rows) (columns []string, types []string, err error) {
+	if columns, err = rows.Columns(); err != nil {
+		return
+	}
+
+	var colTypes []*sql.ColumnType
+
+	if colTypes, err = rows.ColumnTypes(); err != nil {
+		return
+	}
+
+	types = make([]string, len(colTypes))
+
+	for i, c := range colTypes {
+		if c != nil {
+			types[i] = c.DatabaseTypeName()
+		}
+	}
+
+	return
+}
+
+// executeTx executes the queries in order, the read queries return rows while the others return
+// the affected rows.
+func executeTx(tx txExecutor, queries []types.Query) (results []*TxResult, err error) {
+	results = make([]*TxResult, 0, len(queries))
+
+	for i, q := range queries {
+		r := &TxResult{}
+
+		if dialect.IsReadOnly(q.Pattern) {
+			var rows *sql.Rows
+			if rows, err = tx.Query(q.Pattern, convertArgs(q.Args)...); err != nil {
+				err = errors.Wrapf(err, "query #%d failed", i)
+				return
+			}
+			if r.Columns, r.Types, err = readColumns(rows); err == nil {
+				r.Rows, err = readAllRows(rows)
+			}
+			rows.Close()
+			if err != nil {
+				err = errors.Wrapf(err, "read rows of query #%d failed", i)
+				return
+			}
+		} else {
+			var result sql.Result
+			if result, err = tx.Exec(q.Pattern, convertArgs(q.Args)...); err != nil {
+				err = errors.Wrapf(err, "query #%d failed", i)
+				return
+			}
+			r.AffectedRows, _ = result.RowsAffected()
+			r.LastInsertID, _ = result.LastInsertId()
+		}
+
+		results = append(results, r)
+	}
+
+	return
 }
 
 // golang does trick convert, use rowScanner to return the original result type in sqlite3 driver
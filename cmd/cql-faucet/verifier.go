@@ -34,6 +34,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/types"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 	"github.com/CovenantSQL/xurls"
 	"github.com/dyatlov/go-opengraph/opengraph"
@@ -223,8 +224,8 @@ func (v *Verifier) dispenseOne(r *applicationRecord) (err error) {
 	}
 
 	// allocate nonce
-	nonceReq := &bp.NextAccountNonceReq{}
-	nonceResp := &bp.NextAccountNonceResp{}
+	nonceReq := &types.NextAccountNonceReq{}
+	nonceResp := &types.NextAccountNonceResp{}
 	nonceReq.Addr = v.vaultAddress
 
 	if err = requestBP(route.MCCNextAccountNonce.String(), nonceReq, nonceResp); err != nil {
@@ -258,8 +259,8 @@ func (v *Verifier) dispenseOne(r *applicationRecord) (err error) {
 		return
 	}
 
-	req := &bp.AddTxReq{}
-	resp := &bp.AddTxResp{}
+	req := &types.AddTxReq{}
+	resp := &types.AddTxResp{}
 	req.Tx = pt.NewTransfer(
 		&pt.TransferHeader{
 			Sender:   v.vaultAddress,
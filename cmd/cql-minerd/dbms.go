@@ -48,6 +48,8 @@ func startDBMS(server *rpc.Server) (dbms *worker.DBMS, err error) {
 		RootDir:       conf.GConf.Miner.RootDir,
 		Server:        server,
 		MaxReqTimeGap: conf.GConf.Miner.MaxReqTimeGap,
+		AllowMemoryEngine: conf.GConf.Miner.IsTestMode ||
+			conf.GConf.Miner.AllowMemoryStorageEngine,
 	}
 
 	if dbms, err = worker.NewDBMS(cfg); err != nil {
@@ -0,0 +1,293 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync/atomic"
+
+	"github.com/CovenantSQL/CovenantSQL/cmd/internal/adapteruser"
+	"github.com/pkg/errors"
+	my "github.com/siddontang/go-mysql/mysql"
+)
+
+// serverCapability is the capability of the mysql server, which is the same as the one of the
+// vendored mysql server.
+const serverCapability = my.CLIENT_LONG_PASSWORD | my.CLIENT_LONG_FLAG |
+	my.CLIENT_CONNECT_WITH_DB | my.CLIENT_PROTOCOL_41 |
+	my.CLIENT_TRANSACTIONS | my.CLIENT_SECURE_CONNECTION
+
+var (
+	errInvalidHandshake = errors.New("invalid handshake packet")
+
+	baseConnID uint32
+)
+
+// handshakeResponse defines the parsed handshake response packet of the client.
+type handshakeResponse struct {
+	capability uint32
+	user       string
+	// authPos and authLen locate the auth data in the packet payload.
+	authPos int
+	authLen int
+}
+
+// authConn is the client connection authenticated by the adapter. The vendored mysql server only
+// accepts one user with a known password per connection, so the adapter runs the handshake with
+// the client to find the user first. Then the connection is served by the mysql server, which
+// receives the replayed handshake response with the auth data recalculated by its own salt.
+type authConn struct {
+	net.Conn
+	user *adapteruser.User
+	// response is the handshake response payload of the client.
+	response []byte
+	resp     *handshakeResponse
+	// greeting collects the initial handshake packet written by the mysql server.
+	greeting []byte
+	// replay is the rest of the handshake response packet to be read by the mysql server.
+	replay   []byte
+	replayed bool
+}
+
+// authenticate runs the handshake with the client on conn and authenticates the user, the error
+// is sent to the client on failure.
+func authenticate(conn net.Conn, users map[string]*adapteruser.User) (c *authConn, err error) {
+	var (
+		salt    []byte
+		seq     uint8
+		payload []byte
+		resp    *handshakeResponse
+		connID  = atomic.AddUint32(&baseConnID, 1)
+	)
+	if salt, err = my.RandomBuf(20); err != nil {
+		return
+	}
+	if err = writePacket(conn, 0, buildInitialHandshake(connID, salt)); err != nil {
+		return
+	}
+	if seq, payload, err = readPacket(conn); err != nil {
+		return
+	}
+	if seq != 1 {
+		err = errors.Wrapf(errInvalidHandshake, "invalid sequence %d", seq)
+		return
+	}
+	if resp, err = parseHandshakeResponse(payload); err != nil {
+		return
+	}
+
+	var (
+		u, ok = users[resp.user]
+		auth  = payload[resp.authPos : resp.authPos+resp.authLen]
+		myErr *my.MyError
+	)
+	if !ok {
+		myErr = my.NewDefaultError(my.ER_NO_SUCH_USER, resp.user, conn.RemoteAddr().String())
+	} else if !bytes.Equal(auth, my.CalcPassword(salt, []byte(u.Password))) {
+		myErr = my.NewDefaultError(
+			my.ER_ACCESS_DENIED_ERROR, resp.user, conn.RemoteAddr().String(), "Yes")
+	}
+	if myErr != nil {
+		writeError(conn, seq+1, resp.capability, myErr)
+		err = myErr
+		return
+	}
+
+	c = &authConn{
+		Conn:     conn,
+		user:     u,
+		response: payload,
+		resp:     resp,
+	}
+	return
+}
+
+// Write implements net.Conn.Write, the initial handshake packet written by the mysql server is
+// not sent to the client, the salt of the mysql server is taken from it instead.
+func (c *authConn) Write(b []byte) (n int, err error) {
+	if c.replay != nil || c.replayed {
+		return c.Conn.Write(b)
+	}
+	c.greeting = append(c.greeting, b...)
+	if len(c.greeting) < 4 {
+		return len(b), nil
+	}
+	length := int(uint32(c.greeting[0]) | uint32(c.greeting[1])<<8 | uint32(c.greeting[2])<<16)
+	if len(c.greeting) < 4+length {
+		return len(b), nil
+	}
+	if len(c.greeting) > 4+length {
+		return 0, errors.Wrap(errInvalidHandshake, "unexpected data after initial handshake")
+	}
+
+	var salt []byte
+	if salt, err = parseInitialHandshakeSalt(c.greeting[4:]); err != nil {
+		return
+	}
+	var (
+		payload = append([]byte(nil), c.response...)
+		auth    = my.CalcPassword(salt, []byte(c.user.Password))
+	)
+	if len(auth) != c.resp.authLen {
+		return 0, errors.Wrap(errInvalidHandshake, "auth data length mismatched")
+	}
+	copy(payload[c.resp.authPos:], auth)
+	c.replay = make([]byte, 4, 4+len(payload))
+	putPacketHeader(c.replay, len(payload), 1)
+	c.replay = append(c.replay, payload...)
+	return len(b), nil
+}
+
+// Read implements net.Conn.Read, the handshake response is replayed to the mysql server first.
+func (c *authConn) Read(b []byte) (n int, err error) {
+	if c.replayed {
+		return c.Conn.Read(b)
+	}
+	if c.replay == nil {
+		return 0, errors.Wrap(errInvalidHandshake, "read before initial handshake")
+	}
+	n = copy(b, c.replay)
+	if c.replay = c.replay[n:]; len(c.replay) == 0 {
+		c.replay, c.replayed = nil, true
+	}
+	return
+}
+
+func buildInitialHandshake(connID uint32, salt []byte) (data []byte) {
+	var capability uint32 = serverCapability
+	data = make([]byte, 0, 128)
+	data = append(data, 10)
+	data = append(data, my.ServerVersion...)
+	data = append(data, 0)
+	data = append(data, byte(connID), byte(connID>>8), byte(connID>>16), byte(connID>>24))
+	data = append(data, salt[0:8]...)
+	data = append(data, 0)
+	data = append(data, byte(capability), byte(capability>>8))
+	data = append(data, my.DEFAULT_COLLATION_ID)
+	// status
+	data = append(data, 0, 0)
+	data = append(data, byte(capability>>16), byte(capability>>24))
+	data = append(data, 0x15)
+	data = append(data, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)
+	data = append(data, salt[8:]...)
+	data = append(data, 0)
+	return
+}
+
+// parseInitialHandshakeSalt returns the salt of the initial handshake payload built like
+// buildInitialHandshake.
+func parseInitialHandshakeSalt(data []byte) (salt []byte, err error) {
+	var pos = bytes.IndexByte(data, 0)
+	// version, connection id, salt part 1 and filter
+	if pos < 0 || len(data) < pos+1+4+8+1+2+1+2+2+1+10+1 {
+		return nil, errors.Wrap(errInvalidHandshake, "initial handshake too short")
+	}
+	pos += 1 + 4
+	salt = append(salt, data[pos:pos+8]...)
+	pos += 8 + 1 + 2 + 1 + 2 + 2 + 1 + 10
+	end := bytes.IndexByte(data[pos:], 0)
+	if end < 0 {
+		return nil, errors.Wrap(errInvalidHandshake, "unterminated salt")
+	}
+	salt = append(salt, data[pos:pos+end]...)
+	return
+}
+
+// parseHandshakeResponse parses the handshake response payload like the vendored mysql server.
+func parseHandshakeResponse(data []byte) (r *handshakeResponse, err error) {
+	// capability, max packet size, charset and reserved
+	var pos = 4 + 4 + 1 + 23
+	if len(data) < pos {
+		return nil, errors.Wrap(errInvalidHandshake, "handshake response too short")
+	}
+	r = &handshakeResponse{capability: binary.LittleEndian.Uint32(data[:4])}
+
+	end := bytes.IndexByte(data[pos:], 0)
+	if end < 0 {
+		return nil, errors.Wrap(errInvalidHandshake, "unterminated user name")
+	}
+	r.user = string(data[pos : pos+end])
+	pos += end + 1
+
+	if r.capability&my.CLIENT_PLUGIN_AUTH_LENENC_CLIENT_DATA > 0 {
+		num, null, off := my.LengthEncodedInt(data[pos:])
+		pos += off
+		if !null {
+			r.authLen = int(num)
+		}
+	} else if r.capability&my.CLIENT_SECURE_CONNECTION > 0 {
+		if pos >= len(data) {
+			return nil, errors.Wrap(errInvalidHandshake, "missing auth data")
+		}
+		r.authLen = int(data[pos])
+		pos++
+	} else if r.authLen = bytes.IndexByte(data[pos:], 0); r.authLen < 0 {
+		return nil, errors.Wrap(errInvalidHandshake, "unterminated auth data")
+	}
+	if r.authLen < 0 || pos+r.authLen > len(data) {
+		return nil, errors.Wrap(errInvalidHandshake, "auth data out of range")
+	}
+	r.authPos = pos
+	return
+}
+
+func putPacketHeader(header []byte, length int, seq uint8) {
+	header[0] = byte(length)
+	header[1] = byte(length >> 8)
+	header[2] = byte(length >> 16)
+	header[3] = seq
+}
+
+func writePacket(conn net.Conn, seq uint8, payload []byte) (err error) {
+	var data = make([]byte, 4, 4+len(payload))
+	putPacketHeader(data, len(payload), seq)
+	_, err = conn.Write(append(data, payload...))
+	return
+}
+
+// readPacket reads a packet from conn without read-ahead, so that the rest data are still read
+// by the mysql server.
+func readPacket(conn net.Conn) (seq uint8, payload []byte, err error) {
+	var header [4]byte
+	if _, err = io.ReadFull(conn, header[:]); err != nil {
+		return
+	}
+	length := int(uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16)
+	if length < 1 || length >= my.MaxPayloadLen {
+		err = errors.Wrapf(errInvalidHandshake, "invalid payload length %d", length)
+		return
+	}
+	seq = header[3]
+	payload = make([]byte, length)
+	_, err = io.ReadFull(conn, payload)
+	return
+}
+
+func writeError(conn net.Conn, seq uint8, capability uint32, e *my.MyError) error {
+	var data = make([]byte, 0, 16+len(e.Message))
+	data = append(data, my.ERR_HEADER)
+	data = append(data, byte(e.Code), byte(e.Code>>8))
+	if capability&my.CLIENT_PROTOCOL_41 > 0 {
+		data = append(data, '#')
+		data = append(data, e.State...)
+	}
+	data = append(data, e.Message...)
+	return writePacket(conn, seq, data)
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/cmd/internal/adapteruser"
+	my "github.com/siddontang/go-mysql/mysql"
+	mys "github.com/siddontang/go-mysql/server"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// testHandshake runs the handshake of the mysql client with user and password, and returns the
+// reply packet of the handshake response.
+func testHandshake(client net.Conn, user, password string) (reply []byte, err error) {
+	var (
+		greeting, salt []byte
+		seq            uint8
+	)
+	if _, greeting, err = readPacket(client); err != nil {
+		return
+	}
+	if salt, err = parseInitialHandshakeSalt(greeting); err != nil {
+		return
+	}
+	var (
+		auth = my.CalcPassword(salt, []byte(password))
+		resp = make([]byte, 4+4+1+23)
+	)
+	binary.LittleEndian.PutUint32(resp, my.CLIENT_LONG_PASSWORD|my.CLIENT_PROTOCOL_41|
+		my.CLIENT_SECURE_CONNECTION)
+	resp = append(resp, user...)
+	resp = append(resp, 0, byte(len(auth)))
+	resp = append(resp, auth...)
+	if err = writePacket(client, 1, resp); err != nil {
+		return
+	}
+	if seq, reply, err = readPacket(client); err == nil && seq != 2 {
+		err = errInvalidHandshake
+	}
+	return
+}
+
+func TestAuthenticate(t *testing.T) {
+	Convey("Given a mysql adapter with users", t, func() {
+		var (
+			users = map[string]*adapteruser.User{
+				"alice": adapteruser.NewUser("alice", "alice-password"),
+				"bob":   adapteruser.NewUser("bob", ""),
+			}
+			client, server = net.Pipe()
+			errC           = make(chan error, 1)
+			connC          = make(chan *mys.Conn, 1)
+		)
+		defer client.Close()
+		defer server.Close()
+		go func() {
+			ac, err := authenticate(server, users)
+			if err != nil {
+				errC <- err
+				return
+			}
+			h, err := mys.NewConn(ac, ac.user.Name, ac.user.Password, NewCursor(nil, ac.user))
+			if err != nil {
+				errC <- err
+				return
+			}
+			connC <- h
+		}()
+
+		Convey("The user with password should be authenticated", func() {
+			reply, err := testHandshake(client, "alice", "alice-password")
+			So(err, ShouldBeNil)
+			So(reply[0], ShouldEqual, my.OK_HEADER)
+			h := <-connC
+			So(h.GetUser(), ShouldEqual, "alice")
+
+			// the commands are served by the mysql server after the handshake
+			go h.HandleCommand()
+			So(writePacket(client, 0, []byte{my.COM_PING}), ShouldBeNil)
+			seq, reply, err := readPacket(client)
+			So(err, ShouldBeNil)
+			So(seq, ShouldEqual, 1)
+			So(reply[0], ShouldEqual, my.OK_HEADER)
+		})
+		Convey("The user without password should be authenticated", func() {
+			reply, err := testHandshake(client, "bob", "")
+			So(err, ShouldBeNil)
+			So(reply[0], ShouldEqual, my.OK_HEADER)
+			So((<-connC).GetUser(), ShouldEqual, "bob")
+		})
+		Convey("The user with wrong password should be rejected", func() {
+			reply, err := testHandshake(client, "alice", "bob-password")
+			So(err, ShouldBeNil)
+			So(reply[0], ShouldEqual, my.ERR_HEADER)
+			So(binary.LittleEndian.Uint16(reply[1:]), ShouldEqual, my.ER_ACCESS_DENIED_ERROR)
+			So(<-errC, ShouldNotBeNil)
+		})
+		Convey("The unknown user should be rejected", func() {
+			reply, err := testHandshake(client, "carol", "")
+			So(err, ShouldBeNil)
+			So(reply[0], ShouldEqual, my.ERR_HEADER)
+			So(binary.LittleEndian.Uint16(reply[1:]), ShouldEqual, my.ER_NO_SUCH_USER)
+			So(<-errC, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestParseHandshakeResponse(t *testing.T) {
+	Convey("The invalid handshake responses should be rejected", t, func() {
+		_, err := parseHandshakeResponse(make([]byte, 10))
+		So(err, ShouldNotBeNil)
+		resp := make([]byte, 4+4+1+23)
+		binary.LittleEndian.PutUint32(resp, my.CLIENT_SECURE_CONNECTION)
+		_, err = parseHandshakeResponse(append(resp, "user"...))
+		So(err, ShouldNotBeNil)
+		_, err = parseHandshakeResponse(append(resp, "user\x00"...))
+		So(err, ShouldNotBeNil)
+		_, err = parseHandshakeResponse(append(resp, "user\x00\x14short"...))
+		So(err, ShouldNotBeNil)
+		r, err := parseHandshakeResponse(append(resp, "user\x00\x02ab"...))
+		So(err, ShouldBeNil)
+		So(r.user, ShouldEqual, "user")
+		So(r.authPos, ShouldEqual, len(resp)+6)
+		So(r.authLen, ShouldEqual, 2)
+	})
+}
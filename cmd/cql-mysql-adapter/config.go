@@ -0,0 +1,51 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+
+	"github.com/CovenantSQL/CovenantSQL/cmd/internal/adapteruser"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Config defines the mysql adapter settings.
+type Config struct {
+	Users []adapteruser.Config `yaml:"Users"`
+}
+
+type configWrapper struct {
+	MySQLAdapter *Config `yaml:"MySQLAdapter"`
+}
+
+func loadConfig(configPath string) (config *Config, err error) {
+	var (
+		content []byte
+		wrapper = &configWrapper{}
+	)
+	if content, err = ioutil.ReadFile(configPath); err != nil {
+		err = errors.Wrap(err, "read config file failed")
+		return
+	}
+	if err = yaml.Unmarshal(content, wrapper); err != nil {
+		err = errors.Wrap(err, "unmarshal config file failed")
+		return
+	}
+	config = wrapper.MySQLAdapter
+	return
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLoadConfig(t *testing.T) {
+	Convey("Given a working directory", t, func() {
+		var (
+			tmp, fl string
+			cfg     *Config
+			err     error
+		)
+		tmp, err = ioutil.TempDir("", "covenantsql")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			err = os.RemoveAll(tmp)
+			So(err, ShouldBeNil)
+		})
+		fl = filepath.Join(tmp, "config.yaml")
+
+		Convey("The loadConfig func should return a nil config without adapter section", func() {
+			err = ioutil.WriteFile(fl, []byte("IsTestMode: true\n"), 0644)
+			So(err, ShouldBeNil)
+			cfg, err = loadConfig(fl)
+			So(err, ShouldBeNil)
+			So(cfg, ShouldBeNil)
+		})
+		Convey("The users should be loaded from the adapter section", func() {
+			err = ioutil.WriteFile(fl, []byte(`MySQLAdapter:
+  Users:
+  - User: alice
+    Password: a
+    PrivateKeyFile: alice.key
+    MasterKey: pass
+    Databases:
+    - db1
+  - User: bob
+    Password: b
+`), 0644)
+			So(err, ShouldBeNil)
+			cfg, err = loadConfig(fl)
+			So(err, ShouldBeNil)
+			So(cfg, ShouldNotBeNil)
+			So(cfg.Users, ShouldHaveLength, 2)
+			So(cfg.Users[0].PrivateKeyFile, ShouldEqual, "alice.key")
+			So(cfg.Users[0].Databases, ShouldResemble, []string{"db1"})
+		})
+	})
+}
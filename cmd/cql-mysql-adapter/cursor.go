@@ -25,7 +25,9 @@ import (
 	"sync"
 
 	"github.com/CovenantSQL/CovenantSQL/client"
+	"github.com/CovenantSQL/CovenantSQL/cmd/internal/adapteruser"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/CovenantSQL/CovenantSQL/xenomint/dialect"
 	my "github.com/siddontang/go-mysql/mysql"
 )
 
@@ -37,7 +39,6 @@ var (
 	showVariablesQuery            = regexp.MustCompile("^(?i)\\s*(?:/\\*.*?\\*/)?\\s*SHOW\\s+VARIABLES.*$")
 	showDatabasesQuery            = regexp.MustCompile("^(?i)\\s*(?:/\\*.*?\\*/)?\\s*SHOW\\s+DATABASES.*$")
 	useDatabaseQuery              = regexp.MustCompile("^(?i)\\s*USE\\s+`?(\\w+)`?\\s*$")
-	readQuery                     = regexp.MustCompile("^(?i)\\s*(?:SELECT|SHOW|DESC)")
 	mysqlServerVariables          = map[string]interface{}{
 		"max_allowed_packet":       255 * 255 * 255,
 		"auto_increment_increment": 1,
@@ -54,14 +55,15 @@ var (
 // Cursor is a mysql connection handler, like a cursor of normal database.
 type Cursor struct {
 	server        *Server
+	user          *adapteruser.User
 	curDBLock     sync.Mutex
 	curDB         string
 	curDBInstance *sql.DB
 }
 
-// NewCursor returns a new cursor.
-func NewCursor(s *Server) (c *Cursor) {
-	return &Cursor{server: s}
+// NewCursor returns a new cursor of the authenticated user.
+func NewCursor(s *Server, user *adapteruser.User) (c *Cursor) {
+	return &Cursor{server: s, user: user}
 }
 
 func (c *Cursor) buildResultSet(rows *sql.Rows) (r *my.Result, err error) {
@@ -246,7 +248,7 @@ func (c *Cursor) handleSpecialQuery(query string) (r *my.Result, processed bool,
 		case "USER":
 			resultSet, _ = my.BuildSimpleTextResultset(
 				[]string{"USER()"},
-				[][]interface{}{{c.server.mysqlUser}},
+				[][]interface{}{{c.user.Name}},
 			)
 		}
 
@@ -273,15 +275,16 @@ func (c *Cursor) UseDB(dbName string) (err error) {
 		return my.NewError(my.ER_BAD_DB_ERROR, fmt.Sprintf("invalid database: %v", dbName))
 	}
 
-	// connect database
+	if !c.user.AllowDatabase(dbName) {
+		return my.NewError(my.ER_DBACCESS_DENIED_ERROR,
+			fmt.Sprintf("access denied for user %v to database %v", c.user.Name, dbName))
+	}
+
+	// connect database, the queries are signed by the account of the user
 	cfg := client.NewConfig()
 	cfg.DatabaseID = dbName
 
-	var db *sql.DB
-
-	if db, err = sql.Open("covenantsql", cfg.FormatDSN()); err != nil {
-		return
-	}
+	db := sql.OpenDB(client.NewConnector(cfg, c.user.PrivateKey))
 
 	c.curDB = dbName
 	c.curDBInstance = db
@@ -307,7 +310,7 @@ func (c *Cursor) HandleQuery(query string) (r *my.Result, err error) {
 	}
 
 	// as normal query
-	if readQuery.MatchString(query) {
+	if dialect.IsReadOnly(query) {
 		var rows *sql.Rows
 		if rows, err = conn.Query(query); err != nil {
 			err = my.NewError(my.ER_UNKNOWN_ERROR, err.Error())
@@ -407,20 +410,102 @@ func (c *Cursor) HandleFieldList(table string, fieldWildcard string) (fields []*
 // HandleStmtPrepare handle COM_STMT_PREPARE, params is the param number for this statement, columns is the column number
 // context will be used later for statement execute.
 func (c *Cursor) HandleStmtPrepare(query string) (params int, columns int, context interface{}, err error) {
-	// TODO(xq26144), not implemented
+	log.WithField("query", query).Info("received stmt prepare")
+
 	// According to the libmysql standard: https://github.com/mysql/mysql-server/blob/8.0/libmysql/libmysql.cc#L1599
-	// the COM_STMT_PREPARE should return the correct bind parameter count (which can be implemented by newly created parser)
-	// and should return the correct number of return fields (which can not be implemented right now with new query plan logic embedded)
+	// the COM_STMT_PREPARE should return the correct bind parameter count, the number of return fields
+	// is unknown until execution with query plan logic embedded, so the result set metadata is sent on execute.
+	stmt := &preparedStmt{
+		query:  query,
+		params: countParams(query),
+		read:   dialect.IsReadOnly(query),
+	}
+
+	params = stmt.params
+	context = stmt
 
-	err = my.NewError(my.ER_NOT_SUPPORTED_YET, "stmt prepare is not supported yet")
 	return
 }
 
 // HandleStmtExecute handle COM_STMT_EXECUTE, context is the previous one set in prepare
 // query is the statement prepare query, and args is the params for this statement.
-func (c *Cursor) HandleStmtExecute(context interface{}, query string, args []interface{}) (result *my.Result, err error) {
-	// same to COM_STMT_PREPARE
-	err = my.NewError(my.ER_NOT_SUPPORTED_YET, "stmt execute is not supported yet")
+func (c *Cursor) HandleStmtExecute(context interface{}, query string, args []interface{}) (r *my.Result, err error) {
+	stmt, ok := context.(*preparedStmt)
+	if !ok {
+		err = my.NewError(my.ER_UNKNOWN_STMT_HANDLER, "invalid statement context")
+		return
+	}
+
+	if stmt.params == 0 {
+		var processed bool
+		if r, processed, err = c.handleSpecialQuery(stmt.query); processed {
+			if err == nil && r != nil && r.Resultset != nil {
+				// special results are built in text protocol
+				r.Resultset, err = textToBinaryResultSet(r.Resultset)
+			}
+			return
+		}
+	}
+
+	var conn *sql.DB
+
+	if conn, err = c.ensureDatabase(); err != nil {
+		return
+	}
+
+	// arguments are sent parameterized to CovenantSQL
+	stmtArgs := convertStmtArgs(args)
+
+	if stmt.read {
+		var rows *sql.Rows
+		if rows, err = conn.Query(stmt.query, stmtArgs...); err != nil {
+			err = my.NewError(my.ER_UNKNOWN_ERROR, err.Error())
+			return
+		}
+		defer rows.Close()
+
+		var columns []string
+		if columns, err = rows.Columns(); err != nil {
+			err = my.NewError(my.ER_UNKNOWN_ERROR, err.Error())
+			return
+		}
+
+		var resultData [][]interface{}
+		if resultData, err = readAllRows(rows); err != nil {
+			err = my.NewError(my.ER_UNKNOWN_ERROR, err.Error())
+			return
+		}
+
+		var resultSet *my.Resultset
+		if resultSet, err = buildBinaryResultSet(columns, resultData); err != nil {
+			return
+		}
+
+		r = &my.Result{
+			Status:       0,
+			InsertId:     0,
+			AffectedRows: 0,
+			Resultset:    resultSet,
+		}
+		return
+	}
+
+	var result sql.Result
+	if result, err = conn.Exec(stmt.query, stmtArgs...); err != nil {
+		err = my.NewError(my.ER_UNKNOWN_ERROR, err.Error())
+		return
+	}
+
+	lastInsertID, _ := result.LastInsertId()
+	affectedRows, _ := result.RowsAffected()
+
+	r = &my.Result{
+		Status:       0,
+		InsertId:     uint64(lastInsertID),
+		AffectedRows: uint64(affectedRows),
+		Resultset:    nil,
+	}
+
 	return
 }
 
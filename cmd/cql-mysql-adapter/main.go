@@ -21,9 +21,11 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 
 	"github.com/CovenantSQL/CovenantSQL/client"
+	"github.com/CovenantSQL/CovenantSQL/cmd/internal/adapteruser"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 	"golang.org/x/sys/unix"
@@ -50,8 +52,10 @@ func init() {
 	flag.BoolVar(&showVersion, "version", false, "Show version information and exit")
 
 	flag.StringVar(&listenAddr, "listen", "127.0.0.1:4664", "listen address for mysql adapter")
-	flag.StringVar(&mysqlUser, "mysql-user", "root", "mysql user for adapter server")
-	flag.StringVar(&mysqlPassword, "mysql-password", "calvin", "mysql password for adapter server")
+	flag.StringVar(&mysqlUser, "mysql-user", "root",
+		"mysql user for adapter server, ignored if users are configured in config file")
+	flag.StringVar(&mysqlPassword, "mysql-password", "calvin",
+		"mysql password for adapter server, ignored if users are configured in config file")
 }
 
 func main() {
@@ -72,10 +76,29 @@ func main() {
 		return
 	}
 
+	// load users, the mysql user of the arguments acting as the adapter is used if not configured
+	cfg, err := loadConfig(configFile)
+	if err != nil {
+		log.WithError(err).Fatal("load config failed")
+		return
+	}
+
+	var users map[string]*adapteruser.User
+	if cfg != nil && len(cfg.Users) > 0 {
+		if users, err = adapteruser.Load(cfg.Users, filepath.Dir(configFile)); err != nil {
+			log.WithError(err).Fatal("load mysql users failed")
+			return
+		}
+	} else {
+		users = map[string]*adapteruser.User{
+			mysqlUser: adapteruser.NewUser(mysqlUser, mysqlPassword),
+		}
+	}
+
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, unix.SIGTERM)
 
-	server, err := NewServer(listenAddr, mysqlUser, mysqlPassword)
+	server, err := NewServer(listenAddr, users)
 	if err != nil {
 		log.WithError(err).Fatal("init server failed")
 		return
@@ -19,24 +19,24 @@ package main
 import (
 	"net"
 
+	"github.com/CovenantSQL/CovenantSQL/cmd/internal/adapteruser"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 	mys "github.com/siddontang/go-mysql/server"
 )
 
 // Server defines the main logic of mysql protocol adapter.
 type Server struct {
-	listenAddr    string
-	listener      net.Listener
-	mysqlUser     string
-	mysqlPassword string
+	listenAddr string
+	listener   net.Listener
+	users      map[string]*adapteruser.User
 }
 
-// NewServer bind the service port and return a runnable adapter.
-func NewServer(listenAddr string, user string, password string) (s *Server, err error) {
+// NewServer bind the service port and return a runnable adapter, the users are the mysql users
+// allowed to connect.
+func NewServer(listenAddr string, users map[string]*adapteruser.User) (s *Server, err error) {
 	s = &Server{
-		listenAddr:    listenAddr,
-		mysqlUser:     user,
-		mysqlPassword: password,
+		listenAddr: listenAddr,
+		users:      users,
 	}
 
 	if s.listener, err = net.Listen("tcp", listenAddr); err != nil {
@@ -59,7 +59,15 @@ func (s *Server) Serve() {
 }
 
 func (s *Server) handleConn(conn net.Conn) {
-	h, err := mys.NewConn(conn, s.mysqlUser, s.mysqlPassword, NewCursor(s))
+	ac, err := authenticate(conn, s.users)
+	if err != nil {
+		log.WithError(err).Error("authenticate connection failed")
+		conn.Close()
+		return
+	}
+
+	cursor := NewCursor(s, ac.user)
+	h, err := mys.NewConn(ac, ac.user.Name, ac.user.Password, cursor)
 
 	if err != nil {
 		log.WithError(err).Error("process connection failed")
@@ -0,0 +1,244 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"unicode/utf8"
+
+	"github.com/CovenantSQL/sqlparser"
+	my "github.com/siddontang/go-mysql/mysql"
+)
+
+// binaryCollationID is the collation id of the binary charset used by numeric fields.
+const binaryCollationID = 63
+
+// preparedStmt is the statement context kept by the server between COM_STMT_PREPARE and
+// COM_STMT_EXECUTE.
+type preparedStmt struct {
+	query  string
+	params int
+	read   bool
+}
+
+// countParams returns the number of ? placeholders in query, the placeholders in quoted strings,
+// quoted identifiers and comments are not counted. The query is scanned by the sql tokenizer,
+// which names the placeholders as :v1, :v2 and so on.
+func countParams(query string) (n int) {
+	var tkn = sqlparser.NewStringTokenizer(query)
+	for {
+		typ, val := tkn.Scan()
+		switch typ {
+		case 0:
+			return
+		case sqlparser.VALUE_ARG:
+			if isPositionalArg(val) {
+				n++
+			}
+		}
+	}
+}
+
+func isPositionalArg(val []byte) bool {
+	if len(val) < 3 || val[0] != ':' || val[1] != 'v' {
+		return false
+	}
+	for _, c := range val[2:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// convertStmtArgs converts the binary protocol arguments to the values accepted by the
+// covenantsql driver, string typed arguments are decoded as []byte by the protocol and they are
+// sent as string unless containing invalid utf-8 sequences.
+func convertStmtArgs(args []interface{}) (converted []interface{}) {
+	converted = make([]interface{}, len(args))
+
+	for i, arg := range args {
+		if v, ok := arg.([]byte); ok && utf8.Valid(v) {
+			converted[i] = string(v)
+		} else {
+			converted[i] = arg
+		}
+	}
+
+	return
+}
+
+// buildBinaryResultSet builds the binary protocol result set for statement executions. The field
+// type of a column is decided by all of its non-null values, columns with mixed value types are
+// sent as strings.
+func buildBinaryResultSet(columns []string, values [][]interface{}) (r *my.Resultset, err error) {
+	r = &my.Resultset{
+		Fields:   make([]*my.Field, len(columns)),
+		RowDatas: make([]my.RowData, 0, len(values)),
+	}
+
+	for i, name := range columns {
+		r.Fields[i] = &my.Field{
+			Name:    []byte(name),
+			Charset: uint16(my.DEFAULT_COLLATION_ID),
+			Type:    my.MYSQL_TYPE_NULL,
+		}
+	}
+
+	for i, row := range values {
+		if len(row) != len(columns) {
+			err = my.NewError(my.ER_UNKNOWN_ERROR,
+				fmt.Sprintf("row %d has %d columns, expected %d", i, len(row), len(columns)))
+			return
+		}
+		for j, v := range row {
+			if v == nil {
+				continue
+			}
+			typ, flag := binaryFieldType(v)
+			if f := r.Fields[j]; f.Type == my.MYSQL_TYPE_NULL {
+				f.Type, f.Flag = typ, flag
+			} else if f.Type != typ || f.Flag != flag {
+				f.Type, f.Flag = my.MYSQL_TYPE_VAR_STRING, 0
+			}
+		}
+	}
+
+	for _, f := range r.Fields {
+		if f.Type == my.MYSQL_TYPE_NULL {
+			// no values to decide the type
+			f.Type = my.MYSQL_TYPE_VAR_STRING
+		}
+		if f.Type != my.MYSQL_TYPE_VAR_STRING {
+			f.Charset = binaryCollationID
+		}
+	}
+
+	for _, row := range values {
+		// packet header, null bitmap with an offset of 2 bits, and the values
+		data := make([]byte, 1+(len(columns)+7+2)>>3)
+
+		for j, v := range row {
+			if v == nil {
+				data[1+(j+2)>>3] |= 1 << (uint(j+2) & 7)
+				continue
+			}
+			data = appendBinaryValue(data, r.Fields[j].Type, v)
+		}
+
+		r.RowDatas = append(r.RowDatas, data)
+	}
+
+	return
+}
+
+// textToBinaryResultSet rebuilds the text protocol result set rs in binary protocol.
+func textToBinaryResultSet(rs *my.Resultset) (r *my.Resultset, err error) {
+	var (
+		columns = make([]string, len(rs.Fields))
+		values  = make([][]interface{}, 0, len(rs.RowDatas))
+	)
+
+	for i, f := range rs.Fields {
+		columns[i] = string(f.Name)
+	}
+
+	for _, data := range rs.RowDatas {
+		var row []interface{}
+		if row, err = data.ParseText(rs.Fields); err != nil {
+			err = my.NewError(my.ER_UNKNOWN_ERROR, err.Error())
+			return
+		}
+		values = append(values, row)
+	}
+
+	return buildBinaryResultSet(columns, values)
+}
+
+func binaryFieldType(v interface{}) (typ uint8, flag uint16) {
+	switch v.(type) {
+	case int8, int16, int32, int64, int:
+		return my.MYSQL_TYPE_LONGLONG, my.BINARY_FLAG
+	case uint8, uint16, uint32, uint64, uint:
+		return my.MYSQL_TYPE_LONGLONG, my.BINARY_FLAG | my.UNSIGNED_FLAG
+	case float32, float64:
+		return my.MYSQL_TYPE_DOUBLE, my.BINARY_FLAG
+	default:
+		return my.MYSQL_TYPE_VAR_STRING, 0
+	}
+}
+
+func appendBinaryValue(data []byte, typ uint8, v interface{}) []byte {
+	switch typ {
+	case my.MYSQL_TYPE_LONGLONG:
+		if iv, ok := integerBits(v); ok {
+			return append(data, my.Uint64ToBytes(iv)...)
+		}
+	case my.MYSQL_TYPE_DOUBLE:
+		switch fv := v.(type) {
+		case float32:
+			return append(data, my.Uint64ToBytes(math.Float64bits(float64(fv)))...)
+		case float64:
+			return append(data, my.Uint64ToBytes(math.Float64bits(fv))...)
+		}
+	}
+
+	var b []byte
+	switch sv := v.(type) {
+	case []byte:
+		b = sv
+	case string:
+		b = []byte(sv)
+	default:
+		b = []byte(fmt.Sprint(sv))
+	}
+
+	return append(data, my.PutLengthEncodedString(b)...)
+}
+
+// integerBits returns the two's complement bits of the integer value v.
+func integerBits(v interface{}) (bits uint64, ok bool) {
+	ok = true
+
+	switch iv := v.(type) {
+	case int8:
+		bits = uint64(iv)
+	case int16:
+		bits = uint64(iv)
+	case int32:
+		bits = uint64(iv)
+	case int64:
+		bits = uint64(iv)
+	case int:
+		bits = uint64(iv)
+	case uint8:
+		bits = uint64(iv)
+	case uint16:
+		bits = uint64(iv)
+	case uint32:
+		bits = uint64(iv)
+	case uint64:
+		bits = iv
+	case uint:
+		bits = uint64(iv)
+	default:
+		ok = false
+	}
+
+	return
+}
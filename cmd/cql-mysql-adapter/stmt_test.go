@@ -0,0 +1,89 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"testing"
+
+	my "github.com/siddontang/go-mysql/mysql"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCountParams(t *testing.T) {
+	Convey("The placeholders should be counted outside of quotes and comments", t, func() {
+		So(countParams("SELECT 1"), ShouldEqual, 0)
+		So(countParams("SELECT * FROM t WHERE a = ? AND b = ?"), ShouldEqual, 2)
+		So(countParams("INSERT INTO t VALUES (?, '?', \"?\", `?`, ?)"), ShouldEqual, 2)
+		So(countParams("SELECT 'it\\'s ?' , ?"), ShouldEqual, 1)
+		So(countParams("SELECT ? -- ?\n, ? # ?\n, ? /* ? */"), ShouldEqual, 3)
+		So(countParams("SELECT ? /* unterminated ?"), ShouldEqual, 1)
+		So(countParams("SELECT ? /*! , ? */"), ShouldEqual, 2)
+		So(countParams("SELECT :name, ?"), ShouldEqual, 1)
+		So(countParams("SELECT ?, 'unterminated ?"), ShouldEqual, 1)
+	})
+}
+
+func TestBuildBinaryResultSet(t *testing.T) {
+	Convey("Given a result with mixed column types", t, func() {
+		var (
+			columns = []string{"i", "f", "s", "m", "n"}
+			values  = [][]interface{}{
+				{int64(1), float64(1.5), "a", int64(1), nil},
+				{nil, float64(-2), "b", "x", nil},
+				{int64(-3), nil, nil, []byte("y"), nil},
+			}
+		)
+		rs, err := buildBinaryResultSet(columns, values)
+		So(err, ShouldBeNil)
+		So(rs.Fields, ShouldHaveLength, len(columns))
+		So(rs.RowDatas, ShouldHaveLength, len(values))
+		So(rs.Fields[0].Type, ShouldEqual, my.MYSQL_TYPE_LONGLONG)
+		So(rs.Fields[1].Type, ShouldEqual, my.MYSQL_TYPE_DOUBLE)
+		So(rs.Fields[2].Type, ShouldEqual, my.MYSQL_TYPE_VAR_STRING)
+		So(rs.Fields[3].Type, ShouldEqual, my.MYSQL_TYPE_VAR_STRING)
+		So(rs.Fields[4].Type, ShouldEqual, my.MYSQL_TYPE_VAR_STRING)
+
+		Convey("The rows should be decoded by the binary protocol", func() {
+			expected := [][]interface{}{
+				{int64(1), float64(1.5), []byte("a"), []byte("1"), nil},
+				{nil, float64(-2), []byte("b"), []byte("x"), nil},
+				{int64(-3), nil, nil, []byte("y"), nil},
+			}
+			for i, data := range rs.RowDatas {
+				row, err := data.ParseBinary(rs.Fields)
+				So(err, ShouldBeNil)
+				So(row, ShouldResemble, expected[i])
+			}
+		})
+	})
+	Convey("Given an empty result", t, func() {
+		rs, err := buildBinaryResultSet([]string{"a"}, nil)
+		So(err, ShouldBeNil)
+		So(rs.Fields, ShouldHaveLength, 1)
+		So(rs.Fields[0], ShouldNotBeNil)
+		So(rs.RowDatas, ShouldBeEmpty)
+	})
+	Convey("Given a text protocol result set", t, func() {
+		text, err := my.BuildSimpleTextResultset([]string{"a", "b"}, [][]interface{}{{int64(1), "x"}})
+		So(err, ShouldBeNil)
+		rs, err := textToBinaryResultSet(text)
+		So(err, ShouldBeNil)
+		row, err := rs.RowDatas[0].ParseBinary(rs.Fields)
+		So(err, ShouldBeNil)
+		So(row, ShouldResemble, []interface{}{int64(1), []byte("x")})
+	})
+}
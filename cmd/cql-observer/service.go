@@ -81,6 +81,8 @@ var (
 	ErrNotFound = errors.New("resource not found")
 	// ErrInconsistentData represents corrupted observation data.
 	ErrInconsistentData = errors.New("inconsistent data")
+	// ErrPermissionDenied defines error on the caller is not a peer of the database
+	ErrPermissionDenied = errors.New("permission denied")
 
 	// bolt db buckets
 	blockBucket             = []byte("block")
@@ -230,6 +232,10 @@ func (s *Service) AdviseNewBlock(req *sqlchain.MuxAdviseNewBlockReq, resp *sqlch
 		return ErrStopped
 	}
 
+	if err = s.checkUpstream(req.DatabaseID, &req.Envelope); err != nil {
+		return
+	}
+
 	if req.Block == nil {
 		log.WithField("node", req.GetNodeID().String()).Warning("received empty block")
 		return
@@ -507,6 +513,39 @@ func (s *Service) getUpstream(dbID proto.DatabaseID) (instance *types.ServiceIns
 	return
 }
 
+// upstreamRoles implements route.DatabaseRoles with the peers of the upstream database.
+type upstreamRoles struct {
+	peers *proto.Peers
+}
+
+func (r *upstreamRoles) GetNodeRoles(nodeID proto.NodeID) proto.ServerRoles {
+	return route.GetPeersRoles(r.peers, nodeID)
+}
+
+// checkUpstream checks whether the caller is a peer of the database, the peers are refreshed from
+// block producer once on mismatch in case of the peers have changed.
+func (s *Service) checkUpstream(dbID proto.DatabaseID, env *proto.Envelope) (err error) {
+	instance, err := s.getUpstream(dbID)
+	if err != nil {
+		return
+	}
+	if route.IsPermittedOnDatabase(env, &upstreamRoles{peers: instance.Peers}, route.OBSAdviseNewBlock) {
+		return
+	}
+
+	s.upstreamServers.Delete(dbID)
+	if instance, err = s.getUpstream(dbID); err == nil &&
+		route.IsPermittedOnDatabase(env, &upstreamRoles{peers: instance.Peers}, route.OBSAdviseNewBlock) {
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"db":   dbID,
+		"node": env.GetNodeID().String(),
+	}).WithError(err).Warning("reject block from non-peer node")
+	return ErrPermissionDenied
+}
+
 func (s *Service) getAck(dbID proto.DatabaseID, h *hash.Hash) (ack *types.SignedAckHeader, err error) {
 	var (
 		blockHeight int32
@@ -0,0 +1,74 @@
+// +build !testbinary
+
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/conf"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/sqlchain"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestServiceAdviseNewBlock(t *testing.T) {
+	Convey("The blocks should only be accepted from the database peers", t, func() {
+		var err error
+		conf.GConf, err = conf.LoadConfig("../../test/node_0/config.yaml")
+		So(err, ShouldBeNil)
+		// reset the once
+		route.Once = sync.Once{}
+
+		var (
+			s     = &Service{}
+			dbID  = proto.DatabaseID("db")
+			miner = proto.NodeID("0000000000000000000000000000000000000000000000000000000000000001")
+			// a 32 bytes node id which is neither a block producer nor a database peer
+			other = proto.NodeID("0000000000000000000000000000000000000000000000000000000000000004")
+		)
+		s.upstreamServers.Store(dbID, &types.ServiceInstance{
+			DatabaseID: dbID,
+			Peers: &proto.Peers{PeersHeader: proto.PeersHeader{
+				Leader:  miner,
+				Servers: []proto.NodeID{miner},
+			}},
+		})
+
+		req := &sqlchain.MuxAdviseNewBlockReq{Envelope: proto.Envelope{NodeID: other.ToRawNodeID()}}
+		req.DatabaseID = dbID
+		err = s.AdviseNewBlock(req, &sqlchain.MuxAdviseNewBlockResp{})
+		So(err, ShouldEqual, ErrPermissionDenied)
+
+		// restore the upstream peers dropped by the failed check
+		s.upstreamServers.Store(dbID, &types.ServiceInstance{
+			DatabaseID: dbID,
+			Peers: &proto.Peers{PeersHeader: proto.PeersHeader{
+				Leader:  miner,
+				Servers: []proto.NodeID{miner},
+			}},
+		})
+		req = &sqlchain.MuxAdviseNewBlockReq{Envelope: proto.Envelope{NodeID: miner.ToRawNodeID()}}
+		req.DatabaseID = dbID
+		err = s.AdviseNewBlock(req, &sqlchain.MuxAdviseNewBlockResp{})
+		So(err, ShouldBeNil)
+	})
+}
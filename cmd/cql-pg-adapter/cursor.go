@@ -0,0 +1,213 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/CovenantSQL/CovenantSQL/client"
+	"github.com/CovenantSQL/CovenantSQL/cmd/internal/adapteruser"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+var (
+	dbIDRegex        = regexp.MustCompile("^[a-zA-Z0-9_\\.]+$")
+	transactionQuery = regexp.MustCompile("^(?i)(BEGIN|START\\s+TRANSACTION|COMMIT|END|ROLLBACK|ABORT)\\b")
+	emptyResultQuery = regexp.MustCompile("^(?i)(SET|RESET|DISCARD|DEALLOCATE|LISTEN|UNLISTEN)\\b")
+	showQuery        = regexp.MustCompile("^(?i)SHOW\\s+(\\w+)$")
+	transactionTags  = map[string]string{
+		"BEGIN":    "BEGIN",
+		"START":    "BEGIN",
+		"COMMIT":   "COMMIT",
+		"END":      "COMMIT",
+		"ROLLBACK": "ROLLBACK",
+		"ABORT":    "ROLLBACK",
+	}
+)
+
+// column is a column of the result set.
+type column struct {
+	name   string
+	oid    uint32
+	format int16
+}
+
+// result is the execution result of a statement.
+type result struct {
+	columns []column // nil for the statements without result set
+	rows    [][]interface{}
+	tag     string
+}
+
+// Cursor is a postgresql connection handler, like a cursor of normal database.
+type Cursor struct {
+	server *Server
+	user   *adapteruser.User
+	dbName string
+	db     *sql.DB
+}
+
+// NewCursor returns a new cursor.
+func NewCursor(s *Server) (c *Cursor) {
+	return &Cursor{server: s}
+}
+
+// UseDB connects the database of the startup packet.
+func (c *Cursor) UseDB(dbName string) (err error) {
+	// test if the database name is a valid database id
+	if !dbIDRegex.MatchString(dbName) {
+		return newError(codeInvalidCatalogName, "invalid database: %v", dbName)
+	}
+	if !c.user.AllowDatabase(dbName) {
+		return newError(codeInsufficientPrivilege, "permission denied for database %v", dbName)
+	}
+
+	cfg := client.NewConfig()
+	cfg.DatabaseID = dbName
+
+	c.dbName = dbName
+	// the queries are signed by the account of the user
+	c.db = sql.OpenDB(client.NewConnector(cfg, c.user.PrivateKey))
+
+	return
+}
+
+// Close closes the database connection.
+func (c *Cursor) Close() {
+	if c.db != nil {
+		c.db.Close()
+	}
+}
+
+// Query executes a rewritten statement with the arguments in the order of the placeholders.
+func (c *Cursor) Query(q *pgQuery, args []interface{}) (r *result, err error) {
+	log.WithField("query", q.query).Info("received query")
+
+	var processed bool
+	if r, processed, err = c.handleSpecialQuery(q); processed {
+		return
+	}
+
+	if c.db == nil {
+		err = newError(codeInvalidCatalogName, "no database selected")
+		return
+	}
+
+	if q.isRead() {
+		var rows *sql.Rows
+		if rows, err = c.db.Query(q.query, args...); err != nil {
+			return
+		}
+		defer rows.Close()
+
+		return c.buildResult(rows)
+	}
+
+	var res sql.Result
+	if res, err = c.db.Exec(q.query, args...); err != nil {
+		return
+	}
+	affectedRows, _ := res.RowsAffected()
+
+	r = &result{}
+	switch q.command {
+	case "INSERT":
+		r.tag = fmt.Sprintf("INSERT 0 %d", affectedRows)
+	case "UPDATE", "DELETE", "REPLACE":
+		r.tag = fmt.Sprintf("%s %d", q.command, affectedRows)
+	default:
+		r.tag = q.command
+	}
+
+	return
+}
+
+func (c *Cursor) buildResult(rows *sql.Rows) (r *result, err error) {
+	var columnTypes []*sql.ColumnType
+	if columnTypes, err = rows.ColumnTypes(); err != nil {
+		return
+	}
+
+	r = &result{}
+	for rows.Next() {
+		var (
+			row  = make([]interface{}, len(columnTypes))
+			dest = make([]interface{}, len(columnTypes))
+		)
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return
+		}
+		r.rows = append(r.rows, row)
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	r.columns = make([]column, len(columnTypes))
+	for i, ct := range columnTypes {
+		r.columns[i] = column{
+			name: ct.Name(),
+			oid:  columnOID(ct.DatabaseTypeName(), r.rows, i),
+		}
+	}
+	r.tag = fmt.Sprintf("SELECT %d", len(r.rows))
+
+	return
+}
+
+func (c *Cursor) handleSpecialQuery(q *pgQuery) (r *result, processed bool, err error) {
+	if matches := transactionQuery.FindStringSubmatch(q.query); len(matches) > 1 {
+		// every statement is committed on its own, the transaction statements take no effect
+		processed = true
+		r = &result{tag: transactionTags[strings.ToUpper(strings.Fields(matches[1])[0])]}
+	} else if emptyResultQuery.MatchString(q.query) {
+		processed = true
+		r = &result{tag: q.command}
+		if q.command == "DISCARD" {
+			r.tag = "DISCARD ALL"
+		}
+	} else if matches := showQuery.FindStringSubmatch(q.query); len(matches) > 1 {
+		processed = true
+		name := strings.ToLower(matches[1])
+		if name == "all" {
+			r = &result{columns: []column{
+				{name: "name", oid: oidText},
+				{name: "setting", oid: oidText},
+			}}
+			for _, p := range serverParameters {
+				r.rows = append(r.rows, []interface{}{p.name, p.value})
+			}
+		} else if value, ok := serverParameter(name); ok {
+			r = &result{
+				columns: []column{{name: name, oid: oidText}},
+				rows:    [][]interface{}{{value}},
+			}
+		} else {
+			err = newError(codeUndefinedObject, "unrecognized configuration parameter %q", name)
+			return
+		}
+		r.tag = "SHOW"
+	}
+
+	return
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+)
+
+// SQLSTATE codes of the error responses.
+const (
+	codeProtocolViolation     = "08P01"
+	codeFeatureNotSupported   = "0A000"
+	codeInvalidPassword       = "28P01"
+	codeInsufficientPrivilege = "42501"
+	codeInvalidCatalogName    = "3D000"
+	codeInvalidStatementName  = "26000"
+	codeInvalidCursorName     = "34000"
+	codeUndefinedObject       = "42704"
+	codeInvalidParameterValue = "22023"
+	codeInternalError         = "XX000"
+)
+
+// pgError is an error sent to the client as ErrorResponse.
+type pgError struct {
+	code    string
+	message string
+}
+
+func newError(code string, format string, args ...interface{}) *pgError {
+	return &pgError{
+		code:    code,
+		message: fmt.Sprintf(format, args...),
+	}
+}
+
+// Error implements the error interface.
+func (e *pgError) Error() string {
+	return e.message
+}
+
+// toPGError converts err to the error response, the errors of CovenantSQL are reported as internal
+// errors.
+func toPGError(err error) *pgError {
+	if e, ok := err.(*pgError); ok {
+		return e
+	}
+	return newError(codeInternalError, "%v", err)
+}
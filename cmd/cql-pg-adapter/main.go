@@ -0,0 +1,108 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+
+	"github.com/CovenantSQL/CovenantSQL/client"
+	"github.com/CovenantSQL/CovenantSQL/cmd/internal/adapteruser"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"golang.org/x/sys/unix"
+)
+
+const name = "cql-pg-adapter"
+
+var (
+	version    = "unknown"
+	configFile string
+	password   string
+
+	listenAddr  string
+	showVersion bool
+)
+
+func init() {
+	flag.StringVar(&configFile, "config", "./config.yaml", "config file for postgresql adapter")
+	flag.StringVar(&password, "password", "", "master key password")
+	flag.BoolVar(&asymmetric.BypassSignature, "bypassSignature", false,
+		"Disable signature sign and verify, for testing")
+	flag.BoolVar(&showVersion, "version", false, "Show version information and exit")
+
+	flag.StringVar(&listenAddr, "listen", "127.0.0.1:4665", "listen address for postgresql adapter")
+}
+
+func main() {
+	flag.Parse()
+	if showVersion {
+		fmt.Printf("%v %v %v %v %v\n",
+			name, version, runtime.GOOS, runtime.GOARCH, runtime.Version())
+		os.Exit(0)
+	}
+
+	flag.Visit(func(f *flag.Flag) {
+		log.Infof("Args %#v : %s", f.Name, f.Value)
+	})
+
+	// init client
+	if err := client.Init(configFile, []byte(password)); err != nil {
+		log.WithError(err).Fatal("init covenantsql client failed")
+		return
+	}
+
+	// load users, there is no default user as each user signs the queries by its own key
+	cfg, err := loadConfig(configFile)
+	if err != nil {
+		log.WithError(err).Fatal("load config failed")
+		return
+	}
+	if cfg == nil || len(cfg.Users) == 0 {
+		log.Fatal("no postgresql users configured")
+		return
+	}
+
+	users, err := adapteruser.Load(cfg.Users, filepath.Dir(configFile))
+	if err != nil {
+		log.WithError(err).Fatal("load postgresql users failed")
+		return
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, unix.SIGTERM)
+
+	server, err := NewServer(listenAddr, users)
+	if err != nil {
+		log.WithError(err).Fatal("init server failed")
+		return
+	}
+
+	go server.Serve()
+
+	log.Info("start postgresql adapter")
+
+	<-stop
+
+	server.Shutdown()
+
+	log.Info("stopped postgresql adapter")
+}
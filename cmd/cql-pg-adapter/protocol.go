@@ -0,0 +1,269 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// protocolVersion is the version 3.0 of the frontend/backend protocol.
+	protocolVersion = 196608
+	// sslRequestCode is the protocol code of SSLRequest.
+	sslRequestCode = 80877103
+	// gssEncRequestCode is the protocol code of GSSENCRequest.
+	gssEncRequestCode = 80877104
+	// cancelRequestCode is the protocol code of CancelRequest.
+	cancelRequestCode = 80877102
+
+	// maxMessageSize limits the size of a single frontend message.
+	maxMessageSize = 64 << 20
+)
+
+// Frontend message types.
+const (
+	msgQuery     = 'Q'
+	msgParse     = 'P'
+	msgBind      = 'B'
+	msgDescribe  = 'D'
+	msgExecute   = 'E'
+	msgClose     = 'C'
+	msgSync      = 'S'
+	msgFlush     = 'H'
+	msgTerminate = 'X'
+	msgPassword  = 'p'
+)
+
+// Backend message types.
+const (
+	msgAuthentication       = 'R'
+	msgParameterStatus      = 'S'
+	msgBackendKeyData       = 'K'
+	msgReadyForQuery        = 'Z'
+	msgRowDescription       = 'T'
+	msgDataRow              = 'D'
+	msgCommandComplete      = 'C'
+	msgEmptyQueryResponse   = 'I'
+	msgErrorResponse        = 'E'
+	msgParseComplete        = '1'
+	msgBindComplete         = '2'
+	msgCloseComplete        = '3'
+	msgNoData               = 'n'
+	msgParameterDescription = 't'
+	msgPortalSuspended      = 's'
+)
+
+// Authentication request codes.
+const (
+	authOK  = 0
+	authMD5 = 5
+)
+
+var (
+	// errMalformedMessage indicates that a frontend message is truncated or malformed.
+	errMalformedMessage = errors.New("malformed message")
+)
+
+// wireConn reads the frontend messages and writes the backend messages of a connection, the
+// backend messages are buffered until flush.
+type wireConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+func newWireConn(conn net.Conn) *wireConn {
+	return &wireConn{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		w:    bufio.NewWriter(conn),
+	}
+}
+
+// readStartup reads a startup packet, which has no message type.
+func (c *wireConn) readStartup() (code uint32, body *readBuffer, err error) {
+	var data []byte
+	if data, err = c.readBody(); err != nil {
+		return
+	}
+	body = &readBuffer{data: data}
+	code, err = body.uint32()
+	return
+}
+
+// readMessage reads a typed frontend message.
+func (c *wireConn) readMessage() (typ byte, body *readBuffer, err error) {
+	if typ, err = c.r.ReadByte(); err != nil {
+		return
+	}
+	var data []byte
+	if data, err = c.readBody(); err != nil {
+		return
+	}
+	body = &readBuffer{data: data}
+	return
+}
+
+func (c *wireConn) readBody() (data []byte, err error) {
+	var header [4]byte
+	if _, err = io.ReadFull(c.r, header[:]); err != nil {
+		return
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size < 4 || size > maxMessageSize {
+		err = errors.Wrapf(errMalformedMessage, "invalid message size %d", size)
+		return
+	}
+	data = make([]byte, size-4)
+	_, err = io.ReadFull(c.r, data)
+	return
+}
+
+// writeMessage writes a backend message, the message type 0 writes the raw bytes.
+func (c *wireConn) writeMessage(typ byte, body *writeBuffer) (err error) {
+	var data []byte
+	if body != nil {
+		data = body.data
+	}
+	if typ != 0 {
+		if err = c.w.WriteByte(typ); err != nil {
+			return
+		}
+		var header [4]byte
+		binary.BigEndian.PutUint32(header[:], uint32(len(data)+4))
+		if _, err = c.w.Write(header[:]); err != nil {
+			return
+		}
+	}
+	_, err = c.w.Write(data)
+	return
+}
+
+func (c *wireConn) flush() error {
+	return c.w.Flush()
+}
+
+func (c *wireConn) close() error {
+	return c.conn.Close()
+}
+
+// readBuffer decodes the fields of a frontend message.
+type readBuffer struct {
+	data []byte
+}
+
+func (b *readBuffer) byte() (v byte, err error) {
+	if len(b.data) < 1 {
+		err = errMalformedMessage
+		return
+	}
+	v, b.data = b.data[0], b.data[1:]
+	return
+}
+
+func (b *readBuffer) int16() (v int16, err error) {
+	if len(b.data) < 2 {
+		err = errMalformedMessage
+		return
+	}
+	v, b.data = int16(binary.BigEndian.Uint16(b.data)), b.data[2:]
+	return
+}
+
+func (b *readBuffer) int32() (v int32, err error) {
+	var u uint32
+	u, err = b.uint32()
+	v = int32(u)
+	return
+}
+
+func (b *readBuffer) uint32() (v uint32, err error) {
+	if len(b.data) < 4 {
+		err = errMalformedMessage
+		return
+	}
+	v, b.data = binary.BigEndian.Uint32(b.data), b.data[4:]
+	return
+}
+
+// string reads a null-terminated string.
+func (b *readBuffer) string() (v string, err error) {
+	for i, c := range b.data {
+		if c == 0 {
+			v, b.data = string(b.data[:i]), b.data[i+1:]
+			return
+		}
+	}
+	err = errMalformedMessage
+	return
+}
+
+// bytes reads a length-prefixed value, which is nil for the length -1.
+func (b *readBuffer) bytes() (v []byte, err error) {
+	var n int32
+	if n, err = b.int32(); err != nil || n < 0 {
+		return
+	}
+	if int(n) > len(b.data) {
+		err = errMalformedMessage
+		return
+	}
+	v, b.data = b.data[:n], b.data[n:]
+	return
+}
+
+// writeBuffer encodes the fields of a backend message.
+type writeBuffer struct {
+	data []byte
+}
+
+func (b *writeBuffer) byte(v byte) *writeBuffer {
+	b.data = append(b.data, v)
+	return b
+}
+
+func (b *writeBuffer) int16(v int16) *writeBuffer {
+	b.data = append(b.data, byte(v>>8), byte(v))
+	return b
+}
+
+func (b *writeBuffer) int32(v int32) *writeBuffer {
+	b.data = append(b.data, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	return b
+}
+
+// string writes a null-terminated string.
+func (b *writeBuffer) string(v string) *writeBuffer {
+	b.data = append(b.data, v...)
+	b.data = append(b.data, 0)
+	return b
+}
+
+// bytes writes a length-prefixed value, nil is written as the length -1.
+func (b *writeBuffer) bytes(v []byte) *writeBuffer {
+	if v == nil {
+		return b.int32(-1)
+	}
+	b.int32(int32(len(v)))
+	b.data = append(b.data, v...)
+	return b
+}
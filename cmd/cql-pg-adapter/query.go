@@ -0,0 +1,435 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// typeNames maps the declared column type patterns to the PostgreSQL data type and udt names, in
+// the order of the column affinity rules.
+var typeNames = []struct {
+	patterns []string
+	dataType string
+	udtName  string
+}{
+	{[]string{"%bool%"}, "boolean", "bool"},
+	{[]string{"date%", "time%"}, "timestamp without time zone", "timestamp"},
+	{[]string{"%int%"}, "bigint", "int8"},
+	{[]string{"%char%", "%clob%", "%text%"}, "text", "text"},
+	{[]string{"%blob%", "%binary%"}, "bytea", "bytea"},
+	{[]string{"%real%", "%floa%", "%doub%"}, "double precision", "float8"},
+	{[]string{"%dec%", "%num%"}, "numeric", "numeric"},
+}
+
+// castTypeWords are the words following the first word of the multiple words type names, e.g.
+// double precision and timestamp with time zone.
+var castTypeWords = map[string]bool{
+	"precision": true,
+	"varying":   true,
+	"with":      true,
+	"without":   true,
+	"time":      true,
+	"zone":      true,
+}
+
+// aliasStopWords are the keywords which may follow a table reference but are not table aliases.
+var aliasStopWords = map[string]bool{
+	"where": true, "group": true, "order": true, "limit": true, "offset": true, "having": true,
+	"join": true, "inner": true, "left": true, "right": true, "full": true, "outer": true,
+	"cross": true, "natural": true, "on": true, "using": true, "union": true, "except": true,
+	"intersect": true, "window": true, "for": true,
+}
+
+// pgQuery is a PostgreSQL statement rewritten for the SQLite storage of CovenantSQL.
+type pgQuery struct {
+	query   string // the rewritten statement
+	params  []int  // the zero-based parameter indexes of the placeholders in order
+	nParams int    // the number of parameters, which is the max $n of the placeholders
+	command string // the first keyword of the statement in upper case
+}
+
+// args arranges the Bind parameters in the order of the placeholders.
+func (q *pgQuery) args(params []interface{}) (args []interface{}) {
+	args = make([]interface{}, len(q.params))
+	for i, p := range q.params {
+		if p < len(params) {
+			args[i] = params[p]
+		}
+	}
+	return
+}
+
+// isRead reports whether the statement returns rows.
+func (q *pgQuery) isRead() bool {
+	switch q.command {
+	case "SELECT", "WITH", "VALUES", "SHOW", "TABLE", "EXPLAIN":
+		return true
+	}
+	return false
+}
+
+// splitQuery splits the statements of a simple query by the semicolons outside of the quoted
+// strings, identifiers and comments, the empty statements are dropped.
+func splitQuery(query string) (stmts []string) {
+	var s = &queryScanner{text: query}
+	var start int
+	for s.pos < len(s.text) {
+		if s.text[s.pos] == ';' {
+			if stmt := strings.TrimSpace(query[start:s.pos]); stmt != "" {
+				stmts = append(stmts, stmt)
+			}
+			s.pos++
+			start = s.pos
+			continue
+		}
+		s.skip()
+	}
+	if stmt := strings.TrimSpace(query[start:]); stmt != "" {
+		stmts = append(stmts, stmt)
+	}
+	return
+}
+
+// rewriteQuery rewrites a PostgreSQL statement to the dialect accepted by CovenantSQL:
+//
+//   - the double quoted identifiers are quoted by backticks;
+//   - the $n placeholders are replaced by ? in order;
+//   - the dollar quoted strings are replaced by the standard strings;
+//   - the type casts by :: are dropped;
+//   - ILIKE is replaced by LIKE, which is case-insensitive in SQLite;
+//   - the catalog relations pg_tables, pg_views, pg_indexes, information_schema.tables and
+//     information_schema.columns are replaced by the emulated ones on the SQLite schema;
+//   - current_database(), current_schema() and version() are replaced by the values.
+func rewriteQuery(query string, dbName string) (q *pgQuery) {
+	var (
+		s   = &queryScanner{text: query}
+		out strings.Builder
+	)
+	q = &pgQuery{}
+
+	for s.pos < len(s.text) {
+		c := s.text[s.pos]
+		switch {
+		case c == '"':
+			name := s.quotedIdentifier()
+			out.WriteString("`" + strings.Replace(name, "`", "``", -1) + "`")
+		case c == '$' && s.pos+1 < len(s.text) && isDigit(s.text[s.pos+1]):
+			s.pos++
+			start := s.pos
+			for s.pos < len(s.text) && isDigit(s.text[s.pos]) {
+				s.pos++
+			}
+			n, _ := strconv.Atoi(s.text[start:s.pos])
+			if n > q.nParams {
+				q.nParams = n
+			}
+			q.params = append(q.params, n-1)
+			out.WriteByte('?')
+		case c == '$':
+			if str, ok := s.dollarQuoted(); ok {
+				out.WriteString("'" + strings.Replace(str, "'", "''", -1) + "'")
+			} else {
+				out.WriteByte(c)
+				s.pos++
+			}
+		case c == ':' && s.pos+1 < len(s.text) && s.text[s.pos+1] == ':':
+			s.pos += 2
+			s.castType()
+		case c == '-' && s.pos+1 < len(s.text) && s.text[s.pos+1] == '-',
+			c == '/' && s.pos+1 < len(s.text) && s.text[s.pos+1] == '*':
+			s.skip()
+			out.WriteByte(' ')
+		case c == '\'':
+			start := s.pos
+			s.skip()
+			out.WriteString(s.text[start:s.pos])
+		case isIdentStart(c):
+			word := s.word()
+			if q.command == "" {
+				q.command = strings.ToUpper(word)
+			}
+			out.WriteString(s.rewriteWord(word, dbName))
+		default:
+			out.WriteByte(c)
+			s.pos++
+		}
+	}
+
+	q.query = strings.TrimSpace(out.String())
+	return
+}
+
+// queryScanner scans the text of a PostgreSQL query.
+type queryScanner struct {
+	text string
+	pos  int
+}
+
+// skip skips the quoted string, identifier or comment at the position, or a single byte.
+func (s *queryScanner) skip() {
+	switch c := s.text[s.pos]; {
+	case c == '\'':
+		s.pos++
+		for s.pos < len(s.text) {
+			if s.text[s.pos] == '\'' {
+				if s.pos+1 < len(s.text) && s.text[s.pos+1] == '\'' {
+					s.pos += 2
+					continue
+				}
+				break
+			}
+			s.pos++
+		}
+		s.pos++
+	case c == '"':
+		s.quotedIdentifier()
+	case c == '$':
+		if _, ok := s.dollarQuoted(); !ok {
+			s.pos++
+		}
+	case c == '-' && s.pos+1 < len(s.text) && s.text[s.pos+1] == '-':
+		for s.pos < len(s.text) && s.text[s.pos] != '\n' {
+			s.pos++
+		}
+	case c == '/' && s.pos+1 < len(s.text) && s.text[s.pos+1] == '*':
+		if end := strings.Index(s.text[s.pos+2:], "*/"); end >= 0 {
+			s.pos += end + 4
+		} else {
+			s.pos = len(s.text)
+		}
+	default:
+		s.pos++
+	}
+	if s.pos > len(s.text) {
+		s.pos = len(s.text)
+	}
+}
+
+// quotedIdentifier reads a double quoted identifier.
+func (s *queryScanner) quotedIdentifier() string {
+	var name strings.Builder
+	for s.pos++; s.pos < len(s.text); s.pos++ {
+		if s.text[s.pos] == '"' {
+			if s.pos+1 < len(s.text) && s.text[s.pos+1] == '"' {
+				name.WriteByte('"')
+				s.pos++
+				continue
+			}
+			s.pos++
+			break
+		}
+		name.WriteByte(s.text[s.pos])
+	}
+	return name.String()
+}
+
+// dollarQuoted reads a dollar quoted string like $tag$...$tag$.
+func (s *queryScanner) dollarQuoted() (str string, ok bool) {
+	end := s.pos + 1
+	for end < len(s.text) && (isIdentStart(s.text[end]) || isDigit(s.text[end])) {
+		end++
+	}
+	if end >= len(s.text) || s.text[end] != '$' {
+		return
+	}
+	tag := s.text[s.pos : end+1]
+	n := strings.Index(s.text[end+1:], tag)
+	if n < 0 {
+		return
+	}
+	str = s.text[end+1 : end+1+n]
+	s.pos = end + 1 + n + len(tag)
+	ok = true
+	return
+}
+
+// word reads an identifier, which may be qualified by a schema name.
+func (s *queryScanner) word() string {
+	start := s.pos
+	for s.pos < len(s.text) && (isIdentStart(s.text[s.pos]) || isDigit(s.text[s.pos]) ||
+		s.text[s.pos] == '$') {
+		s.pos++
+	}
+	if s.pos+1 < len(s.text) && s.text[s.pos] == '.' && isIdentStart(s.text[s.pos+1]) {
+		s.pos++
+		for s.pos < len(s.text) && (isIdentStart(s.text[s.pos]) || isDigit(s.text[s.pos])) {
+			s.pos++
+		}
+	}
+	return s.text[start:s.pos]
+}
+
+// castType skips the type name of a type cast.
+func (s *queryScanner) castType() {
+	s.skipSpaces()
+	if s.pos < len(s.text) && s.text[s.pos] == '"' {
+		s.quotedIdentifier()
+	} else if s.pos < len(s.text) && isIdentStart(s.text[s.pos]) {
+		s.word()
+	}
+	for {
+		save := s.pos
+		s.skipSpaces()
+		if s.pos < len(s.text) && isIdentStart(s.text[s.pos]) {
+			if castTypeWords[strings.ToLower(s.word())] {
+				continue
+			}
+		}
+		s.pos = save
+		break
+	}
+	if s.pos < len(s.text) && s.text[s.pos] == '(' {
+		if end := strings.IndexByte(s.text[s.pos:], ')'); end >= 0 {
+			s.pos += end + 1
+		}
+	}
+	for s.pos+1 < len(s.text) && s.text[s.pos] == '[' && s.text[s.pos+1] == ']' {
+		s.pos += 2
+	}
+}
+
+func (s *queryScanner) skipSpaces() {
+	for s.pos < len(s.text) && isSpace(s.text[s.pos]) {
+		s.pos++
+	}
+}
+
+// hasAlias reports whether the table reference ending at the position is followed by an alias.
+func (s *queryScanner) hasAlias() bool {
+	var pos = s.pos
+	for pos < len(s.text) && isSpace(s.text[pos]) {
+		pos++
+	}
+	if pos < len(s.text) && s.text[pos] == '"' {
+		return true
+	}
+	end := pos
+	for end < len(s.text) && (isIdentStart(s.text[end]) || isDigit(s.text[end])) {
+		end++
+	}
+	return end > pos && !aliasStopWords[strings.ToLower(s.text[pos:end])]
+}
+
+// rewriteWord rewrites the word just read.
+func (s *queryScanner) rewriteWord(word string, dbName string) string {
+	var lower = strings.ToLower(word)
+
+	switch lower {
+	case "ilike":
+		return "LIKE"
+	case "current_database", "current_schema", "version":
+		save := s.pos
+		s.skipSpaces()
+		if s.pos+1 < len(s.text) && s.text[s.pos] == '(' && s.text[s.pos+1] == ')' {
+			s.pos += 2
+		} else if lower != "current_schema" {
+			s.pos = save
+			return word
+		}
+		switch lower {
+		case "current_database":
+			return quoteLiteral(dbName)
+		case "current_schema":
+			return quoteLiteral(defaultSchema)
+		default:
+			return quoteLiteral(serverVersionString)
+		}
+	}
+
+	if derived, alias := catalogRelation(lower, dbName); derived != "" {
+		if s.hasAlias() {
+			return "(" + derived + ")"
+		}
+		return "(" + derived + ") AS `" + alias + "`"
+	}
+
+	return word
+}
+
+// catalogRelation returns the emulated relation of the catalog relation name and its alias.
+func catalogRelation(name string, dbName string) (derived string, alias string) {
+	switch name {
+	case "pg_tables", "pg_catalog.pg_tables":
+		alias = "pg_tables"
+		derived = "SELECT '" + defaultSchema + "' AS schemaname, name AS tablename, " +
+			"'" + tableOwner + "' AS tableowner, NULL AS tablespace FROM sqlite_master " +
+			"WHERE type = 'table' AND substr(name, 1, 7) <> 'sqlite_'"
+	case "pg_views", "pg_catalog.pg_views":
+		alias = "pg_views"
+		derived = "SELECT '" + defaultSchema + "' AS schemaname, name AS viewname, " +
+			"'" + tableOwner + "' AS viewowner, sql AS definition FROM sqlite_master " +
+			"WHERE type = 'view'"
+	case "pg_indexes", "pg_catalog.pg_indexes":
+		alias = "pg_indexes"
+		derived = "SELECT '" + defaultSchema + "' AS schemaname, tbl_name AS tablename, " +
+			"name AS indexname, NULL AS tablespace, sql AS indexdef FROM sqlite_master " +
+			"WHERE type = 'index'"
+	case "information_schema.tables":
+		alias = "tables"
+		derived = "SELECT " + quoteLiteral(dbName) + " AS table_catalog, " +
+			"'" + defaultSchema + "' AS table_schema, name AS table_name, " +
+			"CASE type WHEN 'view' THEN 'VIEW' ELSE 'BASE TABLE' END AS table_type " +
+			"FROM sqlite_master WHERE type IN ('table', 'view') AND substr(name, 1, 7) <> 'sqlite_'"
+	case "information_schema.columns":
+		// the columns are listed by the information_schema emulation of the miners
+		alias = "columns"
+		derived = "SELECT " + quoteLiteral(dbName) + " AS table_catalog, " +
+			"'" + defaultSchema + "' AS table_schema, TABLE_NAME AS table_name, " +
+			"COLUMN_NAME AS column_name, ORDINAL_POSITION AS ordinal_position, " +
+			"COLUMN_DEFAULT AS column_default, IS_NULLABLE AS is_nullable, " +
+			typeNameCase("data_type") + ", " + typeNameCase("udt_name") + " " +
+			"FROM information_schema.COLUMNS"
+	}
+	return
+}
+
+// typeNameCase returns the CASE expression mapping the declared column types to the type names.
+func typeNameCase(column string) string {
+	var expr strings.Builder
+	expr.WriteString("CASE")
+	for _, t := range typeNames {
+		var conds []string
+		for _, p := range t.patterns {
+			conds = append(conds, "COLUMN_TYPE LIKE '"+p+"'")
+		}
+		name := t.dataType
+		if column == "udt_name" {
+			name = t.udtName
+		}
+		expr.WriteString(" WHEN " + strings.Join(conds, " OR ") + " THEN '" + name + "'")
+	}
+	expr.WriteString(" ELSE 'text' END AS " + column)
+	return expr.String()
+}
+
+func quoteLiteral(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f'
+}
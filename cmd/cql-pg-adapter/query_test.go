@@ -0,0 +1,143 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSplitQuery(t *testing.T) {
+	Convey("The statements should be split by the semicolons outside of quotes and comments", t, func() {
+		So(splitQuery(""), ShouldBeEmpty)
+		So(splitQuery(" ; ;"), ShouldBeEmpty)
+		So(splitQuery("SELECT 1; SELECT 2;"), ShouldResemble, []string{"SELECT 1", "SELECT 2"})
+		So(splitQuery(`SELECT ';', "a;b" -- c;d
+FROM t; SELECT $x$;$x$ /* ; */`), ShouldResemble, []string{
+			"SELECT ';', \"a;b\" -- c;d\nFROM t",
+			"SELECT $x$;$x$ /* ; */",
+		})
+	})
+}
+
+func TestRewriteQuery(t *testing.T) {
+	Convey("The postgresql dialect should be rewritten", t, func() {
+		var cases = []struct {
+			query    string
+			expected string
+		}{
+			{
+				`SELECT "Name", 'it''s "x"' FROM "t" WHERE id = $1`,
+				"SELECT `Name`, 'it''s \"x\"' FROM `t` WHERE id = ?",
+			},
+			{
+				`SELECT $$it's$$, $tag$a$$b$tag$`,
+				`SELECT 'it''s', 'a$$b'`,
+			},
+			{
+				`SELECT id::text, '1'::int8, ts::timestamp without time zone FROM t -- comment`,
+				`SELECT id, '1', ts FROM t`,
+			},
+			{
+				`SELECT * FROM t WHERE name ILIKE 'a%'`,
+				`SELECT * FROM t WHERE name LIKE 'a%'`,
+			},
+			{
+				`SELECT current_database(), current_schema, version()`,
+				`SELECT 'db', 'public', 'PostgreSQL 10.0 on CovenantSQL'`,
+			},
+		}
+		for _, c := range cases {
+			So(rewriteQuery(c.query, "db").query, ShouldEqual, c.expected)
+		}
+	})
+	Convey("The placeholders should be reordered by the parameter numbers", t, func() {
+		q := rewriteQuery(`UPDATE t SET a = $2, b = $1 WHERE c = $2 AND d = '$3'`, "db")
+		So(q.query, ShouldEqual, `UPDATE t SET a = ?, b = ? WHERE c = ? AND d = '$3'`)
+		So(q.params, ShouldResemble, []int{1, 0, 1})
+		So(q.nParams, ShouldEqual, 2)
+		So(q.command, ShouldEqual, "UPDATE")
+		So(q.isRead(), ShouldBeFalse)
+		So(q.args([]interface{}{"x", int64(1)}), ShouldResemble, []interface{}{int64(1), "x", int64(1)})
+	})
+	Convey("The catalog relations should be emulated", t, func() {
+		q := rewriteQuery(`SELECT tablename FROM pg_catalog.pg_tables WHERE schemaname = 'public'`, "db")
+		So(q.query, ShouldStartWith, "SELECT tablename FROM (SELECT 'public' AS schemaname, name AS tablename")
+		So(q.query, ShouldEndWith, ") AS `pg_tables` WHERE schemaname = 'public'")
+		So(q.isRead(), ShouldBeTrue)
+
+		q = rewriteQuery(`SELECT c.column_name FROM information_schema.columns c WHERE c.table_name = $1`, "db")
+		So(q.query, ShouldContainSubstring, "FROM information_schema.COLUMNS")
+		So(q.query, ShouldNotContainSubstring, "AS `columns`")
+		So(q.query, ShouldEndWith, ") c WHERE c.table_name = ?")
+
+		q = rewriteQuery(`SELECT table_name FROM information_schema.tables`, "db")
+		So(q.query, ShouldContainSubstring, "'db' AS table_catalog")
+		So(q.query, ShouldEndWith, ") AS `tables`")
+	})
+}
+
+func TestEncodeValue(t *testing.T) {
+	Convey("The values should be encoded in text format", t, func() {
+		var cases = []struct {
+			value    interface{}
+			oid      uint32
+			expected []byte
+		}{
+			{nil, oidText, nil},
+			{int64(1), oidInt8, []byte("1")},
+			{1.5, oidFloat8, []byte("1.5")},
+			{true, oidBool, []byte("t")},
+			{int64(0), oidBool, []byte("f")},
+			{[]byte{0xab}, oidBytea, []byte(`\xab`)},
+			{"a", oidText, []byte("a")},
+		}
+		for _, c := range cases {
+			data, err := encodeValue(c.value, c.oid, formatText)
+			So(err, ShouldBeNil)
+			So(data, ShouldResemble, c.expected)
+		}
+	})
+	Convey("The values should be encoded in binary format", t, func() {
+		data, err := encodeValue(int64(-2), oidInt8, formatBinary)
+		So(err, ShouldBeNil)
+		So(int64(binary.BigEndian.Uint64(data)), ShouldEqual, -2)
+		data, err = encodeValue("x", oidInt8, formatBinary)
+		So(err, ShouldNotBeNil)
+	})
+	Convey("The parameters should be decoded by the types", t, func() {
+		v, err := decodeParam([]byte("42"), oidInt4, formatText)
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, int64(42))
+		v, err = decodeParam([]byte("on"), oidBool, formatText)
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, true)
+		v, err = decodeParam([]byte(`\x0102`), oidBytea, formatText)
+		So(err, ShouldBeNil)
+		So(v, ShouldResemble, []byte{1, 2})
+		v, err = decodeParam([]byte{0, 0, 0, 7}, oidInt4, formatBinary)
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, int64(7))
+		v, err = decodeParam(nil, oidText, formatText)
+		So(err, ShouldBeNil)
+		So(v, ShouldBeNil)
+		_, err = decodeParam([]byte("x"), oidInt8, formatText)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"net"
+
+	"github.com/CovenantSQL/CovenantSQL/cmd/internal/adapteruser"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+// Server defines the main logic of postgresql protocol adapter.
+type Server struct {
+	listenAddr string
+	listener   net.Listener
+	users      map[string]*adapteruser.User
+}
+
+// NewServer bind the service port and return a runnable adapter, the clients are authenticated
+// as the postgresql users of users.
+func NewServer(listenAddr string, users map[string]*adapteruser.User) (s *Server, err error) {
+	s = &Server{
+		listenAddr: listenAddr,
+		users:      users,
+	}
+
+	if s.listener, err = net.Listen("tcp", listenAddr); err != nil {
+		return
+	}
+
+	return
+}
+
+// Serve starts the server.
+func (s *Server) Serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.handleConn(conn)
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	wc := newWireConn(conn)
+	defer wc.close()
+
+	if err := newSession(s, wc).serve(); err != nil && err != errTerminated {
+		log.WithError(err).Debug("process connection failed")
+	}
+}
+
+// Shutdown ends the server.
+func (s *Server) Shutdown() {
+	s.listener.Close()
+}
@@ -0,0 +1,692 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"strings"
+
+	"github.com/CovenantSQL/CovenantSQL/cmd/internal/adapteruser"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// serverVersion is the PostgreSQL version reported to clients.
+	serverVersion = "10.0"
+	// serverVersionString is the result of version().
+	serverVersionString = "PostgreSQL 10.0 on CovenantSQL"
+	// defaultSchema is the schema of all the tables.
+	defaultSchema = "public"
+	// tableOwner is the owner of all the tables.
+	tableOwner = "covenantsql"
+)
+
+var (
+	// serverParameters are reported to clients after startup, and available to SHOW statements.
+	serverParameters = []struct {
+		name  string
+		value string
+	}{
+		{"server_version", serverVersion},
+		{"server_encoding", "UTF8"},
+		{"client_encoding", "UTF8"},
+		{"DateStyle", "ISO, MDY"},
+		{"TimeZone", "UTC"},
+		{"integer_datetimes", "on"},
+		{"standard_conforming_strings", "on"},
+		{"is_superuser", "off"},
+		{"transaction_isolation", "serializable"},
+	}
+
+	errTerminated = errors.New("connection terminated")
+)
+
+func serverParameter(name string) (value string, ok bool) {
+	for _, p := range serverParameters {
+		if strings.EqualFold(p.name, name) {
+			return p.value, true
+		}
+	}
+	return
+}
+
+// preparedStmt is a statement prepared by Parse.
+type preparedStmt struct {
+	query     *pgQuery
+	paramOIDs []uint32
+}
+
+// portal is a statement bound with parameters by Bind.
+type portal struct {
+	stmt    *preparedStmt
+	params  []interface{}
+	formats []int16 // the result column formats of Bind
+	result  *result // the execution result, nil before execution
+	sent    int     // the number of rows sent by Execute
+}
+
+// session serves the frontend/backend protocol of a client connection.
+type session struct {
+	conn    *wireConn
+	server  *Server
+	cursor  *Cursor
+	stmts   map[string]*preparedStmt
+	portals map[string]*portal
+
+	// ignoreTillSync is set on errors of the extended query messages, the messages are discarded
+	// until Sync
+	ignoreTillSync bool
+	// closed is set on fatal errors
+	closed bool
+}
+
+func newSession(s *Server, conn *wireConn) *session {
+	return &session{
+		conn:    conn,
+		server:  s,
+		cursor:  NewCursor(s),
+		stmts:   make(map[string]*preparedStmt),
+		portals: make(map[string]*portal),
+	}
+}
+
+// serve runs the session until the connection is terminated.
+func (s *session) serve() (err error) {
+	defer s.cursor.Close()
+
+	if err = s.startup(); err != nil {
+		return
+	}
+
+	return s.loop()
+}
+
+// loop processes the messages after startup.
+func (s *session) loop() (err error) {
+	for {
+		var (
+			typ  byte
+			body *readBuffer
+		)
+		if typ, body, err = s.conn.readMessage(); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+
+		if s.ignoreTillSync && typ != msgSync && typ != msgTerminate {
+			continue
+		}
+
+		switch typ {
+		case msgQuery:
+			err = s.handleQuery(body)
+		case msgParse:
+			err = s.extended(s.handleParse(body))
+		case msgBind:
+			err = s.extended(s.handleBind(body))
+		case msgDescribe:
+			err = s.extended(s.handleDescribe(body))
+		case msgExecute:
+			err = s.extended(s.handleExecute(body))
+		case msgClose:
+			err = s.extended(s.handleClose(body))
+		case msgSync:
+			s.ignoreTillSync = false
+			err = s.readyForQuery()
+		case msgFlush:
+			err = s.conn.flush()
+		case msgTerminate:
+			return
+		default:
+			err = s.extended(newError(codeProtocolViolation, "invalid message type %q", typ))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// startup processes the startup packets and authentication.
+func (s *session) startup() (err error) {
+	var params = make(map[string]string)
+
+	for {
+		var (
+			code uint32
+			body *readBuffer
+		)
+		if code, body, err = s.conn.readStartup(); err != nil {
+			return
+		}
+
+		switch code {
+		case sslRequestCode, gssEncRequestCode:
+			// encryption is not supported, the client continues with a plain startup message
+			if err = s.conn.writeMessage(0, (&writeBuffer{}).byte('N')); err != nil {
+				return
+			}
+			if err = s.conn.flush(); err != nil {
+				return
+			}
+			continue
+		case cancelRequestCode:
+			return errTerminated
+		case protocolVersion:
+		default:
+			return s.fatal(newError(codeProtocolViolation, "unsupported protocol version %d.%d",
+				code>>16, code&0xffff))
+		}
+
+		for {
+			var key, value string
+			if key, err = body.string(); err != nil || key == "" {
+				break
+			}
+			if value, err = body.string(); err != nil {
+				break
+			}
+			params[key] = value
+		}
+		if err != nil {
+			return s.fatal(newError(codeProtocolViolation, "invalid startup packet"))
+		}
+		break
+	}
+
+	user := params["user"]
+	if s.cursor.user, err = s.authenticate(user); err != nil {
+		return
+	}
+
+	dbName := params["database"]
+	if dbName == "" {
+		dbName = user
+	}
+	if err = s.cursor.UseDB(dbName); err != nil {
+		return s.fatal(err)
+	}
+
+	if err = s.conn.writeMessage(msgAuthentication, (&writeBuffer{}).int32(authOK)); err != nil {
+		return
+	}
+	for _, p := range serverParameters {
+		if err = s.conn.writeMessage(msgParameterStatus,
+			(&writeBuffer{}).string(p.name).string(p.value)); err != nil {
+			return
+		}
+	}
+
+	var key [8]byte
+	if _, err = rand.Read(key[:]); err != nil {
+		return
+	}
+	if err = s.conn.writeMessage(msgBackendKeyData, &writeBuffer{data: key[:]}); err != nil {
+		return
+	}
+
+	log.WithFields(log.Fields{"user": user, "database": dbName}).Info("client connected")
+
+	return s.readyForQuery()
+}
+
+// authenticate checks the password of user by the md5 authentication, and returns the
+// authenticated user.
+func (s *session) authenticate(user string) (u *adapteruser.User, err error) {
+	var ok bool
+	if u, ok = s.server.users[user]; !ok {
+		err = s.fatal(newError(codeInvalidPassword, "password authentication failed for user %q", user))
+		return
+	}
+
+	var salt [4]byte
+	if _, err = rand.Read(salt[:]); err != nil {
+		return
+	}
+	if err = s.conn.writeMessage(msgAuthentication,
+		(&writeBuffer{}).int32(authMD5).byte(salt[0]).byte(salt[1]).byte(salt[2]).byte(salt[3]),
+	); err != nil {
+		return
+	}
+	if err = s.conn.flush(); err != nil {
+		return
+	}
+
+	var (
+		typ      byte
+		body     *readBuffer
+		password string
+	)
+	if typ, body, err = s.conn.readMessage(); err != nil {
+		return
+	}
+	if typ != msgPassword {
+		err = s.fatal(newError(codeProtocolViolation, "expected password message, got %q", typ))
+		return
+	}
+	if password, err = body.string(); err != nil {
+		err = s.fatal(newError(codeProtocolViolation, "invalid password message"))
+		return
+	}
+	if password != md5Password(u.Password, user, salt[:]) {
+		err = s.fatal(newError(codeInvalidPassword, "password authentication failed for user %q", user))
+		return
+	}
+
+	return
+}
+
+// md5Password returns the md5 password response of the client.
+func md5Password(password string, user string, salt []byte) string {
+	inner := md5.Sum([]byte(password + user))
+	outer := md5.Sum(append([]byte(hex.EncodeToString(inner[:])), salt...))
+	return "md5" + hex.EncodeToString(outer[:])
+}
+
+// fatal sends the error and ends the session.
+func (s *session) fatal(e error) (err error) {
+	s.closed = true
+	if err = s.sendError(e); err != nil {
+		return
+	}
+	if err = s.conn.flush(); err != nil {
+		return
+	}
+	return e
+}
+
+// extended handles the error of an extended query message, the messages are ignored until Sync
+// after an error.
+func (s *session) extended(e error) (err error) {
+	if e == nil || s.closed {
+		return e
+	}
+	s.ignoreTillSync = true
+	return s.sendError(e)
+}
+
+func (s *session) sendError(e error) error {
+	pe := toPGError(e)
+	log.WithError(e).Debug("query failed")
+	return s.conn.writeMessage(msgErrorResponse, (&writeBuffer{}).
+		byte('S').string("ERROR").
+		byte('V').string("ERROR").
+		byte('C').string(pe.code).
+		byte('M').string(pe.message).
+		byte(0))
+}
+
+func (s *session) readyForQuery() (err error) {
+	if err = s.conn.writeMessage(msgReadyForQuery, (&writeBuffer{}).byte('I')); err != nil {
+		return
+	}
+	return s.conn.flush()
+}
+
+// handleQuery handles the simple query.
+func (s *session) handleQuery(body *readBuffer) (err error) {
+	var query string
+	if query, err = body.string(); err != nil {
+		return s.fatal(newError(codeProtocolViolation, "invalid query message"))
+	}
+
+	stmts := splitQuery(query)
+	if len(stmts) == 0 {
+		if err = s.conn.writeMessage(msgEmptyQueryResponse, nil); err != nil {
+			return
+		}
+	}
+	for _, stmt := range stmts {
+		q := rewriteQuery(stmt, s.cursor.dbName)
+		if q.nParams > 0 {
+			err = s.sendError(newError(codeProtocolViolation,
+				"bind message supplies 0 parameters, but statement requires %d", q.nParams))
+			break
+		}
+
+		var r *result
+		if r, err = s.cursor.Query(q, nil); err != nil {
+			err = s.sendError(err)
+			break
+		}
+		if r.columns != nil {
+			if err = s.sendRowDescription(r.columns); err != nil {
+				return
+			}
+		}
+		if err = s.sendRows(r, r.columns, 0, len(r.rows)); err != nil {
+			return
+		}
+		if err = s.conn.writeMessage(msgCommandComplete, (&writeBuffer{}).string(r.tag)); err != nil {
+			return
+		}
+	}
+	if err != nil {
+		return
+	}
+
+	return s.readyForQuery()
+}
+
+// handleParse handles the Parse message of the extended query.
+func (s *session) handleParse(body *readBuffer) (err error) {
+	var (
+		name, query string
+		n           int16
+	)
+	if name, err = body.string(); err != nil {
+		return s.fatal(newError(codeProtocolViolation, "invalid parse message"))
+	}
+	if query, err = body.string(); err != nil {
+		return s.fatal(newError(codeProtocolViolation, "invalid parse message"))
+	}
+	if n, err = body.int16(); err != nil {
+		return s.fatal(newError(codeProtocolViolation, "invalid parse message"))
+	}
+
+	stmts := splitQuery(query)
+	if len(stmts) > 1 {
+		return newError(codeFeatureNotSupported, "cannot insert multiple commands into a prepared statement")
+	}
+	if len(stmts) == 0 {
+		stmts = append(stmts, "")
+	}
+
+	stmt := &preparedStmt{query: rewriteQuery(stmts[0], s.cursor.dbName)}
+	stmt.paramOIDs = make([]uint32, stmt.query.nParams)
+	for i := 0; i < int(n); i++ {
+		var oid uint32
+		if oid, err = body.uint32(); err != nil {
+			return s.fatal(newError(codeProtocolViolation, "invalid parse message"))
+		}
+		if i >= len(stmt.paramOIDs) {
+			stmt.paramOIDs = append(stmt.paramOIDs, oid)
+		} else {
+			stmt.paramOIDs[i] = oid
+		}
+	}
+	for i, oid := range stmt.paramOIDs {
+		if oid == 0 {
+			// the parameter types are not inferred, the values are passed as text
+			stmt.paramOIDs[i] = oidText
+		}
+	}
+
+	s.stmts[name] = stmt
+
+	return s.conn.writeMessage(msgParseComplete, nil)
+}
+
+// handleBind handles the Bind message of the extended query.
+func (s *session) handleBind(body *readBuffer) (err error) {
+	var (
+		name, stmtName string
+		stmt           *preparedStmt
+		formats        []int16
+		n              int16
+		ok             bool
+	)
+	if name, err = body.string(); err != nil {
+		return s.fatal(newError(codeProtocolViolation, "invalid bind message"))
+	}
+	if stmtName, err = body.string(); err != nil {
+		return s.fatal(newError(codeProtocolViolation, "invalid bind message"))
+	}
+	if formats, err = readFormats(body); err != nil {
+		return s.fatal(newError(codeProtocolViolation, "invalid bind message"))
+	}
+	if n, err = body.int16(); err != nil {
+		return s.fatal(newError(codeProtocolViolation, "invalid bind message"))
+	}
+	if stmt, ok = s.stmts[stmtName]; !ok {
+		return newError(codeInvalidStatementName, "prepared statement %q does not exist", stmtName)
+	}
+	if int(n) != len(stmt.paramOIDs) {
+		return newError(codeProtocolViolation,
+			"bind message supplies %d parameters, but prepared statement %q requires %d",
+			n, stmtName, len(stmt.paramOIDs))
+	}
+
+	p := &portal{
+		stmt:   stmt,
+		params: make([]interface{}, n),
+	}
+	for i := range p.params {
+		var data []byte
+		if data, err = body.bytes(); err != nil {
+			return s.fatal(newError(codeProtocolViolation, "invalid bind message"))
+		}
+		if p.params[i], err = decodeParam(data, stmt.paramOIDs[i], formatOf(formats, i)); err != nil {
+			return
+		}
+	}
+	if p.formats, err = readFormats(body); err != nil {
+		return s.fatal(newError(codeProtocolViolation, "invalid bind message"))
+	}
+
+	s.portals[name] = p
+
+	return s.conn.writeMessage(msgBindComplete, nil)
+}
+
+// handleDescribe handles the Describe message of the extended query.
+func (s *session) handleDescribe(body *readBuffer) (err error) {
+	var (
+		kind byte
+		name string
+	)
+	if kind, err = body.byte(); err != nil {
+		return s.fatal(newError(codeProtocolViolation, "invalid describe message"))
+	}
+	if name, err = body.string(); err != nil {
+		return s.fatal(newError(codeProtocolViolation, "invalid describe message"))
+	}
+
+	switch kind {
+	case 'S':
+		stmt, ok := s.stmts[name]
+		if !ok {
+			return newError(codeInvalidStatementName, "prepared statement %q does not exist", name)
+		}
+		desc := &writeBuffer{}
+		desc.int16(int16(len(stmt.paramOIDs)))
+		for _, oid := range stmt.paramOIDs {
+			desc.int32(int32(oid))
+		}
+		if err = s.conn.writeMessage(msgParameterDescription, desc); err != nil {
+			return
+		}
+		if !stmt.query.isRead() {
+			return s.conn.writeMessage(msgNoData, nil)
+		}
+		// the result columns are not known until execution, the statement is executed with
+		// null parameters to describe the columns
+		var r *result
+		if r, err = s.cursor.Query(stmt.query, make([]interface{}, len(stmt.query.params))); err != nil {
+			return
+		}
+		return s.sendRowDescription(r.columns)
+	case 'P':
+		p, ok := s.portals[name]
+		if !ok {
+			return newError(codeInvalidCursorName, "portal %q does not exist", name)
+		}
+		if !p.stmt.query.isRead() {
+			return s.conn.writeMessage(msgNoData, nil)
+		}
+		if err = s.execute(p); err != nil {
+			return
+		}
+		return s.sendRowDescription(p.columns())
+	default:
+		return newError(codeProtocolViolation, "invalid describe kind %q", kind)
+	}
+}
+
+// handleExecute handles the Execute message of the extended query.
+func (s *session) handleExecute(body *readBuffer) (err error) {
+	var (
+		name    string
+		maxRows int32
+	)
+	if name, err = body.string(); err != nil {
+		return s.fatal(newError(codeProtocolViolation, "invalid execute message"))
+	}
+	if maxRows, err = body.int32(); err != nil {
+		return s.fatal(newError(codeProtocolViolation, "invalid execute message"))
+	}
+
+	p, ok := s.portals[name]
+	if !ok {
+		return newError(codeInvalidCursorName, "portal %q does not exist", name)
+	}
+	if p.stmt.query.query == "" {
+		return s.conn.writeMessage(msgEmptyQueryResponse, nil)
+	}
+	if err = s.execute(p); err != nil {
+		return
+	}
+
+	end := len(p.result.rows)
+	if maxRows > 0 && p.sent+int(maxRows) < end {
+		end = p.sent + int(maxRows)
+	}
+	if err = s.sendRows(p.result, p.columns(), p.sent, end); err != nil {
+		return
+	}
+	if p.sent = end; p.sent < len(p.result.rows) {
+		return s.conn.writeMessage(msgPortalSuspended, nil)
+	}
+
+	return s.conn.writeMessage(msgCommandComplete, (&writeBuffer{}).string(p.result.tag))
+}
+
+// handleClose handles the Close message of the extended query.
+func (s *session) handleClose(body *readBuffer) (err error) {
+	var (
+		kind byte
+		name string
+	)
+	if kind, err = body.byte(); err != nil {
+		return s.fatal(newError(codeProtocolViolation, "invalid close message"))
+	}
+	if name, err = body.string(); err != nil {
+		return s.fatal(newError(codeProtocolViolation, "invalid close message"))
+	}
+
+	switch kind {
+	case 'S':
+		delete(s.stmts, name)
+	case 'P':
+		delete(s.portals, name)
+	default:
+		return newError(codeProtocolViolation, "invalid close kind %q", kind)
+	}
+
+	return s.conn.writeMessage(msgCloseComplete, nil)
+}
+
+// execute executes the statement of the portal once.
+func (s *session) execute(p *portal) (err error) {
+	if p.result != nil {
+		return
+	}
+	p.result, err = s.cursor.Query(p.stmt.query, p.stmt.query.args(p.params))
+	return
+}
+
+// columns returns the result columns in the formats of Bind.
+func (p *portal) columns() (columns []column) {
+	if p.result == nil || p.result.columns == nil {
+		return
+	}
+	columns = make([]column, len(p.result.columns))
+	for i, c := range p.result.columns {
+		c.format = formatOf(p.formats, i)
+		columns[i] = c
+	}
+	return
+}
+
+func (s *session) sendRowDescription(columns []column) error {
+	if columns == nil {
+		return s.conn.writeMessage(msgNoData, nil)
+	}
+	desc := &writeBuffer{}
+	desc.int16(int16(len(columns)))
+	for _, c := range columns {
+		desc.string(c.name).
+			int32(0). // table OID
+			int16(0). // column attribute number
+			int32(int32(c.oid)).
+			int16(typeSize(c.oid)).
+			int32(-1). // type modifier
+			int16(c.format)
+	}
+	return s.conn.writeMessage(msgRowDescription, desc)
+}
+
+// sendRows sends the rows in range [start, end) of the result.
+func (s *session) sendRows(r *result, columns []column, start, end int) (err error) {
+	for _, row := range r.rows[start:end] {
+		data := &writeBuffer{}
+		data.int16(int16(len(row)))
+		for i, v := range row {
+			var value []byte
+			if value, err = encodeValue(v, columns[i].oid, columns[i].format); err != nil {
+				return
+			}
+			data.bytes(value)
+		}
+		if err = s.conn.writeMessage(msgDataRow, data); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// readFormats reads the format codes of the Bind message.
+func readFormats(body *readBuffer) (formats []int16, err error) {
+	var n int16
+	if n, err = body.int16(); err != nil {
+		return
+	}
+	formats = make([]int16, n)
+	for i := range formats {
+		if formats[i], err = body.int16(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// formatOf returns the format of the i-th value, a single format applies to all the values.
+func formatOf(formats []int16, i int) int16 {
+	switch {
+	case len(formats) == 1:
+		return formats[0]
+	case i < len(formats):
+		return formats[i]
+	default:
+		return formatText
+	}
+}
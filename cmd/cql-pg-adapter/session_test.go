@@ -0,0 +1,190 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/cmd/internal/adapteruser"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type testClient struct {
+	conn net.Conn
+}
+
+func (c *testClient) send(typ byte, body *writeBuffer) {
+	var data []byte
+	if body != nil {
+		data = body.data
+	}
+	msg := make([]byte, 4, len(data)+5)
+	binary.BigEndian.PutUint32(msg, uint32(len(data)+4))
+	if typ != 0 {
+		msg = append([]byte{typ}, msg...)
+	}
+	c.conn.Write(append(msg, data...))
+}
+
+func (c *testClient) receive() (typ byte, body *readBuffer, err error) {
+	var header [5]byte
+	if _, err = io.ReadFull(c.conn, header[:]); err != nil {
+		return
+	}
+	data := make([]byte, binary.BigEndian.Uint32(header[1:])-4)
+	if _, err = io.ReadFull(c.conn, data); err != nil {
+		return
+	}
+	return header[0], &readBuffer{data: data}, nil
+}
+
+// receiveUntil returns the types of the messages until the message type.
+func (c *testClient) receiveUntil(until byte) (types []byte, err error) {
+	for {
+		var typ byte
+		if typ, _, err = c.receive(); err != nil {
+			return
+		}
+		if types = append(types, typ); typ == until {
+			return
+		}
+	}
+}
+
+func (c *testClient) startup(user string, dbName string) {
+	c.send(0, (&writeBuffer{}).int32(protocolVersion).
+		string("user").string(user).
+		string("database").string(dbName).
+		byte(0))
+}
+
+func TestSession(t *testing.T) {
+	Convey("Given a session with password authentication", t, func() {
+		var (
+			server *Server
+			conn   net.Conn
+			client *testClient
+			typ    byte
+			body   *readBuffer
+			types  []byte
+			users  map[string]*adapteruser.User
+			err    error
+		)
+		users, err = adapteruser.Load([]adapteruser.Config{
+			{User: "root", Password: "calvin", Databases: []string{"db"}},
+		}, "")
+		So(err, ShouldBeNil)
+		server, err = NewServer("127.0.0.1:0", users)
+		So(err, ShouldBeNil)
+		go server.Serve()
+		Reset(func() {
+			server.Shutdown()
+		})
+		conn, err = net.Dial("tcp", server.listener.Addr().String())
+		So(err, ShouldBeNil)
+		Reset(func() {
+			conn.Close()
+		})
+		client = &testClient{conn: conn}
+
+		Convey("The SSL request should be declined", func() {
+			client.send(0, (&writeBuffer{}).int32(sslRequestCode))
+			var b [1]byte
+			_, err = io.ReadFull(conn, b[:])
+			So(err, ShouldBeNil)
+			So(b[0], ShouldEqual, 'N')
+		})
+		Convey("The unknown user should be rejected", func() {
+			client.startup("alice", "db")
+			typ, body, err = client.receive()
+			So(err, ShouldBeNil)
+			So(typ, ShouldEqual, msgErrorResponse)
+			So(string(body.data), ShouldContainSubstring, codeInvalidPassword)
+		})
+		Convey("The database not allowed for the user should be rejected", func() {
+			client.startup("root", "other")
+			typ, body, err = client.receive()
+			So(err, ShouldBeNil)
+			So(typ, ShouldEqual, msgAuthentication)
+			client.send(msgPassword, (&writeBuffer{}).string(md5Password("calvin", "root", body.data[4:])))
+			typ, body, err = client.receive()
+			So(err, ShouldBeNil)
+			So(typ, ShouldEqual, msgErrorResponse)
+			So(string(body.data), ShouldContainSubstring, codeInsufficientPrivilege)
+		})
+		Convey("The md5 password should be verified", func() {
+			client.startup("root", "db")
+			typ, body, err = client.receive()
+			So(err, ShouldBeNil)
+			So(typ, ShouldEqual, msgAuthentication)
+			code, _ := body.int32()
+			So(code, ShouldEqual, authMD5)
+			salt := body.data
+
+			Convey("The wrong password should be rejected", func() {
+				client.send(msgPassword, (&writeBuffer{}).string(md5Password("pass", "root", salt)))
+				typ, body, err = client.receive()
+				So(err, ShouldBeNil)
+				So(typ, ShouldEqual, msgErrorResponse)
+				So(string(body.data), ShouldContainSubstring, codeInvalidPassword)
+			})
+			Convey("The session should be ready for query with the right password", func() {
+				client.send(msgPassword, (&writeBuffer{}).string(md5Password("calvin", "root", salt)))
+				typ, body, err = client.receive()
+				So(err, ShouldBeNil)
+				So(typ, ShouldEqual, msgAuthentication)
+				code, _ = body.int32()
+				So(code, ShouldEqual, authOK)
+				types, err = client.receiveUntil(msgReadyForQuery)
+				So(err, ShouldBeNil)
+				So(types, ShouldContain, byte(msgParameterStatus))
+				So(types, ShouldContain, byte(msgBackendKeyData))
+
+				Convey("The special queries should be processed by the adapter", func() {
+					client.send(msgQuery, (&writeBuffer{}).string("BEGIN; SHOW server_version; COMMIT"))
+					types, err = client.receiveUntil(msgReadyForQuery)
+					So(err, ShouldBeNil)
+					So(string(types), ShouldEqual, "CTDCCZ")
+				})
+				Convey("The extended query messages should be skipped until sync after an error", func() {
+					client.send(msgBind, (&writeBuffer{}).string("").string("none").
+						int16(0).int16(0).int16(0))
+					client.send(msgExecute, (&writeBuffer{}).string("").int32(0))
+					client.send(msgSync, nil)
+					types, err = client.receiveUntil(msgReadyForQuery)
+					So(err, ShouldBeNil)
+					So(string(types), ShouldEqual, "EZ")
+				})
+				Convey("The prepared statement should be described", func() {
+					client.send(msgParse, (&writeBuffer{}).string("s").
+						string("SET search_path = $1").int16(0))
+					client.send(msgDescribe, (&writeBuffer{}).byte('S').string("s"))
+					client.send(msgBind, (&writeBuffer{}).string("").string("s").
+						int16(0).int16(1).bytes([]byte("public")).int16(0))
+					client.send(msgExecute, (&writeBuffer{}).string("").int32(0))
+					client.send(msgSync, nil)
+					types, err = client.receiveUntil(msgReadyForQuery)
+					So(err, ShouldBeNil)
+					So(string(types), ShouldEqual, "1tn2CZ")
+				})
+			})
+		})
+	})
+}
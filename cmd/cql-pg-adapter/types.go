@@ -0,0 +1,337 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/types"
+)
+
+// Type OIDs of the PostgreSQL built-in types.
+const (
+	oidBool      = 16
+	oidBytea     = 17
+	oidInt8      = 20
+	oidInt2      = 21
+	oidInt4      = 23
+	oidText      = 25
+	oidFloat4    = 700
+	oidFloat8    = 701
+	oidUnknown   = 705
+	oidVarchar   = 1043
+	oidTimestamp = 1114
+)
+
+const (
+	formatText   = 0
+	formatBinary = 1
+
+	// timestampFormat is the text output format of timestamp values.
+	timestampFormat = "2006-01-02 15:04:05.999999"
+)
+
+var (
+	// postgresEpoch is the zero time of the binary timestamp values.
+	postgresEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// typeSize returns the size of the fixed length type, or -1 for the variable length types.
+func typeSize(oid uint32) int16 {
+	switch oid {
+	case oidBool:
+		return 1
+	case oidInt2:
+		return 2
+	case oidInt4, oidFloat4:
+		return 4
+	case oidInt8, oidFloat8, oidTimestamp:
+		return 8
+	default:
+		return -1
+	}
+}
+
+// columnOID returns the type OID of a result column by the declared column type, the column
+// without declared type, e.g. an expression column, takes the type of its first non-null value.
+func columnOID(declType string, rows [][]interface{}, column int) uint32 {
+	switch types.ParseColumnMeta(declType, true).Kind {
+	case types.ColumnKindInteger:
+		return oidInt8
+	case types.ColumnKindFloat:
+		return oidFloat8
+	case types.ColumnKindBool:
+		return oidBool
+	case types.ColumnKindBlob:
+		return oidBytea
+	case types.ColumnKindDatetime:
+		return oidTimestamp
+	case types.ColumnKindText, types.ColumnKindDecimal:
+		// decimals are sent as text to keep the precision
+		return oidText
+	}
+
+	for _, row := range rows {
+		switch row[column].(type) {
+		case nil:
+			continue
+		case int64:
+			return oidInt8
+		case float64:
+			return oidFloat8
+		case bool:
+			return oidBool
+		case time.Time:
+			return oidTimestamp
+		default:
+			return oidText
+		}
+	}
+	return oidText
+}
+
+// encodeValue encodes a result value of the column type in the format.
+func encodeValue(v interface{}, oid uint32, format int16) (data []byte, err error) {
+	if v == nil {
+		return
+	}
+	if format == formatBinary {
+		return encodeBinary(v, oid)
+	}
+	return encodeText(v, oid), nil
+}
+
+func encodeText(v interface{}, oid uint32) []byte {
+	if oid == oidBool {
+		// booleans are stored as integers in SQLite
+		if b, err := toBool(v); err == nil {
+			v = b
+		}
+	}
+
+	switch x := v.(type) {
+	case int64:
+		return strconv.AppendInt(nil, x, 10)
+	case float64:
+		return strconv.AppendFloat(nil, x, 'g', -1, 64)
+	case bool:
+		if x {
+			return []byte("t")
+		}
+		return []byte("f")
+	case time.Time:
+		return []byte(x.Format(timestampFormat))
+	case []byte:
+		if oid == oidBytea {
+			return []byte(`\x` + hex.EncodeToString(x))
+		}
+		return x
+	case string:
+		if oid == oidBytea {
+			return []byte(`\x` + hex.EncodeToString([]byte(x)))
+		}
+		return []byte(x)
+	default:
+		return []byte(fmt.Sprint(x))
+	}
+}
+
+func encodeBinary(v interface{}, oid uint32) (data []byte, err error) {
+	switch oid {
+	case oidInt8:
+		var i int64
+		if i, err = toInt64(v); err == nil {
+			data = make([]byte, 8)
+			binary.BigEndian.PutUint64(data, uint64(i))
+		}
+	case oidFloat8:
+		var f float64
+		if f, err = toFloat64(v); err == nil {
+			data = make([]byte, 8)
+			binary.BigEndian.PutUint64(data, math.Float64bits(f))
+		}
+	case oidBool:
+		var b bool
+		if b, err = toBool(v); err == nil {
+			data = []byte{0}
+			if b {
+				data[0] = 1
+			}
+		}
+	case oidTimestamp:
+		t, ok := v.(time.Time)
+		if !ok {
+			err = newError(codeInvalidParameterValue, "cannot encode %T as binary timestamp", v)
+			return
+		}
+		data = make([]byte, 8)
+		binary.BigEndian.PutUint64(data, uint64(t.Sub(postgresEpoch)/time.Microsecond))
+	default:
+		// the binary format of text and bytea is the raw bytes
+		switch x := v.(type) {
+		case []byte:
+			data = x
+		case string:
+			data = []byte(x)
+		default:
+			data = encodeText(v, oid)
+		}
+	}
+	return
+}
+
+func toInt64(v interface{}) (i int64, err error) {
+	switch x := v.(type) {
+	case int64:
+		i = x
+	case float64:
+		i = int64(x)
+	case bool:
+		if x {
+			i = 1
+		}
+	case string:
+		i, err = strconv.ParseInt(x, 10, 64)
+	case []byte:
+		i, err = strconv.ParseInt(string(x), 10, 64)
+	default:
+		err = newError(codeInvalidParameterValue, "cannot encode %T as binary int8", v)
+	}
+	return
+}
+
+func toFloat64(v interface{}) (f float64, err error) {
+	switch x := v.(type) {
+	case int64:
+		f = float64(x)
+	case float64:
+		f = x
+	case string:
+		f, err = strconv.ParseFloat(x, 64)
+	case []byte:
+		f, err = strconv.ParseFloat(string(x), 64)
+	default:
+		err = newError(codeInvalidParameterValue, "cannot encode %T as binary float8", v)
+	}
+	return
+}
+
+func toBool(v interface{}) (b bool, err error) {
+	switch x := v.(type) {
+	case bool:
+		b = x
+	case int64:
+		b = x != 0
+	case float64:
+		b = x != 0
+	case string:
+		b, err = strconv.ParseBool(x)
+	case []byte:
+		b, err = strconv.ParseBool(string(x))
+	default:
+		err = newError(codeInvalidParameterValue, "cannot encode %T as binary bool", v)
+	}
+	return
+}
+
+// decodeParam decodes a Bind parameter of the type in the format, the unknown types are passed as
+// string in text format and as []byte in binary format.
+func decodeParam(data []byte, oid uint32, format int16) (v interface{}, err error) {
+	if data == nil {
+		return
+	}
+
+	if format == formatText {
+		s := string(data)
+		switch oid {
+		case oidInt2, oidInt4, oidInt8:
+			v, err = strconv.ParseInt(s, 10, 64)
+		case oidFloat4, oidFloat8:
+			v, err = strconv.ParseFloat(s, 64)
+		case oidBool:
+			switch strings.ToLower(s) {
+			case "t", "true", "y", "yes", "on", "1":
+				v = true
+			case "f", "false", "n", "no", "off", "0":
+				v = false
+			default:
+				err = newError(codeInvalidParameterValue, "invalid boolean value %q", s)
+			}
+		case oidBytea:
+			if strings.HasPrefix(s, `\x`) {
+				v, err = hex.DecodeString(s[2:])
+			} else {
+				v = data
+			}
+		default:
+			v = s
+		}
+		if err != nil {
+			err = newError(codeInvalidParameterValue, "invalid parameter value: %v", err)
+		}
+		return
+	}
+
+	switch oid {
+	case oidInt2, oidInt4, oidInt8:
+		switch len(data) {
+		case 2:
+			v = int64(int16(binary.BigEndian.Uint16(data)))
+		case 4:
+			v = int64(int32(binary.BigEndian.Uint32(data)))
+		case 8:
+			v = int64(binary.BigEndian.Uint64(data))
+		default:
+			err = newError(codeInvalidParameterValue, "invalid binary integer of %d bytes", len(data))
+		}
+	case oidFloat4:
+		if len(data) != 4 {
+			err = newError(codeInvalidParameterValue, "invalid binary float4 of %d bytes", len(data))
+			return
+		}
+		v = float64(math.Float32frombits(binary.BigEndian.Uint32(data)))
+	case oidFloat8:
+		if len(data) != 8 {
+			err = newError(codeInvalidParameterValue, "invalid binary float8 of %d bytes", len(data))
+			return
+		}
+		v = math.Float64frombits(binary.BigEndian.Uint64(data))
+	case oidBool:
+		if len(data) != 1 {
+			err = newError(codeInvalidParameterValue, "invalid binary bool of %d bytes", len(data))
+			return
+		}
+		v = data[0] != 0
+	case oidTimestamp:
+		if len(data) != 8 {
+			err = newError(codeInvalidParameterValue, "invalid binary timestamp of %d bytes", len(data))
+			return
+		}
+		v = postgresEpoch.Add(time.Duration(int64(binary.BigEndian.Uint64(data))) * time.Microsecond)
+	case oidText, oidVarchar, oidUnknown:
+		v = string(data)
+	default:
+		v = data
+	}
+	return
+}
@@ -21,7 +21,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 	"gopkg.in/yaml.v2"
@@ -37,6 +39,9 @@ type adapterConfig struct {
 	WriteCerts        []string `yaml:"WriteCerts"`
 	StorageDriver     string   `yaml:"StorageDriver"`
 	StorageRoot       string   `yaml:"StorageRoot"`
+	AdvancePayment    uint64   `yaml:"AdvancePayment"`
+	GasPrice          uint64   `yaml:"GasPrice"`
+	CreateTimeout     string   `yaml:"CreateTimeout"`
 }
 
 var (
@@ -50,6 +55,9 @@ var (
 		WriteCerts:        []string{},
 		StorageDriver:     "covenantsql",
 		StorageRoot:       "",
+		AdvancePayment:    0,
+		GasPrice:          1,
+		CreateTimeout:     "3m",
 	}
 )
 
@@ -146,6 +154,45 @@ func (c *adapterConfig) readStorageRoot() {
 	}
 }
 
+func (c *adapterConfig) readAdvancePayment() {
+	for {
+		newAdvancePayment := readDataFromStdin("AdvancePayment (default: %v)", c.AdvancePayment)
+		if newAdvancePayment == "" {
+			return
+		}
+		if v, err := strconv.ParseUint(newAdvancePayment, 10, 64); err == nil {
+			c.AdvancePayment = v
+			return
+		}
+	}
+}
+
+func (c *adapterConfig) readGasPrice() {
+	for {
+		newGasPrice := readDataFromStdin("GasPrice (default: %v)", c.GasPrice)
+		if newGasPrice == "" {
+			return
+		}
+		if v, err := strconv.ParseUint(newGasPrice, 10, 64); err == nil {
+			c.GasPrice = v
+			return
+		}
+	}
+}
+
+func (c *adapterConfig) readCreateTimeout() {
+	for {
+		newCreateTimeout := readDataFromStdin("CreateTimeout (default: %v)", c.CreateTimeout)
+		if newCreateTimeout == "" {
+			return
+		}
+		if _, err := time.ParseDuration(newCreateTimeout); err == nil {
+			c.CreateTimeout = newCreateTimeout
+			return
+		}
+	}
+}
+
 func (c *adapterConfig) loadFromExistingConfig(rawConfig yaml.MapSlice) {
 	if rawConfig == nil {
 		return
@@ -216,6 +263,12 @@ func (c *adapterConfig) readAllConfig() {
 
 	c.readStorageDriver()
 	c.readStorageRoot()
+
+	if c.StorageDriver == "covenantsql" {
+		c.readAdvancePayment()
+		c.readGasPrice()
+		c.readCreateTimeout()
+	}
 }
 
 func readDataFromStdin(prompt string, values ...interface{}) (s string) {
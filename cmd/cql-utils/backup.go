@@ -0,0 +1,163 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/CovenantSQL/CovenantSQL/client"
+	"github.com/CovenantSQL/CovenantSQL/conf"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	backupDatabaseID string
+	backupEndpoint   string
+	backupPath       string
+	restoreForce     bool
+)
+
+func init() {
+	flag.StringVar(&backupDatabaseID, "backup-db", "", "database id to backup")
+	flag.StringVar(&backupEndpoint, "backup-endpoint", "", "miner node id to backup, defaults to the local node")
+	flag.StringVar(&backupPath, "backup-path", "", "backup bundle dir, on the miner host for backup")
+	flag.BoolVar(&restoreForce, "restore-force", false, "overwrite the existing database data dir on restore")
+}
+
+func runBackup() {
+	if configFile == "" || backupDatabaseID == "" || backupPath == "" {
+		log.Error("config file, database id and backup path are required for backup tool")
+		os.Exit(1)
+	}
+
+	if err := client.Init(configFile, []byte("")); err != nil {
+		fmt.Printf("init rpc client failed: %v\n", err)
+		os.Exit(1)
+		return
+	}
+
+	var endpoint = proto.NodeID(backupEndpoint)
+	if endpoint == "" {
+		var err error
+		if endpoint, err = kms.GetLocalNodeID(); err != nil {
+			fmt.Printf("get local node id failed: %v\n", err)
+			os.Exit(1)
+			return
+		}
+	}
+
+	var (
+		req = &types.BackupRequest{
+			DatabaseID: proto.DatabaseID(backupDatabaseID),
+			Path:       backupPath,
+		}
+		resp = &types.BackupResponse{}
+	)
+	if err := rpc.NewCaller().CallNode(endpoint, route.DBSBackup.String(), req, resp); err != nil {
+		fmt.Printf("call backup rpc failed: %v\n", err)
+		os.Exit(1)
+		return
+	}
+
+	if resBytes, err := yaml.Marshal(resp.Manifest); err != nil {
+		fmt.Printf("marshal backup manifest failed: %v\n", err)
+		os.Exit(1)
+	} else {
+		fmt.Println(string(resBytes))
+	}
+}
+
+func runRestore() {
+	if configFile == "" || backupPath == "" {
+		log.Error("config file and backup path are required for restore tool")
+		os.Exit(1)
+	}
+
+	// restore is done offline, the miner must be stopped
+	config, err := conf.LoadConfig(configFile)
+	if err != nil {
+		fmt.Printf("load config failed: %v\n", err)
+		os.Exit(1)
+		return
+	}
+	if config.Miner == nil {
+		log.Error("miner config is required for restore tool")
+		os.Exit(1)
+	}
+
+	var (
+		manifest types.BackupManifest
+		enc      []byte
+	)
+	if enc, err = ioutil.ReadFile(filepath.Join(backupPath, types.BackupManifestFileName)); err != nil {
+		fmt.Printf("read backup manifest failed: %v\n", err)
+		os.Exit(1)
+		return
+	}
+	if err = json.Unmarshal(enc, &manifest); err != nil {
+		fmt.Printf("decode backup manifest failed: %v\n", err)
+		os.Exit(1)
+		return
+	}
+	if backupDatabaseID != "" && proto.DatabaseID(backupDatabaseID) != manifest.DatabaseID {
+		fmt.Printf("database id mismatched: %s in backup manifest\n", manifest.DatabaseID)
+		os.Exit(1)
+		return
+	}
+	if manifest.StorageEngine == types.StorageEngineMemory {
+		log.Error("can not restore a database of the in-memory storage engine")
+		os.Exit(1)
+	}
+
+	dataDir := filepath.Join(config.Miner.RootDir, string(manifest.DatabaseID))
+	if _, err = os.Stat(dataDir); err == nil {
+		if !restoreForce {
+			fmt.Printf("data dir %s already exists, use -restore-force to overwrite\n", dataDir)
+			os.Exit(1)
+			return
+		}
+		if err = os.RemoveAll(dataDir); err != nil {
+			fmt.Printf("remove data dir failed: %v\n", err)
+			os.Exit(1)
+			return
+		}
+	}
+	if err = utils.CopyDir(backupPath, dataDir); err != nil {
+		fmt.Printf("copy backup bundle failed: %v\n", err)
+		os.Exit(1)
+		return
+	}
+	if err = os.Remove(filepath.Join(dataDir, types.BackupManifestFileName)); err != nil {
+		fmt.Printf("remove backup manifest failed: %v\n", err)
+		os.Exit(1)
+		return
+	}
+
+	fmt.Printf("restored database %s at height %d to %s\n", manifest.DatabaseID, manifest.Height, dataDir)
+}
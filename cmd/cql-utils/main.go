@@ -41,7 +41,7 @@ const name = "cql-utils"
 func init() {
 	log.SetLevel(log.InfoLevel)
 
-	flag.StringVar(&tool, "tool", "", "tool type, miner, keygen, keytool, rpc, nonce, confgen, addrgen, adapterconfgen")
+	flag.StringVar(&tool, "tool", "", "tool type, miner, keygen, keytool, rpc, nonce, confgen, addrgen, adapterconfgen, backup, restore")
 	flag.StringVar(&publicKeyHex, "public", "", "public key hex string to mine node id/nonce")
 	flag.StringVar(&privateKeyFile, "private", "private.key", "private key file to generate/show")
 	flag.StringVar(&configFile, "config", "config.yaml", "config file to use")
@@ -93,6 +93,10 @@ func main() {
 			os.Exit(1)
 		}
 		runAddrgen()
+	case "backup":
+		runBackup()
+	case "restore":
+		runRestore()
 	default:
 		flag.Usage()
 		os.Exit(1)
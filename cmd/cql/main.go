@@ -28,6 +28,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/CovenantSQL/go-sqlite3-encrypt"
 	"github.com/xo/dburl"
@@ -40,6 +41,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/client"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
 )
 
 const name = "cql"
@@ -61,6 +63,14 @@ var (
 	createDB   string // as a instance meta json string or simply a node count
 	dropDB     string // database id to drop
 	getBalance bool   // get balance of current account
+	grantUser  string // account address to grant database permission, use with dsn
+	revokeUser string // account address to revoke database permission, use with dsn
+	permission string // permission to grant
+	txFee      uint64 // fee of the main chain transactions
+
+	advancePayment uint64        // advance payment of the created database
+	gasPrice       uint64        // gas price of the created database
+	createTimeout  time.Duration // max time to wait for the created database
 )
 
 type varsFlag struct {
@@ -190,6 +200,13 @@ func init() {
 	flag.StringVar(&createDB, "create", "", "create database, argument can be instance requirement json or simply a node count requirement")
 	flag.StringVar(&dropDB, "drop", "", "drop database, argument should be a database id (without covenantsql:// scheme is acceptable)")
 	flag.BoolVar(&getBalance, "get-balance", false, "get balance of current account")
+	flag.StringVar(&grantUser, "grant", "", "grant permission of the database specified by -dsn to an account address")
+	flag.StringVar(&revokeUser, "revoke", "", "revoke all permissions of the database specified by -dsn from an account address")
+	flag.StringVar(&permission, "perm", "read", "permission to grant, should be one of admin, read and write")
+	flag.Uint64Var(&txFee, "fee", client.DefaultTxFee, "fee of the main chain transactions sent by -create, -grant and -revoke")
+	flag.Uint64Var(&advancePayment, "advance-payment", 0, "advance payment of the database created by -create, which is required and moved to the database deposit")
+	flag.Uint64Var(&gasPrice, "gas-price", client.DefaultGasPrice, "gas price of the database created by -create")
+	flag.DurationVar(&createTimeout, "create-timeout", client.CreationTimeout, "max time to wait for the database created by -create to be deployed")
 }
 
 func main() {
@@ -202,6 +219,8 @@ func main() {
 
 	var err error
 
+	client.DefaultTxFee = txFee
+
 	// init covenantsql driver
 	if err = client.Init(configFile, []byte(password)); err != nil {
 		log.WithError(err).Error("init covenantsql client failed")
@@ -227,6 +246,14 @@ func main() {
 		return
 	}
 
+	if grantUser != "" || revokeUser != "" {
+		if err = updatePermission(); err != nil {
+			log.WithError(err).Error("update database permission failed")
+			os.Exit(-1)
+		}
+		return
+	}
+
 	if dropDB != "" {
 		// drop database
 		if _, err := client.ParseDSN(dropDB); err != nil {
@@ -265,8 +292,18 @@ func main() {
 			meta = client.ResourceMeta{Node: uint16(nodeCnt)}
 		}
 
-		dsn, err := client.Create(meta)
-		if err != nil {
+		if advancePayment == 0 {
+			log.Error("create database failed: advance payment is required, see -advance-payment")
+			os.Exit(-1)
+			return
+		}
+
+		dsn, err := client.CreateAndWait(meta, gasPrice, advancePayment, createTimeout)
+		if errors.Cause(err) == client.ErrCreationTimeout {
+			log.WithField("db", dsn).WithError(err).Error("database is not deployed in time")
+			os.Exit(-1)
+			return
+		} else if err != nil {
 			log.WithError(err).Error("create database failed")
 			os.Exit(-1)
 			return
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"strings"
+
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/client"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
+)
+
+// parseAccountAddress accepts both the base58 wallet address and the hex account hash.
+func parseAccountAddress(s string) (addr proto.AccountAddress, err error) {
+	if _, addr, err = crypto.Addr2Hash(s); err == nil {
+		return
+	}
+	var h *hash.Hash
+	if h, err = hash.NewHashFromStr(s); err != nil {
+		err = errors.Errorf("invalid account address: %s", s)
+		return
+	}
+	addr = proto.AccountAddress(*h)
+	return
+}
+
+func parsePermission(s string) (perm pt.UserPermission, err error) {
+	switch strings.ToLower(s) {
+	case "admin":
+		perm = pt.Admin
+	case "read":
+		perm = pt.Read
+	case "write", "readwrite":
+		perm = pt.ReadWrite
+	default:
+		err = errors.Errorf("invalid permission: %s", s)
+	}
+	return
+}
+
+func updatePermission() (err error) {
+	if dsn == "" {
+		return errors.New("database should be specified by -dsn")
+	}
+	db := dsn
+	if _, err = client.ParseDSN(db); err != nil {
+		// not a dsn
+		cfg := client.NewConfig()
+		cfg.DatabaseID = db
+		db = cfg.FormatDSN()
+	}
+
+	var addr proto.AccountAddress
+	if revokeUser != "" {
+		if addr, err = parseAccountAddress(revokeUser); err != nil {
+			return
+		}
+		if err = client.RevokePermission(db, addr); err != nil {
+			return
+		}
+		log.WithField("db", db).Infof("revoke permissions of %s submitted", revokeUser)
+		return
+	}
+
+	var perm pt.UserPermission
+	if perm, err = parsePermission(permission); err != nil {
+		return
+	}
+	if addr, err = parseAccountAddress(grantUser); err != nil {
+		return
+	}
+	if err = client.GrantPermission(db, addr, perm); err != nil {
+		return
+	}
+	log.WithField("db", db).Infof("grant %s permission to %s submitted", permission, grantUser)
+	return
+}
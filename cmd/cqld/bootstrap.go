@@ -44,6 +44,7 @@ import (
 const (
 	kayakServiceName = "Kayak"
 	kayakMethodName  = "Call"
+	kayakFetchName   = "Fetch"
 	kayakWalFileName = "kayak.ldb"
 )
 
@@ -157,6 +158,7 @@ func runNode(nodeID proto.NodeID, listenAddr string) (err error) {
 		time.Minute,
 		20*time.Second,
 	)
+	chainConfig.Provider = dbService
 	chain, err := bp.NewChain(chainConfig)
 	if err != nil {
 		log.WithError(err).Error("init chain failed")
@@ -223,6 +225,7 @@ func initKayakTwoPC(rootDir string, node *proto.Node, peers *proto.Peers, h kt.H
 		NodeID:           node.ID,
 		ServiceName:      kayakServiceName,
 		MethodName:       kayakMethodName,
+		FetchMethodName:  kayakFetchName,
 	}
 
 	// create kayak runtime
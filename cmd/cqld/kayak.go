@@ -19,9 +19,14 @@ package main
 import (
 	"github.com/CovenantSQL/CovenantSQL/kayak"
 	kt "github.com/CovenantSQL/CovenantSQL/kayak/types"
+	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/pkg/errors"
 )
 
+// ErrPermissionDenied indicates that the caller is not permitted to call the kayak service.
+var ErrPermissionDenied = errors.New("permission denied")
+
 // KayakService defines the leader service kayak.
 type KayakService struct {
 	serviceName string
@@ -40,5 +45,14 @@ func NewKayakService(server *rpc.Server, serviceName string, rt *kayak.Runtime)
 
 // Call handles kayak call.
 func (s *KayakService) Call(req *kt.RPCRequest, _ *interface{}) (err error) {
+	if !route.IsPermitted(&req.Envelope, route.KayakCall) {
+		return ErrPermissionDenied
+	}
 	return s.rt.FollowerApply(req.Log)
 }
+
+// Fetch handles kayak log fetching.
+func (s *KayakService) Fetch(req *kt.FetchRequest, resp *kt.FetchResponse) (err error) {
+	resp.Snapshot, resp.Logs, err = s.rt.Fetch(req.From, req.To)
+	return
+}
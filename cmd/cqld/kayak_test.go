@@ -0,0 +1,51 @@
+// +build !testbinary
+
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/conf"
+	kt "github.com/CovenantSQL/CovenantSQL/kayak/types"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestKayakServiceCall(t *testing.T) {
+	Convey("The kayak logs should only be applied from the block producers", t, func() {
+		var err error
+		conf.GConf, err = conf.LoadConfig("../../test/node_0/config.yaml")
+		So(err, ShouldBeNil)
+		// reset the once
+		route.Once = sync.Once{}
+
+		var (
+			s = &KayakService{}
+			// a 32 bytes node id which is not a block producer
+			other = proto.NodeID("0000000000000000000000000000000000000000000000000000000000000004")
+		)
+		err = s.Call(&kt.RPCRequest{
+			Envelope: proto.Envelope{NodeID: other.ToRawNodeID()},
+			Log:      &kt.Log{},
+		}, nil)
+		So(err, ShouldEqual, ErrPermissionDenied)
+	})
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package adapteruser implements the user table of the database protocol adapters, each adapter
+// user maps to a CovenantSQL account and a set of allowed databases.
+package adapteruser
+
+import (
+	"path/filepath"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/pkg/errors"
+)
+
+// Config defines an adapter user and the CovenantSQL account it acts as.
+type Config struct {
+	User     string `yaml:"User"`
+	Password string `yaml:"Password"`
+	// PrivateKeyFile is the key file of the CovenantSQL account, the queries of the user are signed
+	// by the key. The key of the adapter itself is used if it is empty.
+	PrivateKeyFile string `yaml:"PrivateKeyFile"`
+	MasterKey      string `yaml:"MasterKey"`
+	// Databases defines the database ids allowed to use, all databases are allowed if empty.
+	Databases []string `yaml:"Databases"`
+}
+
+// User defines the loaded credential and permissions of an adapter user.
+type User struct {
+	Name     string
+	Password string
+	// PrivateKey is the key of the CovenantSQL account, nil for the adapter key.
+	PrivateKey *asymmetric.PrivateKey
+	databases  map[string]bool // nil for all databases
+}
+
+// NewUser returns a user acting as the adapter account on all databases.
+func NewUser(name string, password string) *User {
+	return &User{
+		Name:     name,
+		Password: password,
+	}
+}
+
+// AllowDatabase returns whether the user is allowed to use the database.
+func (u *User) AllowDatabase(dbID string) bool {
+	return u.databases == nil || u.databases[dbID]
+}
+
+// Load loads the users of configs, the relative key file paths are resolved from configDir.
+func Load(configs []Config, configDir string) (users map[string]*User, err error) {
+	users = make(map[string]*User, len(configs))
+
+	for _, uc := range configs {
+		if uc.User == "" {
+			err = errors.New("empty user name")
+			return
+		}
+		if _, ok := users[uc.User]; ok {
+			err = errors.Errorf("duplicate user: %s", uc.User)
+			return
+		}
+
+		u := NewUser(uc.User, uc.Password)
+
+		if uc.PrivateKeyFile != "" {
+			keyFile := uc.PrivateKeyFile
+			if !filepath.IsAbs(keyFile) {
+				keyFile = filepath.Join(configDir, keyFile)
+			}
+			if u.PrivateKey, err = kms.LoadPrivateKey(keyFile, []byte(uc.MasterKey)); err != nil {
+				err = errors.Wrapf(err, "load private key of user %s failed", uc.User)
+				return
+			}
+		}
+
+		if len(uc.Databases) > 0 {
+			u.databases = make(map[string]bool, len(uc.Databases))
+			for _, dbID := range uc.Databases {
+				u.databases[dbID] = true
+			}
+		}
+
+		users[uc.User] = u
+	}
+
+	return
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package adapteruser
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLoad(t *testing.T) {
+	Convey("Given a working directory with a private key file", t, func() {
+		var (
+			tmp     string
+			privKey *asymmetric.PrivateKey
+			configs []Config
+			users   map[string]*User
+			err     error
+		)
+		tmp, err = ioutil.TempDir("", "covenantsql")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			err = os.RemoveAll(tmp)
+			So(err, ShouldBeNil)
+		})
+		privKey, _, err = asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		err = kms.SavePrivateKey(filepath.Join(tmp, "alice.key"), privKey, []byte("pass"))
+		So(err, ShouldBeNil)
+		configs = []Config{
+			{
+				User:           "alice",
+				Password:       "a",
+				PrivateKeyFile: "alice.key",
+				MasterKey:      "pass",
+				Databases:      []string{"db1"},
+			},
+			{
+				User:     "bob",
+				Password: "b",
+			},
+		}
+
+		Convey("The users should be loaded with their keys and databases", func() {
+			users, err = Load(configs, tmp)
+			So(err, ShouldBeNil)
+			So(users, ShouldHaveLength, 2)
+			So(users["alice"].Password, ShouldEqual, "a")
+			So(users["alice"].PrivateKey.Serialize(), ShouldResemble, privKey.Serialize())
+			So(users["alice"].AllowDatabase("db1"), ShouldBeTrue)
+			So(users["alice"].AllowDatabase("db2"), ShouldBeFalse)
+			So(users["bob"].PrivateKey, ShouldBeNil)
+			So(users["bob"].AllowDatabase("db2"), ShouldBeTrue)
+		})
+		Convey("The Load func should report error on empty user name", func() {
+			configs = append(configs, Config{Password: "c"})
+			users, err = Load(configs, tmp)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("The Load func should report error on duplicate users", func() {
+			configs = append(configs, Config{User: "bob"})
+			users, err = Load(configs, tmp)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("The Load func should report error on wrong master key", func() {
+			configs[0].MasterKey = "wrong"
+			users, err = Load(configs, tmp)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
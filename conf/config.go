@@ -104,6 +104,10 @@ type MinerInfo struct {
 	// when test mode, fixture database config is used.
 	IsTestMode   bool                    `yaml:"IsTestMode,omitempty"`
 	TestFixtures []*MinerDatabaseFixture `yaml:"TestFixtures,omitempty"`
+
+	// AllowMemoryStorageEngine allows deploying databases on the in-memory storage engine, which
+	// loses all data on restart. It's always allowed in test mode.
+	AllowMemoryStorageEngine bool `yaml:"AllowMemoryStorageEngine,omitempty"`
 }
 
 // DNSSeed defines seed DNS info.
@@ -126,6 +130,9 @@ type Config struct {
 	ValidDNSKeys    map[string]string `yaml:"ValidDNSKeys"` // map[DNSKEY]domain
 	// Check By BP DHT.Ping
 	MinNodeIDDifficulty int `yaml:"MinNodeIDDifficulty"`
+	// RequireAEAD disables the legacy CFB cipher mode of the ETLS connections, the node neither
+	// falls back to it on dialing nor accepts it from the clients.
+	RequireAEAD bool `yaml:"RequireAEAD,omitempty"`
 
 	DNSSeed DNSSeed `yaml:"DNSSeed"`
 
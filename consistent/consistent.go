@@ -325,10 +325,14 @@ func (c *Consistent) GetNeighborsEx(name string, n int, roles proto.ServerRoles)
 		return res, nil
 	}
 
-	for i = start + 1; i != start; i++ {
+	for i = start + 1; ; i++ {
 		if i >= len(c.sortedHashes) {
 			i = 0
 		}
+		if i == start {
+			// walked through the whole circle
+			break
+		}
 		elem = *c.circle[c.sortedHashes[i]]
 		if noFilter || roles.Contains(elem.Role) {
 			if !sliceContainsMember(res, elem) {
@@ -507,6 +507,27 @@ func TestGetNFilterRole(t *testing.T) {
 	}
 }
 
+func TestGetNFilterRoleNotSatisfied(t *testing.T) {
+	kms.Unittest = true
+	os.Remove(testStorePath)
+	kms.ResetBucket()
+
+	x, _ := InitConsistent(testStorePath, new(KMSStorage), false)
+	defer os.Remove(testStorePath)
+	n := NewNodeFromString("0000000000000000000000000000000000000000000000000000000000000000")
+	n.Role = Leader
+	x.Add(n)
+	for i := 0; i < 100; i++ {
+		members, err := x.GetNeighborsEx(strconv.Itoa(i), 1, ServerRoles{Miner})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(members) != 0 {
+			t.Errorf("expected 0 members instead of %d", len(members))
+		}
+	}
+}
+
 func TestGetNLess(t *testing.T) {
 	kms.Unittest = true
 	os.Remove(testStorePath)
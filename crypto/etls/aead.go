@@ -0,0 +1,165 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package etls
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"io"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/pkg/errors"
+)
+
+const (
+	// aeadKeyLen is the key length of AES-256-GCM.
+	aeadKeyLen = 32
+	// frameHeaderLen is the length of the big-endian uint32 sealed size ahead of each frame.
+	frameHeaderLen = 4
+	// maxFramePayload is the max plaintext size of a single frame.
+	maxFramePayload = 16 * 1024
+)
+
+var (
+	// ErrFrameTooLarge indicates that the received frame size exceeds the limit.
+	ErrFrameTooLarge = errors.New("etls frame too large")
+	// ErrFrameAuthFailed indicates that the received frame is forged, replayed or reordered.
+	ErrFrameAuthFailed = errors.New("etls frame authentication failed")
+)
+
+// aeadCipher keeps the AES-GCM states of both directions. Each frame is sealed with the frame
+// sequence number of its direction as nonce, so a replayed, reordered or dropped frame fails the
+// authentication of the peer.
+type aeadCipher struct {
+	enc     cipher.AEAD
+	dec     cipher.AEAD
+	encSeq  uint64
+	decSeq  uint64
+	readBuf []byte
+	readErr error
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// newAEADCipher derives the keys of both directions from rawKey and the handshake transcript,
+// which contains the random values of both sides, so each connection has its own keys.
+func newAEADCipher(rawKey, transcript []byte, isClient bool) (c *aeadCipher, err error) {
+	hSuite := &hash.HashSuite{
+		HashLen:  hash.HashBSize,
+		HashFunc: hash.DoubleHashB,
+	}
+	derive := func(label string) []byte {
+		material := make([]byte, 0, len(rawKey)+len(transcript)+len(label))
+		material = append(material, rawKey...)
+		material = append(material, transcript...)
+		material = append(material, label...)
+		return KeyDerivation(material, aeadKeyLen, hSuite)
+	}
+
+	var c2s, s2c cipher.AEAD
+	if c2s, err = newAESGCM(derive("client write")); err != nil {
+		return
+	}
+	if s2c, err = newAESGCM(derive("server write")); err != nil {
+		return
+	}
+
+	if isClient {
+		c = &aeadCipher{enc: c2s, dec: s2c}
+	} else {
+		c = &aeadCipher{enc: s2c, dec: c2s}
+	}
+	return
+}
+
+func (c *aeadCipher) nonce(aead cipher.AEAD, seq uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], seq)
+	return nonce
+}
+
+// seal encrypts src to frames.
+func (c *aeadCipher) seal(src []byte) (dst []byte) {
+	overhead := c.enc.Overhead()
+	frames := (len(src) + maxFramePayload - 1) / maxFramePayload
+	dst = make([]byte, 0, len(src)+frames*(frameHeaderLen+overhead))
+
+	for len(src) > 0 {
+		size := len(src)
+		if size > maxFramePayload {
+			size = maxFramePayload
+		}
+
+		var header [frameHeaderLen]byte
+		binary.BigEndian.PutUint32(header[:], uint32(size+overhead))
+		dst = append(dst, header[:]...)
+		dst = c.enc.Seal(dst, c.nonce(c.enc, c.encSeq), src[:size], header[:])
+		c.encSeq++
+
+		src = src[size:]
+	}
+	return
+}
+
+// open reads and decrypts the next non-empty frame from r.
+func (c *aeadCipher) open(r io.Reader) (err error) {
+	for len(c.readBuf) == 0 {
+		var header [frameHeaderLen]byte
+		if _, err = io.ReadFull(r, header[:]); err != nil {
+			return
+		}
+
+		size := binary.BigEndian.Uint32(header[:])
+		if size < uint32(c.dec.Overhead()) || size > uint32(maxFramePayload+c.dec.Overhead()) {
+			return ErrFrameTooLarge
+		}
+
+		sealed := make([]byte, size)
+		if _, err = io.ReadFull(r, sealed); err != nil {
+			return
+		}
+		if c.readBuf, err = c.dec.Open(
+			sealed[:0], c.nonce(c.dec, c.decSeq), sealed, header[:]); err != nil {
+			return ErrFrameAuthFailed
+		}
+		c.decSeq++
+	}
+	return
+}
+
+// read reads the decrypted data from r to b, the error is kept as the stream is broken.
+func (c *aeadCipher) read(r io.Reader, b []byte) (n int, err error) {
+	if len(c.readBuf) == 0 {
+		if c.readErr != nil {
+			return 0, c.readErr
+		}
+		if err = c.open(r); err != nil {
+			c.readErr = err
+			return
+		}
+	}
+	n = copy(b, c.readBuf)
+	c.readBuf = c.readBuf[n:]
+	return
+}
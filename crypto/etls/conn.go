@@ -22,6 +22,7 @@ package etls
 import (
 	"io"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/proto"
@@ -33,6 +34,10 @@ type CryptoConn struct {
 	net.Conn
 	*Cipher
 	NodeID *proto.RawNodeID
+
+	handshake     ServerHandshaker
+	handshakeOnce sync.Once
+	handshakeErr  error
 }
 
 // NewConn returns a new CryptoConn
@@ -62,8 +67,27 @@ func (c *CryptoConn) RawRead(b []byte) (n int, err error) {
 	return c.Conn.Read(b)
 }
 
-// Read iv and Encrypted data
+// Handshake runs the deferred server handshake of the connection created by NewServerConn, it's
+// called by the first Read or Write automatically. It returns immediately if the handshake is
+// done, or there is no handshake for the connection.
+func (c *CryptoConn) Handshake() error {
+	if c.handshake != nil {
+		c.handshakeOnce.Do(func() {
+			c.Cipher, c.NodeID, c.handshakeErr = c.handshake(c.Conn)
+		})
+	}
+	return c.handshakeErr
+}
+
+// Read iv and Encrypted data, or the authenticated frames in AEAD mode
 func (c *CryptoConn) Read(b []byte) (n int, err error) {
+	if err = c.Handshake(); err != nil {
+		return
+	}
+	if c.aead != nil {
+		return c.aead.read(c.Conn, b)
+	}
+
 	if c.decStream == nil {
 		iv := make([]byte, c.info.ivLen)
 		if _, err = io.ReadFull(c.Conn, iv); err != nil {
@@ -95,8 +119,18 @@ func (c *CryptoConn) RawWrite(b []byte) (n int, err error) {
 	return c.Conn.Read(b)
 }
 
-// Write iv and Encrypted data
+// Write iv and Encrypted data, or the authenticated frames in AEAD mode
 func (c *CryptoConn) Write(b []byte) (n int, err error) {
+	if err = c.Handshake(); err != nil {
+		return
+	}
+	if c.aead != nil {
+		if _, err = c.Conn.Write(c.aead.seal(b)); err == nil {
+			n = len(b)
+		}
+		return
+	}
+
 	var iv []byte
 	if c.encStream == nil {
 		iv, err = c.initEncrypt()
@@ -90,6 +90,12 @@ type Cipher struct {
 	key        []byte
 	info       *cipherInfo
 	iv         []byte
+	aead       *aeadCipher
+}
+
+// IsAEAD returns whether the cipher works in the authenticated framed mode.
+func (c *Cipher) IsAEAD() bool {
+	return c != nil && c.aead != nil
 }
 
 // NewCipher creates a cipher that can be used in Dial(), Listen() etc.
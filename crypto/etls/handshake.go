@@ -0,0 +1,171 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package etls
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"net"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/pkg/errors"
+)
+
+// The AEAD mode is negotiated right after the node header of the connection: the client sends
+// a hello of magic, supported modes and client random, the server replies with the same magic,
+// the chosen mode and server random. A legacy client sends the CFB IV at the same position, which
+// is distinguished from the magic by the server. A legacy server treats the hello as the CFB IV
+// and broken data then closes the connection, so the client can fall back to the legacy mode.
+
+const (
+	// ModeAESGCM defines the AES-256-GCM framed mode flag in handshake.
+	ModeAESGCM byte = 1 << iota
+
+	helloRandomLen = 32
+)
+
+var (
+	// HandshakeTimeout defines the timeout of waiting for the handshake reply.
+	HandshakeTimeout = 5 * time.Second
+
+	// ErrHandshakeFailed indicates that the peer does not accept the AEAD mode handshake.
+	ErrHandshakeFailed = errors.New("etls handshake failed")
+
+	helloMagic = []byte("CQL-ETLS-AEAD/v1")
+	helloLen   = len(helloMagic) + 1 + helloRandomLen
+)
+
+func newHello(modes byte) (hello []byte, err error) {
+	hello = make([]byte, helloLen)
+	copy(hello, helloMagic)
+	hello[len(helloMagic)] = modes
+	if _, err = io.ReadFull(rand.Reader, hello[len(helloMagic)+1:]); err != nil {
+		err = errors.Wrap(err, "generate handshake random failed")
+	}
+	return
+}
+
+// ClientHandshake negotiates the AEAD mode on conn with rawKey, the node header should already be
+// sent. The returned error wraps ErrHandshakeFailed if the server does not reply as expected, and
+// the conn should be dropped in this case.
+func ClientHandshake(conn net.Conn, rawKey []byte, nodeID *proto.RawNodeID) (c *CryptoConn, err error) {
+	var hello, reply []byte
+	if hello, err = newHello(ModeAESGCM); err != nil {
+		return
+	}
+	if _, err = conn.Write(hello); err != nil {
+		err = errors.Wrap(err, "write handshake hello failed")
+		return
+	}
+
+	if err = conn.SetReadDeadline(time.Now().Add(HandshakeTimeout)); err != nil {
+		return
+	}
+	reply = make([]byte, helloLen)
+	if _, err = io.ReadFull(conn, reply); err != nil {
+		err = errors.Wrapf(ErrHandshakeFailed, "read handshake reply failed: %v", err)
+		return
+	}
+	if err = conn.SetReadDeadline(time.Time{}); err != nil {
+		return
+	}
+
+	if !bytes.Equal(reply[:len(helloMagic)], helloMagic) {
+		err = errors.Wrap(ErrHandshakeFailed, "invalid handshake reply")
+		return
+	}
+	if mode := reply[len(helloMagic)]; mode != ModeAESGCM {
+		err = errors.Wrapf(ErrHandshakeFailed, "unsupported cipher mode: %d", mode)
+		return
+	}
+
+	var aead *aeadCipher
+	if aead, err = newAEADCipher(rawKey, append(hello, reply...), true); err != nil {
+		return
+	}
+	c = NewConn(conn, &Cipher{aead: aead}, nodeID)
+	return
+}
+
+// ServerHandshaker is the func type of the server side handshake on the raw connection, it
+// returns the negotiated cipher and the remote node id of the connection.
+type ServerHandshaker func(conn net.Conn) (cipher *Cipher, nodeID *proto.RawNodeID, err error)
+
+// NewServerConn returns the server side CryptoConn of conn. The handshake is deferred to the first
+// Read or Write of the CryptoConn instead of the Accept of the listener, so that a slow or silent
+// client never blocks the listener from accepting the other connections.
+func NewServerConn(conn net.Conn, handshake ServerHandshaker) *CryptoConn {
+	return &CryptoConn{
+		Conn:      conn,
+		handshake: handshake,
+	}
+}
+
+// ServerHandshake detects the cipher mode chosen by the client after the node header, and
+// returns the cipher in the AEAD mode or the legacy CFB mode accordingly. The legacy CFB mode is
+// rejected if requireAEAD is set.
+func ServerHandshake(conn net.Conn, rawKey []byte, requireAEAD bool) (cipher *Cipher, err error) {
+	// the legacy CFB IV has the same length as the hello magic
+	prefix := make([]byte, len(helloMagic))
+	if _, err = io.ReadFull(conn, prefix); err != nil {
+		err = errors.Wrap(err, "read handshake hello failed")
+		return
+	}
+
+	if !bytes.Equal(prefix, helloMagic) {
+		// legacy client
+		if requireAEAD {
+			err = errors.Wrap(ErrHandshakeFailed, "legacy cipher mode is not allowed")
+			return
+		}
+		cipher = NewCipher(rawKey)
+		if err = cipher.initDecrypt(prefix); err != nil {
+			return
+		}
+		cipher.iv = prefix
+		return
+	}
+
+	hello := make([]byte, helloLen)
+	copy(hello, prefix)
+	if _, err = io.ReadFull(conn, hello[len(prefix):]); err != nil {
+		err = errors.Wrap(err, "read handshake hello failed")
+		return
+	}
+	if hello[len(helloMagic)]&ModeAESGCM == 0 {
+		err = errors.Wrapf(ErrHandshakeFailed, "no supported cipher mode in %#x", hello[len(helloMagic)])
+		return
+	}
+
+	var reply []byte
+	if reply, err = newHello(ModeAESGCM); err != nil {
+		return
+	}
+	if _, err = conn.Write(reply); err != nil {
+		err = errors.Wrap(err, "write handshake reply failed")
+		return
+	}
+
+	var aead *aeadCipher
+	if aead, err = newAEADCipher(rawKey, append(hello, reply...), false); err != nil {
+		return
+	}
+	cipher = &Cipher{aead: aead}
+	return
+}
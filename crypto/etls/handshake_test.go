@@ -0,0 +1,211 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package etls
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newHandshakeListener(t *testing.T, handler CipherHandler) (l *CryptoListener, conns chan net.Conn) {
+	l, err := NewCryptoListener("tcp", "127.0.0.1:0", handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns = make(chan net.Conn, 1)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			// the deferred handshake runs concurrently with the client like the rpc server
+			go func(c net.Conn) {
+				c.(*CryptoConn).Handshake()
+				conns <- c
+			}(c)
+		}
+	}()
+	return
+}
+
+func echoOnce(c net.Conn, size int) {
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(c, buf); err == nil {
+		c.Write(buf)
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	newHandler := func(requireAEAD bool) CipherHandler {
+		return func(conn net.Conn) (cryptoConn *CryptoConn, err error) {
+			return NewServerConn(conn, func(conn net.Conn) (cipher *Cipher, nodeID *proto.RawNodeID, err error) {
+				cipher, err = ServerHandshake(conn, []byte(pass), requireAEAD)
+				return
+			}), nil
+		}
+	}
+	aeadHandler := newHandler(false)
+	payload := make([]byte, 3*maxFramePayload+123)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+
+	Convey("AEAD client should talk to new server in AEAD mode", t, func() {
+		l, conns := newHandshakeListener(t, aeadHandler)
+		defer l.Close()
+
+		raw, err := net.Dial("tcp", l.Addr().String())
+		So(err, ShouldBeNil)
+		defer raw.Close()
+		c, err := ClientHandshake(raw, []byte(pass), nil)
+		So(err, ShouldBeNil)
+		So(c.IsAEAD(), ShouldBeTrue)
+
+		s := <-conns
+		defer s.Close()
+		So(s.(*CryptoConn).Handshake(), ShouldBeNil)
+		So(s.(*CryptoConn).IsAEAD(), ShouldBeTrue)
+		go echoOnce(s, len(payload))
+
+		n, err := c.Write(payload)
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, len(payload))
+		buf := make([]byte, len(payload))
+		_, err = io.ReadFull(c, buf)
+		So(err, ShouldBeNil)
+		So(buf, ShouldResemble, payload)
+	})
+
+	Convey("Legacy client should talk to new server in CFB mode", t, func() {
+		l, conns := newHandshakeListener(t, aeadHandler)
+		defer l.Close()
+
+		c, err := Dial("tcp", l.Addr().String(), NewCipher([]byte(pass)))
+		So(err, ShouldBeNil)
+		defer c.Close()
+		n, err := c.Write(payload)
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, len(payload)+16)
+
+		s := <-conns
+		defer s.Close()
+		So(s.(*CryptoConn).Handshake(), ShouldBeNil)
+		So(s.(*CryptoConn).IsAEAD(), ShouldBeFalse)
+		go echoOnce(s, len(payload))
+
+		buf := make([]byte, len(payload))
+		_, err = io.ReadFull(c, buf)
+		So(err, ShouldBeNil)
+		So(buf, ShouldResemble, payload)
+	})
+
+	Convey("Legacy client should be rejected if AEAD is required", t, func() {
+		l, conns := newHandshakeListener(t, newHandler(true))
+		defer l.Close()
+
+		c, err := Dial("tcp", l.Addr().String(), NewCipher([]byte(pass)))
+		So(err, ShouldBeNil)
+		defer c.Close()
+		_, err = c.Write(payload)
+		So(err, ShouldBeNil)
+
+		s := <-conns
+		defer s.Close()
+		err = s.(*CryptoConn).Handshake()
+		So(errors.Cause(err), ShouldEqual, ErrHandshakeFailed)
+		_, err = s.Read(make([]byte, 1))
+		So(errors.Cause(err), ShouldEqual, ErrHandshakeFailed)
+	})
+
+	Convey("Silent client should not block accepting the others", t, func() {
+		l, conns := newHandshakeListener(t, aeadHandler)
+		defer l.Close()
+
+		silent, err := net.Dial("tcp", l.Addr().String())
+		So(err, ShouldBeNil)
+		defer silent.Close()
+
+		raw, err := net.Dial("tcp", l.Addr().String())
+		So(err, ShouldBeNil)
+		defer raw.Close()
+		c, err := ClientHandshake(raw, []byte(pass), nil)
+		So(err, ShouldBeNil)
+		So(c.IsAEAD(), ShouldBeTrue)
+
+		s := <-conns
+		defer s.Close()
+		So(s.(*CryptoConn).Handshake(), ShouldBeNil)
+		So(s.(*CryptoConn).IsAEAD(), ShouldBeTrue)
+	})
+
+	Convey("AEAD client should fail on legacy server", t, func() {
+		l, conns := newHandshakeListener(t, simpleCipherHandler)
+		defer l.Close()
+		go func() {
+			s := <-conns
+			// legacy server drops the connection on broken data
+			s.Read(make([]byte, helloLen))
+			s.Close()
+		}()
+
+		raw, err := net.Dial("tcp", l.Addr().String())
+		So(err, ShouldBeNil)
+		defer raw.Close()
+		_, err = ClientHandshake(raw, []byte(pass), nil)
+		So(err, ShouldNotBeNil)
+		So(errors.Cause(err), ShouldEqual, ErrHandshakeFailed)
+	})
+
+	Convey("Tampered or replayed frames should be rejected", t, func() {
+		client, err := newAEADCipher([]byte(pass), []byte("transcript"), true)
+		So(err, ShouldBeNil)
+		server, err := newAEADCipher([]byte(pass), []byte("transcript"), false)
+		So(err, ShouldBeNil)
+
+		frame1 := client.seal([]byte("hello"))
+		frame2 := client.seal([]byte("world"))
+		buf := make([]byte, 5)
+		n, err := server.read(bytes.NewReader(frame1), buf)
+		So(err, ShouldBeNil)
+		So(string(buf[:n]), ShouldEqual, "hello")
+
+		// replay the first frame
+		_, err = server.read(bytes.NewReader(frame1), buf)
+		So(err, ShouldEqual, ErrFrameAuthFailed)
+		// the stream is broken since then
+		_, err = server.read(bytes.NewReader(frame2), buf)
+		So(err, ShouldEqual, ErrFrameAuthFailed)
+
+		server, err = newAEADCipher([]byte(pass), []byte("transcript"), false)
+		So(err, ShouldBeNil)
+		frame1[len(frame1)-1] ^= 0x1
+		_, err = server.read(bytes.NewReader(frame1), buf)
+		So(err, ShouldEqual, ErrFrameAuthFailed)
+
+		server, err = newAEADCipher([]byte(pass), []byte("transcript"), false)
+		So(err, ShouldBeNil)
+		_, err = server.read(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff}), buf)
+		So(err, ShouldEqual, ErrFrameTooLarge)
+	})
+}
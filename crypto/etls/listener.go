@@ -45,7 +45,12 @@ func (l *CryptoListener) Accept() (net.Conn, error) {
 		return nil, err
 	}
 
-	return l.CHandler(c)
+	cc, err := l.CHandler(c)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return cc, nil
 }
 
 // Close closes the listener.
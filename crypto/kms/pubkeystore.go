@@ -43,6 +43,8 @@ type PublicKeyStore struct {
 const (
 	// kmsBucketName is the boltdb bucket name
 	kmsBucketName = "kms"
+	// aeadBucketName is the boltdb bucket name of the AEAD cipher capable nodes
+	aeadBucketName = "aead"
 )
 
 var (
@@ -302,6 +304,45 @@ func DelNode(id proto.NodeID) (err error) {
 	return
 }
 
+// SetAEADNode records that the node supports the AEAD cipher mode of ETLS, so that the
+// connections to the node are never downgraded to the legacy cipher mode, even after restart.
+func SetAEADNode(id proto.NodeID) (err error) {
+	pksLock.Lock()
+	defer pksLock.Unlock()
+	if pks == nil || pks.db == nil {
+		return ErrPKSNotInitialized
+	}
+
+	err = pks.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(aeadBucketName))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(id), []byte{1})
+	})
+	if err != nil {
+		log.WithError(err).Error("set AEAD node failed")
+	}
+	return
+}
+
+// IsAEADNode returns whether the node is recorded to support the AEAD cipher mode of ETLS.
+func IsAEADNode(id proto.NodeID) (ok bool) {
+	pksLock.Lock()
+	defer pksLock.Unlock()
+	if pks == nil || pks.db == nil {
+		return
+	}
+
+	pks.db.View(func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket([]byte(aeadBucketName)); bucket != nil {
+			ok = bucket.Get([]byte(id)) != nil
+		}
+		return nil
+	})
+	return
+}
+
 // removeBucket this bucket
 func removeBucket() (err error) {
 	pksLock.Lock()
@@ -148,6 +148,32 @@ func TestDB(t *testing.T) {
 	})
 }
 
+func TestAEADNode(t *testing.T) {
+	Convey("AEAD nodes should be persisted", t, func() {
+		pks = nil
+		os.Remove(dbFile)
+		defer os.Remove(dbFile)
+		So(IsAEADNode(proto.NodeID("1111")), ShouldBeFalse)
+		So(SetAEADNode(proto.NodeID("1111")), ShouldEqual, ErrPKSNotInitialized)
+
+		err := InitPublicKeyStore(dbFile, nil)
+		So(err, ShouldBeNil)
+		So(IsAEADNode(proto.NodeID("1111")), ShouldBeFalse)
+		So(SetAEADNode(proto.NodeID("1111")), ShouldBeNil)
+		So(IsAEADNode(proto.NodeID("1111")), ShouldBeTrue)
+		So(IsAEADNode(proto.NodeID("2222")), ShouldBeFalse)
+
+		// reopen the store
+		pks.db.Close()
+		pks = nil
+		err = InitPublicKeyStore(dbFile, nil)
+		So(err, ShouldBeNil)
+		So(IsAEADNode(proto.NodeID("1111")), ShouldBeTrue)
+		pks.db.Close()
+		pks = nil
+	})
+}
+
 func TestErrorPath(t *testing.T) {
 	Convey("can not init db", t, func() {
 		pks = nil
@@ -0,0 +1,418 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kayak
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync/atomic"
+
+	kt "github.com/CovenantSQL/CovenantSQL/kayak/types"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
+)
+
+// Fetch defines entry for log fetching on leader node, it returns the logs in range [from, to]
+// with the prepare logs they depend on. The wal snapshot is returned instead of the logs already
+// compacted, the pending prepare logs retained by the snapshot are returned too.
+func (r *Runtime) Fetch(from, to uint64) (s *kt.Snapshot, logs []*kt.Log, err error) {
+	r.peersLock.RLock()
+	defer r.peersLock.RUnlock()
+
+	if r.role != proto.Leader {
+		// not leader
+		err = kt.ErrNotLeader
+		return
+	}
+
+	r.snapshotLock.RLock()
+	defer r.snapshotLock.RUnlock()
+
+	var (
+		l        *kt.Log
+		included = make(map[uint64]bool)
+	)
+
+	if r.snapshotIndex > 0 && from <= r.snapshotIndex {
+		if r.snapshot == nil {
+			err = errors.Wrap(kt.ErrInvalidLog, "snapshot not found")
+			return
+		}
+		// the snapshot file is fetched by chunks, see FetchSnapshot
+		s = &kt.Snapshot{
+			Index:   r.snapshot.Index,
+			Pending: r.snapshot.Pending,
+		}
+		for _, i := range s.Pending {
+			if l, err = r.wal.Get(i); err != nil {
+				err = errors.Wrapf(err, "get pending prepare log %v failed", i)
+				return
+			}
+			logs = append(logs, l)
+			included[i] = true
+		}
+		from = s.Index + 1
+	}
+
+	r.nextIndexLock.Lock()
+	last := r.nextIndex
+	r.nextIndexLock.Unlock()
+
+	if last == 0 {
+		return
+	}
+	if last--; to == 0 || to > last {
+		to = last
+	}
+	if to >= from+fetchLimit {
+		to = from + fetchLimit - 1
+	}
+
+	for i := from; i <= to; i++ {
+		if l, err = r.wal.Get(i); err != nil {
+			if i > from {
+				// the log index is allocated but the log is still under writing
+				err = nil
+				break
+			}
+			err = errors.Wrapf(err, "get log %v failed", i)
+			return
+		}
+
+		if l.Type == kt.LogCommit || l.Type == kt.LogRollback {
+			// attach the prepare log before the range
+			var prepareIndex uint64
+			if prepareIndex, err = r.bytesToUint64(l.Data); err != nil {
+				err = errors.Wrap(err, "log does not contain valid prepare index")
+				return
+			}
+			if prepareIndex < from && !included[prepareIndex] {
+				var pl *kt.Log
+				if pl, err = r.wal.Get(prepareIndex); err != nil {
+					err = errors.Wrapf(err, "get prepare log %v failed", prepareIndex)
+					return
+				}
+				logs = append(logs, pl)
+				included[prepareIndex] = true
+			}
+		}
+
+		logs = append(logs, l)
+	}
+
+	sort.Slice(logs, func(i, j int) bool { return logs[i].Index < logs[j].Index })
+
+	return
+}
+
+// FetchSnapshot defines entry for snapshot file fetching on leader node, it returns the chunk of
+// the file of the wal snapshot at index from offset, an empty chunk is returned at the end of file.
+func (r *Runtime) FetchSnapshot(index uint64, offset int64) (chunk []byte, err error) {
+	r.peersLock.RLock()
+	defer r.peersLock.RUnlock()
+
+	if r.role != proto.Leader {
+		// not leader
+		err = kt.ErrNotLeader
+		return
+	}
+
+	sh, ok := r.sh.(kt.Snapshotter)
+	if !ok {
+		err = errors.Wrap(kt.ErrSnapshotNotFound, "handler does not support snapshot")
+		return
+	}
+
+	r.snapshotLock.RLock()
+	defer r.snapshotLock.RUnlock()
+
+	if r.snapshot == nil || r.snapshot.Index != index {
+		// the snapshot is replaced, the follower should fetch logs again
+		err = errors.Wrapf(kt.ErrSnapshotNotFound, "snapshot %v", index)
+		return
+	}
+
+	var n int
+	chunk = make([]byte, snapshotChunkSize)
+	if n, err = sh.ReadSnapshot(r.snapshot.Data, chunk, offset); err == io.EOF {
+		err = nil
+	} else if err != nil {
+		err = errors.Wrapf(err, "read snapshot %v failed", index)
+		return
+	}
+	chunk = chunk[:n]
+
+	return
+}
+
+// ServeFetch serves the log or snapshot file fetching request on leader node.
+func (r *Runtime) ServeFetch(req *kt.FetchRequest, resp *kt.FetchResponse) (err error) {
+	if req.SnapshotIndex != 0 {
+		resp.Chunk, err = r.FetchSnapshot(req.SnapshotIndex, req.SnapshotOffset)
+		return
+	}
+	resp.Snapshot, resp.Logs, err = r.Fetch(req.From, req.To)
+	return
+}
+
+// snapshotReader reads the snapshot file from leader by chunks.
+type snapshotReader struct {
+	r      *Runtime
+	leader proto.NodeID
+	index  uint64
+	offset int64
+	buf    []byte
+	eof    bool
+}
+
+func (s *snapshotReader) Read(p []byte) (n int, err error) {
+	if len(s.buf) == 0 {
+		if s.eof {
+			return 0, io.EOF
+		}
+		req := &kt.FetchRequest{
+			Instance:       s.r.instanceID,
+			SnapshotIndex:  s.index,
+			SnapshotOffset: s.offset,
+		}
+		resp := &kt.FetchResponse{}
+		if err = s.r.getCaller(s.leader).Call(s.r.fetchMethod, req, resp); err != nil {
+			err = errors.Wrap(err, "fetch snapshot chunk from leader failed")
+			return
+		}
+		if len(resp.Chunk) == 0 {
+			s.eof = true
+			return 0, io.EOF
+		}
+		s.buf = resp.Chunk
+		s.offset += int64(len(resp.Chunk))
+	}
+	n = copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return
+}
+
+// catchUp fetches the missing logs from leader and applies them until the last commit reaches to.
+func (r *Runtime) catchUp(leader proto.NodeID, to uint64) (err error) {
+	if r.fetchMethod == "" {
+		err = errors.Wrap(kt.ErrNeedRecovery, "log fetching is disabled")
+		return
+	}
+
+	r.catchUpLock.Lock()
+	defer r.catchUpLock.Unlock()
+
+	var (
+		start   = atomic.LoadUint64(&r.lastCommit)
+		from    = start + 1
+		fetched int
+	)
+
+	defer func() {
+		log.WithFields(log.Fields{
+			"s": start,
+			"c": atomic.LoadUint64(&r.lastCommit),
+			"t": to,
+			"n": fetched,
+		}).WithError(err).Info("kayak follower catch-up")
+	}()
+
+	for atomic.LoadUint64(&r.lastCommit) < to {
+		req := &kt.FetchRequest{
+			Instance: r.instanceID,
+			From:     from,
+			To:       to,
+		}
+		resp := &kt.FetchResponse{}
+
+		if err = r.getCaller(leader).Call(r.fetchMethod, req, resp); err != nil {
+			err = errors.Wrap(err, "fetch logs from leader failed")
+			return
+		}
+
+		if resp.Snapshot == nil && len(resp.Logs) == 0 {
+			err = errors.Wrapf(kt.ErrNeedRecovery, "no logs available from index %v", from)
+			return
+		}
+
+		if resp.Snapshot != nil {
+			if err = r.applySnapshot(leader, resp.Snapshot); err != nil {
+				return
+			}
+			if from <= resp.Snapshot.Index {
+				from = resp.Snapshot.Index + 1
+			}
+		}
+
+		for _, l := range resp.Logs {
+			if err = r.applyFetchedLog(l); err != nil {
+				err = errors.Wrapf(err, "apply fetched log %v failed", l.Index)
+				return
+			}
+			if from <= l.Index {
+				from = l.Index + 1
+			}
+		}
+
+		fetched += len(resp.Logs)
+	}
+
+	return
+}
+
+func (r *Runtime) asyncCatchUp(leader proto.NodeID, to uint64) {
+	if !atomic.CompareAndSwapUint32(&r.catchingUp, 0, 1) {
+		// already running
+		return
+	}
+
+	r.goFunc(func() {
+		defer atomic.StoreUint32(&r.catchingUp, 0)
+		// errors are logged by catch-up, the commits would trigger it again later
+		r.catchUp(leader, to)
+	})
+}
+
+// applySnapshot fetches the snapshot file of leader and installs it. The file is fetched out of
+// the commit cycle, which is only blocked by the restoration.
+func (r *Runtime) applySnapshot(leader proto.NodeID, s *kt.Snapshot) (err error) {
+	if s.Index <= atomic.LoadUint64(&r.lastCommit) {
+		// already covered
+		return
+	}
+
+	sh, ok := r.sh.(kt.Snapshotter)
+	if !ok {
+		err = errors.Wrap(kt.ErrNeedRecovery, "handler does not support snapshot restore")
+		return
+	}
+
+	local := &kt.Snapshot{
+		Index:   s.Index,
+		Pending: s.Pending,
+	}
+	if local.Data, err = sh.WriteSnapshot(&snapshotReader{
+		r:      r,
+		leader: leader,
+		index:  s.Index,
+	}); err != nil {
+		err = errors.Wrap(err, "fetch snapshot failed")
+		return
+	}
+
+	// install the snapshot in commit cycle, so no commit happens during the installation
+	res := make(chan *commitResult, 1)
+	req := &commitReq{
+		ctx:      context.Background(),
+		snapshot: local,
+		result:   res,
+	}
+
+	select {
+	case <-r.stopCh:
+		sh.DropSnapshot(local.Data)
+		return kt.ErrStopped
+	case r.commitCh <- req:
+	}
+
+	return (<-res).err
+}
+
+// installSnapshot restores the handler state by the local snapshot s and compacts the wal, the
+// snapshot file is dropped if it's not installed.
+func (r *Runtime) installSnapshot(s *kt.Snapshot) (err error) {
+	sh := r.sh.(kt.Snapshotter)
+
+	if s.Index <= atomic.LoadUint64(&r.lastCommit) {
+		sh.DropSnapshot(s.Data)
+		return
+	}
+
+	if err = sh.Restore(s.Data); err != nil {
+		sh.DropSnapshot(s.Data)
+		err = errors.Wrap(err, "restore snapshot failed")
+		return
+	}
+
+	if err = r.compact(sh, s); err != nil {
+		return
+	}
+
+	// prepares covered by the snapshot are resolved unless still pending in leader
+	retained := make(map[uint64]bool, len(s.Pending))
+	for _, v := range s.Pending {
+		retained[v] = true
+	}
+	r.pendingPreparesLock.Lock()
+	for i := range r.pendingPrepares {
+		if i < s.Index && !retained[i] {
+			delete(r.pendingPrepares, i)
+		}
+	}
+	r.pendingPreparesLock.Unlock()
+
+	atomic.StoreUint64(&r.lastCommit, s.Index)
+	r.updateNextIndex(&kt.Log{LogHeader: kt.LogHeader{Index: s.Index}})
+
+	return
+}
+
+func (r *Runtime) applyFetchedLog(l *kt.Log) (err error) {
+	if _, err = r.wal.Get(l.Index); err == nil {
+		// already exists
+		r.updateNextIndex(l)
+		return
+	}
+
+	switch l.Type {
+	case kt.LogPrepare:
+		// fetched prepare logs are already accepted by leader, no more checks
+		r.markPendingPrepare(l.Index)
+		if err = r.wal.Write(l); err != nil {
+			r.markPrepareFinished(l.Index)
+			err = errors.Wrap(err, "write follower prepare log failed")
+		}
+	case kt.LogRollback:
+		err = r.followerRollback(l)
+	case kt.LogCommit:
+		var (
+			prepareLog *kt.Log
+			lastCommit uint64
+		)
+		if lastCommit, prepareLog, err = r.getPrepareLog(l); err != nil {
+			err = errors.Wrap(err, "get original request in commit failed")
+			return
+		}
+		if err = r.applyCommit(l, prepareLog, lastCommit); err != nil &&
+			atomic.LoadUint64(&r.lastCommit) == l.Index {
+			// handler error is the result of the request, the log is applied anyway
+			err = nil
+		}
+	case kt.LogBarrier, kt.LogNoop:
+		err = r.followerNoop(l)
+	default:
+		err = errors.Wrapf(kt.ErrInvalidLog, "invalid log type: %v", l.Type)
+	}
+
+	if err == nil {
+		r.updateNextIndex(l)
+	}
+
+	return
+}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -38,6 +39,15 @@ const (
 	commitWindow = 0
 	// prepare window
 	trackerWindow = 10
+	// max log count in a single fetch response
+	fetchLimit = 1000
+	// max wait time of a out-of-order commit before catching up with leader
+	catchUpWait = time.Second
+)
+
+var (
+	// max chunk size of a single snapshot fetch response
+	snapshotChunkSize = 1 << 20
 )
 
 // Runtime defines the main kayak Runtime.
@@ -51,6 +61,14 @@ type Runtime struct {
 	// pendingPrepares, prepares needs to be committed/rollback
 	pendingPrepares     map[uint64]bool
 	pendingPreparesLock sync.RWMutex
+	// snapshotIndex, last commit log index covered by wal snapshot
+	snapshotIndex uint64
+	// snapshot, the current wal snapshot
+	snapshot *kt.Snapshot
+	// snapshot lock for snapshot update and log fetching
+	snapshotLock sync.RWMutex
+	// flag for running async snapshot writing.
+	snapshotting uint32
 
 	/// Runtime entities
 	// current node id.
@@ -86,6 +104,12 @@ type Runtime struct {
 	rpcMethod string
 	// tracks the outgoing rpc requests.
 	rpcTrackCh chan *rpcTracker
+	// rpc method for log fetching requests.
+	fetchMethod string
+	// catch-up lock for follower log fetching.
+	catchUpLock sync.Mutex
+	// flag for running async catch-up.
+	catchingUp uint32
 
 	//// Parameters
 	// prepare threshold defines the minimum node count requirement for prepare operation.
@@ -96,6 +120,8 @@ type Runtime struct {
 	prepareTimeout time.Duration
 	// commit timeout defines the max allowed time for commit operation.
 	commitTimeout time.Duration
+	// snapshot interval defines the minimum log count between wal snapshots.
+	snapshotInterval uint64
 	// channel for awaiting commits.
 	commitCh chan *commitReq
 
@@ -112,6 +138,8 @@ type commitReq struct {
 	index      uint64
 	lastCommit uint64
 	log        *kt.Log
+	snapshot   *kt.Snapshot
+	queued     time.Time
 	result     chan *commitResult
 }
 
@@ -200,11 +228,16 @@ func NewRuntime(cfg *kt.RuntimeConfig) (rt *Runtime, err error) {
 		commitThreshold:  cfg.CommitThreshold,
 		commitTimeout:    cfg.CommitTimeout,
 		commitCh:         make(chan *commitReq, commitWindow),
+		snapshotInterval: cfg.SnapshotInterval,
 
 		// stop coordinator
 		stopCh: make(chan struct{}),
 	}
 
+	if cfg.FetchMethodName != "" {
+		rt.fetchMethod = fmt.Sprintf("%v.%v", cfg.ServiceName, cfg.FetchMethodName)
+	}
+
 	// read from pool to rebuild uncommitted log map
 	if err = rt.readLogs(); err != nil {
 		return
@@ -493,14 +526,16 @@ func (r *Runtime) followerPrepare(l *kt.Log) (err error) {
 		return
 	}
 
+	// mark pending before writing log, so the log is always retained by wal compaction
+	r.markPendingPrepare(l.Index)
+
 	// write log
 	if err = r.wal.Write(l); err != nil {
+		r.markPrepareFinished(l.Index)
 		err = errors.Wrap(err, "write follower prepare log failed")
 		return
 	}
 
-	r.markPendingPrepare(l.Index)
-
 	return
 }
 
@@ -522,7 +557,7 @@ func (r *Runtime) followerRollback(l *kt.Log) (err error) {
 		err = errors.Wrap(err, "write follower rollback log failed")
 	}
 
-	r.markPrepareFinished(l.Index)
+	r.markPrepareFinished(prepareLog.Index)
 
 	return
 }
@@ -530,11 +565,24 @@ func (r *Runtime) followerRollback(l *kt.Log) (err error) {
 func (r *Runtime) followerCommit(l *kt.Log) (err error) {
 	var prepareLog *kt.Log
 	var lastCommit uint64
-	if lastCommit, prepareLog, err = r.getPrepareLog(l); err != nil {
+	lastCommit, prepareLog, err = r.getPrepareLog(l)
+	if err != nil && errors.Cause(err) != kt.ErrInvalidLog && r.fetchMethod != "" {
+		// prepare log is missing, catch up with leader, the commit itself is applied during catch-up
+		if err = r.catchUp(r.peers.Leader, l.Index); err != nil {
+			err = errors.Wrap(err, "catch up missing logs in commit failed")
+		}
+		return
+	}
+	if err != nil {
 		err = errors.Wrap(err, "get original request in commit failed")
 		return
 	}
 
+	return r.applyCommit(l, prepareLog, lastCommit)
+}
+
+func (r *Runtime) applyCommit(l *kt.Log, prepareLog *kt.Log, lastCommit uint64) (err error) {
+
 	// check if prepare already processed
 	if r.checkIfPrepareFinished(prepareLog.Index) {
 		err = errors.Wrap(kt.ErrInvalidLog, "prepare request already processed")
@@ -546,7 +594,7 @@ func (r *Runtime) followerCommit(l *kt.Log) (err error) {
 		err = cResult.err
 	}
 
-	r.markPrepareFinished(l.Index)
+	r.markPrepareFinished(prepareLog.Index)
 
 	return
 }
@@ -626,6 +674,10 @@ func (r *Runtime) followerCommitResult(ctx context.Context, commitLog *kt.Log, p
 
 	select {
 	case <-ctx.Done():
+	case <-r.stopCh:
+		res <- &commitResult{
+			err: kt.ErrStopped,
+		}
 	case r.commitCh <- req:
 	}
 
@@ -645,6 +697,7 @@ func (r *Runtime) commitCycle() {
 
 		if cReq != nil {
 			r.doCommit(cReq)
+			r.checkSnapshot()
 		}
 	}
 }
@@ -691,6 +744,7 @@ func (r *Runtime) leaderDoCommit(req *commitReq) (dbCost time.Duration, tracker
 
 	// mark last commit
 	atomic.StoreUint64(&r.lastCommit, l.Index)
+	r.markPrepareFinished(req.index)
 
 	// send commit
 	tracker = r.rpc(l, r.minCommitFollowers)
@@ -703,6 +757,13 @@ func (r *Runtime) leaderDoCommit(req *commitReq) (dbCost time.Duration, tracker
 }
 
 func (r *Runtime) followerDoCommit(req *commitReq) (err error) {
+	if req.snapshot != nil {
+		// snapshot fetched from leader during catch-up
+		err = r.installSnapshot(req.snapshot)
+		req.result <- &commitResult{err: err}
+		return
+	}
+
 	if req.log == nil {
 		log.Fatal("NO LOG FOR FOLLOWER COMMIT")
 		return
@@ -710,10 +771,25 @@ func (r *Runtime) followerDoCommit(req *commitReq) (err error) {
 
 	// check for last commit availability
 	myLastCommit := atomic.LoadUint64(&r.lastCommit)
-	if req.lastCommit != myLastCommit {
-		// TODO(): need counter for retries, infinite commit re-order would cause troubles
+	if req.lastCommit < myLastCommit {
+		// already covered by newer commits, e.g. applied during catch-up
+		err = errors.Wrapf(kt.ErrInvalidLog, "stale commit log (head: %v, supplied: %v)", myLastCommit, req.lastCommit)
+		req.result <- &commitResult{err: err}
+		return
+	} else if req.lastCommit > myLastCommit {
+		// previous commits are not received yet, catch up with leader if it takes too long
+		if req.queued.IsZero() {
+			req.queued = time.Now()
+		} else if r.fetchMethod != "" && time.Since(req.queued) > catchUpWait {
+			req.queued = time.Now()
+			r.asyncCatchUp(r.peers.Leader, req.lastCommit)
+		}
 		go func(req *commitReq) {
-			r.commitCh <- req
+			select {
+			case <-r.stopCh:
+				req.result <- &commitResult{err: kt.ErrStopped}
+			case r.commitCh <- req:
+			}
 		}(req)
 		return
 	}
@@ -729,6 +805,7 @@ func (r *Runtime) followerDoCommit(req *commitReq) (err error) {
 
 	// mark last commit
 	atomic.StoreUint64(&r.lastCommit, req.log.Index)
+	r.markPrepareFinished(req.index)
 
 	req.result <- &commitResult{err: err}
 
@@ -769,6 +846,11 @@ func (r *Runtime) newLog(logType kt.LogType, data []byte) (l *kt.Log, err error)
 		Data: data,
 	}
 
+	if logType == kt.LogPrepare {
+		// mark pending before writing log, so the log is always retained by wal compaction
+		r.markPendingPrepare(i)
+	}
+
 	// error write will be a fatal error, cause to node to fail fast
 	if err = r.wal.Write(l); err != nil {
 		log.Fatalf("WRITE LOG FAILED: %v", err)
@@ -779,7 +861,34 @@ func (r *Runtime) newLog(logType kt.LogType, data []byte) (l *kt.Log, err error)
 
 func (r *Runtime) readLogs() (err error) {
 	// load logs, only called during init
-	var l *kt.Log
+	var (
+		l           *kt.Log
+		s           *kt.Snapshot
+		sh, restore = r.sh.(kt.Snapshotter)
+	)
+
+	if d, ok := r.sh.(kt.DurableSnapshotter); ok && d.Durable() {
+		// the applied state is already there
+		restore = false
+	}
+
+	// load snapshot first, the following logs are the tail after the snapshot
+	if s, err = r.wal.Snapshot(); err != nil {
+		err = errors.Wrap(err, "load snapshot in wal failed")
+		return
+	}
+	if s != nil {
+		r.lastCommit = s.Index
+		r.snapshotIndex = s.Index
+		r.snapshot = s
+		r.nextIndex = s.Index + 1
+		if restore {
+			if err = sh.Restore(s.Data); err != nil {
+				err = errors.Wrap(err, "restore snapshot failed")
+				return
+			}
+		}
+	}
 
 	for {
 		if l, err = r.wal.Read(); err != nil && err != io.EOF {
@@ -811,6 +920,12 @@ func (r *Runtime) readLogs() (err error) {
 				err = errors.Wrap(kt.ErrInvalidLog, "previous prepare already committed/rollback")
 				return
 			}
+			if restore {
+				// replay committed log to the restored state
+				if err = r.replayCommit(prepareLog); err != nil {
+					return
+				}
+			}
 			r.lastCommit = l.Index
 			// resolve previous prepared
 			delete(r.pendingPrepares, prepareLog.Index)
@@ -840,6 +955,112 @@ func (r *Runtime) readLogs() (err error) {
 	return
 }
 
+func (r *Runtime) replayCommit(prepareLog *kt.Log) (err error) {
+	var req interface{}
+	if req, err = r.sh.DecodePayload(prepareLog.Data); err != nil {
+		err = errors.Wrap(err, "decode kayak payload failed")
+		return
+	}
+	// commit error is the result of the request, which is not a replay failure
+	if _, cerr := r.sh.Commit(req); cerr != nil {
+		log.WithFields(log.Fields{
+			"i": prepareLog.Index,
+		}).WithError(cerr).Debug("replay committed log")
+	}
+	return
+}
+
+// checkSnapshot takes a new snapshot and compacts the wal if there are enough logs since last
+// snapshot, it's called in commit cycle so that no commit happens while the handler fixes the
+// state to snapshot, the snapshot file is written and the wal is compacted asynchronously. The
+// wal is never compacted if the handler can't snapshot its applied state, since the truncated
+// logs are still required to rebuild the state.
+func (r *Runtime) checkSnapshot() {
+	sh, ok := r.sh.(kt.Snapshotter)
+	if !ok || r.snapshotInterval == 0 {
+		return
+	}
+
+	lastCommit := atomic.LoadUint64(&r.lastCommit)
+	r.snapshotLock.RLock()
+	snapshotIndex := r.snapshotIndex
+	r.snapshotLock.RUnlock()
+	if lastCommit < snapshotIndex+r.snapshotInterval {
+		return
+	}
+	if !atomic.CompareAndSwapUint32(&r.snapshotting, 0, 1) {
+		// the previous snapshot is still under writing
+		return
+	}
+
+	s := &kt.Snapshot{
+		Index: lastCommit,
+	}
+
+	r.pendingPreparesLock.RLock()
+	for i := range r.pendingPrepares {
+		if i < lastCommit {
+			s.Pending = append(s.Pending, i)
+		}
+	}
+	r.pendingPreparesLock.RUnlock()
+	sort.Slice(s.Pending, func(i, j int) bool { return s.Pending[i] < s.Pending[j] })
+
+	var (
+		write func() ([]byte, error)
+		err   error
+	)
+	logSnapshot := func() {
+		log.WithFields(log.Fields{
+			"i": s.Index,
+			"p": len(s.Pending),
+		}).WithError(err).Info("kayak wal snapshot")
+	}
+
+	if write, err = sh.Snapshot(); err != nil {
+		err = errors.Wrap(err, "snapshot handler state failed")
+		atomic.StoreUint32(&r.snapshotting, 0)
+		logSnapshot()
+		return
+	}
+
+	r.goFunc(func() {
+		defer atomic.StoreUint32(&r.snapshotting, 0)
+		defer logSnapshot()
+
+		if s.Data, err = write(); err != nil {
+			err = errors.Wrap(err, "write handler snapshot failed")
+			return
+		}
+		err = r.compact(sh, s)
+	})
+}
+
+// compact saves s as the wal snapshot and truncates the logs covered by it. The snapshot file of
+// the replaced snapshot is dropped, or the one of s if it's not saved.
+func (r *Runtime) compact(sh kt.Snapshotter, s *kt.Snapshot) (err error) {
+	var drop *kt.Snapshot
+
+	r.snapshotLock.Lock()
+	if s.Index <= r.snapshotIndex {
+		// a newer snapshot is installed meanwhile
+		drop = s
+	} else if err = r.wal.Compact(s); err != nil {
+		err = errors.Wrap(err, "compact wal failed")
+		drop = s
+	} else {
+		drop, r.snapshot, r.snapshotIndex = r.snapshot, s, s.Index
+	}
+	r.snapshotLock.Unlock()
+
+	if drop != nil {
+		if derr := sh.DropSnapshot(drop.Data); derr != nil {
+			log.WithField("i", drop.Index).WithError(derr).Warning("drop kayak snapshot failed")
+		}
+	}
+	return
+}
+
 func (r *Runtime) updateNextIndex(l *kt.Log) {
 	r.nextIndexLock.Lock()
 	defer r.nextIndexLock.Unlock()
@@ -22,3 +22,8 @@ import "github.com/CovenantSQL/CovenantSQL/proto"
 func (r *Runtime) SetCaller(id proto.NodeID, c Caller) {
 	r.callerMap.Store(id, c)
 }
+
+// SetSnapshotChunkSize injects snapshot chunk size for test purpose.
+func SetSnapshotChunkSize(n int) {
+	snapshotChunkSize = n
+}
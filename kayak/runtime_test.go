@@ -22,6 +22,8 @@ import (
 	"database/sql"
 	"encoding/binary"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math/rand"
 	"net"
 	"net/rpc"
@@ -127,6 +129,73 @@ func (s *sqliteStorage) Close() {
 	}
 }
 
+type counterHandler struct {
+	count uint64
+}
+
+func (h *counterHandler) EncodePayload(request interface{}) (data []byte, err error) {
+	data = make([]byte, 8)
+	binary.BigEndian.PutUint64(data, request.(uint64))
+	return
+}
+
+func (h *counterHandler) DecodePayload(data []byte) (request interface{}, err error) {
+	if len(data) != 8 {
+		err = errors.New("invalid data")
+		return
+	}
+	request = binary.BigEndian.Uint64(data)
+	return
+}
+
+func (h *counterHandler) Check(data interface{}) (err error) {
+	return nil
+}
+
+func (h *counterHandler) Commit(data interface{}) (result interface{}, err error) {
+	h.count += data.(uint64)
+	return h.count, nil
+}
+
+// the snapshot data of counter handler is the count itself instead of a file reference.
+func (h *counterHandler) Snapshot() (write func() ([]byte, error), err error) {
+	count := h.count
+	write = func() ([]byte, error) {
+		return h.EncodePayload(count)
+	}
+	return
+}
+
+func (h *counterHandler) ReadSnapshot(data []byte, p []byte, off int64) (n int, err error) {
+	return bytes.NewReader(data).ReadAt(p, off)
+}
+
+func (h *counterHandler) WriteSnapshot(r io.Reader) (data []byte, err error) {
+	return ioutil.ReadAll(r)
+}
+
+func (h *counterHandler) DropSnapshot(data []byte) (err error) {
+	return
+}
+
+func (h *counterHandler) Restore(data []byte) (err error) {
+	var c interface{}
+	if c, err = h.DecodePayload(data); err != nil {
+		return
+	}
+	h.count = c.(uint64)
+	return
+}
+
+// durableCounterHandler is a counterHandler which keeps the count across restarts.
+type durableCounterHandler struct {
+	counterHandler
+}
+
+func (h *durableCounterHandler) Durable() bool {
+	return true
+}
+
 type fakeMux struct {
 	mux map[proto.NodeID]*fakeService
 }
@@ -165,6 +234,10 @@ func (s *fakeService) Call(req *kt.RPCRequest, resp *interface{}) (err error) {
 	return s.rt.FollowerApply(req.Log)
 }
 
+func (s *fakeService) Fetch(req *kt.FetchRequest, resp *kt.FetchResponse) (err error) {
+	return s.rt.ServeFetch(req, resp)
+}
+
 func (s *fakeService) serveConn(c net.Conn) {
 	s.s.ServeCodec(utils.GetMsgPackServerCodec(c))
 }
@@ -191,6 +264,23 @@ func (c *fakeCaller) Call(method string, req interface{}, resp interface{}) (err
 	return client.Call(method, req, resp)
 }
 
+// lossyCaller silently drops the requests to simulate lost messages.
+type lossyCaller struct {
+	*fakeCaller
+	drop        uint32
+	dropPrepare uint32
+}
+
+func (c *lossyCaller) Call(method string, req interface{}, resp interface{}) (err error) {
+	if atomic.LoadUint32(&c.drop) == 1 {
+		return
+	}
+	if r, ok := req.(*kt.RPCRequest); ok && r.Log.Type == kt.LogPrepare && atomic.LoadUint32(&c.dropPrepare) == 1 {
+		return
+	}
+	return c.fakeCaller.Call(method, req, resp)
+}
+
 func TestRuntime(t *testing.T) {
 	Convey("runtime test", t, func(c C) {
 		lvl := log.GetLevel()
@@ -497,6 +587,252 @@ func TestRuntime(t *testing.T) {
 	})
 }
 
+func TestRuntimeCompaction(t *testing.T) {
+	Convey("test wal compaction", t, func() {
+		lvl := log.GetLevel()
+		log.SetLevel(log.FatalLevel)
+		defer log.SetLevel(lvl)
+		defer os.RemoveAll("testCompaction.db")
+
+		node1 := proto.NodeID("000005aa62048f85da4ae9698ed59c14ec0d48a88a07c15a32265634e7e64ade")
+		peers := &proto.Peers{
+			PeersHeader: proto.PeersHeader{
+				Leader:  node1,
+				Servers: []proto.NodeID{node1},
+			},
+		}
+		privKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		err = peers.Sign(privKey)
+		So(err, ShouldBeNil)
+
+		newRuntime := func(h kt.Handler) (rt *kayak.Runtime, w *kl.LevelDBWal) {
+			w, err := kl.NewLevelDBWal("testCompaction.db")
+			So(err, ShouldBeNil)
+			rt, err = kayak.NewRuntime(&kt.RuntimeConfig{
+				Handler:          h,
+				PrepareThreshold: 1.0,
+				CommitThreshold:  1.0,
+				PrepareTimeout:   time.Second,
+				CommitTimeout:    10 * time.Second,
+				Peers:            peers,
+				Wal:              w,
+				NodeID:           node1,
+				ServiceName:      "Test",
+				MethodName:       "Call",
+				SnapshotInterval: 10,
+			})
+			So(err, ShouldBeNil)
+			So(rt.Start(), ShouldBeNil)
+			return
+		}
+
+		h := &counterHandler{}
+		rt, w := newRuntime(h)
+		for i := 0; i < 100; i++ {
+			_, _, err = rt.Apply(context.Background(), uint64(1))
+			So(err, ShouldBeNil)
+		}
+		So(h.count, ShouldEqual, 100)
+		So(rt.Shutdown(), ShouldBeNil)
+
+		// logs covered by snapshot are truncated
+		s, err := w.Snapshot()
+		So(err, ShouldBeNil)
+		So(s, ShouldNotBeNil)
+		So(s.Index, ShouldBeGreaterThanOrEqualTo, 180)
+		So(s.Pending, ShouldBeEmpty)
+		_, err = w.Get(0)
+		So(err, ShouldNotBeNil)
+		l, err := w.Get(s.Index + 1)
+		So(err, ShouldBeNil)
+		So(l.Type, ShouldEqual, kt.LogPrepare)
+		w.Close()
+
+		// load from snapshot plus tail
+		h = &counterHandler{}
+		rt, w = newRuntime(h)
+		So(h.count, ShouldEqual, 100)
+		var res interface{}
+		res, _, err = rt.Apply(context.Background(), uint64(1))
+		So(err, ShouldBeNil)
+		So(res, ShouldEqual, 101)
+		So(rt.Shutdown(), ShouldBeNil)
+		w.Close()
+
+		// durable state is neither restored nor replayed
+		dh := &durableCounterHandler{counterHandler{count: 101}}
+		rt, w = newRuntime(dh)
+		defer w.Close()
+		So(dh.count, ShouldEqual, 101)
+		res, _, err = rt.Apply(context.Background(), uint64(1))
+		So(err, ShouldBeNil)
+		So(res, ShouldEqual, 102)
+		So(rt.Shutdown(), ShouldBeNil)
+	})
+}
+
+func TestRuntimeCompactionWithoutSnapshotter(t *testing.T) {
+	Convey("test wal compaction without handler snapshot", t, func() {
+		lvl := log.GetLevel()
+		log.SetLevel(log.FatalLevel)
+		defer log.SetLevel(lvl)
+
+		node1 := proto.NodeID("000005aa62048f85da4ae9698ed59c14ec0d48a88a07c15a32265634e7e64ade")
+		peers := &proto.Peers{
+			PeersHeader: proto.PeersHeader{
+				Leader:  node1,
+				Servers: []proto.NodeID{node1},
+			},
+		}
+		privKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		err = peers.Sign(privKey)
+		So(err, ShouldBeNil)
+
+		// hide the Snapshotter methods of the counter handler
+		h := &counterHandler{}
+		w := kl.NewMemWal()
+		defer w.Close()
+		rt, err := kayak.NewRuntime(&kt.RuntimeConfig{
+			Handler:          struct{ kt.Handler }{h},
+			PrepareThreshold: 1.0,
+			CommitThreshold:  1.0,
+			PrepareTimeout:   time.Second,
+			CommitTimeout:    10 * time.Second,
+			Peers:            peers,
+			Wal:              w,
+			NodeID:           node1,
+			ServiceName:      "Test",
+			MethodName:       "Call",
+			SnapshotInterval: 10,
+		})
+		So(err, ShouldBeNil)
+		So(rt.Start(), ShouldBeNil)
+		for i := 0; i < 50; i++ {
+			_, _, err = rt.Apply(context.Background(), uint64(1))
+			So(err, ShouldBeNil)
+		}
+		So(rt.Shutdown(), ShouldBeNil)
+		So(h.count, ShouldEqual, 50)
+
+		// the logs are kept to rebuild the state
+		s, err := w.Snapshot()
+		So(err, ShouldBeNil)
+		So(s, ShouldBeNil)
+		_, err = w.Get(0)
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestRuntimeCatchUp(t *testing.T) {
+	Convey("test follower catch-up", t, func() {
+		lvl := log.GetLevel()
+		log.SetLevel(log.FatalLevel)
+		defer log.SetLevel(lvl)
+
+		node1 := proto.NodeID("000005aa62048f85da4ae9698ed59c14ec0d48a88a07c15a32265634e7e64ade")
+		node2 := proto.NodeID("000005f4f22c06f76c43c4f48d5a7ec1309cc94030cbf9ebae814172884ac8b5")
+		peers := &proto.Peers{
+			PeersHeader: proto.PeersHeader{
+				Leader:  node1,
+				Servers: []proto.NodeID{node1, node2},
+			},
+		}
+		privKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		err = peers.Sign(privKey)
+		So(err, ShouldBeNil)
+
+		newRuntime := func(h kt.Handler, w kt.Wal, nodeID proto.NodeID) (rt *kayak.Runtime) {
+			rt, err := kayak.NewRuntime(&kt.RuntimeConfig{
+				Handler:          h,
+				PrepareThreshold: 1.0,
+				CommitThreshold:  1.0,
+				PrepareTimeout:   time.Second,
+				CommitTimeout:    10 * time.Second,
+				Peers:            peers,
+				Wal:              w,
+				NodeID:           nodeID,
+				ServiceName:      "Test",
+				MethodName:       "Call",
+				FetchMethodName:  "Fetch",
+				SnapshotInterval: 10,
+			})
+			So(err, ShouldBeNil)
+			return
+		}
+
+		// snapshot is fetched in several chunks
+		kayak.SetSnapshotChunkSize(3)
+		defer kayak.SetSnapshotChunkSize(1 << 20)
+
+		h1, h2 := &counterHandler{}, &counterHandler{}
+		wal1, wal2 := kl.NewMemWal(), kl.NewMemWal()
+		defer wal1.Close()
+		defer wal2.Close()
+		rt1 := newRuntime(h1, wal1, node1)
+		rt2 := newRuntime(h2, wal2, node2)
+
+		m := newFakeMux()
+		m.register(node1, newFakeService(rt1))
+		m.register(node2, newFakeService(rt2))
+		c := &lossyCaller{fakeCaller: newFakeCaller(m, node2), drop: 1}
+		rt1.SetCaller(node2, c)
+		rt2.SetCaller(node1, newFakeCaller(m, node1))
+
+		So(rt1.Start(), ShouldBeNil)
+		defer rt1.Shutdown()
+		So(rt2.Start(), ShouldBeNil)
+		defer rt2.Shutdown()
+
+		// follower misses logs already compacted by leader
+		for i := 0; i < 50; i++ {
+			_, _, err = rt1.Apply(context.Background(), uint64(1))
+			So(err, ShouldBeNil)
+		}
+		So(h1.count, ShouldEqual, 50)
+		So(h2.count, ShouldEqual, 0)
+		// snapshot is written asynchronously
+		var s *kt.Snapshot
+		for i := 0; i < 100 && s == nil; i++ {
+			time.Sleep(10 * time.Millisecond)
+			s, err = wal1.Snapshot()
+			So(err, ShouldBeNil)
+		}
+		So(s, ShouldNotBeNil)
+
+		// out-of-order commit triggers catch-up with snapshot
+		atomic.StoreUint32(&c.drop, 0)
+		_, _, err = rt1.Apply(context.Background(), uint64(1))
+		So(err, ShouldBeNil)
+		So(h1.count, ShouldEqual, 51)
+		So(h2.count, ShouldEqual, 51)
+		s, err = wal2.Snapshot()
+		So(err, ShouldBeNil)
+		So(s, ShouldNotBeNil)
+
+		// commit without prepare triggers catch-up with logs
+		atomic.StoreUint32(&c.dropPrepare, 1)
+		for i := 0; i < 5; i++ {
+			_, _, err = rt1.Apply(context.Background(), uint64(1))
+			So(err, ShouldBeNil)
+			So(h2.count, ShouldEqual, h1.count)
+		}
+		So(h2.count, ShouldEqual, 56)
+
+		// follower fetching is not served by leader
+		_, _, err = rt2.Fetch(0, 0)
+		So(errors.Cause(err), ShouldEqual, kt.ErrNotLeader)
+		_, err = rt2.FetchSnapshot(s.Index, 0)
+		So(errors.Cause(err), ShouldEqual, kt.ErrNotLeader)
+
+		// snapshot replaced by leader is not found
+		_, err = rt1.FetchSnapshot(1, 0)
+		So(errors.Cause(err), ShouldEqual, kt.ErrSnapshotNotFound)
+	})
+}
+
 func BenchmarkRuntime(b *testing.B) {
 	Convey("runtime test", b, func(c C) {
 		log.SetLevel(log.DebugLevel)
@@ -38,6 +38,9 @@ type RuntimeConfig struct {
 	Peers *proto.Peers
 	// wal for kayak.
 	Wal Wal
+	// minimum log count between snapshots, wal compaction is disabled if it's 0 or the handler
+	// does not implement Snapshotter.
+	SnapshotInterval uint64
 	// current node id.
 	NodeID proto.NodeID
 	// current instance id.
@@ -46,4 +49,6 @@ type RuntimeConfig struct {
 	ServiceName string
 	// mux service method.
 	MethodName string
+	// mux service method for log fetching, follower catch-up is disabled if it's empty.
+	FetchMethodName string
 }
@@ -35,4 +35,8 @@ var (
 	ErrNeedRecovery = errors.New("need recovery")
 	// ErrInvalidConfig represents invalid kayak runtime config.
 	ErrInvalidConfig = errors.New("invalid runtime config")
+	// ErrSnapshotNotFound represents the requested snapshot is not found, e.g. replaced by a newer one.
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+	// ErrStopped represents the kayak runtime is already stopped.
+	ErrStopped = errors.New("runtime stopped")
 )
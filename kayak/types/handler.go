@@ -16,6 +16,8 @@
 
 package types
 
+import "io"
+
 // Handler defines the main underlying fsm of kayak.
 type Handler interface {
 	EncodePayload(req interface{}) (data []byte, err error)
@@ -23,3 +25,31 @@ type Handler interface {
 	Check(request interface{}) error
 	Commit(request interface{}) (result interface{}, err error)
 }
+
+// Snapshotter defines the optional handler extension to snapshot and restore the applied state.
+// For the handlers implementing it, the state is restored from the last snapshot with the
+// committed logs following it replayed during startup, and the lagging followers are caught up by
+// the snapshot of leader if the logs are already compacted.
+//
+// The snapshots are files kept by the handler, which are referenced by the opaque data saved in
+// the wal snapshot records. Snapshot is called in the commit cycle, it should only fix the applied
+// state to snapshot, e.g. by pinning a read transaction of the storage, and return write, which is
+// called out of the commit cycle to write the fixed state to a new snapshot file and returns its
+// reference. ReadSnapshot reads the snapshot file in the manner of io.ReaderAt, so that it's
+// streamed to the followers in chunks, and WriteSnapshot saves a snapshot streamed from the leader
+// as a new local file. Restore replaces the applied state by a snapshot file, and DropSnapshot
+// removes a snapshot file which is no longer referenced.
+type Snapshotter interface {
+	Snapshot() (write func() (data []byte, err error), err error)
+	ReadSnapshot(data []byte, p []byte, off int64) (n int, err error)
+	WriteSnapshot(r io.Reader) (data []byte, err error)
+	Restore(data []byte) error
+	DropSnapshot(data []byte) error
+}
+
+// DurableSnapshotter defines the Snapshotter with durable state, which survives restarts by
+// itself, so the snapshots are only used to catch up the lagging followers.
+type DurableSnapshotter interface {
+	Snapshotter
+	Durable() bool
+}
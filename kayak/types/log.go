@@ -72,3 +72,12 @@ type Log struct {
 	// Data could be detected and handle decode properly by log layer
 	Data []byte
 }
+
+// Snapshot defines the applied state snapshot tied to a commit log index. Logs up to the snapshot
+// index are truncated from wal, except the pending prepare logs which are still to be committed
+// or rolled back.
+type Snapshot struct {
+	Index   uint64   // last commit log index covered by the snapshot
+	Pending []uint64 // indexes of the pending prepare logs retained in wal
+	Data    []byte   // reference of the snapshot file of handler, see Snapshotter
+}
@@ -24,3 +24,25 @@ type RPCRequest struct {
 	Instance string
 	Log      *Log
 }
+
+// FetchRequest defines the log fetching request from follower to leader.
+type FetchRequest struct {
+	proto.Envelope
+	Instance string
+	// From and To define the inclusive log index range to fetch, To = 0 fetches up to the latest log.
+	From uint64
+	To   uint64
+	// SnapshotIndex and SnapshotOffset define the chunk of the snapshot file to fetch instead of
+	// the logs if SnapshotIndex is not 0.
+	SnapshotIndex  uint64
+	SnapshotOffset int64
+}
+
+// FetchResponse defines the log fetching response, the Snapshot is provided if the requested
+// logs are already compacted by the leader, the file of which is then fetched by chunks. An empty
+// Chunk indicates the end of the snapshot file.
+type FetchResponse struct {
+	Snapshot *Snapshot
+	Logs     []*Log
+	Chunk    []byte
+}
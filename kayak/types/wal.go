@@ -24,4 +24,8 @@ type Wal interface {
 	Read() (*Log, error)
 	// random access
 	Get(index uint64) (*Log, error)
+	// save snapshot and truncate logs covered by the snapshot atomically
+	Compact(*Snapshot) error
+	// load last snapshot, return nil snapshot if there is no snapshot
+	Snapshot() (*Snapshot, error)
 }
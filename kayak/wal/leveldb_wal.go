@@ -36,6 +36,8 @@ var (
 	logHeaderKeyPrefix = []byte{'L', 'H'}
 	// logDataKeyPrefix defines the leveldb data key prefix.
 	logDataKeyPrefix = []byte{'L', 'D'}
+	// snapshotKey defines the leveldb key of last snapshot.
+	snapshotKey = []byte{'S', 'N'}
 )
 
 // LevelDBWal defines a toy wal using leveldb as storage.
@@ -174,6 +176,84 @@ func (p *LevelDBWal) Get(i uint64) (l *kt.Log, err error) {
 	return p.load(headerData)
 }
 
+// Compact implements Wal.Compact.
+func (p *LevelDBWal) Compact(s *kt.Snapshot) (err error) {
+	if atomic.LoadUint32(&p.closed) == 1 {
+		err = ErrWalClosed
+		return
+	}
+
+	if s == nil {
+		err = ErrInvalidSnapshot
+		return
+	}
+
+	var (
+		enc      *bytes.Buffer
+		batch    = new(leveldb.Batch)
+		retained = make(map[uint64]bool, len(s.Pending))
+	)
+	for _, v := range s.Pending {
+		retained[v] = true
+	}
+
+	if enc, err = utils.EncodeMsgPack(s); err != nil {
+		err = errors.Wrap(err, "encode snapshot failed")
+		return
+	}
+	batch.Put(snapshotKey, enc.Bytes())
+
+	// truncate logs covered by the snapshot
+	it := p.db.NewIterator(&util.Range{
+		Start: append(append([]byte(nil), logHeaderKeyPrefix...), p.uint64ToBytes(0)...),
+		Limit: append(append([]byte(nil), logHeaderKeyPrefix...), p.uint64ToBytes(s.Index+1)...),
+	}, nil)
+	defer it.Release()
+	for it.Next() {
+		index := binary.BigEndian.Uint64(it.Key()[len(logHeaderKeyPrefix):])
+		if retained[index] {
+			continue
+		}
+		batch.Delete(append([]byte(nil), it.Key()...))
+		batch.Delete(append(append([]byte(nil), logDataKeyPrefix...), p.uint64ToBytes(index)...))
+	}
+	if err = it.Error(); err != nil {
+		err = errors.Wrap(err, "iterate logs failed")
+		return
+	}
+
+	if err = p.db.Write(batch, nil); err != nil {
+		err = errors.Wrap(err, "write snapshot failed")
+	}
+
+	return
+}
+
+// Snapshot implements Wal.Snapshot.
+func (p *LevelDBWal) Snapshot() (s *kt.Snapshot, err error) {
+	if atomic.LoadUint32(&p.closed) == 1 {
+		err = ErrWalClosed
+		return
+	}
+
+	var enc []byte
+	if enc, err = p.db.Get(snapshotKey, nil); err == leveldb.ErrNotFound {
+		err = nil
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "get snapshot failed")
+		return
+	}
+
+	s = new(kt.Snapshot)
+	if err = utils.DecodeMsgPack(enc, s); err != nil {
+		err = errors.Wrap(err, "decode snapshot failed")
+		s = nil
+	}
+
+	return
+}
+
 // Close implements Wal.Close.
 func (p *LevelDBWal) Close() {
 	if !atomic.CompareAndSwapUint32(&p.closed, 0, 1) {
@@ -144,3 +144,80 @@ func TestLevelDBWal_Write(t *testing.T) {
 		So(err, ShouldNotBeNil)
 	})
 }
+
+func TestLevelDBWal_Compact(t *testing.T) {
+	Convey("wal compact/snapshot", t, func() {
+		dbFile := "testCompact.ldb"
+
+		var p *LevelDBWal
+		var err error
+		p, err = NewLevelDBWal(dbFile)
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dbFile)
+
+		for i := 0; i != 10; i++ {
+			err = p.Write(&kt.Log{
+				LogHeader: kt.LogHeader{
+					Index: uint64(i),
+					Type:  kt.LogPrepare,
+				},
+				Data: []byte("happy"),
+			})
+			So(err, ShouldBeNil)
+		}
+
+		var s *kt.Snapshot
+		s, err = p.Snapshot()
+		So(err, ShouldBeNil)
+		So(s, ShouldBeNil)
+
+		err = p.Compact(nil)
+		So(err, ShouldNotBeNil)
+
+		s1 := &kt.Snapshot{
+			Index:   5,
+			Pending: []uint64{2},
+			Data:    []byte("state"),
+		}
+		err = p.Compact(s1)
+		So(err, ShouldBeNil)
+
+		s, err = p.Snapshot()
+		So(err, ShouldBeNil)
+		So(s, ShouldResemble, s1)
+
+		_, err = p.Get(1)
+		So(err, ShouldNotBeNil)
+		_, err = p.Get(5)
+		So(err, ShouldNotBeNil)
+		_, err = p.Get(2)
+		So(err, ShouldBeNil)
+		_, err = p.Get(6)
+		So(err, ShouldBeNil)
+
+		p.Close()
+
+		_, err = p.Snapshot()
+		So(err, ShouldEqual, ErrWalClosed)
+		err = p.Compact(s1)
+		So(err, ShouldEqual, ErrWalClosed)
+
+		// load again, read the retained logs
+		p, err = NewLevelDBWal(dbFile)
+		So(err, ShouldBeNil)
+		defer p.Close()
+
+		s, err = p.Snapshot()
+		So(err, ShouldBeNil)
+		So(s, ShouldResemble, s1)
+
+		var l *kt.Log
+		for _, i := range []uint64{2, 6, 7, 8, 9} {
+			l, err = p.Read()
+			So(err, ShouldBeNil)
+			So(l.Index, ShouldEqual, i)
+		}
+		_, err = p.Read()
+		So(err, ShouldEqual, io.EOF)
+	})
+}
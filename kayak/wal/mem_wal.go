@@ -31,6 +31,7 @@ type MemWal struct {
 	revIndex map[uint64]int
 	offset   uint64
 	closed   uint32
+	snapshot *kt.Snapshot
 }
 
 // NewMemWal returns new memory wal instance.
@@ -105,6 +106,59 @@ func (p *MemWal) Get(index uint64) (l *kt.Log, err error) {
 	return
 }
 
+// Compact implements Wal.Compact.
+func (p *MemWal) Compact(s *kt.Snapshot) (err error) {
+	if atomic.LoadUint32(&p.closed) == 1 {
+		err = ErrWalClosed
+		return
+	}
+
+	if s == nil {
+		err = ErrInvalidSnapshot
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	retained := make(map[uint64]bool, len(s.Pending))
+	for _, v := range s.Pending {
+		retained[v] = true
+	}
+
+	logs := make([]*kt.Log, 0, len(p.logs))
+	revIndex := make(map[uint64]int, len(p.logs))
+	for _, l := range p.logs {
+		if l.Index <= s.Index && !retained[l.Index] {
+			continue
+		}
+		revIndex[l.Index] = len(logs)
+		logs = append(logs, l)
+	}
+
+	p.logs = logs
+	p.revIndex = revIndex
+	atomic.StoreUint64(&p.offset, uint64(len(logs)))
+	p.snapshot = s
+
+	return
+}
+
+// Snapshot implements Wal.Snapshot.
+func (p *MemWal) Snapshot() (s *kt.Snapshot, err error) {
+	if atomic.LoadUint32(&p.closed) == 1 {
+		err = ErrWalClosed
+		return
+	}
+
+	p.RLock()
+	defer p.RUnlock()
+
+	s = p.snapshot
+
+	return
+}
+
 // Close implements Wal.Close.
 func (p *MemWal) Close() {
 	if !atomic.CompareAndSwapUint32(&p.closed, 0, 1) {
@@ -187,3 +187,70 @@ func TestMemWal_Write2(t *testing.T) {
 		So(p.offset, ShouldEqual, 5)
 	})
 }
+
+func TestMemWal_Compact(t *testing.T) {
+	Convey("test mem wal compact", t, func() {
+		var p *MemWal
+		p = NewMemWal()
+
+		var err error
+		for i := 0; i != 10; i++ {
+			err = p.Write(&kt.Log{
+				LogHeader: kt.LogHeader{
+					Index: uint64(i),
+					Type:  kt.LogPrepare,
+				},
+				Data: []byte("happy"),
+			})
+			So(err, ShouldBeNil)
+		}
+
+		var s *kt.Snapshot
+		s, err = p.Snapshot()
+		So(err, ShouldBeNil)
+		So(s, ShouldBeNil)
+
+		err = p.Compact(nil)
+		So(err, ShouldNotBeNil)
+
+		s1 := &kt.Snapshot{
+			Index:   5,
+			Pending: []uint64{2},
+		}
+		err = p.Compact(s1)
+		So(err, ShouldBeNil)
+		So(p.logs, ShouldHaveLength, 5)
+		So(p.offset, ShouldEqual, 5)
+
+		s, err = p.Snapshot()
+		So(err, ShouldBeNil)
+		So(s, ShouldEqual, s1)
+
+		_, err = p.Get(1)
+		So(err, ShouldNotBeNil)
+		_, err = p.Get(2)
+		So(err, ShouldBeNil)
+		_, err = p.Get(9)
+		So(err, ShouldBeNil)
+
+		// write after compaction
+		err = p.Write(&kt.Log{
+			LogHeader: kt.LogHeader{
+				Index: 10,
+				Type:  kt.LogPrepare,
+			},
+		})
+		So(err, ShouldBeNil)
+		var l *kt.Log
+		l, err = p.Get(10)
+		So(err, ShouldBeNil)
+		So(l.Index, ShouldEqual, 10)
+
+		p.Close()
+
+		_, err = p.Snapshot()
+		So(err, ShouldEqual, ErrWalClosed)
+		err = p.Compact(s1)
+		So(err, ShouldEqual, ErrWalClosed)
+	})
+}
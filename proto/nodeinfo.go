@@ -199,6 +199,8 @@ const (
 	Miner
 	// Client is a client that send sql query to database
 	Client
+	// Observer is a node that subscribes and replicates the sql chain of database
+	Observer
 )
 
 func (s ServerRole) String() string {
@@ -211,6 +213,8 @@ func (s ServerRole) String() string {
 		return "Miner"
 	case Client:
 		return "Client"
+	case Observer:
+		return "Observer"
 	}
 	return "Unknown"
 }
@@ -249,6 +253,9 @@ func parseServerRole(roleStr string) (role ServerRole, err error) {
 	case "client":
 		role = Client
 		return
+	case "observer":
+		role = Observer
+		return
 	}
 
 	return Unknown, nil
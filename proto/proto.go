@@ -40,7 +40,11 @@ type EnvelopeAPI interface {
 	SetContext(context.Context)
 }
 
-// Envelope is the protocol header
+// Envelope is the protocol header.
+//
+// TTL and Expire carry the deadline of the call: TTL is the remaining time budget when the
+// request is sent, and Expire is the absolute deadline in unix nanoseconds. Since node clocks
+// may drift, the receiver derives its local deadline from TTL.
 type Envelope struct {
 	Version string          `json:"v"`
 	TTL     time.Duration   `json:"t"`
@@ -157,5 +161,19 @@ func (e *Envelope) SetContext(ctx context.Context) {
 	e._ctx = ctx
 }
 
+// SetDeadline sets the TTL and Expire of envelope from the deadline of ctx, the envelope is
+// left untouched if ctx has no deadline.
+func SetDeadline(ctx context.Context, e EnvelopeAPI) {
+	if deadline, ok := ctx.Deadline(); ok {
+		ttl := time.Until(deadline)
+		if ttl <= 0 {
+			// already expired, use the minimal ttl to fail fast on the remote side
+			ttl = time.Nanosecond
+		}
+		e.SetTTL(ttl)
+		e.SetExpire(time.Duration(deadline.UnixNano()))
+	}
+}
+
 // DatabaseID is database name, will be generated from UUID
 type DatabaseID string
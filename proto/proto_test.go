@@ -50,3 +50,25 @@ func TestEnvelope_GetSet(t *testing.T) {
 		So(env.GetContext(), ShouldEqual, cldCtx)
 	})
 }
+
+func TestSetDeadline(t *testing.T) {
+	Convey("set deadline from context", t, func() {
+		env := &Envelope{}
+		SetDeadline(context.Background(), env)
+		So(env.GetTTL(), ShouldEqual, 0)
+		So(env.GetExpire(), ShouldEqual, 0)
+
+		deadline := time.Now().Add(time.Minute)
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		defer cancel()
+		SetDeadline(ctx, env)
+		So(env.GetTTL(), ShouldBeGreaterThan, 0)
+		So(env.GetTTL(), ShouldBeLessThanOrEqualTo, time.Minute)
+		So(env.GetExpire(), ShouldEqual, time.Duration(deadline.UnixNano()))
+
+		ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
+		SetDeadline(ctx, env)
+		So(env.GetTTL(), ShouldEqual, time.Nanosecond)
+	})
+}
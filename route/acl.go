@@ -44,12 +44,18 @@ ACLs:
 	Miner -> Miner, Kayak.Call():
 		ACL: Open to Miner Leader.
 
+	Miner -> Miner, Kayak.Fetch():
+		ACL: Open to Database Peers
+
    	BP -> BP, Exchange NodeInfo, Kayak.Call():
   		ACL: Open to BP
 
    	Client -> Miner, SQL Query:
    		ACL: Open to Registered Client
 
+	Miner -> Miner, Observer -> Miner, SQLC.FetchBlock(), SQLC.SubscribeTransactions():
+		ACL: Open to Database Peers and Authorized Observers
+
    	* -> BP, DHT.Ping():
   		ACL: Open to world, add difficulty verification
 
@@ -77,8 +83,16 @@ const (
 	DBSAck
 	// DBSDeploy is used by BP to create/drop/update database
 	DBSDeploy
+	// DBSFetch is used by client to fetch the next page of query result cursor
+	DBSFetch
+	// DBSCloseCursor is used by client to close the query result cursor
+	DBSCloseCursor
+	// DBSBackup is used by the miner owner to take an online backup of a database
+	DBSBackup
 	// DBCCall is used by Miner for data consistency
 	DBCCall
+	// DBCFetch is used by Miner to fetch the missing consensus logs from the database leader
+	DBCFetch
 	// BPDBCreateDatabase is used by client to create database
 	BPDBCreateDatabase
 	// BPDBDropDatabase is used by client to drop database
@@ -103,10 +117,16 @@ const (
 	SQLCSubscribeTransactions
 	// SQLCCancelSubscription is used by sqlchain to handle observer subscription cancellation request
 	SQLCCancelSubscription
+	// SQLCStorageChallenge is used by sqlchain to challenge the storage proof of adjacent nodes
+	SQLCStorageChallenge
 	// OBSAdviseNewBlock is used by sqlchain to push new block to observers
 	OBSAdviseNewBlock
 	// MCCAdviseNewBlock is used by block producer to push block to adjacent nodes
 	MCCAdviseNewBlock
+	// MCCProposeBlock is used by block producer to propose new block and collect prevotes from adjacent nodes
+	MCCProposeBlock
+	// MCCPrecommitBlock is used by block producer to collect precommits of the proposed block from adjacent nodes
+	MCCPrecommitBlock
 	// MCCAdviseTxBilling is used by block producer to push billing transaction to adjacent nodes
 	MCCAdviseTxBilling
 	// MCCAdviseBillingRequest is used by block producer to push billing request to adjacent nodes
@@ -125,6 +145,8 @@ const (
 	MCCQueryAccountStableBalance
 	// MCCQueryAccountCovenantBalance is used by block producer to provide account covenant coin balance
 	MCCQueryAccountCovenantBalance
+	// MCCQuerySQLChainProfile is used by nodes to query the SQLChain profile of a database from block producer
+	MCCQuerySQLChainProfile
 
 	// DHTRPCName defines the block producer dh-rpc service name
 	DHTRPCName = "DHT"
@@ -159,8 +181,16 @@ func (s RemoteFunc) String() string {
 		return "DBS.Ack"
 	case DBSDeploy:
 		return "DBS.Deploy"
+	case DBSFetch:
+		return "DBS.Fetch"
+	case DBSCloseCursor:
+		return "DBS.CloseCursor"
+	case DBSBackup:
+		return "DBS.Backup"
 	case DBCCall:
 		return "DBC.Call"
+	case DBCFetch:
+		return "DBC.Fetch"
 	case BPDBCreateDatabase:
 		return "BPDB.CreateDatabase"
 	case BPDBDropDatabase:
@@ -185,10 +215,16 @@ func (s RemoteFunc) String() string {
 		return "SQLC.SubscribeTransactions"
 	case SQLCCancelSubscription:
 		return "SQLC.CancelSubscription"
+	case SQLCStorageChallenge:
+		return "SQLC.StorageChallenge"
 	case OBSAdviseNewBlock:
 		return "OBS.AdviseNewBlock"
 	case MCCAdviseNewBlock:
 		return "MCC.AdviseNewBlock"
+	case MCCProposeBlock:
+		return "MCC.ProposeBlock"
+	case MCCPrecommitBlock:
+		return "MCC.PrecommitBlock"
 	case MCCAdviseTxBilling:
 		return "MCC.AdviseTxBilling"
 	case MCCAdviseBillingRequest:
@@ -207,43 +243,168 @@ func (s RemoteFunc) String() string {
 		return "MCC.QueryAccountStableBalance"
 	case MCCQueryAccountCovenantBalance:
 		return "MCC.QueryAccountCovenantBalance"
+	case MCCQuerySQLChainProfile:
+		return "MCC.QuerySQLChainProfile"
 	}
 	return "Unknown"
 }
 
+// CallerRole defines the role of a RPC caller in the ACL.
+type CallerRole int
+
+const (
+	// AnonymousCaller is the caller using anonymous ETLS connection.
+	AnonymousCaller CallerRole = iota
+	// NodeCaller is any non-anonymous caller.
+	NodeCaller
+	// BPCaller is the block producer, which can call any RPC.
+	BPCaller
+	// MinerCaller is a miner of the target database.
+	MinerCaller
+	// ClientCaller is a client of the target database.
+	ClientCaller
+	// ObserverCaller is an authorized observer of the target database.
+	ObserverCaller
+)
+
+// acl defines the caller roles permitted to call each RPC func, the MinerCaller, ClientCaller and
+// ObserverCaller roles only make sense in the per database checks by IsPermittedOnDatabase.
+var acl = map[RemoteFunc][]CallerRole{
+	DHTPing:             {AnonymousCaller, NodeCaller},
+	DHTFindNeighbor:     {NodeCaller},
+	DHTFindNode:         {NodeCaller},
+	MetricUploadMetrics: {NodeCaller},
+	KayakCall:           {BPCaller},
+	// the query users are checked against the database users on main chain by miners
+	DBSQuery:       {NodeCaller},
+	DBSAck:         {NodeCaller},
+	DBSDeploy:      {BPCaller},
+	DBSFetch:       {NodeCaller},
+	DBSCloseCursor: {NodeCaller},
+	DBSBackup:      {NodeCaller},
+	DBCCall:        {MinerCaller},
+	DBCFetch:       {MinerCaller},
+	// the database owners are checked by block producer
+	BPDBCreateDatabase:   {NodeCaller},
+	BPDBDropDatabase:     {NodeCaller},
+	BPDBGetDatabase:      {NodeCaller},
+	BPDBGetNodeDatabases: {NodeCaller},
+	// sqlchain peers and observers
+	SQLCAdviseNewBlock:        {MinerCaller},
+	SQLCAdviseBinLog:          {MinerCaller},
+	SQLCAdviseAckedQuery:      {MinerCaller},
+	SQLCFetchBlock:            {MinerCaller, ObserverCaller},
+	SQLCSignBilling:           {MinerCaller},
+	SQLCLaunchBilling:         {BPCaller},
+	SQLCSubscribeTransactions: {MinerCaller, ObserverCaller},
+	SQLCCancelSubscription:    {MinerCaller, ObserverCaller},
+	SQLCStorageChallenge:      {MinerCaller},
+	OBSAdviseNewBlock:         {MinerCaller},
+	// main chain
+	MCCAdviseNewBlock:              {BPCaller},
+	MCCProposeBlock:                {BPCaller},
+	MCCPrecommitBlock:              {BPCaller},
+	MCCAdviseTxBilling:             {BPCaller},
+	MCCAdviseBillingRequest:        {NodeCaller},
+	MCCFetchBlock:                  {NodeCaller},
+	MCCFetchBlockByCount:           {NodeCaller},
+	MCCFetchTxBilling:              {NodeCaller},
+	MCCNextAccountNonce:            {NodeCaller},
+	MCCAddTx:                       {NodeCaller},
+	MCCQueryAccountStableBalance:   {NodeCaller},
+	MCCQueryAccountCovenantBalance: {NodeCaller},
+	MCCQuerySQLChainProfile:        {NodeCaller},
+}
+
+// DatabaseRoles defines the roles of the nodes in a database.
+type DatabaseRoles interface {
+	// GetNodeRoles returns the roles of the node in the database, the peers of database are
+	// Leader/Follower/Miner, and the database users are Client/Observer.
+	GetNodeRoles(nodeID proto.NodeID) proto.ServerRoles
+}
+
 // IsPermitted returns if the node is permitted to call the RPC func
 func IsPermitted(callerEnvelope *proto.Envelope, funcName RemoteFunc) (ok bool) {
+	return IsPermittedOnDatabase(callerEnvelope, nil, funcName)
+}
+
+// IsPermittedOnDatabase returns if the node is permitted to call the RPC func of the database
+// with roles provided by db.
+func IsPermittedOnDatabase(callerEnvelope *proto.Envelope, db DatabaseRoles, funcName RemoteFunc) (ok bool) {
 	callerETLSNodeID := callerEnvelope.GetNodeID()
 	// strict anonymous ETLS only used for Ping
 	// the envelope node id is set at NodeAwareServerCodec and CryptoListener.CHandler
 	// if callerETLSNodeID == nil here indicates that ETLS is not used, just ignore it
 	if callerETLSNodeID != nil {
 		if callerETLSNodeID.IsEqual(&kms.AnonymousRawNodeID.Hash) {
-			if funcName != DHTPing {
+			if !hasCallerRole(acl[funcName], AnonymousCaller) {
 				log.WithField("field", funcName).Warning("anonymous ETLS connection can not used")
 				return false
 			}
+			return true
 		}
 	}
 
-	if !IsBPNodeID(callerETLSNodeID) {
-		// non BP
-		switch funcName {
-		// DHT related
-		case DHTPing, DHTFindNode, DHTFindNeighbor, MetricUploadMetrics:
-			return true
-			// Kayak related
-		case KayakCall:
-			return false
-			// DBSDeploy
-		case DBSDeploy:
-			return false
-		default:
-			// calling Unspecified RPC is forbidden
-			return false
+	if IsBPNodeID(callerETLSNodeID) {
+		// BP can call any RPC
+		return true
+	}
+
+	permitted := acl[funcName]
+	if hasCallerRole(permitted, NodeCaller) {
+		return true
+	}
+	if db == nil || callerETLSNodeID == nil {
+		// calling Unspecified RPC is forbidden
+		return false
+	}
+
+	for _, r := range db.GetNodeRoles(callerETLSNodeID.ToNodeID()) {
+		switch r {
+		case proto.Leader, proto.Follower, proto.Miner:
+			ok = hasCallerRole(permitted, MinerCaller)
+		case proto.Client:
+			ok = hasCallerRole(permitted, ClientCaller)
+		case proto.Observer:
+			ok = hasCallerRole(permitted, ObserverCaller)
+		}
+		if ok {
+			return
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"field":  funcName,
+		"caller": callerETLSNodeID.String(),
+	}).Debug("caller has no permitted role in database")
+	return false
+}
+
+// GetPeersRoles returns the roles of the node in peers.
+func GetPeersRoles(peers *proto.Peers, nodeID proto.NodeID) (roles proto.ServerRoles) {
+	if peers == nil {
+		return
+	}
+	if peers.Leader == nodeID {
+		roles = append(roles, proto.Leader)
+	}
+	for _, s := range peers.Servers {
+		if s == nodeID {
+			if peers.Leader != nodeID {
+				roles = append(roles, proto.Follower)
+			}
+			roles = append(roles, proto.Miner)
+			break
 		}
 	}
+	return
+}
 
-	// BP can call any RPC
-	return true
+func hasCallerRole(roles []CallerRole, role CallerRole) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
 }
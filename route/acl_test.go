@@ -33,6 +33,12 @@ import (
 
 const PubKeyStorePath = "./acl.keystore"
 
+type testDatabaseRoles map[proto.NodeID]proto.ServerRoles
+
+func (r testDatabaseRoles) GetNodeRoles(nodeID proto.NodeID) proto.ServerRoles {
+	return r[nodeID]
+}
+
 func TestIsPermitted(t *testing.T) {
 	log.SetLevel(log.DebugLevel)
 	os.Remove(PubKeyStorePath)
@@ -56,6 +62,59 @@ func TestIsPermitted(t *testing.T) {
 		So(IsPermitted(testEnv, DHTFindNode), ShouldBeTrue)
 		So(IsPermitted(testEnv, RemoteFunc(9999)), ShouldBeFalse)
 		So(IsPermitted(testAnonymous, DHTFindNode), ShouldBeFalse)
+		So(IsPermitted(testAnonymous, DHTPing), ShouldBeTrue)
+		So(IsPermitted(testEnv, SQLCFetchBlock), ShouldBeFalse)
+		So(IsPermitted(testEnv, MCCAdviseNewBlock), ShouldBeFalse)
+		So(IsPermitted(testEnv, MCCProposeBlock), ShouldBeFalse)
+		So(IsPermitted(testEnv, MCCPrecommitBlock), ShouldBeFalse)
+		So(IsPermitted(&proto.Envelope{NodeID: &conf.GConf.BP.RawNodeID}, MCCProposeBlock), ShouldBeTrue)
+	})
+
+	Convey("test IsPermittedOnDatabase", t, func() {
+		var (
+			miner    = proto.NodeID("0000000000000000000000000000000000000000000000000000000000000001")
+			observer = proto.NodeID("0000000000000000000000000000000000000000000000000000000000000002")
+			client   = proto.NodeID("0000000000000000000000000000000000000000000000000000000000000003")
+			other    = proto.NodeID("0000000000000000000000000000000000000000000000000000000000000004")
+			db       = testDatabaseRoles{
+				miner:    proto.ServerRoles{proto.Follower, proto.Miner},
+				observer: proto.ServerRoles{proto.Observer},
+				client:   proto.ServerRoles{proto.Client},
+			}
+			env = func(id proto.NodeID) *proto.Envelope {
+				return &proto.Envelope{NodeID: id.ToRawNodeID()}
+			}
+		)
+		So(IsPermittedOnDatabase(env(miner), db, SQLCFetchBlock), ShouldBeTrue)
+		So(IsPermittedOnDatabase(env(miner), db, SQLCAdviseNewBlock), ShouldBeTrue)
+		So(IsPermittedOnDatabase(env(observer), db, SQLCFetchBlock), ShouldBeTrue)
+		So(IsPermittedOnDatabase(env(observer), db, SQLCSubscribeTransactions), ShouldBeTrue)
+		So(IsPermittedOnDatabase(env(observer), db, SQLCAdviseNewBlock), ShouldBeFalse)
+		So(IsPermittedOnDatabase(env(client), db, SQLCSubscribeTransactions), ShouldBeFalse)
+		So(IsPermittedOnDatabase(env(other), db, SQLCFetchBlock), ShouldBeFalse)
+		So(IsPermittedOnDatabase(env(miner), db, DBCFetch), ShouldBeTrue)
+		So(IsPermittedOnDatabase(env(observer), db, DBCFetch), ShouldBeFalse)
+		So(IsPermittedOnDatabase(env(other), db, DBCFetch), ShouldBeFalse)
+		So(IsPermittedOnDatabase(env(miner), db, DBCCall), ShouldBeTrue)
+		So(IsPermittedOnDatabase(env(client), db, DBCCall), ShouldBeFalse)
+		So(IsPermittedOnDatabase(env(other), db, DBCCall), ShouldBeFalse)
+		So(IsPermittedOnDatabase(env(miner), db, OBSAdviseNewBlock), ShouldBeTrue)
+		So(IsPermittedOnDatabase(env(observer), db, OBSAdviseNewBlock), ShouldBeFalse)
+		So(IsPermittedOnDatabase(env(other), db, OBSAdviseNewBlock), ShouldBeFalse)
+		So(IsPermittedOnDatabase(env(other), db, DHTFindNode), ShouldBeTrue)
+		So(IsPermittedOnDatabase(env(miner), db, SQLCLaunchBilling), ShouldBeFalse)
+		So(IsPermittedOnDatabase(&proto.Envelope{NodeID: &conf.GConf.BP.RawNodeID}, db, SQLCLaunchBilling), ShouldBeTrue)
+	})
+
+	Convey("test peers roles", t, func() {
+		peers := &proto.Peers{PeersHeader: proto.PeersHeader{
+			Leader:  proto.NodeID("0001"),
+			Servers: []proto.NodeID{"0001", "0002"},
+		}}
+		So(GetPeersRoles(peers, "0001"), ShouldResemble, proto.ServerRoles{proto.Leader, proto.Miner})
+		So(GetPeersRoles(peers, "0002"), ShouldResemble, proto.ServerRoles{proto.Follower, proto.Miner})
+		So(GetPeersRoles(peers, "0003"), ShouldBeEmpty)
+		So(GetPeersRoles(nil, "0001"), ShouldBeEmpty)
 	})
 
 	Convey("string RemoteFunc", t, func() {
@@ -18,15 +18,20 @@
 package rpc
 
 import (
+	"io"
 	"net"
 	"net/rpc"
+	"sync"
+	"time"
 
+	"github.com/CovenantSQL/CovenantSQL/conf"
 	"github.com/CovenantSQL/CovenantSQL/crypto/etls"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/pow/cpuminer"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/utils"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
 	mux "github.com/xtaci/smux"
 )
 
@@ -42,6 +47,12 @@ var (
 	YamuxConfig *mux.Config
 	// DefaultDialer holds the default dialer of SessionPool
 	DefaultDialer func(nodeID proto.NodeID) (conn net.Conn, err error)
+	// LegacyPeerTTL defines how long a remote address is remembered as a legacy CFB cipher peer
+	// before negotiating AEAD cipher again.
+	LegacyPeerTTL = 10 * time.Minute
+
+	legacyPeers sync.Map // map[string]time.Time
+	aeadPeers   sync.Map // map[proto.NodeID]bool
 )
 
 func init() {
@@ -49,14 +60,86 @@ func init() {
 	DefaultDialer = dialToNode
 }
 
-// dial connects to a address with a Cipher
+// dial connects to a address with the symmetric key, the AEAD cipher mode is negotiated first,
+// and the legacy CFB mode is used if the remote node does not support it, unless the AEAD mode
+// is required by config or the remote node is known to support it.
 // address should be in the form of host:port
-func dial(network, address string, remoteNodeID *proto.RawNodeID, cipher *etls.Cipher, isAnonymous bool) (c *etls.CryptoConn, err error) {
+func dial(network, address string, remoteNodeID *proto.RawNodeID, symmetricKey []byte, isAnonymous bool) (c *etls.CryptoConn, err error) {
+	if requireAEAD() || !isLegacyPeer(address) {
+		if c, err = dialEx(network, address, remoteNodeID, symmetricKey, isAnonymous, true); err == nil {
+			setAEADPeer(remoteNodeID)
+			return
+		}
+		if errors.Cause(err) != etls.ErrHandshakeFailed {
+			return
+		}
+		if requireAEAD() || isAEADPeer(remoteNodeID) {
+			// never downgrade if it's required or the remote node is known to support AEAD mode
+			log.WithField("addr", address).WithError(err).Error("negotiate AEAD cipher failed")
+			return
+		}
+		log.WithField("addr", address).WithError(err).Warning(
+			"negotiate AEAD cipher failed, fallback to legacy cipher")
+		legacyPeers.Store(address, time.Now().Add(LegacyPeerTTL))
+	}
+	return dialEx(network, address, remoteNodeID, symmetricKey, isAnonymous, false)
+}
+
+func requireAEAD() bool {
+	return conf.GConf != nil && conf.GConf.RequireAEAD
+}
+
+func isLegacyPeer(address string) bool {
+	if expire, ok := legacyPeers.Load(address); ok {
+		if time.Now().Before(expire.(time.Time)) {
+			return true
+		}
+		legacyPeers.Delete(address)
+	}
+	return false
+}
+
+// isAEADPeer returns whether the remote node is known to support the AEAD cipher mode, the
+// AEAD capable nodes are persisted in the public keystore to survive restart.
+func isAEADPeer(nodeID *proto.RawNodeID) bool {
+	if nodeID == nil {
+		return false
+	}
+	id := proto.NodeID(nodeID.String())
+	if _, ok := aeadPeers.Load(id); ok {
+		return true
+	}
+	if kms.IsAEADNode(id) {
+		aeadPeers.Store(id, true)
+		return true
+	}
+	return false
+}
+
+func setAEADPeer(nodeID *proto.RawNodeID) {
+	if nodeID == nil {
+		return
+	}
+	id := proto.NodeID(nodeID.String())
+	if _, loaded := aeadPeers.LoadOrStore(id, true); loaded {
+		return
+	}
+	if err := kms.SetAEADNode(id); err != nil {
+		log.WithField("node", id).WithError(err).Warning("persist AEAD cipher peer failed")
+	}
+}
+
+func dialEx(network, address string, remoteNodeID *proto.RawNodeID, symmetricKey []byte, isAnonymous bool, aead bool) (c *etls.CryptoConn, err error) {
 	conn, err := net.Dial(network, address)
 	if err != nil {
 		log.WithField("addr", address).WithError(err).Error("connect to node failed")
 		return
 	}
+	defer func() {
+		if err != nil {
+			conn.Close()
+		}
+	}()
 	var writeBuf []byte
 	if isAnonymous {
 		writeBuf = append(kms.AnonymousRawNodeID.CloneBytes(), (&cpuminer.Uint256{}).Bytes()...)
@@ -79,10 +162,16 @@ func dial(network, address string, remoteNodeID *proto.RawNodeID, cipher *etls.C
 	wrote, err := conn.Write(writeBuf)
 	if err != nil || wrote != len(writeBuf) {
 		log.WithError(err).Error("write node id and nonce failed")
+		if err == nil {
+			err = io.ErrShortWrite
+		}
 		return
 	}
 
-	c = etls.NewConn(conn, cipher, remoteNodeID)
+	if aead {
+		return etls.ClientHandshake(conn, symmetricKey, remoteNodeID)
+	}
+	c = etls.NewConn(conn, etls.NewCipher(symmetricKey), remoteNodeID)
 	return
 }
 
@@ -147,8 +236,7 @@ func dialToNodeEx(nodeID proto.NodeID, isAnonymous bool) (conn net.Conn, err err
 		return
 	}
 
-	cipher := etls.NewCipher(symmetricKey)
-	conn, err = dial("tcp", nodeAddr, rawNodeID, cipher, isAnonymous)
+	conn, err = dial("tcp", nodeAddr, rawNodeID, symmetricKey, isAnonymous)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"target": rawNodeID.String(),
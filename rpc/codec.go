@@ -19,6 +19,7 @@ package rpc
 import (
 	"context"
 	"net/rpc"
+	"sync"
 
 	"github.com/CovenantSQL/CovenantSQL/proto"
 )
@@ -28,6 +29,9 @@ type NodeAwareServerCodec struct {
 	rpc.ServerCodec
 	NodeID *proto.RawNodeID
 	Ctx    context.Context
+
+	seq     uint64   // seq of the request being read
+	cancels sync.Map // map[uint64]context.CancelFunc
 }
 
 // NewNodeAwareServerCodec returns new NodeAwareServerCodec with normal rpc.ServerCode and proto.RawNodeID
@@ -39,6 +43,15 @@ func NewNodeAwareServerCodec(ctx context.Context, codec rpc.ServerCodec, nodeID
 	}
 }
 
+// ReadRequestHeader override default rpc.ServerCodec behaviour and record the request sequence.
+func (nc *NodeAwareServerCodec) ReadRequestHeader(r *rpc.Request) (err error) {
+	if err = nc.ServerCodec.ReadRequestHeader(r); err != nil {
+		return
+	}
+	nc.seq = r.Seq
+	return
+}
+
 // ReadRequestBody override default rpc.ServerCodec behaviour and inject remote node id into request
 func (nc *NodeAwareServerCodec) ReadRequestBody(body interface{}) (err error) {
 	err = nc.ServerCodec.ReadRequestBody(body)
@@ -54,9 +67,34 @@ func (nc *NodeAwareServerCodec) ReadRequestBody(body interface{}) (err error) {
 	if r, ok := body.(proto.EnvelopeAPI); ok {
 		// inject node id to rpc envelope
 		r.SetNodeID(nc.NodeID)
-		// inject context
-		r.SetContext(nc.Ctx)
+		// inject context, bounded by the deadline of caller if any
+		if ttl := r.GetTTL(); ttl > 0 {
+			ctx, cancel := context.WithTimeout(nc.Ctx, ttl)
+			nc.cancels.Store(nc.seq, cancel)
+			r.SetContext(ctx)
+		} else {
+			r.SetContext(nc.Ctx)
+		}
 	}
 
 	return
 }
+
+// WriteResponse override default rpc.ServerCodec behaviour and release the request context.
+func (nc *NodeAwareServerCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	if cancel, ok := nc.cancels.Load(r.Seq); ok {
+		nc.cancels.Delete(r.Seq)
+		cancel.(context.CancelFunc)()
+	}
+	return nc.ServerCodec.WriteResponse(r, body)
+}
+
+// Close override default rpc.ServerCodec behaviour and release all the pending contexts.
+func (nc *NodeAwareServerCodec) Close() error {
+	nc.cancels.Range(func(seq, cancel interface{}) bool {
+		nc.cancels.Delete(seq)
+		cancel.(context.CancelFunc)()
+		return true
+	})
+	return nc.ServerCodec.Close()
+}
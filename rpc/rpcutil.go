@@ -85,12 +85,34 @@ func (c *PersistentCaller) initClient(isAnonymous bool) (err error) {
 
 // Call invokes the named function, waits for it to complete, and returns its error status.
 func (c *PersistentCaller) Call(method string, args interface{}, reply interface{}) (err error) {
+	return c.CallWithContext(context.Background(), method, args, reply)
+}
+
+// CallWithContext invokes the named function, waits for it to complete or context timeout, and
+// returns its error status. The deadline of ctx is propagated to the remote node through the
+// rpc envelope of args if any.
+//
+// Note that the in progress call is not canceled on timeout, the reply object should not be
+// reused after a timeout error.
+func (c *PersistentCaller) CallWithContext(
+	ctx context.Context, method string, args interface{}, reply interface{}) (err error) {
 	err = c.initClient(method == route.DHTPing.String())
 	if err != nil {
 		log.WithError(err).Error("init PersistentCaller client failed")
 		return
 	}
-	err = c.client.Call(method, args, reply)
+	if env, ok := args.(proto.EnvelopeAPI); ok {
+		proto.SetDeadline(ctx, env)
+	}
+	ch := c.client.Go(method, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+		log.WithField("rpc", method).WithError(err).Warning("call RPC canceled")
+		return
+	case call := <-ch.Done:
+		err = call.Error
+	}
 	if err != nil {
 		if err == io.EOF ||
 			err == io.ErrUnexpectedEOF ||
@@ -181,6 +203,10 @@ func (c *Caller) CallNodeWithContext(
 
 	defer client.Close()
 
+	if env, ok := args.(proto.EnvelopeAPI); ok {
+		proto.SetDeadline(ctx, env)
+	}
+
 	// TODO(xq262144): golang net/rpc does not support cancel in progress calls
 	ch := client.Go(method, args, reply, make(chan *rpc.Call, 1))
 
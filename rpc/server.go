@@ -21,6 +21,7 @@ import (
 	"io"
 	"net"
 	"net/rpc"
+	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/etls"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
@@ -123,6 +124,9 @@ func (s *Server) handleConn(conn net.Conn) {
 	var remoteNodeID *proto.RawNodeID
 
 	if c, ok := conn.(*etls.CryptoConn); ok {
+		if err := c.Handshake(); err != nil {
+			return
+		}
 		// set node id
 		remoteNodeID = c.NodeID
 	}
@@ -175,17 +179,27 @@ func (s *Server) Stop() {
 }
 
 func handleCipher(conn net.Conn) (cryptoConn *etls.CryptoConn, err error) {
+	// the handshake is deferred to the connection goroutine, don't let a slow client block the
+	// listener
+	cryptoConn = etls.NewServerConn(conn, serverHandshake)
+	return
+}
+
+func serverHandshake(conn net.Conn) (cipher *etls.Cipher, rawNodeID *proto.RawNodeID, err error) {
+	if err = conn.SetDeadline(time.Now().Add(etls.HandshakeTimeout)); err != nil {
+		return
+	}
+
 	// NodeID + Uint256 Nonce
 	headerBuf := make([]byte, hash.HashBSize+32)
-	rCount, err := conn.Read(headerBuf)
-	if err != nil || rCount != hash.HashBSize+32 {
+	if _, err = io.ReadFull(conn, headerBuf); err != nil {
 		log.WithError(err).Error("read node header error")
 		return
 	}
 
 	// headerBuf len is hash.HashBSize, so there won't be any error
 	idHash, _ := hash.NewHash(headerBuf[:hash.HashBSize])
-	rawNodeID := &proto.RawNodeID{Hash: *idHash}
+	rawNodeID = &proto.RawNodeID{Hash: *idHash}
 	// TODO(auxten): compute the nonce and check difficulty
 	cpuminer.Uint256FromBytes(headerBuf[hash.HashBSize:])
 
@@ -197,8 +211,11 @@ func handleCipher(conn net.Conn) (cryptoConn *etls.CryptoConn, err error) {
 		log.WithField("target", rawNodeID.String()).WithError(err).Error("get shared secret")
 		return
 	}
-	cipher := etls.NewCipher(symmetricKey)
-	cryptoConn = etls.NewConn(conn, cipher, rawNodeID)
+	if cipher, err = etls.ServerHandshake(conn, symmetricKey, requireAEAD()); err != nil {
+		log.WithField("target", rawNodeID.String()).WithError(err).Error("cipher handshake failed")
+		return
+	}
 
+	err = conn.SetDeadline(time.Time{})
 	return
 }
@@ -0,0 +1,173 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"os"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/storage"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const (
+	// backupMaxRetries defines the max attempts to take a consistent backup.
+	backupMaxRetries = 10
+	// backupRetryInterval defines the wait interval between backup attempts.
+	backupRetryInterval = 100 * time.Millisecond
+	// backupBatchSize defines the max bytes of a single write batch of the block database backup.
+	backupBatchSize = 4 * 1024 * 1024
+)
+
+// Backup takes an online backup of the chain: the committed storage data is copied to dataFile
+// (a storage DSN), and the chain databases are copied to the files prefixed by chainFilePrefix.
+// Blocks which are not yet committed to the storage are excluded from the backup, so the backup
+// can be loaded as an existing chain and then synchronize the missing blocks from peers.
+//
+// It returns the head block hash and height of the backup chain.
+func (c *Chain) Backup(dataFile, chainFilePrefix string) (head hash.Hash, height int32, err error) {
+	var (
+		bdbFile = chainFilePrefix + "-block-state.ldb"
+		tdbFile = chainFilePrefix + "-ack-req-resp.ldb"
+		id      uint64
+	)
+	for i := 0; i < backupMaxRetries; i++ {
+		if i > 0 {
+			time.Sleep(backupRetryInterval)
+		}
+		if err = removeBackupFiles(dataFile, bdbFile, tdbFile); err != nil {
+			return
+		}
+		if id, err = c.st.Backup(dataFile); err != nil {
+			return
+		}
+		// The leader commits the storage before the new block is pushed, retry if the storage
+		// contains queries which are not in the block database yet
+		if head, height, err = c.backupBlocks(id, bdbFile); err == ErrBackupInconsistent {
+			continue
+		} else if err != nil {
+			return
+		}
+		if err = utils.CopyLevelDB(c.tdb, tdbFile); err != nil {
+			err = errors.Wrap(err, "backup ack/request/response database failed")
+		}
+		return
+	}
+	return
+}
+
+// backupBlocks copies a snapshot of the block database to filename, excluding the blocks with
+// queries beyond the storage id. It returns ErrBackupInconsistent if the retained blocks don't
+// cover all the queries before id.
+func (c *Chain) backupBlocks(id uint64, filename string) (head hash.Hash, height int32, err error) {
+	var (
+		snap   *leveldb.Snapshot
+		db     *leveldb.DB
+		batch  = new(leveldb.Batch)
+		kept   = make(map[hash.Hash]bool)
+		nextID uint64
+		last   *types.Block
+	)
+	if snap, err = c.bdb.GetSnapshot(); err != nil {
+		err = errors.Wrap(err, "get block database snapshot failed")
+		return
+	}
+	defer snap.Release()
+	if db, err = leveldb.OpenFile(filename, &leveldbConf); err != nil {
+		err = errors.Wrapf(err, "open leveldb %s", filename)
+		return
+	}
+	defer db.Close()
+
+	iter := snap.NewIterator(util.BytesPrefix(metaBlockIndex[:]), nil)
+	defer iter.Release()
+	for iter.Next() {
+		var block = &types.Block{}
+		if err = utils.DecodeMsgPack(iter.Value(), block); err != nil {
+			err = errors.Wrapf(err, "decoding failed with key %s", string(iter.Key()))
+			return
+		}
+		if last != nil && !kept[*block.ParentHash()] {
+			continue
+		}
+		if nid, ok := block.CalcNextID(); ok {
+			if nid > id {
+				continue
+			}
+			if nid > nextID {
+				nextID = nid
+			}
+		}
+		kept[*block.BlockHash()] = true
+		batch.Put(iter.Key(), iter.Value())
+		if len(batch.Dump()) >= backupBatchSize {
+			if err = db.Write(batch, nil); err != nil {
+				err = errors.Wrap(err, "write block database backup failed")
+				return
+			}
+			batch.Reset()
+		}
+		last = block
+		head = *block.BlockHash()
+		height = keyWithSymbolToHeight(iter.Key())
+	}
+	if err = iter.Error(); err != nil {
+		err = errors.Wrap(err, "iterate block database snapshot failed")
+		return
+	}
+	if last == nil {
+		err = errors.Wrap(ErrMetaStateNotFound, "no block to backup")
+		return
+	}
+	if nextID != id {
+		err = ErrBackupInconsistent
+		return
+	}
+
+	// Write the head state of the retained blocks
+	var st = &state{Head: head, Height: height}
+	enc, err := utils.EncodeMsgPack(st)
+	if err != nil {
+		return
+	}
+	batch.Put(metaState[:], enc.Bytes())
+	if err = db.Write(batch, nil); err != nil {
+		err = errors.Wrap(err, "write block database backup failed")
+	}
+	return
+}
+
+func removeBackupFiles(dataFile string, dirs ...string) (err error) {
+	var dsn *storage.DSN
+	if dsn, err = storage.NewDSN(dataFile); err != nil {
+		return
+	}
+	if err = os.Remove(dsn.GetFileName()); err != nil && !os.IsNotExist(err) {
+		return
+	}
+	for _, v := range dirs {
+		if err = os.RemoveAll(v); err != nil {
+			return
+		}
+	}
+	return nil
+}
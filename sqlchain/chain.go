@@ -21,6 +21,7 @@ import (
 	"context"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"os"
 	rt "runtime"
 	"sync"
@@ -134,6 +135,9 @@ type Chain struct {
 	// replCh defines the replication trigger channel for replication check.
 	replCh chan struct{}
 
+	// sp defines the storage proof state of current chain.
+	sp *storageProofs
+
 	// Cached fileds, may need to renew some of this fields later.
 	//
 	// pk is the private key of the local miner.
@@ -184,7 +188,7 @@ func NewChainWithContext(ctx context.Context, c *Config) (chain *Chain, err erro
 		strg  xi.Storage
 		state *x.State
 	)
-	if strg, err = xs.NewSqlite(c.DataFile); err != nil {
+	if strg, err = xs.NewStorage(c.StorageEngine, c.DataFile); err != nil {
 		return
 	}
 	if state, err = x.NewState(c.Server, strg); err != nil {
@@ -221,6 +225,8 @@ func NewChainWithContext(ctx context.Context, c *Config) (chain *Chain, err erro
 		observerReplicators: make(map[proto.NodeID]*observerReplicator),
 		replCh:              make(chan struct{}),
 
+		sp: newStorageProofs(c),
+
 		pk: pk,
 	}
 
@@ -260,7 +266,7 @@ func LoadChainWithContext(ctx context.Context, c *Config) (chain *Chain, err err
 		strg   xi.Storage
 		xstate *x.State
 	)
-	if strg, err = xs.NewSqlite(c.DataFile); err != nil {
+	if strg, err = xs.NewStorage(c.StorageEngine, c.DataFile); err != nil {
 		return
 	}
 	if xstate, err = x.NewState(c.Server, strg); err != nil {
@@ -297,6 +303,8 @@ func LoadChainWithContext(ctx context.Context, c *Config) (chain *Chain, err err
 		observerReplicators: make(map[proto.NodeID]*observerReplicator),
 		replCh:              make(chan struct{}),
 
+		sp: newStorageProofs(c),
+
 		pk: pk,
 	}
 
@@ -564,6 +572,8 @@ func (c *Chain) produceBlockV2(now time.Time) (err error) {
 		FailedReqs: frs,
 		QueryTxs:   make([]*types.QueryAsTx, len(qts)),
 		Acks:       c.ai.acks(c.rt.getHeightFromTime(now)),
+
+		StorageProofs: c.sp.drain(),
 	}
 	statBlock(block)
 	for i, v := range qts {
@@ -780,6 +790,7 @@ func (c *Chain) mainCycle(ctx context.Context) {
 				time.Sleep(d)
 			} else {
 				c.runCurrentTurn(t)
+				c.rt.goFunc(c.challengeStorage)
 			}
 		}
 	}
@@ -1021,6 +1032,10 @@ func (c *Chain) CheckAndPushNewBlock(block *types.Block) (err error) {
 		return ErrInvalidProducer
 	}
 
+	if err = c.verifyStorageProofs(block, peers); err != nil {
+		return
+	}
+
 	// TODO(leventeliu): check if too many periods are skipped or store block for future use.
 	// if height-c.rt.getHead().Height > X {
 	// 	...
@@ -1054,6 +1069,11 @@ func (c *Chain) UpdatePeers(peers *proto.Peers) error {
 	return c.rt.updatePeers(peers)
 }
 
+// GetNodeRoles implements route.DatabaseRoles.GetNodeRoles.
+func (c *Chain) GetNodeRoles(nodeID proto.NodeID) proto.ServerRoles {
+	return c.rt.getNodeRoles(nodeID)
+}
+
 // getBilling returns a billing request from the blocks within height range [low, high].
 func (c *Chain) getBilling(low, high int32) (req *pt.BillingRequest, err error) {
 	// Height `n` is ensured (or skipped) if `Next Turn` > `n` + 1
@@ -1363,6 +1383,24 @@ func (c *Chain) replicationCycle(ctx context.Context) {
 	}
 }
 
+// Storage returns the underlying storage of the local chain state.
+func (c *Chain) Storage() xi.Storage {
+	return c.st.Storage()
+}
+
+// Snapshot copies the committed storage image of the local chain state to the storage file
+// described by dsn, pinned is called with the next query id of the image and the uncommitted
+// writes once the image is fixed, see xenomint.State.Snapshot.
+func (c *Chain) Snapshot(dsn string, pinned func(id uint64, queries []*x.QueryTracker)) (err error) {
+	return c.st.Snapshot(dsn, pinned)
+}
+
+// Restore replaces the local chain state by a snapshot, see xenomint.State.Restore. The blocks
+// are not affected, the ones behind the snapshot are synchronized from peers as usual.
+func (c *Chain) Restore(r io.Reader, id uint64, queries []*x.QueryTracker) (err error) {
+	return c.st.Restore(r, id, queries)
+}
+
 // Query queries req from local chain state and returns the query results in resp.
 func (c *Chain) Query(req *types.Request) (resp *types.Response, err error) {
 	var ref *x.QueryTracker
@@ -1381,6 +1419,62 @@ func (c *Chain) Query(req *types.Request) (resp *types.Response, err error) {
 	return
 }
 
+// QueryCursor queries req from local chain state and returns the first page of at most pageSize
+// rows in resp. If the result is not complete, the open cursor is returned and cursorID is set
+// in the signed response header, see xenomint.State.QueryCursor.
+func (c *Chain) QueryCursor(
+	req *types.Request, pageSize int, cursorID uint64) (cur *x.Cursor, resp *types.Response, err error,
+) {
+	var ref *x.QueryTracker
+	if ref, cur, resp, err = c.st.QueryCursor(req.GetContext(), req, pageSize); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil && cur != nil {
+			cur.Close()
+			cur = nil
+		}
+	}()
+	if cur != nil {
+		resp.Header.CursorID = cursorID
+	}
+	if err = resp.Sign(c.pk); err != nil {
+		return
+	}
+	if err = c.addResponse(&resp.Header); err != nil {
+		return
+	}
+	ref.UpdateResp(resp)
+	return
+}
+
+// SignPage signs the cursor page with the chain key.
+func (c *Chain) SignPage(page *types.Page) (err error) {
+	return page.Sign(c.pk)
+}
+
+// QueryInTx executes the interactive transaction operation of req in local chain state and
+// returns the query results in resp. The response is not tracked for acknowledgement since
+// the speculative results won't be packed into block.
+func (c *Chain) QueryInTx(req *types.Request) (resp *types.Response, err error) {
+	if resp, err = c.st.QueryInTx(req.GetContext(), req); err != nil {
+		return
+	}
+	err = resp.Sign(c.pk)
+	return
+}
+
+// ReleaseTx ends the interactive transaction session committed by req, see
+// xenomint.State.ReleaseTx.
+func (c *Chain) ReleaseTx(req *types.Request) (err error) {
+	return c.st.ReleaseTx(req)
+}
+
+// RollbackTx rolls back the interactive transaction session if it is still open.
+func (c *Chain) RollbackTx(nodeID proto.NodeID, txID uint64) {
+	c.st.RollbackTx(nodeID, txID)
+}
+
 // Replay replays a write log from other peer to replicate storage state.
 func (c *Chain) Replay(req *types.Request, resp *types.Response) (err error) {
 	switch req.Header.QueryType {
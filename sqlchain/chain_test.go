@@ -316,6 +316,34 @@ func TestMultiChain(t *testing.T) {
 		}(v.chain)
 	}
 
+	// Should be able to backup and load chain from the backup files
+	for _, v := range chains {
+		defer func(p *chainParams) {
+			var (
+				bkfile = p.dbfile + "-backup"
+				config = *p.config
+			)
+			head, height, err := p.chain.Backup(bkfile, bkfile)
+			if err != nil {
+				t.Errorf("Error occurred: %v", err)
+				return
+			}
+			if _, err := kms.GetPublicKey(genesis.Producer()); err != nil {
+				if err = kms.SetPublicKey(genesis.Producer(), gnonce.Nonce, genesis.Signee()); err != nil {
+					t.Errorf("Error occurred: %v", err)
+				}
+			}
+			config.ChainFilePrefix = bkfile
+			config.DataFile = bkfile
+			if chain, err := NewChain(&config); err != nil {
+				t.Errorf("Error occurred: %v", err)
+			} else if st := chain.rt.getHead(); !st.Head.IsEqual(&head) || st.Height != height {
+				t.Errorf("Unexpected backup head: %s at %d, expected %s at %d",
+					st.Head, st.Height, head, height)
+			}
+		}(v)
+	}
+
 	// Create some random clients to push new queries
 	for i, v := range chains {
 		sC := make(chan struct{})
@@ -29,6 +29,7 @@ type Config struct {
 	DatabaseID      proto.DatabaseID
 	ChainFilePrefix string
 	DataFile        string
+	StorageEngine   types.StorageEngine
 
 	Genesis *types.Block
 	Period  time.Duration
@@ -38,6 +39,9 @@ type Config struct {
 	Peers      *proto.Peers
 	Server     proto.NodeID
 
+	// NodeRoles resolves the roles of nodes other than the peers, e.g. the authorized observers.
+	NodeRoles func(nodeID proto.NodeID) proto.ServerRoles
+
 	// Price sets query price in gases.
 	Price           map[types.QueryType]uint64
 	ProducingReward uint64
@@ -71,6 +71,10 @@ var (
 	// ErrUnknownMuxRequest indicates that the multiplexing request endpoint is not found.
 	ErrUnknownMuxRequest = errors.New("unknown multiplexing request")
 
+	// ErrPermissionDenied indicates that the caller is not permitted to call the multiplexing
+	// request endpoint of the database.
+	ErrPermissionDenied = errors.New("permission denied")
+
 	// ErrUnknownProducer indicates that the block has an unknown producer.
 	ErrUnknownProducer = errors.New("unknown block producer")
 
@@ -99,4 +103,12 @@ var (
 	// ErrResponseSeqNotMatch indicates that a response sequence id doesn't match the original one
 	// in the index.
 	ErrResponseSeqNotMatch = errors.New("response sequence id doesn't match")
+
+	// ErrBackupInconsistent indicates that a consistent backup of storage and blocks can not be
+	// taken in the limited retries.
+	ErrBackupInconsistent = errors.New("storage and blocks of backup are inconsistent")
+
+	// ErrInvalidStorageProof indicates that a storage proof in block is not challenged by the
+	// block producer.
+	ErrInvalidStorageProof = errors.New("invalid storage proof")
 )
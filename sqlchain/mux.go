@@ -20,6 +20,7 @@ import (
 	"sync"
 
 	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/rpc"
 )
 
@@ -159,9 +160,26 @@ type MuxCancelSubscriptionResp struct {
 	CancelSubscriptionResp
 }
 
+// MuxStorageChallengeReq defines a request of the StorageChallenge RPC method.
+type MuxStorageChallengeReq struct {
+	proto.Envelope
+	proto.DatabaseID
+	StorageChallengeReq
+}
+
+// MuxStorageChallengeResp defines a response of the StorageChallenge RPC method.
+type MuxStorageChallengeResp struct {
+	proto.Envelope
+	proto.DatabaseID
+	StorageChallengeResp
+}
+
 // AdviseNewBlock is the RPC method to advise a new produced block to the target server.
 func (s *MuxService) AdviseNewBlock(req *MuxAdviseNewBlockReq, resp *MuxAdviseNewBlockResp) error {
 	if v, ok := s.serviceMap.Load(req.DatabaseID); ok {
+		if !route.IsPermittedOnDatabase(&req.Envelope, v.(*ChainRPCService).chain, route.SQLCAdviseNewBlock) {
+			return ErrPermissionDenied
+		}
 		resp.Envelope = req.Envelope
 		resp.DatabaseID = req.DatabaseID
 		return v.(*ChainRPCService).AdviseNewBlock(&req.AdviseNewBlockReq, &resp.AdviseNewBlockResp)
@@ -173,6 +191,9 @@ func (s *MuxService) AdviseNewBlock(req *MuxAdviseNewBlockReq, resp *MuxAdviseNe
 // AdviseBinLog is the RPC method to advise a new binary log to the target server.
 func (s *MuxService) AdviseBinLog(req *MuxAdviseBinLogReq, resp *MuxAdviseBinLogResp) error {
 	if v, ok := s.serviceMap.Load(req.DatabaseID); ok {
+		if !route.IsPermittedOnDatabase(&req.Envelope, v.(*ChainRPCService).chain, route.SQLCAdviseBinLog) {
+			return ErrPermissionDenied
+		}
 		resp.Envelope = req.Envelope
 		resp.DatabaseID = req.DatabaseID
 		return v.(*ChainRPCService).AdviseBinLog(&req.AdviseBinLogReq, &resp.AdviseBinLogResp)
@@ -185,6 +206,9 @@ func (s *MuxService) AdviseBinLog(req *MuxAdviseBinLogReq, resp *MuxAdviseBinLog
 func (s *MuxService) AdviseAckedQuery(
 	req *MuxAdviseAckedQueryReq, resp *MuxAdviseAckedQueryResp) error {
 	if v, ok := s.serviceMap.Load(req.DatabaseID); ok {
+		if !route.IsPermittedOnDatabase(&req.Envelope, v.(*ChainRPCService).chain, route.SQLCAdviseAckedQuery) {
+			return ErrPermissionDenied
+		}
 		resp.Envelope = req.Envelope
 		resp.DatabaseID = req.DatabaseID
 		return v.(*ChainRPCService).AdviseAckedQuery(
@@ -197,6 +221,9 @@ func (s *MuxService) AdviseAckedQuery(
 // FetchBlock is the RPC method to fetch a known block from the target server.
 func (s *MuxService) FetchBlock(req *MuxFetchBlockReq, resp *MuxFetchBlockResp) (err error) {
 	if v, ok := s.serviceMap.Load(req.DatabaseID); ok {
+		if !route.IsPermittedOnDatabase(&req.Envelope, v.(*ChainRPCService).chain, route.SQLCFetchBlock) {
+			return ErrPermissionDenied
+		}
 		resp.Envelope = req.Envelope
 		resp.DatabaseID = req.DatabaseID
 		return v.(*ChainRPCService).FetchBlock(&req.FetchBlockReq, &resp.FetchBlockResp)
@@ -208,6 +235,9 @@ func (s *MuxService) FetchBlock(req *MuxFetchBlockReq, resp *MuxFetchBlockResp)
 // SignBilling is the RPC method to get signature for a billing request from the target server.
 func (s *MuxService) SignBilling(req *MuxSignBillingReq, resp *MuxSignBillingResp) (err error) {
 	if v, ok := s.serviceMap.Load(req.DatabaseID); ok {
+		if !route.IsPermittedOnDatabase(&req.Envelope, v.(*ChainRPCService).chain, route.SQLCSignBilling) {
+			return ErrPermissionDenied
+		}
 		resp.Envelope = req.Envelope
 		resp.DatabaseID = req.DatabaseID
 		return v.(*ChainRPCService).SignBilling(&req.SignBillingReq, &resp.SignBillingResp)
@@ -221,6 +251,9 @@ func (s *MuxService) LaunchBilling(req *MuxLaunchBillingReq, resp *MuxLaunchBill
 	err error,
 ) {
 	if v, ok := s.serviceMap.Load(req.DatabaseID); ok {
+		if !route.IsPermittedOnDatabase(&req.Envelope, v.(*ChainRPCService).chain, route.SQLCLaunchBilling) {
+			return ErrPermissionDenied
+		}
 		resp.Envelope = req.Envelope
 		resp.DatabaseID = req.DatabaseID
 		return v.(*ChainRPCService).LaunchBilling(&req.LaunchBillingReq, &resp.LaunchBillingResp)
@@ -232,6 +265,9 @@ func (s *MuxService) LaunchBilling(req *MuxLaunchBillingReq, resp *MuxLaunchBill
 // SubscribeTransactions is the RPC method to subscribe transactions from the target server.
 func (s *MuxService) SubscribeTransactions(req *MuxSubscribeTransactionsReq, resp *MuxSubscribeTransactionsResp) (err error) {
 	if v, ok := s.serviceMap.Load(req.DatabaseID); ok {
+		if !route.IsPermittedOnDatabase(&req.Envelope, v.(*ChainRPCService).chain, route.SQLCSubscribeTransactions) {
+			return ErrPermissionDenied
+		}
 		resp.Envelope = req.Envelope
 		resp.DatabaseID = req.DatabaseID
 		req.SubscribeTransactionsReq.SubscriberID = req.GetNodeID().ToNodeID()
@@ -244,6 +280,9 @@ func (s *MuxService) SubscribeTransactions(req *MuxSubscribeTransactionsReq, res
 // CancelSubscription is the RPC method to cancel subscription from the target server.
 func (s *MuxService) CancelSubscription(req *MuxCancelSubscriptionReq, resp *MuxCancelSubscriptionResp) (err error) {
 	if v, ok := s.serviceMap.Load(req.DatabaseID); ok {
+		if !route.IsPermittedOnDatabase(&req.Envelope, v.(*ChainRPCService).chain, route.SQLCCancelSubscription) {
+			return ErrPermissionDenied
+		}
 		resp.Envelope = req.Envelope
 		resp.DatabaseID = req.DatabaseID
 		req.CancelSubscriptionReq.SubscriberID = req.GetNodeID().ToNodeID()
@@ -252,3 +291,17 @@ func (s *MuxService) CancelSubscription(req *MuxCancelSubscriptionReq, resp *Mux
 
 	return ErrUnknownMuxRequest
 }
+
+// StorageChallenge is the RPC method to answer the storage proof challenge from the target server.
+func (s *MuxService) StorageChallenge(req *MuxStorageChallengeReq, resp *MuxStorageChallengeResp) (err error) {
+	if v, ok := s.serviceMap.Load(req.DatabaseID); ok {
+		if !route.IsPermittedOnDatabase(&req.Envelope, v.(*ChainRPCService).chain, route.SQLCStorageChallenge) {
+			return ErrPermissionDenied
+		}
+		resp.Envelope = req.Envelope
+		resp.DatabaseID = req.DatabaseID
+		return v.(*ChainRPCService).StorageChallenge(&req.StorageChallengeReq, &resp.StorageChallengeResp)
+	}
+
+	return ErrUnknownMuxRequest
+}
@@ -17,6 +17,8 @@
 package sqlchain
 
 import (
+	"context"
+
 	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
@@ -106,6 +108,18 @@ type CancelSubscriptionReq struct {
 // CancelSubscriptionResp defines a response of CancelSubscription RPC method.
 type CancelSubscriptionResp struct{}
 
+// StorageChallengeReq defines a request of the StorageChallenge RPC method.
+type StorageChallengeReq struct {
+	Seed hash.Hash
+}
+
+// StorageChallengeResp defines a response of the StorageChallenge RPC method, the answer is
+// generated at the committed query id LogOffset.
+type StorageChallengeResp struct {
+	LogOffset uint64
+	Answer    hash.Hash
+}
+
 // AdviseNewBlock is the RPC method to advise a new produced block to the target server.
 func (s *ChainRPCService) AdviseNewBlock(req *AdviseNewBlockReq, resp *AdviseNewBlockResp) (
 	err error) {
@@ -153,3 +167,11 @@ func (s *ChainRPCService) SubscribeTransactions(req *SubscribeTransactionsReq, _
 func (s *ChainRPCService) CancelSubscription(req *CancelSubscriptionReq, _ *CancelSubscriptionResp) error {
 	return s.chain.cancelSubscription(req.SubscriberID)
 }
+
+// StorageChallenge is the RPC method to answer the storage proof challenge from the target server.
+func (s *ChainRPCService) StorageChallenge(req *StorageChallengeReq, resp *StorageChallengeResp) (
+	err error,
+) {
+	resp.LogOffset, resp.Answer, err = s.chain.answerStorageChallenge(context.Background(), req)
+	return
+}
@@ -24,6 +24,7 @@ import (
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/types"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 )
@@ -53,6 +54,8 @@ type runtime struct {
 	blockCacheTTL int32
 	// muxServer is the multiplexing service of sql-chain PRC.
 	muxService *MuxService
+	// nodeRoles resolves the roles of nodes other than the peers.
+	nodeRoles func(nodeID proto.NodeID) proto.ServerRoles
 	// price sets query price in gases.
 	price           map[types.QueryType]uint64
 	producingReward uint64
@@ -105,6 +108,7 @@ func newRunTime(ctx context.Context, c *Config) (r *runtime) {
 			return c.BlockCacheTTL
 		}(),
 		muxService:      c.MuxService,
+		nodeRoles:       c.NodeRoles,
 		price:           c.Price,
 		producingReward: c.ProducingReward,
 		billingPeriods:  c.BillingPeriods,
@@ -319,6 +323,16 @@ func (r *runtime) getPeers() *proto.Peers {
 	return &peers
 }
 
+func (r *runtime) getNodeRoles(nodeID proto.NodeID) (roles proto.ServerRoles) {
+	r.peersMutex.Lock()
+	roles = route.GetPeersRoles(r.peers, nodeID)
+	r.peersMutex.Unlock()
+	if r.nodeRoles != nil {
+		roles = append(roles, r.nodeRoles(nodeID)...)
+	}
+	return
+}
+
 func (r *runtime) getHead() *state {
 	r.stateMutex.Lock()
 	defer r.stateMutex.Unlock()
@@ -17,99 +17,416 @@
 package sqlchain
 
 import (
-	"errors"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
 )
 
-// Answer is responded by node to confirm other nodes that the node stores data correctly
-type Answer struct {
-	// The block id that the question belongs to
-	PreviousBlockID BlockID
-	// The node id that provides this answer
-	NodeID proto.NodeID
-	// The answer for the question
-	Answer hash.Hash
-}
-
-// NewAnswer generates an answer for storage proof
-func NewAnswer(previousBlockID BlockID, nodeID proto.NodeID, answer hash.Hash) *Answer {
-	return &Answer{
-		PreviousBlockID: previousBlockID,
-		NodeID:          nodeID,
-		Answer:          answer,
-	}
-}
-
-// getNextPuzzle generate new puzzle which ask other nodes to get a specified record in database.
-// The index of next SQL (puzzle) is determined by the previous answer and previous block hash
-func getNextPuzzle(answers []Answer, previousBlock StorageProofBlock) (int32, error) {
-	var totalRecordsInSQLChain int32 = 10
-	var sum int32
-	if !CheckValid(answers) {
-		return -1, errors.New("some nodes have not submitted its answer")
-	}
-	for _, answer := range answers {
-		// check if answer is valid
-		if len(answer.Answer) != hash.HashSize {
-			return -1, errors.New("invalid answer format")
+const (
+	// StorageProofRows defines the max row number asked by a storage proof challenge.
+	StorageProofRows = 64
+	// StorageProofTimeout defines the timeout waiting for the answer of a challenged peer.
+	StorageProofTimeout = 10 * time.Second
+)
+
+// storageProofs defines the storage proof state of the chain.
+type storageProofs struct {
+	sync.Mutex
+	// enabled indicates whether the storage proof is supported by the storage engine.
+	enabled bool
+	// seed is the block hash of the last challenge.
+	seed hash.Hash
+	// pending are the challenge results to be packed into the next produced block.
+	pending []*types.StorageProof
+}
+
+func newStorageProofs(c *Config) (sp *storageProofs) {
+	// the reader of in-memory storage is not isolated from the uncommitted writes
+	return &storageProofs{enabled: c.StorageEngine != types.StorageEngineMemory}
+}
+
+// next marks seed as challenged, it returns false if seed is already challenged.
+func (sp *storageProofs) next(seed *hash.Hash) bool {
+	sp.Lock()
+	defer sp.Unlock()
+	if sp.seed.IsEqual(seed) {
+		return false
+	}
+	sp.seed = *seed
+	return true
+}
+
+func (sp *storageProofs) add(proofs ...*types.StorageProof) {
+	sp.Lock()
+	defer sp.Unlock()
+	sp.pending = append(sp.pending, proofs...)
+}
+
+func (sp *storageProofs) drain() (proofs []*types.StorageProof) {
+	sp.Lock()
+	defer sp.Unlock()
+	proofs, sp.pending = sp.pending, nil
+	return
+}
+
+// getChallenger returns the challenger of the storage proof round derived from the block hash.
+func getChallenger(seed *hash.Hash, peers *proto.Peers) (challenger proto.NodeID, ok bool) {
+	if peers == nil || len(peers.Servers) == 0 {
+		return
+	}
+	return peers.Servers[hash.FNVHash32uint(seed[:])%uint32(len(peers.Servers))], true
+}
+
+// getChallengeTable returns the index of the randomly selected table by the block hash in n
+// tables.
+func getChallengeTable(seed *hash.Hash, n int) int {
+	return int(binary.BigEndian.Uint64(seed[:8]) % uint64(n))
+}
+
+// getChallengeRange returns the randomly selected row range by the block hash in a table with the
+// given row count.
+func getChallengeRange(seed *hash.Hash, rows uint64) (offset, count uint64) {
+	if rows == 0 {
+		return
+	}
+	offset = binary.BigEndian.Uint64(seed[hash.HashSize-8:]) % rows
+	if count = rows - offset; count > StorageProofRows {
+		count = StorageProofRows
+	}
+	return
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// ReadChallengeData reads the data asked by the storage proof challenge derived from the block
+// hash in tx. The data are the logical rows in a randomly selected range of a randomly selected
+// table, which are the same in all the replicas with the same committed queries, regardless of
+// the physical layout of the database files.
+func ReadChallengeData(ctx context.Context, tx *sql.Tx, seed *hash.Hash) (data []byte, err error) {
+	var (
+		tables []string
+		table  string
+		rows   *sql.Rows
+	)
+	if rows, err = tx.QueryContext(ctx, `SELECT "name" FROM "sqlite_master" `+
+		`WHERE "type" = 'table' AND "name" NOT LIKE 'sqlite\_%' ESCAPE '\' ORDER BY "name"`,
+	); err != nil {
+		err = errors.Wrap(err, "list tables failed")
+		return
+	}
+	for rows.Next() {
+		if err = rows.Scan(&table); err != nil {
+			rows.Close()
+			err = errors.Wrap(err, "scan table name failed")
+			return
 		}
-		sum += int32(hash.FNVHash32uint(answer.Answer[:]))
+		tables = append(tables, table)
 	}
-	// check if block is valid
-	if len(previousBlock.ID) <= 0 {
-		return -1, errors.New("invalid block format")
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		err = errors.Wrap(err, "list tables failed")
+		return
 	}
-	sum += int32(hash.FNVHash32uint([]byte(previousBlock.ID)))
 
-	nextPuzzle := sum % totalRecordsInSQLChain
-	return nextPuzzle, nil
+	var records = struct {
+		Table string
+		Rows  [][]interface{}
+	}{}
+	if len(tables) > 0 {
+		records.Table = tables[getChallengeTable(seed, len(tables))]
+		if records.Rows, err = readChallengeRows(ctx, tx, seed, records.Table); err != nil {
+			return
+		}
+	}
+	var buf *bytes.Buffer
+	if buf, err = utils.EncodeMsgPack(&records); err != nil {
+		err = errors.Wrap(err, "encode challenge data failed")
+		return
+	}
+	data = buf.Bytes()
+	return
 }
 
-// getNExtVerifier returns the id of next verifier.
-// ID is determined by the hash of previous block.
-func getNextVerifier(previousBlock, currentBlock StorageProofBlock) (int32, error) {
-	// check if block is valid
-	if len(previousBlock.ID) <= 0 {
-		return -1, errors.New("invalid previous block")
+func readChallengeRows(ctx context.Context, tx *sql.Tx, seed *hash.Hash, table string) (
+	records [][]interface{}, err error,
+) {
+	var (
+		quoted        = quoteIdentifier(table)
+		total         uint64
+		offset, count uint64
+		rows          *sql.Rows
+		columns       []string
+	)
+	if err = tx.QueryRowContext(ctx, "SELECT count(*) FROM "+quoted).Scan(&total); err != nil {
+		err = errors.Wrapf(err, "count rows of table %s failed", table)
+		return
+	}
+	if offset, count = getChallengeRange(seed, total); count == 0 {
+		return
 	}
-	if len(currentBlock.Nodes) <= 0 {
-		return -1, errors.New("invalid current block")
+	if rows, err = tx.QueryContext(ctx, "SELECT * FROM "+quoted+" LIMIT 0"); err != nil {
+		err = errors.Wrapf(err, "read columns of table %s failed", table)
+		return
+	}
+	columns, err = rows.Columns()
+	rows.Close()
+	if err != nil {
+		err = errors.Wrapf(err, "read columns of table %s failed", table)
+		return
 	}
-	verifier := int32(hash.FNVHash32uint([]byte(previousBlock.ID))) % int32(len(currentBlock.Nodes))
 
-	return verifier, nil
+	// order by all the columns, so that the order is the same in all the replicas, even for the
+	// tables without rowid
+	var order = make([]string, len(columns))
+	for i := range columns {
+		order[i] = strconv.Itoa(i + 1)
+	}
+	if rows, err = tx.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s ORDER BY %s LIMIT %d OFFSET %d",
+		quoted, strings.Join(order, ", "), count, offset),
+	); err != nil {
+		err = errors.Wrapf(err, "read rows of table %s failed", table)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			values = make([]interface{}, len(columns))
+			dest   = make([]interface{}, len(columns))
+		)
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err = rows.Scan(dest...); err != nil {
+			err = errors.Wrapf(err, "scan rows of table %s failed", table)
+			return
+		}
+		records = append(records, values)
+	}
+	if err = rows.Err(); err != nil {
+		err = errors.Wrapf(err, "read rows of table %s failed", table)
+	}
+	return
 }
 
-// selectRecord returns nth record in the table from the database
-func selectRecord(n int32) string {
-	return "hello world"
+// GenerateAnswer returns the answer of the storage proof challenge, which is the hash over the
+// challenge data and the node id of the prover, so the answer of a prover can not be copied by
+// the others.
+func GenerateAnswer(data []byte, nodeID proto.NodeID) hash.Hash {
+	return hash.THashH(append(append(make([]byte, 0, len(data)+len(nodeID)), data...), nodeID...))
 }
 
-// CheckValid returns whether answers is valid
-// Checkvalid checks answers as follows:
-// 1. len(answers) == len(nodes) - 1
-// 2. answers[i].nodeID's answer is the same as the hash of verifier
-func CheckValid(answers []Answer) bool {
-	return len(answers) > 0
+// readChallengeData reads the storage proof challenge data derived from the block hash in the
+// committed data of the local peer, and returns the next query id of the committed data.
+func (c *Chain) readChallengeData(ctx context.Context, seed *hash.Hash) (
+	id uint64, data []byte, err error,
+) {
+	err = c.st.ReadCommitted(ctx, func(committed uint64, tx *sql.Tx) (err error) {
+		id = committed
+		data, err = ReadChallengeData(ctx, tx, seed)
+		return
+	})
+	return
 }
 
-// GenerateAnswer will select specified record for proving.
-// In order to generate a unique answer which is different with other nodes' answer,
-// we hash(record + nodeID) as the answer
-func GenerateAnswer(answers []Answer, previousBlock StorageProofBlock, node proto.Node) (*Answer, error) {
-	sqlIndex, err := getNextPuzzle(answers, previousBlock)
+// challengeStorage starts a storage proof round if the local peer is the challenger derived from
+// the current head block, the challenge results are packed into the next block produced by the
+// local peer, and the failed peers are reported to block producer.
+func (c *Chain) challengeStorage(ctx context.Context) {
+	var (
+		head   = c.rt.getHead()
+		peers  = c.rt.getPeers()
+		server = c.rt.getServer()
+	)
+	if !c.sp.enabled || head == nil {
+		return
+	}
+	if challenger, ok := getChallenger(&head.Head, peers); !ok || challenger != server {
+		return
+	}
+	if !c.sp.next(&head.Head) {
+		return
+	}
+
+	id, data, err := c.readChallengeData(ctx, &head.Head)
 	if err != nil {
-		return nil, err
+		log.WithField("db", c.rt.databaseID).WithError(err).Warning("skip storage proof round")
+		return
+	}
+
+	var (
+		wg     sync.WaitGroup
+		proofs = make([]*types.StorageProof, 0, len(peers.Servers))
+		lock   sync.Mutex
+	)
+	for _, s := range peers.Servers {
+		if s == server {
+			continue
+		}
+		wg.Add(1)
+		go func(prover proto.NodeID) {
+			defer wg.Done()
+			if p := c.challengePeer(ctx, prover, &head.Head, id, data); p != nil {
+				lock.Lock()
+				proofs = append(proofs, p)
+				lock.Unlock()
+			}
+		}(s)
+	}
+	wg.Wait()
+
+	c.sp.add(proofs...)
+	for _, p := range proofs {
+		if !p.Passed {
+			if err = c.reportStorageProofFailure(p.Prover); err != nil {
+				log.WithFields(log.Fields{
+					"db":     c.rt.databaseID,
+					"prover": p.Prover,
+				}).WithError(err).Warning("report storage proof failure failed")
+			}
+		}
 	}
-	record := []byte(selectRecord(sqlIndex))
-	// check if node is valid
-	if len(node.ID) <= 0 {
-		return nil, errors.New("invalid node format")
+}
+
+// challengePeer challenges the prover with the challenge data read at the committed query id, it
+// returns nil if the prover answers at a different committed query id, which can't be verified.
+func (c *Chain) challengePeer(
+	ctx context.Context, prover proto.NodeID, seed *hash.Hash, id uint64, data []byte,
+) (p *types.StorageProof) {
+	p = &types.StorageProof{
+		Prover:    prover,
+		Seed:      *seed,
+		LogOffset: id,
 	}
-	answer := append(record, []byte(node.ID)...)
 
-	answerHash := hash.HashH(answer)
-	return NewAnswer(previousBlock.ID, node.ID, answerHash), nil
+	var (
+		cctx, cancel = context.WithTimeout(ctx, StorageProofTimeout)
+		req          = &MuxStorageChallengeReq{
+			DatabaseID:          c.rt.databaseID,
+			StorageChallengeReq: StorageChallengeReq{Seed: *seed},
+		}
+		resp     = &MuxStorageChallengeResp{}
+		expected hash.Hash
+		err      error
+	)
+	defer cancel()
+	if err = c.cl.CallNodeWithContext(
+		cctx, prover, route.SQLCStorageChallenge.String(), req, resp,
+	); err != nil {
+		log.WithFields(log.Fields{
+			"db":     c.rt.databaseID,
+			"prover": prover,
+		}).WithError(err).Warning("storage challenge failed")
+		return
+	}
+	if resp.LogOffset != id {
+		// the replicas are only comparable at the same committed queries
+		log.WithFields(log.Fields{
+			"db":       c.rt.databaseID,
+			"prover":   prover,
+			"expected": id,
+			"answered": resp.LogOffset,
+		}).Debug("storage challenge answered at different log offset")
+		return nil
+	}
+	p.Answer = resp.Answer
+	expected = GenerateAnswer(data, prover)
+	p.Passed = p.Answer.IsEqual(&expected)
+	return
+}
+
+// answerStorageChallenge answers the storage proof challenge from the other peer with the
+// committed data of the local peer.
+func (c *Chain) answerStorageChallenge(ctx context.Context, req *StorageChallengeReq) (
+	id uint64, answer hash.Hash, err error,
+) {
+	if !c.sp.enabled {
+		err = errors.Wrap(ErrInvalidRequest, "storage proof is not supported by storage engine")
+		return
+	}
+	var data []byte
+	if id, data, err = c.readChallengeData(ctx, &req.Seed); err != nil {
+		return
+	}
+	answer = GenerateAnswer(data, c.rt.getServer())
+	return
+}
+
+// verifyStorageProofs checks that the storage proofs in block are challenged by the producer.
+func (c *Chain) verifyStorageProofs(block *types.Block, peers *proto.Peers) (err error) {
+	for _, v := range block.StorageProofs {
+		if challenger, ok := getChallenger(&v.Seed, peers); !ok || challenger != block.Producer() {
+			return errors.Wrapf(ErrInvalidStorageProof, "storage proof of %s", v.Prover)
+		}
+	}
+	return
+}
+
+// reportStorageProofFailure sends the storage proof failure transaction of the peer to block
+// producer.
+func (c *Chain) reportStorageProofFailure(id proto.NodeID) (err error) {
+	var (
+		pub             = c.pk.PubKey()
+		reporter, miner proto.AccountAddress
+		bpNodeID        proto.NodeID
+	)
+	if reporter, err = crypto.PubKeyHash(pub); err != nil {
+		return
+	}
+	if pub, err = kms.GetPublicKey(id); err != nil {
+		err = errors.Wrap(err, "get public key of prover failed")
+		return
+	}
+	if miner, err = crypto.PubKeyHash(pub); err != nil {
+		return
+	}
+	if bpNodeID, err = rpc.GetCurrentBP(); err != nil {
+		return
+	}
+
+	var (
+		nonceReq  = &types.NextAccountNonceReq{Addr: reporter}
+		nonceResp = &types.NextAccountNonceResp{}
+	)
+	if err = c.cl.CallNode(
+		bpNodeID, route.MCCNextAccountNonce.String(), nonceReq, nonceResp,
+	); err != nil {
+		err = errors.Wrap(err, "get next account nonce failed")
+		return
+	}
+
+	tx := pt.NewStorageProofFailure(&pt.StorageProofFailureHeader{
+		Reporter:       reporter,
+		TargetSQLChain: c.rt.databaseID,
+		Miner:          miner,
+		Nonce:          nonceResp.Nonce,
+	})
+	if err = tx.Sign(c.pk); err != nil {
+		return
+	}
+	if err = c.cl.CallNode(
+		bpNodeID, route.MCCAddTx.String(), &types.AddTxReq{Tx: tx}, &types.AddTxResp{},
+	); err != nil {
+		err = errors.Wrap(err, "add transaction failed")
+	}
+	return
 }
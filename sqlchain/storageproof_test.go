@@ -17,175 +17,167 @@
 package sqlchain
 
 import (
-	"reflect"
-	"strings"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path"
 	"testing"
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
 )
 
-var (
-	currentNode   proto.Node
-	voidNode      proto.Node
-	answers       []Answer
-	voidAnswer    []Answer
-	previousBlock StorageProofBlock
-	currentBlock  StorageProofBlock
-	voidBlock     StorageProofBlock
-)
-
-func TestNewAnswer(t *testing.T) {
-	wantedAnswer := Answer{
-		PreviousBlockID: "aaa",
-		NodeID:          "bbb",
-		Answer:          hash.HashH([]byte{1, 2, 3, 4, 5}),
+func TestGetChallenger(t *testing.T) {
+	var (
+		seed  = hash.HashH([]byte("seed"))
+		peers = &proto.Peers{PeersHeader: proto.PeersHeader{
+			Servers: []proto.NodeID{"a", "b", "c", "d"},
+		}}
+	)
+	challenger, ok := getChallenger(&seed, peers)
+	if !ok {
+		t.Fatal("challenger should be found")
 	}
-	answer := NewAnswer("aaa", "bbb", hash.HashH([]byte{1, 2, 3, 4, 5}))
-
-	if !reflect.DeepEqual(*answer, wantedAnswer) {
-		t.Errorf("The answer is %+v, should be %+v", answer, wantedAnswer)
+	if _, found := peers.Find(challenger); !found {
+		t.Errorf("challenger %s should be one of the peers", challenger)
 	}
-}
-
-func TestGetNextPuzzle(t *testing.T) {
-	var totalRecordsInSQLChain int32 = 10
-	index, err := getNextPuzzle(answers, previousBlock)
-	if err != nil {
-		t.Error(err)
+	if again, _ := getChallenger(&seed, peers); again != challenger {
+		t.Errorf("challenger should be deterministic, got %s and %s", challenger, again)
 	}
-	var wantedIndex int32
-	for _, answer := range answers {
-		wantedIndex += int32(hash.FNVHash32uint(answer.Answer[:]))
+	if _, ok = getChallenger(&seed, &proto.Peers{}); ok {
+		t.Error("challenger should not be found in empty peers")
 	}
-	wantedIndex += int32(hash.FNVHash32uint([]byte(previousBlock.ID)))
-	wantedIndex %= totalRecordsInSQLChain
-	if index != wantedIndex {
-		t.Errorf("The next sql index is %+v, should be %+v. "+
-			"Answers are %+v, and the previous block is %+v",
-			index, wantedIndex, answers, previousBlock)
+	if _, ok = getChallenger(&seed, nil); ok {
+		t.Error("challenger should not be found in nil peers")
 	}
+}
 
-	// void answer
-	index, err = getNextPuzzle(voidAnswer, previousBlock)
-	if err == nil {
-		t.Errorf("Index is %d, but should be failed", index)
+func TestGetChallengeRange(t *testing.T) {
+	seed := hash.HashH([]byte("seed"))
+	if offset, count := getChallengeRange(&seed, 0); offset != 0 || count != 0 {
+		t.Errorf("range of empty table should be empty, got %d+%d", offset, count)
 	}
-
-	// void block
-	index, err = getNextPuzzle(answers, voidBlock)
-	if err == nil {
-		t.Errorf("Index is %d, but should be failed", index)
+	for _, rows := range []uint64{1, 5, StorageProofRows, 1000} {
+		offset, count := getChallengeRange(&seed, rows)
+		if offset >= rows || count == 0 || count > StorageProofRows || offset+count > rows {
+			t.Errorf("invalid range %d+%d in %d rows", offset, count, rows)
+		}
 	}
 }
 
-func TestGetNextVerifier(t *testing.T) {
-	verifier, err := getNextVerifier(previousBlock, currentBlock)
+func readTestChallengeData(t *testing.T, file string, seed *hash.Hash, queries ...string) []byte {
+	st, err := xs.NewSqlite(file)
 	if err != nil {
-		t.Error(err)
-	}
-	wantedVerifier := int32(hash.FNVHash32uint([]byte(previousBlock.ID))) % int32(len(currentBlock.Nodes))
-	if verifier != wantedVerifier {
-		t.Errorf("The next verifier is %d, should be %d", verifier, wantedVerifier)
+		t.Fatal(err)
 	}
-
-	// void previousBlock
-	verifier, err = getNextVerifier(voidBlock, currentBlock)
-	if err == nil {
-		t.Errorf("Verifier is %d, but should be failed", verifier)
+	defer st.Close()
+	for _, q := range queries {
+		if _, err = st.Writer().Exec(q); err != nil {
+			t.Fatal(err)
+		}
 	}
-
-	// void currentBlock
-	verifier, err = getNextVerifier(previousBlock, voidBlock)
-	if err == nil {
-		t.Errorf("Verifier is %d, but should be failed", verifier)
+	tx, err := st.Reader().Begin()
+	if err != nil {
+		t.Fatal(err)
 	}
-}
-
-func TestSelectRecord(t *testing.T) {
-	if strings.Compare(selectRecord(0), "hello world") != 0 {
-		t.Error("It should be hello world")
+	defer tx.Rollback()
+	data, err := ReadChallengeData(context.Background(), tx, seed)
+	if err != nil {
+		t.Fatal(err)
 	}
+	return data
 }
 
-func TestCheckValid(t *testing.T) {
-	if !CheckValid(answers) {
-		t.Error("It should be true")
+func TestGenerateAnswer(t *testing.T) {
+	var (
+		seed   = hash.HashH([]byte("seed"))
+		file1  = path.Join(testDataDir, t.Name()+"-1.db3")
+		file2  = path.Join(testDataDir, t.Name()+"-2.db3")
+		file3  = path.Join(testDataDir, t.Name()+"-3.db3")
+		file4  = path.Join(testDataDir, t.Name()+"-4.db3")
+		create = []string{
+			`CREATE TABLE "t1" ("k" INT PRIMARY KEY, "v" TEXT)`,
+			`CREATE TABLE "t2" ("v" TEXT)`,
+		}
+		insert []string
+	)
+	defer os.Remove(file1)
+	defer os.Remove(file2)
+	defer os.Remove(file3)
+	defer os.Remove(file4)
+	for i := 0; i < 100; i++ {
+		insert = append(insert,
+			fmt.Sprintf(`INSERT INTO "t1" VALUES (%d, 'value-%d')`, i, i),
+			fmt.Sprintf(`INSERT INTO "t2" VALUES ('value-%d')`, 99-i),
+		)
+	}
+
+	// the same logical rows with different physical histories
+	data1 := readTestChallengeData(t, file1, &seed, append(create, insert...)...)
+	data2 := readTestChallengeData(t, file2, &seed, append(append(create,
+		`INSERT INTO "t1" VALUES (1000, 'removed')`,
+		`INSERT INTO "t2" VALUES ('removed')`,
+	), append(insert,
+		`DELETE FROM "t1" WHERE "k" = 1000`,
+		`DELETE FROM "t2" WHERE "v" = 'removed'`,
+		`VACUUM`,
+	)...)...)
+	if !bytes.Equal(data1, data2) {
+		t.Error("challenge data of the same rows should be equal")
+	}
+	answer := GenerateAnswer(data1, "node")
+	if other := GenerateAnswer(data2, "node"); !other.IsEqual(&answer) {
+		t.Errorf("answer is %s, should be %s", other, answer)
+	}
+	if other := GenerateAnswer(data1, "other"); other.IsEqual(&answer) {
+		t.Error("answers of different nodes should be different")
+	}
+
+	// different rows
+	data3 := readTestChallengeData(t, file3, &seed, append(append(create, insert...),
+		`UPDATE "t1" SET "v" = 'updated'`,
+		`UPDATE "t2" SET "v" = 'updated'`,
+	)...)
+	if bytes.Equal(data1, data3) {
+		t.Error("challenge data of different rows should be different")
+	}
+
+	// empty tables
+	if data4 := readTestChallengeData(t, file4, &seed, create...); len(data4) == 0 {
+		t.Error("challenge data of empty tables should not be empty")
+	} else if bytes.Equal(data1, data4) {
+		t.Error("challenge data of empty tables should be different")
 	}
 }
 
-func TestGenerateAnswer(t *testing.T) {
-	answer, err := GenerateAnswer(answers, previousBlock, currentNode)
-	if err != nil {
-		t.Error(err)
-	}
-	sqlIndex, err := getNextPuzzle(answers, previousBlock)
-	if err != nil {
-		t.Error(err)
+func TestStorageProofs(t *testing.T) {
+	sp := newStorageProofs(&Config{DataFile: "storage.db3"})
+	if !sp.enabled {
+		t.Error("storage proof should be enabled")
 	}
-	record := []byte(selectRecord(sqlIndex))
-	answerHash := hash.HashH(append(record, []byte(currentNode.ID)...))
-	wantedAnswer := NewAnswer(previousBlock.ID, currentNode.ID, answerHash)
-	if !reflect.DeepEqual(*answer, *wantedAnswer) {
-		t.Errorf("Answer is %s, should be %s", *answer, *wantedAnswer)
+	if sp = newStorageProofs(&Config{
+		DataFile:      "storage.db3",
+		StorageEngine: types.StorageEngineMemory,
+	}); sp.enabled {
+		t.Error("storage proof should be disabled for in-memory storage")
 	}
 
-	// void answers
-	answer, err = GenerateAnswer(voidAnswer, previousBlock, currentNode)
-	if err == nil {
-		t.Errorf("Answer is %+v, should be failed", answer)
+	seed := hash.HashH([]byte("seed"))
+	if !sp.next(&seed) {
+		t.Error("seed should be challenged")
 	}
-
-	// void block
-	answer, err = GenerateAnswer(answers, voidBlock, currentNode)
-	if err == nil {
-		t.Errorf("Answer is %+v, should be failed", answer)
+	if sp.next(&seed) {
+		t.Error("seed should not be challenged twice")
 	}
 
-	// void node
-	answer, err = GenerateAnswer(answers, previousBlock, voidNode)
-	if err == nil {
-		t.Errorf("Answer is %+v, should be failed", answer)
+	sp.add(&types.StorageProof{Prover: "a"}, &types.StorageProof{Prover: "b"})
+	if proofs := sp.drain(); len(proofs) != 2 {
+		t.Errorf("drained %d proofs, should be 2", len(proofs))
+	}
+	if proofs := sp.drain(); len(proofs) != 0 {
+		t.Errorf("drained %d proofs, should be empty", len(proofs))
 	}
-
-}
-
-func init() {
-	currentNode = proto.Node{ID: "123456"}
-	currentBlock = StorageProofBlock{
-		ID:    "def",
-		Nodes: []proto.Node{{ID: "a"}, {ID: "b"}, {ID: "c"}, {ID: "d"}, {ID: "e"}},
-	}
-	previousBlock = StorageProofBlock{
-		ID:    "abc",
-		Nodes: []proto.Node{{ID: "a"}, {ID: "b"}, {ID: "c"}, {ID: "d"}},
-	}
-	voidBlock = StorageProofBlock{
-		ID:    "",
-		Nodes: nil,
-	}
-	answers = []Answer{
-		{
-			PreviousBlockID: previousBlock.ID,
-			NodeID:          currentNode.ID,
-			Answer:          hash.HashH([]byte{1}),
-		},
-		{
-			PreviousBlockID: previousBlock.ID,
-			NodeID:          currentNode.ID,
-			Answer:          hash.HashH([]byte{2}),
-		},
-		{
-			PreviousBlockID: previousBlock.ID,
-			NodeID:          currentNode.ID,
-			Answer:          hash.HashH([]byte{3}),
-		},
-		{
-			PreviousBlockID: previousBlock.ID,
-			NodeID:          currentNode.ID,
-			Answer:          hash.HashH([]byte{4}),
-		},
-	}
-	voidAnswer = nil
-	voidNode = proto.Node{}
 }
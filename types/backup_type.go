@@ -0,0 +1,52 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+// BackupManifestFileName defines the manifest file name in a database backup bundle.
+const BackupManifestFileName = "manifest.json"
+
+// BackupManifest describes the consistent point of a database backup bundle.
+type BackupManifest struct {
+	DatabaseID    proto.DatabaseID `json:"dbid"`
+	NodeID        proto.NodeID     `json:"node"` // node id of the backup source miner
+	StorageEngine StorageEngine    `json:"engine"`
+	Head          hash.Hash        `json:"head"`   // sql-chain head block hash
+	Height        int32            `json:"height"` // sql-chain head block height
+	KayakIndex    uint64           `json:"kayak_index"`
+	KayakCommit   uint64           `json:"kayak_commit"` // last committed kayak log index
+	Timestamp     time.Time        `json:"timestamp"`    // time in UTC zone
+}
+
+// BackupRequest defines the database backup request entity, the bundle is written to Path on
+// the miner host.
+type BackupRequest struct {
+	proto.Envelope
+	DatabaseID proto.DatabaseID
+	Path       string
+}
+
+// BackupResponse defines the database backup response entity.
+type BackupResponse struct {
+	Manifest BackupManifest
+}
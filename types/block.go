@@ -89,6 +89,9 @@ type Block struct {
 	FailedReqs   []*Request
 	QueryTxs     []*QueryAsTx
 	Acks         []*SignedAckHeader
+	// StorageProofs are the storage proof challenge results of the peers collected by the
+	// block producer as the challenger.
+	StorageProofs []*StorageProof
 }
 
 // CalcNextID calculates the next query id by examinating every query in block, and adds write
@@ -168,7 +171,8 @@ func (b *Block) Signee() *ca.PublicKey {
 }
 
 func (b *Block) computeMerkleRoot() hash.Hash {
-	var hs = make([]*hash.Hash, 0, len(b.FailedReqs)+len(b.QueryTxs)+len(b.Acks))
+	var hs = make([]*hash.Hash, 0,
+		len(b.FailedReqs)+len(b.QueryTxs)+len(b.Acks)+len(b.StorageProofs))
 	for i := range b.FailedReqs {
 		h := b.FailedReqs[i].Header.Hash()
 		hs = append(hs, &h)
@@ -181,6 +185,10 @@ func (b *Block) computeMerkleRoot() hash.Hash {
 		h := b.Acks[i].Hash()
 		hs = append(hs, &h)
 	}
+	for i := range b.StorageProofs {
+		h := b.StorageProofs[i].Hash()
+		hs = append(hs, &h)
+	}
 	return *merkle.NewMerkle(hs).GetRoot()
 }
 
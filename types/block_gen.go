@@ -10,9 +10,9 @@ import (
 func (z *Block) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 4
+	// map header, size 5
 	// map header, size 2
-	o = append(o, 0x84, 0x84, 0x82, 0x82)
+	o = append(o, 0x85, 0x85, 0x82, 0x82)
 	if oTemp, err := z.SignedHeader.Header.MarshalHash(); err != nil {
 		return nil, err
 	} else {
@@ -24,7 +24,7 @@ func (z *Block) MarshalHash() (o []byte, err error) {
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x84)
+	o = append(o, 0x85)
 	o = hsp.AppendArrayHeader(o, uint32(len(z.QueryTxs)))
 	for za0002 := range z.QueryTxs {
 		if z.QueryTxs[za0002] == nil {
@@ -37,7 +37,7 @@ func (z *Block) MarshalHash() (o []byte, err error) {
 			}
 		}
 	}
-	o = append(o, 0x84)
+	o = append(o, 0x85)
 	o = hsp.AppendArrayHeader(o, uint32(len(z.FailedReqs)))
 	for za0001 := range z.FailedReqs {
 		if z.FailedReqs[za0001] == nil {
@@ -50,7 +50,7 @@ func (z *Block) MarshalHash() (o []byte, err error) {
 			}
 		}
 	}
-	o = append(o, 0x84)
+	o = append(o, 0x85)
 	o = hsp.AppendArrayHeader(o, uint32(len(z.Acks)))
 	for za0003 := range z.Acks {
 		if z.Acks[za0003] == nil {
@@ -63,6 +63,19 @@ func (z *Block) MarshalHash() (o []byte, err error) {
 			}
 		}
 	}
+	o = append(o, 0x85)
+	o = hsp.AppendArrayHeader(o, uint32(len(z.StorageProofs)))
+	for za0004 := range z.StorageProofs {
+		if z.StorageProofs[za0004] == nil {
+			o = hsp.AppendNil(o)
+		} else {
+			if oTemp, err := z.StorageProofs[za0004].MarshalHash(); err != nil {
+				return nil, err
+			} else {
+				o = hsp.AppendBytes(o, oTemp)
+			}
+		}
+	}
 	return
 }
 
@@ -92,6 +105,14 @@ func (z *Block) Msgsize() (s int) {
 			s += z.Acks[za0003].Msgsize()
 		}
 	}
+	s += 14 + hsp.ArrayHeaderSize
+	for za0004 := range z.StorageProofs {
+		if z.StorageProofs[za0004] == nil {
+			s += hsp.NilSize
+		} else {
+			s += z.StorageProofs[za0004].Msgsize()
+		}
+	}
 	return
 }
 
@@ -25,6 +25,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/utils"
 	"github.com/pkg/errors"
 	. "github.com/smartystreets/goconvey/convey"
@@ -143,6 +144,23 @@ func TestSignedHeaderMarshaleUnmarshaler(t *testing.T) {
 	}
 }
 
+func TestStorageProofsVerify(t *testing.T) {
+	block, err := createRandomBlock(genesisHash, true)
+
+	if err != nil {
+		t.Fatalf("Error occurred: %v", err)
+	}
+
+	block.StorageProofs = append(block.StorageProofs, &StorageProof{
+		Prover: proto.NodeID("node"),
+		Passed: true,
+	})
+
+	if err = block.Verify(); err != ErrMerkleRootVerification {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
 func TestBlockMarshalUnmarshaler(t *testing.T) {
 	origin, err := createRandomBlock(genesisHash, false)
 	if err != nil {
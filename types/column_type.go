@@ -0,0 +1,140 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+//go:generate hsp
+
+// ColumnKind defines the value kind of a query result column.
+type ColumnKind int32
+
+const (
+	// ColumnKindUnknown defines a column without declared type, values are passed as is.
+	ColumnKindUnknown ColumnKind = iota
+	// ColumnKindInteger defines an integer column.
+	ColumnKindInteger
+	// ColumnKindFloat defines a floating point number column.
+	ColumnKindFloat
+	// ColumnKindText defines a text column.
+	ColumnKindText
+	// ColumnKindBlob defines a binary column.
+	ColumnKindBlob
+	// ColumnKindBool defines a boolean column.
+	ColumnKindBool
+	// ColumnKindDatetime defines a date, time or timestamp column.
+	ColumnKindDatetime
+	// ColumnKindDecimal defines a fixed point number column.
+	ColumnKindDecimal
+)
+
+// String returns the string representation of column kind.
+func (k ColumnKind) String() string {
+	switch k {
+	case ColumnKindInteger:
+		return "Integer"
+	case ColumnKindFloat:
+		return "Float"
+	case ColumnKindText:
+		return "Text"
+	case ColumnKindBlob:
+		return "Blob"
+	case ColumnKindBool:
+		return "Bool"
+	case ColumnKindDatetime:
+		return "Datetime"
+	case ColumnKindDecimal:
+		return "Decimal"
+	default:
+		return "Unknown"
+	}
+}
+
+// ColumnMeta defines the typed metadata of a query result column.
+type ColumnMeta struct {
+	Kind      ColumnKind `json:"k"`
+	Nullable  bool       `json:"n"` // whether the column may be NULL, true unless known NOT NULL
+	Length    int64      `json:"l"` // max length of text/blob column, math.MaxInt64 for unlimited
+	Precision int64      `json:"p"` // precision of decimal column, 0 for unspecified
+	Scale     int64      `json:"s"` // scale of decimal column
+}
+
+// IsVariableLength returns whether the column values have variable length.
+func (m *ColumnMeta) IsVariableLength() bool {
+	return m.Kind == ColumnKindText || m.Kind == ColumnKindBlob
+}
+
+// ParseColumnMeta builds the column metadata from the declared column type, following the
+// column affinity rules of SQLite with extra recognition of boolean, datetime and decimal types.
+func ParseColumnMeta(declType string, nullable bool) (m ColumnMeta) {
+	var (
+		name = strings.ToUpper(strings.TrimSpace(declType))
+		args []int64
+	)
+	m.Nullable = nullable
+	if i := strings.IndexByte(name, '('); i >= 0 {
+		if j := strings.IndexByte(name[i:], ')'); j > 0 {
+			for _, v := range strings.Split(name[i+1:i+j], ",") {
+				if n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+					args = append(args, n)
+				}
+			}
+		}
+		name = strings.TrimSpace(name[:i])
+	}
+
+	switch {
+	case name == "":
+		m.Kind = ColumnKindUnknown
+	case strings.Contains(name, "BOOL"):
+		m.Kind = ColumnKindBool
+	case strings.HasPrefix(name, "DATE"), strings.HasPrefix(name, "TIME"):
+		m.Kind = ColumnKindDatetime
+	case strings.Contains(name, "INT"):
+		m.Kind = ColumnKindInteger
+	case strings.Contains(name, "CHAR"), strings.Contains(name, "CLOB"), strings.Contains(name, "TEXT"):
+		m.Kind = ColumnKindText
+	case strings.Contains(name, "BLOB"), strings.Contains(name, "BINARY"):
+		m.Kind = ColumnKindBlob
+	case strings.Contains(name, "REAL"), strings.Contains(name, "FLOA"), strings.Contains(name, "DOUB"):
+		m.Kind = ColumnKindFloat
+	case strings.Contains(name, "DEC"), strings.Contains(name, "NUM"), name == "MONEY":
+		m.Kind = ColumnKindDecimal
+	default:
+		m.Kind = ColumnKindUnknown
+	}
+
+	switch m.Kind {
+	case ColumnKindText, ColumnKindBlob:
+		m.Length = math.MaxInt64
+		if len(args) > 0 && args[0] > 0 {
+			m.Length = args[0]
+		}
+	case ColumnKindDecimal:
+		if len(args) > 0 {
+			m.Precision = args[0]
+		}
+		if len(args) > 1 {
+			m.Scale = args[1]
+		}
+	}
+	return
+}
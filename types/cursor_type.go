@@ -0,0 +1,151 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/pkg/errors"
+)
+
+//go:generate hsp
+
+// CursorRequestHeader defines a client request header to fetch page from or close a cursor.
+type CursorRequestHeader struct {
+	DatabaseID proto.DatabaseID `json:"dbid"`
+	NodeID     proto.NodeID     `json:"id"` // request node id
+	CursorID   uint64           `json:"cu"`
+	PageNo     uint64           `json:"p"` // page to fetch, the query response is page 0
+	Timestamp  time.Time        `json:"t"` // time in UTC zone
+}
+
+// SignedCursorRequestHeader defines a signed cursor request header.
+type SignedCursorRequestHeader struct {
+	CursorRequestHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// CursorRequest defines a complete cursor request.
+type CursorRequest struct {
+	proto.Envelope
+	Header SignedCursorRequestHeader `json:"h"`
+}
+
+// CloseCursorResponse defines the cursor close response entity.
+type CloseCursorResponse struct{}
+
+// PageHeader defines a result page header of cursor.
+//
+// Pages are hash-chained: the first fetched page refers to the query response header as its
+// parent, and each following page refers to the previous page header, all of them refer to the
+// original request header.
+type PageHeader struct {
+	RequestHash hash.Hash    `json:"r"`  // hash of original request header
+	ParentHash  hash.Hash    `json:"pa"` // hash of query response header or previous page header
+	NodeID      proto.NodeID `json:"id"` // response node id
+	CursorID    uint64       `json:"cu"`
+	PageNo      uint64       `json:"p"`
+	Timestamp   time.Time    `json:"t"`  // time in UTC zone
+	RowCount    uint64       `json:"c"`  // row count of payload
+	Done        bool         `json:"e"`  // whether it's the last page of cursor
+	PayloadHash hash.Hash    `json:"dh"` // hash of page payload
+}
+
+// SignedPageHeader defines a signed page header.
+type SignedPageHeader struct {
+	PageHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// Page defines a complete result page of cursor.
+type Page struct {
+	Header  SignedPageHeader `json:"h"`
+	Payload ResponsePayload  `json:"p"`
+}
+
+// Verify checks hash and signature in cursor request header.
+func (sh *SignedCursorRequestHeader) Verify() (err error) {
+	return sh.DefaultHashSignVerifierImpl.Verify(&sh.CursorRequestHeader)
+}
+
+// Sign the request.
+func (sh *SignedCursorRequestHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return sh.DefaultHashSignVerifierImpl.Sign(&sh.CursorRequestHeader, signer)
+}
+
+// Verify checks hash and signature in cursor request.
+func (r *CursorRequest) Verify() error {
+	return r.Header.Verify()
+}
+
+// Sign the request.
+func (r *CursorRequest) Sign(signer *asymmetric.PrivateKey) error {
+	return r.Header.Sign(signer)
+}
+
+// Verify checks hash and signature in page header.
+func (sh *SignedPageHeader) Verify() (err error) {
+	return sh.DefaultHashSignVerifierImpl.Verify(&sh.PageHeader)
+}
+
+// Sign the page header.
+func (sh *SignedPageHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return sh.DefaultHashSignVerifierImpl.Sign(&sh.PageHeader, signer)
+}
+
+// Verify checks hash and signature in whole page.
+func (p *Page) Verify() (err error) {
+	// verify data hash in header
+	if err = verifyHash(&p.Payload, &p.Header.PayloadHash); err != nil {
+		return
+	}
+
+	return p.Header.Verify()
+}
+
+// Sign the page.
+func (p *Page) Sign(signer *asymmetric.PrivateKey) (err error) {
+	// set rows count
+	p.Header.RowCount = uint64(len(p.Payload.Rows))
+
+	// build hash in header
+	if err = buildHash(&p.Payload, &p.Header.PayloadHash); err != nil {
+		return
+	}
+
+	// sign the page
+	return p.Header.Sign(signer)
+}
+
+// VerifyChain checks that the page is the next page of cursor following the parent header hash.
+func (p *Page) VerifyChain(request, parent hash.Hash, cursorID, pageNo uint64) (err error) {
+	if !p.Header.RequestHash.IsEqual(&request) {
+		return errors.Wrap(ErrPageChainMismatch, "request hash mismatch")
+	}
+	if !p.Header.ParentHash.IsEqual(&parent) {
+		return errors.Wrap(ErrPageChainMismatch, "parent hash mismatch")
+	}
+	if p.Header.CursorID != cursorID || p.Header.PageNo != pageNo {
+		return errors.Wrapf(ErrPageChainMismatch, "unexpected page %d#%d, expected %d#%d",
+			p.Header.CursorID, p.Header.PageNo, cursorID, pageNo)
+	}
+	return
+}
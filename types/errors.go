@@ -28,4 +28,6 @@ var (
 	ErrNodePublicKeyNotMatch = errors.New("node publick key doesn't match")
 	// ErrSignRequest indicates a failed signature compute operation.
 	ErrSignRequest = errors.New("signature compute failed")
+	// ErrPageChainMismatch indicates that a cursor page is not chained to the expected parent.
+	ErrPageChainMismatch = errors.New("page chain mismatch")
 )
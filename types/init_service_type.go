@@ -29,13 +29,28 @@ type InitService struct {
 	proto.Envelope
 }
 
+// StorageEngine defines the storage engine type of a database instance.
+type StorageEngine string
+
+const (
+	// StorageEngineDefault selects the default storage engine, which is StorageEngineSQLite.
+	StorageEngineDefault StorageEngine = ""
+	// StorageEngineSQLite defines the on-disk sqlite3 storage engine.
+	StorageEngineSQLite StorageEngine = "sqlite"
+	// StorageEngineMemory defines the in-memory sqlite3 storage engine, data is lost on restart,
+	// which is intended for testing and ephemeral databases only, miners reject it unless
+	// explicitly allowed.
+	StorageEngineMemory StorageEngine = "memory"
+)
+
 // ResourceMeta defines single database resource meta.
 type ResourceMeta struct {
-	Node          uint16 // reserved node count
-	Space         uint64 // reserved storage space in bytes
-	Memory        uint64 // reserved memory in bytes
-	LoadAvgPerCPU uint64 // max loadAvg15 per CPU
-	EncryptionKey string `hspack:"-"` // encryption key for database instance
+	Node          uint16        // reserved node count
+	Space         uint64        // reserved storage space in bytes
+	Memory        uint64        // reserved memory in bytes
+	LoadAvgPerCPU uint64        // max loadAvg15 per CPU
+	EncryptionKey string        `hspack:"-"` // encryption key for database instance
+	StorageEngine StorageEngine // storage engine of database instance
 }
 
 // ServiceInstance defines single instance to be initialized.
@@ -76,21 +76,23 @@ func (z *InitServiceResponseHeader) Msgsize() (s int) {
 func (z *ResourceMeta) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 4
-	o = append(o, 0x84, 0x84)
+	// map header, size 5
+	o = append(o, 0x85, 0x85)
+	o = hsp.AppendString(o, string(z.StorageEngine))
+	o = append(o, 0x85)
 	o = hsp.AppendUint16(o, z.Node)
-	o = append(o, 0x84)
+	o = append(o, 0x85)
 	o = hsp.AppendUint64(o, z.Space)
-	o = append(o, 0x84)
+	o = append(o, 0x85)
 	o = hsp.AppendUint64(o, z.Memory)
-	o = append(o, 0x84)
+	o = append(o, 0x85)
 	o = hsp.AppendUint64(o, z.LoadAvgPerCPU)
 	return
 }
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *ResourceMeta) Msgsize() (s int) {
-	s = 1 + 5 + hsp.Uint16Size + 6 + hsp.Uint64Size + 7 + hsp.Uint64Size + 14 + hsp.Uint64Size
+	s = 1 + 14 + hsp.StringPrefixSize + len(string(z.StorageEngine)) + 5 + hsp.Uint16Size + 6 + hsp.Uint64Size + 7 + hsp.Uint64Size + 14 + hsp.Uint64Size
 	return
 }
 
@@ -185,3 +187,17 @@ func (z *SignedInitServiceResponseHeader) Msgsize() (s int) {
 	s += 28 + z.DefaultHashSignVerifierImpl.Msgsize()
 	return
 }
+
+// MarshalHash marshals for hash
+func (z StorageEngine) MarshalHash() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	o = hsp.AppendString(o, string(z))
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z StorageEngine) Msgsize() (s int) {
+	s = hsp.StringPrefixSize + len(string(z))
+	return
+}
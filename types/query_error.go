@@ -0,0 +1,72 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// QueryErrorCode defines the code of the query errors reported by miners to clients, which
+// classifies the error without parsing the message.
+type QueryErrorCode int
+
+const (
+	// QueryErrUnknownUser indicates that the query account is not a database user.
+	QueryErrUnknownUser QueryErrorCode = iota + 1
+	// QueryErrPermissionDenied indicates that the query account has no permission for the query.
+	QueryErrPermissionDenied
+	// QueryErrDatabaseFrozen indicates that the database is frozen for low deposit.
+	QueryErrDatabaseFrozen
+	// QueryErrInvalidRequestSeq indicates that the request sequence no is already applied.
+	QueryErrInvalidRequestSeq
+	// QueryErrNotLeader indicates that the write query is sent to a non-leader peer.
+	QueryErrNotLeader
+)
+
+const queryErrorPrefix = "query error #"
+
+// QueryError defines the query error with code. Only the error message is kept by the rpc
+// transport, so the code is carried in the message prefix and recovered by ParseQueryError.
+type QueryError struct {
+	Code QueryErrorCode
+	Msg  string
+}
+
+// Error implements the error interface.
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%s%d: %s", queryErrorPrefix, e.Code, e.Msg)
+}
+
+// ParseQueryError parses the error message produced by QueryError.Error.
+func ParseQueryError(msg string) (e *QueryError, ok bool) {
+	if !strings.HasPrefix(msg, queryErrorPrefix) {
+		return
+	}
+	var (
+		code QueryErrorCode
+		rest = msg[len(queryErrorPrefix):]
+		i    = strings.Index(rest, ": ")
+	)
+	if i <= 0 {
+		return
+	}
+	if _, err := fmt.Sscanf(rest[:i], "%d", &code); err != nil {
+		return
+	}
+	return &QueryError{Code: code, Msg: rest[i+2:]}, true
+}
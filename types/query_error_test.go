@@ -0,0 +1,39 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestQueryError(t *testing.T) {
+	Convey("test query error codes", t, func() {
+		err := &QueryError{Code: QueryErrPermissionDenied, Msg: "read-only account: permission denied"}
+		e, ok := ParseQueryError(err.Error())
+		So(ok, ShouldBeTrue)
+		So(e, ShouldResemble, err)
+
+		_, ok = ParseQueryError("read-only account: permission denied")
+		So(ok, ShouldBeFalse)
+		_, ok = ParseQueryError(queryErrorPrefix + "x: message")
+		So(ok, ShouldBeFalse)
+		_, ok = ParseQueryError(queryErrorPrefix + "1")
+		So(ok, ShouldBeFalse)
+	})
+}
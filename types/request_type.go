@@ -38,6 +38,23 @@ const (
 	WriteQuery
 )
 
+// TxOp enumerates the operations of an interactive transaction.
+type TxOp int32
+
+const (
+	// TxNone defines a request outside of any interactive transaction.
+	TxNone TxOp = iota
+	// TxBegin opens an interactive transaction and executes the queries in it.
+	TxBegin
+	// TxExec executes the queries in an opened interactive transaction.
+	TxExec
+	// TxCommit commits an interactive transaction, the request carries all the write queries
+	// executed in the transaction and is replicated as a normal write request.
+	TxCommit
+	// TxRollback rolls back an interactive transaction.
+	TxRollback
+)
+
 // NamedArg defines the named argument structure for database.
 type NamedArg struct {
 	Name  string
@@ -65,6 +82,9 @@ type RequestHeader struct {
 	Timestamp    time.Time        `json:"t"`  // time in UTC zone
 	BatchCount   uint64           `json:"bc"` // query count in this request
 	QueriesHash  hash.Hash        `json:"qh"` // hash of query payload
+	TxID         uint64           `json:"tx"` // interactive transaction id, 0 for auto-commit
+	TxOp         TxOp             `json:"to"` // interactive transaction operation
+	PageSize     uint64           `json:"ps"` // max rows of the first result page, 0 for whole result
 }
 
 // QueryKey defines an unique query key of a request.
@@ -104,6 +124,24 @@ func (t QueryType) String() string {
 	}
 }
 
+// String implements fmt.Stringer for logging purpose.
+func (o TxOp) String() string {
+	switch o {
+	case TxNone:
+		return "none"
+	case TxBegin:
+		return "begin"
+	case TxExec:
+		return "exec"
+	case TxCommit:
+		return "commit"
+	case TxRollback:
+		return "rollback"
+	default:
+		return "unknown"
+	}
+}
+
 // Verify checks hash and signature in request header.
 func (sh *SignedRequestHeader) Verify() (err error) {
 	return sh.DefaultHashSignVerifierImpl.Verify(&sh.RequestHeader)
@@ -137,6 +175,11 @@ func (r *Request) Sign(signer *asymmetric.PrivateKey) (err error) {
 	return r.Header.Sign(signer)
 }
 
+// InTx reports whether the request is a part of an interactive transaction.
+func (sh *SignedRequestHeader) InTx() bool {
+	return sh.TxID != 0 && sh.TxOp != TxNone
+}
+
 // GetQueryKey returns a unique query key of this request.
 func (sh *SignedRequestHeader) GetQueryKey() QueryKey {
 	return QueryKey{
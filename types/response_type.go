@@ -35,9 +35,10 @@ type ResponseRow struct {
 
 // ResponsePayload defines column names and rows of query response.
 type ResponsePayload struct {
-	Columns   []string      `json:"c"`
-	DeclTypes []string      `json:"t"`
-	Rows      []ResponseRow `json:"r"`
+	Columns     []string      `json:"c"`
+	DeclTypes   []string      `json:"t"`
+	Rows        []ResponseRow `json:"r"`
+	ColumnMetas []ColumnMeta  `json:"m"` // typed metadata of columns
 }
 
 // ResponseHeader defines a query response header.
@@ -50,6 +51,7 @@ type ResponseHeader struct {
 	LastInsertID int64               `json:"l"`  // insert insert id
 	AffectedRows int64               `json:"a"`  // affected rows
 	PayloadHash  hash.Hash           `json:"dh"` // hash of query response payload
+	CursorID     uint64              `json:"cu"` // cursor to fetch the remaining rows, 0 for none
 }
 
 // SignedResponseHeader defines a signed query response header.
@@ -43,41 +43,43 @@ func (z *Response) Msgsize() (s int) {
 func (z *ResponseHeader) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 8
-	o = append(o, 0x88, 0x88)
+	// map header, size 9
+	o = append(o, 0x89, 0x89)
 	if oTemp, err := z.Request.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x88)
+	o = append(o, 0x89)
 	if oTemp, err := z.PayloadHash.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x88)
+	o = append(o, 0x89)
 	o = hsp.AppendInt64(o, z.LastInsertID)
-	o = append(o, 0x88)
+	o = append(o, 0x89)
 	o = hsp.AppendInt64(o, z.AffectedRows)
-	o = append(o, 0x88)
+	o = append(o, 0x89)
 	if oTemp, err := z.NodeID.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x88)
+	o = append(o, 0x89)
 	o = hsp.AppendTime(o, z.Timestamp)
-	o = append(o, 0x88)
+	o = append(o, 0x89)
 	o = hsp.AppendUint64(o, z.RowCount)
-	o = append(o, 0x88)
+	o = append(o, 0x89)
 	o = hsp.AppendUint64(o, z.LogOffset)
+	o = append(o, 0x89)
+	o = hsp.AppendUint64(o, z.CursorID)
 	return
 }
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *ResponseHeader) Msgsize() (s int) {
-	s = 1 + 8 + z.Request.Msgsize() + 12 + z.PayloadHash.Msgsize() + 13 + hsp.Int64Size + 13 + hsp.Int64Size + 7 + z.NodeID.Msgsize() + 10 + hsp.TimeSize + 9 + hsp.Uint64Size + 10 + hsp.Uint64Size
+	s = 1 + 8 + z.Request.Msgsize() + 12 + z.PayloadHash.Msgsize() + 13 + hsp.Int64Size + 13 + hsp.Int64Size + 7 + z.NodeID.Msgsize() + 10 + hsp.TimeSize + 9 + hsp.Uint64Size + 10 + hsp.Uint64Size + 9 + hsp.Uint64Size
 	return
 }
 
@@ -85,8 +87,8 @@ func (z *ResponseHeader) Msgsize() (s int) {
 func (z *ResponsePayload) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 3
-	o = append(o, 0x83, 0x83)
+	// map header, size 4
+	o = append(o, 0x84, 0x84)
 	o = hsp.AppendArrayHeader(o, uint32(len(z.Rows)))
 	for za0003 := range z.Rows {
 		// map header, size 1
@@ -99,12 +101,21 @@ func (z *ResponsePayload) MarshalHash() (o []byte, err error) {
 			}
 		}
 	}
-	o = append(o, 0x83)
+	o = append(o, 0x84)
+	o = hsp.AppendArrayHeader(o, uint32(len(z.ColumnMetas)))
+	for za0005 := range z.ColumnMetas {
+		if oTemp, err := z.ColumnMetas[za0005].MarshalHash(); err != nil {
+			return nil, err
+		} else {
+			o = hsp.AppendBytes(o, oTemp)
+		}
+	}
+	o = append(o, 0x84)
 	o = hsp.AppendArrayHeader(o, uint32(len(z.Columns)))
 	for za0001 := range z.Columns {
 		o = hsp.AppendString(o, z.Columns[za0001])
 	}
-	o = append(o, 0x83)
+	o = append(o, 0x84)
 	o = hsp.AppendArrayHeader(o, uint32(len(z.DeclTypes)))
 	for za0002 := range z.DeclTypes {
 		o = hsp.AppendString(o, z.DeclTypes[za0002])
@@ -121,6 +132,10 @@ func (z *ResponsePayload) Msgsize() (s int) {
 			s += hsp.GuessSize(z.Rows[za0003].Values[za0004])
 		}
 	}
+	s += 12 + hsp.ArrayHeaderSize
+	for za0005 := range z.ColumnMetas {
+		s += z.ColumnMetas[za0005].Msgsize()
+	}
 	s += 8 + hsp.ArrayHeaderSize
 	for za0001 := range z.Columns {
 		s += hsp.StringPrefixSize + len(z.Columns[za0001])
@@ -0,0 +1,42 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+//go:generate hsp
+
+// StorageProof records the result of a storage proof challenge to a miner, the challenge is
+// derived from the block with hash Seed, and asks for the hash over the logical rows selected by
+// Seed in the committed data with next query id LogOffset.
+type StorageProof struct {
+	Prover    proto.NodeID
+	Seed      hash.Hash
+	LogOffset uint64
+	Answer    hash.Hash
+	Passed    bool
+}
+
+// Hash returns the hash of the storage proof.
+func (p *StorageProof) Hash() (h hash.Hash) {
+	// marshalling of the plain fields never fails
+	buildHash(p, &h)
+	return
+}
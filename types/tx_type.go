@@ -0,0 +1,46 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+// NextAccountNonceReq defines a request of the NextAccountNonce RPC method.
+type NextAccountNonceReq struct {
+	proto.Envelope
+	Addr proto.AccountAddress
+}
+
+// NextAccountNonceResp defines a response of the NextAccountNonce RPC method.
+type NextAccountNonceResp struct {
+	proto.Envelope
+	Addr  proto.AccountAddress
+	Nonce pi.AccountNonce
+}
+
+// AddTxReq defines a request of the AddTx RPC method.
+type AddTxReq struct {
+	proto.Envelope
+	Tx pi.Transaction
+}
+
+// AddTxResp defines a response of the AddTx RPC method.
+type AddTxResp struct {
+	proto.Envelope
+}
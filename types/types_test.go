@@ -18,6 +18,7 @@ package types
 
 import (
 	"fmt"
+	"math"
 	"testing"
 	"time"
 
@@ -690,3 +691,107 @@ func TestQueryTypeStringer(t *testing.T) {
 		}
 	})
 }
+
+func TestPage_Sign(t *testing.T) {
+	privKey, _ := getCommKeys()
+
+	Convey("sign", t, func() {
+		req := &SignedRequestHeader{
+			RequestHeader: RequestHeader{
+				QueryType:  ReadQuery,
+				NodeID:     proto.NodeID("0000000000000000000000000000000000000000000000000000000000001111"),
+				DatabaseID: proto.DatabaseID("db1"),
+				Timestamp:  time.Now().UTC(),
+				PageSize:   1,
+			},
+		}
+		err := req.Sign(privKey)
+		So(err, ShouldBeNil)
+		res := &SignedResponseHeader{
+			ResponseHeader: ResponseHeader{
+				Request:   *req,
+				NodeID:    proto.NodeID("0000000000000000000000000000000000000000000000000000000000002222"),
+				Timestamp: time.Now().UTC(),
+				CursorID:  1,
+			},
+		}
+		err = res.Sign(privKey)
+		So(err, ShouldBeNil)
+
+		page := &Page{
+			Header: SignedPageHeader{
+				PageHeader: PageHeader{
+					RequestHash: req.Hash(),
+					ParentHash:  res.Hash(),
+					NodeID:      res.NodeID,
+					CursorID:    1,
+					PageNo:      1,
+					Timestamp:   time.Now().UTC(),
+				},
+			},
+			Payload: ResponsePayload{
+				Rows: []ResponseRow{{Values: []interface{}{int64(1), "v1"}}},
+			},
+		}
+		err = page.Sign(privKey)
+		So(err, ShouldBeNil)
+		So(page.Header.RowCount, ShouldEqual, 1)
+
+		Convey("verify", func() {
+			err = page.Verify()
+			So(err, ShouldBeNil)
+			err = page.VerifyChain(req.Hash(), res.Hash(), 1, 1)
+			So(err, ShouldBeNil)
+
+			Convey("encode/decode verify", func() {
+				buf, err := utils.EncodeMsgPack(page)
+				So(err, ShouldBeNil)
+				var p *Page
+				err = utils.DecodeMsgPack(buf.Bytes(), &p)
+				So(err, ShouldBeNil)
+				err = p.Verify()
+				So(err, ShouldBeNil)
+			})
+			Convey("payload change", func() {
+				page.Payload.Rows[0].Values[1] = "v2"
+				err = page.Verify()
+				So(err, ShouldNotBeNil)
+			})
+			Convey("chain mismatch", func() {
+				err = page.VerifyChain(req.Hash(), req.Hash(), 1, 1)
+				So(errors.Cause(err), ShouldEqual, ErrPageChainMismatch)
+				err = page.VerifyChain(req.Hash(), res.Hash(), 1, 2)
+				So(errors.Cause(err), ShouldEqual, ErrPageChainMismatch)
+				err = page.VerifyChain(res.Hash(), res.Hash(), 1, 1)
+				So(errors.Cause(err), ShouldEqual, ErrPageChainMismatch)
+			})
+		})
+	})
+}
+
+func TestParseColumnMeta(t *testing.T) {
+	Convey("Column meta should be parsed from declared types", t, func() {
+		var cases = [...]struct {
+			decl string
+			meta ColumnMeta
+		}{
+			{decl: "", meta: ColumnMeta{Kind: ColumnKindUnknown, Nullable: true}},
+			{decl: "int", meta: ColumnMeta{Kind: ColumnKindInteger, Nullable: true}},
+			{decl: "BIGINT", meta: ColumnMeta{Kind: ColumnKindInteger, Nullable: true}},
+			{decl: "double precision", meta: ColumnMeta{Kind: ColumnKindFloat, Nullable: true}},
+			{decl: "TEXT", meta: ColumnMeta{Kind: ColumnKindText, Nullable: true, Length: math.MaxInt64}},
+			{decl: "varchar(255)", meta: ColumnMeta{Kind: ColumnKindText, Nullable: true, Length: 255}},
+			{decl: "BLOB", meta: ColumnMeta{Kind: ColumnKindBlob, Nullable: true, Length: math.MaxInt64}},
+			{decl: "boolean", meta: ColumnMeta{Kind: ColumnKindBool, Nullable: true}},
+			{decl: "DATETIME", meta: ColumnMeta{Kind: ColumnKindDatetime, Nullable: true}},
+			{decl: "timestamp", meta: ColumnMeta{Kind: ColumnKindDatetime, Nullable: true}},
+			{decl: "DECIMAL(10, 2)", meta: ColumnMeta{Kind: ColumnKindDecimal, Nullable: true, Precision: 10, Scale: 2}},
+			{decl: "NUMERIC", meta: ColumnMeta{Kind: ColumnKindDecimal, Nullable: true}},
+		}
+		for _, v := range cases {
+			So(ParseColumnMeta(v.decl, true), ShouldResemble, v.meta)
+		}
+		So(ParseColumnMeta("INTEGER", false).Nullable, ShouldBeFalse)
+		So(ColumnKindDatetime.String(), ShouldEqual, "Datetime")
+	})
+}
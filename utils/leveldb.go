@@ -0,0 +1,74 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+const (
+	// copyLevelDBBatchSize defines the max bytes of a single write batch while copying leveldb.
+	copyLevelDBBatchSize = 4 * 1024 * 1024
+)
+
+// CopyLevelDB copies a consistent snapshot of the src leveldb to a new leveldb at dst.
+func CopyLevelDB(src *leveldb.DB, dst string) (err error) {
+	var snap *leveldb.Snapshot
+	if snap, err = src.GetSnapshot(); err != nil {
+		return errors.Wrap(err, "get leveldb snapshot failed")
+	}
+	defer snap.Release()
+	return CopyLevelDBSnapshot(snap, dst)
+}
+
+// CopyLevelDBSnapshot copies all the key/value pairs in snap to a new leveldb at dst.
+func CopyLevelDBSnapshot(snap *leveldb.Snapshot, dst string) (err error) {
+	var (
+		db    *leveldb.DB
+		batch = new(leveldb.Batch)
+	)
+	if db, err = leveldb.OpenFile(dst, nil); err != nil {
+		return errors.Wrapf(err, "open leveldb %s failed", dst)
+	}
+	defer func() {
+		if cerr := db.Close(); cerr != nil && err == nil {
+			err = errors.Wrapf(cerr, "close leveldb %s failed", dst)
+		}
+	}()
+
+	iter := snap.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		batch.Put(iter.Key(), iter.Value())
+		if len(batch.Dump()) >= copyLevelDBBatchSize {
+			if err = db.Write(batch, nil); err != nil {
+				return errors.Wrap(err, "write leveldb batch failed")
+			}
+			batch.Reset()
+		}
+	}
+	if err = iter.Error(); err != nil {
+		return errors.Wrap(err, "iterate leveldb snapshot failed")
+	}
+	if batch.Len() > 0 {
+		if err = db.Write(batch, nil); err != nil {
+			return errors.Wrap(err, "write leveldb batch failed")
+		}
+	}
+	return
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+func TestCopyLevelDB(t *testing.T) {
+	Convey("copy leveldb", t, func() {
+		dir, err := ioutil.TempDir("", "copy-leveldb-")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		src, err := leveldb.OpenFile(filepath.Join(dir, "src"), nil)
+		So(err, ShouldBeNil)
+		defer src.Close()
+		for i := 0; i < 100; i++ {
+			err = src.Put([]byte(fmt.Sprintf("key%03d", i)), []byte(fmt.Sprintf("value%d", i)), nil)
+			So(err, ShouldBeNil)
+		}
+
+		err = CopyLevelDB(src, filepath.Join(dir, "dst"))
+		So(err, ShouldBeNil)
+
+		dst, err := leveldb.OpenFile(filepath.Join(dir, "dst"), nil)
+		So(err, ShouldBeNil)
+		defer dst.Close()
+		for i := 0; i < 100; i++ {
+			v, err := dst.Get([]byte(fmt.Sprintf("key%03d", i)), nil)
+			So(err, ShouldBeNil)
+			So(string(v), ShouldEqual, fmt.Sprintf("value%d", i))
+		}
+
+		// invalid destination
+		err = CopyLevelDB(src, filepath.Join(dir, "a", "\x00"))
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -46,3 +46,25 @@ func CopyFile(src, dst string) (int64, error) {
 	defer df.Close()
 	return io.Copy(df, sf)
 }
+
+// CopyDir copies the directory tree of src to dst, dst is created if not exists and the files
+// in dst with the same relative path are replaced.
+func CopyDir(src, dst string) (err error) {
+	cleanSrc := filepath.Clean(src)
+	cleanDst := filepath.Clean(dst)
+	return filepath.Walk(cleanSrc, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(cleanSrc, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(cleanDst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode()|0700)
+		}
+		_, err = CopyFile(path, target)
+		return err
+	})
+}
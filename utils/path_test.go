@@ -19,6 +19,7 @@ package utils
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -47,3 +48,24 @@ func TestCopyFile(t *testing.T) {
 		So(n, ShouldBeZeroValue)
 	})
 }
+
+func TestCopyDir(t *testing.T) {
+	Convey("copy dir", t, func() {
+		bytes := []byte("abc")
+		defer os.RemoveAll("testcopydir")
+		defer os.RemoveAll("testcopydir2")
+		So(os.MkdirAll(filepath.Join("testcopydir", "sub"), 0755), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join("testcopydir", "a"), bytes, 0600), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join("testcopydir", "sub", "b"), bytes, 0600), ShouldBeNil)
+
+		err := CopyDir("testcopydir", "testcopydir2")
+		So(err, ShouldBeNil)
+		bytes2, _ := ioutil.ReadFile(filepath.Join("testcopydir2", "a"))
+		So(bytes2, ShouldResemble, bytes)
+		bytes2, _ = ioutil.ReadFile(filepath.Join("testcopydir2", "sub", "b"))
+		So(bytes2, ShouldResemble, bytes)
+
+		err = CopyDir("/path/not/exist", "testcopydir2")
+		So(err, ShouldNotBeNil)
+	})
+}
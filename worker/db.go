@@ -45,6 +45,9 @@ const (
 	// SQLChainFileName defines sqlchain storage file name.
 	SQLChainFileName = "chain.db"
 
+	// SnapshotDirName defines the dir name of kayak snapshot files.
+	SnapshotDirName = "snapshot"
+
 	// MaxRecordedConnectionSequences defines the max connection slots to anti reply attack.
 	MaxRecordedConnectionSequences = 1000
 
@@ -53,6 +56,15 @@ const (
 
 	// CommitThreshold defines the commit complete threshold.
 	CommitThreshold = 1.0
+
+	// KayakSnapshotInterval defines the minimum kayak log count between wal snapshots.
+	KayakSnapshotInterval = 10000
+
+	// MaxOpenCursors defines the max open query result cursors of a database instance.
+	MaxOpenCursors = 64
+
+	// MaxPageSize defines the max rows of a single query result page.
+	MaxPageSize = 10000
 )
 
 // Database defines a single database instance in worker runtime.
@@ -67,6 +79,16 @@ type Database struct {
 	chain          *sqlchain.Chain
 	nodeID         proto.NodeID
 	mux            *DBKayakMuxService
+
+	// txGate is the write gate, held shared by normal writes and exclusively by the open
+	// interactive transaction.
+	txGate writeGate
+	txLock sync.Mutex
+	tx     *txSession
+
+	cursors     sync.Map // map[uint64]*cursorSession
+	cursorSeq   uint64
+	cursorCount int32
 }
 
 // NewDatabase create a single database instance using config.
@@ -81,6 +103,19 @@ func NewDatabase(cfg *DBConfig, peers *proto.Peers, genesisBlock *types.Block) (
 		return
 	}
 
+	if cfg.TxTimeout <= 0 {
+		cfg.TxTimeout = DefaultTxTimeout
+	}
+	if cfg.TxMaxLifetime <= 0 {
+		cfg.TxMaxLifetime = DefaultTxMaxLifetime
+	}
+	if cfg.CursorTimeout <= 0 {
+		cfg.CursorTimeout = DefaultCursorTimeout
+	}
+	if cfg.SnapshotInterval == 0 {
+		cfg.SnapshotInterval = KayakSnapshotInterval
+	}
+
 	// init database
 	db = &Database{
 		cfg:            cfg,
@@ -105,16 +140,11 @@ func NewDatabase(cfg *DBConfig, peers *proto.Peers, genesisBlock *types.Block) (
 	}()
 
 	// init storage
-	storageFile := filepath.Join(cfg.DataDir, StorageFileName)
-	storageDSN, err := storage.NewDSN(storageFile)
+	storageDSN, err := buildStorageDSN(cfg.DataDir, cfg.EncryptionKey)
 	if err != nil {
 		return
 	}
 
-	if cfg.EncryptionKey != "" {
-		storageDSN.AddParam("_crypto_key", cfg.EncryptionKey)
-	}
-
 	// init chain
 	chainFile := filepath.Join(cfg.DataDir, SQLChainFileName)
 	if db.nodeID, err = kms.GetLocalNodeID(); err != nil {
@@ -126,6 +156,7 @@ func NewDatabase(cfg *DBConfig, peers *proto.Peers, genesisBlock *types.Block) (
 		DatabaseID:      cfg.DatabaseID,
 		ChainFilePrefix: chainFile,
 		DataFile:        storageDSN.Format(),
+		StorageEngine:   cfg.StorageEngine,
 		Genesis:         genesisBlock,
 		Peers:           peers,
 
@@ -133,6 +164,7 @@ func NewDatabase(cfg *DBConfig, peers *proto.Peers, genesisBlock *types.Block) (
 		// currently sqlchain package only use Server.ID as node id
 		MuxService: cfg.ChainMux,
 		Server:     db.nodeID,
+		NodeRoles:  cfg.NodeRoles,
 
 		// TODO(xq262144): currently using fixed period/resolution from sqlchain test case
 		Period:   60 * time.Second,
@@ -151,6 +183,9 @@ func NewDatabase(cfg *DBConfig, peers *proto.Peers, genesisBlock *types.Block) (
 		err = errors.Wrap(err, "init kayak log pool failed")
 		return
 	}
+	if s, serr := db.kayakWal.Snapshot(); serr == nil {
+		db.cleanSnapshots(s)
+	}
 
 	db.kayakConfig = &kt.RuntimeConfig{
 		Handler:          db,
@@ -160,10 +195,12 @@ func NewDatabase(cfg *DBConfig, peers *proto.Peers, genesisBlock *types.Block) (
 		CommitTimeout:    time.Second * 60,
 		Peers:            peers,
 		Wal:              db.kayakWal,
+		SnapshotInterval: cfg.SnapshotInterval,
 		NodeID:           db.nodeID,
 		InstanceID:       string(db.dbID),
 		ServiceName:      DBKayakRPCName,
 		MethodName:       DBKayakMethodName,
+		FetchMethodName:  DBKayakFetchMethodName,
 	}
 
 	// create kayak runtime
@@ -172,7 +209,7 @@ func NewDatabase(cfg *DBConfig, peers *proto.Peers, genesisBlock *types.Block) (
 	}
 
 	// register kayak runtime rpc
-	db.mux.register(db.dbID, db.kayakRuntime)
+	db.mux.register(db.dbID, db.kayakRuntime, db.chain)
 
 	// start kayak runtime
 	db.kayakRuntime.Start()
@@ -183,6 +220,17 @@ func NewDatabase(cfg *DBConfig, peers *proto.Peers, genesisBlock *types.Block) (
 	return
 }
 
+// buildStorageDSN returns the storage DSN of the database in dir.
+func buildStorageDSN(dir string, encryptionKey string) (dsn *storage.DSN, err error) {
+	if dsn, err = storage.NewDSN(filepath.Join(dir, StorageFileName)); err != nil {
+		return
+	}
+	if encryptionKey != "" {
+		dsn.AddParam("_crypto_key", encryptionKey)
+	}
+	return
+}
+
 // UpdatePeers defines peers update query interface.
 func (db *Database) UpdatePeers(peers *proto.Peers) (err error) {
 	if err = db.kayakRuntime.UpdatePeers(peers); err != nil {
@@ -199,8 +247,15 @@ func (db *Database) Query(request *types.Request) (response *types.Response, err
 	//	return
 	//}
 
+	if request.Header.InTx() {
+		return db.txQuery(request)
+	}
+
 	switch request.Header.QueryType {
 	case types.ReadQuery:
+		if request.Header.PageSize > 0 {
+			return db.cursorQuery(request)
+		}
 		return db.chain.Query(request)
 	case types.WriteQuery:
 		return db.writeQuery(request)
@@ -222,6 +277,14 @@ func (db *Database) Ack(ack *types.Ack) (err error) {
 
 // Shutdown stop database handles and stop service the database.
 func (db *Database) Shutdown() (err error) {
+	// release the open interactive transaction
+	db.txLock.Lock()
+	db.endTx()
+	db.txLock.Unlock()
+
+	// release the open cursors
+	db.closeAllCursors()
+
 	if db.kayakRuntime != nil {
 		// shutdown, stop kayak
 		if err = db.kayakRuntime.Shutdown(); err != nil {
@@ -272,6 +335,14 @@ func (db *Database) Destroy() (err error) {
 }
 
 func (db *Database) writeQuery(request *types.Request) (response *types.Response, err error) {
+	// wait for the open interactive transaction
+	db.txGate.acquireShared()
+	defer db.txGate.releaseShared()
+
+	return db.applyWrite(request)
+}
+
+func (db *Database) applyWrite(request *types.Request) (response *types.Response, err error) {
 	//ctx := context.Background()
 	//ctx, task := trace.NewTask(ctx, "writeQuery")
 	//defer task.End()
@@ -279,18 +350,15 @@ func (db *Database) writeQuery(request *types.Request) (response *types.Response
 
 	// check database size first, wal/kayak/chain database size is not included
 	if db.cfg.SpaceLimit > 0 {
-		path := filepath.Join(db.cfg.DataDir, StorageFileName)
-		var statInfo os.FileInfo
-		if statInfo, err = os.Stat(path); err != nil {
-			if !os.IsNotExist(err) {
-				return
-			}
-		} else {
-			if uint64(statInfo.Size()) > db.cfg.SpaceLimit {
-				// rejected
-				err = ErrSpaceLimitExceeded
-				return
-			}
+		var size int64
+		if size, err = db.chain.Storage().Size(); err != nil {
+			err = errors.Wrap(err, "get storage size failed")
+			return
+		}
+		if uint64(size) > db.cfg.SpaceLimit {
+			// rejected
+			err = ErrSpaceLimitExceeded
+			return
 		}
 	}
 
@@ -0,0 +1,179 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	kt "github.com/CovenantSQL/CovenantSQL/kayak/types"
+	kl "github.com/CovenantSQL/CovenantSQL/kayak/wal"
+	"github.com/CovenantSQL/CovenantSQL/storage"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Following contains online backup logic extracted from main database instance definition.
+//
+// A backup bundle has the same layout as the data dir of a database instance plus a manifest
+// file, it's restored by copying the bundle files to the data dir of the instance on a stopped
+// miner. The sql-chain in the bundle only retains the blocks committed to the storage, and the
+// kayak wal is copied after them, so the restored instance reloads the chain from the bundle
+// head and synchronizes the following blocks from its peers, instead of replaying from genesis.
+
+// Backup writes a consistent backup bundle of the database to a new dir.
+func (db *Database) Backup(dir string) (manifest *types.BackupManifest, err error) {
+	if _, err = os.Stat(dir); err == nil {
+		err = errors.Wrapf(ErrBackupPathExists, "backup to %s", dir)
+		return
+	} else if !os.IsNotExist(err) {
+		return
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	var (
+		dsn     *storage.DSN
+		walDB   *leveldb.DB
+		walFile = filepath.Join(dir, KayakWalFileName)
+		m       = &types.BackupManifest{
+			DatabaseID:    db.dbID,
+			NodeID:        db.nodeID,
+			StorageEngine: db.cfg.StorageEngine,
+		}
+		enc []byte
+	)
+
+	// backup storage and chain
+	if dsn, err = buildStorageDSN(dir, db.cfg.EncryptionKey); err != nil {
+		return
+	}
+	if m.Head, m.Height, err = db.chain.Backup(
+		dsn.Format(), filepath.Join(dir, SQLChainFileName)); err != nil {
+		err = errors.Wrap(err, "backup chain failed")
+		return
+	}
+
+	// backup kayak wal, the logs are at least as new as the chain
+	if walDB, err = db.kayakWal.GetDB(); err != nil {
+		return
+	}
+	if err = utils.CopyLevelDB(walDB, walFile); err != nil {
+		err = errors.Wrap(err, "backup kayak wal failed")
+		return
+	}
+	if m.KayakIndex, m.KayakCommit, err = readKayakPosition(walFile); err != nil {
+		return
+	}
+	if err = db.backupSnapshot(walFile, dir); err != nil {
+		return
+	}
+
+	// write manifest
+	m.Timestamp = getLocalTime()
+	if enc, err = json.MarshalIndent(m, "", "  "); err != nil {
+		return
+	}
+	if err = ioutil.WriteFile(
+		filepath.Join(dir, types.BackupManifestFileName), enc, 0644); err != nil {
+		return
+	}
+
+	manifest = m
+	return
+}
+
+// backupSnapshot copies the snapshot file referenced by the kayak wal snapshot to dir, which is
+// served to the lagging followers. The file may be replaced by a new snapshot meanwhile, and the
+// restored instance serves a new one after its next wal compaction.
+func (db *Database) backupSnapshot(walFile, dir string) (err error) {
+	var (
+		wal *kl.LevelDBWal
+		s   *kt.Snapshot
+		src string
+	)
+	if wal, err = kl.NewLevelDBWal(walFile); err != nil {
+		return
+	}
+	defer wal.Close()
+	if s, err = wal.Snapshot(); err != nil {
+		err = errors.Wrap(err, "read kayak wal snapshot failed")
+		return
+	} else if s == nil {
+		return
+	}
+	if src, err = db.snapshotFile(s.Data); err != nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Join(dir, SnapshotDirName), 0755); err != nil {
+		return
+	}
+	if _, err = utils.CopyFile(
+		src, filepath.Join(dir, SnapshotDirName, filepath.Base(src))); os.IsNotExist(err) {
+		log.WithField("file", src).Warning("kayak snapshot is replaced during backup")
+		err = nil
+	} else if err != nil {
+		err = errors.Wrap(err, "backup kayak snapshot failed")
+	}
+	return
+}
+
+// readKayakPosition returns the last log index and the last commit log index of the kayak wal.
+func readKayakPosition(filename string) (index uint64, commit uint64, err error) {
+	var (
+		wal *kl.LevelDBWal
+		s   *kt.Snapshot
+		l   *kt.Log
+	)
+	if wal, err = kl.NewLevelDBWal(filename); err != nil {
+		return
+	}
+	defer wal.Close()
+	if s, err = wal.Snapshot(); err != nil {
+		err = errors.Wrap(err, "read kayak wal snapshot failed")
+		return
+	} else if s != nil {
+		index, commit = s.Index, s.Index
+	}
+	for {
+		if l, err = wal.Read(); err == io.EOF {
+			err = nil
+			return
+		} else if err != nil {
+			err = errors.Wrap(err, "read kayak wal failed")
+			return
+		}
+		if l.Index > index {
+			index = l.Index
+		}
+		if l.Type == kt.LogCommit && l.Index > commit {
+			commit = l.Index
+		}
+	}
+}
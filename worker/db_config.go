@@ -21,6 +21,7 @@ import (
 
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/sqlchain"
+	"github.com/CovenantSQL/CovenantSQL/types"
 )
 
 // DBConfig defines the database config.
@@ -32,4 +33,13 @@ type DBConfig struct {
 	MaxWriteTimeGap time.Duration
 	EncryptionKey   string
 	SpaceLimit      uint64
+	StorageEngine   types.StorageEngine
+	TxTimeout       time.Duration
+	TxMaxLifetime   time.Duration
+	CursorTimeout   time.Duration
+	// SnapshotInterval defines the minimum kayak log count between wal snapshots, 0 for the
+	// default KayakSnapshotInterval.
+	SnapshotInterval uint64
+	// NodeRoles resolves the roles of non-peer nodes in the database, e.g. the observers.
+	NodeRoles func(nodeID proto.NodeID) proto.ServerRoles
 }
@@ -0,0 +1,238 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	x "github.com/CovenantSQL/CovenantSQL/xenomint"
+	"github.com/pkg/errors"
+)
+
+// Following contains query result cursor logic extracted from main database instance definition.
+//
+// A paged read query returns the first page in the query response with an open cursor, the
+// remaining rows are fetched page by page by the requesting node. Each page is signed and
+// chained to the previous page, the first fetched page is chained to the query response.
+
+// cursorSession tracks an open query result cursor of the database.
+type cursorSession struct {
+	sync.Mutex
+	id       uint64
+	nodeID   proto.NodeID
+	cursor   *x.Cursor
+	pageSize int
+	request  hash.Hash   // request is the hash of original request header
+	parent   hash.Hash   // parent is the hash of last response or page header
+	pageNo   uint64      // pageNo is the last page sent
+	last     *types.Page // last is kept for retransmission
+	timer    *time.Timer
+}
+
+func (db *Database) cursorQuery(request *types.Request) (response *types.Response, err error) {
+	if !db.reserveCursor() {
+		err = errors.Wrapf(ErrTooManyCursors, "%d cursors open", MaxOpenCursors)
+		return
+	}
+
+	var opened bool
+	defer func() {
+		if !opened {
+			atomic.AddInt32(&db.cursorCount, -1)
+		}
+	}()
+
+	var (
+		id       = atomic.AddUint64(&db.cursorSeq, 1)
+		pageSize = request.Header.PageSize
+		cursor   *x.Cursor
+	)
+	if pageSize > MaxPageSize {
+		pageSize = MaxPageSize
+	}
+	if cursor, response, err = db.chain.QueryCursor(request, int(pageSize), id); err != nil {
+		return
+	}
+	if cursor == nil {
+		// whole result is returned in the first page
+		return
+	}
+
+	sess := &cursorSession{
+		id:       id,
+		nodeID:   request.Header.NodeID,
+		cursor:   cursor,
+		pageSize: int(pageSize),
+		request:  request.Header.Hash(),
+		parent:   response.Header.Hash(),
+	}
+	sess.timer = time.AfterFunc(db.cfg.CursorTimeout, func() {
+		db.closeCursor(id)
+	})
+	opened = true
+	db.cursors.Store(id, sess)
+
+	return
+}
+
+// reserveCursor reserves a slot of the open cursors, it returns false if the limit is reached.
+func (db *Database) reserveCursor() bool {
+	for {
+		count := atomic.LoadInt32(&db.cursorCount)
+		if count >= MaxOpenCursors {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&db.cursorCount, count, count+1) {
+			return true
+		}
+	}
+}
+
+// FetchCursor returns the next page of the open cursor requested by req.
+func (db *Database) FetchCursor(req *types.CursorRequest) (page *types.Page, err error) {
+	if err = req.Verify(); err != nil {
+		return
+	}
+
+	var sess *cursorSession
+	if sess, err = db.getCursor(req); err != nil {
+		return
+	}
+
+	sess.Lock()
+	defer sess.Unlock()
+
+	if sess.last != nil && req.Header.PageNo == sess.pageNo {
+		// retransmit the lost page
+		return sess.last, nil
+	}
+	if sess.cursor == nil || req.Header.PageNo != sess.pageNo+1 {
+		err = errors.Wrapf(ErrInvalidRequest, "unexpected page %d, last sent page %d",
+			req.Header.PageNo, sess.pageNo)
+		return
+	}
+
+	// renew cursor timeout on every fetch
+	sess.timer.Reset(db.cfg.CursorTimeout)
+
+	var (
+		rows []types.ResponseRow
+		done bool
+	)
+	if rows, done, err = sess.cursor.Next(req.GetContext(), sess.pageSize); err != nil {
+		// the cursor is no longer usable
+		db.cursors.Delete(sess.id)
+		sess.release(db)
+		return
+	}
+
+	page = &types.Page{
+		Header: types.SignedPageHeader{
+			PageHeader: types.PageHeader{
+				RequestHash: sess.request,
+				ParentHash:  sess.parent,
+				NodeID:      db.nodeID,
+				CursorID:    sess.id,
+				PageNo:      req.Header.PageNo,
+				Timestamp:   getLocalTime(),
+				Done:        done,
+			},
+		},
+		Payload: types.ResponsePayload{
+			Rows: rows,
+		},
+	}
+	if err = db.chain.SignPage(page); err != nil {
+		return
+	}
+
+	sess.parent = page.Header.Hash()
+	sess.pageNo = page.Header.PageNo
+	sess.last = page
+
+	if done {
+		// release the underlying read transaction as early as possible, the session is kept
+		// for retransmission until closed by client or timeout
+		sess.cursor.Close()
+		sess.cursor = nil
+	}
+
+	return
+}
+
+// CloseCursor closes the open cursor requested by req.
+func (db *Database) CloseCursor(req *types.CursorRequest) (err error) {
+	if err = req.Verify(); err != nil {
+		return
+	}
+
+	var sess *cursorSession
+	if sess, err = db.getCursor(req); err != nil {
+		return
+	}
+
+	db.closeCursor(sess.id)
+	return
+}
+
+func (db *Database) getCursor(req *types.CursorRequest) (sess *cursorSession, err error) {
+	if rawSess, ok := db.cursors.Load(req.Header.CursorID); ok {
+		sess = rawSess.(*cursorSession)
+	}
+	if sess == nil || sess.nodeID != req.Header.NodeID {
+		err = errors.Wrapf(ErrCursorNotFound, "cursor %d of %s", req.Header.CursorID, req.Header.NodeID)
+		sess = nil
+	}
+	return
+}
+
+func (db *Database) closeCursor(id uint64) {
+	if rawSess, ok := db.cursors.Load(id); ok {
+		db.cursors.Delete(id)
+		sess := rawSess.(*cursorSession)
+		sess.Lock()
+		defer sess.Unlock()
+		sess.release(db)
+	}
+}
+
+func (db *Database) closeAllCursors() {
+	db.cursors.Range(func(rawID, _ interface{}) bool {
+		db.closeCursor(rawID.(uint64))
+		return true
+	})
+}
+
+// release closes the underlying cursor, should be called with session lock held.
+func (sess *cursorSession) release(db *Database) {
+	if sess.timer == nil {
+		// already released
+		return
+	}
+	sess.timer.Stop()
+	sess.timer = nil
+	if sess.cursor != nil {
+		sess.cursor.Close()
+		sess.cursor = nil
+	}
+	atomic.AddInt32(&db.cursorCount, -1)
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReserveCursor(t *testing.T) {
+	Convey("The concurrent cursor reservations should not exceed the limit", t, func() {
+		var (
+			db       = &Database{}
+			wg       sync.WaitGroup
+			reserved int32
+		)
+		for i := 0; i < MaxOpenCursors*4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if db.reserveCursor() {
+					atomic.AddInt32(&reserved, 1)
+				}
+			}()
+		}
+		wg.Wait()
+		So(reserved, ShouldEqual, MaxOpenCursors)
+		So(db.cursorCount, ShouldEqual, MaxOpenCursors)
+		So(db.reserveCursor(), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,342 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	kt "github.com/CovenantSQL/CovenantSQL/kayak/types"
+	"github.com/CovenantSQL/CovenantSQL/storage"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	x "github.com/CovenantSQL/CovenantSQL/xenomint"
+	"github.com/pkg/errors"
+)
+
+// Following contains kayak snapshot logic extracted from main database instance definition.
+//
+// A kayak snapshot is a file in the snapshot dir of the database instance, which is referenced
+// by its file name in the kayak wal. The file is the storage image copied by an online backup,
+// followed by the msgpack encoded dbSnapshot and the 8 bytes big-endian length of it.
+
+// dbSnapshot defines the trailer of the kayak snapshot file of the database, the storage image
+// with the uncommitted writes following it is the whole applied state.
+type dbSnapshot struct {
+	ID      uint64
+	Queries []*dbSnapshotQuery
+}
+
+type dbSnapshotQuery struct {
+	Request  *types.Request
+	Response *types.Response
+}
+
+// snapshotDir returns the dir of the kayak snapshot files.
+func (db *Database) snapshotDir() string {
+	return filepath.Join(db.cfg.DataDir, SnapshotDirName)
+}
+
+// snapshotFile returns the snapshot file path referenced by data.
+func (db *Database) snapshotFile(data []byte) (fl string, err error) {
+	var name = string(data)
+	if name == "" || filepath.Base(name) != name {
+		err = errors.Wrapf(ErrInvalidSnapshot, "invalid snapshot file name %s", name)
+		return
+	}
+	fl = filepath.Join(db.snapshotDir(), name)
+	return
+}
+
+// createSnapshotFile creates a new empty snapshot file and returns its path.
+func (db *Database) createSnapshotFile() (fl string, err error) {
+	var f *os.File
+	if err = os.MkdirAll(db.snapshotDir(), 0755); err != nil {
+		return
+	}
+	if f, err = ioutil.TempFile(db.snapshotDir(), "snapshot-"); err != nil {
+		err = errors.Wrap(err, "create snapshot file failed")
+		return
+	}
+	fl = f.Name()
+	f.Close()
+	return
+}
+
+// Snapshot implements kayak.types.Snapshotter.Snapshot. It returns once the storage image is
+// pinned, the image is copied to the snapshot file by write.
+func (db *Database) Snapshot() (write func() ([]byte, error), err error) {
+	var (
+		fl     string
+		dsn    *storage.DSN
+		pinned = make(chan *dbSnapshot, 1)
+		done   = make(chan error, 1)
+		s      *dbSnapshot
+	)
+
+	if fl, err = db.createSnapshotFile(); err != nil {
+		return
+	}
+	if dsn, err = buildStorageDSN(db.snapshotDir(), db.cfg.EncryptionKey); err != nil {
+		os.Remove(fl)
+		return
+	}
+	dsn.SetFileName(fl)
+
+	go func() {
+		done <- db.chain.Snapshot(dsn.Format(), func(id uint64, queries []*x.QueryTracker) {
+			ps := &dbSnapshot{
+				ID:      id,
+				Queries: make([]*dbSnapshotQuery, len(queries)),
+			}
+			for i, q := range queries {
+				q.RLock()
+				ps.Queries[i] = &dbSnapshotQuery{Request: q.Req, Response: q.Resp}
+				q.RUnlock()
+			}
+			pinned <- ps
+		})
+	}()
+
+	select {
+	case s = <-pinned:
+	case err = <-done:
+		if err != nil {
+			os.Remove(fl)
+			err = errors.Wrap(err, "snapshot chain state failed")
+			return
+		}
+		// pinned and copied at once
+		s = <-pinned
+		done <- nil
+	}
+
+	write = func() (data []byte, err error) {
+		defer func() {
+			if err != nil {
+				os.Remove(fl)
+			}
+		}()
+		if err = <-done; err != nil {
+			err = errors.Wrap(err, "snapshot chain state failed")
+			return
+		}
+		if err = writeSnapshotTrailer(fl, s); err != nil {
+			return
+		}
+		data = []byte(filepath.Base(fl))
+		return
+	}
+	return
+}
+
+// ReadSnapshot implements kayak.types.Snapshotter.ReadSnapshot.
+func (db *Database) ReadSnapshot(data []byte, p []byte, off int64) (n int, err error) {
+	var (
+		fl string
+		f  *os.File
+	)
+	if fl, err = db.snapshotFile(data); err != nil {
+		return
+	}
+	if f, err = os.Open(fl); err != nil {
+		err = errors.Wrap(err, "open snapshot file failed")
+		return
+	}
+	defer f.Close()
+	return f.ReadAt(p, off)
+}
+
+// WriteSnapshot implements kayak.types.Snapshotter.WriteSnapshot, it saves the snapshot of leader
+// read from r as a local snapshot file.
+func (db *Database) WriteSnapshot(r io.Reader) (data []byte, err error) {
+	var (
+		fl string
+		f  *os.File
+	)
+	if fl, err = db.createSnapshotFile(); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(fl)
+		}
+	}()
+	if f, err = os.OpenFile(fl, os.O_WRONLY, 0644); err != nil {
+		err = errors.Wrap(err, "open snapshot file failed")
+		return
+	}
+	if _, err = io.Copy(f, r); err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err != nil {
+		err = errors.Wrap(err, "write snapshot file failed")
+		return
+	}
+	// validate the trailer
+	if f, _, _, err = readSnapshotFile(fl); err != nil {
+		return
+	}
+	f.Close()
+	data = []byte(filepath.Base(fl))
+	return
+}
+
+// Restore implements kayak.types.Snapshotter.Restore, it replaces the storage by the snapshot
+// of leader on a lagging follower.
+func (db *Database) Restore(data []byte) (err error) {
+	var (
+		fl   string
+		f    *os.File
+		s    *dbSnapshot
+		size int64
+	)
+	if fl, err = db.snapshotFile(data); err != nil {
+		return
+	}
+	if f, s, size, err = readSnapshotFile(fl); err != nil {
+		return
+	}
+	defer f.Close()
+
+	queries := make([]*x.QueryTracker, len(s.Queries))
+	for i, q := range s.Queries {
+		queries[i] = &x.QueryTracker{Req: q.Request, Resp: q.Response}
+	}
+
+	// the open cursors are reading the replaced storage
+	db.closeAllCursors()
+
+	if err = db.chain.Restore(io.NewSectionReader(f, 0, size), s.ID, queries); err != nil {
+		err = errors.Wrap(err, "restore chain state failed")
+	}
+	return
+}
+
+// DropSnapshot implements kayak.types.Snapshotter.DropSnapshot.
+func (db *Database) DropSnapshot(data []byte) (err error) {
+	var fl string
+	if fl, err = db.snapshotFile(data); err != nil {
+		return
+	}
+	if err = os.Remove(fl); err != nil && !os.IsNotExist(err) {
+		err = errors.Wrap(err, "remove snapshot file failed")
+		return
+	}
+	return nil
+}
+
+// cleanSnapshots removes the snapshot files left by interrupted snapshots, which are not
+// referenced by the kayak wal snapshot s.
+func (db *Database) cleanSnapshots(s *kt.Snapshot) {
+	var (
+		infos []os.FileInfo
+		keep  string
+		err   error
+	)
+	if infos, err = ioutil.ReadDir(db.snapshotDir()); err != nil {
+		return
+	}
+	if s != nil {
+		keep = string(s.Data)
+	}
+	for _, info := range infos {
+		if info.Name() == keep {
+			continue
+		}
+		if err = os.Remove(filepath.Join(db.snapshotDir(), info.Name())); err != nil {
+			log.WithError(err).WithField("file", info.Name()).Warning("remove snapshot file failed")
+		}
+	}
+}
+
+// writeSnapshotTrailer appends the trailer s to the storage image in snapshot file fl.
+func writeSnapshotTrailer(fl string, s *dbSnapshot) (err error) {
+	var (
+		enc *bytes.Buffer
+		f   *os.File
+		l   = make([]byte, 8)
+	)
+	if enc, err = utils.EncodeMsgPack(s); err != nil {
+		err = errors.Wrap(err, "encode snapshot failed")
+		return
+	}
+	binary.BigEndian.PutUint64(l, uint64(enc.Len()))
+	if f, err = os.OpenFile(fl, os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		err = errors.Wrap(err, "open snapshot file failed")
+		return
+	}
+	defer f.Close()
+	if _, err = f.Write(append(enc.Bytes(), l...)); err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		err = errors.Wrap(err, "write snapshot file failed")
+	}
+	return
+}
+
+// readSnapshotFile opens the snapshot file fl and returns the opened file with its trailer and
+// the size of the storage image.
+func readSnapshotFile(fl string) (f *os.File, s *dbSnapshot, size int64, err error) {
+	var (
+		info os.FileInfo
+		l    = make([]byte, 8)
+		n    uint64
+		enc  []byte
+	)
+	if f, err = os.Open(fl); err != nil {
+		err = errors.Wrap(err, "open snapshot file failed")
+		return
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			f = nil
+		}
+	}()
+	if info, err = f.Stat(); err != nil {
+		return
+	}
+	if size = info.Size() - int64(len(l)); size < 0 {
+		err = errors.Wrap(ErrInvalidSnapshot, "snapshot file is truncated")
+		return
+	}
+	if _, err = f.ReadAt(l, size); err != nil {
+		return
+	}
+	if n = binary.BigEndian.Uint64(l); n > uint64(size) {
+		err = errors.Wrap(ErrInvalidSnapshot, "snapshot file is truncated")
+		return
+	}
+	size -= int64(n)
+	enc = make([]byte, n)
+	if _, err = f.ReadAt(enc, size); err != nil {
+		return
+	}
+	if err = utils.DecodeMsgPack(enc, &s); err != nil {
+		err = errors.Wrapf(ErrInvalidSnapshot, "decode snapshot failed: %v", err)
+		return
+	}
+	return
+}
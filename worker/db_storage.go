@@ -107,6 +107,12 @@ func (db *Database) Commit(rawReq interface{}) (result interface{}, err error) {
 	return db.chain.Query(req)
 }
 
+// Durable implements kayak.types.DurableSnapshotter.Durable, the storage and the sql-chain
+// survive restarts by themselves.
+func (db *Database) Durable() bool {
+	return true
+}
+
 func (db *Database) recordSequence(connID uint64, seqNo uint64) {
 	db.connSeqs.Store(connID, seqNo)
 }
@@ -19,6 +19,7 @@ package worker
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
@@ -30,11 +31,16 @@ import (
 	"testing"
 	"time"
 
+	bp "github.com/CovenantSQL/CovenantSQL/blockproducer"
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
 	"github.com/CovenantSQL/CovenantSQL/conf"
 	"github.com/CovenantSQL/CovenantSQL/consistent"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	kt "github.com/CovenantSQL/CovenantSQL/kayak/types"
 	"github.com/CovenantSQL/CovenantSQL/pow/cpuminer"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/route"
@@ -44,12 +50,21 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/utils"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 	"github.com/fortytw2/leaktest"
+	"github.com/pkg/errors"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
-var rootHash = hash.Hash{}
+var (
+	rootHash = hash.Hash{}
+)
+
+const (
+	PubKeyStorePath = "./public.keystore"
 
-const PubKeyStorePath = "./public.keystore"
+	testInitBalance uint64 = 10000000
+	testChainPeriod        = time.Second
+	testChainTick          = 100 * time.Millisecond
+)
 
 func TestSingleDatabase(t *testing.T) {
 	log.SetLevel(log.DebugLevel)
@@ -254,6 +269,73 @@ func TestSingleDatabase(t *testing.T) {
 			So(err, ShouldBeNil)
 		})
 
+		Convey("test paged read", func() {
+			var writeQuery *types.Request
+			var res *types.Response
+			writeQuery, err = buildQuery(types.WriteQuery, 1, 1, []string{
+				"create table test (test int)",
+				"insert into test values(1)",
+				"insert into test values(2)",
+				"insert into test values(3)",
+			})
+			So(err, ShouldBeNil)
+			res, err = db.Query(writeQuery)
+			So(err, ShouldBeNil)
+
+			var readQuery *types.Request
+			readQuery, err = buildQuery(types.ReadQuery, 1, 2, []string{
+				"select * from test",
+			})
+			So(err, ShouldBeNil)
+			privateKey, _, err := getKeys()
+			So(err, ShouldBeNil)
+			readQuery.Header.PageSize = 2
+			err = readQuery.Sign(privateKey)
+			So(err, ShouldBeNil)
+
+			res, err = db.Query(readQuery)
+			So(err, ShouldBeNil)
+			err = res.Verify()
+			So(err, ShouldBeNil)
+			So(res.Header.RowCount, ShouldEqual, uint64(2))
+			So(res.Header.CursorID, ShouldNotEqual, 0)
+
+			fetch := &types.CursorRequest{
+				Header: types.SignedCursorRequestHeader{
+					CursorRequestHeader: types.CursorRequestHeader{
+						NodeID:    readQuery.Header.NodeID,
+						CursorID:  res.Header.CursorID,
+						PageNo:    1,
+						Timestamp: getLocalTime(),
+					},
+				},
+			}
+			err = fetch.Sign(privateKey)
+			So(err, ShouldBeNil)
+			page, err := db.FetchCursor(fetch)
+			So(err, ShouldBeNil)
+			err = page.Verify()
+			So(err, ShouldBeNil)
+			err = page.VerifyChain(readQuery.Header.Hash(), res.Header.Hash(), res.Header.CursorID, 1)
+			So(err, ShouldBeNil)
+			So(page.Header.Done, ShouldBeTrue)
+			So(page.Payload.Rows, ShouldHaveLength, 1)
+			So(page.Payload.Rows[0].Values[0], ShouldEqual, 3)
+
+			// fetch the same page again
+			page2, err := db.FetchCursor(fetch)
+			So(err, ShouldBeNil)
+			So(page2, ShouldEqual, page)
+
+			err = db.CloseCursor(fetch)
+			So(err, ShouldBeNil)
+			_, err = db.FetchCursor(fetch)
+			So(errors.Cause(err), ShouldEqual, ErrCursorNotFound)
+
+			err = db.Shutdown()
+			So(err, ShouldBeNil)
+		})
+
 		Convey("test invalid request", func() {
 			var writeQuery *types.Request
 			var res *types.Response
@@ -552,6 +634,176 @@ func TestDatabaseRecycle(t *testing.T) {
 	})
 }
 
+func TestDatabaseCatchUp(t *testing.T) {
+	Convey("test lagging follower catch-up by leader snapshot", t, func() {
+		var err error
+		var server *rpc.Server
+		var cleanup func()
+		cleanup, server, err = initNode()
+		So(err, ShouldBeNil)
+
+		var leaderDir, followerDir string
+		leaderDir, err = ioutil.TempDir("", "db_test_")
+		So(err, ShouldBeNil)
+		followerDir, err = ioutil.TempDir("", "db_test_")
+		So(err, ShouldBeNil)
+
+		kayakMuxService, err := NewDBKayakMuxService("DBKayak", server)
+		So(err, ShouldBeNil)
+		chainMuxService, err := sqlchain.NewMuxService("sqlchain", server)
+		So(err, ShouldBeNil)
+
+		var peers *proto.Peers
+		peers, err = getPeers(1)
+		So(err, ShouldBeNil)
+
+		newDatabase := func(dbID proto.DatabaseID, dir string) (db *Database) {
+			block, err := createRandomBlock(rootHash, true)
+			So(err, ShouldBeNil)
+			db, err = NewDatabase(&DBConfig{
+				DatabaseID:       dbID,
+				DataDir:          dir,
+				KayakMux:         kayakMuxService,
+				ChainMux:         chainMuxService,
+				MaxWriteTimeGap:  time.Second * 5,
+				SnapshotInterval: 5,
+			}, peers, block)
+			So(err, ShouldBeNil)
+			return
+		}
+		count := func(db *Database, seqNo uint64) (n int64) {
+			readQuery, err := buildQuery(types.ReadQuery, 2, seqNo, []string{
+				"select count(1) from test",
+			})
+			So(err, ShouldBeNil)
+			res, err := db.Query(readQuery)
+			So(err, ShouldBeNil)
+			So(res.Payload.Rows, ShouldHaveLength, 1)
+			n, _ = res.Payload.Rows[0].Values[0].(int64)
+			return
+		}
+
+		leader := newDatabase("TEST", leaderDir)
+		follower := newDatabase("TEST-FOLLOWER", followerDir)
+
+		Reset(func() {
+			leader.Shutdown()
+			follower.Shutdown()
+			os.RemoveAll(leaderDir)
+			os.RemoveAll(followerDir)
+			cleanup()
+		})
+
+		// the follower misses all the writes, which are compacted by leader
+		var seqNo uint64 = 1
+		writeQuery, err := buildQuery(types.WriteQuery, 1, seqNo, []string{
+			"create table test (test int)",
+		})
+		So(err, ShouldBeNil)
+		_, err = leader.Query(writeQuery)
+		So(err, ShouldBeNil)
+		for i := 0; i < 20; i++ {
+			seqNo++
+			writeQuery, err = buildQuery(types.WriteQuery, 1, seqNo, []string{
+				fmt.Sprintf("insert into test values(%d)", i),
+			})
+			So(err, ShouldBeNil)
+			_, err = leader.Query(writeQuery)
+			So(err, ShouldBeNil)
+		}
+		So(count(leader, 1), ShouldEqual, 20)
+
+		nodeID, err := kms.GetLocalNodeID()
+		So(err, ShouldBeNil)
+		fetch := func(from uint64) (resp *kt.FetchResponse) {
+			resp = &kt.FetchResponse{}
+			err := kayakMuxService.Fetch(&kt.FetchRequest{
+				Envelope: proto.Envelope{NodeID: nodeID.ToRawNodeID()},
+				Instance: string(leader.dbID),
+				From:     from,
+			}, resp)
+			So(err, ShouldBeNil)
+			return
+		}
+		fetchSnapshot := func(index uint64) (data []byte) {
+			// the snapshot file is fetched by chunks until an empty one
+			var buf bytes.Buffer
+			for {
+				resp := &kt.FetchResponse{}
+				err := kayakMuxService.Fetch(&kt.FetchRequest{
+					Envelope:       proto.Envelope{NodeID: nodeID.ToRawNodeID()},
+					Instance:       string(leader.dbID),
+					SnapshotIndex:  index,
+					SnapshotOffset: int64(buf.Len()),
+				}, resp)
+				So(err, ShouldBeNil)
+				if len(resp.Chunk) == 0 {
+					break
+				}
+				buf.Write(resp.Chunk)
+			}
+			data, err := follower.WriteSnapshot(&buf)
+			So(err, ShouldBeNil)
+			return
+		}
+		apply := func(resp *kt.FetchResponse) (last uint64) {
+			if resp.Snapshot != nil {
+				So(resp.Snapshot.Data, ShouldBeNil)
+				err := follower.Restore(fetchSnapshot(resp.Snapshot.Index))
+				So(err, ShouldBeNil)
+				last = resp.Snapshot.Index
+			}
+			prepares := make(map[uint64]*kt.Log)
+			for _, l := range resp.Logs {
+				switch l.Type {
+				case kt.LogPrepare:
+					prepares[l.Index] = l
+				case kt.LogCommit:
+					pl := prepares[binary.BigEndian.Uint64(l.Data)]
+					So(pl, ShouldNotBeNil)
+					req, err := follower.DecodePayload(pl.Data)
+					So(err, ShouldBeNil)
+					_, err = follower.Commit(req)
+					So(err, ShouldBeNil)
+				}
+				last = l.Index
+			}
+			return
+		}
+
+		// the snapshot is written asynchronously
+		resp := fetch(1)
+		for i := 0; i < 100 && resp.Snapshot == nil; i++ {
+			time.Sleep(10 * time.Millisecond)
+			resp = fetch(1)
+		}
+		So(resp.Snapshot, ShouldNotBeNil)
+		last := apply(resp)
+		So(count(follower, 1), ShouldEqual, 20)
+
+		// the following logs are applied on the restored state
+		seqNo++
+		writeQuery, err = buildQuery(types.WriteQuery, 1, seqNo, []string{
+			"insert into test values(20)",
+		})
+		So(err, ShouldBeNil)
+		_, err = leader.Query(writeQuery)
+		So(err, ShouldBeNil)
+		resp = fetch(last + 1)
+		So(resp.Snapshot, ShouldBeNil)
+		So(resp.Logs, ShouldNotBeEmpty)
+		apply(resp)
+		So(count(follower, 2), ShouldEqual, 21)
+		So(count(leader, 2), ShouldEqual, 21)
+
+		// the durable state is not restored again on restart
+		err = leader.Shutdown()
+		So(err, ShouldBeNil)
+		leader = newDatabase("TEST", leaderDir)
+		So(count(leader, 3), ShouldEqual, 21)
+	})
+}
+
 func buildAck(res *types.Response) (ack *types.Ack, err error) {
 	// get node id
 	var nodeID proto.NodeID
@@ -727,10 +979,17 @@ func initNode() (cleanupFunc func(), server *rpc.Server, err error) {
 		return
 	}
 
+	// start main chain
+	var chain *bp.Chain
+	if chain, err = startTestChain(server, d); err != nil {
+		return
+	}
+
 	// start server
 	go server.Serve()
 
 	cleanupFunc = func() {
+		chain.Stop()
 		os.RemoveAll(d)
 		server.Listener.Close()
 		server.Stop()
@@ -741,6 +1000,173 @@ func initNode() (cleanupFunc func(), server *rpc.Server, err error) {
 	return
 }
 
+// stubDatabaseProvider allocates the local node for the databases created on the test chain, the
+// test cases deploy the databases by themselves.
+type stubDatabaseProvider struct{}
+
+func (p *stubDatabaseProvider) AllocateMiners(
+	dbID proto.DatabaseID, meta *pt.ResourceMeta) (nodes []proto.NodeID, err error,
+) {
+	var nodeID proto.NodeID
+	if nodeID, err = kms.GetLocalNodeID(); err != nil {
+		return
+	}
+	nodes = []proto.NodeID{nodeID}
+	return
+}
+
+func (p *stubDatabaseProvider) DeployDatabase(profile *pt.SQLChainProfile) error {
+	return nil
+}
+
+func (p *stubDatabaseProvider) UndeployDatabase(profile *pt.SQLChainProfile) error {
+	return nil
+}
+
+// startTestChain starts a single block producer main chain with the local account as the base
+// account.
+func startTestChain(server *rpc.Server, dir string) (chain *bp.Chain, err error) {
+	var (
+		privKey *asymmetric.PrivateKey
+		pubKey  *asymmetric.PublicKey
+		nodeID  proto.NodeID
+		addr    proto.AccountAddress
+	)
+	if privKey, pubKey, err = getKeys(); err != nil {
+		return
+	}
+	if nodeID, err = kms.GetLocalNodeID(); err != nil {
+		return
+	}
+	if addr, err = crypto.PubKeyHash(pubKey); err != nil {
+		return
+	}
+
+	ba := pt.NewBaseAccount(&pt.Account{
+		Address:             addr,
+		StableCoinBalance:   testInitBalance,
+		CovenantCoinBalance: testInitBalance,
+	})
+	if err = ba.Sign(privKey); err != nil {
+		return
+	}
+	genesis := &pt.Block{
+		SignedHeader: pt.SignedHeader{
+			Header: pt.Header{
+				Version:   0x01000000,
+				Producer:  addr,
+				Timestamp: time.Now().UTC(),
+			},
+		},
+		Transactions: []pi.Transaction{ba},
+	}
+	if err = genesis.PackAndSignBlock(privKey); err != nil {
+		return
+	}
+
+	var peers *proto.Peers
+	if peers, err = getPeers(1); err != nil {
+		return
+	}
+
+	cfg := bp.NewConfig(genesis, filepath.Join(dir, "chain.db"), server, peers, nodeID,
+		testChainPeriod, testChainTick)
+	cfg.Provider = &stubDatabaseProvider{}
+	if chain, err = bp.NewChain(cfg); err != nil {
+		return
+	}
+	if err = chain.Start(); err != nil {
+		chain.Stop()
+		chain = nil
+	}
+	return
+}
+
+// createTestDatabase creates a database owned by the local account on the test chain, and waits
+// until the database profile is available.
+func createTestDatabase() (dbID proto.DatabaseID, err error) {
+	var tx *pt.CreateDatabase
+	if err = sendTestTx(func(addr proto.AccountAddress, nonce pi.AccountNonce) pi.Transaction {
+		tx = pt.NewCreateDatabase(&pt.CreateDatabaseHeader{
+			Owner:          addr,
+			ResourceMeta:   pt.ResourceMeta{Node: 1},
+			GasPrice:       1,
+			AdvancePayment: testInitBalance / 10,
+			Nonce:          nonce,
+		})
+		return tx
+	}); err != nil {
+		return
+	}
+	if dbID, err = tx.DatabaseID(); err != nil {
+		return
+	}
+	err = waitTestProfile(dbID, func(*pt.SQLChainProfile) bool { return true })
+	return
+}
+
+// addTestDatabaseUser adds user with permission perm to the database on the test chain, and
+// waits until the user is in the database profile.
+func addTestDatabaseUser(dbID proto.DatabaseID, user proto.AccountAddress, perm pt.UserPermission) (err error) {
+	if err = sendTestTx(func(addr proto.AccountAddress, nonce pi.AccountNonce) pi.Transaction {
+		return pt.NewAddDatabaseUser(&pt.AddDatabaseUserHeader{
+			Advocate:       addr,
+			TargetSQLChain: dbID,
+			TargetUser:     user,
+			Permission:     perm,
+			Nonce:          nonce,
+		})
+	}); err != nil {
+		return
+	}
+	return waitTestProfile(dbID, func(profile *pt.SQLChainProfile) bool {
+		for _, u := range profile.Users {
+			if u != nil && u.Address == user {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func sendTestTx(build func(proto.AccountAddress, pi.AccountNonce) pi.Transaction) (err error) {
+	var (
+		privKey *asymmetric.PrivateKey
+		pubKey  *asymmetric.PublicKey
+		addr    proto.AccountAddress
+	)
+	if privKey, pubKey, err = getKeys(); err != nil {
+		return
+	}
+	if addr, err = crypto.PubKeyHash(pubKey); err != nil {
+		return
+	}
+
+	nonceResp := new(types.NextAccountNonceResp)
+	if err = testRequest(route.MCCNextAccountNonce, &types.NextAccountNonceReq{Addr: addr}, nonceResp); err != nil {
+		return
+	}
+	req := &types.AddTxReq{Tx: build(addr, nonceResp.Nonce)}
+	if err = req.Tx.Sign(privKey); err != nil {
+		return
+	}
+	return testRequest(route.MCCAddTx, req, new(types.AddTxResp))
+}
+
+func waitTestProfile(dbID proto.DatabaseID, ready func(*pt.SQLChainProfile) bool) (err error) {
+	for i := 0; i < 30; i++ {
+		res := new(types.QuerySQLChainProfileResp)
+		if err = testRequest(route.MCCQuerySQLChainProfile, &types.QuerySQLChainProfileReq{DBID: dbID}, res); err != nil {
+			return
+		}
+		if res.OK && ready(&res.Profile) {
+			return
+		}
+		time.Sleep(testChainPeriod)
+	}
+	return errors.Errorf("wait profile of database %s timeout", dbID)
+}
+
 // copied from sqlchain.xxx_test.
 func createRandomBlock(parent hash.Hash, isGenesis bool) (b *types.Block, err error) {
 	// Generate key pair
@@ -795,21 +1221,6 @@ func createRandomBlock(parent hash.Hash, isGenesis bool) (b *types.Block, err er
 // fake BPDB service
 type stubBPDBService struct{}
 
-func (s *stubBPDBService) CreateDatabase(req *types.CreateDatabaseRequest, resp *types.CreateDatabaseResponse) (err error) {
-	if resp.Header.InstanceMeta, err = s.getInstanceMeta("db2"); err != nil {
-		return
-	}
-	if resp.Header.Signee, err = kms.GetLocalPublicKey(); err != nil {
-		return
-	}
-	var privateKey *asymmetric.PrivateKey
-	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
-		return
-	}
-	err = resp.Sign(privateKey)
-	return
-}
-
 func (s *stubBPDBService) DropDatabase(req *types.DropDatabaseRequest, resp *types.DropDatabaseRequest) (err error) {
 	return
 }
@@ -0,0 +1,271 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
+)
+
+// Following contains interactive transaction logic extracted from main database instance
+// definition.
+//
+// An interactive transaction holds the write gate of the database exclusively during its
+// whole life, so that the speculative writes executed in the session could be re-applied
+// through kayak with exactly the same results when the transaction commits.
+
+// txSession tracks the open interactive transaction of the database.
+type txSession struct {
+	nodeID   proto.NodeID
+	txID     uint64
+	timer    *time.Timer
+	deadline time.Time // the end of the max lifetime
+}
+
+// writeGate is a readers-writer lock of the database writes, which is held shared by normal
+// writes and exclusively by the open interactive transaction. Unlike sync.RWMutex, the exclusive
+// lock is acquired with a timeout, and new shared holders wait for the exclusive waiters.
+type writeGate struct {
+	lock      sync.Mutex
+	shared    int
+	exclusive bool
+	waiting   int           // the number of exclusive waiters
+	changed   chan struct{} // closed on every release
+}
+
+func (g *writeGate) acquireShared() {
+	g.lock.Lock()
+	for g.exclusive || g.waiting > 0 {
+		ch := g.wait()
+		g.lock.Unlock()
+		<-ch
+		g.lock.Lock()
+	}
+	g.shared++
+	g.lock.Unlock()
+}
+
+func (g *writeGate) releaseShared() {
+	g.lock.Lock()
+	g.shared--
+	g.notify()
+	g.lock.Unlock()
+}
+
+// acquireExclusive returns false if the gate is not acquired before timeout.
+func (g *writeGate) acquireExclusive(timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.waiting++
+	defer func() { g.waiting-- }()
+
+	for g.exclusive || g.shared > 0 {
+		ch := g.wait()
+		g.lock.Unlock()
+		select {
+		case <-ch:
+			g.lock.Lock()
+		case <-timer.C:
+			g.lock.Lock()
+			// wake up the shared waiters blocked by this waiter
+			g.notify()
+			return false
+		}
+	}
+	g.exclusive = true
+	return true
+}
+
+func (g *writeGate) releaseExclusive() {
+	g.lock.Lock()
+	g.exclusive = false
+	g.notify()
+	g.lock.Unlock()
+}
+
+// wait returns the channel closed on next release, should be called with lock held.
+func (g *writeGate) wait() chan struct{} {
+	if g.changed == nil {
+		g.changed = make(chan struct{})
+	}
+	return g.changed
+}
+
+// notify wakes up all the waiters, should be called with lock held.
+func (g *writeGate) notify() {
+	if g.changed != nil {
+		close(g.changed)
+		g.changed = nil
+	}
+}
+
+func (db *Database) txQuery(request *types.Request) (response *types.Response, err error) {
+	if err = request.Verify(); err != nil {
+		return
+	}
+
+	switch request.Header.TxOp {
+	case types.TxBegin:
+		return db.beginTx(request)
+	case types.TxExec:
+		return db.execTx(request)
+	case types.TxCommit:
+		return db.commitTx(request)
+	case types.TxRollback:
+		return db.rollbackTx(request)
+	default:
+		return nil, errors.Wrap(ErrInvalidRequest, "invalid tx op")
+	}
+}
+
+func (db *Database) beginTx(request *types.Request) (response *types.Response, err error) {
+	// wait for the ongoing writes and transaction, no longer than the idle timeout of transaction
+	if !db.txGate.acquireExclusive(db.cfg.TxTimeout) {
+		err = errors.Wrap(ErrTxBusy, "begin tx")
+		return
+	}
+
+	db.txLock.Lock()
+	defer db.txLock.Unlock()
+
+	if response, err = db.chain.QueryInTx(request); err != nil {
+		db.txGate.releaseExclusive()
+		return
+	}
+
+	var (
+		nodeID = request.Header.NodeID
+		txID   = request.Header.TxID
+	)
+	db.tx = &txSession{
+		nodeID:   nodeID,
+		txID:     txID,
+		deadline: time.Now().Add(db.cfg.TxMaxLifetime),
+		timer: time.AfterFunc(db.cfg.TxTimeout, func() {
+			db.abortTx(nodeID, txID)
+		}),
+	}
+
+	return
+}
+
+func (db *Database) execTx(request *types.Request) (response *types.Response, err error) {
+	db.txLock.Lock()
+	defer db.txLock.Unlock()
+
+	if !db.tx.match(request) {
+		err = errors.Wrap(ErrTxNotFound, "exec tx")
+		return
+	}
+
+	// renew session timeout on every statement, but never beyond the max lifetime
+	timeout := time.Until(db.tx.deadline)
+	if timeout <= 0 {
+		db.chain.RollbackTx(db.tx.nodeID, db.tx.txID)
+		db.endTx()
+		err = errors.Wrap(ErrTxExpired, "exec tx")
+		return
+	}
+	if timeout > db.cfg.TxTimeout {
+		timeout = db.cfg.TxTimeout
+	}
+	db.tx.timer.Reset(timeout)
+
+	return db.chain.QueryInTx(request)
+}
+
+func (db *Database) commitTx(request *types.Request) (response *types.Response, err error) {
+	db.txLock.Lock()
+	defer db.txLock.Unlock()
+
+	if !db.tx.match(request) {
+		err = errors.Wrap(ErrTxNotFound, "commit tx")
+		return
+	}
+
+	defer db.endTx()
+
+	if request.Header.QueryType != types.WriteQuery {
+		db.chain.RollbackTx(db.tx.nodeID, db.tx.txID)
+		err = errors.Wrap(ErrInvalidRequest, "commit tx with non-write query")
+		return
+	}
+
+	// discard speculative writes and apply the committed writes through kayak, the write gate
+	// is still held so that nothing could be applied in between
+	if err = db.chain.ReleaseTx(request); err != nil {
+		return
+	}
+
+	return db.applyWrite(request)
+}
+
+func (db *Database) rollbackTx(request *types.Request) (response *types.Response, err error) {
+	db.txLock.Lock()
+	defer db.txLock.Unlock()
+
+	if !db.tx.match(request) {
+		err = errors.Wrap(ErrTxNotFound, "rollback tx")
+		return
+	}
+
+	defer db.endTx()
+
+	return db.chain.QueryInTx(request)
+}
+
+// abortTx rolls back the abandoned transaction on session timeout.
+func (db *Database) abortTx(nodeID proto.NodeID, txID uint64) {
+	db.txLock.Lock()
+	defer db.txLock.Unlock()
+
+	if db.tx == nil || db.tx.nodeID != nodeID || db.tx.txID != txID {
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"db":   db.dbID,
+		"node": nodeID,
+		"tx":   txID,
+	}).Warning("interactive transaction timeout, rolled back")
+
+	db.chain.RollbackTx(nodeID, txID)
+	db.endTx()
+}
+
+// endTx releases the session and the write gate, should be called with txLock held.
+func (db *Database) endTx() {
+	if db.tx == nil {
+		return
+	}
+	db.tx.timer.Stop()
+	db.tx = nil
+	db.txGate.releaseExclusive()
+}
+
+func (t *txSession) match(request *types.Request) bool {
+	return t != nil && t.nodeID == request.Header.NodeID && t.txID == request.Header.TxID
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWriteGate(t *testing.T) {
+	Convey("Given a write gate", t, func() {
+		var g writeGate
+
+		Convey("The shared holders should not block each other", func() {
+			g.acquireShared()
+			g.acquireShared()
+			So(g.acquireExclusive(10*time.Millisecond), ShouldBeFalse)
+			g.releaseShared()
+			g.releaseShared()
+			So(g.acquireExclusive(10*time.Millisecond), ShouldBeTrue)
+			g.releaseExclusive()
+		})
+		Convey("The exclusive acquisition should time out while held", func() {
+			So(g.acquireExclusive(10*time.Millisecond), ShouldBeTrue)
+			So(g.acquireExclusive(10*time.Millisecond), ShouldBeFalse)
+
+			acquired := make(chan struct{})
+			go func() {
+				g.acquireShared()
+				close(acquired)
+			}()
+			select {
+			case <-acquired:
+				t.Fatal("shared acquired while exclusively held")
+			case <-time.After(10 * time.Millisecond):
+			}
+			g.releaseExclusive()
+			<-acquired
+			g.releaseShared()
+		})
+		Convey("The exclusive waiter should be granted on release", func() {
+			g.acquireShared()
+			acquired := make(chan bool)
+			go func() {
+				acquired <- g.acquireExclusive(time.Second)
+			}()
+			time.Sleep(10 * time.Millisecond)
+			g.releaseShared()
+			So(<-acquired, ShouldBeTrue)
+			g.releaseExclusive()
+		})
+	})
+}
@@ -48,6 +48,9 @@ type DBMS struct {
 	kayakMux *DBKayakMuxService
 	chainMux *sqlchain.MuxService
 	rpc      *DBMSRPCService
+
+	// database users learned from main chain
+	permissions sync.Map // map[proto.DatabaseID]*userPermissions
 }
 
 // NewDBMS returns new database management instance.
@@ -181,6 +184,15 @@ func (dbms *DBMS) Create(instance *types.ServiceInstance, cleanup bool) (err err
 		return ErrAlreadyExists
 	}
 
+	if instance.ResourceMeta.StorageEngine == types.StorageEngineMemory {
+		if !dbms.cfg.AllowMemoryEngine {
+			return errors.Wrapf(ErrStorageEngineDisabled,
+				"memory storage engine of database %s", instance.DatabaseID)
+		}
+		log.WithField("db", instance.DatabaseID).Warning(
+			"database deployed on memory storage engine, all data is lost on restart")
+	}
+
 	// set database root dir
 	rootDir := filepath.Join(dbms.cfg.RootDir, string(instance.DatabaseID))
 
@@ -213,6 +225,8 @@ func (dbms *DBMS) Create(instance *types.ServiceInstance, cleanup bool) (err err
 		MaxWriteTimeGap: dbms.cfg.MaxReqTimeGap,
 		EncryptionKey:   instance.ResourceMeta.EncryptionKey,
 		SpaceLimit:      instance.ResourceMeta.Space,
+		StorageEngine:   instance.ResourceMeta.StorageEngine,
+		NodeRoles:       dbms.userNodeRoles(instance.DatabaseID),
 	}
 
 	if db, err = NewDatabase(dbCfg, instance.Peers, instance.GenesisBlock); err != nil {
@@ -239,6 +253,8 @@ func (dbms *DBMS) Drop(dbID proto.DatabaseID) (err error) {
 		return
 	}
 
+	dbms.permissions.Delete(dbID)
+
 	// remove meta
 	return dbms.removeMeta(dbID)
 }
@@ -267,6 +283,11 @@ func (dbms *DBMS) Query(req *types.Request) (res *types.Response, err error) {
 		return
 	}
 
+	// check permission of the request account
+	if err = dbms.checkPermission(req); err != nil {
+		return
+	}
+
 	// send query
 	return db.Query(req)
 }
@@ -286,6 +307,48 @@ func (dbms *DBMS) Ack(ack *types.Ack) (err error) {
 	return db.Ack(ack)
 }
 
+// Fetch handles fetch of query result cursor page.
+func (dbms *DBMS) Fetch(req *types.CursorRequest) (page *types.Page, err error) {
+	var db *Database
+	var exists bool
+
+	// find database
+	if db, exists = dbms.getMeta(req.Header.DatabaseID); !exists {
+		err = ErrNotExists
+		return
+	}
+
+	return db.FetchCursor(req)
+}
+
+// CloseCursor handles close of query result cursor.
+func (dbms *DBMS) CloseCursor(req *types.CursorRequest) (err error) {
+	var db *Database
+	var exists bool
+
+	// find database
+	if db, exists = dbms.getMeta(req.Header.DatabaseID); !exists {
+		err = ErrNotExists
+		return
+	}
+
+	return db.CloseCursor(req)
+}
+
+// Backup handles online backup of a database instance to a new dir on local host.
+func (dbms *DBMS) Backup(dbID proto.DatabaseID, dir string) (manifest *types.BackupManifest, err error) {
+	var db *Database
+	var exists bool
+
+	// find database
+	if db, exists = dbms.getMeta(dbID); !exists {
+		err = ErrNotExists
+		return
+	}
+
+	return db.Backup(dir)
+}
+
 func (dbms *DBMS) getMeta(dbID proto.DatabaseID) (db *Database, exists bool) {
 	var rawDB interface{}
 
@@ -25,6 +25,24 @@ import (
 var (
 	// DefaultMaxReqTimeGap defines max time gap between request and server.
 	DefaultMaxReqTimeGap = time.Minute
+
+	// DefaultTxTimeout defines the max idle time of an interactive transaction before it's
+	// rolled back.
+	DefaultTxTimeout = 30 * time.Second
+
+	// DefaultTxMaxLifetime defines the max lifetime of an interactive transaction, it's rolled
+	// back on the first statement after expiration even if it's never idle.
+	DefaultTxMaxLifetime = 5 * time.Minute
+
+	// DefaultCursorTimeout defines the max idle time of a query result cursor before it's closed.
+	DefaultCursorTimeout = 30 * time.Second
+
+	// PermissionCacheTTL defines the max age of the database users cache learned from main chain.
+	PermissionCacheTTL = 10 * time.Second
+
+	// PermissionRefreshInterval defines the min interval to refresh the database users cache on
+	// query from an unknown account.
+	PermissionRefreshInterval = time.Second
 )
 
 // DBMSConfig defines the local multi-database management system config.
@@ -32,4 +50,7 @@ type DBMSConfig struct {
 	RootDir       string
 	Server        *rpc.Server
 	MaxReqTimeGap time.Duration
+	// AllowMemoryEngine allows the databases on the in-memory storage engine, which is intended
+	// for test and development only.
+	AllowMemoryEngine bool
 }
@@ -22,6 +22,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/kayak"
 	kt "github.com/CovenantSQL/CovenantSQL/kayak/types"
 	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/rpc"
 	"github.com/pkg/errors"
 )
@@ -29,6 +30,8 @@ import (
 const (
 	// DBKayakMethodName defines the database kayak rpc method name.
 	DBKayakMethodName = "Call"
+	// DBKayakFetchMethodName defines the database kayak log fetching rpc method name.
+	DBKayakFetchMethodName = "Fetch"
 )
 
 // DBKayakMuxService defines a mux service for sqlchain kayak.
@@ -37,6 +40,13 @@ type DBKayakMuxService struct {
 	serviceMap  sync.Map
 }
 
+// dbKayakInstance defines a kayak runtime registered in the mux service with the roles of the
+// database nodes.
+type dbKayakInstance struct {
+	rt    *kayak.Runtime
+	roles route.DatabaseRoles
+}
+
 // NewDBKayakMuxService returns a new kayak mux service.
 func NewDBKayakMuxService(serviceName string, server *rpc.Server) (s *DBKayakMuxService, err error) {
 	s = &DBKayakMuxService{
@@ -46,9 +56,9 @@ func NewDBKayakMuxService(serviceName string, server *rpc.Server) (s *DBKayakMux
 	return
 }
 
-func (s *DBKayakMuxService) register(id proto.DatabaseID, rt *kayak.Runtime) {
-	s.serviceMap.Store(id, rt)
-
+func (s *DBKayakMuxService) register(
+	id proto.DatabaseID, rt *kayak.Runtime, roles route.DatabaseRoles) {
+	s.serviceMap.Store(id, &dbKayakInstance{rt: rt, roles: roles})
 }
 
 func (s *DBKayakMuxService) unregister(id proto.DatabaseID) {
@@ -62,7 +72,30 @@ func (s *DBKayakMuxService) Call(req *kt.RPCRequest, _ *interface{}) (err error)
 	id := proto.DatabaseID(req.Instance)
 
 	if v, ok := s.serviceMap.Load(id); ok {
-		return v.(*kayak.Runtime).FollowerApply(req.Log)
+		inst := v.(*dbKayakInstance)
+		// only the database peers can replicate the logs
+		if !route.IsPermittedOnDatabase(&req.Envelope, inst.roles, route.DBCCall) {
+			return errors.Wrapf(ErrPermissionDenied, "apply kayak log of instance %v", req.Instance)
+		}
+		return inst.rt.FollowerApply(req.Log)
+	}
+
+	return errors.Wrapf(ErrUnknownMuxRequest, "instance %v", req.Instance)
+}
+
+// Fetch handles kayak log and snapshot fetching.
+func (s *DBKayakMuxService) Fetch(req *kt.FetchRequest, resp *kt.FetchResponse) (err error) {
+	// treat req.Instance as DatabaseID
+	id := proto.DatabaseID(req.Instance)
+
+	if v, ok := s.serviceMap.Load(id); ok {
+		inst := v.(*dbKayakInstance)
+		// the logs and snapshots contain the whole database, only serve the database peers
+		if !route.IsPermittedOnDatabase(&req.Envelope, inst.roles, route.DBCFetch) {
+			return errors.Wrapf(ErrPermissionDenied, "fetch kayak logs of instance %v", req.Instance)
+		}
+		err = inst.rt.ServeFetch(req, resp)
+		return
 	}
 
 	return errors.Wrapf(ErrUnknownMuxRequest, "instance %v", req.Instance)
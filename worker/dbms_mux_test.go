@@ -0,0 +1,91 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"testing"
+
+	kt "github.com/CovenantSQL/CovenantSQL/kayak/types"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type testDatabaseRoles map[proto.NodeID]proto.ServerRoles
+
+func (r testDatabaseRoles) GetNodeRoles(nodeID proto.NodeID) proto.ServerRoles {
+	return r[nodeID]
+}
+
+func TestDBKayakMuxFetch(t *testing.T) {
+	Convey("The kayak logs should only be fetched by the database peers", t, func() {
+		var (
+			s = &DBKayakMuxService{}
+			// a 32 bytes node id which is neither a block producer nor a database peer
+			other = proto.NodeID("0000000000000000000000000000000000000000000000000000000000000004")
+			resp  = &kt.FetchResponse{}
+		)
+		s.register("db", nil, testDatabaseRoles{
+			proto.NodeID("0000000000000000000000000000000000000000000000000000000000000001"): {
+				proto.Leader, proto.Miner,
+			},
+			other: {proto.Client},
+		})
+		err := s.Fetch(&kt.FetchRequest{
+			Envelope: proto.Envelope{NodeID: other.ToRawNodeID()},
+			Instance: "db",
+			From:     1,
+		}, resp)
+		So(errors.Cause(err), ShouldEqual, ErrPermissionDenied)
+		So(resp.Snapshot, ShouldBeNil)
+		So(resp.Logs, ShouldBeEmpty)
+
+		err = s.Fetch(&kt.FetchRequest{
+			Envelope: proto.Envelope{NodeID: other.ToRawNodeID()},
+			Instance: "unknown",
+		}, resp)
+		So(errors.Cause(err), ShouldEqual, ErrUnknownMuxRequest)
+	})
+}
+
+func TestDBKayakMuxCall(t *testing.T) {
+	Convey("The kayak logs should only be applied from the database peers", t, func() {
+		var (
+			s = &DBKayakMuxService{}
+			// a 32 bytes node id which is neither a block producer nor a database peer
+			other = proto.NodeID("0000000000000000000000000000000000000000000000000000000000000004")
+		)
+		s.register("db", nil, testDatabaseRoles{
+			proto.NodeID("0000000000000000000000000000000000000000000000000000000000000001"): {
+				proto.Leader, proto.Miner,
+			},
+			other: {proto.Client},
+		})
+		err := s.Call(&kt.RPCRequest{
+			Envelope: proto.Envelope{NodeID: other.ToRawNodeID()},
+			Instance: "db",
+			Log:      &kt.Log{},
+		}, nil)
+		So(errors.Cause(err), ShouldEqual, ErrPermissionDenied)
+
+		err = s.Call(&kt.RPCRequest{
+			Envelope: proto.Envelope{NodeID: other.ToRawNodeID()},
+			Instance: "unknown",
+		}, nil)
+		So(errors.Cause(err), ShouldEqual, ErrUnknownMuxRequest)
+	})
+}
@@ -0,0 +1,184 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"sync"
+	"time"
+
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
+)
+
+// userPermissions defines the database users and status cache learned from main chain.
+type userPermissions struct {
+	sync.Mutex
+	users   map[proto.AccountAddress]pt.UserPermission
+	status  pt.DatabaseStatus
+	updated time.Time
+}
+
+// checkPermission verifies the request signature, and checks the permission of the request
+// account against the database users on main chain. The write queries are rejected if the
+// database is frozen for low deposit.
+func (dbms *DBMS) checkPermission(req *types.Request) (err error) {
+	if err = req.Verify(); err != nil {
+		err = errors.Wrap(err, "verify request failed")
+		return
+	}
+
+	var addr proto.AccountAddress
+	if addr, err = crypto.PubKeyHash(req.Header.Signee); err != nil {
+		err = errors.Wrap(err, "get request account address failed")
+		return
+	}
+
+	var (
+		perm   pt.UserPermission
+		status pt.DatabaseStatus
+		exists bool
+	)
+	if perm, status, exists, err = dbms.getUserPermission(req.Header.DatabaseID, addr); err != nil {
+		return
+	}
+	if !exists {
+		err = errors.Wrapf(ErrUnknownUser, "account %s in database %s", addr.String(), req.Header.DatabaseID)
+		return
+	}
+
+	switch perm {
+	case pt.Admin, pt.ReadWrite:
+	case pt.Read:
+		if isWriteRequest(req) {
+			err = errors.Wrapf(ErrPermissionDenied, "write query from read-only account %s", addr.String())
+		}
+	default:
+		err = errors.Wrapf(ErrPermissionDenied, "invalid permission %d of account %s", perm, addr.String())
+	}
+
+	if err == nil && status == pt.DatabaseFrozen && isWriteRequest(req) {
+		err = errors.Wrapf(ErrDatabaseFrozen, "database %s", req.Header.DatabaseID)
+	}
+
+	return
+}
+
+// isWriteRequest reports whether req writes the database or blocks the writes, i.e. begins an
+// interactive transaction, which holds the write gate until it ends.
+func isWriteRequest(req *types.Request) bool {
+	return req.Header.QueryType == types.WriteQuery || req.Header.TxOp == types.TxBegin
+}
+
+// getUserPermission returns the permission of addr in database, the cache is refreshed if it's
+// expired, or the account is not found which might be added recently.
+func (dbms *DBMS) getUserPermission(dbID proto.DatabaseID, addr proto.AccountAddress) (
+	perm pt.UserPermission, status pt.DatabaseStatus, exists bool, err error) {
+	rawUP, _ := dbms.permissions.LoadOrStore(dbID, &userPermissions{})
+	up := rawUP.(*userPermissions)
+
+	up.Lock()
+	defer up.Unlock()
+
+	perm, exists = up.users[addr]
+	status = up.status
+	age := time.Since(up.updated)
+	if up.users != nil && age < PermissionCacheTTL && (exists || age < PermissionRefreshInterval) {
+		return
+	}
+
+	var users map[proto.AccountAddress]pt.UserPermission
+	if users, status, err = dbms.fetchUserPermissions(dbID); err != nil {
+		if up.users == nil {
+			return
+		}
+		// use the stale cache until next refresh
+		log.WithField("db", dbID).WithError(err).Warning("refresh database users failed")
+		up.updated = time.Now()
+		status = up.status
+		err = nil
+		return
+	}
+
+	up.users, up.status, up.updated = users, status, time.Now()
+	perm, exists = up.users[addr]
+
+	return
+}
+
+// userNodeRoles returns the resolver of node roles by the database users on main chain, the
+// node of any database user account is permitted to be a client and an observer of the database.
+func (dbms *DBMS) userNodeRoles(dbID proto.DatabaseID) func(nodeID proto.NodeID) proto.ServerRoles {
+	return func(nodeID proto.NodeID) (roles proto.ServerRoles) {
+		var (
+			pubKey *asymmetric.PublicKey
+			addr   proto.AccountAddress
+			exists bool
+			err    error
+		)
+		// the public key is already known by the ETLS session of the caller
+		if pubKey, err = kms.GetPublicKey(nodeID); err != nil {
+			log.WithField("node", nodeID).WithError(err).Debug("get node public key failed")
+			return
+		}
+		if addr, err = crypto.PubKeyHash(pubKey); err != nil {
+			return
+		}
+		if _, _, exists, err = dbms.getUserPermission(dbID, addr); err != nil || !exists {
+			return
+		}
+		return proto.ServerRoles{proto.Client, proto.Observer}
+	}
+}
+
+func (dbms *DBMS) fetchUserPermissions(dbID proto.DatabaseID) (
+	users map[proto.AccountAddress]pt.UserPermission, status pt.DatabaseStatus, err error) {
+	var bpNodeID proto.NodeID
+	if bpNodeID, err = rpc.GetCurrentBP(); err != nil {
+		return
+	}
+
+	req := &types.QuerySQLChainProfileReq{
+		DBID: dbID,
+	}
+	res := new(types.QuerySQLChainProfileResp)
+
+	if err = rpc.NewCaller().CallNode(bpNodeID, route.MCCQuerySQLChainProfile.String(), req, res); err != nil {
+		err = errors.Wrap(err, "query sqlchain profile failed")
+		return
+	}
+
+	// no user is permitted if the database is not found on main chain
+	users = make(map[proto.AccountAddress]pt.UserPermission, len(res.Profile.Users))
+	if res.OK {
+		status = res.Profile.Status
+		for _, u := range res.Profile.Users {
+			if u != nil {
+				users[u.Address] = u.Permission
+			}
+		}
+	}
+
+	return
+}
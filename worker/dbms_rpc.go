@@ -20,6 +20,9 @@ import (
 	//"context"
 	//"runtime/trace"
 
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	kt "github.com/CovenantSQL/CovenantSQL/kayak/types"
+	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/rpc"
 	"github.com/CovenantSQL/CovenantSQL/types"
@@ -74,6 +77,7 @@ func (rpc *DBMSRPCService) Query(req *types.Request, res *types.Response) (err e
 	var r *types.Response
 	if r, err = rpc.dbms.Query(req); err != nil {
 		dbQueryFailCounter.Mark(1)
+		err = codeQueryError(err)
 		return
 	}
 
@@ -83,6 +87,26 @@ func (rpc *DBMSRPCService) Query(req *types.Request, res *types.Response) (err e
 	return
 }
 
+// codeQueryError attaches the code to the query errors which are classified by clients.
+func codeQueryError(err error) error {
+	var code types.QueryErrorCode
+	switch errors.Cause(err) {
+	case ErrUnknownUser:
+		code = types.QueryErrUnknownUser
+	case ErrPermissionDenied:
+		code = types.QueryErrPermissionDenied
+	case ErrDatabaseFrozen:
+		code = types.QueryErrDatabaseFrozen
+	case ErrInvalidRequestSeq:
+		code = types.QueryErrInvalidRequestSeq
+	case kt.ErrNotLeader:
+		code = types.QueryErrNotLeader
+	default:
+		return err
+	}
+	return &types.QueryError{Code: code, Msg: err.Error()}
+}
+
 // Ack rpc, called by client to confirm read request.
 func (rpc *DBMSRPCService) Ack(ack *types.Ack, _ *types.AckResponse) (err error) {
 	// Just need to verify signature in db.saveAck
@@ -106,6 +130,58 @@ func (rpc *DBMSRPCService) Ack(ack *types.Ack, _ *types.AckResponse) (err error)
 	return
 }
 
+// Fetch rpc, called by client to fetch the next page of query result cursor.
+func (rpc *DBMSRPCService) Fetch(req *types.CursorRequest, res *types.Page) (err error) {
+	// verify if fetch node is the original query node
+	if req.Envelope.NodeID.String() != string(req.Header.NodeID) {
+		err = errors.Wrap(ErrInvalidRequest, "request node id mismatch in fetch")
+		return
+	}
+
+	var page *types.Page
+	if page, err = rpc.dbms.Fetch(req); err != nil {
+		return
+	}
+
+	*res = *page
+
+	return
+}
+
+// CloseCursor rpc, called by client to close query result cursor.
+func (rpc *DBMSRPCService) CloseCursor(req *types.CursorRequest, _ *types.CloseCursorResponse) (err error) {
+	// verify if close node is the original query node
+	if req.Envelope.NodeID.String() != string(req.Header.NodeID) {
+		err = errors.Wrap(ErrInvalidRequest, "request node id mismatch in close cursor")
+		return
+	}
+
+	return rpc.dbms.CloseCursor(req)
+}
+
+// Backup rpc, called by the miner owner to take an online backup of a database instance, the
+// bundle is written to the miner host.
+func (rpc *DBMSRPCService) Backup(req *types.BackupRequest, res *types.BackupResponse) (err error) {
+	// verify request node is the local node, which holds the miner private key
+	var localNodeID proto.NodeID
+	if localNodeID, err = kms.GetLocalNodeID(); err != nil {
+		return
+	}
+	if req.Envelope.NodeID == nil || req.Envelope.NodeID.String() != string(localNodeID) {
+		err = errors.Wrap(ErrInvalidRequest, "node not permitted for backup request")
+		return
+	}
+
+	var manifest *types.BackupManifest
+	if manifest, err = rpc.dbms.Backup(req.DatabaseID, req.Path); err != nil {
+		return
+	}
+
+	res.Manifest = *manifest
+
+	return
+}
+
 // Deploy rpc, called by BP to create/drop database and update peers.
 func (rpc *DBMSRPCService) Deploy(req *types.UpdateService, _ *types.UpdateServiceResponse) (err error) {
 	// verify request node is block producer
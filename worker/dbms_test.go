@@ -22,6 +22,8 @@ import (
 	"testing"
 	"time"
 
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/proto"
@@ -67,7 +69,10 @@ func TestDBMS(t *testing.T) {
 		var peers *proto.Peers
 		var block *types.Block
 
-		dbID := proto.DatabaseID("db")
+		// create database on main chain
+		var dbID proto.DatabaseID
+		dbID, err = createTestDatabase()
+		So(err, ShouldBeNil)
 
 		// create sqlchain block
 		block, err = createRandomBlock(rootHash, true)
@@ -88,6 +93,24 @@ func TestDBMS(t *testing.T) {
 		err = req.Sign(privateKey)
 		So(err, ShouldBeNil)
 
+		Convey("memory storage engine is disabled by default", func() {
+			memReq := new(types.UpdateService)
+			memReq.Header.Op = types.CreateDB
+			memReq.Header.Instance = types.ServiceInstance{
+				DatabaseID:   proto.DatabaseID("memdb"),
+				Peers:        peers,
+				GenesisBlock: block,
+				ResourceMeta: types.ResourceMeta{
+					StorageEngine: types.StorageEngineMemory,
+				},
+			}
+			err = memReq.Sign(privateKey)
+			So(err, ShouldBeNil)
+			err = testRequest(route.DBSDeploy, memReq, &res)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, ErrStorageEngineDisabled.Error())
+		})
+
 		Convey("with bp privilege", func() {
 			// send update again
 			err = testRequest(route.DBSDeploy, req, &res)
@@ -137,6 +160,64 @@ func TestDBMS(t *testing.T) {
 				So(err, ShouldBeNil)
 			})
 
+			Convey("queries with user permissions", func() {
+				// read-only user
+				var readerKey *asymmetric.PrivateKey
+				var readerAddr proto.AccountAddress
+				readerKey, _, err = asymmetric.GenSecp256k1KeyPair()
+				So(err, ShouldBeNil)
+				readerAddr, err = crypto.PubKeyHash(readerKey.PubKey())
+				So(err, ShouldBeNil)
+				err = addTestDatabaseUser(dbID, readerAddr, pt.Read)
+				So(err, ShouldBeNil)
+
+				var writeQuery, readQuery *types.Request
+				var queryRes *types.Response
+				writeQuery, err = buildQueryWithDatabaseID(types.WriteQuery, 1, 1, dbID, []string{
+					"create table test (test int)",
+				})
+				So(err, ShouldBeNil)
+				err = writeQuery.Sign(readerKey)
+				So(err, ShouldBeNil)
+				err = testRequest(route.DBSQuery, writeQuery, &queryRes)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, ErrPermissionDenied.Error())
+
+				readQuery, err = buildQueryWithDatabaseID(types.ReadQuery, 1, 2, dbID, []string{
+					"select 1",
+				})
+				So(err, ShouldBeNil)
+				err = readQuery.Sign(readerKey)
+				So(err, ShouldBeNil)
+				err = testRequest(route.DBSQuery, readQuery, &queryRes)
+				So(err, ShouldBeNil)
+
+				// beginning a transaction blocks the writes, denied for read-only user
+				var beginQuery *types.Request
+				beginQuery, err = buildQueryWithDatabaseID(types.ReadQuery, 1, 3, dbID, []string{})
+				So(err, ShouldBeNil)
+				beginQuery.Header.TxOp = types.TxBegin
+				err = beginQuery.Sign(readerKey)
+				So(err, ShouldBeNil)
+				err = testRequest(route.DBSQuery, beginQuery, &queryRes)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, ErrPermissionDenied.Error())
+
+				// unknown user
+				var strangerKey *asymmetric.PrivateKey
+				strangerKey, _, err = asymmetric.GenSecp256k1KeyPair()
+				So(err, ShouldBeNil)
+				readQuery, err = buildQueryWithDatabaseID(types.ReadQuery, 1, 4, dbID, []string{
+					"select 1",
+				})
+				So(err, ShouldBeNil)
+				err = readQuery.Sign(strangerKey)
+				So(err, ShouldBeNil)
+				err = testRequest(route.DBSQuery, readQuery, &queryRes)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, ErrUnknownUser.Error())
+			})
+
 			Convey("query non-existent database", func() {
 				// sending write query
 				var writeQuery *types.Request
@@ -42,4 +42,38 @@ var (
 
 	// ErrUnknownMuxRequest indicates that the a multiplexing request endpoint is not found.
 	ErrUnknownMuxRequest = errors.New("unknown multiplexing request")
+
+	// ErrStorageEngineDisabled defines errors on deploying database on a disabled storage engine.
+	ErrStorageEngineDisabled = errors.New("storage engine is disabled")
+
+	// ErrTxNotFound defines errors on operating a non-exists interactive transaction.
+	ErrTxNotFound = errors.New("interactive transaction not found")
+
+	// ErrTxBusy defines errors on beginning interactive transaction while the write gate is held
+	// until timeout.
+	ErrTxBusy = errors.New("database is busy with another transaction")
+
+	// ErrTxExpired defines errors on operating an interactive transaction exceeding max lifetime.
+	ErrTxExpired = errors.New("interactive transaction expired")
+
+	// ErrCursorNotFound defines errors on fetching a non-exists query result cursor.
+	ErrCursorNotFound = errors.New("cursor not found")
+
+	// ErrTooManyCursors defines errors on opening query result cursor exceeding limit.
+	ErrTooManyCursors = errors.New("too many open cursors")
+
+	// ErrBackupPathExists defines errors on writing backup bundle to an existing path.
+	ErrBackupPathExists = errors.New("backup path already exists")
+
+	// ErrInvalidSnapshot defines errors on loading a broken kayak snapshot file.
+	ErrInvalidSnapshot = errors.New("invalid snapshot")
+
+	// ErrUnknownUser defines errors on query from an account which is not a database user.
+	ErrUnknownUser = errors.New("unknown database user")
+
+	// ErrPermissionDenied defines errors on query without enough permission.
+	ErrPermissionDenied = errors.New("database permission denied")
+
+	// ErrDatabaseFrozen defines errors on write query to a database frozen for low deposit.
+	ErrDatabaseFrozen = errors.New("database is frozen for low deposit")
 )
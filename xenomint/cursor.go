@@ -0,0 +1,234 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/pkg/errors"
+)
+
+// Cursor defines an open result set of a read query, which is fetched page by page.
+//
+// The query is executed in a separated read transaction of the dirty reader, so the pages may
+// observe writes applied after the query, the same as the normal read queries. If an interactive
+// transaction session is open, the committed data is read instead, and a dirty cursor can't be
+// fetched until the session ends, see txSession.
+type Cursor struct {
+	st     *State // st is the state of a dirty cursor, nil if the committed data is read
+	tx     *sql.Tx
+	rows   *sql.Rows
+	cancel context.CancelFunc
+	width  int
+	next   []interface{} // next is the prefetched row, nil if the result set is drained
+}
+
+// QueryCursor executes the read query of req and returns at most pageSize rows as the first
+// page in resp. The returned cursor is nil if the first page is already the whole result,
+// otherwise the remaining rows should be fetched by the cursor, which must be closed later.
+//
+// Only a read request with a single query is paged, others are served as normal queries.
+func (s *State) QueryCursor(
+	ctx context.Context, req *types.Request, pageSize int,
+) (
+	ref *QueryTracker, cur *Cursor, resp *types.Response, err error,
+) {
+	if pageSize <= 0 || req.Header.QueryType != types.ReadQuery ||
+		len(req.Payload.Queries) != 1 || atomic.LoadUint32(&s.hasSchemaChange) == 1 {
+		ref, resp, err = s.QueryWithContext(ctx, req)
+		return
+	}
+
+	var (
+		id             uint64
+		cnames, ctypes []string
+		cmetas         []types.ColumnMeta
+		rows           []types.ResponseRow
+		done           bool
+	)
+	if id, cur, cnames, ctypes, cmetas, err = s.openCursor(&req.Payload.Queries[0]); err != nil {
+		err = errors.Wrap(err, "query at #0 failed")
+		s.pool.setFailed(req)
+		return
+	}
+	if rows, done, err = cur.Next(ctx, pageSize); err != nil {
+		cur.Close()
+		cur = nil
+		err = errors.Wrap(err, "query at #0 failed")
+		s.pool.setFailed(req)
+		return
+	}
+	if done {
+		cur.Close()
+		cur = nil
+	}
+
+	// Build query response
+	ref = &QueryTracker{Req: req}
+	resp = &types.Response{
+		Header: types.SignedResponseHeader{
+			ResponseHeader: types.ResponseHeader{
+				Request:   req.Header,
+				NodeID:    s.nodeID,
+				Timestamp: s.getLocalTime(),
+				RowCount:  uint64(len(rows)),
+				LogOffset: id,
+			},
+		},
+		Payload: types.ResponsePayload{
+			Columns:     cnames,
+			DeclTypes:   ctypes,
+			Rows:        rows,
+			ColumnMetas: cmetas,
+		},
+	}
+	return
+}
+
+func (s *State) openCursor(q *types.Query) (
+	id uint64, cur *Cursor, names []string, ctypes []string, metas []types.ColumnMeta, err error,
+) {
+	var (
+		pattern string
+		args    []interface{}
+		cols    []*sql.ColumnType
+		ctx     context.Context
+	)
+	if _, pattern, args, err = convertQueryAndBuildArgs(
+		context.Background(), s.strg.DirtyReader(), q.Pattern, q.Args,
+	); err != nil {
+		return
+	}
+
+	// the cursor outlives the request, so it's bound to its own context which is canceled
+	// on close
+	cur = &Cursor{}
+	ctx, cur.cancel = context.WithCancel(context.Background())
+	defer func() {
+		if err != nil {
+			cur.Close()
+			cur = nil
+		}
+	}()
+
+	if s.lockDirtyRead() {
+		defer s.txLock.RUnlock()
+		cur.st = s
+		id = s.getID()
+		if cur.tx, err = s.strg.DirtyReader().Begin(); err != nil {
+			err = errors.Wrap(err, "open tx failed")
+			return
+		}
+	} else if id, cur.tx, err = s.beginCommitted(ctx); err != nil {
+		err = errors.Wrap(err, "open tx failed")
+		return
+	}
+	if cur.rows, err = cur.tx.QueryContext(ctx, pattern, args...); err != nil {
+		return
+	}
+	// Fetch column names and types
+	if names, err = cur.rows.Columns(); err != nil {
+		return
+	}
+	if cols, err = cur.rows.ColumnTypes(); err != nil {
+		return
+	}
+	ctypes = buildTypeNamesFromSQLColumnTypes(cols)
+	metas = buildColumnMetasFromSQLColumnTypes(cols)
+	cur.width = len(cols)
+	err = cur.prefetch()
+	return
+}
+
+func (c *Cursor) prefetch() (err error) {
+	if !c.rows.Next() {
+		c.next = nil
+		return c.rows.Err()
+	}
+	var (
+		row  = make([]interface{}, c.width)
+		dest = make([]interface{}, c.width)
+	)
+	for i := range row {
+		dest[i] = &row[i]
+	}
+	if err = c.rows.Scan(dest...); err != nil {
+		return
+	}
+	c.next = row
+	return
+}
+
+// Next fetches at most n rows from the cursor, and reports whether the result set is drained.
+// The running query is interrupted if ctx is done, after which the cursor is no longer usable.
+func (c *Cursor) Next(ctx context.Context, n int) (rows []types.ResponseRow, done bool, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	if c.st != nil {
+		if !c.st.lockDirtyRead() {
+			err = errors.Wrap(ErrTxConflict, "dirty cursor is blocked by the open tx")
+			return
+		}
+		defer c.st.txLock.RUnlock()
+	}
+	if ctxDone := ctx.Done(); ctxDone != nil {
+		var (
+			state    int32 // 0 for running, 1 for finished and 2 for interrupted
+			finished = make(chan struct{})
+		)
+		defer func() {
+			if !atomic.CompareAndSwapInt32(&state, 0, 1) && err == nil {
+				err = ctx.Err()
+			}
+			close(finished)
+		}()
+		go func() {
+			select {
+			case <-ctxDone:
+				if atomic.CompareAndSwapInt32(&state, 0, 2) {
+					c.cancel()
+				}
+			case <-finished:
+			}
+		}()
+	}
+
+	rows = make([]types.ResponseRow, 0, n)
+	for len(rows) < n && c.next != nil {
+		rows = append(rows, types.ResponseRow{Values: c.next})
+		if err = c.prefetch(); err != nil {
+			return
+		}
+	}
+	done = c.next == nil
+	return
+}
+
+// Close closes the cursor and releases its read transaction.
+func (c *Cursor) Close() {
+	if c.rows != nil {
+		c.rows.Close()
+	}
+	c.cancel()
+	if c.tx != nil {
+		c.tx.Rollback()
+	}
+}
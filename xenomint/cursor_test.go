@@ -0,0 +1,108 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCursor(t *testing.T) {
+	Convey("Given a chain state object with a basic KV table", t, func() {
+		var (
+			fl     = path.Join(testingDataDir, t.Name())
+			nodeID = proto.NodeID("0000000000000000000000000000000000000000000000000000000000000000")
+			st     *State
+			cur    *Cursor
+			resp   *types.Response
+			rows   []types.ResponseRow
+			done   bool
+			qs     = []types.Query{buildQuery(`CREATE TABLE t1 (k INT, v TEXT, PRIMARY KEY(k))`)}
+			req    = buildRequest(types.ReadQuery, []types.Query{
+				buildQuery(`SELECT k, v FROM t1 ORDER BY k`),
+			})
+		)
+		strg, err := xs.NewSqlite(fmt.Sprint("file:", fl))
+		So(err, ShouldBeNil)
+		st, err = NewState(nodeID, strg)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			err = st.Close(true)
+			So(err, ShouldBeNil)
+			err = os.Remove(fl)
+			So(err, ShouldBeNil)
+			os.Remove(fmt.Sprint(fl, "-shm"))
+			os.Remove(fmt.Sprint(fl, "-wal"))
+		})
+		for i := 0; i < 10; i++ {
+			qs = append(qs, buildQuery(`INSERT INTO t1 (k, v) VALUES (?, ?)`, i, "v"))
+		}
+		_, _, err = st.Query(buildRequest(types.WriteQuery, qs))
+		So(err, ShouldBeNil)
+		err = st.commit()
+		So(err, ShouldBeNil)
+
+		Convey("The result should be fetched page by page", func() {
+			_, cur, resp, err = st.QueryCursor(context.Background(), req, 4)
+			So(err, ShouldBeNil)
+			So(cur, ShouldNotBeNil)
+			So(resp.Payload.Columns, ShouldResemble, []string{"k", "v"})
+			So(resp.Payload.Rows, ShouldHaveLength, 4)
+			rows, done, err = cur.Next(context.Background(), 4)
+			So(err, ShouldBeNil)
+			So(done, ShouldBeFalse)
+			So(rows, ShouldHaveLength, 4)
+			So(rows[0].Values[0], ShouldEqual, 4)
+			rows, done, err = cur.Next(context.Background(), 4)
+			So(err, ShouldBeNil)
+			So(done, ShouldBeTrue)
+			So(rows, ShouldHaveLength, 2)
+			cur.Close()
+		})
+		Convey("The cursor should not be opened if the first page is the whole result", func() {
+			_, cur, resp, err = st.QueryCursor(context.Background(), req, 10)
+			So(err, ShouldBeNil)
+			So(cur, ShouldBeNil)
+			So(resp.Payload.Rows, ShouldHaveLength, 10)
+		})
+		Convey("The cursor should not be opened for malformed query", func() {
+			_, cur, resp, err = st.QueryCursor(context.Background(), buildRequest(
+				types.ReadQuery, []types.Query{buildQuery(`SELECT x FROM t1`)}), 4)
+			So(err, ShouldNotBeNil)
+			So(cur, ShouldBeNil)
+			So(resp, ShouldBeNil)
+		})
+		Convey("The cursor should report error with canceled context", func() {
+			_, cur, resp, err = st.QueryCursor(context.Background(), req, 4)
+			So(err, ShouldBeNil)
+			So(cur, ShouldNotBeNil)
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, _, err = cur.Next(ctx, 4)
+			So(err, ShouldNotBeNil)
+			cur.Close()
+		})
+	})
+}
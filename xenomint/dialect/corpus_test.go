@@ -0,0 +1,166 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dialect
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// corpus is the MySQL compatibility corpus, the statements are translated and executed in order,
+// and the rows of the read statements are compared with the expected ones.
+var corpus = []struct {
+	query string
+	args  []interface{}
+	rows  [][]string
+}{
+	// schema definitions generated by mysqldump and ORMs
+	{query: "CREATE TABLE `users` (\n" +
+		"  `id` int(11) unsigned NOT NULL AUTO_INCREMENT,\n" +
+		"  `name` varchar(64) COLLATE utf8mb4_bin NOT NULL DEFAULT '' COMMENT 'login name',\n" +
+		"  `email` varchar(128) CHARACTER SET utf8mb4 DEFAULT NULL,\n" +
+		"  `role` enum('admin','user') NOT NULL DEFAULT 'user',\n" +
+		"  `score` int(11) NOT NULL DEFAULT -1,\n" +
+		"  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,\n" +
+		"  `updated_at` timestamp NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP,\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  UNIQUE KEY `uk_email` (`email`),\n" +
+		"  KEY `idx_name` (`name`(16))\n" +
+		") ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin"},
+	{query: "CREATE TABLE IF NOT EXISTS `settings` (`user_id` int unsigned NOT NULL, " +
+		"`key` varchar(32) NOT NULL, `value` json, PRIMARY KEY (`user_id`, `key`), " +
+		"CONSTRAINT `fk_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)) ENGINE=InnoDB"},
+	{query: "CREATE TABLE `counters` (`name` varchar(32) NOT NULL PRIMARY KEY, " +
+		"`hits` bigint NOT NULL DEFAULT 0) ENGINE=MyISAM"},
+
+	// data manipulation
+	{query: "INSERT INTO `users` (`name`, `email`) VALUES ('alice', 'alice@example.com'), " +
+		"('bob', 'bob@example.com')"},
+	{query: "INSERT INTO `users` (`name`, `email`) VALUES (?, ?) " +
+		"ON DUPLICATE KEY UPDATE `name` = VALUES(`name`), `score` = `score` + 1",
+		args: []interface{}{"alice2", "alice@example.com"}},
+	{query: "INSERT IGNORE INTO `users` (`id`, `name`) VALUES (2, 'eve')"},
+	{query: "INSERT INTO counters (name, hits) VALUES ('home', 1) " +
+		"ON DUPLICATE KEY UPDATE hits = hits + VALUES(hits)"},
+	{query: "INSERT INTO counters (name, hits) VALUES ('home', 1) " +
+		"ON DUPLICATE KEY UPDATE hits = hits + VALUES(hits)"},
+	{query: "INSERT INTO settings VALUES (1, 'theme', '\"dark\"') " +
+		"ON DUPLICATE KEY UPDATE value = VALUES(value)"},
+	{query: "INSERT INTO settings VALUES (1, 'theme', '\"light\"') " +
+		"ON DUPLICATE KEY UPDATE value = VALUES(value)"},
+	{query: "SELECT `id`, `name`, `email`, `role`, `score` FROM `users` ORDER BY `id` FOR UPDATE",
+		rows: [][]string{
+			{"1", "alice2", "alice@example.com", "user", "0"},
+			{"2", "bob", "bob@example.com", "user", "-1"},
+		}},
+	{query: "SELECT hits FROM counters WHERE name = 'home' LOCK IN SHARE MODE",
+		rows: [][]string{{"2"}}},
+	{query: "SELECT `value` FROM `settings` WHERE `user_id` = 1",
+		rows: [][]string{{`"light"`}}},
+
+	// schema introspection
+	{query: "SHOW TABLES", rows: [][]string{{"users"}, {"settings"}, {"counters"}}},
+	{query: "SHOW COLUMNS FROM `counters`", rows: [][]string{
+		{"0", "name", "varchar(32)", "1", "NULL", "1"},
+		{"1", "hits", "bigint", "1", "0", "0"},
+	}},
+	{query: "DESCRIBE counters", rows: [][]string{
+		{"0", "name", "varchar(32)", "1", "NULL", "1"},
+		{"1", "hits", "bigint", "1", "0", "0"},
+	}},
+	{query: "SHOW INDEX FROM `users`",
+		rows: [][]string{{"sqlite_autoindex_users_1"}, {"idx_name"}}},
+	{query: "SELECT TABLE_NAME, TABLE_TYPE FROM information_schema.TABLES " +
+		"WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME LIKE 'c%'",
+		rows: [][]string{{"counters", "BASE TABLE"}}},
+	{query: "SELECT c.column_name, c.data_type, c.is_nullable, c.column_key " +
+		"FROM information_schema.columns AS c WHERE c.table_name = ? ORDER BY c.ordinal_position",
+		args: []interface{}{"settings"},
+		rows: [][]string{
+			{"user_id", "int", "NO", "PRI"},
+			{"key", "varchar", "NO", "PRI"},
+			{"value", "text", "YES", ""},
+		}},
+
+	// cleanup
+	{query: "TRUNCATE TABLE `settings`"},
+	{query: "SELECT COUNT(*) FROM settings", rows: [][]string{{"0"}}},
+}
+
+func TestCorpus(t *testing.T) {
+	Convey("Given a memory database", t, func() {
+		st, err := sqlite.NewMemory(fmt.Sprint("file:", t.Name()))
+		So(err, ShouldBeNil)
+		Reset(func() {
+			err = st.Close()
+			So(err, ShouldBeNil)
+		})
+		Convey("The MySQL compatibility corpus should be executed in order", func() {
+			var db = st.Writer()
+			for _, c := range corpus {
+				tr, err := Translate(context.Background(), c.query, db)
+				So(err, ShouldBeNil)
+				So(tr.ReadOnly, ShouldEqual, c.rows != nil)
+				if !tr.ReadOnly {
+					_, err = db.Exec(tr.Query, c.args...)
+					So(err, ShouldBeNil)
+					continue
+				}
+				rows, err := db.Query(tr.Query, c.args...)
+				So(err, ShouldBeNil)
+				values, err := readRows(rows)
+				So(err, ShouldBeNil)
+				So(values, ShouldResemble, c.rows)
+			}
+		})
+	})
+}
+
+func readRows(rows *sql.Rows) (values [][]string, err error) {
+	defer rows.Close()
+
+	var columns []string
+	if columns, err = rows.Columns(); err != nil {
+		return
+	}
+	for rows.Next() {
+		var (
+			row  = make([]sql.NullString, len(columns))
+			dest = make([]interface{}, len(columns))
+		)
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return
+		}
+		var value = make([]string, len(columns))
+		for i, v := range row {
+			if value[i] = "NULL"; v.Valid {
+				value[i] = v.String
+			}
+		}
+		values = append(values, value)
+	}
+	err = rows.Err()
+	return
+}
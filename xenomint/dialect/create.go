@@ -0,0 +1,325 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dialect
+
+import (
+	"strings"
+)
+
+// tableDef is a CREATE TABLE statement under translation.
+type tableDef struct {
+	text        string
+	table       string // unquoted table name
+	tableText   string // table name in the statement
+	ifNotExists bool
+
+	columns     []*columnDef
+	constraints []string
+	indexes     []string
+	primaryKey  []string // columns of the table level primary key
+	pkText      string
+}
+
+// columnDef is a column definition under translation.
+type columnDef struct {
+	name     string
+	nameText string
+	typ      string
+	options  []string
+	autoInc  bool
+	primary  bool
+}
+
+// translateCreateTable translates the MySQL table definition of a CREATE TABLE statement, it
+// returns an empty string if the statement has no table definition, e.g. CREATE TABLE ... LIKE.
+//
+// The table options, column comments, charsets and collations are dropped, the AUTO_INCREMENT
+// primary key column is declared as INTEGER PRIMARY KEY AUTOINCREMENT, and the non-unique keys
+// are created as separate indexes.
+func translateCreateTable(text string, tokens []token) (query string) {
+	var (
+		def = &tableDef{text: text}
+		i   int
+	)
+
+	// CREATE [TEMPORARY] TABLE [IF NOT EXISTS] tbl_name (create_definition, ...) [table_options]
+	if i++; i < len(tokens) && tokens[i].is("temporary") {
+		i++
+	}
+	if i >= len(tokens) || !tokens[i].is("table") {
+		return
+	}
+	if i++; i+2 < len(tokens) && tokens[i].is("if") && tokens[i+1].is("not") && tokens[i+2].is("exists") {
+		def.ifNotExists = true
+		i += 3
+	}
+	nameStart := i
+	for i < len(tokens) && !tokens[i].isChar('(') {
+		i++
+	}
+	if i >= len(tokens) || i == nameStart {
+		return
+	}
+	end, ok := group(tokens, i)
+	if !ok {
+		return
+	}
+	def.table = tokens[i-1].val
+	def.tableText = text[tokens[nameStart].start:tokens[i-1].end]
+
+	for _, item := range splitList(tokens[i+1 : end]) {
+		if len(item) > 0 {
+			def.addDefinition(item)
+		}
+	}
+
+	// the single column primary key of an AUTO_INCREMENT column is declared in the column
+	if len(def.primaryKey) == 1 {
+		for _, c := range def.columns {
+			if c.autoInc && strings.EqualFold(c.name, def.primaryKey[0]) {
+				c.primary = true
+				def.pkText = ""
+			}
+		}
+	}
+
+	var items []string
+	for _, c := range def.columns {
+		items = append(items, c.String())
+	}
+	if def.pkText != "" {
+		items = append(items, def.pkText)
+	}
+	items = append(items, def.constraints...)
+
+	queries := []string{
+		text[:tokens[i].start] + "(" + strings.Join(items, ", ") + ")",
+	}
+	queries = append(queries, def.indexes...)
+
+	return strings.Join(queries, "; ")
+}
+
+func (def *tableDef) addDefinition(item []token) {
+	switch first := &item[0]; {
+	case first.is("constraint"):
+		// CONSTRAINT [symbol] {PRIMARY KEY | UNIQUE | FOREIGN KEY | CHECK} ...
+		rest := item[1:]
+		if len(rest) > 0 && !rest[0].is("primary", "unique", "foreign", "check") {
+			rest = rest[1:]
+		}
+		switch {
+		case len(rest) == 0:
+		case rest[0].is("foreign"):
+			def.constraints = append(def.constraints,
+				render(def.text, item[:len(item)-len(rest)])+" "+def.foreignKey(rest))
+		case rest[0].is("check"):
+			def.constraints = append(def.constraints, render(def.text, item))
+		default:
+			def.addDefinition(rest)
+		}
+	case first.is("primary"):
+		names, cols := def.keyColumns(item)
+		def.primaryKey = names
+		def.pkText = "PRIMARY KEY (" + strings.Join(cols, ", ") + ")"
+	case first.is("unique"):
+		_, cols := def.keyColumns(item)
+		def.constraints = append(def.constraints, "UNIQUE ("+strings.Join(cols, ", ")+")")
+	case first.is("key", "index"):
+		names, cols := def.keyColumns(item)
+		name := quoteIdentifier(def.table + "_" + strings.Join(names, "_"))
+		if len(item) > 1 && item[1].isName() && !item[1].is("using") {
+			name = def.text[item[1].start:item[1].end]
+		}
+		index := "CREATE INDEX "
+		if def.ifNotExists {
+			index += "IF NOT EXISTS "
+		}
+		def.indexes = append(def.indexes,
+			index+name+" ON "+def.tableText+" ("+strings.Join(cols, ", ")+")")
+	case first.is("fulltext", "spatial"):
+		// not supported by SQLite
+	case first.is("foreign"):
+		def.constraints = append(def.constraints, def.foreignKey(item))
+	case first.is("check"):
+		def.constraints = append(def.constraints, render(def.text, item))
+	default:
+		def.columns = append(def.columns, def.parseColumn(item))
+	}
+}
+
+// foreignKey returns the foreign key definition without the index name.
+func (def *tableDef) foreignKey(item []token) string {
+	// FOREIGN KEY [index_name] (col_name, ...) REFERENCES ...
+	if len(item) > 3 && !item[2].isChar('(') {
+		return render(def.text, item[:2]) + " " + render(def.text, item[3:])
+	}
+	return render(def.text, item)
+}
+
+// keyColumns returns the column names and the indexed columns of a key definition, the prefix
+// lengths of the columns are dropped.
+func (def *tableDef) keyColumns(item []token) (names []string, cols []string) {
+	var start int
+	for start < len(item) && !item[start].isChar('(') {
+		start++
+	}
+	end, ok := group(item, start)
+	if !ok {
+		return
+	}
+
+	for _, col := range splitList(item[start+1 : end]) {
+		if len(col) == 0 {
+			continue
+		}
+		names = append(names, col[0].val)
+		c := def.text[col[0].start:col[0].end]
+		if last := col[len(col)-1]; last.is("asc", "desc") {
+			c += " " + strings.ToUpper(last.val)
+		}
+		cols = append(cols, c)
+	}
+	return
+}
+
+func (def *tableDef) parseColumn(item []token) (c *columnDef) {
+	c = &columnDef{
+		name:     item[0].val,
+		nameText: def.text[item[0].start:item[0].end],
+	}
+
+	// data type
+	i := 1
+	if i < len(item) {
+		typeStart := i
+		i++
+		if i < len(item) && item[i].isChar('(') {
+			if end, ok := group(item, i); ok {
+				i = end + 1
+			}
+		}
+		switch {
+		case item[typeStart].is("enum", "set", "json"):
+			c.typ = "TEXT"
+		default:
+			c.typ = render(def.text, item[typeStart:i])
+		}
+		for i < len(item) && item[i].is("unsigned", "signed", "zerofill") {
+			i++
+		}
+	}
+
+	// column attributes
+	for i < len(item) {
+		t := &item[i]
+		switch {
+		case t.is("not") && i+1 < len(item) && item[i+1].is("null"):
+			c.options = append(c.options, "NOT NULL")
+			i += 2
+		case t.is("null"):
+			c.options = append(c.options, "NULL")
+			i++
+		case t.is("default") && i+1 < len(item):
+			var value string
+			value, i = def.defaultValue(item, i+1)
+			c.options = append(c.options, "DEFAULT "+value)
+		case t.is("auto_increment"):
+			c.autoInc = true
+			i++
+		case t.is("primary") && i+1 < len(item) && item[i+1].is("key"):
+			c.primary = true
+			i += 2
+		case t.is("key"):
+			c.primary = true
+			i++
+		case t.is("unique"):
+			c.options = append(c.options, "UNIQUE")
+			if i++; i < len(item) && item[i].is("key") {
+				i++
+			}
+		case t.is("comment", "collate", "charset") && i+1 < len(item):
+			i += 2
+		case t.is("character") && i+2 < len(item) && item[i+1].is("set"):
+			i += 3
+		case t.is("on") && i+1 < len(item) && item[i+1].is("update"):
+			// ON UPDATE CURRENT_TIMESTAMP
+			_, i = def.defaultValue(item, i+2)
+		default:
+			// the rest attributes are kept as is, e.g. REFERENCES and CHECK
+			c.options = append(c.options, render(def.text, item[i:]))
+			i = len(item)
+		}
+	}
+
+	return
+}
+
+// defaultValue returns the default value expression starting from item[i] and the index of the
+// next token.
+func (def *tableDef) defaultValue(item []token, i int) (value string, next int) {
+	if i >= len(item) {
+		return "", i
+	}
+
+	start := i
+	switch t := &item[i]; {
+	case t.isChar('('):
+		if end, ok := group(item, i); ok {
+			i = end
+		}
+	case t.isChar('-') || t.isChar('+'):
+		i++
+	case t.is("current_timestamp", "current_date", "current_time", "now", "localtime",
+		"localtimestamp"):
+		// the precision of the current time is not supported
+		next = i + 1
+		if next < len(item) && item[next].isChar('(') {
+			if end, ok := group(item, next); ok {
+				next = end + 1
+			}
+		}
+		value = "CURRENT_TIMESTAMP"
+		if t.is("current_date", "current_time") {
+			value = strings.ToUpper(t.val)
+		}
+		return
+	}
+
+	next = i + 1
+	value = render(def.text, item[start:next])
+	return
+}
+
+func (c *columnDef) String() string {
+	var parts = []string{c.nameText}
+
+	if c.primary && c.autoInc {
+		// the rowid alias, which must be declared as INTEGER
+		parts = append(parts, "INTEGER PRIMARY KEY AUTOINCREMENT")
+	} else if c.typ != "" {
+		parts = append(parts, c.typ)
+		if c.primary {
+			parts = append(parts, "PRIMARY KEY")
+		}
+	} else if c.primary {
+		parts = append(parts, "PRIMARY KEY")
+	}
+	parts = append(parts, c.options...)
+
+	return strings.Join(parts, " ")
+}
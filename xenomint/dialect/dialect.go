@@ -0,0 +1,256 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dialect
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/CovenantSQL/sqlparser"
+	"github.com/pkg/errors"
+)
+
+// Querier queries the database being translated for, it's implemented by sql.DB, sql.Conn and
+// sql.Tx.
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Translation is the translation result of a query.
+type Translation struct {
+	// Query is the translated statements joined by semicolons.
+	Query string
+	// ContainsDDL indicates that the query contains schema changes.
+	ContainsDDL bool
+	// ReadOnly indicates that all the statements of the query are read statements.
+	ReadOnly bool
+}
+
+// statement is a single statement under translation.
+type statement struct {
+	text   string
+	tokens []token
+	parse  []edit // edits making the statement acceptable to the parser
+	output []edit // edits translating the statement to SQLite
+
+	onDup int // index of the ON token of ON DUPLICATE KEY UPDATE, or -1
+}
+
+// Translate translates the MySQL dialect statements of query to SQLite, the statements supported
+// by SQLite are kept as is. The schema required by some translations, e.g. the conflict target of
+// INSERT ... ON DUPLICATE KEY UPDATE, is looked up through q, which may be nil if the database is
+// not accessible, then such statements are reported as unsupported.
+func Translate(ctx context.Context, query string, q Querier) (t *Translation, err error) {
+	var texts []string
+	if texts, err = splitStatements(query); err != nil {
+		return
+	}
+
+	var (
+		queries = make([]string, 0, len(texts))
+		result  = &Translation{ReadOnly: len(texts) > 0}
+		stmt    sqlparser.Statement
+	)
+	for _, text := range texts {
+		s := &statement{text: text, onDup: -1}
+		if stmt, err = s.prepare(); err != nil {
+			return
+		}
+		if _, ok := stmt.(*sqlparser.DDL); ok {
+			result.ContainsDDL = true
+		}
+		result.ReadOnly = result.ReadOnly && isRead(stmt)
+
+		var translated string
+		if translated, err = s.translate(ctx, stmt, q); err != nil {
+			return
+		}
+		queries = append(queries, translated)
+	}
+
+	result.Query = strings.Join(queries, "; ")
+	t = result
+	return
+}
+
+// IsReadOnly reports whether all the statements of query are read statements, it's false if the
+// query is invalid.
+func IsReadOnly(query string) bool {
+	var texts, err = splitStatements(query)
+	if err != nil || len(texts) == 0 {
+		return false
+	}
+
+	for _, text := range texts {
+		s := &statement{text: text, onDup: -1}
+		stmt, err := s.prepare()
+		if err != nil || !isRead(stmt) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isRead(stmt sqlparser.Statement) bool {
+	switch stmt.(type) {
+	case *sqlparser.Select, *sqlparser.Union, *sqlparser.ParenSelect, *sqlparser.Show:
+		return true
+	default:
+		return false
+	}
+}
+
+// prepare scans the MySQL specific syntax of the statement and parses it.
+func (s *statement) prepare() (stmt sqlparser.Statement, err error) {
+	if s.tokens, err = tokenize(s.text); err != nil {
+		return
+	}
+
+	s.normalize()
+
+	if stmt, err = sqlparser.Parse(applyEdits(s.text, s.parse)); err != nil {
+		err = errors.Wrapf(ErrInvalidQuery, "parse statement failed: %v", err)
+	}
+	return
+}
+
+// normalize scans the statement tokens for the syntax beyond the parser grammar or SQLite.
+func (s *statement) normalize() {
+	var toks = s.tokens
+	if len(toks) == 0 {
+		return
+	}
+
+	// statement level rewrites
+	switch {
+	case toks[0].is("truncate"):
+		// TRUNCATE [TABLE] tbl_name
+		end := toks[0].end
+		if len(toks) > 1 && toks[1].is("table") {
+			end = toks[1].end
+		}
+		s.both(edit{start: toks[0].start, end: end, text: "DELETE FROM"})
+	case toks[0].is("show") && len(toks) > 3 && toks[1].is("index", "indexes", "keys") &&
+		toks[2].is("from", "in"):
+		// SHOW {INDEX | INDEXES | KEYS} {FROM | IN} [TABLE] tbl_name
+		end := toks[2].end
+		if toks[3].is("table") {
+			end = toks[3].end
+		}
+		s.both(edit{start: toks[1].start, end: end, text: "INDEX FROM TABLE"})
+	case toks[0].is("show") && len(toks) > 3:
+		// SHOW [FULL] {COLUMNS | FIELDS} {FROM | IN} tbl_name [{FROM | IN} db_name]
+		i := 1
+		if toks[i].is("full") {
+			i++
+		}
+		if i+2 < len(toks) && toks[i].is("columns", "fields") && toks[i+1].is("from", "in") {
+			s.parse = append(s.parse, edit{start: toks[i].start, end: toks[i+1].end, text: "COLUMNS FROM"})
+			if n := i + 3; n+1 < len(toks) && toks[n].is("from", "in") {
+				// SQLite database has a single schema
+				s.both(edit{start: toks[n-1].end, end: toks[len(toks)-1].end})
+			}
+		}
+	case toks[0].is("create") && len(toks) > 2 && toks[1].is("temporary") && toks[2].is("table"):
+		s.parse = append(s.parse, edit{start: toks[0].end, end: toks[1].end})
+	case toks[0].is("select"):
+		// locking reads, SQLite transactions are serializable anyway
+		n := len(toks)
+		if n > 2 && toks[n-2].is("for") && toks[n-1].is("update") {
+			s.both(edit{start: toks[n-3].end, end: toks[n-1].end})
+		} else if n > 4 && toks[n-4].is("lock") && toks[n-3].is("in") && toks[n-2].is("share") &&
+			toks[n-1].is("mode") {
+			s.both(edit{start: toks[n-5].end, end: toks[n-1].end})
+		}
+	case toks[0].is("insert", "replace"):
+		if toks[0].is("insert") && len(toks) > 1 && toks[1].is("ignore") {
+			s.output = append(s.output, edit{start: toks[1].start, end: toks[1].end, text: "OR IGNORE"})
+		}
+		for i := 1; i+3 < len(toks); i++ {
+			if toks[i].is("on") && toks[i+1].is("duplicate") && toks[i+2].is("key") &&
+				toks[i+3].is("update") {
+				s.onDup = i
+				s.parse = append(s.parse, edit{start: toks[i-1].end, end: len(s.text)})
+				break
+			}
+		}
+	}
+
+	// expression level rewrites
+	for i := 0; i < len(toks); i++ {
+		switch {
+		case toks[i].typ == sqlparser.ID && strings.EqualFold(toks[i].val, "information_schema") &&
+			i+2 < len(toks) && toks[i+1].isChar('.'):
+			i = s.normalizeInformationSchema(i)
+		case toks[i].is("from") && i+1 < len(toks) && toks[i+1].is("dual"):
+			// the dummy table of MySQL
+			s.output = append(s.output, edit{start: toks[i-1].end, end: toks[i+1].end})
+			i++
+		case toks[i].is("database", "schema") && i+2 < len(toks) && toks[i+1].isChar('(') &&
+			toks[i+2].isChar(')'):
+			// the SQLite main database
+			s.output = append(s.output, edit{start: toks[i].start, end: toks[i+2].end, text: "'main'"})
+			i += 2
+		case s.onDup >= 0 && i > s.onDup+3 && toks[i].is("values") && i+3 < len(toks) &&
+			toks[i+1].isChar('(') && toks[i+2].isName() && toks[i+3].isChar(')'):
+			// VALUES(col) refers to the value to be inserted
+			s.output = append(s.output, edit{
+				start: toks[i].start,
+				end:   toks[i+3].end,
+				text:  "excluded." + s.text[toks[i+2].start:toks[i+2].end],
+			})
+			i += 3
+		}
+	}
+}
+
+// both adds the edit to both of the parsing and output edits.
+func (s *statement) both(e edit) {
+	s.parse = append(s.parse, e)
+	s.output = append(s.output, e)
+}
+
+// translate returns the SQLite statement of the parsed statement.
+func (s *statement) translate(ctx context.Context, stmt sqlparser.Statement, q Querier) (
+	query string, err error,
+) {
+	switch st := stmt.(type) {
+	case *sqlparser.Show:
+		if query = translateShow(st); query != "" {
+			return
+		}
+	case *sqlparser.DDL:
+		if st.Action == sqlparser.CreateStr {
+			if query = translateCreateTable(s.text, s.tokens); query != "" {
+				return
+			}
+		}
+	case *sqlparser.Insert:
+		if s.onDup >= 0 {
+			var e edit
+			if e, err = s.translateOnDuplicate(ctx, st, q); err != nil {
+				return
+			}
+			s.output = append(s.output, e)
+		}
+	}
+
+	query = applyEdits(s.text, s.output)
+	return
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dialect
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTranslate(t *testing.T) {
+	Convey("Given the MySQL dialect statements without schema dependencies", t, func() {
+		var cases = []struct {
+			query string
+			want  string
+			ddl   bool
+			read  bool
+		}{
+			{"SELECT * FROM t1 WHERE k = ?", "SELECT * FROM t1 WHERE k = ?", false, true},
+			{"SELECT 'it''s', a || b FROM t1", "SELECT 'it''s', a || b FROM t1", false, true},
+			{"/* hint */ SELECT 1 -- comment", "SELECT 1", false, true},
+			{"SELECT 1; ; SELECT 2;", "SELECT 1; SELECT 2", false, true},
+			{"SELECT 1 FROM dual", "SELECT 1", false, true},
+			{"SELECT DATABASE()", "SELECT 'main'", false, true},
+			{"SELECT * FROM t1 WHERE k = 1 FOR UPDATE", "SELECT * FROM t1 WHERE k = 1", false, true},
+			{"SELECT * FROM t1 LOCK IN SHARE MODE", "SELECT * FROM t1", false, true},
+			{"SHOW TABLES", `SELECT name FROM sqlite_master WHERE type = "table" AND ` +
+				`name NOT LIKE 'sqlite\_%' ESCAPE '\'`, false, true},
+			{"SHOW TABLE t1", "PRAGMA table_info(t1)", false, true},
+			{"SHOW FULL COLUMNS FROM `t1`", "PRAGMA table_info(t1)", false, true},
+			{"SHOW FIELDS IN t1 FROM db", "PRAGMA table_info(t1)", false, true},
+			{"DESCRIBE t1", "PRAGMA table_info(t1)", false, true},
+			{"DESC t1", "PRAGMA table_info(t1)", false, true},
+			{"SHOW CREATE TABLE t1",
+				`SELECT sql FROM sqlite_master WHERE type = "table" AND tbl_name = "t1"`, false, true},
+			{"SHOW INDEX FROM t1",
+				`SELECT name FROM sqlite_master WHERE type = "index" AND tbl_name = "t1"`, false, true},
+			{"SHOW KEYS IN TABLE t1",
+				`SELECT name FROM sqlite_master WHERE type = "index" AND tbl_name = "t1"`, false, true},
+			{"TRUNCATE TABLE t1", "DELETE FROM t1", false, false},
+			{"TRUNCATE t1", "DELETE FROM t1", false, false},
+			{"INSERT IGNORE INTO t1 (k, v) VALUES (?, ?)",
+				"INSERT OR IGNORE INTO t1 (k, v) VALUES (?, ?)", false, false},
+			{"REPLACE INTO t1 VALUES (1, 'a')", "REPLACE INTO t1 VALUES (1, 'a')", false, false},
+			{"CREATE INDEX i1 ON t1 (v)", "CREATE INDEX i1 ON t1 (v)", true, false},
+			{"CREATE TABLE t1 (k INT, v TEXT, PRIMARY KEY (k))",
+				"CREATE TABLE t1 (k INT, v TEXT, PRIMARY KEY (k))", true, false},
+			{"CREATE TABLE `t1` (`id` int(11) unsigned NOT NULL AUTO_INCREMENT, " +
+				"`name` varchar(64) NOT NULL DEFAULT '' COMMENT 'user''s name', " +
+				"PRIMARY KEY (`id`)) ENGINE=InnoDB AUTO_INCREMENT=10 DEFAULT CHARSET=utf8mb4",
+				"CREATE TABLE `t1` (`id` INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL, " +
+					"`name` varchar(64) NOT NULL DEFAULT '')", true, false},
+			{"CREATE TABLE IF NOT EXISTS t2 (id bigint primary key auto_increment, " +
+				"state enum('a', 'b') DEFAULT 'a', doc json, " +
+				"created datetime(3) DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3), " +
+				"UNIQUE KEY uk (doc(16)), KEY (state, created DESC), FULLTEXT KEY ft (doc), " +
+				"CONSTRAINT fk FOREIGN KEY idx (id) REFERENCES t1 (id) ON DELETE CASCADE)",
+				"CREATE TABLE IF NOT EXISTS t2 (id INTEGER PRIMARY KEY AUTOINCREMENT, " +
+					"state TEXT DEFAULT 'a', doc TEXT, " +
+					"created datetime(3) DEFAULT CURRENT_TIMESTAMP, UNIQUE (doc), " +
+					"CONSTRAINT fk FOREIGN KEY (id) REFERENCES t1 (id) ON DELETE CASCADE); " +
+					"CREATE INDEX IF NOT EXISTS `t2_state_created` ON t2 (state, created DESC)",
+				true, false},
+			{"CREATE TEMPORARY TABLE t3 (a int, b int, KEY i3 (b), PRIMARY KEY (a, b))",
+				"CREATE TEMPORARY TABLE t3 (a int, b int, PRIMARY KEY (a, b)); " +
+					"CREATE INDEX i3 ON t3 (b)", true, false},
+			{"SELECT 1; DROP TABLE t1", "SELECT 1; DROP TABLE t1", true, false},
+		}
+		for _, c := range cases {
+			tr, err := Translate(context.Background(), c.query, nil)
+			So(err, ShouldBeNil)
+			So(tr.Query, ShouldEqual, c.want)
+			So(tr.ContainsDDL, ShouldEqual, c.ddl)
+			So(tr.ReadOnly, ShouldEqual, c.read)
+			So(IsReadOnly(c.query), ShouldEqual, c.read)
+		}
+	})
+	Convey("Given the invalid or unsupported statements", t, func() {
+		var cases = []struct {
+			query string
+			err   error
+		}{
+			{"", nil},
+			{"SELECT FROM", ErrInvalidQuery},
+			{"SELECT 'unterminated", ErrInvalidQuery},
+			{"INSERT INTO t1 (k, v) VALUES (1, 'a') ON DUPLICATE KEY UPDATE v = 'b'",
+				ErrUnsupportedStatement},
+		}
+		for _, c := range cases {
+			tr, err := Translate(context.Background(), c.query, nil)
+			if c.err == nil {
+				So(err, ShouldBeNil)
+				So(tr.Query, ShouldBeEmpty)
+				So(tr.ReadOnly, ShouldBeFalse)
+			} else {
+				So(errors.Cause(err), ShouldEqual, c.err)
+			}
+			So(IsReadOnly(c.query), ShouldBeFalse)
+		}
+	})
+}
@@ -0,0 +1,25 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package dialect translates the MySQL dialect statements to SQLite, so that the queries of MySQL
+// clients and tools can be executed by the SQLite storage of the database.
+//
+// The statements are parsed by the vendored sqlparser, which covers a subset of the MySQL
+// grammar. The clauses beyond the grammar, e.g. ON DUPLICATE KEY UPDATE, are separated on the
+// token stream before parsing, and the translation is applied as edits on the original statement
+// text, so the statements without MySQL specific syntax, including their placeholders, are kept
+// as is.
+package dialect
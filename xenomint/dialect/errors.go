@@ -14,17 +14,13 @@
  * limitations under the License.
  */
 
-package sqlchain
+package dialect
 
-import "github.com/CovenantSQL/CovenantSQL/proto"
+import "errors"
 
-// BlockID is the hash of block content
-type BlockID string
-
-// StorageProofBlock records block's status
-type StorageProofBlock struct {
-	// Block id
-	ID BlockID
-	// Nodes with index in the SQL chain.
-	Nodes []proto.Node
-}
+var (
+	// ErrInvalidQuery indicates that the query can not be tokenized or parsed.
+	ErrInvalidQuery = errors.New("invalid query")
+	// ErrUnsupportedStatement indicates that the statement can not be translated to SQLite.
+	ErrUnsupportedStatement = errors.New("unsupported statement")
+)
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dialect
+
+import (
+	"context"
+	"strings"
+
+	"github.com/CovenantSQL/sqlparser"
+	"github.com/pkg/errors"
+)
+
+// translateOnDuplicate returns the edit translating the ON DUPLICATE KEY UPDATE clause to the
+// SQLite upsert clause. The conflict target is the first unique key of the table covered by the
+// insert columns, the primary key goes first.
+func (s *statement) translateOnDuplicate(ctx context.Context, stmt *sqlparser.Insert, q Querier) (
+	e edit, err error,
+) {
+	var table = stmt.Table.Name.String()
+
+	if _, ok := stmt.Rows.(sqlparser.Values); !ok {
+		err = errors.Wrap(ErrUnsupportedStatement, "ON DUPLICATE KEY UPDATE requires VALUES rows")
+		return
+	}
+	if q == nil {
+		err = errors.Wrap(ErrUnsupportedStatement, "ON DUPLICATE KEY UPDATE requires the table schema")
+		return
+	}
+
+	var keys [][]string
+	if keys, err = uniqueKeys(ctx, q, table); err != nil {
+		return
+	}
+
+	var columns = make(map[string]bool, len(stmt.Columns))
+	for _, c := range stmt.Columns {
+		columns[c.Lowered()] = true
+	}
+
+	var target []string
+	for _, key := range keys {
+		covered := true
+		for _, c := range key {
+			if len(columns) > 0 && !columns[strings.ToLower(c)] {
+				covered = false
+				break
+			}
+		}
+		if covered {
+			target = key
+			break
+		}
+	}
+	if target == nil {
+		err = errors.Wrapf(ErrUnsupportedStatement,
+			"no unique key of table %s covered by the insert columns", table)
+		return
+	}
+
+	for i, c := range target {
+		target[i] = quoteIdentifier(c)
+	}
+
+	e = edit{
+		start: s.tokens[s.onDup].start,
+		end:   s.tokens[s.onDup+3].end,
+		text:  "ON CONFLICT (" + strings.Join(target, ", ") + ") DO UPDATE SET",
+	}
+	return
+}
+
+// quoteIdentifier quotes name as a SQLite identifier.
+func quoteIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
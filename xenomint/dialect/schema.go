@@ -0,0 +1,80 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dialect
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// uniqueKeys returns the columns of the primary key and the unique indexes of table, the primary
+// key goes first.
+func uniqueKeys(ctx context.Context, q Querier, table string) (keys [][]string, err error) {
+	var pk []string
+	if pk, err = queryNames(ctx, q,
+		`SELECT name FROM pragma_table_info(?) WHERE pk > 0 ORDER BY pk`, table,
+	); err != nil {
+		err = errors.Wrapf(err, "query primary key of table %s failed", table)
+		return
+	}
+	if len(pk) > 0 {
+		keys = append(keys, pk)
+	}
+
+	var indexes []string
+	if indexes, err = queryNames(ctx, q,
+		`SELECT name FROM pragma_index_list(?) WHERE "unique" AND origin <> 'pk' AND NOT partial `+
+			`ORDER BY seq DESC`, table,
+	); err != nil {
+		err = errors.Wrapf(err, "query unique indexes of table %s failed", table)
+		return
+	}
+	for _, index := range indexes {
+		var columns []string
+		if columns, err = queryNames(ctx, q,
+			`SELECT name FROM pragma_index_info(?) ORDER BY seqno`, index,
+		); err != nil {
+			err = errors.Wrapf(err, "query columns of index %s failed", index)
+			return
+		}
+		keys = append(keys, columns)
+	}
+
+	return
+}
+
+func queryNames(ctx context.Context, q Querier, query string, args ...interface{}) (
+	names []string, err error,
+) {
+	var rows *sql.Rows
+	if rows, err = q.QueryContext(ctx, query, args...); err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return
+		}
+		names = append(names, name)
+	}
+	err = rows.Err()
+	return
+}
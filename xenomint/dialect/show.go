@@ -0,0 +1,90 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dialect
+
+import (
+	"strings"
+
+	"github.com/CovenantSQL/sqlparser"
+)
+
+var (
+	// informationSchemaTables defines the emulated information_schema tables on the SQLite schema.
+	informationSchemaTables = map[string]string{
+		"tables": `SELECT 'def' AS TABLE_CATALOG, 'main' AS TABLE_SCHEMA, name AS TABLE_NAME, ` +
+			`CASE type WHEN 'view' THEN 'VIEW' ELSE 'BASE TABLE' END AS TABLE_TYPE, ` +
+			`'SQLite' AS ENGINE, NULL AS TABLE_ROWS, NULL AS AUTO_INCREMENT, ` +
+			`'' AS TABLE_COMMENT ` +
+			`FROM sqlite_master WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite\_%' ESCAPE '\'`,
+		"columns": `SELECT 'def' AS TABLE_CATALOG, 'main' AS TABLE_SCHEMA, m.name AS TABLE_NAME, ` +
+			`p.name AS COLUMN_NAME, p.cid + 1 AS ORDINAL_POSITION, p.dflt_value AS COLUMN_DEFAULT, ` +
+			`CASE WHEN p."notnull" THEN 'NO' ELSE 'YES' END AS IS_NULLABLE, ` +
+			`lower(trim(substr(p.type, 1, instr(p.type || '(', '(') - 1))) AS DATA_TYPE, ` +
+			`lower(p.type) AS COLUMN_TYPE, CASE WHEN p.pk > 0 THEN 'PRI' ELSE '' END AS COLUMN_KEY, ` +
+			`'' AS EXTRA, '' AS COLUMN_COMMENT ` +
+			`FROM sqlite_master AS m, pragma_table_info(m.name) AS p ` +
+			`WHERE m.type = 'table' AND m.name NOT LIKE 'sqlite\_%' ESCAPE '\'`,
+	}
+)
+
+// translateShow returns the SQLite query of the SHOW statement, or an empty string if not
+// supported.
+func translateShow(stmt *sqlparser.Show) (query string) {
+	switch stmt.Type {
+	case "table":
+		if stmt.ShowCreate {
+			query = "SELECT sql FROM sqlite_master WHERE type = \"table\" AND tbl_name = \"" +
+				stmt.OnTable.Name.String() + "\""
+		} else {
+			query = "PRAGMA table_info(" + stmt.OnTable.Name.String() + ")"
+		}
+	case "index":
+		query = "SELECT name FROM sqlite_master WHERE type = \"index\" AND tbl_name = \"" +
+			stmt.OnTable.Name.String() + "\""
+	case "tables":
+		query = "SELECT name FROM sqlite_master WHERE type = \"table\" AND name NOT LIKE 'sqlite\\_%' ESCAPE '\\'"
+	}
+	return
+}
+
+// normalizeInformationSchema rewrites the information_schema table reference at tokens[i] to the
+// emulated table, it returns the index of the last token of the reference.
+func (s *statement) normalizeInformationSchema(i int) (last int) {
+	var (
+		toks  = s.tokens
+		name  = &toks[i+2]
+		table = strings.ToLower(name.val)
+	)
+
+	last = i + 2
+	derived, ok := informationSchemaTables[table]
+	if !ok || !name.isName() {
+		return
+	}
+
+	// the keyword table names are quoted for the parser
+	s.parse = append(s.parse, edit{start: name.start, end: name.end, text: "`" + table + "`"})
+
+	// the emulated table is aliased as the original table if no alias is specified
+	text := "(" + derived + ")"
+	if last+1 >= len(toks) || !(toks[last+1].is("as") || toks[last+1].typ == sqlparser.ID) {
+		text += " AS `" + table + "`"
+	}
+	s.output = append(s.output, edit{start: toks[i].start, end: name.end, text: text})
+
+	return
+}
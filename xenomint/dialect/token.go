@@ -0,0 +1,225 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dialect
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/CovenantSQL/sqlparser"
+	"github.com/pkg/errors"
+)
+
+// token is a lexical token of a statement, start and end are the byte offsets in the statement.
+type token struct {
+	typ        int
+	val        string
+	start, end int
+	quoted     bool // quoted identifier or string
+}
+
+// is reports whether the token is one of the unquoted words, case insensitively.
+func (t *token) is(words ...string) bool {
+	if t.quoted {
+		return false
+	}
+	for _, w := range words {
+		if strings.EqualFold(t.val, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// isChar reports whether the token is the single char operator c.
+func (t *token) isChar(c byte) bool {
+	return t.typ == int(c)
+}
+
+// isName reports whether the token can be an identifier, unquoted keywords are included.
+func (t *token) isName() bool {
+	return t.typ == sqlparser.ID || (!t.quoted && t.val != "" && t.typ != sqlparser.STRING &&
+		t.typ != sqlparser.VALUE_ARG && !isNumber(t.val))
+}
+
+func isNumber(s string) bool {
+	return s[0] >= '0' && s[0] <= '9'
+}
+
+// tokenize scans the tokens of text, comments are skipped.
+func tokenize(text string) (tokens []token, err error) {
+	var tkn = sqlparser.NewStringTokenizer(text)
+
+	for {
+		start := tkn.Position - 1
+		if start < 0 {
+			start = 0
+		}
+		typ, val := tkn.Scan()
+		if typ == 0 {
+			return
+		}
+		if typ == sqlparser.LEX_ERROR {
+			err = errors.Wrapf(ErrInvalidQuery, "unexpected char at position %d", tkn.Position-1)
+			return
+		}
+		if typ == sqlparser.COMMENT {
+			continue
+		}
+
+		// skip the blanks before token
+		for start < len(text) && strings.IndexByte(" \t\r\n", text[start]) >= 0 {
+			start++
+		}
+		end := tkn.Position - 1
+		if end > len(text) {
+			end = len(text)
+		}
+		tokens = append(tokens, token{
+			typ:    typ,
+			val:    string(val),
+			start:  start,
+			end:    end,
+			quoted: start < len(text) && strings.IndexByte("`'\"", text[start]) >= 0,
+		})
+	}
+}
+
+// splitStatements splits query into statement texts by the semicolons, the comments around the
+// statements are dropped.
+func splitStatements(query string) (stmts []string, err error) {
+	var tokens []token
+	if tokens, err = tokenize(query); err != nil {
+		return
+	}
+
+	var first = -1
+	for i, t := range tokens {
+		if t.isChar(';') {
+			if first >= 0 {
+				stmts = append(stmts, query[tokens[first].start:tokens[i-1].end])
+			}
+			first = -1
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+	}
+	if first >= 0 {
+		stmts = append(stmts, query[tokens[first].start:tokens[len(tokens)-1].end])
+	}
+
+	return
+}
+
+// edit replaces the text in range [start, end) of a statement.
+type edit struct {
+	start, end int
+	text       string
+}
+
+// applyEdits applies the non-overlapping edits to text.
+func applyEdits(text string, edits []edit) string {
+	if len(edits) == 0 {
+		return text
+	}
+
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+
+	var (
+		buf  strings.Builder
+		last int
+	)
+	for _, e := range edits {
+		buf.WriteString(text[last:e.start])
+		buf.WriteString(e.text)
+		last = e.end
+	}
+	buf.WriteString(text[last:])
+
+	return buf.String()
+}
+
+// render returns the text of tokens in text, the string literals are quoted in SQLite style.
+func render(text string, tokens []token) string {
+	if len(tokens) == 0 {
+		return ""
+	}
+
+	var edits []edit
+	for _, t := range tokens {
+		if t.typ == sqlparser.STRING {
+			edits = append(edits, edit{start: t.start, end: t.end, text: quoteString(t.val)})
+		}
+	}
+
+	var (
+		start = tokens[0].start
+		end   = tokens[len(tokens)-1].end
+	)
+	for i := range edits {
+		edits[i].start -= start
+		edits[i].end -= start
+	}
+
+	return applyEdits(text[start:end], edits)
+}
+
+// quoteString quotes s as a SQLite string literal.
+func quoteString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// group returns the index of the closing parenthesis matching the opening one at tokens[i].
+func group(tokens []token, i int) (end int, ok bool) {
+	var depth int
+	for j := i; j < len(tokens); j++ {
+		switch {
+		case tokens[j].isChar('('):
+			depth++
+		case tokens[j].isChar(')'):
+			if depth--; depth == 0 {
+				return j, true
+			}
+		}
+	}
+	return
+}
+
+// splitList splits tokens by the commas outside of parentheses.
+func splitList(tokens []token) (items [][]token) {
+	var (
+		depth int
+		last  int
+	)
+	for i, t := range tokens {
+		switch {
+		case t.isChar('('):
+			depth++
+		case t.isChar(')'):
+			depth--
+		case t.isChar(',') && depth == 0:
+			items = append(items, tokens[last:i])
+			last = i + 1
+		}
+	}
+	if last < len(tokens) {
+		items = append(items, tokens[last:])
+	}
+	return
+}
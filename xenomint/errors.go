@@ -35,4 +35,12 @@ var (
 	ErrLocalBehindRemote = errors.New("local state is behind the remote")
 	// ErrMuxServiceNotFound indicates that the multiplexing service endpoint is not found.
 	ErrMuxServiceNotFound = errors.New("mux service not found")
+	// ErrTxConflict indicates that another interactive transaction is still open.
+	ErrTxConflict = errors.New("interactive transaction conflict")
+	// ErrTxNotFound indicates that the interactive transaction is not found, it may be already
+	// committed, rolled back or aborted due to timeout.
+	ErrTxNotFound = errors.New("interactive transaction not found")
+	// ErrTxMismatch indicates that the committing request mismatches the writes executed in the
+	// interactive transaction.
+	ErrTxMismatch = errors.New("interactive transaction mismatch")
 )
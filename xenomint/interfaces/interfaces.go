@@ -18,13 +18,25 @@ package interfaces
 
 import (
 	"database/sql"
+	"io"
 )
 
 // Storage is the interface implemented by an object that returns standard *sql.DB as DirtyReader,
 // Reader, or Writer and can be closed by Close.
+//
+// Snapshot writes a consistent image of the committed data to w, which can be loaded as a new
+// storage file by the same engine, or replace the data of a storage by Restore, which requires
+// that the writer has no open transaction. Backup copies the committed data to a new storage file
+// at filename online, without blocking the writer; pinned, if not nil, is called once the copied
+// image is fixed, so that the commits after it are known to be excluded. Size reports the current
+// data size in bytes.
 type Storage interface {
 	DirtyReader() *sql.DB
 	Reader() *sql.DB
 	Writer() *sql.DB
+	Snapshot(w io.Writer) error
+	Restore(r io.Reader) error
+	Backup(filename string, pinned func()) error
+	Size() (int64, error)
 	Close() error
 }
@@ -0,0 +1,273 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
+)
+
+// txSession defines an interactive transaction session held open in the state.
+//
+// Writes executed in the session are speculative: they're applied to the uncommitted
+// transaction of the state, so that the session can read its own writes, and rolled back
+// when the session ends. A committing request carrying the same writes should be applied as a
+// normal write request thereafter, which is then replicated and packed into block as usual.
+//
+// The speculative writes are never exposed to the queries out of the session: while a session is
+// open, the normal reads and cursors are served from the committed data of the storage instead of
+// the dirty reader, and a dirty cursor opened before the session can't be fetched any more.
+type txSession struct {
+	nodeID proto.NodeID
+	txID   uint64
+	origin uint64        // origin is the savepoint before the speculative writes
+	writes []types.Query // writes is the write queries executed in the session
+}
+
+// txSavepoint is the savepoint name of the session origin. Note that state savepoints are all
+// set with the same name, so a dedicated one is required to discard all the speculative writes.
+const txSavepoint = `SAVEPOINT "tx"`
+
+func (t *txSession) match(req *types.Request) bool {
+	return t != nil && t.nodeID == req.Header.NodeID && t.txID == req.Header.TxID
+}
+
+// QueryInTx executes the interactive transaction operation of req, which should be one of
+// TxBegin, TxExec and TxRollback. Only one session is allowed at the same time, the caller
+// should make sure that no other write is applied to the state while a session is open.
+func (s *State) QueryInTx(ctx context.Context, req *types.Request) (resp *types.Response, err error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.closed {
+		err = ErrStateClosed
+		return
+	}
+	switch req.Header.TxOp {
+	case types.TxBegin:
+		if s.tx != nil {
+			err = errors.Wrapf(ErrTxConflict, "tx %d of %s is still open", s.tx.txID, s.tx.nodeID)
+			return
+		}
+		s.setTx(&txSession{
+			nodeID: req.Header.NodeID,
+			txID:   req.Header.TxID,
+			origin: s.getID(),
+		})
+		s.beginTx()
+		if resp, err = s.execInTx(ctx, req); err != nil {
+			// a failed begin leaves no speculative write, just drop the session
+			s.endTx()
+		}
+	case types.TxExec:
+		if !s.tx.match(req) {
+			err = errors.Wrapf(ErrTxNotFound, "tx %d of %s", req.Header.TxID, req.Header.NodeID)
+			return
+		}
+		resp, err = s.execInTx(ctx, req)
+	case types.TxRollback:
+		if !s.tx.match(req) {
+			err = errors.Wrapf(ErrTxNotFound, "tx %d of %s", req.Header.TxID, req.Header.NodeID)
+			return
+		}
+		s.endTx()
+		resp = s.buildTxResponse(req, nil, nil, nil, nil, 0, 0)
+	default:
+		err = errors.Wrapf(ErrInvalidRequest, "unexpected tx op %s", req.Header.TxOp)
+	}
+	return
+}
+
+// ReleaseTx ends the interactive transaction session to be committed by req and rolls back
+// its speculative writes. It checks that req carries exactly the writes executed in the
+// session, the request should then be applied as a normal write request.
+func (s *State) ReleaseTx(req *types.Request) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	if !s.tx.match(req) {
+		err = errors.Wrapf(ErrTxNotFound, "tx %d of %s", req.Header.TxID, req.Header.NodeID)
+		return
+	}
+	var (
+		expected = types.RequestPayload{Queries: s.tx.writes}
+		eh, ah   []byte
+	)
+	s.endTx()
+	if eh, err = expected.MarshalHash(); err != nil {
+		return
+	}
+	if ah, err = req.Payload.MarshalHash(); err != nil {
+		return
+	}
+	if !bytes.Equal(eh, ah) {
+		err = errors.Wrapf(ErrTxMismatch, "tx %d of %s", req.Header.TxID, req.Header.NodeID)
+	}
+	return
+}
+
+// RollbackTx rolls back the interactive transaction session if it is still open, it is used
+// to clean up abandoned sessions.
+func (s *State) RollbackTx(nodeID proto.NodeID, txID uint64) {
+	s.Lock()
+	defer s.Unlock()
+	if s.tx != nil && s.tx.nodeID == nodeID && s.tx.txID == txID {
+		s.endTx()
+	}
+}
+
+func (s *State) execInTx(ctx context.Context, req *types.Request) (resp *types.Response, err error) {
+	var (
+		ierr              error
+		savepoint         = s.getID()
+		writes            = len(s.tx.writes)
+		cnames, ctypes    []string
+		cmetas            []types.ColumnMeta
+		data              [][]interface{}
+		totalAffectedRows int64
+		curAffectedRows   int64
+		lastInsertID      int64
+	)
+	for i, v := range req.Payload.Queries {
+		switch req.Header.QueryType {
+		case types.ReadQuery:
+			if cnames, ctypes, cmetas, data, ierr = readSingle(ctx, s.unc, &v); ierr != nil {
+				err = errors.Wrapf(ierr, "query at #%d failed", i)
+				return
+			}
+		case types.WriteQuery:
+			var res sql.Result
+			// an interrupted write rolls back the whole uncommitted transaction in sqlite, so
+			// speculative writes are never canceled by the request context
+			if res, ierr = s.writeSingle(context.Background(), &v); ierr != nil {
+				err = errors.Wrapf(ierr, "execute at #%d failed", i)
+				// only the failed request is rolled back, the session is kept open
+				s.rollbackTo(savepoint)
+				s.tx.writes = s.tx.writes[:writes]
+				return
+			}
+			curAffectedRows, _ = res.RowsAffected()
+			lastInsertID, _ = res.LastInsertId()
+			totalAffectedRows += curAffectedRows
+			s.tx.writes = append(s.tx.writes, v)
+		default:
+			err = errors.Wrapf(ErrInvalidRequest, "unexpected query type %s", req.Header.QueryType)
+			return
+		}
+	}
+	if req.Header.QueryType == types.WriteQuery {
+		s.setSavepoint()
+	}
+	resp = s.buildTxResponse(req, cnames, ctypes, cmetas, data, totalAffectedRows, lastInsertID)
+	return
+}
+
+func (s *State) buildTxResponse(
+	req *types.Request, cnames, ctypes []string, cmetas []types.ColumnMeta, data [][]interface{},
+	affectedRows, lastInsertID int64,
+) *types.Response {
+	return &types.Response{
+		Header: types.SignedResponseHeader{
+			ResponseHeader: types.ResponseHeader{
+				Request:      req.Header,
+				NodeID:       s.nodeID,
+				Timestamp:    s.getLocalTime(),
+				RowCount:     uint64(len(data)),
+				LogOffset:    s.getID(),
+				AffectedRows: affectedRows,
+				LastInsertID: lastInsertID,
+			},
+		},
+		Payload: types.ResponsePayload{
+			Columns:     cnames,
+			DeclTypes:   ctypes,
+			Rows:        buildRowsFromNativeData(data),
+			ColumnMetas: cmetas,
+		},
+	}
+}
+
+// beginTx marks the session origin on the uncommitted transaction.
+func (s *State) beginTx() {
+	s.unc.Exec(txSavepoint)
+	s.setSavepoint()
+}
+
+// discardTx rolls back all the speculative writes of the session.
+func (s *State) discardTx() {
+	s.unc.Exec(`ROLLBACK TO "tx"`)
+	s.unc.Exec(`RELEASE "tx"`)
+	s.rollbackID(s.tx.origin)
+}
+
+func (s *State) endTx() {
+	s.discardTx()
+	s.setTx(nil)
+}
+
+// setTx sets the open session, the in-flight dirty reads are waited before a session is opened.
+func (s *State) setTx(tx *txSession) {
+	s.txLock.Lock()
+	defer s.txLock.Unlock()
+	s.tx = tx
+}
+
+// lockDirtyRead locks the dirty reader for a read out of the session. It reports false if a
+// session is open, in which case the committed data should be read instead, otherwise the lock
+// should be released by s.txLock.RUnlock once the read is done.
+func (s *State) lockDirtyRead() bool {
+	s.txLock.RLock()
+	if s.tx != nil {
+		s.txLock.RUnlock()
+		return false
+	}
+	return true
+}
+
+// suspendTx rolls back the speculative writes of the open session, so that the uncommitted
+// transaction can be replayed or committed without them. It should be paired with resumeTx.
+func (s *State) suspendTx() {
+	if s.tx != nil {
+		s.discardTx()
+	}
+}
+
+// resumeTx re-executes the speculative writes of the open session on the current
+// transaction. The session is dropped if any of the writes fails.
+func (s *State) resumeTx(ctx context.Context) {
+	if s.tx == nil {
+		return
+	}
+	s.tx.origin = s.getID()
+	s.beginTx()
+	for i, v := range s.tx.writes {
+		if _, err := s.writeSingle(ctx, &v); err != nil {
+			log.WithFields(log.Fields{
+				"node": s.tx.nodeID,
+				"tx":   s.tx.txID,
+				"at":   i,
+			}).WithError(err).Warning("resume tx failed, session dropped")
+			s.endTx()
+			return
+		}
+	}
+	s.setSavepoint()
+}
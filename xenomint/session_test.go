@@ -0,0 +1,189 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func buildTxRequest(qt types.QueryType, op types.TxOp, txID uint64, qs []types.Query) *types.Request {
+	var req = buildRequest(qt, qs)
+	req.Header.TxID = txID
+	req.Header.TxOp = op
+	return req
+}
+
+func TestInteractiveTx(t *testing.T) {
+	Convey("Given a chain state object with a basic KV table", t, func() {
+		var (
+			fl     = path.Join(testingDataDir, t.Name())
+			nodeID = proto.NodeID("0000000000000000000000000000000000000000000000000000000000000000")
+			st     *State
+			resp   *types.Response
+			err    error
+			count  = func() int64 {
+				_, resp, err := st.Query(buildRequest(types.ReadQuery, []types.Query{
+					buildQuery(`SELECT COUNT(1) FROM t1`),
+				}))
+				So(err, ShouldBeNil)
+				return resp.Payload.Rows[0].Values[0].(int64)
+			}
+			countInTx = func() int64 {
+				resp, err := st.QueryInTx(context.Background(), buildTxRequest(types.ReadQuery, types.TxExec, 1, []types.Query{
+					buildQuery(`SELECT COUNT(1) FROM t1`),
+				}))
+				So(err, ShouldBeNil)
+				return resp.Payload.Rows[0].Values[0].(int64)
+			}
+		)
+		strg, err := xs.NewSqlite(fmt.Sprint("file:", fl))
+		So(err, ShouldBeNil)
+		st, err = NewState(nodeID, strg)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			err = st.Close(true)
+			So(err, ShouldBeNil)
+			err = os.Remove(fl)
+			So(err, ShouldBeNil)
+			os.Remove(fmt.Sprint(fl, "-shm"))
+			os.Remove(fmt.Sprint(fl, "-wal"))
+		})
+		_, _, err = st.Query(buildRequest(types.WriteQuery, []types.Query{
+			buildQuery(`CREATE TABLE t1 (k INT, v TEXT, PRIMARY KEY(k))`),
+			buildQuery(`INSERT INTO t1 (k, v) VALUES (?, ?)`, 1, "v1"),
+		}))
+		So(err, ShouldBeNil)
+		err = st.commit()
+		So(err, ShouldBeNil)
+		var origin = st.getID()
+
+		Convey("A dirty cursor should not be fetched while a session is open", func() {
+			_, _, err = st.Query(buildRequest(types.WriteQuery, []types.Query{
+				buildQuery(`INSERT INTO t1 (k, v) VALUES (?, ?)`, 2, "v2"),
+				buildQuery(`INSERT INTO t1 (k, v) VALUES (?, ?)`, 3, "v3"),
+			}))
+			So(err, ShouldBeNil)
+			_, cur, resp, err := st.QueryCursor(context.Background(), buildRequest(
+				types.ReadQuery, []types.Query{buildQuery(`SELECT k FROM t1`)}), 1)
+			So(err, ShouldBeNil)
+			So(cur, ShouldNotBeNil)
+			defer cur.Close()
+			So(resp.Payload.Rows, ShouldHaveLength, 1)
+			_, err = st.QueryInTx(context.Background(), buildTxRequest(types.WriteQuery, types.TxBegin, 1, []types.Query{
+				buildQuery(`INSERT INTO t1 (k, v) VALUES (?, ?)`, 4, "v4"),
+			}))
+			So(err, ShouldBeNil)
+			_, _, err = cur.Next(context.Background(), 10)
+			So(errors.Cause(err), ShouldEqual, ErrTxConflict)
+			_, err = st.QueryInTx(context.Background(), buildTxRequest(types.WriteQuery, types.TxRollback, 1, nil))
+			So(err, ShouldBeNil)
+			rows, done, err := cur.Next(context.Background(), 10)
+			So(err, ShouldBeNil)
+			So(done, ShouldBeTrue)
+			So(rows, ShouldHaveLength, 2)
+		})
+
+		Convey("The session should be able to read its own writes", func() {
+			resp, err = st.QueryInTx(context.Background(), buildTxRequest(types.WriteQuery, types.TxBegin, 1, []types.Query{
+				buildQuery(`INSERT INTO t1 (k, v) VALUES (?, ?)`, 2, "v2"),
+			}))
+			So(err, ShouldBeNil)
+			So(resp.Header.AffectedRows, ShouldEqual, 1)
+			resp, err = st.QueryInTx(context.Background(), buildTxRequest(types.ReadQuery, types.TxExec, 1, []types.Query{
+				buildQuery(`SELECT v FROM t1 WHERE k=?`, 2),
+			}))
+			So(err, ShouldBeNil)
+			So(resp.Payload.Rows, ShouldHaveLength, 1)
+			So(resp.Payload.Rows[0].Values[0], ShouldResemble, []byte("v2"))
+
+			Convey("Another session should not be opened", func() {
+				_, err = st.QueryInTx(context.Background(), buildTxRequest(types.ReadQuery, types.TxBegin, 2, nil))
+				So(errors.Cause(err), ShouldEqual, ErrTxConflict)
+			})
+			Convey("A failed write should not end the session", func() {
+				_, err = st.QueryInTx(context.Background(), buildTxRequest(types.WriteQuery, types.TxExec, 1, []types.Query{
+					buildQuery(`INSERT INTO t1 (k, v) VALUES (?, ?)`, 2, "v2"),
+				}))
+				So(err, ShouldNotBeNil)
+				So(st.tx.writes, ShouldHaveLength, 1)
+				So(countInTx(), ShouldEqual, 2)
+			})
+			Convey("The speculative writes should be discarded on rollback", func() {
+				_, err = st.QueryInTx(context.Background(), buildTxRequest(types.WriteQuery, types.TxRollback, 1, nil))
+				So(err, ShouldBeNil)
+				So(st.getID(), ShouldEqual, origin)
+				So(count(), ShouldEqual, 1)
+				_, err = st.QueryInTx(context.Background(), buildTxRequest(types.ReadQuery, types.TxExec, 1, nil))
+				So(errors.Cause(err), ShouldEqual, ErrTxNotFound)
+			})
+			Convey("The speculative writes should be kept across block producing", func() {
+				_, _, err = st.CommitEx()
+				So(err, ShouldBeNil)
+				So(countInTx(), ShouldEqual, 2)
+				st.RollbackTx(nodeID, 1)
+				So(count(), ShouldEqual, 1)
+			})
+			Convey("The speculative writes should not be read by other clients", func() {
+				So(count(), ShouldEqual, 1)
+				_, resp, err = st.Query(buildRequest(types.ReadQuery, []types.Query{
+					buildQuery(`SELECT v FROM t1 WHERE k=?`, 2),
+				}))
+				So(err, ShouldBeNil)
+				So(resp.Payload.Rows, ShouldBeEmpty)
+				So(resp.Header.LogOffset, ShouldEqual, origin)
+				_, cur, resp, err := st.QueryCursor(context.Background(), buildRequest(
+					types.ReadQuery, []types.Query{buildQuery(`SELECT k FROM t1`)}), 1)
+				So(err, ShouldBeNil)
+				So(cur, ShouldBeNil)
+				So(resp.Payload.Rows, ShouldHaveLength, 1)
+				_, err = st.QueryInTx(context.Background(), buildTxRequest(types.WriteQuery, types.TxRollback, 1, nil))
+				So(err, ShouldBeNil)
+				So(count(), ShouldEqual, 1)
+			})
+			Convey("The session should be released with the matched commit request", func() {
+				err = st.ReleaseTx(buildTxRequest(types.WriteQuery, types.TxCommit, 1, []types.Query{
+					buildQuery(`INSERT INTO t1 (k, v) VALUES (?, ?)`, 3, "v3"),
+				}))
+				So(errors.Cause(err), ShouldEqual, ErrTxMismatch)
+				So(st.tx, ShouldBeNil)
+				So(count(), ShouldEqual, 1)
+			})
+			Convey("The committed writes should be applied as normal write", func() {
+				var req = buildTxRequest(types.WriteQuery, types.TxCommit, 1, []types.Query{
+					buildQuery(`INSERT INTO t1 (k, v) VALUES (?, ?)`, 2, "v2"),
+				})
+				err = st.ReleaseTx(req)
+				So(err, ShouldBeNil)
+				So(count(), ShouldEqual, 1)
+				_, resp, err = st.Query(req)
+				So(err, ShouldBeNil)
+				So(resp.Header.LogOffset, ShouldEqual, origin)
+				So(count(), ShouldEqual, 2)
+			})
+		})
+	})
+}
@@ -0,0 +1,215 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/storage"
+	"github.com/CovenantSQL/go-sqlite3-encrypt"
+	"github.com/pkg/errors"
+)
+
+const (
+	// backupRetryInterval defines the wait interval before retrying a locked backup step.
+	backupRetryInterval = 10 * time.Millisecond
+)
+
+var (
+	// BackupBusyTimeout defines the max time to wait for a locked backup source.
+	BackupBusyTimeout = 10 * time.Second
+
+	// ErrBackupBusy indicates that the backup source keeps locked until timeout.
+	ErrBackupBusy = errors.New("backup source is busy")
+)
+
+// backup copies the main database of src to the database file described by dst, which is a
+// sqlite3 DSN and may carry the same parameters as the source, e.g. _crypto_key.
+//
+// If pinned is not nil, the copy runs in a read transaction of src, and pinned is called as soon
+// as the transaction holds its snapshot. The source must isolate readers from the writer, e.g.
+// a private cache in WAL mode, so that the later commits don't block on or leak into the copy.
+func backup(src *sql.DB, dst string, pinned func()) (err error) {
+	var (
+		ctx    = context.Background()
+		dstDB  *sql.DB
+		sc, dc *sql.Conn
+	)
+	if dstDB, err = sql.Open(serializableDriver, dst); err != nil {
+		err = errors.Wrap(err, "open backup destination failed")
+		return
+	}
+	defer dstDB.Close()
+	if dc, err = dstDB.Conn(ctx); err != nil {
+		err = errors.Wrap(err, "connect backup destination failed")
+		return
+	}
+	defer dc.Close()
+	if sc, err = src.Conn(ctx); err != nil {
+		err = errors.Wrap(err, "connect backup source failed")
+		return
+	}
+	defer sc.Close()
+	if pinned != nil {
+		if _, err = sc.ExecContext(ctx, "BEGIN"); err != nil {
+			err = errors.Wrap(err, "begin backup transaction failed")
+			return
+		}
+		defer sc.ExecContext(ctx, "ROLLBACK")
+		// the read transaction takes its snapshot on the first read
+		var n int64
+		if err = sc.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master").Scan(&n); err != nil {
+			err = errors.Wrap(err, "pin backup snapshot failed")
+			return
+		}
+		pinned()
+	}
+
+	return copyPages(dc, sc)
+}
+
+// copyPages copies all pages of the main database of the connection sc to the connection dc.
+func copyPages(dc, sc *sql.Conn) error {
+	return dc.Raw(func(dconn interface{}) error {
+		return sc.Raw(func(sconn interface{}) (err error) {
+			var (
+				d, dok = dconn.(*sqlite3.SQLiteConn)
+				s, sok = sconn.(*sqlite3.SQLiteConn)
+				b      *sqlite3.SQLiteBackup
+				done   bool
+				expire = time.Now().Add(BackupBusyTimeout)
+			)
+			if !dok || !sok {
+				return errors.New("unexpected driver connection type")
+			}
+			if b, err = d.Backup("main", s, "main"); err != nil {
+				return errors.Wrap(err, "init backup failed")
+			}
+			// copy all pages in a single step to get a consistent image, the step returns
+			// without progress if the source is locked
+			for !done {
+				if done, err = b.Step(-1); err != nil {
+					b.Finish()
+					return errors.Wrap(err, "backup step failed")
+				}
+				if !done {
+					if time.Now().After(expire) {
+						b.Finish()
+						return ErrBackupBusy
+					}
+					time.Sleep(backupRetryInterval)
+				}
+			}
+			return errors.Wrap(b.Finish(), "finish backup failed")
+		})
+	})
+}
+
+// snapshot writes the image of the main database of src to w through a temporary database file
+// described by dsn with its file name replaced.
+func snapshot(src *sql.DB, dsn *storage.DSN, w io.Writer) (err error) {
+	var (
+		tmp *os.File
+		fl  string
+	)
+	if tmp, err = ioutil.TempFile("", "xenomint-snapshot-"); err != nil {
+		err = errors.Wrap(err, "create snapshot file failed")
+		return
+	}
+	fl = tmp.Name()
+	tmp.Close()
+	defer os.Remove(fl)
+
+	var tmpDSN = dsn.Clone()
+	tmpDSN.SetFileName(fl)
+	if err = backup(src, tmpDSN.Format(), nil); err != nil {
+		return
+	}
+	if tmp, err = os.Open(fl); err != nil {
+		err = errors.Wrap(err, "open snapshot file failed")
+		return
+	}
+	defer tmp.Close()
+	if _, err = io.Copy(w, tmp); err != nil {
+		err = errors.Wrap(err, "write snapshot failed")
+	}
+	return
+}
+
+// restore replaces the main database of dst with the image read from r, which is written by
+// snapshot with the same dsn parameters.
+func restore(dst *sql.DB, dsn *storage.DSN, r io.Reader) (err error) {
+	var (
+		ctx    = context.Background()
+		tmp    *os.File
+		fl     string
+		srcDB  *sql.DB
+		sc, dc *sql.Conn
+	)
+	if tmp, err = ioutil.TempFile("", "xenomint-restore-"); err != nil {
+		err = errors.Wrap(err, "create restore file failed")
+		return
+	}
+	fl = tmp.Name()
+	defer os.Remove(fl)
+	_, err = io.Copy(tmp, r)
+	tmp.Close()
+	if err != nil {
+		err = errors.Wrap(err, "read snapshot failed")
+		return
+	}
+
+	var tmpDSN = dsn.Clone()
+	tmpDSN.SetFileName(fl)
+	if srcDB, err = sql.Open(serializableDriver, tmpDSN.Format()); err != nil {
+		err = errors.Wrap(err, "open restore source failed")
+		return
+	}
+	defer srcDB.Close()
+	if sc, err = srcDB.Conn(ctx); err != nil {
+		err = errors.Wrap(err, "connect restore source failed")
+		return
+	}
+	defer sc.Close()
+	if dc, err = dst.Conn(ctx); err != nil {
+		err = errors.Wrap(err, "connect restore destination failed")
+		return
+	}
+	defer dc.Close()
+
+	return copyPages(dc, sc)
+}
+
+// size returns the main database size of db in bytes.
+func size(db *sql.DB) (n int64, err error) {
+	var pageCount, pageSize int64
+	if err = db.QueryRow("PRAGMA page_count").Scan(&pageCount); err != nil {
+		err = errors.Wrap(err, "query page count failed")
+		return
+	}
+	if err = db.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		err = errors.Wrap(err, "query page size failed")
+		return
+	}
+	n = pageCount * pageSize
+	return
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlite
+
+import (
+	"github.com/CovenantSQL/CovenantSQL/types"
+	xi "github.com/CovenantSQL/CovenantSQL/xenomint/interfaces"
+	"github.com/pkg/errors"
+)
+
+// ErrUnknownEngine indicates that the storage engine is not supported.
+var ErrUnknownEngine = errors.New("unknown storage engine")
+
+// NewStorage returns a new storage instance of the engine attached to filename, an empty engine
+// name selects the default on-disk engine.
+func NewStorage(engine types.StorageEngine, filename string) (s xi.Storage, err error) {
+	switch engine {
+	case types.StorageEngineDefault, types.StorageEngineSQLite:
+		var strg *SQLite3
+		if strg, err = NewSqlite(filename); err != nil {
+			return
+		}
+		s = strg
+	case types.StorageEngineMemory:
+		var strg *Memory
+		if strg, err = NewMemory(filename); err != nil {
+			return
+		}
+		s = strg
+	default:
+		err = errors.Wrapf(ErrUnknownEngine, "engine %s", engine)
+	}
+	return
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlite
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/types"
+	xi "github.com/CovenantSQL/CovenantSQL/xenomint/interfaces"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func countRows(filename string) (count int, err error) {
+	var st *SQLite3
+	if st, err = NewSqlite(filename); err != nil {
+		return
+	}
+	defer st.Close()
+	err = st.Reader().QueryRow(`SELECT COUNT(1) FROM "t1"`).Scan(&count)
+	return
+}
+
+func TestStorageEngines(t *testing.T) {
+	for _, engine := range []types.StorageEngine{
+		types.StorageEngineDefault, types.StorageEngineSQLite, types.StorageEngineMemory,
+	} {
+		Convey(fmt.Sprintf("Given a storage instance of engine %#v", engine), t, func() {
+			const rows = 100
+			var (
+				fl  = path.Join(testingDataDir, fmt.Sprint(t.Name(), "-", engine))
+				st  xi.Storage
+				n   int64
+				err error
+			)
+			st, err = NewStorage(engine, fmt.Sprint("file:", fl))
+			So(err, ShouldBeNil)
+			Reset(func() {
+				err = st.Close()
+				So(err, ShouldBeNil)
+				for _, v := range []string{fl, fl + ".bak", fl + ".snap"} {
+					os.Remove(v)
+					os.Remove(v + "-shm")
+					os.Remove(v + "-wal")
+				}
+			})
+			_, err = st.Writer().Exec(`CREATE TABLE "t1" ("k" INT, "v" TEXT, PRIMARY KEY("k"))`)
+			So(err, ShouldBeNil)
+			for i := 0; i < rows; i++ {
+				_, err = st.Writer().Exec(
+					`INSERT INTO "t1" ("k", "v") VALUES (?, ?)`, i, fmt.Sprintf("v%d", i))
+				So(err, ShouldBeNil)
+			}
+			Convey("The storage should report its size", func() {
+				n, err = st.Size()
+				So(err, ShouldBeNil)
+				So(n, ShouldBeGreaterThan, 0)
+			})
+			Convey("The storage should be backed up online", func() {
+				var pinned bool
+				err = st.Backup(fmt.Sprint("file:", fl, ".bak"), func() {
+					pinned = true
+					// commits after the image is pinned are excluded from the backup
+					_, err := st.Writer().Exec(
+						`INSERT INTO "t1" ("k", "v") VALUES (?, ?)`, rows, "late")
+					So(err, ShouldBeNil)
+				})
+				So(err, ShouldBeNil)
+				So(pinned, ShouldBeTrue)
+				count, err := countRows(fmt.Sprint("file:", fl, ".bak"))
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, rows)
+			})
+			Convey("The storage snapshot should be loaded as a database file", func() {
+				var buf bytes.Buffer
+				err = st.Snapshot(&buf)
+				So(err, ShouldBeNil)
+				err = ioutil.WriteFile(fl+".snap", buf.Bytes(), 0600)
+				So(err, ShouldBeNil)
+				count, err := countRows(fmt.Sprint("file:", fl, ".snap"))
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, rows)
+			})
+			Convey("The storage should be restored from its snapshot", func() {
+				var buf bytes.Buffer
+				err = st.Snapshot(&buf)
+				So(err, ShouldBeNil)
+				_, err = st.Writer().Exec(`DELETE FROM "t1"`)
+				So(err, ShouldBeNil)
+				err = st.Restore(&buf)
+				So(err, ShouldBeNil)
+				var count int
+				err = st.Reader().QueryRow(`SELECT COUNT(1) FROM "t1"`).Scan(&count)
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, rows)
+			})
+		})
+	}
+	Convey("The in-memory storage should be dropped on close", t, func() {
+		var fl = fmt.Sprint("file:", path.Join(testingDataDir, t.Name(), "-volatile"))
+		st, err := NewMemory(fl)
+		So(err, ShouldBeNil)
+		_, err = st.Writer().Exec(`CREATE TABLE "t1" ("k" INT, "v" TEXT, PRIMARY KEY("k"))`)
+		So(err, ShouldBeNil)
+		err = st.Close()
+		So(err, ShouldBeNil)
+		st, err = NewMemory(fl)
+		So(err, ShouldBeNil)
+		defer st.Close()
+		_, err = st.Writer().Exec(`CREATE TABLE "t1" ("k" INT, "v" TEXT, PRIMARY KEY("k"))`)
+		So(err, ShouldBeNil)
+	})
+	Convey("Unknown storage engine should be rejected", t, func() {
+		_, err := NewStorage(types.StorageEngine("unknown"), "file:unknown")
+		So(errors.Cause(err), ShouldEqual, ErrUnknownEngine)
+	})
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"io"
+
+	"github.com/CovenantSQL/CovenantSQL/storage"
+)
+
+// Memory is the in-memory sqlite3 implementation of the xenomint/interfaces.Storage interface.
+// All the connections share a single page cache, so the data is dropped on close.
+//
+// Note that the shared page cache also holds the uncommitted pages of the writer, thus the
+// Reader of Memory is not isolated from the writer, and Snapshot/Backup can only proceed while
+// there is no open write transaction, or fail with ErrBackupBusy. It's intended for testing and
+// ephemeral databases.
+type Memory struct {
+	dsn         *storage.DSN
+	keeper      *sql.Conn // keeps the in-memory database alive
+	dirtyReader *sql.DB
+	reader      *sql.DB
+	writer      *sql.DB
+}
+
+// NewMemory returns a new Memory instance named by the file name of the filename DSN, other
+// parameters of the DSN are ignored.
+func NewMemory(filename string) (s *Memory, err error) {
+	var (
+		instance = &Memory{}
+		roDSN    string
+		rwDSN    string
+		dsn      *storage.DSN
+	)
+
+	if dsn, err = storage.NewDSN(filename); err != nil {
+		return
+	}
+
+	instance.dsn = &storage.DSN{}
+	instance.dsn.SetFileName(dsn.GetFileName())
+	instance.dsn.AddParam("mode", "memory")
+	instance.dsn.AddParam("cache", "shared")
+
+	dsnRO := instance.dsn.Clone()
+	dsnRO.AddParam("_query_only", "on")
+	roDSN = dsnRO.Format()
+	rwDSN = instance.dsn.Format()
+
+	defer func() {
+		if err != nil {
+			instance.Close()
+		}
+	}()
+	if instance.writer, err = sql.Open(serializableDriver, rwDSN); err != nil {
+		return
+	}
+	if instance.keeper, err = instance.writer.Conn(context.Background()); err != nil {
+		return
+	}
+	if instance.dirtyReader, err = sql.Open(dirtyReadDriver, roDSN); err != nil {
+		return
+	}
+	if instance.reader, err = sql.Open(serializableDriver, roDSN); err != nil {
+		return
+	}
+	s = instance
+	return
+}
+
+// DirtyReader implements DirtyReader method of the xenomint/interfaces.Storage interface.
+func (s *Memory) DirtyReader() *sql.DB {
+	return s.dirtyReader
+}
+
+// Reader implements Reader method of the xenomint/interfaces.Storage interface.
+func (s *Memory) Reader() *sql.DB {
+	return s.reader
+}
+
+// Writer implements Writer method of the xenomint/interfaces.Storage interface.
+func (s *Memory) Writer() *sql.DB {
+	return s.writer
+}
+
+// Snapshot implements Snapshot method of the xenomint/interfaces.Storage interface.
+func (s *Memory) Snapshot(w io.Writer) error {
+	// the snapshot file is a plain on-disk database
+	return snapshot(s.reader, &storage.DSN{}, w)
+}
+
+// Restore implements Restore method of the xenomint/interfaces.Storage interface.
+func (s *Memory) Restore(r io.Reader) error {
+	return restore(s.writer, &storage.DSN{}, r)
+}
+
+// Backup implements Backup method of the xenomint/interfaces.Storage interface.
+func (s *Memory) Backup(filename string, pinned func()) (err error) {
+	// the reader is not isolated from the writer, so the image is only fixed after the copy
+	err = backup(s.reader, filename, nil)
+	if pinned != nil {
+		pinned()
+	}
+	return
+}
+
+// Size implements Size method of the xenomint/interfaces.Storage interface.
+func (s *Memory) Size() (int64, error) {
+	return size(s.reader)
+}
+
+// Close implements Close method of the xenomint/interfaces.Storage interface.
+func (s *Memory) Close() (err error) {
+	if s.dirtyReader != nil {
+		if err = s.dirtyReader.Close(); err != nil {
+			return
+		}
+	}
+	if s.reader != nil {
+		if err = s.reader.Close(); err != nil {
+			return
+		}
+	}
+	if s.keeper != nil {
+		if err = s.keeper.Close(); err != nil {
+			return
+		}
+		s.keeper = nil
+	}
+	if s.writer != nil {
+		if err = s.writer.Close(); err != nil {
+			return
+		}
+	}
+	return
+}
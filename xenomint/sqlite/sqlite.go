@@ -18,6 +18,7 @@ package sqlite
 
 import (
 	"database/sql"
+	"io"
 	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/storage"
@@ -61,6 +62,7 @@ func init() {
 // SQLite3 is the sqlite3 implementation of the xenomint/interfaces.Storage interface.
 type SQLite3 struct {
 	filename    string
+	dsn         *storage.DSN
 	dirtyReader *sql.DB
 	reader      *sql.DB
 	writer      *sql.DB
@@ -79,6 +81,7 @@ func NewSqlite(filename string) (s *SQLite3, err error) {
 	if dsn, err = storage.NewDSN(filename); err != nil {
 		return
 	}
+	instance.dsn = dsn
 
 	dsnRO := dsn.Clone()
 	dsnRO.AddParam("_journal_mode", "WAL")
@@ -124,6 +127,27 @@ func (s *SQLite3) Writer() *sql.DB {
 	return s.writer
 }
 
+// Snapshot implements Snapshot method of the xenomint/interfaces.Storage interface.
+func (s *SQLite3) Snapshot(w io.Writer) error {
+	return snapshot(s.reader, s.dsn, w)
+}
+
+// Restore implements Restore method of the xenomint/interfaces.Storage interface.
+func (s *SQLite3) Restore(r io.Reader) error {
+	return restore(s.writer, s.dsn, r)
+}
+
+// Backup implements Backup method of the xenomint/interfaces.Storage interface.
+func (s *SQLite3) Backup(filename string, pinned func()) error {
+	// the private cache reader only sees the committed data
+	return backup(s.reader, filename, pinned)
+}
+
+// Size implements Size method of the xenomint/interfaces.Storage interface.
+func (s *SQLite3) Size() (int64, error) {
+	return size(s.reader)
+}
+
 // Close implements Close method of the xenomint/interfaces.Storage interface.
 func (s *SQLite3) Close() (err error) {
 	if err = s.dirtyReader.Close(); err != nil {
@@ -20,7 +20,6 @@ import (
 	"context"
 	"database/sql"
 	"io"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -28,8 +27,8 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/types"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/CovenantSQL/CovenantSQL/xenomint/dialect"
 	xi "github.com/CovenantSQL/CovenantSQL/xenomint/interfaces"
-	"github.com/CovenantSQL/sqlparser"
 	"github.com/pkg/errors"
 )
 
@@ -50,6 +49,11 @@ type State struct {
 	cmpoint         uint64 // cmpoint is the last commit point of the current transaction
 	current         uint64 // current is the current savepoint of the current transaction
 	hasSchemaChange uint32 // indicates schema change happens in this uncommitted transaction
+
+	// tx is the open interactive transaction session, which is only set or cleared while
+	// holding both the state lock and txLock, so that dirty reads can be ordered against it.
+	tx     *txSession
+	txLock sync.RWMutex
 }
 
 // NewState returns a new State bound to strg.
@@ -98,6 +102,163 @@ func (s *State) getID() uint64 {
 	return atomic.LoadUint64(&s.current)
 }
 
+// Storage returns the underlying storage of the state.
+func (s *State) Storage() xi.Storage {
+	return s.strg
+}
+
+// Backup copies the committed data of the underlying storage to filename and returns the next
+// query id of the backup, i.e. the id of the first query which is not included. Commits are only
+// blocked until the storage pins the image to copy.
+func (s *State) Backup(filename string) (id uint64, err error) {
+	var locked = true
+	s.Lock()
+	defer func() {
+		if locked {
+			s.Unlock()
+		}
+	}()
+	if err = s.strg.Backup(filename, func() {
+		id = s.origin
+		locked = false
+		s.Unlock()
+	}); err != nil {
+		err = errors.Wrap(err, "backup storage failed")
+		id = 0
+		return
+	}
+	return
+}
+
+// ReadCommitted calls fn with a read transaction on the committed data of the underlying storage
+// and the next query id of the data, i.e. the id of the first query which is not included.
+// Commits are only blocked until the transaction pins the data to read.
+func (s *State) ReadCommitted(ctx context.Context, fn func(id uint64, tx *sql.Tx) error) (err error) {
+	var (
+		tx *sql.Tx
+		id uint64
+	)
+	if id, tx, err = s.beginCommitted(ctx); err != nil {
+		return
+	}
+	defer tx.Rollback()
+	return fn(id, tx)
+}
+
+// beginCommitted opens a read transaction pinned on the committed data of the underlying storage
+// and returns it with the next query id of the data.
+func (s *State) beginCommitted(ctx context.Context) (id uint64, tx *sql.Tx, err error) {
+	var dummy int
+	s.RLock()
+	defer s.RUnlock()
+	if tx, err = s.strg.Reader().BeginTx(ctx, nil); err != nil {
+		err = errors.Wrap(err, "begin read transaction failed")
+		return
+	}
+	// the snapshot of the transaction is taken on the first read
+	if err = tx.QueryRowContext(ctx, `SELECT count(*) FROM "sqlite_master"`).Scan(&dummy); err != nil {
+		tx.Rollback()
+		tx = nil
+		err = errors.Wrap(err, "read storage failed")
+		return
+	}
+	id = s.origin
+	return
+}
+
+// Snapshot copies the committed data of the underlying storage to filename like Backup, and
+// calls pinned with the next query id of the copied image and the pooled writes following it,
+// which are not committed yet. The image and the writes together are the whole applied state,
+// see Restore. Commits are only blocked until pinned is called.
+func (s *State) Snapshot(filename string, pinned func(id uint64, queries []*QueryTracker)) (err error) {
+	var locked = true
+	s.Lock()
+	defer func() {
+		if locked {
+			s.Unlock()
+		}
+	}()
+
+	// the pool is truncated by the blocks of the uncommitted transaction, which can't be
+	// rebuilt until the transaction is committed
+	var (
+		sps  = make([]uint64, len(s.pool.queries))
+		next = s.origin
+	)
+	for sp, pos := range s.pool.index {
+		sps[pos] = sp
+	}
+	for i, q := range s.pool.queries {
+		if sps[i] != next {
+			err = errors.Wrapf(ErrQueryConflict, "pooled query %d vs expected %d", sps[i], next)
+			return
+		}
+		next += uint64(len(q.Req.Payload.Queries))
+	}
+	if next != s.getID() {
+		err = errors.Wrapf(ErrQueryConflict, "pooled queries end at %d vs id %d", next, s.getID())
+		return
+	}
+
+	if err = s.strg.Backup(filename, func() {
+		var (
+			id      = s.origin
+			queries = make([]*QueryTracker, len(s.pool.queries))
+		)
+		copy(queries, s.pool.queries)
+		locked = false
+		s.Unlock()
+		pinned(id, queries)
+	}); err != nil {
+		err = errors.Wrap(err, "snapshot storage failed")
+		return
+	}
+	return
+}
+
+// Restore replaces the whole state by the storage image with next query id and the uncommitted
+// writes following it, which are returned by Snapshot. Any open session is dropped.
+func (s *State) Restore(r io.Reader, id uint64, queries []*QueryTracker) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	if err = s.unc.Rollback(); err != nil {
+		err = errors.Wrap(err, "rollback uncommitted transaction failed")
+		return
+	}
+	s.setTx(nil)
+	if err = s.strg.Restore(r); err != nil {
+		err = errors.Wrap(err, "restore storage failed")
+	}
+	// the state keeps an open transaction anyway
+	var ierr error
+	if s.unc, ierr = s.strg.Writer().Begin(); ierr != nil {
+		// FATAL ERROR
+		if err == nil {
+			err = errors.Wrap(ierr, "open transaction failed")
+		}
+		return
+	}
+	if err != nil {
+		return
+	}
+	atomic.StoreUint32(&s.hasSchemaChange, 0)
+	s.pool = newPool()
+	s.InitTx(id)
+	for i, q := range queries {
+		var savepoint = s.getID()
+		for j, v := range q.Req.Payload.Queries {
+			if _, err = s.writeSingle(context.Background(), &v); err != nil {
+				err = errors.Wrapf(err, "replay pooled query at %d:%d failed", i, j)
+				s.rollbackTo(savepoint)
+				return
+			}
+		}
+		s.setSavepoint()
+		s.pool.enqueue(savepoint, q)
+	}
+	return
+}
+
 // Close commits any ongoing transaction if needed and closes the underlying storage.
 func (s *State) Close(commit bool) (err error) {
 	if s.closed {
@@ -107,6 +268,10 @@ func (s *State) Close(commit bool) (err error) {
 		if commit {
 			s.Lock()
 			defer s.Unlock()
+			// never persist speculative writes of an open session
+			if s.tx != nil {
+				s.endTx()
+			}
 			if err = s.uncCommit(); err != nil {
 				return
 			}
@@ -129,61 +294,22 @@ func (s *State) Close(commit bool) (err error) {
 	return
 }
 
-func convertQueryAndBuildArgs(pattern string, args []types.NamedArg) (containsDDL bool, p string, ifs []interface{}, err error) {
-	var (
-		tokenizer  = sqlparser.NewStringTokenizer(pattern)
-		stmt       sqlparser.Statement
-		lastPos    int
-		query      string
-		queryParts []string
-	)
-
-	for {
-		stmt, err = sqlparser.ParseNext(tokenizer)
-
-		if err != nil && err != io.EOF {
-			return
-		}
-
-		if err == io.EOF {
-			err = nil
-			break
-		}
-
-		query = pattern[lastPos : tokenizer.Position-1]
-		lastPos = tokenizer.Position + 1
-
-		// translate show statement
-		if showStmt, ok := stmt.(*sqlparser.Show); ok {
-			origQuery := query
-
-			switch showStmt.Type {
-			case "table":
-				if showStmt.ShowCreate {
-					query = "SELECT sql FROM sqlite_master WHERE type = \"table\" AND tbl_name = \"" +
-						showStmt.OnTable.Name.String() + "\""
-				} else {
-					query = "PRAGMA table_info(" + showStmt.OnTable.Name.String() + ")"
-				}
-			case "index":
-				query = "SELECT name FROM sqlite_master WHERE type = \"index\" AND tbl_name = \"" +
-					showStmt.OnTable.Name.String() + "\""
-			case "tables":
-				query = "SELECT name FROM sqlite_master WHERE type = \"table\""
-			}
-
-			log.WithFields(log.Fields{
-				"from": origQuery,
-				"to":   query,
-			}).Debug("query translated")
-		} else if _, ok := stmt.(*sqlparser.DDL); ok {
-			containsDDL = true
-		}
-
-		queryParts = append(queryParts, query)
+func convertQueryAndBuildArgs(
+	ctx context.Context, qer dialect.Querier, pattern string, args []types.NamedArg,
+) (
+	containsDDL bool, p string, ifs []interface{}, err error,
+) {
+	var t *dialect.Translation
+	if t, err = dialect.Translate(ctx, pattern, qer); err != nil {
+		return
 	}
-
-	p = strings.Join(queryParts, "; ")
+	if t.Query != pattern {
+		log.WithFields(log.Fields{
+			"from": pattern,
+			"to":   t.Query,
+		}).Debug("query translated")
+	}
+	containsDDL, p = t.ContainsDDL, t.Query
 
 	ifs = make([]interface{}, len(args))
 	for i, v := range args {
@@ -203,6 +329,17 @@ func buildTypeNamesFromSQLColumnTypes(types []*sql.ColumnType) (names []string)
 	return
 }
 
+func buildColumnMetasFromSQLColumnTypes(cols []*sql.ColumnType) (metas []types.ColumnMeta) {
+	metas = make([]types.ColumnMeta, len(cols))
+	for i, v := range cols {
+		// the sqlite driver reports every column as nullable, even for a NOT NULL column, so the
+		// column is only marked not nullable if the driver does so
+		var nullable, ok = v.Nullable()
+		metas[i] = types.ParseColumnMeta(v.DatabaseTypeName(), nullable || !ok)
+	}
+	return
+}
+
 type sqlQuerier interface {
 	Query(query string, args ...interface{}) (*sql.Rows, error)
 	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
@@ -211,7 +348,7 @@ type sqlQuerier interface {
 func readSingle(
 	ctx context.Context, qer sqlQuerier, q *types.Query,
 ) (
-	names []string, types []string, data [][]interface{}, err error,
+	names []string, ctypes []string, metas []types.ColumnMeta, data [][]interface{}, err error,
 ) {
 	var (
 		rows    *sql.Rows
@@ -220,7 +357,7 @@ func readSingle(
 		args    []interface{}
 	)
 
-	if _, pattern, args, err = convertQueryAndBuildArgs(q.Pattern, q.Args); err != nil {
+	if _, pattern, args, err = convertQueryAndBuildArgs(ctx, qer, q.Pattern, q.Args); err != nil {
 		return
 	}
 	if rows, err = qer.QueryContext(ctx, pattern, args...); err != nil {
@@ -234,7 +371,8 @@ func readSingle(
 	if cols, err = rows.ColumnTypes(); err != nil {
 		return
 	}
-	types = buildTypeNamesFromSQLColumnTypes(cols)
+	ctypes = buildTypeNamesFromSQLColumnTypes(cols)
+	metas = buildColumnMetasFromSQLColumnTypes(cols)
 	// Scan data row by row
 	data = make([][]interface{}, 0)
 	for rows.Next() {
@@ -250,6 +388,8 @@ func readSingle(
 		}
 		data = append(data, row)
 	}
+	// rows iteration may be interrupted by context cancellation
+	err = rows.Err()
 	return
 }
 
@@ -271,11 +411,12 @@ func (s *State) readWithContext(
 	var (
 		ierr           error
 		cnames, ctypes []string
+		cmetas         []types.ColumnMeta
 		data           [][]interface{}
 	)
 	// TODO(leventeliu): no need to run every read query here.
 	for i, v := range req.Payload.Queries {
-		if cnames, ctypes, data, ierr = readSingle(ctx, s.strg.DirtyReader(), &v); ierr != nil {
+		if cnames, ctypes, cmetas, data, ierr = readSingle(ctx, s.strg.DirtyReader(), &v); ierr != nil {
 			err = errors.Wrapf(ierr, "query at #%d failed", i)
 			// Add to failed pool list
 			s.pool.setFailed(req)
@@ -295,9 +436,10 @@ func (s *State) readWithContext(
 			},
 		},
 		Payload: types.ResponsePayload{
-			Columns:   cnames,
-			DeclTypes: ctypes,
-			Rows:      buildRowsFromNativeData(data),
+			Columns:     cnames,
+			DeclTypes:   ctypes,
+			Rows:        buildRowsFromNativeData(data),
+			ColumnMetas: cmetas,
 		},
 	}
 	return
@@ -311,6 +453,7 @@ func (s *State) readTx(
 		id             uint64
 		ierr           error
 		cnames, ctypes []string
+		cmetas         []types.ColumnMeta
 		data           [][]interface{}
 		querier        sqlQuerier
 	)
@@ -318,13 +461,26 @@ func (s *State) readTx(
 		// lock transaction
 		s.Lock()
 		defer s.Unlock()
-		id = s.getID()
-		s.setSavepoint()
-		querier = s.unc
-		defer s.rollbackTo(id)
+		if s.tx != nil {
+			// the uncommitted transaction holds the speculative writes of the open session, read
+			// the committed data instead
+			id = s.origin
+			if tx, ierr = s.strg.Reader().BeginTx(ctx, nil); ierr != nil {
+				err = errors.Wrap(ierr, "open tx failed")
+				return
+			}
+			querier = tx
+			defer tx.Rollback()
+		} else {
+			id = s.getID()
+			s.setSavepoint()
+			querier = s.unc
+			defer s.rollbackTo(id)
+		}
 
 		// TODO(): should detect query type, any timeout write query will cause underlying transaction to rollback
-	} else {
+	} else if s.lockDirtyRead() {
+		defer s.txLock.RUnlock()
 		id = s.getID()
 		if tx, ierr = s.strg.DirtyReader().Begin(); ierr != nil {
 			err = errors.Wrap(ierr, "open tx failed")
@@ -332,6 +488,14 @@ func (s *State) readTx(
 		}
 		querier = tx
 		defer tx.Rollback()
+	} else {
+		// an interactive transaction session is open, read the committed data instead
+		if id, tx, ierr = s.beginCommitted(ctx); ierr != nil {
+			err = errors.Wrap(ierr, "open tx failed")
+			return
+		}
+		querier = tx
+		defer tx.Rollback()
 	}
 
 	defer func() {
@@ -345,7 +509,7 @@ func (s *State) readTx(
 	}()
 
 	for i, v := range req.Payload.Queries {
-		if cnames, ctypes, data, ierr = readSingle(ctx, querier, &v); ierr != nil {
+		if cnames, ctypes, cmetas, data, ierr = readSingle(ctx, querier, &v); ierr != nil {
 			err = errors.Wrapf(ierr, "query at #%d failed", i)
 			// Add to failed pool list
 			s.pool.setFailed(req)
@@ -365,9 +529,10 @@ func (s *State) readTx(
 			},
 		},
 		Payload: types.ResponsePayload{
-			Columns:   cnames,
-			DeclTypes: ctypes,
-			Rows:      buildRowsFromNativeData(data),
+			Columns:     cnames,
+			DeclTypes:   ctypes,
+			Rows:        buildRowsFromNativeData(data),
+			ColumnMetas: cmetas,
 		},
 	}
 	return
@@ -382,7 +547,9 @@ func (s *State) writeSingle(
 		args        []interface{}
 	)
 
-	if containsDDL, pattern, args, err = convertQueryAndBuildArgs(q.Pattern, q.Args); err != nil {
+	if containsDDL, pattern, args, err = convertQueryAndBuildArgs(
+		ctx, s.unc, q.Pattern, q.Args,
+	); err != nil {
 		return
 	}
 	if res, err = s.unc.ExecContext(ctx, pattern, args...); err == nil {
@@ -509,8 +676,14 @@ func (s *State) ReplayBlockWithContext(ctx context.Context, block *types.Block)
 	)
 	s.Lock()
 	defer s.Unlock()
+	s.suspendTx()
+	defer s.resumeTx(ctx)
 	for i, q := range block.QueryTxs {
 		var query = &QueryTracker{Req: q.Request, Resp: &types.Response{Header: *q.Response}}
+		if q.Response.ResponseHeader.LogOffset < s.origin {
+			// already committed, e.g. restored from a snapshot
+			continue
+		}
 		lastsp = s.getID()
 		if q.Response.ResponseHeader.LogOffset > lastsp {
 			err = ErrMissingParent
@@ -572,6 +745,8 @@ func (s *State) ReplayBlockWithContext(ctx context.Context, block *types.Block)
 func (s *State) commit() (err error) {
 	s.Lock()
 	defer s.Unlock()
+	s.suspendTx()
+	defer s.resumeTx(context.Background())
 	if err = s.uncCommit(); err != nil {
 		return
 	}
@@ -597,6 +772,8 @@ func (s *State) CommitExWithContext(
 ) {
 	s.Lock()
 	defer s.Unlock()
+	s.suspendTx()
+	defer s.resumeTx(ctx)
 	if err = s.uncCommit(); err != nil {
 		// FATAL ERROR
 		return
@@ -17,11 +17,13 @@
 package xenomint
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
 	"path"
 	"testing"
+	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
@@ -130,6 +132,50 @@ func TestState(t *testing.T) {
 			So(err, ShouldBeNil)
 			So(resp, ShouldNotBeNil)
 			err = st2.commit()
+			Convey("The state should be restored from the snapshot of another state", func() {
+				for i, v := range values {
+					_, _, err = st1.Query(buildRequest(types.WriteQuery, []types.Query{
+						buildQuery(`INSERT INTO t1 (k, v) VALUES (?, ?)`, v...),
+					}))
+					So(err, ShouldBeNil)
+					if i == 1 {
+						// the following writes are pooled and not committed yet
+						err = st1.commit()
+						So(err, ShouldBeNil)
+					}
+				}
+				var (
+					fl      = path.Join(testingDataDir, fmt.Sprint(t.Name(), "snapshot"))
+					f       *os.File
+					id      uint64
+					queries []*QueryTracker
+				)
+				defer os.Remove(fl)
+				err = st1.Snapshot(fmt.Sprint("file:", fl), func(i uint64, qs []*QueryTracker) {
+					id, queries = i, qs
+				})
+				So(err, ShouldBeNil)
+				So(id, ShouldEqual, st1.origin)
+				So(len(queries), ShouldEqual, 2)
+				f, err = os.Open(fl)
+				So(err, ShouldBeNil)
+				defer f.Close()
+				err = st2.Restore(f, id, queries)
+				So(err, ShouldBeNil)
+				So(st2.getID(), ShouldEqual, st1.getID())
+				So(st2.pool.queries, ShouldResemble, st1.pool.queries)
+				for i := range values {
+					var resp1, resp2 *types.Response
+					req = buildRequest(types.ReadQuery, []types.Query{
+						buildQuery(`SELECT v FROM t1 WHERE k=?`, values[i][0]),
+					})
+					_, resp1, err = st1.Query(req)
+					So(err, ShouldBeNil)
+					_, resp2, err = st2.Query(req)
+					So(err, ShouldBeNil)
+					So(resp2.Payload, ShouldResemble, resp1.Payload)
+				}
+			})
 			Convey("The state should not change after attempted writing in read query", func() {
 				_, resp, err = st1.Query(buildRequest(types.ReadQuery, []types.Query{
 					buildQuery(`INSERT INTO t1 (k, v) VALUES (?, ?)`, 1, "v1"),
@@ -141,6 +187,25 @@ func TestState(t *testing.T) {
 				So(err, ShouldBeNil)
 				So(resp.Header.RowCount, ShouldEqual, 0)
 			})
+			Convey("The state should interrupt the running read query on context timeout", func() {
+				var qs = make([]types.Query, 100)
+				for i := range qs {
+					qs[i] = buildQuery(`INSERT INTO t1 (k, v) VALUES (?, ?)`, i, "v")
+				}
+				_, resp, err = st1.Query(buildRequest(types.WriteQuery, qs))
+				So(err, ShouldBeNil)
+				err = st1.commit()
+				So(err, ShouldBeNil)
+				ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+				defer cancel()
+				var start = time.Now()
+				_, resp, err = st1.QueryWithContext(ctx, buildRequest(types.ReadQuery, []types.Query{
+					buildQuery(`SELECT COUNT(1) FROM t1 a, t1 b, t1 c, t1 d, t1 e`),
+				}))
+				So(err, ShouldNotBeNil)
+				So(resp, ShouldBeNil)
+				So(time.Since(start), ShouldBeLessThan, 10*time.Second)
+			})
 			Convey("The state should report invalid request with unknown query type", func() {
 				req = buildRequest(types.QueryType(0xff), []types.Query{
 					buildQuery(`INSERT INTO t1 (k, v) VALUES (?, ?)`, values[0]...),
@@ -218,7 +283,10 @@ func TestState(t *testing.T) {
 				So(resp.Payload, ShouldResemble, types.ResponsePayload{
 					Columns:   []string{"v"},
 					DeclTypes: []string{"TEXT"},
-					Rows:      []types.ResponseRow{{Values: values[0][1:]}},
+					ColumnMetas: []types.ColumnMeta{
+						types.ParseColumnMeta("TEXT", true),
+					},
+					Rows: []types.ResponseRow{{Values: values[0][1:]}},
 				})
 				st1.Stat(id1)
 
@@ -237,6 +305,9 @@ INSERT INTO t1 (k, v) VALUES (?, ?)`, concat(values[2:4])...),
 				So(resp.Payload, ShouldResemble, types.ResponsePayload{
 					Columns:   []string{"v"},
 					DeclTypes: []string{"TEXT"},
+					ColumnMetas: []types.ColumnMeta{
+						types.ParseColumnMeta("TEXT", true),
+					},
 					Rows: []types.ResponseRow{
 						{Values: values[0][1:]},
 						{Values: values[1][1:]},
@@ -253,6 +324,10 @@ INSERT INTO t1 (k, v) VALUES (?, ?)`, concat(values[2:4])...),
 				So(resp.Payload, ShouldResemble, types.ResponsePayload{
 					Columns:   []string{"k", "v"},
 					DeclTypes: []string{"INT", "TEXT"},
+					ColumnMetas: []types.ColumnMeta{
+						types.ParseColumnMeta("INT", true),
+						types.ParseColumnMeta("TEXT", true),
+					},
 					Rows: []types.ResponseRow{
 						{Values: values[0][:]},
 						{Values: values[1][:]},
@@ -293,6 +368,10 @@ INSERT INTO t1 (k, v) VALUES (?, ?)`, concat(values[2:4])...),
 				So(resp.Payload, ShouldResemble, types.ResponsePayload{
 					Columns:   []string{"k", "v"},
 					DeclTypes: []string{"INT", "TEXT"},
+					ColumnMetas: []types.ColumnMeta{
+						types.ParseColumnMeta("INT", true),
+						types.ParseColumnMeta("TEXT", true),
+					},
 					Rows: []types.ResponseRow{
 						{Values: values[0][:]},
 						{Values: values[1][:]},